@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// CompressBlocks rewrites the stored blocks compressed, from the root up to the highest height
+// with blocks, to migrate a DB after enabling CfgStorageCompressBlocks. The blocks are read
+// the same way whether compressed or not, so the migration can be interrupted and rerun. It
+// holds the chain lock throughout, and is meant to run while the node is stopped. It returns
+// the number of blocks rewritten.
+func (ch *Chain) CompressBlocks() (int, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	root, err := ch.findBlock(ch.root)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to find the root block: %v", err)
+	}
+
+	target := ch
+	var buffered store.BufferedStore
+	if creator, ok := ch.store.(bufferedStoreCreator); ok {
+		buffered = creator.NewBufferedStore()
+		batchChain := *ch
+		batchChain.store = buffered
+		target = &batchChain
+	}
+	commit := func() error {
+		if buffered == nil {
+			return nil
+		}
+		return buffered.Commit()
+	}
+
+	count := 0
+	for height := root.Height; ; height++ {
+		blocks := target.findBlocksByHeight(height)
+		if len(blocks) == 0 && height > ch.finalizedHeight {
+			break
+		}
+		for _, block := range blocks {
+			hash := block.Hash()
+			if err := target.store.Put(hash[:], kvstore.Compressed{Value: block}); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if buffered != nil && buffered.PendingSize() >= ch.addBlocksBatchBytes {
+			if err := commit(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, commit()
+}
@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestCompressBlocks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	db := backend.NewMemDatabase()
+	chain := NewChain("testchain", kvstore.NewKVStore(db), core.CreateTestBlock("a0", ""))
+
+	addBlock := func(name, parent string) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = []common.Bytes{make(common.Bytes, 4000)}
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+	a1 := addBlock("a1", "a0")
+	a2 := addBlock("a2", "a1")
+	b2 := addBlock("b2", "a1")
+	require.Nil(chain.FinalizePreviousBlocks(a1.Hash()))
+
+	rawSize := func(block *core.Block) int {
+		hash := block.Hash()
+		raw, err := db.Get(hash[:])
+		require.Nil(err)
+		return len(raw)
+	}
+	uncompressed := rawSize(b2)
+
+	// The blocks saved once enabled are compressed, the others are left as is until migrated.
+	chain.compressBlocks = true
+	a3 := addBlock("a3", "a2")
+	assert.True(rawSize(a3) < uncompressed/2)
+	assert.True(rawSize(a2) < uncompressed/2) // saved with its new child
+	assert.Equal(uncompressed, rawSize(b2))
+
+	// The existing blocks are migrated, including the forks and the pending blocks.
+	count, err := chain.CompressBlocks()
+	require.Nil(err)
+	assert.Equal(5, count)
+	for _, block := range []*core.Block{a1, a2, b2} {
+		assert.True(rawSize(block) < uncompressed/2)
+	}
+
+	// The reads are transparent.
+	block, err := chain.FindBlock(a2.Hash())
+	require.Nil(err)
+	assert.Equal(a2.Txs, block.Txs)
+	assert.Equal([]common.Hash{a3.Hash()}, block.Children)
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store"
+)
+
+// BlockIterator walks the finalized blocks of a height range in increasing height. It is not
+// safe for concurrent use.
+//
+//	it := chain.IterateBlocks(start, end, nil)
+//	for it.Next() {
+//		block := it.Block()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type BlockIterator struct {
+	chain     *Chain
+	height    uint64
+	endHeight uint64
+	filterFn  func(block *core.ExtendedBlock) bool
+	done      bool
+
+	block *core.ExtendedBlock
+	err   error
+}
+
+// IterateBlocks returns an iterator over the finalized blocks from the start height to the end
+// height, both included, and capped at the finalized height. The blocks are looked up through
+// the height index, the heights without a finalized block (e.g. below the snapshot) are
+// skipped. If filterFn is not nil, only the blocks it accepts are returned.
+func (ch *Chain) IterateBlocks(startHeight, endHeight uint64, filterFn func(block *core.ExtendedBlock) bool) *BlockIterator {
+	ch.mu.RLock()
+	if endHeight > ch.finalizedHeight {
+		endHeight = ch.finalizedHeight
+	}
+	ch.mu.RUnlock()
+
+	return &BlockIterator{
+		chain:     ch,
+		height:    startHeight,
+		endHeight: endHeight,
+		filterFn:  filterFn,
+		done:      startHeight > endHeight,
+	}
+}
+
+// Next moves to the next finalized block accepted by the filter. It returns false when the
+// range is exhausted or an error occurred.
+func (it *BlockIterator) Next() bool {
+	it.block = nil
+	for !it.done {
+		block, err := it.chain.FindFinalizedBlockByHeight(it.height)
+		if it.height == it.endHeight {
+			it.done = true
+		} else {
+			it.height++
+		}
+		if err != nil {
+			it.err = err
+			it.done = true
+			return false
+		}
+		if block == nil || it.filterFn != nil && !it.filterFn(block) {
+			continue
+		}
+		it.block = block
+		return true
+	}
+	return false
+}
+
+// Block returns the current block.
+func (it *BlockIterator) Block() *core.ExtendedBlock {
+	return it.block
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *BlockIterator) Err() error {
+	return it.err
+}
+
+// FindFinalizedBlockByHeight returns the finalized block at the height, nil if there is none.
+// The latest finalized blocks are served from memory. Unlike FindBlocksByHeight, the blocks of
+// the other branches are not all decoded once the finalized block is found.
+func (ch *Chain) FindFinalizedBlockByHeight(height uint64) (*core.ExtendedBlock, error) {
+	if block := ch.canonicalBlocks.getByHeight(height); block != nil {
+		return block, nil
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	blockByHeightIndexEntry := BlockByHeightIndexEntry{
+		Blocks: []common.Hash{},
+	}
+	err := ch.store.Get(blockByHeightIndexKey(height), &blockByHeightIndexEntry)
+	if err == store.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range blockByHeightIndexEntry.Blocks {
+		block, err := ch.findBlock(hash)
+		if err == store.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block.Status.IsFinalized() {
+			ch.canonicalBlocks.add(block)
+			return block, nil
+		}
+	}
+	return nil, nil
+}
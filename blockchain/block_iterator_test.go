@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestIterateBlocks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = txs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	a1 := addBlock("a1", "a0", common.Bytes("tx1"))
+	addBlock("b2", "a1", common.Bytes("tx2"))
+	a2 := addBlock("a2", "a1")
+	a3 := addBlock("a3", "a2", common.Bytes("tx3"))
+	addBlock("a4", "a3")
+	require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+
+	collect := func(it *BlockIterator) []common.Hash {
+		hashes := []common.Hash{}
+		for it.Next() {
+			hashes = append(hashes, it.Block().Hash())
+		}
+		require.Nil(it.Err())
+		return hashes
+	}
+
+	// The fork and the blocks above the finalized height are skipped.
+	assert.Equal([]common.Hash{a1.Hash(), a2.Hash(), a3.Hash()}, collect(chain.IterateBlocks(1, 100, nil)))
+	assert.Equal([]common.Hash{a2.Hash()}, collect(chain.IterateBlocks(2, 2, nil)))
+
+	withTxs := func(block *core.ExtendedBlock) bool {
+		return len(block.Txs) > 0
+	}
+	assert.Equal([]common.Hash{a1.Hash(), a3.Hash()}, collect(chain.IterateBlocks(0, 100, withTxs)))
+
+	assert.Empty(collect(chain.IterateBlocks(3, 2, nil)))
+	assert.Empty(collect(chain.IterateBlocks(4, 100, nil)))
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func blockMetadataKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("bm/"), hash[:]...)
+}
+
+// BlockMetadata records who produced and voted for a finalized block, and the rewards it
+// distributed.
+type BlockMetadata struct {
+	Proposer      common.Address
+	Validators    []common.Address // the validator set voting on the block
+	Participation []byte           // bit i (LSB first) is set if Validators[i] voted for the block
+	Rewards       []BlockReward
+}
+
+// BlockReward is a reward paid by the coinbase transaction of a block.
+type BlockReward struct {
+	Address common.Address
+	Coins   types.Coins
+}
+
+// NewBlockMetadata computes the metadata of the block from the validator set voting on it and
+// the votes received for it.
+func NewBlockMetadata(block *core.Block, validators *core.ValidatorSet, votes *core.VoteSet) *BlockMetadata {
+	voted := make(map[common.Address]bool)
+	for _, vote := range votes.Votes() {
+		if vote.Block == block.Hash() {
+			voted[vote.ID] = true
+		}
+	}
+
+	metadata := &BlockMetadata{
+		Proposer:   block.Proposer,
+		Validators: []common.Address{},
+		Rewards:    []BlockReward{},
+	}
+	vals := validators.Validators()
+	metadata.Participation = make([]byte, (len(vals)+7)/8)
+	for i, v := range vals {
+		metadata.Validators = append(metadata.Validators, v.Address)
+		if voted[v.Address] {
+			metadata.Participation[i/8] |= 1 << uint(i%8)
+		}
+	}
+
+	for _, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			continue
+		}
+		if coinbaseTx, ok := tx.(*types.CoinbaseTx); ok {
+			for _, output := range coinbaseTx.Outputs {
+				metadata.Rewards = append(metadata.Rewards, BlockReward{
+					Address: output.Address,
+					Coins:   output.Coins,
+				})
+			}
+		}
+	}
+	return metadata
+}
+
+// Voted returns whether the validator voted for the block.
+func (m *BlockMetadata) Voted(validator common.Address) bool {
+	for i, address := range m.Validators {
+		if address == validator {
+			return m.Participation[i/8]&(1<<uint(i%8)) != 0
+		}
+	}
+	return false
+}
+
+// NumVoters returns the number of validators who voted for the block.
+func (m *BlockMetadata) NumVoters() int {
+	count := 0
+	for i := range m.Validators {
+		if m.Participation[i/8]&(1<<uint(i%8)) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// RecordsBlockMetadata returns whether the metadata of the finalized blocks is recorded.
+func (ch *Chain) RecordsBlockMetadata() bool {
+	return ch.recordBlockMetadata
+}
+
+// SaveBlockMetadata saves the metadata of the block.
+func (ch *Chain) SaveBlockMetadata(hash common.Hash, metadata *BlockMetadata) error {
+	return ch.store.Put(blockMetadataKey(hash), metadata)
+}
+
+// GetBlockMetadata returns the metadata recorded for the block.
+func (ch *Chain) GetBlockMetadata(hash common.Hash) (*BlockMetadata, error) {
+	if !ch.recordBlockMetadata {
+		return nil, fmt.Errorf("The block metadata is not recorded, see %v", common.CfgStorageRecordBlockMetadata)
+	}
+	metadata := &BlockMetadata{}
+	if err := ch.store.Get(blockMetadataKey(hash), metadata); err != nil {
+		return nil, fmt.Errorf("Failed to find the metadata of block %v: %v", hash.Hex(), err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestBlockMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	rewarded := common.HexToAddress("0xabc")
+	coinbaseTx := &types.CoinbaseTx{
+		Proposer: types.TxInput{Address: core.GetTestBlock("a0").Proposer},
+		Outputs: []types.TxOutput{
+			{Address: rewarded, Coins: types.NewCoins(0, 48)},
+		},
+		BlockHeight: 1,
+	}
+	rawTx, err := types.TxToBytes(coinbaseTx)
+	require.Nil(err)
+	block := core.CreateTestBlock("a1", "a0")
+	block.AddTxs([]common.Bytes{rawTx})
+	_, err = chain.AddBlock(block)
+	require.Nil(err)
+
+	validators := core.NewValidatorSet()
+	addresses := []common.Address{}
+	for i := 1; i <= 10; i++ {
+		address := common.HexToAddress(fmt.Sprintf("0x%x", i))
+		addresses = append(addresses, address)
+		validators.AddValidator(core.Validator{Address: address, Stake: big.NewInt(100)})
+	}
+	votes := core.NewVoteSet()
+	for _, i := range []int{0, 7, 9} {
+		votes.AddVote(core.Vote{Block: block.Hash(), ID: addresses[i], Epoch: 1})
+	}
+	// The votes for other blocks are ignored.
+	votes.AddVote(core.Vote{Block: block.Parent, ID: addresses[1], Epoch: 1})
+
+	metadata := NewBlockMetadata(block, validators, votes)
+	assert.Equal(block.Proposer, metadata.Proposer)
+	assert.Equal(10, len(metadata.Validators))
+	assert.Equal([]byte{0x81, 0x02}, metadata.Participation)
+	assert.Equal(3, metadata.NumVoters())
+	assert.True(metadata.Voted(addresses[7]))
+	assert.False(metadata.Voted(addresses[1]))
+	assert.False(metadata.Voted(common.HexToAddress("0xff")))
+	require.Equal(1, len(metadata.Rewards))
+	assert.Equal(rewarded, metadata.Rewards[0].Address)
+	assert.Equal(int64(48), metadata.Rewards[0].Coins.TFuelWei.Int64())
+
+	// The metadata is only served if recorded.
+	require.Nil(chain.SaveBlockMetadata(block.Hash(), metadata))
+	_, err = chain.GetBlockMetadata(block.Hash())
+	assert.NotNil(err)
+
+	viper.Set(common.CfgStorageRecordBlockMetadata, true)
+	defer viper.Set(common.CfgStorageRecordBlockMetadata, false)
+	chain.recordBlockMetadata = viper.GetBool(common.CfgStorageRecordBlockMetadata)
+
+	saved, err := chain.GetBlockMetadata(block.Hash())
+	require.Nil(err)
+	assert.Equal(metadata.Participation, saved.Participation)
+	assert.Equal(metadata.Validators, saved.Validators)
+	assert.Equal(3, saved.NumVoters())
+	_, err = chain.GetBlockMetadata(block.Parent)
+	assert.NotNil(err)
+}
@@ -0,0 +1,11 @@
+package blockchain
+
+import (
+	"github.com/thetatoken/theta/core"
+)
+
+// GetBlockTrioByHeight looks up the block trio proving the validator set change at the given
+// height, saved when a snapshot was loaded. The error is store.ErrKeyNotFound if there is none.
+func (ch *Chain) GetBlockTrioByHeight(height uint64) (*core.SnapshotBlockTrio, error) {
+	return core.GetBlockTrioByHeight(ch.store, height)
+}
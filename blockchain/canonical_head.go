@@ -0,0 +1,220 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store"
+)
+
+// canonicalHeadKey is the DB key of the latest directly finalized block.
+var canonicalHeadKey = common.Bytes("ch/head")
+
+// CanonicalHead identifies the latest directly finalized block.
+type CanonicalHead struct {
+	Hash   common.Hash
+	Height uint64
+}
+
+// CanonicalHead returns the latest directly finalized block.
+func (ch *Chain) CanonicalHead() CanonicalHead {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.head
+}
+
+// loadCanonicalHead restores the finalized height saved by the last run, if any.
+func (ch *Chain) loadCanonicalHead() {
+	head := CanonicalHead{}
+	err := ch.store.Get(canonicalHeadKey, &head)
+	if err == store.ErrKeyNotFound {
+		return
+	}
+	if err != nil {
+		logger.Panic(err)
+	}
+	ch.head = head
+	ch.finalizedHeight = head.Height
+	ch.canonicalBlocks.setHeadHeight(head.Height)
+}
+
+// setCanonicalHead makes the directly finalized block the head if it is above the current one.
+// It is called as part of the finalization, so the head record is written in the same batch
+// as the block status.
+func (ch *Chain) setCanonicalHead(block *core.ExtendedBlock) {
+	if block.Height <= ch.finalizedHeight && !ch.head.Hash.IsEmpty() {
+		return
+	}
+	head := CanonicalHead{Hash: block.Hash(), Height: block.Height}
+	if err := ch.store.Put(canonicalHeadKey, head); err != nil {
+		logger.Panic(err)
+	}
+	ch.head = head
+	ch.finalizedHeight = block.Height
+}
+
+// withBatch runs fn on a copy of the chain whose writes are buffered, and commits them in a
+// single batch if the store supports it, so that a crash never leaves a partial update in the
+// DB. If fn fails, the writes are discarded and the chain is left unchanged. Otherwise the
+// canonical head set by fn is kept once the writes are committed.
+func (ch *Chain) withBatch(fn func(target *Chain) error) error {
+	creator, ok := ch.store.(bufferedStoreCreator)
+	if !ok {
+		return fn(ch)
+	}
+	batchChain := ch.newBatchChain(creator.NewBufferedStore())
+	if err := fn(batchChain); err != nil {
+		return err
+	}
+	if err := ch.commitBatch(batchChain); err != nil {
+		return err
+	}
+	ch.head = batchChain.head
+	ch.finalizedHeight = batchChain.finalizedHeight
+	return nil
+}
+
+// newBatchChain returns a copy of the chain writing to the buffered store. The cached copies
+// of the blocks saved through the batch chain are refreshed by commitBatch.
+func (ch *Chain) newBatchChain(buffered store.BufferedStore) *Chain {
+	batchChain := *ch
+	batchChain.store = buffered
+	batchChain.savedBlocks = []*core.ExtendedBlock{}
+	return &batchChain
+}
+
+// commitBatch commits the buffered writes of the batch chain, and then refreshes the cached
+// copies of the blocks saved since the last commit.
+func (ch *Chain) commitBatch(batchChain *Chain) error {
+	if err := batchChain.store.(store.BufferedStore).Commit(); err != nil {
+		return err
+	}
+	for _, block := range batchChain.savedBlocks {
+		ch.canonicalBlocks.update(block)
+	}
+	batchChain.savedBlocks = batchChain.savedBlocks[:0]
+	return nil
+}
+
+// canonicalBlockCache holds the latest finalized blocks, so that the reads of the recent
+// blocks don't hit the DB. It returns copies, which the callers are free to modify. A nil
+// cache holds nothing.
+type canonicalBlockCache struct {
+	mu         sync.RWMutex
+	size       uint64
+	headHeight uint64
+	byHeight   map[uint64]*core.ExtendedBlock
+	byHash     map[common.Hash]*core.ExtendedBlock
+}
+
+func newCanonicalBlockCache(size uint64) *canonicalBlockCache {
+	if size == 0 {
+		return nil
+	}
+	return &canonicalBlockCache{
+		size:     size,
+		byHeight: make(map[uint64]*core.ExtendedBlock),
+		byHash:   make(map[common.Hash]*core.ExtendedBlock),
+	}
+}
+
+// setHeadHeight moves the window of the cached heights up to the head height.
+func (c *canonicalBlockCache) setHeadHeight(height uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if height <= c.headHeight {
+		return
+	}
+	c.headHeight = height
+	for h, block := range c.byHeight {
+		if !c.inWindow(h) {
+			delete(c.byHeight, h)
+			delete(c.byHash, block.Hash())
+		}
+	}
+}
+
+// add caches the block if it is finalized and within the latest heights.
+func (c *canonicalBlockCache) add(block *core.ExtendedBlock) {
+	if c == nil || !block.Status.IsFinalized() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.inWindow(block.Height) {
+		return
+	}
+	if old, ok := c.byHeight[block.Height]; ok {
+		delete(c.byHash, old.Hash())
+	}
+	block = copyExtendedBlock(block)
+	c.byHeight[block.Height] = block
+	c.byHash[block.Hash()] = block
+}
+
+// update refreshes the cached copy of the saved block, or drops it if it is no longer
+// finalized.
+func (c *canonicalBlockCache) update(block *core.ExtendedBlock) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hash := block.Hash()
+	if _, ok := c.byHash[hash]; !ok {
+		return
+	}
+	if !block.Status.IsFinalized() {
+		delete(c.byHash, hash)
+		delete(c.byHeight, block.Height)
+		return
+	}
+	block = copyExtendedBlock(block)
+	c.byHeight[block.Height] = block
+	c.byHash[hash] = block
+}
+
+func (c *canonicalBlockCache) getByHeight(height uint64) *core.ExtendedBlock {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if block, ok := c.byHeight[height]; ok {
+		return copyExtendedBlock(block)
+	}
+	return nil
+}
+
+func (c *canonicalBlockCache) getByHash(hash common.Hash) *core.ExtendedBlock {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if block, ok := c.byHash[hash]; ok {
+		return copyExtendedBlock(block)
+	}
+	return nil
+}
+
+func (c *canonicalBlockCache) inWindow(height uint64) bool {
+	return height+c.size > c.headHeight
+}
+
+// copyExtendedBlock returns a copy of the block which can be modified without affecting the
+// original. The block itself is shared, it is never modified once added.
+func copyExtendedBlock(block *core.ExtendedBlock) *core.ExtendedBlock {
+	c := *block
+	c.Children = append([]common.Hash{}, block.Children...)
+	return &c
+}
@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestCanonicalHead(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	viper.Set(common.CfgStorageCanonicalBlockCacheSize, 2)
+	defer viper.Set(common.CfgStorageCanonicalBlockCacheSize, 256)
+
+	core.ResetTestBlocks()
+	db := backend.NewMemDatabase()
+	chain := NewChain("testchain", kvstore.NewKVStore(db), core.CreateTestBlock("a0", ""))
+	assert.Equal(core.GetTestBlock("a0").Hash(), chain.CanonicalHead().Hash)
+
+	for _, pair := range [][2]string{{"a1", "a0"}, {"a2", "a1"}, {"a3", "a2"}, {"b3", "a2"}, {"a4", "a3"}} {
+		_, err := chain.AddBlock(core.CreateTestBlock(pair[0], pair[1]))
+		require.Nil(err)
+	}
+	a3 := core.GetTestBlock("a3").Hash()
+	require.Nil(chain.FinalizePreviousBlocks(a3))
+	assert.Equal(CanonicalHead{Hash: a3, Height: 3}, chain.CanonicalHead())
+
+	// The head is restored when the chain is reopened.
+	reopened := NewChain("testchain", kvstore.NewKVStore(db), core.CreateTestBlock("a0", ""))
+	assert.Equal(CanonicalHead{Hash: a3, Height: 3}, reopened.CanonicalHead())
+	assert.Equal(uint64(3), reopened.FinalizedHeight())
+
+	// The latest finalized blocks are served from memory.
+	for _, name := range []string{"a2", "a3"} {
+		hash := core.GetTestBlock(name).Hash()
+		require.Nil(chain.store.Delete(hash[:]))
+	}
+	block, err := chain.FindFinalizedBlockByHeight(3)
+	require.Nil(err)
+	require.NotNil(block)
+	assert.Equal(a3, block.Hash())
+	block, err = chain.FindBlock(core.GetTestBlock("a2").Hash())
+	require.Nil(err)
+	assert.True(block.Status.IsFinalized())
+
+	// The copies returned can be modified.
+	block.Children = append(block.Children[:0], common.Hash{})
+	block, err = chain.FindBlock(core.GetTestBlock("a2").Hash())
+	require.Nil(err)
+	assert.Equal([]common.Hash{a3, core.GetTestBlock("b3").Hash()}, block.Children)
+
+	// Only the latest heights are cached.
+	a1 := core.GetTestBlock("a1").Hash()
+	require.Nil(chain.store.Delete(a1[:]))
+	_, err = chain.FindBlock(a1)
+	assert.NotNil(err)
+
+	// The cache follows the updates of the cached blocks.
+	block, err = chain.FindBlock(a3)
+	require.Nil(err)
+	block.Children = append(block.Children, common.Hash{0x1})
+	require.Nil(chain.SaveBlock(block))
+	block, err = chain.FindBlock(a3)
+	require.Nil(err)
+	assert.Contains(block.Children, common.Hash{0x1})
+
+	block.Status = core.BlockStatusDisposed
+	require.Nil(chain.SaveBlock(block))
+	block, err = chain.FindFinalizedBlockByHeight(3)
+	require.Nil(err)
+	assert.Nil(block)
+}
+
+func TestWithBatchDiscardsOnError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := NewChain("testchain", kvstore.NewKVStore(backend.NewMemDatabase()), core.CreateTestBlock("a0", ""))
+	for _, pair := range [][2]string{{"a1", "a0"}, {"a2", "a1"}} {
+		_, err := chain.AddBlock(core.CreateTestBlock(pair[0], pair[1]))
+		require.Nil(err)
+	}
+	a1 := core.GetTestBlock("a1").Hash()
+	require.Nil(chain.FinalizePreviousBlocks(a1))
+	head := chain.CanonicalHead()
+
+	a2 := core.GetTestBlock("a2").Hash()
+	err := chain.withBatch(func(target *Chain) error {
+		block, err := target.markBlockFinalized(a2)
+		require.Nil(err)
+		require.NotNil(block)
+		return errors.New("failure after the writes")
+	})
+	assert.NotNil(err)
+
+	// Neither the DB, the cached blocks nor the head see the discarded writes.
+	assert.Equal(head, chain.CanonicalHead())
+	assert.Equal(uint64(1), chain.FinalizedHeight())
+	block, err := chain.FindBlock(a2)
+	require.Nil(err)
+	assert.False(block.Status.IsFinalized())
+	var stored core.ExtendedBlock
+	require.Nil(chain.store.Get(a2[:], &stored))
+	assert.False(stored.Status.IsFinalized())
+}
@@ -7,16 +7,22 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/kvstore"
 )
 
 const maxDistance = 2000
 
 var logger *log.Entry = log.WithFields(log.Fields{"prefix": "blockchain"})
 
+// ErrAncestorPruned is returned along with a partial result when an ancestor block is not
+// present in the store.
+var ErrAncestorPruned = errors.New("Ancestor block has been pruned")
+
 // Chain represents the blockchain and also is the interface to underlying store.
 type Chain struct {
 	store store.Store
@@ -24,16 +30,56 @@ type Chain struct {
 	ChainID string
 	root    common.Hash
 
-	mu *sync.RWMutex
+	finalizedHeight         uint64
+	head                    CanonicalHead
+	canonicalBlocks         *canonicalBlockCache
+	finalizationSubscribers []func(block *core.ExtendedBlock)
+
+	validatorStateSource ValidatorStateSource
+	selectValidators     ValidatorSetSelector
+	validatorSetCache    *validatorSetCacheEntry
+
+	indexStateRoot    bool
+	indexTxsByAddress bool
+	indexLogs         bool
+	indexInternalTxs  bool
+	txIndexPolicy     TxIndexPolicy
+	txIndexDepth      uint64
+	compressBlocks    bool
+
+	recordBlockMetadata bool
+
+	addBlocksBatchBytes int
+	addBlocksBatchTxs   int
+
+	// savedBlocks collects the blocks saved through a batch chain, whose cached copies are only
+	// refreshed once the batch is committed. Nil for the chain itself.
+	savedBlocks []*core.ExtendedBlock
+
+	mu         *sync.RWMutex
+	evidenceMu *sync.Mutex
 }
 
 // NewChain creates a new Chain instance.
 func NewChain(chainID string, store store.Store, root *core.Block) *Chain {
 	chain := &Chain{
-		ChainID: chainID,
-		store:   store,
-		mu:      &sync.RWMutex{},
+		ChainID:             chainID,
+		store:               store,
+		indexStateRoot:      viper.GetBool(common.CfgStorageIndexStateRoot),
+		indexTxsByAddress:   viper.GetBool(common.CfgStorageIndexTxsByAddress),
+		indexLogs:           viper.GetBool(common.CfgStorageIndexLogs),
+		indexInternalTxs:    viper.GetBool(common.CfgStorageIndexInternalTxs),
+		txIndexPolicy:       ParseTxIndexPolicy(viper.GetString(common.CfgStorageTxIndexPolicy)),
+		txIndexDepth:        viper.GetUint64(common.CfgStorageTxIndexDepth),
+		compressBlocks:      viper.GetBool(common.CfgStorageCompressBlocks),
+		recordBlockMetadata: viper.GetBool(common.CfgStorageRecordBlockMetadata),
+		addBlocksBatchBytes: viper.GetInt(common.CfgStorageAddBlocksBatchBytes),
+		addBlocksBatchTxs:   viper.GetInt(common.CfgStorageAddBlocksBatchTxs),
+		canonicalBlocks:     newCanonicalBlockCache(uint64(viper.GetInt(common.CfgStorageCanonicalBlockCacheSize))),
+		mu:                  &sync.RWMutex{},
+		evidenceMu:          &sync.Mutex{},
 	}
+	chain.loadCanonicalHead()
 	rootBlock, err := chain.FindBlock(root.Hash())
 	if err != nil {
 		logger.WithFields(log.Fields{"Hash": root.Hash().Hex()}).Info("Root block is not found in chain. Adding block.")
@@ -63,10 +109,67 @@ func (ch *Chain) AddBlock(block *core.Block) (*core.ExtendedBlock, error) {
 	return ch.addBlock(block, false)
 }
 
+// bufferedStoreCreator is implemented by the stores which can buffer writes in memory.
+type bufferedStoreCreator interface {
+	NewBufferedStore() store.BufferedStore
+}
+
+// AddBlocks adds the blocks to the chain in order. If the underlying store supports it, the
+// writes are committed in batches once the pending writes or the transactions added exceed
+// the configured thresholds, rather than after a fixed number of blocks, so that memory stays
+// bounded regardless of the block sizes. It returns the blocks added before any error.
+func (ch *Chain) AddBlocks(blocks []*core.Block) ([]*core.ExtendedBlock, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	target := ch
+	var buffered store.BufferedStore
+	if creator, ok := ch.store.(bufferedStoreCreator); ok {
+		buffered = creator.NewBufferedStore()
+		target = ch.newBatchChain(buffered)
+	}
+	commit := func() error {
+		if buffered == nil {
+			return nil
+		}
+		return ch.commitBatch(target)
+	}
+
+	added := make([]*core.ExtendedBlock, 0, len(blocks))
+	numTxs := 0
+	for _, block := range blocks {
+		extendedBlock, err := target.insertBlock(block, false)
+		if err != nil {
+			// insertBlock fails before writing anything, the blocks added so far are kept.
+			if commitErr := commit(); commitErr != nil {
+				return added, commitErr
+			}
+			return added, err
+		}
+		added = append(added, extendedBlock)
+
+		numTxs += len(block.Txs)
+		if buffered != nil && (buffered.PendingSize() >= ch.addBlocksBatchBytes || numTxs >= ch.addBlocksBatchTxs) {
+			if err := commit(); err != nil {
+				return added, err
+			}
+			numTxs = 0
+		}
+	}
+	if err := commit(); err != nil {
+		return added, err
+	}
+	return added, nil
+}
+
 func (ch *Chain) addBlock(block *core.Block, isSnapshotRoot bool) (*core.ExtendedBlock, error) {
 	ch.mu.Lock()
 	defer ch.mu.Unlock()
+	return ch.insertBlock(block, isSnapshotRoot)
+}
 
+// insertBlock is the non-locking version of addBlock.
+func (ch *Chain) insertBlock(block *core.Block, isSnapshotRoot bool) (*core.ExtendedBlock, error) {
 	if block.ChainID != ch.ChainID {
 		return nil, errors.Errorf("ChainID mismatch: block.ChainID(%s) != %s", block.ChainID, ch.ChainID)
 	}
@@ -92,6 +195,13 @@ func (ch *Chain) addBlock(block *core.Block, isSnapshotRoot bool) (*core.Extende
 	}
 
 	extendedBlock := &core.ExtendedBlock{Block: block}
+	if !isSnapshotRoot && block.Height > 0 {
+		if skip, err := ch.findAncestor(block.Parent, core.SkipHeight(block.Height)); err == nil {
+			if err := ch.store.Put(blockSkipKey(hash), skip.Hash()); err != nil {
+				logger.Panic(err)
+			}
+		}
+	}
 
 	// Update children if present.
 	children := ch.findBlocksByHeight(block.Height + 1)
@@ -110,6 +220,10 @@ func (ch *Chain) addBlock(block *core.Block, isSnapshotRoot bool) (*core.Extende
 
 	ch.AddBlockByHeightIndex(extendedBlock.Height, extendedBlock.Hash())
 	ch.AddTxsToIndex(extendedBlock, false)
+	ch.addCumulativeTxCount(extendedBlock, isSnapshotRoot)
+	if ch.indexStateRoot {
+		ch.addBlockByStateRootIndex(extendedBlock.StateHash, extendedBlock.Hash())
+	}
 
 	return extendedBlock, nil
 }
@@ -121,6 +235,10 @@ func (ch *Chain) FixBlockIndex(block *core.ExtendedBlock) {
 
 	ch.AddBlockByHeightIndex(block.Height, block.Hash())
 	ch.AddTxsToIndex(block, false)
+	ch.addCumulativeTxCount(block, false)
+	if ch.indexStateRoot {
+		ch.addBlockByStateRootIndex(block.StateHash, block.Hash())
+	}
 }
 
 // FixMissingChildren removes dead links to missing children blocks.
@@ -145,6 +263,46 @@ func (ch *Chain) FixMissingChildren(block *core.ExtendedBlock) {
 	}
 }
 
+// VerifyBlockLinks checks that the Children list of the given block is consistent with the
+// stored child blocks, i.e. every listed child exists and points back to the block as its
+// parent, and every stored block whose parent is the given block is listed.
+func (ch *Chain) VerifyBlockLinks(blockHash common.Hash) error {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	block, err := ch.findBlock(blockHash)
+	if err != nil {
+		return errors.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+
+	listed := make(map[common.Hash]bool)
+	for _, childHash := range block.Children {
+		if listed[childHash] {
+			return errors.Errorf("Block %v lists child %v more than once", blockHash.Hex(), childHash.Hex())
+		}
+		listed[childHash] = true
+
+		child, err := ch.findBlock(childHash)
+		if err != nil {
+			return errors.Errorf("Block %v lists child %v which is not stored", blockHash.Hex(), childHash.Hex())
+		}
+		if child.Parent != blockHash {
+			return errors.Errorf("Block %v lists child %v whose parent is %v", blockHash.Hex(), childHash.Hex(), child.Parent.Hex())
+		}
+	}
+
+	for _, candidate := range ch.findBlocksByHeight(block.Height + 1) {
+		if candidate.Parent != blockHash {
+			continue
+		}
+		if !listed[candidate.Hash()] {
+			return errors.Errorf("Block %v does not list its stored child %v", blockHash.Hex(), candidate.Hash().Hex())
+		}
+	}
+
+	return nil
+}
+
 // blockByHeightIndexKey constructs the DB key for the given block height.
 func blockByHeightIndexKey(height uint64) common.Bytes {
 	// convert uint64 to []byte
@@ -181,6 +339,43 @@ func (ch *Chain) AddBlockByHeightIndex(height uint64, block common.Hash) {
 	}
 }
 
+// blockByStateRootIndexKey constructs the DB key for the given state root.
+func blockByStateRootIndexKey(stateHash common.Hash) common.Bytes {
+	return append(common.Bytes("sr/"), stateHash[:]...)
+}
+
+// addBlockByStateRootIndex maps the state root to the block. If several blocks share the same
+// state root, the first block added is kept.
+func (ch *Chain) addBlockByStateRootIndex(stateHash common.Hash, block common.Hash) {
+	key := blockByStateRootIndexKey(stateHash)
+	err := ch.store.Get(key, &common.Hash{})
+	if err != store.ErrKeyNotFound {
+		return
+	}
+	err = ch.store.Put(key, block)
+	if err != nil {
+		logger.Panic(err)
+	}
+}
+
+// FindBlockByStateRoot returns the block whose state hash is the given state root. It requires
+// the state root index to be enabled.
+func (ch *Chain) FindBlockByStateRoot(stateHash common.Hash) (*core.ExtendedBlock, bool) {
+	blockHash := common.Hash{}
+	err := ch.store.Get(blockByStateRootIndexKey(stateHash), &blockHash)
+	if err != nil {
+		if err != store.ErrKeyNotFound {
+			logger.Error(err)
+		}
+		return nil, false
+	}
+	block, err := ch.FindBlock(blockHash)
+	if err != nil {
+		return nil, false
+	}
+	return block, true
+}
+
 // FindBlocksByHeight tries to retrieve blocks by height.
 func (ch *Chain) FindBlocksByHeight(height uint64) []*core.ExtendedBlock {
 	ch.mu.RLock()
@@ -270,18 +465,59 @@ func (ch *Chain) CommitBlock(hash common.Hash) {
 	}
 }
 
+// FinalizePreviousBlocks marks the block as directly finalized, and its ancestors up to the last
+// finalized block as indirectly finalized. The finalization subscribers are notified of the
+// directly finalized block afterwards.
 func (ch *Chain) FinalizePreviousBlocks(hash common.Hash) error {
+	finalized, subscribers, err := ch.finalizePreviousBlocks(hash)
+	if len(finalized) > 0 {
+		for _, subscriber := range subscribers {
+			subscriber(finalized[0])
+		}
+	}
+	return err
+}
+
+// finalizePreviousBlocks returns the newly finalized blocks from the newest, along with the
+// subscribers to notify.
+func (ch *Chain) finalizePreviousBlocks(hash common.Hash) ([]*core.ExtendedBlock, []func(block *core.ExtendedBlock), error) {
 	ch.mu.Lock()
 	defer ch.mu.Unlock()
 
+	var finalized []*core.ExtendedBlock
+	err := ch.withBatch(func(target *Chain) error {
+		var err error
+		finalized, err = target.markPreviousBlocksFinalized(hash)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	ch.cacheFinalizedBlocks(finalized)
+	return finalized, ch.finalizationSubscribers, nil
+}
+
+// markPreviousBlocksFinalized is the non-locking version of finalizePreviousBlocks.
+func (ch *Chain) markPreviousBlocksFinalized(hash common.Hash) ([]*core.ExtendedBlock, error) {
+	// The blocks are finalized from the newest, and indexed from the oldest.
+	finalized := []*core.ExtendedBlock{}
+	defer func() {
+		for i := len(finalized) - 1; i >= 0; i-- {
+			ch.indexFinalizedBlock(finalized[i])
+		}
+	}()
+
 	status := core.BlockStatusDirectlyFinalized
 	for !hash.IsEmpty() {
 		block, err := ch.findBlock(hash)
 		if err != nil || block.Status.IsFinalized() {
-			return nil
+			break
 		}
 		if block.Status == core.BlockStatusDisposed {
-			return errors.New("Cannot finalize disposed branch")
+			return finalized, errors.New("Cannot finalize disposed branch")
+		}
+		if status == core.BlockStatusDirectlyFinalized {
+			ch.setCanonicalHead(block)
 		}
 		block.Status = status
 		status = core.BlockStatusIndirectlyFinalized // Only the first block is marked as directly finalized
@@ -290,15 +526,124 @@ func (ch *Chain) FinalizePreviousBlocks(hash common.Hash) error {
 			logger.Panic(err)
 		}
 
-		// Force update TX index on block finalization so that the index doesn't point to
-		// duplicate TX in fork.
-		ch.AddTxsToIndex(block, true)
+		// The TX index is re-pointed to the finalized block, so that the index doesn't point
+		// to duplicate TX in fork, and the TXs of the other blocks at its height are orphaned.
+		ch.AddTxsToIndex(block, false)
+		ch.orphanSiblings(block)
+		finalized = append(finalized, block)
 
 		hash = block.Parent
 	}
+	return finalized, nil
+}
+
+// cacheFinalizedBlocks adds the newly finalized blocks to the cache once they are committed.
+func (ch *Chain) cacheFinalizedBlocks(blocks []*core.ExtendedBlock) {
+	ch.canonicalBlocks.setHeadHeight(ch.finalizedHeight)
+	for _, block := range blocks {
+		ch.canonicalBlocks.add(block)
+	}
+}
+
+// orphanSiblings marks the TXs of the other blocks at the height of the finalized block as
+// orphaned.
+func (ch *Chain) orphanSiblings(block *core.ExtendedBlock) {
+	for _, sibling := range ch.findBlocksByHeight(block.Height) {
+		if sibling.Hash() != block.Hash() {
+			ch.markOrphanedTxs(sibling)
+		}
+	}
+}
+
+// indexFinalizedBlock adds the finalized block to the optional indexes, and removes the block
+// falling out of the tx index depth from the tx index.
+func (ch *Chain) indexFinalizedBlock(block *core.ExtendedBlock) {
+	ch.unindexTxsBelowDepth(block.Height)
+	if ch.indexTxsByAddress {
+		ch.addTxsToAddressIndex(block)
+	}
+	if ch.indexLogs {
+		ch.addBlockToLogIndex(block)
+	}
+	if ch.indexInternalTxs {
+		ch.addInternalTxsToAddressIndex(block)
+	}
+}
+
+// FinalizeBlock atomically marks a stored block as directly finalized, makes sure it is in the
+// height index, and updates the finalized height. The finalization subscribers are notified
+// afterwards. It is a no-op if the block is already finalized.
+func (ch *Chain) FinalizeBlock(blockHash common.Hash) error {
+	block, subscribers, err := ch.finalizeBlock(blockHash)
+	if err != nil || block == nil {
+		return err
+	}
+	for _, subscriber := range subscribers {
+		subscriber(block)
+	}
 	return nil
 }
 
+// finalizeBlock returns the newly finalized block along with the subscribers to notify, or
+// nil if the block has already been finalized.
+func (ch *Chain) finalizeBlock(blockHash common.Hash) (*core.ExtendedBlock, []func(block *core.ExtendedBlock), error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	var block *core.ExtendedBlock
+	err := ch.withBatch(func(target *Chain) error {
+		var err error
+		block, err = target.markBlockFinalized(blockHash)
+		return err
+	})
+	if err != nil || block == nil {
+		return nil, nil, err
+	}
+	ch.cacheFinalizedBlocks([]*core.ExtendedBlock{block})
+	return block, ch.finalizationSubscribers, nil
+}
+
+// markBlockFinalized is the non-locking version of finalizeBlock.
+func (ch *Chain) markBlockFinalized(blockHash common.Hash) (*core.ExtendedBlock, error) {
+	block, err := ch.findBlock(blockHash)
+	if err != nil {
+		return nil, errors.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+	if block.Status.IsFinalized() {
+		return nil, nil
+	}
+	if block.Status == core.BlockStatusDisposed {
+		return nil, errors.New("Cannot finalize disposed block")
+	}
+
+	block.Status = core.BlockStatusDirectlyFinalized
+	err = ch.saveBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	ch.AddBlockByHeightIndex(block.Height, blockHash)
+	ch.AddTxsToIndex(block, false)
+	ch.orphanSiblings(block)
+	ch.indexFinalizedBlock(block)
+	ch.setCanonicalHead(block)
+	return block, nil
+}
+
+// SubscribeFinalization registers a callback which is called whenever a block is directly
+// finalized through FinalizeBlock or FinalizePreviousBlocks.
+func (ch *Chain) SubscribeFinalization(subscriber func(block *core.ExtendedBlock)) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.finalizationSubscribers = append(ch.finalizationSubscribers, subscriber)
+}
+
+// FinalizedHeight returns the height of the latest directly finalized block.
+func (ch *Chain) FinalizedHeight() uint64 {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.finalizedHeight
+}
+
 func (ch *Chain) IsOrphan(block *core.Block) bool {
 	_, err := ch.FindBlock(block.Parent)
 	return err != nil
@@ -307,15 +652,30 @@ func (ch *Chain) IsOrphan(block *core.Block) bool {
 // saveBlock updates a previously stored block.
 func (ch *Chain) saveBlock(block *core.ExtendedBlock) error {
 	hash := block.Hash()
-	return ch.store.Put(hash[:], block)
+	var value interface{} = block
+	if ch.compressBlocks {
+		value = kvstore.Compressed{Value: block}
+	}
+	if err := ch.store.Put(hash[:], value); err != nil {
+		return err
+	}
+	if ch.savedBlocks != nil {
+		ch.savedBlocks = append(ch.savedBlocks, copyExtendedBlock(block))
+	} else {
+		ch.canonicalBlocks.update(block)
+	}
+	return nil
 }
 
 func (ch *Chain) SaveBlock(block *core.ExtendedBlock) error {
 	return ch.saveBlock(block)
 }
 
-// FindBlock tries to retrieve a block by hash.
+// FindBlock tries to retrieve a block by hash. The latest finalized blocks are served from memory.
 func (ch *Chain) FindBlock(hash common.Hash) (*core.ExtendedBlock, error) {
+	if block := ch.canonicalBlocks.getByHash(hash); block != nil {
+		return block, nil
+	}
 	ch.mu.RLock()
 	defer ch.mu.RUnlock()
 	return ch.findBlock(hash)
@@ -333,20 +693,144 @@ func (ch *Chain) findBlock(hash common.Hash) (*core.ExtendedBlock, error) {
 
 // IsDescendant determines whether one block is the ascendant of another block.
 func (ch *Chain) IsDescendant(ascendantHash common.Hash, descendantHash common.Hash) bool {
+	if ascendantHash == descendantHash {
+		return true
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	ascendant, err := ch.findBlock(ascendantHash)
+	if err == nil {
+		descendant, err := ch.findBlock(descendantHash)
+		if err != nil {
+			return false
+		}
+		if descendant.Height > ascendant.Height {
+			if descendant.Height-ascendant.Height >= maxDistance {
+				return false
+			}
+			ancestor, err := ch.findAncestorOf(descendant, ascendant.Height)
+			if err == nil {
+				return ancestor.Hash() == ascendantHash
+			}
+			if err == ErrAncestorPruned {
+				return false
+			}
+		}
+	}
+
+	// The ascendant is not stored, e.g. the empty parent of the root, or the stored heights are
+	// inconsistent with the Parent links. Walk the links instead.
 	hash := descendantHash
 	for i := 0; i < maxDistance; i++ {
 		if hash == ascendantHash {
 			return true
 		}
-		currBlock, err := ch.FindBlock(hash)
+		block, err := ch.findBlock(hash)
 		if err != nil {
 			return false
 		}
-		hash = currBlock.Parent
+		hash = block.Parent
 	}
 	return false
 }
 
+// FindAncestor returns the ancestor of the block at the given height, the block itself if it
+// is at the height. The skip pointers of the blocks are followed, so that it takes O(log k)
+// lookups for an ancestor k blocks below.
+func (ch *Chain) FindAncestor(hash common.Hash, height uint64) (*core.ExtendedBlock, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.findAncestor(hash, height)
+}
+
+func (ch *Chain) findAncestor(hash common.Hash, height uint64) (*core.ExtendedBlock, error) {
+	block, err := ch.findBlock(hash)
+	if err != nil {
+		return nil, errors.Errorf("Failed to find block %v: %v", hash.Hex(), err)
+	}
+	return ch.findAncestorOf(block, height)
+}
+
+// blockSkipKey is the DB key of the skip pointer of the block. The skip pointers are kept apart
+// from the stored blocks, whose encoding is shared with the older nodes and the chain backups.
+func blockSkipKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("bs/"), hash[:]...)
+}
+
+// findSkip returns the skip pointer of the block, empty if it is not indexed.
+func (ch *Chain) findSkip(hash common.Hash) common.Hash {
+	skip := common.Hash{}
+	ch.store.Get(blockSkipKey(hash), &skip)
+	return skip
+}
+
+// findAncestorOf walks down from the block, taking the skip pointer whenever it doesn't jump
+// below the height, or jumps further than the skip pointer of the parent would. The Parent
+// link is followed if the skip pointer is missing or its block has been pruned.
+func (ch *Chain) findAncestorOf(block *core.ExtendedBlock, height uint64) (*core.ExtendedBlock, error) {
+	if height > block.Height {
+		return nil, errors.Errorf("Block %v is at height %v, below %v", block.Hash().Hex(), block.Height, height)
+	}
+	for block.Height > height {
+		skipHeight := core.SkipHeight(block.Height)
+		skipHeightPrev := core.SkipHeight(block.Height - 1)
+		if skipHeight == height || skipHeight > height && !(skipHeightPrev+2 < skipHeight && skipHeightPrev >= height) {
+			if skipHash := ch.findSkip(block.Hash()); !skipHash.IsEmpty() {
+				if skip, err := ch.findBlock(skipHash); err == nil {
+					block = skip
+					continue
+				}
+			}
+		}
+		parent, err := ch.findBlock(block.Parent)
+		if err != nil {
+			return nil, ErrAncestorPruned
+		}
+		block = parent
+	}
+	if block.Height != height {
+		return nil, errors.Errorf("No ancestor at height %v, reached block %v at height %v", height, block.Hash().Hex(), block.Height)
+	}
+	return block, nil
+}
+
+// AncestryOf returns the headers of the given block and its ancestors, oldest first. It walks
+// the Parent links toward genesis and stops at genesis or after maxDepth hops. If an ancestor
+// is missing from the store (e.g. pruned), the headers collected so far are returned along
+// with ErrAncestorPruned.
+func (ch *Chain) AncestryOf(blockHash common.Hash, maxDepth int) ([]*core.BlockHeader, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	block, err := ch.findBlock(blockHash)
+	if err != nil {
+		return nil, errors.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+
+	ancestry := []*core.BlockHeader{block.BlockHeader}
+	var retErr error
+	for hops := 0; hops < maxDepth; hops++ {
+		if block.Height == core.GenesisBlockHeight || block.Parent.IsEmpty() {
+			break
+		}
+		parent, err := ch.findBlock(block.Parent)
+		if err != nil {
+			retErr = ErrAncestorPruned
+			break
+		}
+		ancestry = append(ancestry, parent.BlockHeader)
+		block = parent
+	}
+
+	// Reverse to return the oldest block first.
+	for i, j := 0, len(ancestry)-1; i < j; i, j = i+1, j-1 {
+		ancestry[i], ancestry[j] = ancestry[j], ancestry[i]
+	}
+	return ancestry, retErr
+}
+
 // PrintBranch return the string describing path from root to given leaf.
 func (ch *Chain) PrintBranch(hash common.Hash) string {
 	ret := []string{}
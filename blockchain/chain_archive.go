@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// ChainArchiveVersion is the version of the chain archive format.
+const ChainArchiveVersion = 1
+
+// ChainArchiveHeader is the first item of a chain archive. It is followed by a
+// ChainArchiveRecord for each finalized block of the height range, in increasing height.
+type ChainArchiveHeader struct {
+	Version     uint64
+	ChainID     string
+	StartHeight uint64
+	EndHeight   uint64
+}
+
+// ChainArchiveRecord holds a block and the votes on it.
+type ChainArchiveRecord struct {
+	Block *core.Block
+	Votes *core.VoteSet
+}
+
+// ExportChain writes the finalized blocks from the start height to the end height, capped at
+// the finalized height, and their votes to the writer as a flat sequence of RLP items. It
+// returns the number of blocks written.
+func ExportChain(chain *Chain, w io.Writer, startHeight, endHeight uint64) (int, error) {
+	if finalizedHeight := chain.FinalizedHeight(); endHeight > finalizedHeight {
+		endHeight = finalizedHeight
+	}
+	if startHeight > endHeight {
+		return 0, fmt.Errorf("Invalid height range: %v to %v", startHeight, endHeight)
+	}
+
+	header := &ChainArchiveHeader{
+		Version:     ChainArchiveVersion,
+		ChainID:     chain.ChainID,
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+	}
+	if err := rlp.Encode(w, header); err != nil {
+		return 0, fmt.Errorf("Failed to write the chain archive header: %v", err)
+	}
+
+	count := 0
+	it := chain.IterateBlocks(startHeight, endHeight, nil)
+	for it.Next() {
+		block := it.Block()
+		record := &ChainArchiveRecord{
+			Block: block.Block,
+			Votes: chain.FindVotesByHash(block.Hash()),
+		}
+		if err := rlp.Encode(w, record); err != nil {
+			return count, fmt.Errorf("Failed to write block %v: %v", block.Hash().Hex(), err)
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// ImportChain adds the blocks of a chain archive and their votes to the chain. The blocks are
+// added as pending, the node validates and executes them on start, as if they had been
+// received from its peers. Each block must extend a block of the chain or the previous
+// block of the archive. The blocks already in the chain or not above its root are skipped. It
+// returns the number of blocks added.
+func ImportChain(chain *Chain, r io.Reader) (int, error) {
+	stream := rlp.NewStream(r, 0)
+	header := &ChainArchiveHeader{}
+	if err := stream.Decode(header); err != nil {
+		return 0, fmt.Errorf("Failed to read the chain archive header: %v", err)
+	}
+	if header.Version != ChainArchiveVersion {
+		return 0, fmt.Errorf("Unsupported chain archive version: %v", header.Version)
+	}
+	if header.ChainID != chain.ChainID {
+		return 0, fmt.Errorf("ChainID mismatch: archive.ChainID(%v) != %v", header.ChainID, chain.ChainID)
+	}
+
+	rootHeight := chain.Root().Height
+	count := 0
+	for {
+		record := &ChainArchiveRecord{}
+		err := stream.Decode(record)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("Failed to read the chain archive: %v", err)
+		}
+		added, err := importArchiveRecord(chain, record, rootHeight)
+		if err != nil {
+			return count, err
+		}
+		if added {
+			count++
+		}
+	}
+}
+
+func importArchiveRecord(chain *Chain, record *ChainArchiveRecord, rootHeight uint64) (bool, error) {
+	block := record.Block
+	if block == nil || block.BlockHeader == nil {
+		return false, fmt.Errorf("Chain archive contains an empty block")
+	}
+	hash := block.Hash()
+	if block.TxHash != core.CalculateRootHash(block.Txs) {
+		return false, fmt.Errorf("TxHash does not match for block %v", hash.Hex())
+	}
+	if record.Votes != nil {
+		for _, vote := range record.Votes.Votes() {
+			if vote.Block != hash {
+				return false, fmt.Errorf("Vote of %v is not on block %v", vote.ID.Hex(), hash.Hex())
+			}
+		}
+	}
+
+	if block.Height <= rootHeight {
+		return false, nil
+	}
+	if _, err := chain.FindBlock(hash); err == nil {
+		return false, nil
+	}
+	if _, err := chain.FindBlock(block.Parent); err != nil {
+		return false, fmt.Errorf("Parent %v of block %v at height %v is missing", block.Parent.Hex(), hash.Hex(), block.Height)
+	}
+	if _, err := chain.AddBlock(block); err != nil {
+		return false, err
+	}
+	if record.Votes != nil {
+		for _, vote := range record.Votes.Votes() {
+			chain.AddVoteToIndex(vote)
+		}
+	}
+	return true, nil
+}
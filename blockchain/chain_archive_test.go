@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestExportImportChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.AddTxs(txs)
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	a1 := addBlock("a1", "a0", common.Bytes("tx1"))
+	addBlock("b2", "a1", common.Bytes("tx2"))
+	a2 := addBlock("a2", "a1")
+	a3 := addBlock("a3", "a2", common.Bytes("tx3"))
+	addBlock("a4", "a3")
+	require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+
+	voter := common.HexToAddress("0x1")
+	chain.AddVoteToIndex(core.Vote{Block: a2.Hash(), ID: voter, Epoch: 2})
+
+	archive := &bytes.Buffer{}
+	count, err := ExportChain(chain, archive, 0, 100)
+	require.Nil(err)
+	assert.Equal(4, count) // a0 to a3, the fork and the block above the finalized height are left out
+
+	// The root is already in the chain.
+	imported := CreateTestChain()
+	count, err = ImportChain(imported, bytes.NewReader(archive.Bytes()))
+	require.Nil(err)
+	assert.Equal(3, count)
+
+	for _, block := range []*core.Block{a1, a2, a3} {
+		eb, err := imported.FindBlock(block.Hash())
+		require.Nil(err)
+		assert.True(eb.Status.IsPending())
+		require.Equal(len(block.Txs), len(eb.Txs)) // the empty blocks decode with an empty tx list
+		for i, tx := range block.Txs {
+			assert.Equal(tx, eb.Txs[i])
+		}
+		assert.Equal(block.Parent, eb.Parent)
+	}
+	a1Block, err := imported.FindBlock(a1.Hash())
+	require.Nil(err)
+	assert.Equal([]common.Hash{a2.Hash()}, a1Block.Children)
+
+	votes := imported.FindVotesByHash(a2.Hash()).Votes()
+	require.Equal(1, len(votes))
+	assert.Equal(voter, votes[0].ID)
+
+	// Importing again is a no-op.
+	count, err = ImportChain(imported, bytes.NewReader(archive.Bytes()))
+	require.Nil(err)
+	assert.Equal(0, count)
+
+	// The blocks need to extend the chain.
+	archive.Reset()
+	_, err = ExportChain(chain, archive, 2, 3)
+	require.Nil(err)
+	count, err = ImportChain(CreateTestChain(), bytes.NewReader(archive.Bytes()))
+	assert.NotNil(err)
+	assert.Equal(0, count)
+
+	_, err = ExportChain(chain, archive, 4, 10)
+	assert.NotNil(err)
+}
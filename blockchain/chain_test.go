@@ -1,11 +1,15 @@
 package blockchain
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
 )
 
 func TestBlockchain(t *testing.T) {
@@ -167,3 +171,308 @@ func TestBlockIndex(t *testing.T) {
 	assert.Equal(core.GetTestBlock("a2").Hash(), blocks[0].Hash())
 	assert.Equal(core.GetTestBlock("b2").Hash(), blocks[1].Hash())
 }
+
+func TestVerifyBlockLinks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	ch := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+		"a2", "a1",
+		"b2", "a1",
+	})
+
+	for _, name := range []string{"a0", "a1", "a2", "b2"} {
+		assert.Nil(ch.VerifyBlockLinks(core.GetTestBlock(name).Hash()))
+	}
+
+	// Drop b2 from a1's children list.
+	a1, err := ch.FindBlock(core.GetTestBlock("a1").Hash())
+	require.Nil(err)
+	a1.Children = []common.Hash{core.GetTestBlock("a2").Hash()}
+	require.Nil(ch.SaveBlock(a1))
+
+	err = ch.VerifyBlockLinks(a1.Hash())
+	require.NotNil(err)
+	assert.Contains(err.Error(), "does not list its stored child")
+
+	// List a child that doesn't point back.
+	a1.Children = []common.Hash{core.GetTestBlock("a2").Hash(), core.GetTestBlock("b2").Hash(), core.GetTestBlock("a0").Hash()}
+	require.Nil(ch.SaveBlock(a1))
+
+	err = ch.VerifyBlockLinks(a1.Hash())
+	require.NotNil(err)
+	assert.Contains(err.Error(), "whose parent is")
+}
+
+func TestAncestryOf(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	ch := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+		"a2", "a1",
+		"a3", "a2",
+		"b2", "a1",
+	})
+
+	checkAncestry := func(ancestry []*core.BlockHeader, names ...string) {
+		require.Equal(len(names), len(ancestry))
+		for i, name := range names {
+			assert.Equal(core.GetTestBlock(name).Hash(), ancestry[i].Hash())
+		}
+	}
+
+	ancestry, err := ch.AncestryOf(core.GetTestBlock("a3").Hash(), 10)
+	require.Nil(err)
+	checkAncestry(ancestry, "a0", "a1", "a2", "a3")
+
+	ancestry, err = ch.AncestryOf(core.GetTestBlock("a3").Hash(), 2)
+	require.Nil(err)
+	checkAncestry(ancestry, "a1", "a2", "a3")
+
+	ancestry, err = ch.AncestryOf(core.GetTestBlock("b2").Hash(), 10)
+	require.Nil(err)
+	checkAncestry(ancestry, "a0", "a1", "b2")
+
+	// Prune a1.
+	a1 := core.GetTestBlock("a1").Hash()
+	require.Nil(ch.store.Delete(a1[:]))
+
+	ancestry, err = ch.AncestryOf(core.GetTestBlock("a3").Hash(), 10)
+	assert.Equal(ErrAncestorPruned, err)
+	checkAncestry(ancestry, "a2", "a3")
+
+	_, err = ch.AncestryOf(a1, 10)
+	assert.NotNil(err)
+}
+
+func TestFindAncestor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	pairs := []string{}
+	for i := 1; i <= 300; i++ {
+		pairs = append(pairs, fmt.Sprintf("a%v", i), fmt.Sprintf("a%v", i-1))
+	}
+	pairs = append(pairs, "b101", "a100", "b102", "b101")
+	ch := CreateTestChainByBlocks(pairs)
+
+	for _, height := range []uint64{1, 2, 7, 64, 255, 300} {
+		skip := core.GetTestBlock(fmt.Sprintf("a%v", core.SkipHeight(height)))
+		assert.Equal(skip.Hash(), ch.findSkip(core.GetTestBlock(fmt.Sprintf("a%v", height)).Hash()), "height %v", height)
+	}
+
+	head := core.GetTestBlock("a300").Hash()
+	for _, height := range []uint64{0, 1, 99, 100, 128, 255, 299, 300} {
+		ancestor, err := ch.FindAncestor(head, height)
+		require.Nil(err)
+		assert.Equal(core.GetTestBlock(fmt.Sprintf("a%v", height)).Hash(), ancestor.Hash())
+	}
+	ancestor, err := ch.FindAncestor(core.GetTestBlock("b102").Hash(), 50)
+	require.Nil(err)
+	assert.Equal(core.GetTestBlock("a50").Hash(), ancestor.Hash())
+	_, err = ch.FindAncestor(head, 301)
+	assert.NotNil(err)
+
+	assert.True(ch.IsDescendant(core.GetTestBlock("a3").Hash(), head))
+	assert.True(ch.IsDescendant(core.GetTestBlock("a101").Hash(), head))
+	assert.True(ch.IsDescendant(head, head))
+	assert.False(ch.IsDescendant(core.GetTestBlock("b101").Hash(), head))
+	assert.False(ch.IsDescendant(head, core.GetTestBlock("a3").Hash()))
+	assert.True(ch.IsDescendant(core.GetTestBlock("a100").Hash(), core.GetTestBlock("b102").Hash()))
+
+	// The blocks stored without a skip pointer are walked through their parents.
+	require.Nil(ch.store.Delete(blockSkipKey(core.GetTestBlock("a200").Hash())))
+	ancestor, err = ch.FindAncestor(head, 10)
+	require.Nil(err)
+	assert.Equal(core.GetTestBlock("a10").Hash(), ancestor.Hash())
+
+	// The walk stops at a pruned ancestor.
+	a150 := core.GetTestBlock("a150").Hash()
+	require.Nil(ch.store.Delete(a150[:]))
+	_, err = ch.FindAncestor(core.GetTestBlock("a151").Hash(), 149)
+	assert.Equal(ErrAncestorPruned, err)
+}
+
+func TestFinalizeBlock(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	ch := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+		"a2", "a1",
+	})
+
+	notified := []common.Hash{}
+	ch.SubscribeFinalization(func(block *core.ExtendedBlock) {
+		notified = append(notified, block.Hash())
+	})
+
+	a2 := core.GetTestBlock("a2")
+	require.Nil(ch.FinalizeBlock(a2.Hash()))
+
+	block, err := ch.FindBlock(a2.Hash())
+	require.Nil(err)
+	assert.True(block.Status.IsDirectlyFinalized())
+	assert.Equal(a2.Height, ch.FinalizedHeight())
+	assert.Equal([]common.Hash{a2.Hash()}, notified)
+
+	found := false
+	for _, b := range ch.FindBlocksByHeight(a2.Height) {
+		found = found || b.Hash() == a2.Hash()
+	}
+	assert.True(found)
+
+	// Finalizing again is a no-op.
+	require.Nil(ch.FinalizeBlock(a2.Hash()))
+	assert.Equal(1, len(notified))
+
+	err = ch.FinalizeBlock(common.HexToHash("deadbeef"))
+	assert.NotNil(err)
+}
+
+func TestFinalizePreviousBlocksNotification(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	ch := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+		"a2", "a1",
+		"a3", "a2",
+	})
+
+	notified := []common.Hash{}
+	ch.SubscribeFinalization(func(block *core.ExtendedBlock) {
+		notified = append(notified, block.Hash())
+	})
+
+	// Only the directly finalized block is notified.
+	a3 := core.GetTestBlock("a3")
+	require.Nil(ch.FinalizePreviousBlocks(a3.Hash()))
+	assert.Equal([]common.Hash{a3.Hash()}, notified)
+
+	require.Nil(ch.FinalizePreviousBlocks(a3.Hash()))
+	assert.Equal(1, len(notified))
+}
+
+func TestFindBlockByStateRoot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	viper.Set(common.CfgStorageIndexStateRoot, true)
+	defer viper.Set(common.CfgStorageIndexStateRoot, false)
+
+	chain := CreateTestChain()
+	blocks := []*core.Block{
+		core.CreateTestBlock("a1", "a0"),
+		core.CreateTestBlock("a2", "a1"),
+		core.CreateTestBlock("b2", "a1"),
+	}
+	for _, block := range blocks {
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+	}
+
+	for _, block := range blocks {
+		found, ok := chain.FindBlockByStateRoot(block.StateHash)
+		require.True(ok)
+		assert.Equal(block.Hash(), found.Hash())
+	}
+
+	_, ok := chain.FindBlockByStateRoot(common.HexToHash("c1"))
+	assert.False(ok)
+}
+
+// createTestBlockSequence creates a sequence of blocks on top of a0, every fullEvery-th block
+// carrying numTxs transactions and the others none.
+func createTestBlockSequence(numBlocks, fullEvery, numTxs int) []*core.Block {
+	blocks := []*core.Block{}
+	parent := "a0"
+	for i := 1; i <= numBlocks; i++ {
+		name := fmt.Sprintf("a%d", i)
+		block := core.CreateTestBlock(name, parent)
+		if i%fullEvery == 0 {
+			for j := 0; j < numTxs; j++ {
+				block.Txs = append(block.Txs, common.Bytes(fmt.Sprintf("tx-%v-%v", i, j)))
+			}
+			block.UpdateHash()
+		}
+		blocks = append(blocks, block)
+		parent = name
+	}
+	return blocks
+}
+
+func TestAddBlocks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	// Small thresholds so that the blocks are committed in several batches.
+	viper.Set(common.CfgStorageAddBlocksBatchBytes, 2048)
+	viper.Set(common.CfgStorageAddBlocksBatchTxs, 30)
+	defer viper.Set(common.CfgStorageAddBlocksBatchBytes, 4*1024*1024)
+	defer viper.Set(common.CfgStorageAddBlocksBatchTxs, 10000)
+
+	chain := CreateTestChain()
+	blocks := createTestBlockSequence(50, 5, 20)
+	added, err := chain.AddBlocks(blocks)
+	require.Nil(err)
+	require.Equal(len(blocks), len(added))
+
+	for i, block := range blocks {
+		eb, err := chain.FindBlock(block.Hash())
+		require.Nil(err)
+		assert.Equal(block.Height, eb.Height)
+		if i+1 < len(blocks) {
+			assert.Equal([]common.Hash{blocks[i+1].Hash()}, eb.Children)
+		}
+		assert.Equal(1, len(chain.FindBlocksByHeight(block.Height)))
+		for _, tx := range block.Txs {
+			_, txBlock, found := chain.FindTxByHash(crypto.Keccak256Hash(tx))
+			require.True(found)
+			assert.Equal(block.Hash(), txBlock.Hash())
+		}
+	}
+	assert.Nil(chain.VerifyBlockLinks(chain.Root().Hash()))
+
+	// Blocks added before a failure are kept.
+	core.ResetTestBlocks()
+	chain = CreateTestChain()
+	blocks = createTestBlockSequence(5, 1, 1)
+	added, err = chain.AddBlocks(append(blocks[:3:3], blocks[2]))
+	assert.NotNil(err)
+	assert.Equal(3, len(added))
+	_, err = chain.FindBlock(blocks[2].Hash())
+	assert.Nil(err)
+}
+
+// BenchmarkAddBlocks adds a mix of empty and full blocks, committing the writes in batches
+// sized by the accumulated bytes and transactions.
+func BenchmarkAddBlocks(b *testing.B) {
+	for _, batchBytes := range []int{64 * 1024, 4 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("batch-%dKB", batchBytes/1024), func(b *testing.B) {
+			viper.Set(common.CfgStorageAddBlocksBatchBytes, batchBytes)
+			defer viper.Set(common.CfgStorageAddBlocksBatchBytes, 4*1024*1024)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				core.ResetTestBlocks()
+				chain := CreateTestChain()
+				blocks := createTestBlockSequence(500, 10, 500)
+				b.StartTimer()
+
+				_, err := chain.AddBlocks(blocks)
+				require.Nil(b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store"
+)
+
+// The evidence is stored by hash, and listed in the order it was added: the hash of the
+// entry i of the list is stored under evidenceListKey(i), and the length of the list under
+// evidenceCountKey. The hashes of the evidence of an offender are stored as a single list.
+
+func evidenceKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("evd/"), hash[:]...)
+}
+
+func evidenceCountKey() common.Bytes {
+	return common.Bytes("evdc")
+}
+
+func evidenceListKey(seq uint64) common.Bytes {
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	return append(common.Bytes("evdl/"), seqBytes[:]...)
+}
+
+func offenderEvidenceKey(offender common.Address) common.Bytes {
+	return append(common.Bytes("evdo/"), offender[:]...)
+}
+
+// The first vote of a validator at a height, and the first block of a proposer in an epoch,
+// are recorded to detect the conflicting ones.
+
+func voteByHeightKey(voter common.Address, height uint64) common.Bytes {
+	key := append(common.Bytes("evdv/"), voter[:]...)
+	var heightBytes [8]byte
+	binary.BigEndian.PutUint64(heightBytes[:], height)
+	return append(key, heightBytes[:]...)
+}
+
+func proposalByEpochKey(proposer common.Address, epoch uint64) common.Bytes {
+	key := append(common.Bytes("evdp/"), proposer[:]...)
+	var epochBytes [8]byte
+	binary.BigEndian.PutUint64(epochBytes[:], epoch)
+	return append(key, epochBytes[:]...)
+}
+
+// DetectDuplicateVote returns the evidence of the vote conflicting with an earlier vote of
+// the same validator for another block at the same height, or nil. The votes for blocks not
+// in the chain are skipped, as their heights are unknown.
+func (ch *Chain) DetectDuplicateVote(vote core.Vote) *core.Evidence {
+	block, err := ch.FindBlock(vote.Block)
+	if err != nil {
+		return nil
+	}
+
+	ch.evidenceMu.Lock()
+	defer ch.evidenceMu.Unlock()
+
+	key := voteByHeightKey(vote.ID, block.Height)
+	first := core.Vote{}
+	if err := ch.store.Get(key, &first); err != nil {
+		if err := ch.store.Put(key, vote); err != nil {
+			logger.Panic(err)
+		}
+		return nil
+	}
+	if first.Block == vote.Block {
+		return nil
+	}
+	firstBlock, err := ch.FindBlock(first.Block)
+	if err != nil {
+		return nil
+	}
+	return core.NewDuplicateVoteEvidence(firstBlock.BlockHeader, first, block.BlockHeader, vote)
+}
+
+// DetectDuplicateProposal returns the evidence of the block conflicting with an earlier block
+// of the same proposer in the same epoch, or nil. The block header needs to be validated.
+func (ch *Chain) DetectDuplicateProposal(header *core.BlockHeader) *core.Evidence {
+	ch.evidenceMu.Lock()
+	defer ch.evidenceMu.Unlock()
+
+	key := proposalByEpochKey(header.Proposer, header.Epoch)
+	var first common.Hash
+	if err := ch.store.Get(key, &first); err != nil {
+		if err := ch.store.Put(key, header.Hash()); err != nil {
+			logger.Panic(err)
+		}
+		return nil
+	}
+	if first == header.Hash() {
+		return nil
+	}
+	firstBlock, err := ch.FindBlock(first)
+	if err != nil {
+		return nil
+	}
+	return core.NewDuplicateProposalEvidence(firstBlock.BlockHeader, header)
+}
+
+// AddEvidence stores the validated evidence, and returns whether it was not stored already.
+func (ch *Chain) AddEvidence(evidence *core.Evidence) (bool, error) {
+	ch.evidenceMu.Lock()
+	defer ch.evidenceMu.Unlock()
+
+	hash := evidence.Hash()
+	if _, err := ch.findEvidence(hash); err == nil {
+		return false, nil
+	}
+	count := ch.evidenceCount()
+	hashes := ch.offenderEvidenceHashes(evidence.Offender)
+
+	// The evidence is saved before the lists, so the readers never see a missing evidence.
+	if err := ch.store.Put(evidenceKey(hash), evidence); err != nil {
+		return false, fmt.Errorf("Failed to save evidence %v: %v", hash.Hex(), err)
+	}
+	if err := ch.store.Put(evidenceListKey(count), hash); err != nil {
+		return false, fmt.Errorf("Failed to save evidence %v: %v", hash.Hex(), err)
+	}
+	if err := ch.store.Put(evidenceCountKey(), count+1); err != nil {
+		return false, fmt.Errorf("Failed to save evidence %v: %v", hash.Hex(), err)
+	}
+	if err := ch.store.Put(offenderEvidenceKey(evidence.Offender), append(hashes, hash)); err != nil {
+		return false, fmt.Errorf("Failed to save evidence %v: %v", hash.Hex(), err)
+	}
+	return true, nil
+}
+
+// FindEvidenceByHash looks up the evidence by hash.
+func (ch *Chain) FindEvidenceByHash(hash common.Hash) (*core.Evidence, error) {
+	return ch.findEvidence(hash)
+}
+
+func (ch *Chain) findEvidence(hash common.Hash) (*core.Evidence, error) {
+	evidence := &core.Evidence{}
+	if err := ch.store.Get(evidenceKey(hash), evidence); err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+func (ch *Chain) evidenceCount() uint64 {
+	var count uint64
+	err := ch.store.Get(evidenceCountKey(), &count)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Panic(err)
+	}
+	return count
+}
+
+func (ch *Chain) offenderEvidenceHashes(offender common.Address) []common.Hash {
+	hashes := []common.Hash{}
+	err := ch.store.Get(offenderEvidenceKey(offender), &hashes)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Panic(err)
+	}
+	return hashes
+}
+
+// GetEvidence returns the evidence in the order it was added, from the sequence number start
+// on, along with the sequence number of the next page, 0 if there is none.
+func (ch *Chain) GetEvidence(start uint64, limit int) ([]*core.Evidence, uint64, error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("Invalid limit: %v", limit)
+	}
+	count := ch.evidenceCount()
+	result := []*core.Evidence{}
+	for seq := start; seq < count; seq++ {
+		if len(result) >= limit {
+			return result, seq, nil
+		}
+		var hash common.Hash
+		if err := ch.store.Get(evidenceListKey(seq), &hash); err != nil {
+			return nil, 0, fmt.Errorf("Failed to read evidence %v: %v", seq, err)
+		}
+		evidence, err := ch.findEvidence(hash)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to read evidence %v: %v", hash.Hex(), err)
+		}
+		result = append(result, evidence)
+	}
+	return result, 0, nil
+}
+
+// GetEvidenceByOffender returns the evidence against the validator.
+func (ch *Chain) GetEvidenceByOffender(offender common.Address) ([]*core.Evidence, error) {
+	result := []*core.Evidence{}
+	for _, hash := range ch.offenderEvidenceHashes(offender) {
+		evidence, err := ch.findEvidence(hash)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read evidence %v: %v", hash.Hex(), err)
+		}
+		result = append(result, evidence)
+	}
+	return result, nil
+}
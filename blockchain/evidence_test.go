@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestEvidence(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+		"b1", "a0",
+		"a2", "a1",
+	})
+	a1 := core.GetTestBlock("a1")
+	b1 := core.GetTestBlock("b1")
+	a2 := core.GetTestBlock("a2")
+
+	voter := common.HexToAddress("0x1")
+	other := common.HexToAddress("0x2")
+
+	// Votes at increasing heights, and repeated votes, do not conflict.
+	assert.Nil(chain.DetectDuplicateVote(core.Vote{Block: a1.Hash(), Height: 1, Epoch: 1, ID: voter}))
+	assert.Nil(chain.DetectDuplicateVote(core.Vote{Block: a1.Hash(), Height: 1, Epoch: 2, ID: voter}))
+	assert.Nil(chain.DetectDuplicateVote(core.Vote{Block: a2.Hash(), Height: 2, Epoch: 2, ID: voter}))
+	assert.Nil(chain.DetectDuplicateVote(core.Vote{Block: b1.Hash(), Height: 1, Epoch: 2, ID: other}))
+	// Votes for unknown blocks are skipped.
+	assert.Nil(chain.DetectDuplicateVote(core.Vote{Block: common.HexToHash("0x99"), Height: 1, ID: voter}))
+
+	ev := chain.DetectDuplicateVote(core.Vote{Block: b1.Hash(), Height: 1, Epoch: 3, ID: voter})
+	require.NotNil(ev)
+	assert.Equal(core.EvidenceTypeDuplicateVote, ev.Type)
+	assert.Equal(voter, ev.Offender)
+	assert.Equal(uint64(1), ev.Height())
+
+	added, err := chain.AddEvidence(ev)
+	require.Nil(err)
+	assert.True(added)
+	added, err = chain.AddEvidence(ev)
+	require.Nil(err)
+	assert.False(added)
+
+	// A second block of the proposer of a1 in the same epoch.
+	header := *a1.BlockHeader
+	header.StateHash = common.HexToHash("0x1234")
+	header.Signature, _ = core.DefaultSigner.Sign(header.SignBytes())
+	header.UpdateHash()
+	assert.Nil(chain.DetectDuplicateProposal(a1.BlockHeader))
+	assert.Nil(chain.DetectDuplicateProposal(a1.BlockHeader))
+	_, err = chain.AddBlock(&core.Block{BlockHeader: &header})
+	require.Nil(err)
+	proposalEv := chain.DetectDuplicateProposal(&header)
+	require.NotNil(proposalEv)
+	assert.True(proposalEv.Validate("testchain").IsOK())
+	added, err = chain.AddEvidence(proposalEv)
+	require.Nil(err)
+	assert.True(added)
+
+	found, err := chain.FindEvidenceByHash(ev.Hash())
+	require.Nil(err)
+	assert.Equal(ev.Hash(), found.Hash())
+
+	list, next, err := chain.GetEvidence(0, 1)
+	require.Nil(err)
+	assert.Equal(uint64(1), next)
+	require.Equal(1, len(list))
+	assert.Equal(ev.Hash(), list[0].Hash())
+	list, next, err = chain.GetEvidence(next, 1)
+	require.Nil(err)
+	assert.Equal(uint64(0), next)
+	require.Equal(1, len(list))
+	assert.Equal(proposalEv.Hash(), list[0].Hash())
+
+	list, err = chain.GetEvidenceByOffender(voter)
+	require.Nil(err)
+	assert.Equal(1, len(list))
+	list, err = chain.GetEvidenceByOffender(other)
+	require.Nil(err)
+	assert.Equal(0, len(list))
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// FinalityStatus is the finality of a block, as seen by downstream services deciding whether
+// a block is confirmed.
+type FinalityStatus string
+
+const (
+	// FinalityStatusPending is a block which can still be finalized, but hasn't been committed.
+	FinalityStatusPending FinalityStatus = "pending"
+	// FinalityStatusCommitted is a block which has been committed, but not finalized yet.
+	FinalityStatusCommitted FinalityStatus = "committed"
+	// FinalityStatusDirectlyFinalized is a block finalized by the votes on it, or trusted.
+	FinalityStatusDirectlyFinalized FinalityStatus = "directly-finalized"
+	// FinalityStatusIndirectlyFinalized is a block finalized as an ancestor of a directly
+	// finalized block.
+	FinalityStatusIndirectlyFinalized FinalityStatus = "indirectly-finalized"
+	// FinalityStatusOrphaned is a block which will never be finalized, either because another
+	// block has been finalized at its height, or because it is invalid.
+	FinalityStatusOrphaned FinalityStatus = "orphaned"
+)
+
+// GetFinalityStatus returns the finality status of the block, along with the directly
+// finalized block which finalized it, i.e. the block itself if directly finalized, or its
+// closest directly finalized descendant if indirectly finalized. The finalizing block is empty
+// if the block is not finalized, or if the descendant is more than maxDistance blocks above.
+func (ch *Chain) GetFinalityStatus(hash common.Hash) (FinalityStatus, common.Hash, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	block, err := ch.findBlock(hash)
+	if err != nil {
+		return "", common.Hash{}, fmt.Errorf("Failed to find block %v: %v", hash.Hex(), err)
+	}
+
+	switch {
+	case block.Status.IsDirectlyFinalized() || block.Status.IsTrusted():
+		return FinalityStatusDirectlyFinalized, hash, nil
+	case block.Status.IsIndirectlyFinalized():
+		return FinalityStatusIndirectlyFinalized, ch.findFinalizingDescendant(block), nil
+	case block.Status.IsInvalid() || block.Height <= ch.finalizedHeight:
+		return FinalityStatusOrphaned, common.Hash{}, nil
+	case block.Status.IsCommitted():
+		return FinalityStatusCommitted, common.Hash{}, nil
+	default:
+		return FinalityStatusPending, common.Hash{}, nil
+	}
+}
+
+// findFinalizingDescendant follows the finalized children of the indirectly finalized block
+// up to the first directly finalized one.
+func (ch *Chain) findFinalizingDescendant(block *core.ExtendedBlock) common.Hash {
+	for i := 0; i < maxDistance; i++ {
+		var next *core.ExtendedBlock
+		for _, childHash := range block.Children {
+			child, err := ch.findBlock(childHash)
+			if err == nil && child.Status.IsFinalized() {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return common.Hash{}
+		}
+		if next.Status.IsDirectlyFinalized() {
+			return next.Hash()
+		}
+		block = next
+	}
+	return common.Hash{}
+}
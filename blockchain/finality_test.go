@@ -0,0 +1,52 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestGetFinalityStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	for _, pair := range [][2]string{{"a1", "a0"}, {"a2", "a1"}, {"b2", "a1"}, {"a3", "a2"}, {"a4", "a3"}, {"a5", "a4"}, {"c5", "a4"}} {
+		_, err := chain.AddBlock(core.CreateTestBlock(pair[0], pair[1]))
+		require.Nil(err)
+	}
+	hash := func(name string) common.Hash {
+		return core.GetTestBlock(name).Hash()
+	}
+	require.Nil(chain.FinalizePreviousBlocks(hash("a3")))
+	chain.CommitBlock(hash("a4"))
+	chain.MarkBlockInvalid(hash("c5"))
+
+	for _, c := range []struct {
+		name        string
+		status      FinalityStatus
+		finalizedBy common.Hash
+	}{
+		{"a0", FinalityStatusDirectlyFinalized, hash("a0")},
+		{"a1", FinalityStatusIndirectlyFinalized, hash("a3")},
+		{"a2", FinalityStatusIndirectlyFinalized, hash("a3")},
+		{"a3", FinalityStatusDirectlyFinalized, hash("a3")},
+		{"b2", FinalityStatusOrphaned, common.Hash{}},
+		{"a4", FinalityStatusCommitted, common.Hash{}},
+		{"a5", FinalityStatusPending, common.Hash{}},
+		{"c5", FinalityStatusOrphaned, common.Hash{}},
+	} {
+		status, finalizedBy, err := chain.GetFinalityStatus(hash(c.name))
+		require.Nil(err, c.name)
+		assert.Equal(c.status, status, c.name)
+		assert.Equal(c.finalizedBy, finalizedBy, c.name)
+	}
+
+	_, _, err := chain.GetFinalityStatus(common.Hash{0x1})
+	assert.NotNil(err)
+}
@@ -0,0 +1,65 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/store"
+)
+
+// BackfillIndexes adds the blocks stored before the cumulative tx counts and the log index were
+// introduced to them, from the root up to the highest height with blocks. The blocks with a
+// cumulative tx count are skipped, and the log blooms are merged, so the backfill can be
+// interrupted and rerun. The log index is only backfilled if CfgStorageIndexLogs is enabled.
+// It holds the chain lock throughout, and is meant to run while the node is stopped. It
+// returns the number of blocks visited.
+func (ch *Chain) BackfillIndexes() (int, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	root, err := ch.findBlock(ch.root)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to find the root block: %v", err)
+	}
+
+	target := ch
+	var buffered store.BufferedStore
+	if creator, ok := ch.store.(bufferedStoreCreator); ok {
+		buffered = creator.NewBufferedStore()
+		target = ch.newBatchChain(buffered)
+	}
+	commit := func() error {
+		if buffered == nil {
+			return nil
+		}
+		return ch.commitBatch(target)
+	}
+
+	count := 0
+	for height := root.Height; ; height++ {
+		blocks := target.findBlocksByHeight(height)
+		if len(blocks) == 0 && height > ch.finalizedHeight {
+			break
+		}
+		for _, block := range blocks {
+			hash := block.Hash()
+			var txCount uint64
+			err := target.store.Get(cumulativeTxCountKey(hash), &txCount)
+			if err == store.ErrKeyNotFound {
+				// The blocks are visited by height, so the count of the parent is known.
+				target.addCumulativeTxCount(block, hash == ch.root)
+			} else if err != nil {
+				return count, err
+			}
+			if ch.indexLogs && block.Status.IsFinalized() {
+				target.addBlockToLogIndex(block)
+			}
+			count++
+		}
+		if buffered != nil && buffered.PendingSize() >= ch.addBlocksBatchBytes {
+			if err := commit(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, commit()
+}
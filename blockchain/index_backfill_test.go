@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestBackfillIndexes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	// The txs are signed, the tx index decodes the signatures.
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	from := privKey.PublicKey().Address()
+	contract := common.HexToAddress("0xc1")
+	transfer := common.HexToHash("0x01")
+	addBlock := func(name, parent string, logs []*types.Log) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		tx := &types.SmartContractTx{
+			From:     types.NewTxInput(from, types.NewCoins(0, 0), int(block.Height)),
+			To:       types.TxOutput{Address: contract},
+			GasLimit: 100000,
+			GasPrice: big.NewInt(1),
+		}
+		sig, err := privKey.Sign(tx.SignBytes(chain.ChainID))
+		require.Nil(err)
+		tx.SetSignature(from, sig)
+		raw, err := types.TxToBytes(tx)
+		require.Nil(err)
+		block.Txs = append(block.Txs, raw)
+		block.UpdateHash()
+		_, err = chain.AddBlock(block)
+		require.Nil(err)
+		chain.AddTxReceipt(tx, logs, nil, nil, common.Address{}, 21000, nil)
+		return block
+	}
+
+	a1 := addBlock("a1", "a0", []*types.Log{{Address: contract, Topics: []common.Hash{transfer}}})
+	a2 := addBlock("a2", "a1", nil)
+	a3 := addBlock("a3", "a2", []*types.Log{{Address: contract, Topics: []common.Hash{transfer}}})
+	require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+
+	// The blocks were stored before the indexes were introduced.
+	for _, block := range []*core.Block{a1, a2, a3} {
+		require.Nil(chain.store.Delete(cumulativeTxCountKey(block.Hash())))
+	}
+	chain.indexLogs = true
+	_, err = chain.CumulativeTxCount(2)
+	assert.NotNil(err)
+	logs, err := chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100})
+	require.Nil(err)
+	assert.Equal(0, len(logs))
+
+	count, err := chain.BackfillIndexes()
+	require.Nil(err)
+	assert.Equal(4, count)
+	for height, expected := range []uint64{0, 1, 2, 3} {
+		actual, err := chain.CumulativeTxCount(uint64(height))
+		require.Nil(err)
+		assert.Equal(expected, actual, "height %v", height)
+	}
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100})
+	require.Nil(err)
+	require.Equal(2, len(logs))
+	assert.Equal(a1.Hash(), logs[0].BlockHash)
+	assert.Equal(a3.Hash(), logs[1].BlockHash)
+
+	// Rerunning the backfill changes nothing.
+	_, err = chain.BackfillIndexes()
+	require.Nil(err)
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100})
+	require.Nil(err)
+	assert.Equal(2, len(logs))
+}
@@ -0,0 +1,180 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store"
+)
+
+// The internal transactions of an address are stored as a list in the order of their
+// finalization, like the transactions of an address, see addressTxKey.
+
+func addressInternalTxCountKey(address common.Address) common.Bytes {
+	return append(common.Bytes("itac/"), address[:]...)
+}
+
+func addressInternalTxKey(address common.Address, seq uint64) common.Bytes {
+	key := append(common.Bytes("ita/"), address[:]...)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	return append(key, seqBytes[:]...)
+}
+
+// InternalTxEntry is a value transfer by a smart contract, along with the transaction whose
+// execution made it.
+type InternalTxEntry struct {
+	TxHash        common.Hash
+	BlockHash     common.Hash
+	BlockHeight   uint64
+	Index         uint64 // index of the transaction in the block
+	InternalIndex uint64 // index of the internal transaction in the receipt
+	InternalTx    types.InternalTx
+}
+
+// GetInternalTxsByBlock returns the value transfers by the smart contracts executed by the
+// transactions of the block, in their execution order, as recorded in the tx receipts.
+func (ch *Chain) GetInternalTxsByBlock(blockHash common.Hash) ([]*InternalTxEntry, error) {
+	block, err := ch.FindBlock(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+	return ch.blockInternalTxs(block), nil
+}
+
+func (ch *Chain) blockInternalTxs(block *core.ExtendedBlock) []*InternalTxEntry {
+	entries := []*InternalTxEntry{}
+	for idx, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			logger.Errorf("Failed to decode tx %v of block %v: %v", idx, block.Hash().Hex(), err)
+			continue
+		}
+		if _, ok := tx.(*types.SmartContractTx); !ok {
+			continue
+		}
+		txHash := crypto.Keccak256Hash(rawTx)
+		receipt, found := ch.FindTxReceiptByHash(txHash)
+		if !found {
+			continue
+		}
+		for internalIdx, internalTx := range receipt.InternalTxs {
+			entries = append(entries, &InternalTxEntry{
+				TxHash:        txHash,
+				BlockHash:     block.Hash(),
+				BlockHeight:   block.Height,
+				Index:         uint64(idx),
+				InternalIndex: uint64(internalIdx),
+				InternalTx:    *internalTx,
+			})
+		}
+	}
+	return entries
+}
+
+// addInternalTxsToAddressIndex appends the internal transactions of the finalized block to
+// the lists of their senders and recipients. The blocks need to be added in increasing
+// height, like for addTxsToAddressIndex.
+func (ch *Chain) addInternalTxsToAddressIndex(block *core.ExtendedBlock) {
+	for _, entry := range ch.blockInternalTxs(block) {
+		ch.appendAddressInternalTx(entry.InternalTx.From, entry)
+		if entry.InternalTx.To != entry.InternalTx.From {
+			ch.appendAddressInternalTx(entry.InternalTx.To, entry)
+		}
+	}
+}
+
+func (ch *Chain) appendAddressInternalTx(address common.Address, entry *InternalTxEntry) {
+	count := ch.addressInternalTxCount(address)
+	if count > 0 {
+		last, err := ch.getAddressInternalTx(address, count-1)
+		if err != nil {
+			logger.Panic(err)
+		}
+		if !internalTxEntryBefore(last, entry) {
+			return
+		}
+	}
+	// The entry is saved before the count, so the readers never see a missing entry.
+	if err := ch.store.Put(addressInternalTxKey(address, count), *entry); err != nil {
+		logger.Panic(err)
+	}
+	if err := ch.store.Put(addressInternalTxCountKey(address), count+1); err != nil {
+		logger.Panic(err)
+	}
+}
+
+// internalTxEntryBefore returns whether the entry a was made before the entry b.
+func internalTxEntryBefore(a, b *InternalTxEntry) bool {
+	if a.BlockHeight != b.BlockHeight {
+		return a.BlockHeight < b.BlockHeight
+	}
+	if a.Index != b.Index {
+		return a.Index < b.Index
+	}
+	return a.InternalIndex < b.InternalIndex
+}
+
+func (ch *Chain) addressInternalTxCount(address common.Address) uint64 {
+	var count uint64
+	err := ch.store.Get(addressInternalTxCountKey(address), &count)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Panic(err)
+	}
+	return count
+}
+
+func (ch *Chain) getAddressInternalTx(address common.Address, seq uint64) (*InternalTxEntry, error) {
+	entry := &InternalTxEntry{}
+	if err := ch.store.Get(addressInternalTxKey(address, seq), entry); err != nil {
+		return nil, fmt.Errorf("Failed to read internal tx %v of address %v: %v", seq, address.Hex(), err)
+	}
+	return entry, nil
+}
+
+// GetInternalTxsByAddress returns the finalized internal transactions sent or received by
+// the address from the start height on, paged like GetTxsByAddress.
+func (ch *Chain) GetInternalTxsByAddress(address common.Address, startHeight uint64, limit int) ([]*InternalTxEntry, uint64, error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("Invalid limit: %v", limit)
+	}
+	if !ch.indexInternalTxs {
+		return nil, 0, fmt.Errorf("The internal transactions are not indexed, see %v", common.CfgStorageIndexInternalTxs)
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	// Binary search of the first entry at or above the start height.
+	count := ch.addressInternalTxCount(address)
+	lo, hi := uint64(0), count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		entry, err := ch.getAddressInternalTx(address, mid)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry.BlockHeight < startHeight {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	entries := []*InternalTxEntry{}
+	for seq := lo; seq < count; seq++ {
+		entry, err := ch.getAddressInternalTx(address, seq)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(entries) >= limit && entry.BlockHeight != entries[len(entries)-1].BlockHeight {
+			return entries, entry.BlockHeight, nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries, 0, nil
+}
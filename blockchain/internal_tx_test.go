@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestInternalTxIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+	chain.indexInternalTxs = true
+
+	contract := common.HexToAddress("0xc1")
+	alice := common.HexToAddress("0xa1")
+	bob := common.HexToAddress("0xb1")
+
+	sequence := uint64(0)
+	addBlock := func(name, parent string, internalTxs ...[]*types.InternalTx) *core.Block {
+		txs := []*types.SmartContractTx{}
+		block := core.CreateTestBlock(name, parent)
+		for range internalTxs {
+			sequence++
+			tx := newTestSmartContractTx(t, contract, sequence)
+			raw, err := types.TxToBytes(tx)
+			require.Nil(err)
+			block.Txs = append(block.Txs, raw)
+			txs = append(txs, tx)
+		}
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		for i, tx := range txs {
+			chain.AddTxReceipt(tx, nil, internalTxs[i], nil, common.Address{}, 21000, nil)
+		}
+		return block
+	}
+	transfer := func(to common.Address, tfuel int64) *types.InternalTx {
+		return &types.InternalTx{Type: types.InternalTxTypeCall, From: contract, To: to, Coins: types.NewCoins(0, tfuel), Depth: 1}
+	}
+
+	a1 := addBlock("a1", "a0", []*types.InternalTx{transfer(alice, 10), transfer(bob, 20)})
+	a2 := addBlock("a2", "a1", nil, []*types.InternalTx{transfer(alice, 30)})
+	// The internal txs of the fork are not indexed.
+	addBlock("b2", "a1", []*types.InternalTx{transfer(alice, 40)})
+	a3 := addBlock("a3", "a2")
+	require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+
+	entries, err := chain.GetInternalTxsByBlock(a1.Hash())
+	require.Nil(err)
+	require.Equal(2, len(entries))
+	assert.Equal(uint64(1), entries[1].InternalIndex)
+	assert.Equal(bob, entries[1].InternalTx.To)
+	assert.Equal(int64(20), entries[1].InternalTx.Coins.TFuelWei.Int64())
+
+	entries, nextHeight, err := chain.GetInternalTxsByAddress(alice, 0, 10)
+	require.Nil(err)
+	assert.Equal(uint64(0), nextHeight)
+	require.Equal(2, len(entries))
+	assert.Equal(a1.Hash(), entries[0].BlockHash)
+	assert.Equal(a2.Hash(), entries[1].BlockHash)
+	assert.Equal(uint64(1), entries[1].Index)
+	assert.Equal(int64(30), entries[1].InternalTx.Coins.TFuelWei.Int64())
+
+	// The sender is indexed too.
+	entries, nextHeight, err = chain.GetInternalTxsByAddress(contract, 0, 1)
+	require.Nil(err)
+	assert.Equal(a2.Height, nextHeight)
+	assert.Equal(2, len(entries)) // the internal txs of a block are not split across pages
+
+	// Indexing the block again is a no-op.
+	chain.addInternalTxsToAddressIndex(&core.ExtendedBlock{Block: a2})
+	assert.Equal(uint64(2), chain.addressInternalTxCount(alice))
+
+	// The receipts recorded before the internal txs decode with none.
+	oldReceipt := struct {
+		TxHash          common.Hash
+		Logs            []*types.Log
+		EvmRet          common.Bytes
+		ContractAddress common.Address
+		GasUsed         uint64
+		EvmErr          string
+	}{TxHash: common.HexToHash("0x1234"), GasUsed: 21000}
+	require.Nil(chain.store.Put(txReceiptKey(oldReceipt.TxHash), oldReceipt))
+	receipt, found := chain.FindTxReceiptByHash(oldReceipt.TxHash)
+	require.True(found)
+	assert.Equal(uint64(21000), receipt.GasUsed)
+	assert.Equal(0, len(receipt.InternalTxs))
+}
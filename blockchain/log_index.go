@@ -0,0 +1,255 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store"
+)
+
+// LogBloomSectionSize is the number of heights whose block blooms are merged into a section
+// bloom, which lets the log queries skip the sections without a match.
+const LogBloomSectionSize = 4096
+
+func blockLogBloomKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("lb/"), hash[:]...)
+}
+
+func logBloomSectionKey(section uint64) common.Bytes {
+	var sectionBytes [8]byte
+	binary.BigEndian.PutUint64(sectionBytes[:], section)
+	return append(common.Bytes("lbs/"), sectionBytes[:]...)
+}
+
+// LogFilter selects the logs of the finalized blocks in a height range. A log matches if it
+// was emitted by one of the addresses, and for each position of the topics, its topic is one
+// of the listed topics. An empty address or topic list matches anything.
+type LogFilter struct {
+	FromHeight uint64
+	ToHeight   uint64
+	Addresses  []common.Address
+	Topics     [][]common.Hash
+}
+
+// FilteredLog is a log matching a filter, with its position in the chain.
+type FilteredLog struct {
+	*types.Log
+	BlockHash   common.Hash
+	BlockHeight uint64
+	TxHash      common.Hash
+	TxIndex     uint64
+	LogIndex    uint64 // index of the log in the block
+}
+
+// logsBloom returns the bloom of the addresses and topics of the logs.
+func logsBloom(logs []*types.Log) core.Bloom {
+	bin := new(big.Int)
+	for _, log := range logs {
+		bin.Or(bin, core.Bloom9(log.Address.Bytes()))
+		for _, topic := range log.Topics {
+			bin.Or(bin, core.Bloom9(topic.Bytes()))
+		}
+	}
+	return core.BytesToBloom(bin.Bytes())
+}
+
+// addBlockToLogIndex saves the bloom of the logs of the finalized block, and merges it into
+// the bloom of its section. The blocks without logs are left out.
+func (ch *Chain) addBlockToLogIndex(block *core.ExtendedBlock) {
+	logs := []*types.Log{}
+	for _, rawTx := range block.Txs {
+		if receipt, found := ch.FindTxReceiptByHash(crypto.Keccak256Hash(rawTx)); found {
+			logs = append(logs, receipt.Logs...)
+		}
+	}
+	if len(logs) == 0 {
+		return
+	}
+	bloom := logsBloom(logs)
+	if err := ch.store.Put(blockLogBloomKey(block.Hash()), bloom); err != nil {
+		logger.Panic(err)
+	}
+
+	section := block.Height / LogBloomSectionSize
+	sectionBloom, err := ch.getLogBloom(logBloomSectionKey(section))
+	if err != nil {
+		logger.Panic(err)
+	}
+	merged := new(big.Int).Or(sectionBloom.Big(), bloom.Big())
+	if err := ch.store.Put(logBloomSectionKey(section), core.BytesToBloom(merged.Bytes())); err != nil {
+		logger.Panic(err)
+	}
+}
+
+// getLogBloom returns the bloom saved under the key, empty if there is none.
+func (ch *Chain) getLogBloom(key common.Bytes) (core.Bloom, error) {
+	var bloom core.Bloom
+	err := ch.store.Get(key, &bloom)
+	if err != nil && err != store.ErrKeyNotFound {
+		return bloom, err
+	}
+	return bloom, nil
+}
+
+// GetLogs returns the logs of the finalized blocks matching the filter, in chain order. The
+// range is capped at the finalized height. The blocks finalized before the logs were indexed
+// are only matched once BackfillIndexes has run.
+func (ch *Chain) GetLogs(filter *LogFilter) ([]*FilteredLog, error) {
+	if !ch.indexLogs {
+		return nil, fmt.Errorf("The logs are not indexed, see %v", common.CfgStorageIndexLogs)
+	}
+	if filter.FromHeight > filter.ToHeight {
+		return nil, fmt.Errorf("Invalid height range: %v to %v", filter.FromHeight, filter.ToHeight)
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	toHeight := filter.ToHeight
+	if toHeight > ch.finalizedHeight {
+		toHeight = ch.finalizedHeight
+	}
+	result := []*FilteredLog{}
+	for height := filter.FromHeight; height <= toHeight; {
+		section := height / LogBloomSectionSize
+		sectionEnd := (section+1)*LogBloomSectionSize - 1
+		if sectionEnd > toHeight {
+			sectionEnd = toHeight
+		}
+		sectionBloom, err := ch.getLogBloom(logBloomSectionKey(section))
+		if err != nil {
+			return nil, err
+		}
+		if filter.matchesBloom(sectionBloom) {
+			for ; height <= sectionEnd; height++ {
+				logs, err := ch.getBlockLogs(height, filter)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, logs...)
+			}
+		}
+		height = sectionEnd + 1
+	}
+	return result, nil
+}
+
+// getBlockLogs returns the logs of the finalized block at the height matching the filter.
+func (ch *Chain) getBlockLogs(height uint64, filter *LogFilter) ([]*FilteredLog, error) {
+	var block *core.ExtendedBlock
+	for _, b := range ch.findBlocksByHeight(height) {
+		if b.Status.IsFinalized() {
+			block = b
+			break
+		}
+	}
+	if block == nil {
+		return nil, nil
+	}
+	bloom, err := ch.getLogBloom(blockLogBloomKey(block.Hash()))
+	if err != nil {
+		return nil, err
+	}
+	if !filter.matchesBloom(bloom) {
+		return nil, nil
+	}
+
+	logs := []*FilteredLog{}
+	logIndex := uint64(0)
+	for txIndex, rawTx := range block.Txs {
+		txHash := crypto.Keccak256Hash(rawTx)
+		receipt, found := ch.FindTxReceiptByHash(txHash)
+		if !found {
+			continue
+		}
+		for _, log := range receipt.Logs {
+			if filter.matches(log) {
+				logs = append(logs, &FilteredLog{
+					Log:         log,
+					BlockHash:   block.Hash(),
+					BlockHeight: block.Height,
+					TxHash:      txHash,
+					TxIndex:     uint64(txIndex),
+					LogIndex:    logIndex,
+				})
+			}
+			logIndex++
+		}
+	}
+	return logs, nil
+}
+
+// matchesBloom returns false if no log of the bloom can match the filter.
+func (filter *LogFilter) matchesBloom(bloom core.Bloom) bool {
+	if (bloom == core.Bloom{}) {
+		return false
+	}
+	if len(filter.Addresses) > 0 {
+		found := false
+		for _, address := range filter.Addresses {
+			if core.BloomLookup(bloom, address) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range topics {
+			if core.BloomLookup(bloom, topic) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns whether the log matches the addresses and topics of the filter.
+func (filter *LogFilter) matches(log *types.Log) bool {
+	if len(filter.Addresses) > 0 {
+		found := false
+		for _, address := range filter.Addresses {
+			if log.Address == address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(filter.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range topics {
+			if log.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
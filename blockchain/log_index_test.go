@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestGetLogs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+	chain.indexLogs = true
+
+	contract1 := common.HexToAddress("0xc1")
+	contract2 := common.HexToAddress("0xc2")
+	transfer := common.HexToHash("0x01")
+	approval := common.HexToHash("0x02")
+	holder := common.HexToHash("0x03")
+
+	sequence := uint64(0)
+	addBlock := func(name, parent string, logs ...[]*types.Log) *core.Block {
+		txs := []*types.SmartContractTx{}
+		block := core.CreateTestBlock(name, parent)
+		for range logs {
+			sequence++
+			tx := newTestSmartContractTx(t, contract1, sequence)
+			raw, err := types.TxToBytes(tx)
+			require.Nil(err)
+			block.Txs = append(block.Txs, raw)
+			txs = append(txs, tx)
+		}
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		for i, tx := range txs {
+			chain.AddTxReceipt(tx, logs[i], nil, nil, common.Address{}, 21000, nil)
+		}
+		return block
+	}
+
+	a1 := addBlock("a1", "a0", []*types.Log{
+		{Address: contract1, Topics: []common.Hash{transfer, holder}},
+		{Address: contract2, Topics: []common.Hash{approval}},
+	})
+	addBlock("a2", "a1", nil)
+	a3 := addBlock("a3", "a2", []*types.Log{{Address: contract2, Topics: []common.Hash{transfer}}},
+		[]*types.Log{{Address: contract1, Topics: []common.Hash{approval, holder}}})
+	// The logs of the fork are not indexed.
+	addBlock("b3", "a2", []*types.Log{{Address: contract1, Topics: []common.Hash{transfer}}})
+	a4 := addBlock("a4", "a3")
+	require.Nil(chain.FinalizePreviousBlocks(a4.Hash()))
+
+	logs, err := chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100})
+	require.Nil(err)
+	require.Equal(4, len(logs))
+	assert.Equal(a1.Hash(), logs[0].BlockHash)
+	assert.Equal(uint64(1), logs[1].LogIndex)
+	assert.Equal(a3.Height, logs[3].BlockHeight)
+	assert.Equal(uint64(1), logs[3].TxIndex)
+	assert.Equal(uint64(1), logs[3].LogIndex)
+
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100, Addresses: []common.Address{contract1}})
+	require.Nil(err)
+	require.Equal(2, len(logs))
+	assert.Equal(a1.Height, logs[0].BlockHeight)
+	assert.Equal(a3.Height, logs[1].BlockHeight)
+
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100, Topics: [][]common.Hash{{transfer}}})
+	require.Nil(err)
+	require.Equal(2, len(logs))
+	assert.Equal(contract1, logs[0].Address)
+	assert.Equal(contract2, logs[1].Address)
+
+	// The second topic is holder, the first one either.
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: 0, ToHeight: 100, Topics: [][]common.Hash{{}, {holder}}})
+	require.Nil(err)
+	assert.Equal(2, len(logs))
+
+	logs, err = chain.GetLogs(&LogFilter{FromHeight: a3.Height, ToHeight: a3.Height, Addresses: []common.Address{contract1},
+		Topics: [][]common.Hash{{transfer}}})
+	require.Nil(err)
+	assert.Empty(logs)
+
+	_, err = chain.GetLogs(&LogFilter{FromHeight: 2, ToHeight: 1})
+	assert.NotNil(err)
+}
@@ -0,0 +1,259 @@
+package blockchain
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store"
+)
+
+// orphanPruningProgressKey is the DB key of the last height pruned by the orphan pruner.
+var orphanPruningProgressKey = common.Bytes("opr/height")
+
+// orphanPruningBatchSize is the number of heights pruned between two checks of the context.
+const orphanPruningBatchSize = 256
+
+// PruneOrphanBlocks removes the blocks which are not on the finalized chain at the heights of
+// the range, along with their tx index entries, tx receipts, and the links from their parents.
+// The heights without a finalized block are left untouched. It returns the number of blocks
+// removed.
+func (ch *Chain) PruneOrphanBlocks(startHeight, endHeight uint64) (int, error) {
+	pruned := 0
+	for height := startHeight; height <= endHeight; height++ {
+		count, err := ch.pruneOrphanBlocksAtHeight(height)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += count
+		if height == endHeight {
+			break
+		}
+	}
+	return pruned, nil
+}
+
+func (ch *Chain) pruneOrphanBlocksAtHeight(height uint64) (int, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	key := blockByHeightIndexKey(height)
+	entry := BlockByHeightIndexEntry{}
+	err := ch.store.Get(key, &entry)
+	if err == store.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	blocks := []*core.ExtendedBlock{}
+	canonical := false
+	for _, hash := range entry.Blocks {
+		block, err := ch.findBlock(hash)
+		if err == store.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		canonical = canonical || block.Status.IsFinalized()
+		blocks = append(blocks, block)
+	}
+	if !canonical {
+		return 0, nil
+	}
+
+	remaining := []common.Hash{}
+	pruned := 0
+	for _, block := range blocks {
+		if block.Status.IsFinalized() || block.Hash() == ch.root {
+			remaining = append(remaining, block.Hash())
+			continue
+		}
+		if err := ch.pruneBlock(block); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+	if err := ch.store.Put(key, BlockByHeightIndexEntry{Blocks: remaining}); err != nil {
+		return pruned, err
+	}
+	return pruned, nil
+}
+
+// pruneBlock deletes the orphan block, the tx index entries and receipts of the transactions
+// only it includes, and its link from its parent.
+func (ch *Chain) pruneBlock(block *core.ExtendedBlock) error {
+	blockHash := block.Hash()
+	if err := ch.unindexBlockTxs(block); err != nil {
+		return err
+	}
+
+	if parent, err := ch.findBlock(block.Parent); err == nil {
+		children := []common.Hash{}
+		for _, child := range parent.Children {
+			if child != blockHash {
+				children = append(children, child)
+			}
+		}
+		if len(children) != len(parent.Children) {
+			parent.Children = children
+			if err := ch.saveBlock(parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := ch.store.Delete(cumulativeTxCountKey(blockHash)); err != nil {
+		return err
+	}
+	if err := ch.store.Delete(blockSkipKey(blockHash)); err != nil {
+		return err
+	}
+	if ch.indexStateRoot {
+		stateRootBlock := common.Hash{}
+		if err := ch.store.Get(blockByStateRootIndexKey(block.StateHash), &stateRootBlock); err == nil && stateRootBlock == blockHash {
+			if err := ch.store.Delete(blockByStateRootIndexKey(block.StateHash)); err != nil {
+				return err
+			}
+		}
+	}
+	return ch.store.Delete(blockHash[:])
+}
+
+// OrphanPruner periodically removes the orphan blocks older than the retained number of blocks
+// below the finalized height.
+type OrphanPruner struct {
+	chain    *Chain
+	retained uint64
+	interval uint64
+
+	trigger chan uint64
+
+	// Life cycle
+	wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewOrphanPruner creates a pruner running every interval finalized blocks, and keeping the
+// orphan blocks of the retained latest heights.
+func NewOrphanPruner(chain *Chain, retained, interval uint64) *OrphanPruner {
+	if interval == 0 {
+		interval = 1
+	}
+	p := &OrphanPruner{
+		chain:    chain,
+		retained: retained,
+		interval: interval,
+		trigger:  make(chan uint64, 1),
+		wg:       &sync.WaitGroup{},
+	}
+	chain.SubscribeFinalization(p.onFinalized)
+	return p
+}
+
+// Start starts pruning in the background.
+func (p *OrphanPruner) Start(ctx context.Context) {
+	c, cancel := context.WithCancel(ctx)
+	p.ctx = c
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go p.mainLoop()
+}
+
+// Stop notifies the pruner to stop without blocking.
+func (p *OrphanPruner) Stop() {
+	p.cancel()
+}
+
+// Wait blocks until the pruner stops.
+func (p *OrphanPruner) Wait() {
+	p.wg.Wait()
+}
+
+// onFinalized triggers a pruning run if the height is due. A pending run is replaced by the
+// newer one, the finalization is never blocked.
+func (p *OrphanPruner) onFinalized(block *core.ExtendedBlock) {
+	if block.Height%p.interval != 0 {
+		return
+	}
+	for {
+		select {
+		case p.trigger <- block.Height:
+			return
+		default:
+		}
+		select {
+		case <-p.trigger:
+		default:
+		}
+	}
+}
+
+func (p *OrphanPruner) mainLoop() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case height := <-p.trigger:
+			if height <= p.retained {
+				continue
+			}
+			if err := p.prune(height - p.retained); err != nil {
+				logger.WithFields(log.Fields{"height": height, "err": err}).Warn("Failed to prune the orphan blocks")
+			}
+		}
+	}
+}
+
+// prune prunes the heights from the last pruned height up to the end height, saving the
+// progress after each batch.
+func (p *OrphanPruner) prune(endHeight uint64) error {
+	var lastPruned uint64
+	err := p.chain.store.Get(orphanPruningProgressKey, &lastPruned)
+	if err == store.ErrKeyNotFound {
+		root, err := p.chain.FindBlock(p.chain.root)
+		if err != nil {
+			return err
+		}
+		lastPruned = root.Height
+	} else if err != nil {
+		return err
+	}
+
+	total := 0
+	for lastPruned < endHeight {
+		select {
+		case <-p.ctx.Done():
+			return nil
+		default:
+		}
+		batchEnd := lastPruned + orphanPruningBatchSize
+		if batchEnd > endHeight {
+			batchEnd = endHeight
+		}
+		pruned, err := p.chain.PruneOrphanBlocks(lastPruned+1, batchEnd)
+		total += pruned
+		if err != nil {
+			return err
+		}
+		lastPruned = batchEnd
+		if err := p.chain.store.Put(orphanPruningProgressKey, lastPruned); err != nil {
+			return err
+		}
+	}
+	if total > 0 {
+		logger.Infof("Pruned %v orphan blocks up to height %v", total, endHeight)
+	}
+	return nil
+}
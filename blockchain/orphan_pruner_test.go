@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+)
+
+func TestPruneOrphanBlocks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tx1 := common.Bytes("tx1")
+	tx2 := common.Bytes("tx2")
+	tx3 := common.Bytes("tx3")
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = txs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	a1 := addBlock("a1", "a0")
+	b2 := addBlock("b2", "a1", tx1, tx2)
+	a2 := addBlock("a2", "a1", tx1)
+	b3 := addBlock("b3", "b2", tx3)
+	addBlock("a3", "a2")
+	a4 := addBlock("a4", "a3")
+	addBlock("a5", "a4")
+	addBlock("c5", "a4")
+	require.Nil(chain.FinalizePreviousBlocks(a4.Hash()))
+
+	pruned, err := chain.PruneOrphanBlocks(1, 5)
+	require.Nil(err)
+	assert.Equal(2, pruned)
+
+	for _, block := range []*core.Block{b2, b3} {
+		_, err = chain.FindBlock(block.Hash())
+		assert.NotNil(err)
+		assert.Equal(1, len(chain.FindBlocksByHeight(block.Height)))
+	}
+	parent, err := chain.FindBlock(a1.Hash())
+	require.Nil(err)
+	assert.Equal([]common.Hash{a2.Hash()}, parent.Children)
+
+	// The entries of the txs only included by the pruned blocks are removed.
+	_, block, found := chain.FindTxByHash(crypto.Keccak256Hash(tx1))
+	require.True(found)
+	assert.Equal(a2.Hash(), block.Hash())
+	for _, tx := range []common.Bytes{tx2, tx3} {
+		_, _, found = chain.FindTxByHash(crypto.Keccak256Hash(tx))
+		assert.False(found)
+		assert.False(chain.IsTxOrphaned(crypto.Keccak256Hash(tx)))
+	}
+
+	// The height without a finalized block is kept.
+	assert.Equal(2, len(chain.FindBlocksByHeight(5)))
+
+	pruned, err = chain.PruneOrphanBlocks(1, 5)
+	require.Nil(err)
+	assert.Equal(0, pruned)
+}
+
+func TestOrphanPruner(t *testing.T) {
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	addBlock := func(name, parent string) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	addBlock("a1", "a0")
+	b2 := addBlock("b2", "a1")
+	addBlock("a2", "a1")
+	addBlock("a3", "a2")
+	a4 := addBlock("a4", "a3")
+
+	pruner := NewOrphanPruner(chain, 2, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	pruner.Start(ctx)
+	defer func() {
+		cancel()
+		pruner.Wait()
+	}()
+
+	require.Nil(chain.FinalizePreviousBlocks(a4.Hash()))
+	var lastPruned uint64
+	for i := 0; chain.store.Get(orphanPruningProgressKey, &lastPruned) != nil; i++ {
+		require.True(i < 100, "orphan blocks are not pruned")
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(a4.Height-2, lastPruned)
+	_, err := chain.FindBlock(b2.Hash())
+	require.NotNil(err)
+}
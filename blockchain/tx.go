@@ -23,8 +23,47 @@ type TxIndexEntry struct {
 	Index       uint64
 }
 
-// AddTxsToIndex adds transactions in given block to index.
+// txOrphanKey constructs the DB key marking the index entry of the given transaction hash as
+// pointing to a block of an orphaned branch.
+func txOrphanKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("txo/"), hash[:]...)
+}
+
+// TxIndexPolicy selects which block the index entry of a transaction included in more than
+// one block points to.
+type TxIndexPolicy string
+
+const (
+	// TxIndexPolicyFirstSeen keeps the entry pointing to the first block the transaction is
+	// seen in, unless that block is orphaned.
+	TxIndexPolicyFirstSeen TxIndexPolicy = "first-seen"
+	// TxIndexPolicyLastFinalized re-points the entry to the last finalized block including the
+	// transaction.
+	TxIndexPolicyLastFinalized TxIndexPolicy = "last-finalized"
+	// TxIndexPolicyAllOccurrences indexes like TxIndexPolicyLastFinalized, and additionally
+	// records every block including the transaction.
+	TxIndexPolicyAllOccurrences TxIndexPolicy = "all-occurrences"
+)
+
+// ParseTxIndexPolicy parses the configured policy, defaulting to TxIndexPolicyLastFinalized.
+func ParseTxIndexPolicy(value string) TxIndexPolicy {
+	switch policy := TxIndexPolicy(value); policy {
+	case TxIndexPolicyFirstSeen, TxIndexPolicyLastFinalized, TxIndexPolicyAllOccurrences:
+		return policy
+	case "":
+		return TxIndexPolicyLastFinalized
+	default:
+		logger.Warnf("Unknown tx index policy %v, using %v", value, TxIndexPolicyLastFinalized)
+		return TxIndexPolicyLastFinalized
+	}
+}
+
+// AddTxsToIndex adds transactions in given block to index. An existing entry is re-pointed to
+// the block if it points to an orphaned branch, if force is set, or if the block is finalized
+// and preferred by the policy.
 func (ch *Chain) AddTxsToIndex(block *core.ExtendedBlock, force bool) {
+	finalized := block.Status.IsFinalized()
+	recordAll := ch.txIndexPolicy == TxIndexPolicyAllOccurrences
 	for idx, tx := range block.Txs {
 		txIndexEntry := TxIndexEntry{
 			BlockHash:   block.Hash(),
@@ -32,39 +71,234 @@ func (ch *Chain) AddTxsToIndex(block *core.ExtendedBlock, force bool) {
 			Index:       uint64(idx),
 		}
 		txHash := crypto.Keccak256Hash(tx)
-		key := txIndexKey(txHash)
+		if recordAll {
+			ch.addTxOccurrence(txHash, txIndexEntry)
+		}
+		relink := force || finalized && ch.prefersFinalizedBlock(txHash, block)
+		if !ch.indexTx(txHash, &txIndexEntry, relink) && !recordAll {
+			continue
+		}
 
-		if !force {
-			// Check if TX with given hash exists in DB.
-			err := ch.store.Get(key, &TxIndexEntry{})
-			if err != store.ErrKeyNotFound {
+		ch.insertEthTxHash(block, tx, &txIndexEntry, relink)
+	}
+}
+
+// unindexBlockTxs removes the tx index entries and receipts of the transactions of the block,
+// unless the entries point to another block.
+func (ch *Chain) unindexBlockTxs(block *core.ExtendedBlock) error {
+	blockHash := block.Hash()
+	for _, tx := range block.Txs {
+		txHash := crypto.Keccak256Hash(tx)
+		hashes := []common.Hash{txHash}
+		if ethTxHash, err := CalcEthTxHash(block, tx); err == nil {
+			hashes = append(hashes, ethTxHash)
+		}
+		for _, hash := range hashes {
+			if ch.txIndexPolicy == TxIndexPolicyAllOccurrences {
+				if err := ch.removeTxOccurrence(hash, blockHash); err != nil {
+					return err
+				}
+			}
+			txIndexEntry := &TxIndexEntry{}
+			err := ch.store.Get(txIndexKey(hash), txIndexEntry)
+			if err == store.ErrKeyNotFound || err == nil && txIndexEntry.BlockHash != blockHash {
 				continue
 			}
+			if err != nil {
+				return err
+			}
+			for _, key := range []common.Bytes{txIndexKey(hash), txOrphanKey(hash), txReceiptKey(hash)} {
+				if err := ch.store.Delete(key); err != nil {
+					return err
+				}
+			}
 		}
+	}
+	return nil
+}
 
-		err := ch.store.Put(key, txIndexEntry)
-		if err != nil {
-			logger.Panic(err)
+// unindexTxsBelowDepth removes from the tx index the transactions of the finalized block which
+// falls out of the tx index depth once the block at the height is finalized.
+func (ch *Chain) unindexTxsBelowDepth(height uint64) {
+	if ch.txIndexDepth == 0 || height <= ch.txIndexDepth {
+		return
+	}
+	for _, block := range ch.findBlocksByHeight(height - ch.txIndexDepth) {
+		if !block.Status.IsFinalized() {
+			continue
+		}
+		if err := ch.unindexBlockTxs(block); err != nil {
+			logger.Warnf("Failed to remove the txs of block %v from the tx index: %v", block.Hash().Hex(), err)
+		}
+	}
+}
+
+// prefersFinalizedBlock returns whether the index entry of the transaction is to be re-pointed
+// to the finalized block, i.e. unless it points to another finalized block the policy prefers:
+// a lower one for TxIndexPolicyFirstSeen, a higher one otherwise. The blocks are finalized from
+// the newest, so both can be finalized in the same batch.
+func (ch *Chain) prefersFinalizedBlock(hash common.Hash, block *core.ExtendedBlock) bool {
+	existing := &TxIndexEntry{}
+	if err := ch.store.Get(txIndexKey(hash), existing); err != nil {
+		return true
+	}
+	var keep bool
+	if ch.txIndexPolicy == TxIndexPolicyFirstSeen {
+		keep = existing.BlockHeight < block.Height
+	} else {
+		keep = existing.BlockHeight > block.Height
+	}
+	if !keep {
+		return true
+	}
+	indexed, err := ch.findBlock(existing.BlockHash)
+	return err != nil || !indexed.Status.IsFinalized()
+}
+
+// indexTx saves the index entry of the transaction hash, unless an entry pointing to a block
+// not known to be orphaned exists and relink is not set. It returns whether the entry is saved.
+func (ch *Chain) indexTx(hash common.Hash, txIndexEntry *TxIndexEntry, relink bool) bool {
+	key := txIndexKey(hash)
+	orphaned := ch.IsTxOrphaned(hash)
+	if !relink && !orphaned {
+		// Check if TX with given hash exists in DB.
+		err := ch.store.Get(key, &TxIndexEntry{})
+		if err != store.ErrKeyNotFound {
+			return false
 		}
+	}
 
-		ch.insertEthTxHash(block, tx, &txIndexEntry)
+	err := ch.store.Put(key, *txIndexEntry)
+	if err != nil {
+		logger.Panic(err)
+	}
+	if orphaned {
+		if err := ch.store.Delete(txOrphanKey(hash)); err != nil {
+			logger.Panic(err)
+		}
 	}
+	return true
 }
 
 // Index the ETH smart contract transactions, using the ETH tx hash as the key
-func (ch *Chain) insertEthTxHash(block *core.ExtendedBlock, rawTxBytes []byte, txIndexEntry *TxIndexEntry) error {
+func (ch *Chain) insertEthTxHash(block *core.ExtendedBlock, rawTxBytes []byte, txIndexEntry *TxIndexEntry, relink bool) error {
 	ethTxHash, err := CalcEthTxHash(block, rawTxBytes)
 	if err != nil {
 		return err // skip insertion
 	}
 
-	key := txIndexKey(ethTxHash)
-	err = ch.store.Put(key, *txIndexEntry)
-	if err != nil {
+	if ch.txIndexPolicy == TxIndexPolicyAllOccurrences {
+		ch.addTxOccurrence(ethTxHash, *txIndexEntry)
+	}
+	ch.indexTx(ethTxHash, txIndexEntry, relink)
+	return nil
+}
+
+// txOccurrencesKey constructs the DB key of all the blocks including the given transaction hash.
+func txOccurrencesKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("txoc/"), hash[:]...)
+}
+
+// addTxOccurrence records that the transaction is included in the block of the entry.
+func (ch *Chain) addTxOccurrence(hash common.Hash, txIndexEntry TxIndexEntry) {
+	occurrences := ch.findTxOccurrences(hash)
+	for _, occurrence := range occurrences {
+		if occurrence.BlockHash == txIndexEntry.BlockHash {
+			return
+		}
+	}
+	occurrences = append(occurrences, txIndexEntry)
+	if err := ch.store.Put(txOccurrencesKey(hash), occurrences); err != nil {
 		logger.Panic(err)
 	}
+}
 
-	return nil
+// removeTxOccurrence removes the block from the recorded occurrences of the transaction.
+func (ch *Chain) removeTxOccurrence(hash common.Hash, blockHash common.Hash) error {
+	occurrences := ch.findTxOccurrences(hash)
+	remaining := []TxIndexEntry{}
+	for _, occurrence := range occurrences {
+		if occurrence.BlockHash != blockHash {
+			remaining = append(remaining, occurrence)
+		}
+	}
+	if len(remaining) == len(occurrences) {
+		return nil
+	}
+	if len(remaining) == 0 {
+		return ch.store.Delete(txOccurrencesKey(hash))
+	}
+	return ch.store.Put(txOccurrencesKey(hash), remaining)
+}
+
+func (ch *Chain) findTxOccurrences(hash common.Hash) []TxIndexEntry {
+	occurrences := []TxIndexEntry{}
+	err := ch.store.Get(txOccurrencesKey(hash), &occurrences)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Error(err)
+	}
+	return occurrences
+}
+
+// FindTxOccurrences returns the index entries of every block including the transaction, which
+// can also be the ETH hash of a smart contract transaction, in the order the blocks were
+// indexed. It requires the TxIndexPolicyAllOccurrences policy.
+func (ch *Chain) FindTxOccurrences(hash common.Hash) ([]TxIndexEntry, error) {
+	if ch.txIndexPolicy != TxIndexPolicyAllOccurrences {
+		return nil, fmt.Errorf("The tx occurrences are not recorded, see %v", common.CfgStorageTxIndexPolicy)
+	}
+	occurrences := ch.findTxOccurrences(hash)
+	if len(occurrences) == 0 {
+		return nil, fmt.Errorf("Tx %v is not found", hash.Hex())
+	}
+	return occurrences, nil
+}
+
+// markOrphanedTxs marks the index entries pointing to the block as pointing to an orphaned
+// branch, after another block is finalized at its height. The entries are re-pointed when
+// the transactions are included in another block.
+func (ch *Chain) markOrphanedTxs(block *core.ExtendedBlock) {
+	blockHash := block.Hash()
+	for _, tx := range block.Txs {
+		hashes := []common.Hash{crypto.Keccak256Hash(tx)}
+		if ethTxHash, err := CalcEthTxHash(block, tx); err == nil {
+			hashes = append(hashes, ethTxHash)
+		}
+		for _, hash := range hashes {
+			txIndexEntry := &TxIndexEntry{}
+			err := ch.store.Get(txIndexKey(hash), txIndexEntry)
+			if err != nil {
+				if err != store.ErrKeyNotFound {
+					logger.Error(err)
+				}
+				continue
+			}
+			if txIndexEntry.BlockHash != blockHash {
+				continue
+			}
+			if err := ch.store.Put(txOrphanKey(hash), blockHash); err != nil {
+				logger.Panic(err)
+			}
+		}
+	}
+}
+
+// IsTxOrphaned returns whether the index entry of the transaction hash points to a block of an
+// orphaned branch, i.e. the transaction is not included in the finalized chain.
+func (ch *Chain) IsTxOrphaned(hash common.Hash) bool {
+	if checker, ok := ch.store.(keyChecker); ok {
+		exists, err := checker.Has(txOrphanKey(hash))
+		if err != nil {
+			logger.Error(err)
+		}
+		return exists
+	}
+	var blockHash common.Hash
+	err := ch.store.Get(txOrphanKey(hash), &blockHash)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Error(err)
+	}
+	return err == nil
 }
 
 // FindTxByHash looks up transaction by hash and additionally returns the containing block.
@@ -87,6 +321,112 @@ func (ch *Chain) FindTxByHash(hash common.Hash) (tx common.Bytes, block *core.Ex
 	return block.Txs[txIndexEntry.Index], block, true
 }
 
+// cumulativeTxCountKey constructs the DB key of the cumulative tx count of the given block.
+func cumulativeTxCountKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("ct/"), hash[:]...)
+}
+
+// addCumulativeTxCount stores the number of transactions included from the chain root up to
+// and including the block, i.e. the count of its parent plus its own. The count is left out
+// if the count of the parent is unknown, e.g. for the blocks added before their parent.
+func (ch *Chain) addCumulativeTxCount(block *core.ExtendedBlock, isSnapshotRoot bool) {
+	var parentCount uint64
+	if !isSnapshotRoot && !block.Parent.IsEmpty() {
+		err := ch.store.Get(cumulativeTxCountKey(block.Parent), &parentCount)
+		if err != nil {
+			if err != store.ErrKeyNotFound {
+				logger.Error(err)
+			}
+			return
+		}
+	}
+	err := ch.store.Put(cumulativeTxCountKey(block.Hash()), parentCount+uint64(len(block.Txs)))
+	if err != nil {
+		logger.Panic(err)
+	}
+}
+
+// CumulativeTxCount returns the number of transactions included from the chain root up to and
+// including the finalized block at the given height. As the counts follow the parent links,
+// the blocks of the other forks don't contribute, while a transaction included more than once
+// along the chain is counted for each inclusion. The blocks stored before the counts were
+// introduced are counted once BackfillIndexes has run.
+func (ch *Chain) CumulativeTxCount(height uint64) (uint64, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	var canonical *core.ExtendedBlock
+	for _, block := range ch.findBlocksByHeight(height) {
+		if block.Status.IsFinalized() {
+			canonical = block
+			break
+		}
+	}
+	if canonical == nil {
+		return 0, fmt.Errorf("No finalized block at height %v", height)
+	}
+
+	var count uint64
+	err := ch.store.Get(cumulativeTxCountKey(canonical.Hash()), &count)
+	if err != nil {
+		return 0, fmt.Errorf("Cumulative tx count of block %v is not available: %v", canonical.Hash().Hex(), err)
+	}
+	return count, nil
+}
+
+// keyChecker is implemented by the stores which can check the existence of a key without
+// retrieving and decoding its value.
+type keyChecker interface {
+	Has(key common.Bytes) (bool, error)
+}
+
+// WhichTxsExist resolves, for a batch of transaction hashes, whether each of them is already
+// indexed on-chain, e.g. for the mempool to drop the included transactions.
+func (ch *Chain) WhichTxsExist(hashes []common.Hash) map[common.Hash]bool {
+	result := make(map[common.Hash]bool, len(hashes))
+	checker, canCheckKey := ch.store.(keyChecker)
+	for _, hash := range hashes {
+		if _, resolved := result[hash]; resolved {
+			continue
+		}
+		key := txIndexKey(hash)
+		if canCheckKey {
+			exists, err := checker.Has(key)
+			if err != nil {
+				logger.Error(err)
+			}
+			result[hash] = exists
+			continue
+		}
+		err := ch.store.Get(key, &TxIndexEntry{})
+		if err != nil && err != store.ErrKeyNotFound {
+			logger.Error(err)
+		}
+		result[hash] = err == nil
+	}
+	return result
+}
+
+// IterateBlockTxs walks the transactions of the given block in their canonical order, invoking
+// fn with the index, hash and decoded form of each transaction. Iteration stops early if fn
+// returns false.
+func (ch *Chain) IterateBlockTxs(blockHash common.Hash, fn func(index int, hash common.Hash, tx types.Tx) bool) error {
+	block, err := ch.FindBlock(blockHash)
+	if err != nil {
+		return fmt.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+	for idx, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return fmt.Errorf("Failed to decode tx %v of block %v: %v", idx, blockHash.Hex(), err)
+		}
+		if !fn(idx, crypto.Keccak256Hash(rawTx), tx) {
+			break
+		}
+	}
+	return nil
+}
+
 // ---------------- Tx Receipts ---------------
 
 // txReceiptKey constructs the DB key for the given transaction hash.
@@ -102,10 +442,28 @@ type TxReceiptEntry struct {
 	ContractAddress common.Address
 	GasUsed         uint64
 	EvmErr          string
+	InternalTxs     []*types.InternalTx `rlp:"tail"` // value transfers by the contracts, empty for the older receipts
+}
+
+// TxReceiptStatus is the execution status of a smart contract transaction.
+type TxReceiptStatus string
+
+const (
+	TxReceiptStatusSuccess TxReceiptStatus = "success"
+	TxReceiptStatusFailed  TxReceiptStatus = "failed"
+)
+
+// Status returns whether the EVM execution of the transaction succeeded. A failed transaction
+// is still included in its block, and charged for the gas used.
+func (r *TxReceiptEntry) Status() TxReceiptStatus {
+	if r.EvmErr != "" {
+		return TxReceiptStatusFailed
+	}
+	return TxReceiptStatusSuccess
 }
 
 // AddTxReceipt adds transaction receipt.
-func (ch *Chain) AddTxReceipt(tx types.Tx, logs []*types.Log, evmRet common.Bytes,
+func (ch *Chain) AddTxReceipt(tx types.Tx, logs []*types.Log, internalTxs []*types.InternalTx, evmRet common.Bytes,
 	contractAddr common.Address, gasUsed uint64, evmErr error) {
 	raw, err := types.TxToBytes(tx)
 	if err != nil {
@@ -124,6 +482,7 @@ func (ch *Chain) AddTxReceipt(tx types.Tx, logs []*types.Log, evmRet common.Byte
 		ContractAddress: contractAddr,
 		GasUsed:         gasUsed,
 		EvmErr:          errStr,
+		InternalTxs:     internalTxs,
 	}
 	key := txReceiptKey(txHash)
 
@@ -150,6 +509,20 @@ func (ch *Chain) FindTxReceiptByHash(hash common.Hash) (*TxReceiptEntry, bool) {
 	return txReceiptEntry, true
 }
 
+// GetTxReceipt returns the receipt of the included transaction with the given hash, which can
+// also be the ETH hash of a smart contract transaction, along with the containing block.
+func (ch *Chain) GetTxReceipt(hash common.Hash) (*TxReceiptEntry, *core.ExtendedBlock, error) {
+	raw, block, found := ch.FindTxByHash(hash)
+	if !found {
+		return nil, nil, fmt.Errorf("Tx %v is not found", hash.Hex())
+	}
+	receipt, found := ch.FindTxReceiptByHash(crypto.Keccak256Hash(raw))
+	if !found {
+		return nil, nil, fmt.Errorf("Receipt of tx %v is not found", hash.Hex())
+	}
+	return receipt, block, nil
+}
+
 // ---------------- Utils ---------------
 
 func CalcEthTxHash(block *core.ExtendedBlock, rawTxBytes []byte) (common.Hash, error) {
@@ -0,0 +1,207 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store"
+)
+
+// The transactions of an address are stored as a list in the order of their finalization,
+// i.e. sorted by height: the entry i of the list is stored under addressTxKey(address, i),
+// and the length of the list under addressTxCountKey(address).
+
+func addressTxCountKey(address common.Address) common.Bytes {
+	return append(common.Bytes("txac/"), address[:]...)
+}
+
+func addressTxKey(address common.Address, seq uint64) common.Bytes {
+	key := append(common.Bytes("txa/"), address[:]...)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	return append(key, seqBytes[:]...)
+}
+
+// AddressTxEntry locates a finalized transaction sent or received by an address.
+type AddressTxEntry struct {
+	TxHash      common.Hash
+	BlockHash   common.Hash
+	BlockHeight uint64
+	Index       uint64
+}
+
+// addTxsToAddressIndex appends the transactions of the finalized block to the lists of their
+// senders and recipients. The blocks need to be added in increasing height, a block at or
+// below the height of the last entry of an address is already indexed for the address.
+func (ch *Chain) addTxsToAddressIndex(block *core.ExtendedBlock) {
+	for idx, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			logger.Errorf("Failed to decode tx %v of block %v: %v", idx, block.Hash().Hex(), err)
+			continue
+		}
+		entry := AddressTxEntry{
+			TxHash:      crypto.Keccak256Hash(rawTx),
+			BlockHash:   block.Hash(),
+			BlockHeight: block.Height,
+			Index:       uint64(idx),
+		}
+		for _, address := range TxAddresses(tx) {
+			ch.appendAddressTx(address, &entry)
+		}
+	}
+}
+
+func (ch *Chain) appendAddressTx(address common.Address, entry *AddressTxEntry) {
+	count := ch.addressTxCount(address)
+	if count > 0 {
+		last, err := ch.getAddressTx(address, count-1)
+		if err != nil {
+			logger.Panic(err)
+		}
+		if last.BlockHeight > entry.BlockHeight || last.BlockHeight == entry.BlockHeight && last.Index >= entry.Index {
+			return
+		}
+	}
+	// The entry is saved before the count, so the readers never see a missing entry.
+	if err := ch.store.Put(addressTxKey(address, count), *entry); err != nil {
+		logger.Panic(err)
+	}
+	if err := ch.store.Put(addressTxCountKey(address), count+1); err != nil {
+		logger.Panic(err)
+	}
+}
+
+func (ch *Chain) addressTxCount(address common.Address) uint64 {
+	var count uint64
+	err := ch.store.Get(addressTxCountKey(address), &count)
+	if err != nil && err != store.ErrKeyNotFound {
+		logger.Panic(err)
+	}
+	return count
+}
+
+func (ch *Chain) getAddressTx(address common.Address, seq uint64) (*AddressTxEntry, error) {
+	entry := &AddressTxEntry{}
+	if err := ch.store.Get(addressTxKey(address, seq), entry); err != nil {
+		return nil, fmt.Errorf("Failed to read tx %v of address %v: %v", seq, address.Hex(), err)
+	}
+	return entry, nil
+}
+
+// GetTxsByAddress returns the finalized transactions sent or received by the address from
+// the start height on, sorted by height, and the start height of the next page, 0 if there
+// are no more transactions. A page holds limit transactions, or more so that the
+// transactions of its last block are not split across pages.
+func (ch *Chain) GetTxsByAddress(address common.Address, startHeight uint64, limit int) ([]*AddressTxEntry, uint64, error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("Invalid limit: %v", limit)
+	}
+	if !ch.indexTxsByAddress {
+		return nil, 0, fmt.Errorf("The transactions are not indexed by address, see %v", common.CfgStorageIndexTxsByAddress)
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	// Binary search of the first entry at or above the start height.
+	count := ch.addressTxCount(address)
+	lo, hi := uint64(0), count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		entry, err := ch.getAddressTx(address, mid)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry.BlockHeight < startHeight {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	entries := []*AddressTxEntry{}
+	for seq := lo; seq < count; seq++ {
+		entry, err := ch.getAddressTx(address, seq)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(entries) >= limit && entry.BlockHeight != entries[len(entries)-1].BlockHeight {
+			return entries, entry.BlockHeight, nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries, 0, nil
+}
+
+// TxAddresses returns the addresses sending or receiving funds with the transaction, each
+// address once.
+func TxAddresses(tx types.Tx) []common.Address {
+	addresses := []common.Address{}
+	seen := make(map[common.Address]bool)
+	add := func(address common.Address) {
+		if (address == common.Address{}) || seen[address] {
+			return
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+
+	switch tx := tx.(type) {
+	case *types.CoinbaseTx:
+		add(tx.Proposer.Address)
+		for _, output := range tx.Outputs {
+			add(output.Address)
+		}
+	case *types.SlashTx:
+		add(tx.Proposer.Address)
+		add(tx.SlashedAddress)
+	case *types.SendTx:
+		for _, input := range tx.Inputs {
+			add(input.Address)
+		}
+		for _, output := range tx.Outputs {
+			add(output.Address)
+		}
+	case *types.ReserveFundTx:
+		add(tx.Source.Address)
+	case *types.ReleaseFundTx:
+		add(tx.Source.Address)
+	case *types.ServicePaymentTx:
+		add(tx.Source.Address)
+		add(tx.Target.Address)
+	case *types.SplitRuleTx:
+		add(tx.Initiator.Address)
+		for _, split := range tx.Splits {
+			add(split.Address)
+		}
+	case *types.SmartContractTx:
+		add(tx.From.Address)
+		add(tx.To.Address)
+	case *types.DepositStakeTx:
+		add(tx.Source.Address)
+		add(tx.Holder.Address)
+	case *types.DepositStakeTxV2:
+		add(tx.Source.Address)
+		add(tx.Holder.Address)
+	case *types.WithdrawStakeTx:
+		add(tx.Source.Address)
+		add(tx.Holder.Address)
+	case *types.StakeRewardDistributionTx:
+		add(tx.Holder.Address)
+		add(tx.Beneficiary.Address)
+	case *types.EvidenceTx:
+		add(tx.Proposer.Address)
+		if tx.Evidence != nil {
+			add(tx.Evidence.Offender)
+		}
+	case *types.RotateValidatorKeyTx:
+		add(tx.Holder.Address)
+		add(tx.Signer.Address)
+	}
+	return addresses
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestGetTxsByAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+	chain.indexTxsByAddress = true
+
+	send := func(from, to string, sequence uint64) common.Bytes {
+		tx := &types.SendTx{
+			Fee:     types.NewCoins(0, 1000000000000),
+			Inputs:  []types.TxInput{types.NewTxInput(common.HexToAddress(from), types.NewCoins(0, 10), int(sequence))},
+			Outputs: []types.TxOutput{{Address: common.HexToAddress(to), Coins: types.NewCoins(0, 10)}},
+		}
+		raw, err := types.TxToBytes(tx)
+		require.Nil(err)
+		return raw
+	}
+	addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = txs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	a1 := addBlock("a1", "a0", send("0x1", "0x2", 1), send("0x3", "0x2", 1))
+	addBlock("a2", "a1")
+	a3 := addBlock("a3", "a2", send("0x2", "0x4", 1))
+	// The transactions of the fork are not indexed.
+	addBlock("b3", "a2", send("0x5", "0x2", 1))
+	a4 := addBlock("a4", "a3", send("0x1", "0x2", 2), send("0x1", "0x6", 3))
+	require.Nil(chain.FinalizePreviousBlocks(a4.Hash()))
+
+	entries, next, err := chain.GetTxsByAddress(common.HexToAddress("0x2"), 0, 10)
+	require.Nil(err)
+	assert.Equal(uint64(0), next)
+	require.Equal(4, len(entries))
+	expected := []struct {
+		block *core.Block
+		index uint64
+	}{{a1, 0}, {a1, 1}, {a3, 0}, {a4, 0}}
+	for i, e := range expected {
+		assert.Equal(e.block.Hash(), entries[i].BlockHash)
+		assert.Equal(e.block.Height, entries[i].BlockHeight)
+		assert.Equal(e.index, entries[i].Index)
+		assert.Equal(crypto.Keccak256Hash(e.block.Txs[e.index]), entries[i].TxHash)
+	}
+
+	// The pages don't split the transactions of a block.
+	entries, next, err = chain.GetTxsByAddress(common.HexToAddress("0x2"), 0, 1)
+	require.Nil(err)
+	assert.Equal(2, len(entries))
+	assert.Equal(a3.Height, next)
+	entries, next, err = chain.GetTxsByAddress(common.HexToAddress("0x2"), next, 1)
+	require.Nil(err)
+	assert.Equal(1, len(entries))
+	assert.Equal(a3.Hash(), entries[0].BlockHash)
+	assert.Equal(a4.Height, next)
+	entries, next, err = chain.GetTxsByAddress(common.HexToAddress("0x2"), next, 1)
+	require.Nil(err)
+	assert.Equal(1, len(entries))
+	assert.Equal(a4.Hash(), entries[0].BlockHash)
+	assert.Equal(uint64(0), next)
+
+	entries, _, err = chain.GetTxsByAddress(common.HexToAddress("0x1"), a1.Height+1, 1)
+	require.Nil(err)
+	assert.Equal(2, len(entries))
+	entries, _, err = chain.GetTxsByAddress(common.HexToAddress("0x5"), 0, 10)
+	require.Nil(err)
+	assert.Empty(entries)
+
+	// Indexing a block again doesn't duplicate its entries.
+	extended, err := chain.FindBlock(a4.Hash())
+	require.Nil(err)
+	chain.addTxsToAddressIndex(extended)
+	entries, _, err = chain.GetTxsByAddress(common.HexToAddress("0x1"), 0, 10)
+	require.Nil(err)
+	assert.Equal(3, len(entries))
+
+	chain.indexTxsByAddress = false
+	_, _, err = chain.GetTxsByAddress(common.HexToAddress("0x2"), 0, 10)
+	assert.NotNil(err)
+}
@@ -1,6 +1,9 @@
 package blockchain
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,6 +11,7 @@ import (
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
 )
 
 func TestTxIndex(t *testing.T) {
@@ -176,3 +180,360 @@ func TestTxIndexDuplicateTx2(t *testing.T) {
 	assert.NotNil(block)
 	assert.Equal(block.Hash(), block2.Hash())
 }
+
+func TestIterateBlockTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	coinbaseTx := &types.CoinbaseTx{
+		Proposer:    types.NewTxInput(common.HexToAddress("0x1"), types.NewCoins(0, 0), 1),
+		BlockHeight: 10,
+	}
+	sendTx := &types.SendTx{
+		Fee:     types.NewCoins(0, 1000000000000),
+		Inputs:  []types.TxInput{types.NewTxInput(common.HexToAddress("0x2"), types.NewCoins(0, 10), 1)},
+		Outputs: []types.TxOutput{{Address: common.HexToAddress("0x3"), Coins: types.NewCoins(0, 10)}},
+	}
+	rawTxs := []common.Bytes{}
+	for _, tx := range []types.Tx{coinbaseTx, sendTx} {
+		raw, err := types.TxToBytes(tx)
+		require.Nil(err)
+		rawTxs = append(rawTxs, raw)
+	}
+
+	block1 := core.CreateTestBlock("b1", "")
+	block1.Height = 10
+	block1.Txs = rawTxs
+	_, err := chain.AddBlock(block1)
+	require.Nil(err)
+
+	indices := []int{}
+	err = chain.IterateBlockTxs(block1.Hash(), func(index int, hash common.Hash, tx types.Tx) bool {
+		indices = append(indices, index)
+		assert.Equal(crypto.Keccak256Hash(rawTxs[index]), hash)
+		switch index {
+		case 0:
+			_, ok := tx.(*types.CoinbaseTx)
+			assert.True(ok)
+		case 1:
+			_, ok := tx.(*types.SendTx)
+			assert.True(ok)
+		}
+		return true
+	})
+	require.Nil(err)
+	assert.Equal([]int{0, 1}, indices)
+
+	// Early termination.
+	count := 0
+	err = chain.IterateBlockTxs(block1.Hash(), func(index int, hash common.Hash, tx types.Tx) bool {
+		count++
+		return false
+	})
+	require.Nil(err)
+	assert.Equal(1, count)
+
+	err = chain.IterateBlockTxs(common.HexToHash("0xdeadbeef"), func(index int, hash common.Hash, tx types.Tx) bool {
+		return true
+	})
+	assert.NotNil(err)
+}
+
+func TestWhichTxsExist(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	block1 := core.CreateTestBlock("b1", "")
+	block1.Height = 10
+	block1.Txs = []common.Bytes{common.Bytes("tx1"), common.Bytes("tx2")}
+	block1.UpdateHash()
+	_, err := chain.AddBlock(block1)
+	require.Nil(err)
+
+	tx1 := crypto.Keccak256Hash(common.Bytes("tx1"))
+	tx2 := crypto.Keccak256Hash(common.Bytes("tx2"))
+	tx3 := crypto.Keccak256Hash(common.Bytes("tx3"))
+	result := chain.WhichTxsExist([]common.Hash{tx1, tx3, tx2, tx1})
+	assert.Equal(map[common.Hash]bool{tx1: true, tx2: true, tx3: false}, result)
+
+	assert.Empty(chain.WhichTxsExist(nil))
+}
+
+func BenchmarkWhichTxsExist(b *testing.B) {
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	block := core.CreateTestBlock("b1", "")
+	block.Height = 10
+	hashes := []common.Hash{}
+	for i := 0; i < 1000; i++ {
+		tx := common.Bytes(fmt.Sprintf("tx%v", i))
+		if i%2 == 0 {
+			block.Txs = append(block.Txs, tx)
+		}
+		hashes = append(hashes, crypto.Keccak256Hash(tx))
+	}
+	block.UpdateHash()
+	_, err := chain.AddBlock(block)
+	require.Nil(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.WhichTxsExist(hashes)
+	}
+}
+
+func TestCumulativeTxCount(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	txs := func(names ...string) []common.Bytes {
+		ret := []common.Bytes{}
+		for _, name := range names {
+			ret = append(ret, common.Bytes(name))
+		}
+		return ret
+	}
+	addBlock := func(name, parent string, blockTxs []common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = blockTxs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	addBlock("a1", "a0", txs("tx1", "tx2"))
+	addBlock("a2", "a1", nil)
+	addBlock("a3", "a2", txs("tx3", "tx4", "tx5"))
+	// The fork includes the same transaction as the canonical chain, and more.
+	addBlock("b3", "a2", txs("tx3", "tx6", "tx7", "tx8"))
+	// tx1 is included again along the canonical chain.
+	a4 := addBlock("a4", "a3", txs("tx1", "tx9"))
+	require.Nil(chain.FinalizePreviousBlocks(a4.Hash()))
+
+	expected := []uint64{0, 2, 2, 5, 7}
+	for height, count := range expected {
+		actual, err := chain.CumulativeTxCount(uint64(height))
+		require.Nil(err)
+		assert.Equal(count, actual, "height %v", height)
+	}
+
+	_, err := chain.CumulativeTxCount(5)
+	assert.NotNil(err)
+}
+
+func TestGetTxReceipt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	contract := common.HexToAddress("0xc0")
+	succeededTx, failedTx := newTestSmartContractTx(t, contract, 1), newTestSmartContractTx(t, contract, 2)
+	rawTxs := []common.Bytes{}
+	for _, tx := range []types.Tx{succeededTx, failedTx} {
+		raw, err := types.TxToBytes(tx)
+		require.Nil(err)
+		rawTxs = append(rawTxs, raw)
+	}
+	block := core.CreateTestBlock("b1", "")
+	block.Height = 10
+	block.Txs = rawTxs
+	_, err := chain.AddBlock(block)
+	require.Nil(err)
+
+	logs := []*types.Log{{Address: contract, Data: common.Bytes("event")}}
+	chain.AddTxReceipt(succeededTx, logs, nil, common.Bytes("ret"), common.Address{}, 21000, nil)
+	chain.AddTxReceipt(failedTx, nil, nil, nil, common.Address{}, 30000, errors.New("execution reverted"))
+
+	receipt, receiptBlock, err := chain.GetTxReceipt(crypto.Keccak256Hash(rawTxs[0]))
+	require.Nil(err)
+	assert.Equal(block.Hash(), receiptBlock.Hash())
+	assert.Equal(TxReceiptStatusSuccess, receipt.Status())
+	assert.Equal(uint64(21000), receipt.GasUsed)
+	require.Equal(1, len(receipt.Logs))
+	assert.Equal(contract, receipt.Logs[0].Address)
+
+	receipt, _, err = chain.GetTxReceipt(crypto.Keccak256Hash(rawTxs[1]))
+	require.Nil(err)
+	assert.Equal(TxReceiptStatusFailed, receipt.Status())
+	assert.Equal("execution reverted", receipt.EvmErr)
+	assert.Equal(uint64(30000), receipt.GasUsed)
+
+	_, _, err = chain.GetTxReceipt(crypto.Keccak256Hash(common.Bytes("unknown")))
+	assert.NotNil(err)
+}
+
+func TestTxIndexReorg(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tx1 := common.Bytes("tx1")
+	tx2 := common.Bytes("tx2")
+	tx3 := common.Bytes("tx3")
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+
+	addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = txs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		return block
+	}
+
+	addBlock("a1", "a0")
+	b2 := addBlock("b2", "a1", tx1, tx2)
+	a2 := addBlock("a2", "a1", tx1)
+	a3 := addBlock("a3", "a2", tx3)
+
+	// The first block including a tx is indexed until a block is finalized.
+	_, block, found := chain.FindTxByHash(crypto.Keccak256Hash(tx1))
+	require.True(found)
+	assert.Equal(b2.Hash(), block.Hash())
+
+	// The index is re-pointed to the finalized branch, and the txs left on the fork are orphaned.
+	require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+	_, block, found = chain.FindTxByHash(crypto.Keccak256Hash(tx1))
+	require.True(found)
+	assert.Equal(a2.Hash(), block.Hash())
+	assert.False(chain.IsTxOrphaned(crypto.Keccak256Hash(tx1)))
+	_, block, found = chain.FindTxByHash(crypto.Keccak256Hash(tx2))
+	require.True(found)
+	assert.Equal(b2.Hash(), block.Hash())
+	assert.True(chain.IsTxOrphaned(crypto.Keccak256Hash(tx2)))
+	assert.False(chain.IsTxOrphaned(crypto.Keccak256Hash(tx3)))
+
+	// An orphaned tx is re-pointed to the next block including it, even if not finalized.
+	a4 := addBlock("a4", "a3", tx2)
+	_, block, found = chain.FindTxByHash(crypto.Keccak256Hash(tx2))
+	require.True(found)
+	assert.Equal(a4.Hash(), block.Hash())
+	assert.False(chain.IsTxOrphaned(crypto.Keccak256Hash(tx2)))
+}
+
+func TestTxIndexPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tx1 := common.Bytes("tx1")
+	tx2 := common.Bytes("tx2")
+
+	for _, policy := range []TxIndexPolicy{TxIndexPolicyFirstSeen, TxIndexPolicyLastFinalized, TxIndexPolicyAllOccurrences} {
+		core.ResetTestBlocks()
+		chain := CreateTestChain()
+		chain.txIndexPolicy = policy
+
+		addBlock := func(name, parent string, txs ...common.Bytes) *core.Block {
+			block := core.CreateTestBlock(name, parent)
+			block.Txs = txs
+			block.UpdateHash()
+			_, err := chain.AddBlock(block)
+			require.Nil(err)
+			return block
+		}
+
+		a1 := addBlock("a1", "a0", tx1)
+		b2 := addBlock("b2", "a1", tx2)
+		a2 := addBlock("a2", "a1", tx2)
+		a3 := addBlock("a3", "a2", tx1)
+		require.Nil(chain.FinalizePreviousBlocks(a3.Hash()))
+
+		// The blocks are finalized in one batch.
+		expected := a3.Hash()
+		if policy == TxIndexPolicyFirstSeen {
+			expected = a1.Hash()
+		}
+		_, block, found := chain.FindTxByHash(crypto.Keccak256Hash(tx1))
+		require.True(found)
+		assert.Equal(expected, block.Hash(), policy)
+		_, block, found = chain.FindTxByHash(crypto.Keccak256Hash(tx2))
+		require.True(found)
+		assert.Equal(a2.Hash(), block.Hash(), policy)
+
+		occurrences, err := chain.FindTxOccurrences(crypto.Keccak256Hash(tx2))
+		if policy != TxIndexPolicyAllOccurrences {
+			assert.NotNil(err)
+			continue
+		}
+		require.Nil(err)
+		require.Equal(2, len(occurrences))
+		assert.Equal(b2.Hash(), occurrences[0].BlockHash)
+		assert.Equal(a2.Hash(), occurrences[1].BlockHash)
+		occurrences, err = chain.FindTxOccurrences(crypto.Keccak256Hash(tx1))
+		require.Nil(err)
+		require.Equal(2, len(occurrences))
+		assert.Equal(a1.Hash(), occurrences[0].BlockHash)
+		assert.Equal(a3.Hash(), occurrences[1].BlockHash)
+		assert.Equal(uint64(3), occurrences[1].BlockHeight)
+	}
+
+	assert.Equal(TxIndexPolicyLastFinalized, ParseTxIndexPolicy(""))
+	assert.Equal(TxIndexPolicyFirstSeen, ParseTxIndexPolicy("first-seen"))
+	assert.Equal(TxIndexPolicyLastFinalized, ParseTxIndexPolicy("unknown"))
+}
+
+func TestTxIndexDepth(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tx1 := common.Bytes("tx1")
+	tx2 := common.Bytes("tx2")
+	tx3 := common.Bytes("tx3")
+
+	core.ResetTestBlocks()
+	chain := CreateTestChain()
+	chain.txIndexDepth = 2
+
+	parent := "a0"
+	for i, txs := range [][]common.Bytes{{tx1}, {tx2}, {}, {tx3}} {
+		name := fmt.Sprintf("a%d", i+1)
+		block := core.CreateTestBlock(name, parent)
+		block.Txs = txs
+		block.UpdateHash()
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		require.Nil(chain.FinalizePreviousBlocks(block.Hash()))
+		parent = name
+	}
+
+	// The txs of the blocks more than two blocks below the last finalized block are unindexed.
+	for _, tx := range []common.Bytes{tx1, tx2} {
+		_, _, found := chain.FindTxByHash(crypto.Keccak256Hash(tx))
+		assert.False(found)
+	}
+	_, block, found := chain.FindTxByHash(crypto.Keccak256Hash(tx3))
+	require.True(found)
+	assert.Equal(uint64(4), block.Height)
+}
+
+// newTestSmartContractTx creates a tx calling the contract. The tx is signed by a generated key,
+// the tx index decodes the signatures of the smart contract txs.
+func newTestSmartContractTx(t *testing.T, contract common.Address, sequence uint64) *types.SmartContractTx {
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(t, err)
+	from := privKey.PublicKey().Address()
+	tx := &types.SmartContractTx{
+		From:     types.NewTxInput(from, types.NewCoins(0, 0), int(sequence)),
+		To:       types.TxOutput{Address: contract},
+		GasLimit: 100000,
+		GasPrice: big.NewInt(1),
+	}
+	sig, err := privKey.Sign(tx.SignBytes("testchain"))
+	require.Nil(t, err)
+	tx.SetSignature(from, sig)
+	return tx
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/pkg/errors"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// ValidatorStateSource retrieves the validator candidate pool from the state with the given
+// root. It is implemented on top of the ledger state, which the chain doesn't depend on.
+type ValidatorStateSource interface {
+	GetValidatorCandidatePool(height uint64, stateHash common.Hash) (*core.ValidatorCandidatePool, error)
+}
+
+// ValidatorSetSelector selects the validator set from the validator candidate pool.
+type ValidatorSetSelector func(vcp *core.ValidatorCandidatePool) *core.ValidatorSet
+
+type validatorSetCacheEntry struct {
+	height uint64
+	valSet *core.ValidatorSet
+}
+
+// SetValidatorStateSource sets the validator state source and the validator selection rule
+// used by the validator set queries.
+func (ch *Chain) SetValidatorStateSource(source ValidatorStateSource, selectValidators ValidatorSetSelector) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.validatorStateSource = source
+	ch.selectValidators = selectValidators
+	ch.validatorSetCache = nil
+}
+
+// TotalValidatorStake returns the total stake of the validator set at the latest finalized block.
+func (ch *Chain) TotalValidatorStake() (*big.Int, error) {
+	valSet, err := ch.finalizedValidatorSet()
+	if err != nil {
+		return nil, err
+	}
+	return valSet.TotalStake(), nil
+}
+
+// ValidatorCount returns the size of the validator set at the latest finalized block.
+func (ch *Chain) ValidatorCount() (int, error) {
+	valSet, err := ch.finalizedValidatorSet()
+	if err != nil {
+		return 0, err
+	}
+	return valSet.Size(), nil
+}
+
+// finalizedValidatorSet returns the validator set at the latest finalized block. The result
+// is cached per finalized height.
+func (ch *Chain) finalizedValidatorSet() (*core.ValidatorSet, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.validatorStateSource == nil || ch.selectValidators == nil {
+		return nil, errors.New("Validator state source is not set")
+	}
+
+	height := ch.finalizedHeight
+	if ch.validatorSetCache != nil && ch.validatorSetCache.height == height {
+		return ch.validatorSetCache.valSet, nil
+	}
+
+	var finalizedBlock *core.ExtendedBlock
+	for _, block := range ch.findBlocksByHeight(height) {
+		if block.Status.IsDirectlyFinalized() {
+			finalizedBlock = block
+			break
+		}
+	}
+	if finalizedBlock == nil {
+		return nil, errors.Errorf("Failed to find the finalized block at height %v", height)
+	}
+
+	vcp, err := ch.validatorStateSource.GetValidatorCandidatePool(finalizedBlock.Height, finalizedBlock.StateHash)
+	if err != nil {
+		return nil, err
+	}
+	valSet := ch.selectValidators(vcp)
+
+	ch.validatorSetCache = &validatorSetCacheEntry{
+		height: height,
+		valSet: valSet,
+	}
+	return valSet, nil
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// testValidatorStateSource serves the validator candidate pools by state hash.
+type testValidatorStateSource map[common.Hash]*core.ValidatorCandidatePool
+
+func (s testValidatorStateSource) GetValidatorCandidatePool(height uint64, stateHash common.Hash) (*core.ValidatorCandidatePool, error) {
+	vcp, ok := s[stateHash]
+	if !ok {
+		return nil, fmt.Errorf("Failed to load the state at height %v", height)
+	}
+	return vcp, nil
+}
+
+func selectAllValidators(vcp *core.ValidatorCandidatePool) *core.ValidatorSet {
+	valSet := core.NewValidatorSet()
+	for _, stakeHolder := range vcp.GetTopStakeHolders(100) {
+		valSet.AddValidator(core.NewValidator(stakeHolder.Holder.Hex(), stakeHolder.TotalStake()))
+	}
+	return valSet
+}
+
+func TestTotalValidatorStake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	ch := CreateTestChainByBlocks([]string{
+		"a1", "a0",
+	})
+
+	vcp := &core.ValidatorCandidatePool{}
+	stakes := []int64{1, 2, 3}
+	expectedTotal := new(big.Int)
+	for i, stake := range stakes {
+		amount := new(big.Int).Mul(big.NewInt(stake), core.MinValidatorStakeDeposit)
+		validator := common.BigToAddress(big.NewInt(int64(i + 1)))
+		require.Nil(vcp.DepositStake(validator, validator, amount))
+		expectedTotal.Add(expectedTotal, amount)
+	}
+	stateHash := common.HexToHash("a1")
+
+	block := core.NewBlock()
+	block.ChainID = "testchain"
+	block.Height = core.GetTestBlock("a1").Height + 1
+	block.Parent = core.GetTestBlock("a1").Hash()
+	block.StateHash = stateHash
+	_, err := ch.AddBlock(block)
+	require.Nil(err)
+	require.Nil(ch.FinalizeBlock(block.Hash()))
+
+	_, err = ch.TotalValidatorStake()
+	assert.NotNil(err)
+
+	ch.SetValidatorStateSource(testValidatorStateSource{stateHash: vcp}, selectAllValidators)
+	total, err := ch.TotalValidatorStake()
+	require.Nil(err)
+	assert.Equal(0, expectedTotal.Cmp(total))
+	count, err := ch.ValidatorCount()
+	require.Nil(err)
+	assert.Equal(len(stakes), count)
+
+	// Cached for the finalized height.
+	require.NotNil(ch.validatorSetCache)
+	assert.Equal(block.Height, ch.validatorSetCache.height)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// backfillIndexesCmd represents the backfill-indexes command
+var backfillIndexesCmd = &cobra.Command{
+	Use:   "backfill-indexes",
+	Short: "Add the blocks in the database of a stopped node to the cumulative tx counts and the log index, see storage.indexLogs.",
+	Run:   runBackfillIndexes,
+}
+
+func init() {
+	RootCmd.AddCommand(backfillIndexesCmd)
+}
+
+func runBackfillIndexes(cmd *cobra.Command, args []string) {
+	db, chain := openNodeChain()
+	defer db.Close()
+
+	count, err := chain.BackfillIndexes()
+	if err != nil {
+		log.Fatalf("Failed to backfill the indexes after %v blocks: %v", count, err)
+	}
+	fmt.Printf("Indexed %v blocks\n", count)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// compressBlocksCmd represents the compress-blocks command
+var compressBlocksCmd = &cobra.Command{
+	Use:   "compress-blocks",
+	Short: "Rewrite the blocks in the database of a stopped node compressed, see storage.compressBlocks.",
+	Run:   runCompressBlocks,
+}
+
+func init() {
+	RootCmd.AddCommand(compressBlocksCmd)
+}
+
+func runCompressBlocks(cmd *cobra.Command, args []string) {
+	db, chain := openNodeChain()
+	defer db.Close()
+
+	count, err := chain.CompressBlocks()
+	if err != nil {
+		log.Fatalf("Failed to compress the blocks after %v blocks: %v", count, err)
+	}
+	fmt.Printf("Compressed %v blocks\n", count)
+}
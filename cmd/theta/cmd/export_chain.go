@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/snapshot"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+var exportChainStartHeight uint64
+var exportChainEndHeight uint64
+var exportChainOutput string
+
+// exportChainCmd represents the export-chain command
+var exportChainCmd = &cobra.Command{
+	Use:   "export-chain",
+	Short: "Export the finalized blocks and their votes from the database of a stopped node to an RLP archive.",
+	Run:   runExportChain,
+}
+
+func init() {
+	exportChainCmd.Flags().Uint64Var(&exportChainStartHeight, "start", 0, "height of the first block to export")
+	exportChainCmd.Flags().Uint64Var(&exportChainEndHeight, "end", ^uint64(0), "height of the last block to export (default is the finalized height)")
+	exportChainCmd.Flags().StringVar(&exportChainOutput, "output", "", "path of the archive file")
+	RootCmd.AddCommand(exportChainCmd)
+}
+
+func runExportChain(cmd *cobra.Command, args []string) {
+	if exportChainOutput == "" {
+		log.Fatalf("Please specify the archive file with --output")
+	}
+
+	db, chain := openNodeChain()
+	defer db.Close()
+
+	f, err := os.Create(exportChainOutput)
+	if err != nil {
+		log.Fatalf("Failed to create %v: %v", exportChainOutput, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	count, err := blockchain.ExportChain(chain, w, exportChainStartHeight, exportChainEndHeight)
+	if err != nil {
+		log.Fatalf("Failed to export the chain: %v", err)
+	}
+	if err = w.Flush(); err != nil {
+		log.Fatalf("Failed to write %v: %v", exportChainOutput, err)
+	}
+	fmt.Printf("Exported %v blocks to %v\n", count, exportChainOutput)
+}
+
+// openNodeChain opens the database of the node, and the chain rooted at the snapshot the node
+// was started from.
+func openNodeChain() (database.Database, *blockchain.Chain) {
+	dbPath := viper.GetString(common.CfgDataPath)
+	if dbPath == "" {
+		dbPath = cfgPath
+	}
+	mainDBPath := path.Join(dbPath, "db", "main")
+	refDBPath := path.Join(dbPath, "db", "ref")
+	db, err := backend.NewLDBDatabase(mainDBPath, refDBPath,
+		viper.GetInt(common.CfgStorageLevelDBCacheSize),
+		viper.GetInt(common.CfgStorageLevelDBHandles))
+	if err != nil {
+		log.Fatalf("Failed to connect to the db. main: %v, ref: %v, err: %v",
+			mainDBPath, refDBPath, err)
+	}
+
+	rootHeader, err := snapshot.LoadValidatedSnapshotHeader(db)
+	if err != nil {
+		log.Fatalf("Failed to load the snapshot block header of the node: %v", err)
+	}
+	root := &core.Block{BlockHeader: rootHeader}
+	return db, blockchain.NewChain(root.ChainID, kvstore.NewKVStore(db), root)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+var exportSnapshotHeight uint64
+var exportSnapshotDir string
+
+// exportSnapshotCmd represents the export-snapshot command
+var exportSnapshotCmd = &cobra.Command{
+	Use:   "export-snapshot",
+	Short: "Export a snapshot at a finalized height from the database of a stopped node.",
+	Run:   runExportSnapshot,
+}
+
+func init() {
+	exportSnapshotCmd.Flags().Uint64Var(&exportSnapshotHeight, "height", 0, "height of the finalized block to export")
+	exportSnapshotCmd.Flags().StringVar(&exportSnapshotDir, "output", "", "output directory (default is <config>/backup/snapshot)")
+	RootCmd.AddCommand(exportSnapshotCmd)
+}
+
+func runExportSnapshot(cmd *cobra.Command, args []string) {
+	if exportSnapshotHeight == 0 {
+		log.Fatalf("Please specify the snapshot height with --height")
+	}
+
+	db, chain := openNodeChain()
+	defer db.Close()
+
+	snapshotDir := exportSnapshotDir
+	if snapshotDir == "" {
+		snapshotDir = path.Join(cfgPath, "backup", "snapshot")
+	}
+	if err := os.MkdirAll(snapshotDir, os.ModePerm); err != nil {
+		log.Fatalf("Failed to create the output directory %v: %v", snapshotDir, err)
+	}
+
+	snapshotFile, err := snapshot.ExportSnapshot(db, chain, snapshotDir, exportSnapshotHeight)
+	if err != nil {
+		log.Fatalf("Failed to export snapshot: %v", err)
+	}
+	fmt.Printf("Snapshot exported to %v\n", path.Join(snapshotDir, snapshotFile))
+}
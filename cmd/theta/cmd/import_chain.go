@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/blockchain"
+)
+
+var importChainInput string
+
+// importChainCmd represents the import-chain command
+var importChainCmd = &cobra.Command{
+	Use:   "import-chain",
+	Short: "Import the blocks of an RLP archive into the database of a stopped node, which replays them on start.",
+	Run:   runImportChain,
+}
+
+func init() {
+	importChainCmd.Flags().StringVar(&importChainInput, "input", "", "path of the archive file")
+	RootCmd.AddCommand(importChainCmd)
+}
+
+func runImportChain(cmd *cobra.Command, args []string) {
+	if importChainInput == "" {
+		log.Fatalf("Please specify the archive file with --input")
+	}
+
+	f, err := os.Open(importChainInput)
+	if err != nil {
+		log.Fatalf("Failed to open %v: %v", importChainInput, err)
+	}
+	defer f.Close()
+
+	db, chain := openNodeChain()
+	defer db.Close()
+
+	count, err := blockchain.ImportChain(chain, bufio.NewReader(f))
+	if err != nil {
+		log.Fatalf("Failed to import the chain after %v blocks: %v", count, err)
+	}
+	fmt.Printf("Imported %v blocks from %v\n", count, importChainInput)
+}
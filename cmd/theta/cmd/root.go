@@ -79,6 +79,11 @@ func initConfig() {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 
+	if err := common.ApplyNodeMode(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	util.InitLog()
 }
 
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+var signSnapshotPath string
+var signSnapshotKeyPath string
+
+// signSnapshotCmd represents the sign-snapshot command
+var signSnapshotCmd = &cobra.Command{
+	Use:   "sign-snapshot",
+	Short: "Sign the metadata of a snapshot with the publisher key.",
+	Run:   runSignSnapshot,
+}
+
+func init() {
+	signSnapshotCmd.Flags().StringVar(&signSnapshotPath, "snapshot", "", "path of the snapshot file to sign")
+	signSnapshotCmd.Flags().StringVar(&signSnapshotKeyPath, "key", "", "path of the hex encoded publisher private key file")
+	RootCmd.AddCommand(signSnapshotCmd)
+}
+
+func runSignSnapshot(cmd *cobra.Command, args []string) {
+	if signSnapshotPath == "" || signSnapshotKeyPath == "" {
+		log.Fatalf("Please specify the snapshot with --snapshot and the publisher key with --key")
+	}
+	privKey, err := crypto.PrivateKeyFromFile(signSnapshotKeyPath)
+	if err != nil {
+		log.Fatalf("Failed to load the publisher key: %v", err)
+	}
+	signature, err := snapshot.SignSnapshot(signSnapshotPath, privKey)
+	if err != nil {
+		log.Fatalf("Failed to sign snapshot: %v", err)
+	}
+	fmt.Printf("Snapshot signed by publisher %v, metadata hash: %v\n", signature.Publisher.Hex(), signature.MetadataHash.Hex())
+}
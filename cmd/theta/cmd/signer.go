@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/consensus/signer"
+	"github.com/thetatoken/theta/core"
+)
+
+var signerListenAddr string
+var signerStatePath string
+
+// signerCmd represents the signer command
+var signerCmd = &cobra.Command{
+	Use:   "signer",
+	Short: "Run a signer process that signs the votes and blocks of the validator key for a node, see consensus.remoteSigner.",
+	Long: `Run a signer process that signs the votes and blocks of the validator key for a node, see consensus.remoteSigner.
+The signer uses the key under the config folder, and refuses to sign conflicting votes or blocks.`,
+	Run: runSigner,
+}
+
+func init() {
+	signerCmd.Flags().StringVar(&signerListenAddr, "listen", "", "address to listen on, e.g. tcp://127.0.0.1:26659 (default is unix://<config>/signer.sock)")
+	signerCmd.Flags().StringVar(&signerStatePath, "state", "", "path of the last signed vote and block (default is <config>/signer_state)")
+	RootCmd.AddCommand(signerCmd)
+}
+
+func runSigner(cmd *cobra.Command, args []string) {
+	privKey, err := loadOrCreateKey()
+	if err != nil {
+		log.Fatalf("Failed to load or create key: %v", err)
+	}
+
+	listenAddr := signerListenAddr
+	if listenAddr == "" {
+		listenAddr = "unix://" + path.Join(cfgPath, "signer.sock")
+	}
+	statePath := signerStatePath
+	if statePath == "" {
+		statePath = path.Join(cfgPath, "signer_state")
+	}
+
+	server, err := signer.NewServer(core.NewLocalSigner(privKey), listenAddr, statePath)
+	if err != nil {
+		log.Fatalf("Failed to create signer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("Failed to start signer: %v", err)
+	}
+
+	c := make(chan os.Signal)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		signal.Stop(c)
+		cancel()
+	}()
+
+	server.Wait()
+	log.Infof("Signer stopped.")
+}
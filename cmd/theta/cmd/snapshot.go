@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Inspect snapshot files.",
+}
+
+// snapshotInfoCmd represents the snapshot info command
+var snapshotInfoCmd = &cobra.Command{
+	Use:   "info [snapshot path]",
+	Short: "Print the summary of a snapshot file without loading its state.",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runSnapshotInfo,
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotInfoCmd)
+	RootCmd.AddCommand(snapshotCmd)
+}
+
+func runSnapshotInfo(cmd *cobra.Command, args []string) {
+	filePath := snapshotPath
+	if len(args) > 0 {
+		filePath = args[0]
+	}
+	if filePath == "" {
+		log.Fatalf("Please specify the snapshot file")
+	}
+	info, err := snapshot.InspectSnapshot(filePath)
+	if err != nil {
+		log.Fatalf("Failed to inspect snapshot: %v", err)
+	}
+
+	header := info.Header
+	fmt.Printf("File:             %v\n", filePath)
+	fmt.Printf("File size:        %v bytes\n", info.FileSize)
+	fmt.Printf("Compression:      %v\n", info.Compression)
+	fmt.Printf("Format version:   %v\n", header.FormatVersion())
+	fmt.Printf("Flags:            prefixCompressed=%v typedRecords=%v filtered=%v diff=%v checksummed=%v\n",
+		header.IsPrefixCompressed(), header.HasTypedRecords(), header.IsFiltered(), header.IsDiff(), header.HasRecordChecksums())
+	fmt.Printf("Metadata version: %v\n", info.MetadataVersion)
+	fmt.Printf("Block height:     %v\n", info.BlockHeight)
+	fmt.Printf("Block hash:       %v\n", info.BlockHash.Hex())
+	fmt.Printf("State hash:       %v\n", info.StateHash.Hex())
+	if !info.PrunedStateHash.IsEmpty() {
+		fmt.Printf("Pruned hash:      %v\n", info.PrunedStateHash.Hex())
+	}
+	fmt.Printf("Block trios:      %v\n", info.NumBlockTrios)
+	fmt.Printf("Records:          %v\n", info.RecordCount)
+}
@@ -23,7 +23,6 @@ import (
 	"github.com/thetatoken/theta/node"
 	msg "github.com/thetatoken/theta/p2p/messenger"
 	msgl "github.com/thetatoken/theta/p2pl/messenger"
-	"github.com/thetatoken/theta/rlp"
 	"github.com/thetatoken/theta/snapshot"
 	"github.com/thetatoken/theta/store/database/backend"
 	"github.com/thetatoken/theta/store/rollingdb"
@@ -56,6 +55,7 @@ func runStart(cmd *cobra.Command, args []string) {
 	dbPath := viper.GetString(common.CfgDataPath)
 	if dbPath == "" {
 		dbPath = cfgPath
+		viper.Set(common.CfgDataPath, dbPath)
 	}
 
 	mainDBPath := path.Join(dbPath, "db", "main")
@@ -78,35 +78,33 @@ func runStart(cmd *cobra.Command, args []string) {
 
 	var root *core.Block
 	var snapshotBlockHeader *core.BlockHeader
-	dbSnapshotHeader := &core.BlockHeader{}
 	skipLoadSnapshot := false
 
 	// Read last verified snapshot header from db and compare with current snapshot
-	raw, err := db.Get([]byte("/snapshot_blockheader"))
+	dbSnapshotHeader, err := snapshot.LoadValidatedSnapshotHeader(db)
 	if err == nil {
-		err = rlp.DecodeBytes(raw, dbSnapshotHeader)
-		if err == nil {
-			snapshotBlockHeader = snapshot.LoadSnapshotCheckpointHeader(snapshotPath)
-			if snapshotBlockHeader.Hash() == dbSnapshotHeader.Hash() {
-				// snapshot has already been loaded into db
-				skipLoadSnapshot = true
-			}
+		snapshotBlockHeader = snapshot.LoadSnapshotCheckpointHeader(snapshotPath)
+		if snapshotBlockHeader.Hash() == dbSnapshotHeader.Hash() {
+			// snapshot has already been loaded into db
+			skipLoadSnapshot = true
 		}
 	}
 	if skipLoadSnapshot && !viper.GetBool(common.CfgForceValidateSnapshot) {
 		log.Println("Skip validating snapshot")
+	} else if !skipLoadSnapshot && viper.GetBool(common.CfgSnapshotValidateAndLoad) {
+		// The snapshot is validated as the node loads it, see snapshot.ValidateAndLoad
+		snapshotBlockHeader = snapshot.LoadSnapshotCheckpointHeader(snapshotPath)
+		if snapshotBlockHeader == nil {
+			log.Fatalf("Failed to read the snapshot block header from %v", snapshotPath)
+		}
 	} else {
 		snapshotBlockHeader, err = snapshot.ValidateSnapshot(snapshotPath, chainImportDirPath, chainCorrectionPath)
 		if err != nil {
 			log.Fatalf("Snapshot validation failed, err: %v", err)
 		}
 
-		raw, err := rlp.EncodeToBytes(snapshotBlockHeader)
-		if err == nil {
-			err = db.Put([]byte("/snapshot_blockheader"), raw)
-			if err != nil {
-				log.Errorf("Failed to save snapshot validation result: %v", err)
-			}
+		if err = snapshot.SaveValidatedSnapshotHeader(db, snapshotBlockHeader); err != nil {
+			log.Errorf("Failed to save snapshot validation result: %v", err)
 		}
 	}
 
@@ -146,6 +144,7 @@ func runStart(cmd *cobra.Command, args []string) {
 		SnapshotPath:        snapshotPath,
 		ChainImportDirPath:  chainImportDirPath,
 		ChainCorrectionPath: chainCorrectionPath,
+		WALPath:             path.Join(dbPath, "db", consensusWALFile),
 	}
 
 	n := node.NewNode(params)
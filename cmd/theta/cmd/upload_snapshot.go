@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+var uploadSnapshotPath string
+var uploadSnapshotTargets []string
+
+// uploadSnapshotCmd represents the upload-snapshot command
+var uploadSnapshotCmd = &cobra.Command{
+	Use:   "upload-snapshot",
+	Short: "Upload a snapshot with its signature and checksum manifest.",
+	Run:   runUploadSnapshot,
+}
+
+func init() {
+	uploadSnapshotCmd.Flags().StringVar(&uploadSnapshotPath, "snapshot", "", "path of the snapshot file to upload")
+	uploadSnapshotCmd.Flags().StringSliceVar(&uploadSnapshotTargets, "target", []string{}, "upload target, s3://<bucket>/<prefix>, gs://<bucket>/<prefix> or an http(s) URL (default: the targets in the config)")
+	RootCmd.AddCommand(uploadSnapshotCmd)
+}
+
+func runUploadSnapshot(cmd *cobra.Command, args []string) {
+	if uploadSnapshotPath == "" {
+		log.Fatalf("Please specify the snapshot with --snapshot")
+	}
+	uploaders, err := snapshot.SnapshotUploaders()
+	if err != nil {
+		log.Fatalf("Failed to create the snapshot uploaders: %v", err)
+	}
+	if len(uploadSnapshotTargets) > 0 {
+		uploaders = []snapshot.SnapshotUploader{}
+		config := snapshot.SnapshotUploaderConfigFromViper()
+		for _, target := range uploadSnapshotTargets {
+			uploader, err := snapshot.NewSnapshotUploader(target, config)
+			if err != nil {
+				log.Fatalf("Failed to create the snapshot uploader: %v", err)
+			}
+			uploaders = append(uploaders, uploader)
+		}
+	}
+	if len(uploaders) == 0 {
+		log.Fatalf("Please specify the upload targets with --target or in the config")
+	}
+	if err := snapshot.UploadSnapshot(uploadSnapshotPath, uploaders); err != nil {
+		log.Fatalf("Failed to upload snapshot: %v", err)
+	}
+	fmt.Printf("Snapshot %v uploaded to %v targets\n", uploadSnapshotPath, len(uploaders))
+}
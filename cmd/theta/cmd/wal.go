@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+)
+
+// consensusWALFile is the name of the consensus write-ahead log in the db directory.
+const consensusWALFile = "consensus_wal"
+
+var walReplayPath string
+
+// walCmd represents the wal command
+var walCmd = &cobra.Command{
+	Use:   "wal",
+	Short: "Inspect the consensus write-ahead log, see consensus.wal.",
+}
+
+// walReplayCmd represents the wal replay command
+var walReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Print the records of the consensus write-ahead log, and the state a node recovers from it.",
+	Run:   runWALReplay,
+}
+
+func init() {
+	walReplayCmd.Flags().StringVar(&walReplayPath, "path", "", "path of the WAL (default is <data>/db/"+consensusWALFile+")")
+	walCmd.AddCommand(walReplayCmd)
+	RootCmd.AddCommand(walCmd)
+}
+
+func runWALReplay(cmd *cobra.Command, args []string) {
+	walPath := walReplayPath
+	if walPath == "" {
+		dbPath := viper.GetString(common.CfgDataPath)
+		if dbPath == "" {
+			dbPath = cfgPath
+		}
+		walPath = path.Join(dbPath, "db", consensusWALFile)
+	}
+
+	records, size, err := consensus.ReadWAL(walPath)
+	if err != nil {
+		log.Fatalf("Failed to read the WAL: %v", err)
+	}
+	fmt.Printf("WAL %v: %v records in %v bytes\n", walPath, len(records), size)
+
+	// The most recent proposal, vote and epoch logged for the last root, which a node on that
+	// root recovers unless its state is more recent, see State.RecoverFromWAL.
+	var root common.Hash
+	var lastProposal, lastVote string
+	var epoch uint64
+	for i, record := range records {
+		if record.Root != root {
+			root = record.Root
+			lastProposal, lastVote, epoch = "", "", 0
+			fmt.Printf("Root %v\n", root.Hex())
+		}
+		var desc string
+		switch record.Type {
+		case consensus.WALRecordProposal:
+			proposal, err := record.Proposal()
+			if err != nil {
+				log.Fatalf("Record %v: %v", i, err)
+			}
+			if proposal.Block == nil {
+				desc = "reset"
+				break
+			}
+			desc = fmt.Sprintf("block %v, height %v, epoch %v, proposer %v",
+				proposal.Block.Hash().Hex(), proposal.Block.Height, proposal.Block.Epoch, proposal.ProposerID.Hex())
+			lastProposal = desc
+		case consensus.WALRecordVote:
+			vote, err := record.Vote()
+			if err != nil {
+				log.Fatalf("Record %v: %v", i, err)
+			}
+			if vote.Height == 0 {
+				desc = "reset"
+				break
+			}
+			desc = fmt.Sprintf("block %v, height %v, epoch %v, voter %v",
+				vote.Block.Hex(), vote.Height, vote.Epoch, vote.ID.Hex())
+			lastVote = desc
+		case consensus.WALRecordEpoch:
+			recordEpoch, err := record.Epoch()
+			if err != nil {
+				log.Fatalf("Record %v: %v", i, err)
+			}
+			if recordEpoch > epoch {
+				epoch = recordEpoch
+			}
+			desc = fmt.Sprintf("%v", recordEpoch)
+		default:
+			desc = fmt.Sprintf("%v payload bytes", len(record.Payload))
+		}
+		fmt.Printf("%6d %-8v %v\n", i, record.Type, desc)
+	}
+
+	if len(records) == 0 {
+		return
+	}
+	fmt.Printf("Most recent state of root %v\n", root.Hex())
+	fmt.Printf("  proposal: %v\n", lastProposal)
+	fmt.Printf("  vote:     %v\n", lastVote)
+	fmt.Printf("  epoch:    %v\n", epoch)
+}
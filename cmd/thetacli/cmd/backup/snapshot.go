@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/thetatoken/theta/cmd/thetacli/cmd/utils"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/rpc"
 
 	"github.com/spf13/cobra"
@@ -12,6 +14,11 @@ import (
 	rpcc "github.com/ybbus/jsonrpc"
 )
 
+var (
+	pruneDustFlag     bool
+	dustThresholdFlag string
+)
+
 // snapshotCmd represents the snapshot backup command.
 // Example:
 //		thetacli backup snapshot
@@ -26,7 +33,16 @@ var snapshotCmd = &cobra.Command{
 func doSnapshotCmd(cmd *cobra.Command, args []string) {
 	client := rpcc.NewRPCClient(viper.GetString(utils.CfgRemoteRPCEndpoint))
 
-	res, err := client.Call("theta.BackupSnapshot", rpc.BackupSnapshotArgs{Config: configFlag, Height: heightFlag, Version: versionFlag})
+	backupArgs := rpc.BackupSnapshotArgs{Config: configFlag, Height: heightFlag, Version: versionFlag, PruneDust: pruneDustFlag}
+	if pruneDustFlag {
+		threshold, ok := types.ParseCoinAmount(dustThresholdFlag)
+		if !ok {
+			utils.Error("Failed to parse dust threshold")
+		}
+		backupArgs.DustThreshold = (*common.JSONBig)(threshold)
+	}
+
+	res, err := client.Call("theta.BackupSnapshot", backupArgs)
 	if err != nil {
 		utils.Error("Failed to get backup snapshot call details: %v\n", err)
 	}
@@ -45,4 +61,6 @@ func init() {
 	snapshotCmd.MarkFlagRequired("config")
 	snapshotCmd.Flags().Uint64Var(&heightFlag, "height", 0, "Snapshot height")
 	snapshotCmd.Flags().Uint64Var(&versionFlag, "version", 0, "Snapshot version.(2 or 3. Default is 2)")
+	snapshotCmd.Flags().BoolVar(&pruneDustFlag, "prune_dust", false, "Prune the dust accounts (version 2 only)")
+	snapshotCmd.Flags().StringVar(&dustThresholdFlag, "dust_threshold", "0", "Max TFuel of a pruned dust account")
 }
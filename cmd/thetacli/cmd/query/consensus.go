@@ -0,0 +1,39 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/thetatoken/theta/cmd/thetacli/cmd/utils"
+	"github.com/thetatoken/theta/rpc"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	rpcc "github.com/ybbus/jsonrpc"
+)
+
+// consensusCmd represents the consensus command.
+// Example:
+//		thetacli query consensus
+var consensusCmd = &cobra.Command{
+	Use:     "consensus",
+	Short:   "Get consensus state",
+	Long:    `Get the consensus state, e.g. to debug a stuck network.`,
+	Example: `thetacli query consensus`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := rpcc.NewRPCClient(viper.GetString(utils.CfgRemoteRPCEndpoint))
+
+		res, err := client.Call("theta.GetConsensusState", rpc.GetConsensusStateArgs{})
+		if err != nil {
+			utils.Error("Failed to get consensus state: %v\n", err)
+		}
+		if res.Error != nil {
+			utils.Error("Failed to retrieve consensus state: %v\n", res.Error)
+		}
+		json, err := json.MarshalIndent(res.Result, "", "    ")
+		if err != nil {
+			utils.Error("Failed to parse server response: %v\n%v\n", err, string(json))
+		}
+		fmt.Println(string(json))
+	},
+}
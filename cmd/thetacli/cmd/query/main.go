@@ -25,6 +25,7 @@ var QueryCmd = &cobra.Command{
 
 func init() {
 	QueryCmd.AddCommand(statusCmd)
+	QueryCmd.AddCommand(consensusCmd)
 	QueryCmd.AddCommand(accountCmd)
 	QueryCmd.AddCommand(guardianCmd)
 	QueryCmd.AddCommand(blockCmd)
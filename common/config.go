@@ -16,8 +16,66 @@ const (
 
 	// CfgNodeType indicates the type of the node, e.g. blockchain node/edge node
 	CfgNodeType = "node.type"
+	// CfgNodeMode indicates the operating mode of the node, i.e. archive, full or light, which sets the defaults of the state retention, the tx indexing and the RPC methods served
+	CfgNodeMode = "node.mode"
 	// CfgForceValidateSnapshot defines wether validation of snapshot can be skipped
 	CfgForceValidateSnapshot = "snapshot.force_validate"
+	// CfgSnapshotWriteBatchSize defines the number of snapshot records written to the DB per batch (0: auto-tuned)
+	CfgSnapshotWriteBatchSize = "snapshot.writeBatchSize"
+	// CfgSnapshotReuseRecordBuffer defines whether to decode snapshot records in a reused buffer to reduce allocations
+	CfgSnapshotReuseRecordBuffer = "snapshot.reuseRecordBuffer"
+	// CfgSnapshotPrefixCompression defines whether to prefix compress the records of the exported V2 snapshots
+	CfgSnapshotPrefixCompression = "snapshot.prefixCompression"
+	// CfgSnapshotTypedRecords defines whether to tag the records of the exported V2 snapshots with the record type
+	CfgSnapshotTypedRecords = "snapshot.typedRecords"
+	// CfgSnapshotSafeLoad defines whether to validate a snapshot in a temporary DB before loading it into the node DB
+	CfgSnapshotSafeLoad = "snapshot.safeLoad"
+	// CfgSnapshotValidateAndLoad defines whether to validate a snapshot while loading it into the node DB, rather than validating it in a temporary DB first
+	CfgSnapshotValidateAndLoad = "snapshot.validateAndLoad"
+	// CfgSnapshotValidateInMemory defines whether to validate snapshots in a memory-backed DB rather than a temporary DB on disk
+	CfgSnapshotValidateInMemory = "snapshot.validateInMemory"
+	// CfgSnapshotSpillThresholdMB defines the size (in MB) above which the memory-backed validation DB is moved to disk (0: never)
+	CfgSnapshotSpillThresholdMB = "snapshot.spillThresholdMB"
+	// CfgSnapshotStrictRecordOrder defines whether to reject V2 snapshots whose records are not in ascending key order within each store view
+	CfgSnapshotStrictRecordOrder = "snapshot.strictRecordOrder"
+	// CfgSnapshotFlushHeapThresholdMB defines the heap usage (in MB) above which the in-progress store view is flushed during V2 snapshot loads (0: disabled)
+	CfgSnapshotFlushHeapThresholdMB = "snapshot.flushHeapThresholdMB"
+	// CfgSnapshotMemoryLimitMB defines the memory (in MB) the snapshot loads may use to hold the pending state records (0: unlimited)
+	CfgSnapshotMemoryLimitMB = "snapshot.memoryLimitMB"
+	// CfgSnapshotUseMmap defines whether to memory-map the snapshot files being loaded
+	CfgSnapshotUseMmap = "snapshot.useMmap"
+	// CfgSnapshotVerificationCache defines whether to cache successful snapshot validations in the node data dir, keyed by the snapshot content hash
+	CfgSnapshotVerificationCache = "snapshot.verificationCache"
+	// CfgSnapshotExportCompression defines the compression of the exported snapshots, i.e. none or gzip
+	CfgSnapshotExportCompression = "snapshot.exportCompression"
+	// CfgSnapshotLoadParallelism defines the number of workers loading the account storages of a snapshot concurrently
+	CfgSnapshotLoadParallelism = "snapshot.loadParallelism"
+	// CfgSnapshotResumableLoad defines whether to checkpoint the snapshot loading progress so that an interrupted load can resume
+	CfgSnapshotResumableLoad = "snapshot.resumableLoad"
+	// CfgSnapshotRecordChecksums defines whether to append a checksum to each record of the exported snapshots, and a trailer checksum of the whole file
+	CfgSnapshotRecordChecksums = "snapshot.recordChecksums"
+	// CfgSnapshotPublishers defines the comma separated addresses of the publishers whose signature a snapshot needs to pass validation (empty: not required)
+	CfgSnapshotPublishers = "snapshot.publishers"
+	// CfgSnapshotScheduleInterval defines the number of finalized blocks between the snapshots exported automatically (0: disabled)
+	CfgSnapshotScheduleInterval = "snapshot.scheduleInterval"
+	// CfgSnapshotScheduleDir defines the directory of the snapshots exported automatically (empty: the scheduled directory next to the snapshot)
+	CfgSnapshotScheduleDir = "snapshot.scheduleDir"
+	// CfgSnapshotScheduleKeep defines the number of the snapshots exported automatically kept on disk (0: all)
+	CfgSnapshotScheduleKeep = "snapshot.scheduleKeep"
+	// CfgSnapshotUploadTargets defines the comma separated targets the scheduled snapshots are uploaded to, s3://<bucket>/<prefix>, gs://<bucket>/<prefix> or http(s) URLs (empty: disabled)
+	CfgSnapshotUploadTargets = "snapshot.uploadTargets"
+	// CfgSnapshotUploadS3Endpoint defines the endpoint of the S3 compatible storage (empty: the AWS endpoint of the region)
+	CfgSnapshotUploadS3Endpoint = "snapshot.uploadS3Endpoint"
+	// CfgSnapshotUploadS3Region defines the region of the S3 buckets
+	CfgSnapshotUploadS3Region = "snapshot.uploadS3Region"
+	// CfgSnapshotUploadS3AccessKey defines the access key ID of the S3 uploads
+	CfgSnapshotUploadS3AccessKey = "snapshot.uploadS3AccessKey"
+	// CfgSnapshotUploadS3SecretKey defines the secret access key of the S3 uploads
+	CfgSnapshotUploadS3SecretKey = "snapshot.uploadS3SecretKey"
+	// CfgSnapshotUploadGCSToken defines the OAuth2 access token of the Google Cloud Storage uploads
+	CfgSnapshotUploadGCSToken = "snapshot.uploadGCSToken"
+	// CfgSnapshotUploadHTTPAuthorization defines the Authorization header of the HTTP PUT uploads (empty: none)
+	CfgSnapshotUploadHTTPAuthorization = "snapshot.uploadHTTPAuthorization"
 
 	// CfgGenesisHash defines the hash of the genesis block
 	CfgGenesisHash = "genesis.hash"
@@ -26,6 +84,9 @@ const (
 
 	// CfgConsensusMaxEpochLength defines the maxium length of an epoch.
 	CfgConsensusMaxEpochLength = "consensus.maxEpochLength"
+	// CfgConsensusMaxEpochBackoffLength defines the maximum length of an epoch (in seconds) as it backs
+	// off after consecutive epoch timeouts.
+	CfgConsensusMaxEpochBackoffLength = "consensus.maxEpochBackoffLength"
 	// CfgConsensusMinBlockTime defines the minimal block interval (in seconds)
 	CfgConsensusMinBlockInterval = "consensus.minBlockInterval"
 	// CfgConsensusMessageQueueSize defines the capacity of consensus message queue.
@@ -34,10 +95,17 @@ const (
 	CfgConsensusEdgeNodeVoteQueueSize = "consensus.edgeNodeVoteQueueSize"
 	// CfgConsensusPassThroughGuardianVote defines the how guardian vote is handled.
 	CfgConsensusPassThroughGuardianVote = "consensus.passThroughGuardianVote"
+	// CfgConsensusWAL defines whether the proposals, votes and epochs are logged for the crash recovery.
+	CfgConsensusWAL = "consensus.wal"
+	// CfgConsensusRemoteSigner defines the address of the signer process of the validator key, e.g.
+	// unix:///var/run/theta_signer.sock. The node key signs the votes and blocks if it is empty.
+	CfgConsensusRemoteSigner = "consensus.remoteSigner"
+	// CfgConsensusRemoteSignerTimeoutSecs defines the timeout of a request to the signer process.
+	CfgConsensusRemoteSignerTimeoutSecs = "consensus.remoteSignerTimeoutSecs"
 
 	// CfgStorageRollingEnabled indicates whether rolling is enabled
 	CfgStorageRollingEnabled = "storage.stateRollingEnabled"
-	// CfgStorageStatePruningEnabled indicates whether state pruning is enabled
+	// CfgStorageStatePruningEnabled indicates whether to prune the reference counted state trie nodes of the blocks older than the retained blocks
 	CfgStorageStatePruningEnabled = "storage.statePruningEnabled"
 	// CfgStorageStatePruningInterval indicates the purning interval (in terms of blocks)
 	CfgStorageStatePruningInterval = "storage.statePruningInterval"
@@ -45,12 +113,42 @@ const (
 	CfgStorageStatePruningRetainedBlocks = "storage.statePruningRetainedBlocks"
 	// CfgStorageStatePruningSkipCheckpoints indicates if the checkpoint state trie should be retained
 	CfgStorageStatePruningSkipCheckpoints = "storage.statePruningSkipCheckpoints"
+	// CfgStorageFlatSnapshotEnabled indicates whether to serve the account and storage reads from a flat snapshot of the state trie
+	CfgStorageFlatSnapshotEnabled = "storage.flatSnapshotEnabled"
 	// CfgStorageLevelDBCacheSize indicates Level DB cache size
 	CfgStorageLevelDBCacheSize = "storage.levelDBCacheSize"
 	// CfgStorageLevelDBHandles indicates Level DB handle count
 	CfgStorageLevelDBHandles = "storage.levelDBHandles"
 	// CfgStorageRollingInterval is the block interval that we start new db layer
 	CfgStorageRollingInterval = "storage.rollingInterval"
+	// CfgStorageIndexStateRoot indicates whether to index the blocks by their state root
+	CfgStorageIndexStateRoot = "storage.indexStateRoot"
+	// CfgStorageIndexTxsByAddress indicates whether to index the finalized transactions by their sender and recipient addresses
+	CfgStorageIndexTxsByAddress = "storage.indexTxsByAddress"
+	// CfgStorageIndexLogs indicates whether to index the smart contract logs of the finalized blocks with bloom filters
+	CfgStorageIndexLogs = "storage.indexLogs"
+	// CfgStorageIndexInternalTxs indicates whether to index the value transfers by the smart contracts of the finalized blocks by their sender and recipient addresses
+	CfgStorageIndexInternalTxs = "storage.indexInternalTxs"
+	// CfgStorageTxIndexPolicy selects which block the tx index points to for a tx included more than once: first-seen, last-finalized or all-occurrences
+	CfgStorageTxIndexPolicy = "storage.txIndexPolicy"
+	// CfgStorageTxIndexDepth indicates the number of the latest finalized blocks whose transactions are kept in the tx index (0: all)
+	CfgStorageTxIndexDepth = "storage.txIndexDepth"
+	// CfgStorageCompressBlocks indicates whether to store the blocks, mostly their transaction payloads, compressed
+	CfgStorageCompressBlocks = "storage.compressBlocks"
+	// CfgStorageRecordBlockMetadata indicates whether to record the proposer, vote participation and rewards of the finalized blocks
+	CfgStorageRecordBlockMetadata = "storage.recordBlockMetadata"
+	// CfgStorageOrphanPruningEnabled indicates whether to remove the blocks of the abandoned forks from the DB
+	CfgStorageOrphanPruningEnabled = "storage.orphanPruningEnabled"
+	// CfgStorageOrphanPruningInterval indicates the orphan pruning interval (in terms of finalized blocks)
+	CfgStorageOrphanPruningInterval = "storage.orphanPruningInterval"
+	// CfgStorageOrphanPruningRetainedBlocks indicates the number of heights below the finalized height whose orphan blocks are retained
+	CfgStorageOrphanPruningRetainedBlocks = "storage.orphanPruningRetainedBlocks"
+	// CfgStorageAddBlocksBatchBytes is the size of the pending writes (in bytes) after which a bulk block insertion commits
+	CfgStorageAddBlocksBatchBytes = "storage.addBlocksBatchBytes"
+	// CfgStorageAddBlocksBatchTxs is the number of transactions after which a bulk block insertion commits
+	CfgStorageAddBlocksBatchTxs = "storage.addBlocksBatchTxs"
+	// CfgStorageCanonicalBlockCacheSize is the number of the latest finalized blocks kept in memory
+	CfgStorageCanonicalBlockCacheSize = "storage.canonicalBlockCacheSize"
 
 	// CfgSyncMessageQueueSize defines the capacity of Sync Manager message queue.
 	CfgSyncMessageQueueSize = "sync.messageQueueSize"
@@ -110,6 +208,16 @@ const (
 
 	// CfgSyncInboundResponseWhitelist filters inbound messages based on peer ID.
 	CfgSyncInboundResponseWhitelist = "sync.inboundResponseWhitelist"
+	// CfgSyncSnapshotChunkDir defines the directory of the snapshot chunks served to the peers (empty: not serving)
+	CfgSyncSnapshotChunkDir = "sync.snapshotChunkDir"
+	// CfgSyncSnapshotFastSync defines whether to fetch the state of a recent finalized checkpoint from the snapshot peers before syncing blocks
+	CfgSyncSnapshotFastSync = "sync.snapshotFastSync"
+	// CfgSyncSnapshotFastSyncMinHeightGap defines how far ahead of the last finalized block a checkpoint needs to be for the snapshot fast sync
+	CfgSyncSnapshotFastSyncMinHeightGap = "sync.snapshotFastSyncMinHeightGap"
+	// CfgSyncSnapshotFastSyncMinPeers defines the number of peers which need to serve a checkpoint for the snapshot fast sync to select it
+	CfgSyncSnapshotFastSyncMinPeers = "sync.snapshotFastSyncMinPeers"
+	// CfgSyncLightSync defines whether to only sync the block headers and the validator set transitions, without the blocks and the state
+	CfgSyncLightSync = "sync.lightSync"
 
 	// CfgRPCEnabled sets whether to run RPC service.
 	CfgRPCEnabled = "rpc.enabled"
@@ -121,6 +229,10 @@ const (
 	CfgRPCMaxConnections = "rpc.maxConnections"
 	// CfgRPCTimeoutSecs set a timeout for RPC.
 	CfgRPCTimeoutSecs = "rpc.timeoutSecs"
+	// CfgRPCEnabledMethods sets the comma separated RPC methods served, e.g. GetStatus (empty: all)
+	CfgRPCEnabledMethods = "rpc.enabledMethods"
+	// CfgRPCDisabledMethods sets the comma separated RPC methods not served
+	CfgRPCDisabledMethods = "rpc.disabledMethods"
 
 	// CfgLogLevels sets the log level.
 	CfgLogLevels = "log.levels"
@@ -130,6 +242,11 @@ const (
 
 	// CfgGuardianRoundLength defines the length of a guardian voting round.
 	CfgGuardianRoundLength = "guardian.roundLength"
+	// CfgGuardianVoteWorkers defines the number of workers verifying the guardian votes, 0 for
+	// the number of CPUs.
+	CfgGuardianVoteWorkers = "guardian.voteWorkers"
+	// CfgGuardianVoteQueueSize defines the capacity of the queue of guardian votes to verify.
+	CfgGuardianVoteQueueSize = "guardian.voteQueueSize"
 
 	// Graphite Server to collet metrics
 	CfgMetricsServer = "metrics.server"
@@ -158,26 +275,79 @@ p2p:
 
 func init() {
 	viper.SetDefault(CfgNodeType, 1) // 1: blockchain node, 2: edge node
+	viper.SetDefault(CfgNodeMode, NodeModeArchive)
 	viper.SetDefault(CfgForceValidateSnapshot, false)
+	viper.SetDefault(CfgSnapshotWriteBatchSize, 0)
+	viper.SetDefault(CfgSnapshotReuseRecordBuffer, false)
+	viper.SetDefault(CfgSnapshotPrefixCompression, false)
+	viper.SetDefault(CfgSnapshotTypedRecords, false)
+	viper.SetDefault(CfgSnapshotSafeLoad, false)
+	viper.SetDefault(CfgSnapshotValidateAndLoad, false)
+	viper.SetDefault(CfgSnapshotValidateInMemory, false)
+	viper.SetDefault(CfgSnapshotSpillThresholdMB, 4096)
+	viper.SetDefault(CfgSnapshotStrictRecordOrder, false)
+	viper.SetDefault(CfgSnapshotFlushHeapThresholdMB, 0)
+	viper.SetDefault(CfgSnapshotMemoryLimitMB, 0)
+	viper.SetDefault(CfgSnapshotUseMmap, false)
+	viper.SetDefault(CfgSnapshotVerificationCache, false)
+	viper.SetDefault(CfgSnapshotExportCompression, "none")
+	viper.SetDefault(CfgSnapshotLoadParallelism, 1)
+	viper.SetDefault(CfgSnapshotResumableLoad, false)
+	viper.SetDefault(CfgSnapshotRecordChecksums, false)
+	viper.SetDefault(CfgSnapshotPublishers, "")
+	viper.SetDefault(CfgSnapshotScheduleInterval, 0)
+	viper.SetDefault(CfgSnapshotScheduleDir, "")
+	viper.SetDefault(CfgSnapshotScheduleKeep, 3)
+	viper.SetDefault(CfgSnapshotUploadTargets, "")
+	viper.SetDefault(CfgSnapshotUploadS3Endpoint, "")
+	viper.SetDefault(CfgSnapshotUploadS3Region, "us-east-1")
+	viper.SetDefault(CfgSnapshotUploadS3AccessKey, "")
+	viper.SetDefault(CfgSnapshotUploadS3SecretKey, "")
+	viper.SetDefault(CfgSnapshotUploadGCSToken, "")
+	viper.SetDefault(CfgSnapshotUploadHTTPAuthorization, "")
 
 	viper.SetDefault(CfgConsensusMaxEpochLength, 20)
+	viper.SetDefault(CfgConsensusMaxEpochBackoffLength, 160)
 	viper.SetDefault(CfgConsensusMinBlockInterval, 6)
 	viper.SetDefault(CfgConsensusMessageQueueSize, 512)
 	viper.SetDefault(CfgConsensusEdgeNodeVoteQueueSize, 100000)
 	viper.SetDefault(CfgConsensusPassThroughGuardianVote, false)
+	viper.SetDefault(CfgConsensusWAL, true)
+	viper.SetDefault(CfgConsensusRemoteSigner, "")
+	viper.SetDefault(CfgConsensusRemoteSignerTimeoutSecs, 5)
 
 	viper.SetDefault(CfgSyncMessageQueueSize, 512)
 	viper.SetDefault(CfgSyncDownloadByHash, false)
 	viper.SetDefault(CfgSyncDownloadByHeader, true)
+	viper.SetDefault(CfgSyncSnapshotChunkDir, "")
+	viper.SetDefault(CfgSyncSnapshotFastSync, false)
+	viper.SetDefault(CfgSyncSnapshotFastSyncMinHeightGap, 10000)
+	viper.SetDefault(CfgSyncSnapshotFastSyncMinPeers, 2)
+	viper.SetDefault(CfgSyncLightSync, false)
 
 	viper.SetDefault(CfgStorageRollingEnabled, true)
-	viper.SetDefault(CfgStorageStatePruningEnabled, true)
+	viper.SetDefault(CfgStorageStatePruningEnabled, false)
 	viper.SetDefault(CfgStorageStatePruningInterval, 16)
 	viper.SetDefault(CfgStorageStatePruningRetainedBlocks, 2048)
 	viper.SetDefault(CfgStorageStatePruningSkipCheckpoints, true)
+	viper.SetDefault(CfgStorageFlatSnapshotEnabled, false)
 	viper.SetDefault(CfgStorageLevelDBCacheSize, 256)
 	viper.SetDefault(CfgStorageLevelDBHandles, 16)
 	viper.SetDefault(CfgStorageRollingInterval, 14400) // approximately 1 days by default
+	viper.SetDefault(CfgStorageIndexStateRoot, false)
+	viper.SetDefault(CfgStorageIndexTxsByAddress, false)
+	viper.SetDefault(CfgStorageIndexLogs, false)
+	viper.SetDefault(CfgStorageIndexInternalTxs, false)
+	viper.SetDefault(CfgStorageTxIndexPolicy, "last-finalized")
+	viper.SetDefault(CfgStorageTxIndexDepth, 0)
+	viper.SetDefault(CfgStorageCompressBlocks, false)
+	viper.SetDefault(CfgStorageRecordBlockMetadata, false)
+	viper.SetDefault(CfgStorageOrphanPruningEnabled, false)
+	viper.SetDefault(CfgStorageOrphanPruningInterval, 1000)
+	viper.SetDefault(CfgStorageOrphanPruningRetainedBlocks, 14400)
+	viper.SetDefault(CfgStorageAddBlocksBatchBytes, 4*1024*1024)
+	viper.SetDefault(CfgStorageAddBlocksBatchTxs, 10000)
+	viper.SetDefault(CfgStorageCanonicalBlockCacheSize, 256)
 
 	viper.SetDefault(CfgRPCEnabled, false)
 	viper.SetDefault(CfgP2PMessageQueueSize, 512)
@@ -205,11 +375,15 @@ func init() {
 	viper.SetDefault(CfgRPCPort, "16888")
 	viper.SetDefault(CfgRPCMaxConnections, 200)
 	viper.SetDefault(CfgRPCTimeoutSecs, 60)
+	viper.SetDefault(CfgRPCEnabledMethods, "")
+	viper.SetDefault(CfgRPCDisabledMethods, "")
 
 	viper.SetDefault(CfgLogLevels, "*:debug")
 	viper.SetDefault(CfgLogPrintSelfID, false)
 
 	viper.SetDefault(CfgGuardianRoundLength, 30)
+	viper.SetDefault(CfgGuardianVoteWorkers, 0)
+	viper.SetDefault(CfgGuardianVoteQueueSize, 16384)
 
 	viper.SetDefault(CfgMetricsServer, "guardian-metrics.thetatoken.org")
 
@@ -30,6 +30,9 @@ const HeightTxWrapperExtension uint64 = 12749952
 // HeightSupportThetaTokenInSmartContract specifies the block height to support Theta in smart contracts
 const HeightSupportThetaTokenInSmartContract uint64 = 13123789 // approximate time: 5pm Dec 4, 2021 PT
 
+// HeightEnableRotateValidatorKey specifies the minimal block height to enable the validator key rotation transaction
+const HeightEnableRotateValidatorKey uint64 = 13500000
+
 // CheckpointInterval defines the interval between checkpoints.
 const CheckpointInterval = int64(100)
 
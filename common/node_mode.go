@@ -0,0 +1,92 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// The node modes, set with CfgNodeMode.
+const (
+	// NodeModeArchive retains the states of all the blocks and serves all the RPC methods.
+	NodeModeArchive = "archive"
+	// NodeModeFull prunes the old states and the old tx index entries, and does not serve the
+	// RPC methods depending on the full history.
+	NodeModeFull = "full"
+	// NodeModeLight only syncs the block headers and the validator set transitions, and only
+	// serves the RPC methods about the chain status and the finality.
+	NodeModeLight = "light"
+)
+
+// FullNodeTxIndexDepth is the default tx index depth of the full nodes, about 30 days of blocks.
+const FullNodeTxIndexDepth = 432000
+
+// fullNodeDisabledRPCMethods are the RPC methods depending on the states or the indexes the full
+// nodes do not retain.
+var fullNodeDisabledRPCMethods = []string{
+	"BackupChain",
+	"BackupChainCorrection",
+	"GetTransactionOccurrences",
+	"GetTransactionsByAddress",
+	"GetInternalTransactionsByBlock",
+	"GetInternalTransactionsByAddress",
+	"GetLogs",
+}
+
+// lightNodeEnabledRPCMethods are the RPC methods served from the block headers the light nodes
+// sync.
+var lightNodeEnabledRPCMethods = []string{
+	"GetVersion",
+	"GetStatus",
+	"GetPeers",
+	"GetPeerURLs",
+	"GetFinalityStatus",
+	"GetFinalityProof",
+}
+
+// ApplyNodeMode sets the defaults of the configured node mode. It needs to be called once the
+// config is loaded, the settings explicitly configured keep their value.
+func ApplyNodeMode() error {
+	switch mode := viper.GetString(CfgNodeMode); mode {
+	case NodeModeArchive:
+		viper.SetDefault(CfgStorageStatePruningEnabled, false)
+		viper.SetDefault(CfgStorageTxIndexDepth, 0)
+	case NodeModeFull:
+		viper.SetDefault(CfgStorageStatePruningEnabled, true)
+		viper.SetDefault(CfgStorageTxIndexDepth, FullNodeTxIndexDepth)
+		viper.SetDefault(CfgStorageIndexTxsByAddress, false)
+		viper.SetDefault(CfgStorageIndexLogs, false)
+		viper.SetDefault(CfgStorageIndexInternalTxs, false)
+		viper.SetDefault(CfgRPCDisabledMethods, strings.Join(fullNodeDisabledRPCMethods, ","))
+	case NodeModeLight:
+		viper.SetDefault(CfgSyncLightSync, true)
+		viper.SetDefault(CfgRPCEnabledMethods, strings.Join(lightNodeEnabledRPCMethods, ","))
+	default:
+		return fmt.Errorf("Unknown node mode: %v, expected %v, %v or %v", mode, NodeModeArchive, NodeModeFull, NodeModeLight)
+	}
+	return nil
+}
+
+// RPCMethodFilter returns the function checking whether the configured RPC methods include the
+// method, named without its service prefix, e.g. GetStatus.
+func RPCMethodFilter() func(method string) bool {
+	enabled := parseMethodList(viper.GetString(CfgRPCEnabledMethods))
+	disabled := parseMethodList(viper.GetString(CfgRPCDisabledMethods))
+	return func(method string) bool {
+		if len(enabled) > 0 && !enabled[method] {
+			return false
+		}
+		return !disabled[method]
+	}
+}
+
+func parseMethodList(value string) map[string]bool {
+	methods := make(map[string]bool)
+	for _, method := range strings.Split(value, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			methods[method] = true
+		}
+	}
+	return methods
+}
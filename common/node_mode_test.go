@@ -0,0 +1,53 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyNodeMode(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func() {
+		viper.Set(CfgNodeMode, NodeModeArchive)
+		viper.Set(CfgStorageIndexLogs, nil)
+		viper.SetDefault(CfgStorageStatePruningEnabled, false)
+		viper.SetDefault(CfgStorageTxIndexDepth, 0)
+		viper.SetDefault(CfgStorageIndexTxsByAddress, false)
+		viper.SetDefault(CfgStorageIndexLogs, false)
+		viper.SetDefault(CfgStorageIndexInternalTxs, false)
+		viper.SetDefault(CfgRPCDisabledMethods, "")
+	}()
+
+	viper.Set(CfgNodeMode, "pruned")
+	assert.NotNil(ApplyNodeMode())
+
+	viper.Set(CfgNodeMode, NodeModeFull)
+	viper.Set(CfgStorageIndexLogs, true) // explicitly configured
+	assert.Nil(ApplyNodeMode())
+	assert.True(viper.GetBool(CfgStorageStatePruningEnabled))
+	assert.Equal(uint64(FullNodeTxIndexDepth), viper.GetUint64(CfgStorageTxIndexDepth))
+	assert.False(viper.GetBool(CfgStorageIndexTxsByAddress))
+	assert.True(viper.GetBool(CfgStorageIndexLogs))
+
+	filter := RPCMethodFilter()
+	assert.True(filter("GetStatus"))
+	assert.True(filter("GetBlock"))
+	assert.False(filter("GetTransactionsByAddress"))
+}
+
+func TestRPCMethodFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	viper.Set(CfgRPCEnabledMethods, "GetStatus, GetBlock")
+	viper.Set(CfgRPCDisabledMethods, "GetBlock")
+	defer viper.Set(CfgRPCEnabledMethods, "")
+	defer viper.Set(CfgRPCDisabledMethods, "")
+
+	filter := RPCMethodFilter()
+	assert.True(filter("GetStatus"))
+	assert.False(filter("GetBlock"))
+	assert.False(filter("GetAccount"))
+}
@@ -361,6 +361,8 @@ const (
 	MessageIDInvResponse
 	MessageIDDataRequest
 	MessageIDDataResponse
+	MessageIDSnapshotRequest
+	MessageIDSnapshotResponse
 )
 
 // ChannelIDEnum defines the channelID for different type of data for synchronization among blockchain nodes
@@ -409,6 +411,12 @@ const (
 
 	// ChannelIDAggregatedEliteEdgeNodeVotes indicates the channel for Elite Edge Node aggregated vote messages
 	ChannelIDAggregatedEliteEdgeNodeVotes
+
+	// ChannelIDSnapshot indicates the channel for snapshot state sync messages
+	ChannelIDSnapshot
+
+	// ChannelIDEvidence indicates the channel for the evidence of validator misbehaviors
+	ChannelIDEvidence
 )
 
 // P2POptEnum defines the p2p network
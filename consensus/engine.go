@@ -33,6 +33,7 @@ type ConsensusEngine struct {
 	logger *log.Entry
 
 	privateKey *crypto.PrivateKey
+	signer     core.Signer
 
 	chain            *blockchain.Chain
 	dispatcher       *dispatcher.Dispatcher
@@ -59,6 +60,14 @@ type ConsensusEngine struct {
 	voteTimerReady bool
 	blockProcessed bool
 
+	pacemaker *Pacemaker
+	eventBus  *EventBus
+
+	// The clock and the delivery of the node's own messages, replaced by the simulation to run
+	// the engine deterministically.
+	clock    func() time.Time
+	loopback func(msg interface{})
+
 	state *State
 }
 
@@ -69,6 +78,7 @@ func NewConsensusEngine(privateKey *crypto.PrivateKey, db store.Store, chain *bl
 		dispatcher: dispatcher,
 
 		privateKey: privateKey,
+		signer:     core.NewLocalSigner(privateKey),
 
 		incoming:        make(chan interface{}, viper.GetInt(common.CfgConsensusMessageQueueSize)),
 		finalizedBlocks: make(chan *core.Block, viper.GetInt(common.CfgConsensusMessageQueueSize)),
@@ -82,6 +92,12 @@ func NewConsensusEngine(privateKey *crypto.PrivateKey, db store.Store, chain *bl
 
 		voteTimerReady: false,
 		blockProcessed: false,
+
+		pacemaker: NewPacemaker(time.Duration(viper.GetInt(common.CfgConsensusMaxEpochLength))*time.Second,
+			time.Duration(viper.GetInt(common.CfgConsensusMaxEpochBackoffLength))*time.Second),
+		eventBus: NewEventBus(),
+
+		clock: time.Now,
 	}
 
 	logger = util.GetLoggerForModule("consensus")
@@ -110,7 +126,7 @@ func (e *ConsensusEngine) GetLedger() core.Ledger {
 
 // ID returns the identifier of current node.
 func (e *ConsensusEngine) ID() string {
-	return e.privateKey.PublicKey().Address().Hex()
+	return e.signer.Address().Hex()
 }
 
 // PrivateKey returns the private key
@@ -118,12 +134,33 @@ func (e *ConsensusEngine) PrivateKey() *crypto.PrivateKey {
 	return e.privateKey
 }
 
+// Signer returns the signer of the votes, blocks and transactions of the validator.
+func (e *ConsensusEngine) Signer() core.Signer {
+	return e.signer
+}
+
+// SetSigner replaces the signer of the validator, e.g. with a remote signer. It needs to be
+// called before the engine starts.
+func (e *ConsensusEngine) SetSigner(signer core.Signer) {
+	e.signer = signer
+}
+
 // Chain return a pointer to the underlying chain store.
 func (e *ConsensusEngine) Chain() *blockchain.Chain {
 	return e.chain
 }
 
+// Pacemaker returns the pacemaker setting the epoch timeouts.
+func (e *ConsensusEngine) Pacemaker() *Pacemaker {
+	return e.pacemaker
+}
+
 // GetEpoch returns the current epoch
+// EventBus returns the bus of the consensus events.
+func (e *ConsensusEngine) EventBus() *EventBus {
+	return e.eventBus
+}
+
 func (e *ConsensusEngine) GetEpoch() uint64 {
 	return e.state.GetEpoch()
 }
@@ -254,14 +291,39 @@ func (e *ConsensusEngine) Stop() {
 // Wait blocks until all goroutines stop.
 func (e *ConsensusEngine) Wait() {
 	e.wg.Wait()
+
+	if err := e.state.CloseWAL(); err != nil {
+		e.logger.WithFields(log.Fields{"error": err}).Warn("Failed to close the consensus WAL")
+	}
+}
+
+// OpenWAL recovers the consensus state from the write-ahead log at the path, and logs the
+// state changes to it from then on. It needs to be called before Start.
+func (e *ConsensusEngine) OpenWAL(path string) error {
+	wal, records, err := OpenWAL(path)
+	if err != nil {
+		return err
+	}
+	if err := e.state.RecoverFromWAL(wal, records); err != nil {
+		wal.Close()
+		return fmt.Errorf("Failed to recover the consensus state from the WAL %v: %v", path, err)
+	}
+	e.logger.WithFields(log.Fields{
+		"path":    path,
+		"records": len(records),
+		"state":   e.state,
+	}).Info("Recovered consensus state from the WAL")
+	return nil
 }
 
 func (e *ConsensusEngine) mainLoop() {
 	defer e.wg.Done()
 
 	for {
+		e.mu.Lock()
 		e.enterEpoch()
 		e.propose()
+		e.mu.Unlock()
 	Epoch:
 		for {
 			select {
@@ -269,20 +331,23 @@ func (e *ConsensusEngine) mainLoop() {
 				e.stopped = true
 				return
 			case msg := <-e.incoming:
+				e.mu.Lock()
 				endEpoch := e.processMessage(msg)
+				e.mu.Unlock()
 				if endEpoch {
 					break Epoch
 				}
 			case <-e.voteTimer.C:
-				e.voteTimerReady = true
-				if e.blockProcessed {
-					e.vote()
-				}
+				e.mu.Lock()
+				e.handleVoteTimer()
+				e.mu.Unlock()
 			case <-e.epochTimer.C:
-				e.logger.WithFields(log.Fields{"e.epoch": e.GetEpoch()}).Debug("Epoch timeout. Repeating epoch")
-				e.vote()
+				e.mu.Lock()
+				e.handleEpochTimeout()
+				e.mu.Unlock()
 				break Epoch
 			case <-e.guardianTimer.C:
+				e.mu.Lock()
 				v := e.guardian.GetVoteToBroadcast()
 
 				if v != nil {
@@ -298,28 +363,62 @@ func (e *ConsensusEngine) mainLoop() {
 					e.broadcastAggregatedEliteEdgeNodeVotes(eenv)
 				}
 				e.eliteEdgeNode.StartNewRound()
+				e.mu.Unlock()
 			}
 		}
 	}
 }
 
+// RunExclusive runs fn while the main loop is paused between two events, so that fn can
+// replace the chain and ledger state the engine works on, e.g. by importing a snapshot.
+func (e *ConsensusEngine) RunExclusive(fn func() error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fn()
+}
+
 // enterEpoch is called when engine enters a new epoch.
 func (e *ConsensusEngine) enterEpoch() {
-	logger.Debugf("Enter epoch %v", e.GetEpoch())
+	epochTimeout := e.resetEpoch()
 
 	// Reset timers.
 	if e.epochTimer != nil {
 		e.epochTimer.Stop()
 	}
-	e.epochTimer = time.NewTimer(time.Duration(viper.GetInt(common.CfgConsensusMaxEpochLength)) * time.Second)
+	e.epochTimer = time.NewTimer(epochTimeout)
 
 	if e.voteTimer != nil {
 		e.voteTimer.Stop()
 	}
 	e.voteTimer = time.NewTimer(time.Duration(viper.GetInt(common.CfgConsensusMinBlockInterval)) * time.Second)
+}
+
+// resetEpoch resets the progress of the epoch, and returns its timeout.
+func (e *ConsensusEngine) resetEpoch() time.Duration {
+	logger.Debugf("Enter epoch %v", e.GetEpoch())
 
 	e.voteTimerReady = false
 	e.blockProcessed = false
+	return e.pacemaker.EnterEpoch()
+}
+
+// handleVoteTimer is called once the minimal block interval has passed in the epoch.
+func (e *ConsensusEngine) handleVoteTimer() {
+	e.voteTimerReady = true
+	if e.blockProcessed {
+		e.vote()
+	}
+}
+
+// handleEpochTimeout is called when the epoch times out, before the epoch is repeated.
+func (e *ConsensusEngine) handleEpochTimeout() {
+	e.pacemaker.OnTimeout(e.GetEpoch())
+	e.logger.WithFields(log.Fields{
+		"e.epoch":             e.GetEpoch(),
+		"consecutiveTimeouts": e.pacemaker.ConsecutiveTimeouts(),
+		"nextTimeout":         e.pacemaker.Timeout(),
+	}).Debug("Epoch timeout. Repeating epoch")
+	e.vote()
 }
 
 // GetChannelIDs implements the p2p.MessageHandler interface.
@@ -336,6 +435,18 @@ func (e *ConsensusEngine) AddMessage(msg interface{}) {
 	e.incoming <- msg
 }
 
+// addOwnMessage adds a message of the node itself to the message queue, without blocking the
+// main loop.
+func (e *ConsensusEngine) addOwnMessage(msg interface{}) {
+	if e.loopback != nil {
+		e.loopback(msg)
+		return
+	}
+	go func() {
+		e.AddMessage(msg)
+	}()
+}
+
 func (e *ConsensusEngine) processMessage(msg interface{}) (endEpoch bool) {
 	switch m := msg.(type) {
 	case core.Vote:
@@ -357,6 +468,8 @@ func (e *ConsensusEngine) processMessage(msg interface{}) (endEpoch bool) {
 	case *core.AggregatedEENVotes:
 		// e.logger.WithFields(log.Fields{"aggregated elite edge node vote": m}).Debug("Received agggregated elite edge node vote")
 		e.handleAggregatedEliteEdgeNodeVote(m)
+	case *core.Evidence:
+		e.handleEvidence(m)
 	default:
 		// Should not happen.
 		log.Errorf("Unknown message type: %v", m)
@@ -741,6 +854,10 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 	}
 	validateBlockTime := time.Since(start1)
 
+	if evidence := e.chain.DetectDuplicateProposal(block.BlockHeader); evidence != nil {
+		e.handleEvidence(evidence)
+	}
+
 	for _, vote := range block.HCC.Votes.Votes() {
 		e.handleVote(vote)
 	}
@@ -789,6 +906,7 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 	}
 
 	e.chain.MarkBlockValid(block.Hash())
+	e.eventBus.Publish(Event{Type: EventNewProposal, Epoch: e.GetEpoch(), Block: eb})
 
 	// Skip voting for block older than current best known epoch.
 	// Allow block with one epoch behind since votes are processed first and might advance epoch
@@ -820,7 +938,7 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 }
 
 func (e *ConsensusEngine) shouldVote(block common.Hash) bool {
-	return e.shouldVoteByID(e.privateKey.PublicKey().Address(), block)
+	return e.shouldVoteByID(e.signer.Address(), block)
 }
 
 func (e *ConsensusEngine) shouldVoteByID(id common.Address, block common.Hash) bool {
@@ -865,19 +983,29 @@ func (e *ConsensusEngine) vote() {
 			log.Panic(err)
 		}
 		// Recreating vote so that it has updated epoch and signature.
-		vote = e.createVote(block.Block)
+		vote, err = e.createVote(block.Block)
+		if err != nil {
+			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to sign vote")
+			return
+		}
 	} else {
-		vote = e.createVote(tip.Block)
-		e.state.SetLastVote(vote)
+		var err error
+		vote, err = e.createVote(tip.Block)
+		if err != nil {
+			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to sign vote")
+			return
+		}
+		if err := e.state.SetLastVote(vote); err != nil {
+			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to save vote")
+			return
+		}
 	}
 	e.logger.WithFields(log.Fields{
 		"vote": vote,
 	}).Debug("Sending vote")
 	e.broadcastVote(vote)
 
-	go func() {
-		e.AddMessage(vote)
-	}()
+	e.addOwnMessage(vote)
 }
 
 func (e *ConsensusEngine) broadcastVote(vote core.Vote) {
@@ -893,15 +1021,17 @@ func (e *ConsensusEngine) broadcastVote(vote core.Vote) {
 	e.dispatcher.SendData([]string{}, voteMsg)
 }
 
-func (e *ConsensusEngine) createVote(block *core.Block) core.Vote {
+func (e *ConsensusEngine) createVote(block *core.Block) (core.Vote, error) {
 	vote := core.Vote{
 		Block:  block.Hash(),
 		Height: block.Height,
-		ID:     e.privateKey.PublicKey().Address(),
+		ID:     e.signer.Address(),
 		Epoch:  e.GetEpoch(),
 	}
-	vote.Sign(e.privateKey)
-	return vote
+	if err := e.signer.SignVote(&vote); err != nil {
+		return core.Vote{}, err
+	}
+	return vote, nil
 }
 
 func (e *ConsensusEngine) validateVote(vote core.Vote) bool {
@@ -920,6 +1050,10 @@ func (e *ConsensusEngine) handleVote(vote core.Vote) (endEpoch bool) {
 		return
 	}
 
+	if evidence := e.chain.DetectDuplicateVote(vote); evidence != nil {
+		e.handleEvidence(evidence)
+	}
+
 	// Save vote.
 	err := e.state.AddVote(&vote)
 	if err != nil {
@@ -961,6 +1095,8 @@ func (e *ConsensusEngine) handleVote(vote core.Vote) (endEpoch bool) {
 				"expectedProposer": expectedProposer.ID().Hex(),
 			}).Debug("Majority votes for current epoch. Moving to new epoch")
 			e.state.SetEpoch(nextEpoch)
+			e.pacemaker.OnProgress()
+			e.eventBus.Publish(Event{Type: EventEpochChange, Epoch: nextEpoch, Votes: currentEpochVotes})
 
 			e.checkSyncStatus()
 		}
@@ -1092,6 +1228,43 @@ func (e *ConsensusEngine) broadcastAggregatedEliteEdgeNodeVotes(vote *core.Aggre
 	e.dispatcher.SendData([]string{}, voteMsg)
 }
 
+// handleEvidence stores the evidence of a validator misbehavior, and gossips it the first time.
+func (e *ConsensusEngine) handleEvidence(evidence *core.Evidence) {
+	if res := evidence.Validate(e.chain.ChainID); res.IsError() {
+		e.logger.WithFields(log.Fields{
+			"evidence": evidence,
+			"error":    res.String(),
+		}).Warn("Ignoring invalid evidence")
+		return
+	}
+	added, err := e.chain.AddEvidence(evidence)
+	if err != nil {
+		e.logger.WithFields(log.Fields{"evidence": evidence, "error": err}).Error("Failed to save evidence")
+		return
+	}
+	if !added {
+		return
+	}
+	e.logger.WithFields(log.Fields{
+		"evidence": evidence,
+		"hash":     evidence.Hash().Hex(),
+	}).Warn("Validator misbehavior detected")
+	e.broadcastEvidence(evidence)
+}
+
+func (e *ConsensusEngine) broadcastEvidence(evidence *core.Evidence) {
+	payload, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		e.logger.WithFields(log.Fields{"evidence": evidence}).Error("Failed to encode evidence")
+		return
+	}
+	evidenceMsg := dispatcher.DataResponse{
+		ChannelID: common.ChannelIDEvidence,
+		Payload:   payload,
+	}
+	e.dispatcher.SendData([]string{}, evidenceMsg)
+}
+
 // GetSummary returns a summary of consensus state.
 func (e *ConsensusEngine) GetSummary() *StateStub {
 	return e.state.GetSummary()
@@ -1129,6 +1302,12 @@ func (e *ConsensusEngine) processCCBlock(ccBlock *core.ExtendedBlock) {
 	e.logger.WithFields(log.Fields{"ccBlock.Hash": ccBlock.Hash().Hex(), "c.epoch": e.state.GetEpoch()}).Debug("Updating highestCCBlock")
 	e.state.SetHighestCCBlock(ccBlock)
 	e.chain.CommitBlock(ccBlock.Hash())
+	e.eventBus.Publish(Event{
+		Type:  EventVoteQuorum,
+		Epoch: e.GetEpoch(),
+		Block: ccBlock,
+		Votes: e.chain.FindVotesByHash(ccBlock.Hash()).UniqueVoter(),
+	})
 }
 
 func (e *ConsensusEngine) finalizeBlock(block *core.ExtendedBlock) error {
@@ -1137,7 +1316,8 @@ func (e *ConsensusEngine) finalizeBlock(block *core.ExtendedBlock) error {
 	}
 
 	// Skip blocks that have already published.
-	if block.Hash() == e.state.GetLastFinalizedBlock().Hash() {
+	lastFinalized := e.state.GetLastFinalizedBlock()
+	if block.Hash() == lastFinalized.Hash() {
 		return nil
 	}
 
@@ -1152,10 +1332,9 @@ func (e *ConsensusEngine) finalizeBlock(block *core.ExtendedBlock) error {
 	if err := e.chain.FinalizePreviousBlocks(block.Hash()); err != nil {
 		return err
 	}
-
-	// Force update TX index on block finalization so that the index doesn't point to
-	// duplicate TX in fork.
-	e.chain.AddTxsToIndex(block, true)
+	if e.chain.RecordsBlockMetadata() {
+		e.recordBlockMetadata(block, lastFinalized.Height)
+	}
 
 	// Guardians and Elite Edge Nodes to vote for checkpoint blocks.
 	if common.IsCheckPointHeight(block.Height) {
@@ -1170,9 +1349,41 @@ func (e *ConsensusEngine) finalizeBlock(block *core.ExtendedBlock) error {
 	default:
 		e.logger.Warnf("Failed to notify finalized block, height=%v", block.Height)
 	}
+	e.eventBus.Publish(Event{Type: EventBlockFinalized, Epoch: e.GetEpoch(), Block: block})
 	return nil
 }
 
+// recordBlockMetadata records the metadata of the newly finalized blocks, from the block down to
+// the previous last finalized block.
+func (e *ConsensusEngine) recordBlockMetadata(block *core.ExtendedBlock, lastFinalizedHeight uint64) {
+	for block.Height > lastFinalizedHeight {
+		hash := block.Hash()
+		votes := e.chain.FindVotesByHash(hash)
+		// The votes in the commit certificates of the children are counted too, the node might
+		// not have received them directly.
+		for _, childHash := range block.Children {
+			child, err := e.chain.FindBlock(childHash)
+			if err != nil || child.HCC.BlockHash != hash || child.HCC.Votes == nil {
+				continue
+			}
+			for _, vote := range child.HCC.Votes.Votes() {
+				votes.AddVote(vote)
+			}
+		}
+		validators := e.validatorManager.GetValidatorSet(hash)
+		metadata := blockchain.NewBlockMetadata(block.Block, validators, votes)
+		if err := e.chain.SaveBlockMetadata(hash, metadata); err != nil {
+			e.logger.WithFields(log.Fields{"block.Hash": hash.Hex(), "error": err}).Warn("Failed to save the block metadata")
+		}
+
+		parent, err := e.chain.FindBlock(block.Parent)
+		if err != nil {
+			return
+		}
+		block = parent
+	}
+}
+
 func (e *ConsensusEngine) shouldPropose(tip *core.ExtendedBlock, epoch uint64) bool {
 	if epoch <= tip.Epoch {
 		e.logger.WithFields(log.Fields{
@@ -1254,8 +1465,8 @@ func (e *ConsensusEngine) createProposal(shouldIncludeValidatorUpdateTxs bool) (
 	block.Epoch = e.GetEpoch()
 	block.Parent = tip.Hash()
 	block.Height = tip.Height + 1
-	block.Proposer = e.privateKey.PublicKey().Address()
-	block.Timestamp = big.NewInt(time.Now().Unix())
+	block.Proposer = e.signer.Address()
+	block.Timestamp = big.NewInt(e.clock().Unix())
 	block.HCC.BlockHash = e.state.GetHighestCCBlock().Hash()
 	hccValidators := e.validatorManager.GetValidatorSet(block.HCC.BlockHash)
 	block.HCC.Votes = e.chain.FindVotesByHash(block.HCC.BlockHash).UniqueVoter().FilterByValidators(hccValidators)
@@ -1280,11 +1491,9 @@ func (e *ConsensusEngine) createProposal(shouldIncludeValidatorUpdateTxs bool) (
 	block.StateHash = newRoot
 
 	// Sign block.
-	sig, err := e.privateKey.Sign(block.SignBytes())
-	if err != nil {
-		e.logger.WithFields(log.Fields{"error": err}).Panic("Failed to sign vote")
+	if err := e.signer.SignBlock(block.BlockHeader); err != nil {
+		return core.Proposal{}, fmt.Errorf("Failed to sign block: %v", err)
 	}
-	block.SetSignature(sig)
 
 	proposal := core.Proposal{
 		Block:      block,
@@ -1327,7 +1536,11 @@ func (e *ConsensusEngine) propose() {
 			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to create proposal")
 			return
 		}
-		e.state.LastProposal = proposal
+		// The proposal is logged before it is sent, so it is repeated after a crash.
+		if err = e.state.SetLastProposal(proposal); err != nil {
+			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to save proposal")
+			return
+		}
 
 		_, err = e.chain.AddBlock(proposal.Block)
 		if err != nil {
@@ -1348,31 +1561,28 @@ func (e *ConsensusEngine) propose() {
 	}
 	e.dispatcher.SendData([]string{}, proposalMsg)
 
-	go func() {
-		e.AddMessage(proposal.Block)
-	}()
+	e.addOwnMessage(proposal.Block)
 }
 
 func (e *ConsensusEngine) pruneState(currentBlockHeight uint64) {
-	// Permanently disabled
-	return
-
-	// if !viper.GetBool(common.CfgStorageStatePruningEnabled) {
-	// 	return
-	// }
+	if !viper.GetBool(common.CfgStorageStatePruningEnabled) {
+		return
+	}
 
-	// pruneInterval := uint64(viper.GetInt(common.CfgStorageStatePruningInterval))
-	// if currentBlockHeight%pruneInterval != 0 {
-	// 	return
-	// }
+	pruneInterval := uint64(viper.GetInt(common.CfgStorageStatePruningInterval))
+	if pruneInterval > 0 && currentBlockHeight%pruneInterval != 0 {
+		return
+	}
 
-	// minimumNumBlocksToRetain := uint64(viper.GetInt(common.CfgStorageStatePruningRetainedBlocks))
-	// if currentBlockHeight <= minimumNumBlocksToRetain+1 {
-	// 	return
-	// }
+	// Retain the states of the latest finalized blocks
+	minimumNumBlocksToRetain := uint64(viper.GetInt(common.CfgStorageStatePruningRetainedBlocks))
+	lastFinalizedHeight := e.GetLastFinalizedBlock().Height
+	if lastFinalizedHeight <= minimumNumBlocksToRetain+1 {
+		return
+	}
 
-	// endHeight := currentBlockHeight - minimumNumBlocksToRetain
-	// e.ledger.PruneState(endHeight)
+	endHeight := lastFinalizedHeight - minimumNumBlocksToRetain
+	e.ledger.PruneState(endHeight)
 }
 
 func (e *ConsensusEngine) State() *State {
@@ -0,0 +1,154 @@
+package consensus
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/core"
+)
+
+var (
+	eventPublishedCounter = metrics.NewRegisteredCounter("consensus/events/published", nil)
+	eventDroppedCounter   = metrics.NewRegisteredCounter("consensus/events/dropped", nil) // Subscriber buffer full.
+)
+
+// EventType is the type of a consensus event.
+type EventType byte
+
+const (
+	// EventNewProposal is published when a valid proposed block is processed.
+	EventNewProposal EventType = iota + 1
+	// EventVoteQuorum is published when a block gathers the votes of a majority of the validators.
+	EventVoteQuorum
+	// EventBlockFinalized is published when a block is directly finalized.
+	EventBlockFinalized
+	// EventEpochChange is published when the engine moves to a new epoch.
+	EventEpochChange
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNewProposal:
+		return "new-proposal"
+	case EventVoteQuorum:
+		return "vote-quorum"
+	case EventBlockFinalized:
+		return "block-finalized"
+	case EventEpochChange:
+		return "epoch-change"
+	default:
+		return fmt.Sprintf("unknown(%d)", t)
+	}
+}
+
+// Event is a consensus event. The fields not relevant to its type are left empty.
+type Event struct {
+	Type  EventType
+	Epoch uint64              // epoch of the engine, the new one for an epoch change
+	Block *core.ExtendedBlock // block proposed, reaching the quorum, or finalized
+	Votes *core.VoteSet       // votes of the quorum, for the block or the epoch
+}
+
+func (ev Event) String() string {
+	block := "nil"
+	if ev.Block != nil {
+		block = fmt.Sprintf("%v@%v", ev.Block.Hash().Hex(), ev.Block.Height)
+	}
+	return fmt.Sprintf("Event{type: %v, epoch: %v, block: %v}", ev.Type, ev.Epoch, block)
+}
+
+// EventBus delivers the consensus events to the subscribers. Publishing never blocks the
+// engine: an event is dropped for the subscribers whose buffer is full.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[*EventSubscription]struct{}
+}
+
+// NewEventBus creates an event bus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription to the events of the given types, or of all types if none
+// is given, buffering up to bufferSize events.
+func (b *EventBus) Subscribe(bufferSize int, types ...EventType) *EventSubscription {
+	sub := &EventSubscription{
+		bus:    b,
+		events: make(chan Event, bufferSize),
+	}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers the event to the subscribers of its type.
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	eventPublishedCounter.Inc(1)
+	for sub := range b.subscribers {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+			eventDroppedCounter.Inc(1)
+		}
+	}
+}
+
+// NumSubscribers returns the number of active subscriptions.
+func (b *EventBus) NumSubscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers)
+}
+
+func (b *EventBus) unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// EventSubscription receives the events of a subscriber.
+type EventSubscription struct {
+	dropped uint64 // first for the 64-bit alignment of the atomic operations
+
+	bus    *EventBus
+	types  map[EventType]bool // nil for all types
+	events chan Event
+}
+
+// Events returns the channel of the events, closed once unsubscribed.
+func (s *EventSubscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped as the buffer was full.
+func (s *EventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops the delivery of the events and closes the channel.
+func (s *EventSubscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
@@ -0,0 +1,73 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestEventBus(t *testing.T) {
+	assert := assert.New(t)
+
+	bus := NewEventBus()
+	all := bus.Subscribe(10)
+	finalized := bus.Subscribe(1, EventBlockFinalized)
+	assert.Equal(2, bus.NumSubscribers())
+
+	bus.Publish(Event{Type: EventEpochChange, Epoch: 2})
+	bus.Publish(Event{Type: EventBlockFinalized, Epoch: 2, Block: &core.ExtendedBlock{Block: core.NewBlock()}})
+	bus.Publish(Event{Type: EventBlockFinalized, Epoch: 3, Block: &core.ExtendedBlock{Block: core.NewBlock()}})
+
+	assert.Equal(3, len(all.Events()))
+	assert.Equal(EventEpochChange, (<-all.Events()).Type)
+	assert.Equal(uint64(0), all.Dropped())
+
+	// The second finalization does not fit the buffer.
+	assert.Equal(1, len(finalized.Events()))
+	assert.Equal(uint64(2), (<-finalized.Events()).Epoch)
+	assert.Equal(uint64(1), finalized.Dropped())
+
+	finalized.Unsubscribe()
+	finalized.Unsubscribe()
+	_, ok := <-finalized.Events()
+	assert.False(ok)
+	assert.Equal(1, bus.NumSubscribers())
+	bus.Publish(Event{Type: EventBlockFinalized})
+	assert.Equal(3, len(all.Events()))
+}
+
+func TestEngineEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sim := newTestSimulation(t, DefaultSimulationConfig())
+	defer sim.Stop()
+	sub := sim.Nodes[0].Engine.EventBus().Subscribe(4096)
+	require.True(sim.RunUntil(func() bool { return sim.Nodes[0].LastFinalizedHeight() >= 3 }, 5*time.Minute))
+	sub.Unsubscribe()
+
+	counts := make(map[EventType]int)
+	lastEpoch := uint64(0)
+	finalizedHeights := []uint64{}
+	for event := range sub.Events() {
+		counts[event.Type]++
+		switch event.Type {
+		case EventEpochChange:
+			assert.True(event.Epoch > lastEpoch)
+			lastEpoch = event.Epoch
+		case EventBlockFinalized:
+			finalizedHeights = append(finalizedHeights, event.Block.Height)
+		case EventVoteQuorum:
+			assert.NotNil(event.Votes)
+		}
+	}
+	assert.True(counts[EventNewProposal] >= 3)
+	assert.True(counts[EventVoteQuorum] >= 3)
+	assert.True(counts[EventEpochChange] >= 3)
+	require.True(len(finalizedHeights) > 0)
+	assert.Equal(sim.Nodes[0].LastFinalizedHeight(), finalizedHeights[len(finalizedHeights)-1])
+	assert.Equal(uint64(0), sub.Dropped())
+}
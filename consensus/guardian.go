@@ -2,21 +2,45 @@ package consensus
 
 import (
 	"context"
+	"runtime"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/metrics"
 	"github.com/thetatoken/theta/common/util"
 	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/crypto/bls"
+	"github.com/thetatoken/theta/rlp"
 )
 
 const (
 	maxLogNeighbors uint32 = 3 // Estimated number of neighbors during gossip = 2**3 = 8
 	maxRound               = 10
+
+	// maxSeenGuardianVotes is the number of distinct guardian votes remembered per block to skip
+	// their duplicates.
+	maxSeenGuardianVotes = 1 << 16
+)
+
+var (
+	guardianVoteReceivedCounter  = metrics.NewRegisteredCounter("consensus/guardian/votes/received", nil)
+	guardianVoteDroppedCounter   = metrics.NewRegisteredCounter("consensus/guardian/votes/dropped", nil)   // Queue full.
+	guardianVoteDuplicateCounter = metrics.NewRegisteredCounter("consensus/guardian/votes/duplicate", nil) // Seen before, or adding no signer.
+	guardianVoteInvalidCounter   = metrics.NewRegisteredCounter("consensus/guardian/votes/invalid", nil)
+	guardianVoteMergedCounter    = metrics.NewRegisteredCounter("consensus/guardian/votes/merged", nil)
 )
 
+// guardianVoteTask is a guardian vote to verify, along with the voting state it was accepted in.
+type guardianVoteTask struct {
+	vote    *core.AggregatedVotes
+	block   common.Hash
+	gcp     *core.GuardianCandidatePool
+	gcpHash common.Hash
+}
+
 type GuardianEngine struct {
 	logger *log.Entry
 
@@ -32,8 +56,12 @@ type GuardianEngine struct {
 	gcpHash     common.Hash
 	signerIndex int // Signer's index in current gcp
 
-	incoming chan *core.AggregatedVotes
-	mu       *sync.Mutex
+	// Votes are screened and deduplicated in order, then their signatures are verified by a pool
+	// of workers, and the valid ones are aggregated.
+	incoming  chan *core.AggregatedVotes
+	verifying chan *guardianVoteTask
+	seen      map[common.Hash]struct{} // Hashes of the votes received for the current block.
+	mu        *sync.Mutex
 }
 
 func NewGuardianEngine(c *ConsensusEngine, privateKey *bls.SecretKey) *GuardianEngine {
@@ -42,8 +70,10 @@ func NewGuardianEngine(c *ConsensusEngine, privateKey *bls.SecretKey) *GuardianE
 		engine:  c,
 		privKey: privateKey,
 
-		incoming: make(chan *core.AggregatedVotes, viper.GetInt(common.CfgConsensusMessageQueueSize)),
-		mu:       &sync.Mutex{},
+		incoming:  make(chan *core.AggregatedVotes, viper.GetInt(common.CfgGuardianVoteQueueSize)),
+		verifying: make(chan *guardianVoteTask, viper.GetInt(common.CfgGuardianVoteQueueSize)),
+		seen:      make(map[common.Hash]struct{}),
+		mu:        &sync.Mutex{},
 	}
 }
 
@@ -59,6 +89,7 @@ func (g *GuardianEngine) StartNewBlock(block common.Hash) {
 	g.nextVote = nil
 	g.currVote = nil
 	g.round = 1
+	g.seen = make(map[common.Hash]struct{})
 
 	gcp, err := g.engine.GetLedger().GetGuardianCandidatePool(block)
 	if err != nil {
@@ -113,6 +144,13 @@ func (g *GuardianEngine) GetBestVote() *core.AggregatedVotes {
 }
 
 func (g *GuardianEngine) Start(ctx context.Context) {
+	numWorkers := viper.GetInt(common.CfgGuardianVoteWorkers)
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	for i := 0; i < numWorkers; i++ {
+		go g.verifyLoop(ctx)
+	}
 	go g.mainLoop(ctx)
 }
 
@@ -122,23 +160,134 @@ func (g *GuardianEngine) mainLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case vote, ok := <-g.incoming:
-			if ok {
-				g.processVote(vote)
+			if !ok {
+				continue
+			}
+			task, ok := g.screenVote(vote)
+			if !ok {
+				continue
+			}
+			select {
+			case g.verifying <- task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (g *GuardianEngine) verifyLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-g.verifying:
+			if g.verifyVote(task) {
+				g.aggregateVote(task)
 			}
 		}
 	}
 }
 
+// processVote handles a vote synchronously.
 func (g *GuardianEngine) processVote(vote *core.AggregatedVotes) {
+	task, ok := g.screenVote(vote)
+	if !ok {
+		return
+	}
+	if g.verifyVote(task) {
+		g.aggregateVote(task)
+	}
+}
+
+// screenVote runs the cheap checks of the vote, and skips the votes already received and the ones
+// that would add no signer, before their signatures are verified.
+func (g *GuardianEngine) screenVote(vote *core.AggregatedVotes) (*guardianVoteTask, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.checkVote(vote) {
+		return nil, false
+	}
+
+	hash, err := guardianVoteHash(vote)
+	if err != nil {
+		return nil, false
+	}
+	if _, ok := g.seen[hash]; ok {
+		guardianVoteDuplicateCounter.Inc(1)
+		return nil, false
+	}
+	if len(g.seen) < maxSeenGuardianVotes {
+		g.seen[hash] = struct{}{}
+	}
+
+	if g.nextVote != nil && !g.mayImprove(vote) {
+		guardianVoteDuplicateCounter.Inc(1)
+		g.logger.WithFields(log.Fields{
+			"vote.block":     vote.Block.Hex(),
+			"vote.Mutiplies": vote.Multiplies,
+		}).Debug("Skipping vote: no new index")
+		return nil, false
+	}
+
+	return &guardianVoteTask{
+		vote:    vote,
+		block:   g.block,
+		gcp:     g.gcp,
+		gcpHash: g.gcpHash,
+	}, true
+}
+
+// mayImprove returns whether the vote can improve the next vote, i.e. has more signers when passed
+// through, or a signer the next vote misses when merged.
+func (g *GuardianEngine) mayImprove(vote *core.AggregatedVotes) bool {
+	if len(vote.Multiplies) != len(g.nextVote.Multiplies) {
+		return true // Left to the validation.
+	}
+	if !g.isGuardian() && viper.GetBool(common.CfgConsensusPassThroughGuardianVote) {
+		return vote.Abs() > g.nextVote.Abs()
+	}
+	for i, m := range vote.Multiplies {
+		if m != 0 && g.nextVote.Multiplies[i] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyVote verifies the signature of the vote, without holding the lock.
+func (g *GuardianEngine) verifyVote(task *guardianVoteTask) bool {
+	if result := task.vote.Validate(task.gcp); result.IsError() {
+		guardianVoteInvalidCounter.Inc(1)
+		g.logger.WithFields(log.Fields{
+			"vote.block":     task.vote.Block.Hex(),
+			"vote.Mutiplies": task.vote.Multiplies,
+			"vote.gcp":       task.vote.Gcp.Hex(),
+			"error":          result.Message,
+		}).Debug("Ignoring guardian vote: invalid vote")
+		return false
+	}
+	return true
+}
+
+// aggregateVote adds the verified vote to the next vote, unless the block changed meanwhile.
+func (g *GuardianEngine) aggregateVote(task *guardianVoteTask) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	if !g.validateVote(vote) {
+	vote := task.vote
+	if task.block != g.block || task.gcpHash != g.gcpHash {
+		g.logger.WithFields(log.Fields{
+			"local.block": g.block.Hex(),
+			"vote.block":  vote.Block.Hex(),
+		}).Debug("Ignoring guardian vote: local candidate changed")
 		return
 	}
 
 	if g.nextVote == nil {
 		g.nextVote = vote
+		guardianVoteMergedCounter.Inc(1)
 		return
 	}
 
@@ -204,6 +353,7 @@ func (g *GuardianEngine) processVote(vote *core.AggregatedVotes) {
 	}
 
 	g.nextVote = candidate
+	guardianVoteMergedCounter.Inc(1)
 
 	g.logger.WithFields(log.Fields{
 		"local.block":           g.block.Hex(),
@@ -213,15 +363,18 @@ func (g *GuardianEngine) processVote(vote *core.AggregatedVotes) {
 }
 
 func (g *GuardianEngine) HandleVote(vote *core.AggregatedVotes) {
+	guardianVoteReceivedCounter.Inc(1)
 	select {
 	case g.incoming <- vote:
 		return
 	default:
-		g.logger.Debug("GuardianEngine queue is full, discarding vote: %v", vote)
+		guardianVoteDroppedCounter.Inc(1)
+		g.logger.Debugf("GuardianEngine queue is full, discarding vote: %v", vote)
 	}
 }
 
-func (g *GuardianEngine) validateVote(vote *core.AggregatedVotes) (res bool) {
+// checkVote runs the checks of the vote that do not verify its signature.
+func (g *GuardianEngine) checkVote(vote *core.AggregatedVotes) (res bool) {
 	if g.block.IsEmpty() {
 		g.logger.WithFields(log.Fields{
 			"local.block":    g.block.Hex(),
@@ -262,22 +415,19 @@ func (g *GuardianEngine) validateVote(vote *core.AggregatedVotes) (res bool) {
 		}).Debug("Ignoring guardian vote: mutiplies exceed limit for round")
 		return
 	}
-	if result := vote.Validate(g.gcp); result.IsError() {
-		g.logger.WithFields(log.Fields{
-			"local.block":    g.block.Hex(),
-			"local.round":    g.round,
-			"vote.block":     vote.Block.Hex(),
-			"vote.Mutiplies": vote.Multiplies,
-			"vote.gcp":       vote.Gcp.Hex(),
-			"local.gcp":      g.gcpHash.Hex(),
-			"error":          result.Message,
-		}).Debug("Ignoring guardian vote: invalid vote")
-		return
-	}
 	res = true
 	return
 }
 
+// guardianVoteHash identifies a vote, including its signature.
+func guardianVoteHash(vote *core.AggregatedVotes) (common.Hash, error) {
+	raw, err := rlp.EncodeToBytes(vote)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(raw), nil
+}
+
 func (g *GuardianEngine) checkMultipliesForRound(vote *core.AggregatedVotes, k uint32) bool {
 	// for _, m := range vote.Multiplies {
 	// 	if m > g.maxMultiply(k) {
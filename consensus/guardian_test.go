@@ -1,9 +1,16 @@
 package consensus
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/crypto/bls"
 )
 
 func TestMaxMultiplies(t *testing.T) {
@@ -14,3 +21,103 @@ func TestMaxMultiplies(t *testing.T) {
 	require.Equal(maxNeighbors*maxNeighbors, g.maxMultiply(2))
 
 }
+
+// newTestGuardianVotes creates a guardian pool, and the vote of each guardian on the block.
+func newTestGuardianVotes(block common.Hash, size int) (*core.GuardianCandidatePool, []*core.AggregatedVotes) {
+	pool := core.NewGuardianCandidatePool()
+	sks := make(map[common.Address]*bls.SecretKey)
+	for i := 0; i < size; i++ {
+		_, pub, _ := crypto.GenerateKeyPair()
+		blsKey, _ := bls.RandKey()
+		pool.Add(&core.Guardian{
+			StakeHolder: &core.StakeHolder{
+				Holder: pub.Address(),
+				Stakes: []*core.Stake{&core.Stake{
+					Source:       pub.Address(),
+					Amount:       core.MinGuardianStakeDeposit,
+					ReturnHeight: 99999999999,
+				}},
+			},
+			Pubkey: blsKey.PublicKey(),
+		})
+		sks[pub.Address()] = blsKey
+	}
+	votes := []*core.AggregatedVotes{}
+	for i, g := range pool.WithStake().SortedGuardians {
+		vote := core.NewAggregateVotes(block, pool)
+		vote.Sign(sks[g.Holder], i)
+		votes = append(votes, vote)
+	}
+	return pool, votes
+}
+
+func newTestGuardianEngine(block common.Hash, pool *core.GuardianCandidatePool) *GuardianEngine {
+	g := NewGuardianEngine(nil, nil)
+	g.block = block
+	g.round = 1
+	g.gcp = pool
+	g.gcpHash = pool.Hash()
+	g.signerIndex = -1
+	return g
+}
+
+func TestGuardianVotePipeline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	block := common.HexToHash("0x1234")
+	pool, votes := newTestGuardianVotes(block, 10)
+
+	g := newTestGuardianEngine(block, pool)
+	for _, vote := range votes[:5] {
+		g.processVote(vote)
+	}
+	require.NotNil(g.GetBestVote())
+	assert.Equal(5, g.GetBestVote().Abs())
+	assert.True(g.GetBestVote().Validate(pool).IsOK())
+
+	// Duplicates and votes without a new signer are skipped before their verification.
+	_, ok := g.screenVote(votes[0])
+	assert.False(ok)
+	_, ok = g.screenVote(g.GetBestVote().Copy())
+	assert.False(ok)
+
+	// Invalid votes are not aggregated.
+	forged := votes[6].Copy()
+	forged.Multiplies[6] = 0
+	forged.Multiplies[7] = 1
+	g.processVote(forged)
+	assert.Equal(5, g.GetBestVote().Abs())
+
+	// Votes verified for a previous block are dropped.
+	task, ok := g.screenVote(votes[5])
+	require.True(ok)
+	g.block = common.HexToHash("0x5678")
+	g.aggregateVote(task)
+	g.block = block
+	assert.Equal(5, g.GetBestVote().Abs())
+
+	// The votes are verified in parallel, in any order.
+	g = newTestGuardianEngine(block, pool)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g.Start(ctx)
+	for i := len(votes) - 1; i >= 0; i-- {
+		g.HandleVote(votes[i])
+		g.HandleVote(votes[i])
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if best := g.GetBestVote(); best != nil && best.Abs() == len(votes) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	best := g.GetBestVote()
+	require.NotNil(best)
+	assert.Equal(len(votes), best.Abs())
+	assert.True(best.Validate(pool).IsOK())
+	for _, m := range best.Multiplies {
+		assert.Equal(uint32(1), m)
+	}
+}
@@ -0,0 +1,153 @@
+package consensus
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/common/metrics"
+)
+
+var (
+	epochTimeoutCounter = metrics.NewRegisteredCounter("consensus/epoch/timeouts", nil)
+	epochTimeoutGauge   = metrics.NewRegisteredGauge("consensus/epoch/timeout", nil) // Current epoch timeout in milliseconds.
+)
+
+// maxRecordedTimeoutEpochs is the number of most recent epochs with timeouts that are kept.
+const maxRecordedTimeoutEpochs = 1000
+
+// EpochTimeout is the number of times an epoch timed out.
+type EpochTimeout struct {
+	Epoch    uint64
+	Timeouts uint64
+}
+
+// Pacemaker sets the epoch timeouts. The timeout doubles after each consecutive epoch timeout,
+// up to a maximum, so the validators stay in an epoch long enough to collect the votes during a
+// network partition. It returns to the base timeout as soon as an epoch ends with the votes.
+type Pacemaker struct {
+	mu *sync.Mutex
+
+	baseTimeout time.Duration
+	maxTimeout  time.Duration
+
+	consecutiveTimeouts uint
+	timeout             time.Duration
+	epochStartTime      time.Time
+
+	totalTimeouts uint64
+	epochTimeouts map[uint64]uint64
+}
+
+// NewPacemaker creates a pacemaker with the given base and maximum timeouts. The timeout does
+// not back off if the maximum is not larger than the base.
+func NewPacemaker(baseTimeout time.Duration, maxTimeout time.Duration) *Pacemaker {
+	if maxTimeout < baseTimeout {
+		maxTimeout = baseTimeout
+	}
+	p := &Pacemaker{
+		mu:            &sync.Mutex{},
+		baseTimeout:   baseTimeout,
+		maxTimeout:    maxTimeout,
+		timeout:       baseTimeout,
+		epochTimeouts: make(map[uint64]uint64),
+	}
+	epochTimeoutGauge.Update(int64(p.timeout / time.Millisecond))
+	return p
+}
+
+// EnterEpoch records the start of an epoch, or of its repetition after a timeout, and returns
+// its timeout.
+func (p *Pacemaker) EnterEpoch() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.epochStartTime = time.Now()
+	return p.timeout
+}
+
+// EpochStartTime returns the time the current epoch started, or was last repeated.
+func (p *Pacemaker) EpochStartTime() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.epochStartTime
+}
+
+// Timeout returns the timeout of the current epoch.
+func (p *Pacemaker) Timeout() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.timeout
+}
+
+// OnTimeout records the timeout of the epoch, and backs off the timeout.
+func (p *Pacemaker) OnTimeout(epoch uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.consecutiveTimeouts++
+	p.totalTimeouts++
+	if _, ok := p.epochTimeouts[epoch]; !ok && len(p.epochTimeouts) >= maxRecordedTimeoutEpochs {
+		p.evictOldestEpoch()
+	}
+	p.epochTimeouts[epoch]++
+
+	if p.timeout < p.maxTimeout {
+		p.timeout *= 2
+		if p.timeout > p.maxTimeout {
+			p.timeout = p.maxTimeout
+		}
+	}
+	epochTimeoutCounter.Inc(1)
+	epochTimeoutGauge.Update(int64(p.timeout / time.Millisecond))
+}
+
+// OnProgress resets the timeout once an epoch ends with the votes of the validators.
+func (p *Pacemaker) OnProgress() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.consecutiveTimeouts = 0
+	p.timeout = p.baseTimeout
+	epochTimeoutGauge.Update(int64(p.timeout / time.Millisecond))
+}
+
+// ConsecutiveTimeouts returns the number of epoch timeouts since the last epoch that ended with
+// the votes.
+func (p *Pacemaker) ConsecutiveTimeouts() uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.consecutiveTimeouts
+}
+
+// TotalTimeouts returns the number of epoch timeouts since the start.
+func (p *Pacemaker) TotalTimeouts() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.totalTimeouts
+}
+
+// EpochTimeouts returns the timeouts of the most recent epochs that timed out, from the oldest.
+func (p *Pacemaker) EpochTimeouts() []EpochTimeout {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]EpochTimeout, 0, len(p.epochTimeouts))
+	for epoch, timeouts := range p.epochTimeouts {
+		result = append(result, EpochTimeout{Epoch: epoch, Timeouts: timeouts})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Epoch < result[j].Epoch })
+	return result
+}
+
+func (p *Pacemaker) evictOldestEpoch() {
+	first := true
+	var oldest uint64
+	for epoch := range p.epochTimeouts {
+		if first || epoch < oldest {
+			oldest = epoch
+			first = false
+		}
+	}
+	delete(p.epochTimeouts, oldest)
+}
@@ -0,0 +1,54 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacemakerBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewPacemaker(20*time.Second, 100*time.Second)
+	assert.True(p.EpochStartTime().IsZero())
+	assert.Equal(20*time.Second, p.EnterEpoch())
+	assert.False(p.EpochStartTime().IsZero())
+
+	p.OnTimeout(5)
+	assert.Equal(40*time.Second, p.Timeout())
+	p.OnTimeout(5)
+	assert.Equal(80*time.Second, p.Timeout())
+	p.OnTimeout(5)
+	assert.Equal(100*time.Second, p.Timeout())
+	p.OnTimeout(6)
+	assert.Equal(100*time.Second, p.Timeout())
+	assert.Equal(uint(4), p.ConsecutiveTimeouts())
+
+	// Recovers at once.
+	p.OnProgress()
+	assert.Equal(20*time.Second, p.Timeout())
+	assert.Equal(uint(0), p.ConsecutiveTimeouts())
+
+	p.OnTimeout(9)
+	assert.Equal(uint64(5), p.TotalTimeouts())
+	assert.Equal([]EpochTimeout{{Epoch: 5, Timeouts: 3}, {Epoch: 6, Timeouts: 1}, {Epoch: 9, Timeouts: 1}}, p.EpochTimeouts())
+
+	// No backoff without a larger maximum.
+	p = NewPacemaker(20*time.Second, 0)
+	p.OnTimeout(1)
+	assert.Equal(20*time.Second, p.Timeout())
+}
+
+func TestPacemakerEpochLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewPacemaker(time.Second, time.Second)
+	for epoch := uint64(1); epoch <= maxRecordedTimeoutEpochs+10; epoch++ {
+		p.OnTimeout(epoch)
+	}
+	epochs := p.EpochTimeouts()
+	assert.Equal(maxRecordedTimeoutEpochs, len(epochs))
+	assert.Equal(uint64(11), epochs[0].Epoch)
+	assert.Equal(uint64(maxRecordedTimeoutEpochs+10), p.TotalTimeouts())
+}
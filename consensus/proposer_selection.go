@@ -0,0 +1,169 @@
+package consensus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// ProposerSelector selects the proposer of the block following the given block in an epoch.
+type ProposerSelector interface {
+	SelectProposer(valSet *core.ValidatorSet, blockHash common.Hash, epoch uint64) core.Validator
+}
+
+// NewProposerSelector creates the selector of the strategy set in the genesis. The VRF strategy
+// looks up the parent blocks in the chain.
+func NewProposerSelector(selection *core.ProposerSelection, chain *blockchain.Chain) (ProposerSelector, error) {
+	switch selection.Strategy {
+	case core.ProposerSelectionStake:
+		return &StakeWeightedSelector{}, nil
+	case core.ProposerSelectionStakeBlockHash:
+		return &BlockHashSeededSelector{}, nil
+	case core.ProposerSelectionVRF:
+		return &VRFSelector{chain: chain}, nil
+	case core.ProposerSelectionRoundRobin:
+		return &RoundRobinSelector{}, nil
+	case core.ProposerSelectionFixed:
+		return &FixedSelector{Proposer: selection.FixedProposer}, nil
+	default:
+		return nil, fmt.Errorf("Unknown proposer selection strategy: %v", selection.Strategy)
+	}
+}
+
+//
+// -------------------------------- StakeWeightedSelector ----------------------------------
+//
+var _ ProposerSelector = (*StakeWeightedSelector)(nil)
+
+// StakeWeightedSelector selects a random validator using validator's stake as weight, seeded by
+// the epoch.
+type StakeWeightedSelector struct{}
+
+// SelectProposer implements ProposerSelector interface.
+func (s *StakeWeightedSelector) SelectProposer(valSet *core.ValidatorSet, _ common.Hash, epoch uint64) core.Validator {
+	return selectByStake(valSet, rand.New(rand.NewSource(int64(epoch))))
+}
+
+//
+// -------------------------------- BlockHashSeededSelector ----------------------------------
+//
+var _ ProposerSelector = (*BlockHashSeededSelector)(nil)
+
+// BlockHashSeededSelector selects a random validator using validator's stake as weight, seeded by
+// the hash of the parent block and the epoch. Unlike the epoch, the seed is not known before the
+// parent block is signed, while every node can still verify the selection. The proposer of the
+// parent block can however influence it by varying its block.
+type BlockHashSeededSelector struct{}
+
+// SelectProposer implements ProposerSelector interface.
+func (s *BlockHashSeededSelector) SelectProposer(valSet *core.ValidatorSet, blockHash common.Hash, epoch uint64) core.Validator {
+	return selectBySeed(valSet, blockHash[:], epoch)
+}
+
+//
+// -------------------------------- VRFSelector ----------------------------------
+//
+var _ ProposerSelector = (*VRFSelector)(nil)
+
+// VRFSelector selects a random validator using validator's stake as weight, seeded by the
+// signature of the parent block and the epoch. The signature is the output of a verifiable random
+// function of the parent proposer: no other node can compute it before the block is proposed, and
+// every node verifies it against the proposer address. The genesis and snapshot blocks are not
+// signed, their hash seeds the selection instead.
+type VRFSelector struct {
+	chain *blockchain.Chain
+}
+
+// SelectProposer implements ProposerSelector interface.
+func (s *VRFSelector) SelectProposer(valSet *core.ValidatorSet, blockHash common.Hash, epoch uint64) core.Validator {
+	block, err := s.chain.FindBlock(blockHash)
+	if err != nil {
+		log.Panicf("Failed to find block %v to select the proposer: %v", blockHash.Hex(), err)
+	}
+	if block.Signature == nil || block.Signature.IsEmpty() {
+		return selectBySeed(valSet, blockHash[:], epoch)
+	}
+	return selectBySeed(valSet, block.Signature.ToBytes(), epoch)
+}
+
+//
+// -------------------------------- RoundRobinSelector ----------------------------------
+//
+var _ ProposerSelector = (*RoundRobinSelector)(nil)
+
+// RoundRobinSelector selects the validators in the order of their addresses, one per epoch.
+type RoundRobinSelector struct{}
+
+// SelectProposer implements ProposerSelector interface.
+func (s *RoundRobinSelector) SelectProposer(valSet *core.ValidatorSet, _ common.Hash, epoch uint64) core.Validator {
+	if valSet.Size() == 0 {
+		log.Panic("No validators have been added")
+	}
+	validators := valSet.Validators()
+	return validators[epoch%uint64(len(validators))]
+}
+
+//
+// -------------------------------- FixedSelector ----------------------------------
+//
+var _ ProposerSelector = (*FixedSelector)(nil)
+
+// FixedSelector always selects the given validator, or the first validator if it is not set or
+// not a validator.
+type FixedSelector struct {
+	Proposer common.Address
+}
+
+// SelectProposer implements ProposerSelector interface.
+func (s *FixedSelector) SelectProposer(valSet *core.ValidatorSet, _ common.Hash, _ uint64) core.Validator {
+	if valSet.Size() == 0 {
+		log.Panic("No validators have been added")
+	}
+	if !s.Proposer.IsEmpty() {
+		if v, err := valSet.GetValidator(s.Proposer); err == nil {
+			return v
+		}
+	}
+	return valSet.Validators()[0]
+}
+
+// selectBySeed selects a random validator weighted by stake, seeded by the hash of the seed and
+// the epoch.
+func selectBySeed(valSet *core.ValidatorSet, seed []byte, epoch uint64) core.Validator {
+	var epochBytes [8]byte
+	binary.BigEndian.PutUint64(epochBytes[:], epoch)
+	hash := crypto.Keccak256Hash(seed, epochBytes[:])
+	return selectByStake(valSet, rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(hash[:8])))))
+}
+
+func selectByStake(valSet *core.ValidatorSet, rnd *rand.Rand) core.Validator {
+	if valSet.Size() == 0 {
+		log.Panic("No validators have been added")
+	}
+
+	totalStake := valSet.TotalStake()
+	scalingFactor := new(big.Int).Div(totalStake, common.BigMaxUint32)
+	scalingFactor = new(big.Int).Add(scalingFactor, common.Big1)
+	scaledTotalStake := scaleDown(totalStake, scalingFactor)
+
+	r := randUint64(rnd, scaledTotalStake)
+	curr := uint64(0)
+	validators := valSet.Validators()
+	for _, v := range validators {
+		curr += scaleDown(v.Stake, scalingFactor)
+		if r < curr {
+			return v
+		}
+	}
+
+	// Should not reach here.
+	log.Panic("Failed to randomly select a validator")
+	panic("Should not reach here")
+}
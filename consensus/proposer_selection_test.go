@@ -0,0 +1,113 @@
+package consensus
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestProposerSelection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	valSet := core.NewValidatorSet()
+	valSet.AddValidator(core.NewValidator("0x1", big.NewInt(100)))
+	valSet.AddValidator(core.NewValidator("0x2", big.NewInt(300)))
+	valSet.AddValidator(core.NewValidator("0x3", big.NewInt(600)))
+	validators := valSet.Validators()
+
+	_, err := NewProposerSelector(&core.ProposerSelection{Strategy: "unknown"}, nil)
+	assert.NotNil(err)
+
+	// Round robin.
+	selector, err := NewProposerSelector(&core.ProposerSelection{Strategy: core.ProposerSelectionRoundRobin}, nil)
+	require.Nil(err)
+	for epoch := uint64(0); epoch < 6; epoch++ {
+		assert.Equal(validators[epoch%3].ID(), selector.SelectProposer(valSet, common.Hash{}, epoch).ID())
+	}
+
+	// Fixed.
+	selector, err = NewProposerSelector(&core.ProposerSelection{Strategy: core.ProposerSelectionFixed, FixedProposer: common.HexToAddress("0x2")}, nil)
+	require.Nil(err)
+	assert.Equal(common.HexToAddress("0x2"), selector.SelectProposer(valSet, common.Hash{}, 7).ID())
+	selector, err = NewProposerSelector(&core.ProposerSelection{Strategy: core.ProposerSelectionFixed, FixedProposer: common.HexToAddress("0x9")}, nil)
+	require.Nil(err)
+	assert.Equal(validators[0].ID(), selector.SelectProposer(valSet, common.Hash{}, 7).ID())
+
+	// The stake weighted selections are deterministic, and favor the larger stakes.
+	for _, strategy := range []string{core.ProposerSelectionStake, core.ProposerSelectionStakeBlockHash} {
+		selector, err = NewProposerSelector(&core.ProposerSelection{Strategy: strategy}, nil)
+		require.Nil(err)
+		counts := make(map[common.Address]int)
+		for epoch := uint64(0); epoch < 1000; epoch++ {
+			blockHash := crypto.Keccak256Hash(common.BigToHash(big.NewInt(int64(epoch / 10))).Bytes())
+			proposer := selector.SelectProposer(valSet, blockHash, epoch)
+			assert.Equal(proposer.ID(), selector.SelectProposer(valSet, blockHash, epoch).ID())
+			counts[proposer.ID()]++
+		}
+		assert.True(counts[common.HexToAddress("0x1")] < counts[common.HexToAddress("0x3")], strategy)
+	}
+
+	// The block hash seeded selection depends on the block.
+	selector = &BlockHashSeededSelector{}
+	differs := false
+	for i := uint64(0); i < 20 && !differs; i++ {
+		a := selector.SelectProposer(valSet, crypto.Keccak256Hash(common.BigToHash(big.NewInt(int64(i))).Bytes()), 1)
+		b := selector.SelectProposer(valSet, crypto.Keccak256Hash(common.BigToHash(big.NewInt(int64(i+100))).Bytes()), 1)
+		differs = a.ID() != b.ID()
+	}
+	assert.True(differs)
+}
+
+func TestVRFProposerSelection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	valSet := core.NewValidatorSet()
+	valSet.AddValidator(core.NewValidator("0x1", big.NewInt(100)))
+	valSet.AddValidator(core.NewValidator("0x2", big.NewInt(300)))
+	valSet.AddValidator(core.NewValidator("0x3", big.NewInt(600)))
+
+	genesis := core.NewBlock()
+	genesis.ChainID = "testchain"
+	genesis.Height = core.GenesisBlockHeight
+	chain := blockchain.NewChain(genesis.ChainID, kvstore.NewKVStore(backend.NewMemDatabase()), genesis)
+	selector, err := NewProposerSelector(&core.ProposerSelection{Strategy: core.ProposerSelectionVRF}, chain)
+	require.Nil(err)
+
+	// The genesis block is not signed, its hash seeds the selection.
+	for epoch := uint64(0); epoch < 10; epoch++ {
+		assert.Equal((&BlockHashSeededSelector{}).SelectProposer(valSet, genesis.Hash(), epoch).ID(),
+			selector.SelectProposer(valSet, genesis.Hash(), epoch).ID())
+	}
+
+	// The selection following a signed block depends on its signature, and not on its hash.
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	block := core.NewBlock()
+	block.ChainID = genesis.ChainID
+	block.Height = genesis.Height + 1
+	block.Parent = genesis.Hash()
+	block.Proposer = privKey.PublicKey().Address()
+	block.Signature, err = privKey.Sign(block.SignBytes())
+	require.Nil(err)
+	_, err = chain.AddBlock(block)
+	require.Nil(err)
+
+	counts := make(map[common.Address]int)
+	for epoch := uint64(0); epoch < 1000; epoch++ {
+		proposer := selector.SelectProposer(valSet, block.Hash(), epoch)
+		assert.Equal(proposer.ID(), selector.SelectProposer(valSet, block.Hash(), epoch).ID())
+		assert.Equal(selectBySeed(valSet, block.Signature.ToBytes(), epoch).ID(), proposer.ID())
+		counts[proposer.ID()]++
+	}
+	assert.True(counts[common.HexToAddress("0x1")] < counts[common.HexToAddress("0x3")])
+}
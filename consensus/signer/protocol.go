@@ -0,0 +1,95 @@
+package signer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// The node and the signer process exchange RLP encoded requests and responses, each framed by
+// its length as a 4-byte big endian integer. A connection carries one request at a time.
+
+type requestType byte
+
+const (
+	requestAddress   requestType = iota + 1 // Payload: none. Response: the signer address.
+	requestSignVote                         // Payload: the vote. Response: the signature.
+	requestSignBlock                        // Payload: the block header. Response: the signature.
+	requestSignTx                           // Payload: the sign bytes. Response: the signature.
+)
+
+func (t requestType) String() string {
+	switch t {
+	case requestAddress:
+		return "address"
+	case requestSignVote:
+		return "vote"
+	case requestSignBlock:
+		return "block"
+	case requestSignTx:
+		return "tx"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+type request struct {
+	Type    requestType
+	Payload common.Bytes
+}
+
+type response struct {
+	Payload common.Bytes
+	Error   string
+}
+
+// maxMessageSize limits the size of a message, well above the size of a block header.
+const maxMessageSize = 1 << 20
+
+func writeMessage(w io.Writer, msg interface{}) error {
+	raw, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(raw)))
+	if _, err := w.Write(append(length[:], raw...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readMessage(r io.Reader, msg interface{}) error {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxMessageSize {
+		return fmt.Errorf("Message of %v bytes exceeds the limit of %v bytes", size, maxMessageSize)
+	}
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(raw, msg)
+}
+
+// parseAddress splits a signer address, e.g. tcp://127.0.0.1:26659 or unix:///var/run/signer.sock,
+// into the network and the address to dial or listen on.
+func parseAddress(addr string) (string, string, error) {
+	parts := strings.SplitN(addr, "://", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("Invalid signer address %v, expected tcp://<host>:<port> or unix://<path>", addr)
+	}
+	switch parts[0] {
+	case "tcp", "unix":
+		return parts[0], parts[1], nil
+	default:
+		return "", "", fmt.Errorf("Unsupported network %v of signer address %v", parts[0], addr)
+	}
+}
@@ -0,0 +1,172 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+var _ core.Signer = (*RemoteSigner)(nil)
+
+// RemoteSigner requests the signatures from a signer process, so the validator key is not held
+// in the memory of the node.
+type RemoteSigner struct {
+	network string
+	address string
+	timeout time.Duration
+
+	mu      *sync.Mutex
+	conn    net.Conn
+	signer  common.Address
+	stopped bool
+}
+
+// NewRemoteSigner connects to the signer process at the given address, e.g.
+// tcp://127.0.0.1:26659 or unix:///var/run/signer.sock, and fetches the signer address.
+func NewRemoteSigner(addr string, timeout time.Duration) (*RemoteSigner, error) {
+	network, address, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	rs := &RemoteSigner{
+		network: network,
+		address: address,
+		timeout: timeout,
+		mu:      &sync.Mutex{},
+	}
+	payload, err := rs.request(requestAddress, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the address of signer %v: %v", addr, err)
+	}
+	if len(payload) != common.AddressLength {
+		return nil, fmt.Errorf("Invalid address of signer %v: %v", addr, payload)
+	}
+	rs.signer = common.BytesToAddress(payload)
+	return rs, nil
+}
+
+// Address returns the address of the signer.
+func (rs *RemoteSigner) Address() common.Address {
+	return rs.signer
+}
+
+// SignVote requests the signature of the vote.
+func (rs *RemoteSigner) SignVote(vote *core.Vote) error {
+	raw, err := rlp.EncodeToBytes(vote)
+	if err != nil {
+		return err
+	}
+	sig, err := rs.sign(requestSignVote, raw, vote.SignBytes())
+	if err != nil {
+		return err
+	}
+	vote.SetSignature(sig)
+	return nil
+}
+
+// SignBlock requests the signature of the block header.
+func (rs *RemoteSigner) SignBlock(header *core.BlockHeader) error {
+	raw, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return err
+	}
+	sig, err := rs.sign(requestSignBlock, raw, header.SignBytes())
+	if err != nil {
+		return err
+	}
+	header.SetSignature(sig)
+	return nil
+}
+
+// SignTx requests the signature of the sign bytes of a transaction.
+func (rs *RemoteSigner) SignTx(signBytes common.Bytes) (*crypto.Signature, error) {
+	return rs.sign(requestSignTx, signBytes, signBytes)
+}
+
+// Close closes the connection to the signer process.
+func (rs *RemoteSigner) Close() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.stopped = true
+	rs.closeConn()
+}
+
+// sign requests a signature, and verifies it against the signed message.
+func (rs *RemoteSigner) sign(reqType requestType, payload common.Bytes, msg common.Bytes) (*crypto.Signature, error) {
+	raw, err := rs.request(reqType, payload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.SignatureFromBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %v signature from signer: %v", reqType, err)
+	}
+	if !sig.Verify(msg, rs.signer) {
+		return nil, fmt.Errorf("The %v signature from signer does not match address %v", reqType, rs.signer.Hex())
+	}
+	return sig, nil
+}
+
+// request sends a request and waits for the response. The connection is re-established once
+// if it fails, which is safe since the signer signs an identical request again.
+func (rs *RemoteSigner) request(reqType requestType, payload common.Bytes) (common.Bytes, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.stopped {
+		return nil, errors.New("Remote signer is closed")
+	}
+
+	var resp *response
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		resp, err = rs.roundTrip(&request{Type: reqType, Payload: payload})
+		if err == nil {
+			break
+		}
+		rs.closeConn()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to send %v request to signer: %v", reqType, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("Signer refused %v request: %v", reqType, resp.Error)
+	}
+	return resp.Payload, nil
+}
+
+func (rs *RemoteSigner) roundTrip(req *request) (*response, error) {
+	if rs.conn == nil {
+		conn, err := net.DialTimeout(rs.network, rs.address, rs.timeout)
+		if err != nil {
+			return nil, err
+		}
+		rs.conn = conn
+	}
+	if err := rs.conn.SetDeadline(time.Now().Add(rs.timeout)); err != nil {
+		return nil, err
+	}
+	if err := writeMessage(rs.conn, req); err != nil {
+		return nil, err
+	}
+	resp := &response{}
+	if err := readMessage(rs.conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (rs *RemoteSigner) closeConn() {
+	if rs.conn != nil {
+		rs.conn.Close()
+		rs.conn = nil
+	}
+}
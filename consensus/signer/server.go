@@ -0,0 +1,309 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+var logger = log.WithFields(log.Fields{"prefix": "signer"})
+
+// signState records the last vote and block signed, so the server never signs a conflicting
+// vote or block, even across restarts.
+type signState struct {
+	VoteHeight     uint64
+	VoteBlock      common.Hash
+	BlockEpoch     uint64
+	BlockSignBytes common.Hash // Hash of the sign bytes of the block.
+}
+
+// Server serves the signature requests of a node with a backend signer, e.g. one backed by an
+// HSM. It refuses to sign a vote for another block at the same or a lower height than the last
+// vote, or another block at the same or a lower epoch than the last block.
+type Server struct {
+	backend   core.Signer
+	addr      string
+	statePath string
+
+	mu    *sync.Mutex
+	state *signState
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+
+	// Life cycle
+	wg      *sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+}
+
+// NewServer creates a server listening on the given address, which persists its sign state to
+// the file at statePath.
+func NewServer(backend core.Signer, addr string, statePath string) (*Server, error) {
+	state, err := loadSignState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		backend:   backend,
+		addr:      addr,
+		statePath: statePath,
+		mu:        &sync.Mutex{},
+		state:     state,
+		conns:     make(map[net.Conn]struct{}),
+		wg:        &sync.WaitGroup{},
+	}, nil
+}
+
+func loadSignState(statePath string) (*signState, error) {
+	state := &signState{}
+	raw, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read sign state %v: %v", statePath, err)
+	}
+	if err := rlp.DecodeBytes(raw, state); err != nil {
+		return nil, fmt.Errorf("Failed to decode sign state %v: %v", statePath, err)
+	}
+	return state, nil
+}
+
+func (s *Server) saveSignState(state *signState) error {
+	raw, err := rlp.EncodeToBytes(state)
+	if err != nil {
+		return err
+	}
+	tmpPath := s.statePath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.statePath)
+}
+
+// Start starts to serve the requests.
+func (s *Server) Start(ctx context.Context) error {
+	network, address, err := parseAddress(s.addr)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		// Remove the socket left by an earlier run.
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %v: %v", s.addr, err)
+	}
+	s.listener = listener
+
+	c, cancel := context.WithCancel(ctx)
+	s.ctx = c
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.mainLoop()
+
+	logger.WithFields(log.Fields{"address": s.addr, "signer": s.backend.Address().Hex()}).Info("Signer started")
+	return nil
+}
+
+// Stop notifies all goroutines to stop without blocking.
+func (s *Server) Stop() {
+	s.cancel()
+}
+
+// Wait blocks until all goroutines stop.
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Server) mainLoop() {
+	defer s.wg.Done()
+
+	go func() {
+		<-s.ctx.Done()
+		s.mu.Lock()
+		s.stopped = true
+		s.listener.Close()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			default:
+			}
+			logger.WithFields(log.Fields{"error": err}).Warn("Failed to accept connection")
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		req := &request{}
+		if err := readMessage(conn, req); err != nil {
+			if err != io.EOF {
+				logger.WithFields(log.Fields{"error": err}).Debug("Closing connection")
+			}
+			return
+		}
+		resp := &response{}
+		payload, err := s.handleRequest(req)
+		if err != nil {
+			logger.WithFields(log.Fields{"request": req.Type, "error": err}).Warn("Refused request")
+			resp.Error = err.Error()
+		} else {
+			resp.Payload = payload
+		}
+		if err := writeMessage(conn, resp); err != nil {
+			logger.WithFields(log.Fields{"error": err}).Debug("Closing connection")
+			return
+		}
+	}
+}
+
+func (s *Server) handleRequest(req *request) (common.Bytes, error) {
+	switch req.Type {
+	case requestAddress:
+		addr := s.backend.Address()
+		return addr[:], nil
+	case requestSignVote:
+		vote := core.Vote{}
+		if err := rlp.DecodeBytes(req.Payload, &vote); err != nil {
+			return nil, fmt.Errorf("Failed to decode vote: %v", err)
+		}
+		return s.signVote(vote)
+	case requestSignBlock:
+		header := &core.BlockHeader{}
+		if err := rlp.DecodeBytes(req.Payload, header); err != nil {
+			return nil, fmt.Errorf("Failed to decode block header: %v", err)
+		}
+		return s.signBlock(header)
+	case requestSignTx:
+		sig, err := s.backend.SignTx(req.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return sig.ToBytes(), nil
+	default:
+		return nil, fmt.Errorf("Unknown request type %v", req.Type)
+	}
+}
+
+func (s *Server) signVote(vote core.Vote) (common.Bytes, error) {
+	if vote.ID != s.backend.Address() {
+		return nil, fmt.Errorf("Vote of %v cannot be signed by %v", vote.ID.Hex(), s.backend.Address().Hex())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A vote for the last block again, e.g. in a later epoch, does not conflict.
+	if s.state.VoteHeight != 0 && vote.Height <= s.state.VoteHeight && vote.Block != s.state.VoteBlock {
+		return nil, fmt.Errorf("Vote for block %v at height %v conflicts with the last vote for block %v at height %v",
+			vote.Block.Hex(), vote.Height, s.state.VoteBlock.Hex(), s.state.VoteHeight)
+	}
+	if vote.Height > s.state.VoteHeight {
+		state := *s.state
+		state.VoteHeight = vote.Height
+		state.VoteBlock = vote.Block
+		if err := s.saveSignState(&state); err != nil {
+			return nil, fmt.Errorf("Failed to save sign state: %v", err)
+		}
+		s.state = &state
+	}
+
+	if err := s.backend.SignVote(&vote); err != nil {
+		return nil, err
+	}
+	return vote.Signature.ToBytes(), nil
+}
+
+func (s *Server) signBlock(header *core.BlockHeader) (common.Bytes, error) {
+	if header.Proposer != s.backend.Address() {
+		return nil, fmt.Errorf("Block of %v cannot be signed by %v", header.Proposer.Hex(), s.backend.Address().Hex())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signBytesHash := crypto.Keccak256Hash(header.SignBytes())
+	if s.state.BlockEpoch != 0 && header.Epoch <= s.state.BlockEpoch &&
+		!(header.Epoch == s.state.BlockEpoch && signBytesHash == s.state.BlockSignBytes) {
+		return nil, fmt.Errorf("Block at epoch %v conflicts with the last block at epoch %v",
+			header.Epoch, s.state.BlockEpoch)
+	}
+	if header.Epoch > s.state.BlockEpoch {
+		state := *s.state
+		state.BlockEpoch = header.Epoch
+		state.BlockSignBytes = signBytesHash
+		if err := s.saveSignState(&state); err != nil {
+			return nil, fmt.Errorf("Failed to save sign state: %v", err)
+		}
+		s.state = &state
+	}
+
+	if err := s.backend.SignBlock(header); err != nil {
+		return nil, err
+	}
+	if header.Signature == nil {
+		return nil, errors.New("Backend did not sign the block")
+	}
+	return header.Signature.ToBytes(), nil
+}
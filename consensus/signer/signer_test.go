@@ -0,0 +1,93 @@
+package signer
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "signer")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	address := privKey.PublicKey().Address()
+	addr := "unix://" + path.Join(dir, "signer.sock")
+	statePath := path.Join(dir, "sign_state")
+
+	startServer := func() *Server {
+		server, err := NewServer(core.NewLocalSigner(privKey), addr, statePath)
+		require.Nil(err)
+		require.Nil(server.Start(context.Background()))
+		return server
+	}
+	server := startServer()
+
+	rs, err := NewRemoteSigner(addr, 5*time.Second)
+	require.Nil(err)
+	defer rs.Close()
+	assert.Equal(address, rs.Address())
+
+	// Votes.
+	vote := core.Vote{Block: common.HexToHash("0x1"), Height: 10, Epoch: 3, ID: address}
+	require.Nil(rs.SignVote(&vote))
+	assert.True(vote.Validate().IsOK())
+	again := core.Vote{Block: common.HexToHash("0x1"), Height: 10, Epoch: 4, ID: address}
+	require.Nil(rs.SignVote(&again))
+	assert.True(again.Validate().IsOK())
+	conflicting := core.Vote{Block: common.HexToHash("0x2"), Height: 10, Epoch: 4, ID: address}
+	assert.NotNil(rs.SignVote(&conflicting))
+	other := core.Vote{Block: common.HexToHash("0x3"), Height: 11, Epoch: 4, ID: common.HexToAddress("0x9")}
+	assert.NotNil(rs.SignVote(&other))
+
+	// Blocks.
+	header := &core.BlockHeader{
+		ChainID:   "testchain",
+		Epoch:     5,
+		Height:    11,
+		Parent:    common.HexToHash("0x1"),
+		Timestamp: big.NewInt(1),
+		Proposer:  address,
+	}
+	require.Nil(rs.SignBlock(header))
+	assert.True(header.Signature.Verify(header.SignBytes(), address))
+	require.Nil(rs.SignBlock(header))
+	header2 := *header
+	header2.Timestamp = big.NewInt(2)
+	assert.NotNil(rs.SignBlock(&header2))
+
+	// Transactions.
+	sig, err := rs.SignTx(common.Bytes("tx"))
+	require.Nil(err)
+	assert.True(sig.Verify(common.Bytes("tx"), address))
+
+	// The sign state survives the restarts, and the client reconnects.
+	server.Stop()
+	server.Wait()
+	server = startServer()
+	defer func() {
+		server.Stop()
+		server.Wait()
+	}()
+
+	assert.NotNil(rs.SignVote(&conflicting))
+	assert.NotNil(rs.SignBlock(&header2))
+	next := core.Vote{Block: common.HexToHash("0x2"), Height: 11, Epoch: 6, ID: address}
+	require.Nil(rs.SignVote(&next))
+	assert.True(next.Validate().IsOK())
+}
@@ -0,0 +1,791 @@
+package consensus
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/p2p"
+	p2ptypes "github.com/thetatoken/theta/p2p/types"
+	"github.com/thetatoken/theta/p2pl"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// SimulationChainID is the chain ID of the simulated networks.
+const SimulationChainID = "simchain"
+
+// simulationStartTime is the virtual time the simulations start at, so that the block
+// timestamps do not depend on the wall clock.
+var simulationStartTime = time.Unix(1600000000, 0)
+
+// SimulationConfig configures a simulated network.
+type SimulationConfig struct {
+	NumNodes          int
+	Seed              int64         // Seed of the validator keys, the latencies and the message drops.
+	MinLatency        time.Duration // Minimal latency of a message.
+	MaxLatency        time.Duration // Maximal latency of a message.
+	ProposerSelection string        // Proposer selection strategy, see core.ProposerSelection.
+}
+
+// DefaultSimulationConfig returns the configuration of a network of 4 validators, with latencies
+// between 10 and 100 milliseconds.
+func DefaultSimulationConfig() SimulationConfig {
+	return SimulationConfig{
+		NumNodes:          4,
+		Seed:              1,
+		MinLatency:        10 * time.Millisecond,
+		MaxLatency:        100 * time.Millisecond,
+		ProposerSelection: core.ProposerSelectionStake,
+	}
+}
+
+// Simulation runs a network of in-process consensus engines over a simulated network. Rather
+// than by their main loops and timers, the engines are driven from a single goroutine by a queue
+// of events on a virtual clock, so that a scenario replays identically from the same seed. A
+// Simulation is not safe for concurrent use.
+type Simulation struct {
+	Nodes []*SimNode
+
+	config SimulationConfig
+	rand   *rand.Rand
+	now    time.Duration
+	seq    uint64
+	events simEventQueue
+
+	partitions []int                    // Partition of each node. The nodes in the same partition are connected.
+	latencies  map[[2]int]time.Duration // Fixed latencies of some links, by sender and receiver.
+	dropRate   float64
+
+	Delivered uint64 // Number of messages delivered.
+	Dropped   uint64 // Number of messages lost to partitions, crashes and random drops.
+}
+
+// NewSimulation creates a simulated network of validators with equal stakes, sharing a genesis
+// block. The simulation needs to be started.
+func NewSimulation(config SimulationConfig) (*Simulation, error) {
+	if config.NumNodes <= 0 {
+		return nil, fmt.Errorf("Invalid number of nodes: %v", config.NumNodes)
+	}
+	if config.MaxLatency < config.MinLatency {
+		return nil, fmt.Errorf("Max latency %v is smaller than min latency %v", config.MaxLatency, config.MinLatency)
+	}
+	selection := &core.ProposerSelection{Strategy: config.ProposerSelection}
+	if err := selection.Validate(); err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{
+		config:     config,
+		rand:       rand.New(rand.NewSource(config.Seed)),
+		partitions: make([]int, config.NumNodes),
+		latencies:  make(map[[2]int]time.Duration),
+	}
+
+	privKeys := make([]*crypto.PrivateKey, config.NumNodes)
+	vcp := &core.ValidatorCandidatePool{}
+	for i := range privKeys {
+		seed := crypto.Keccak256([]byte(fmt.Sprintf("simulation/%v/%v", config.Seed, i)))
+		privKey, err := crypto.PrivateKeyFromBytes(seed)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create the key of node %v: %v", i, err)
+		}
+		privKeys[i] = privKey
+		address := privKey.PublicKey().Address()
+		if err := vcp.DepositStake(address, address, core.MinValidatorStakeDeposit); err != nil {
+			return nil, fmt.Errorf("Failed to deposit the stake of node %v: %v", i, err)
+		}
+	}
+
+	genesis := core.NewBlock()
+	genesis.ChainID = SimulationChainID
+	genesis.Height = core.GenesisBlockHeight
+	genesis.Timestamp = big.NewInt(simulationStartTime.Unix())
+
+	for i, privKey := range privKeys {
+		db := kvstore.NewKVStore(backend.NewMemDatabase())
+		chain := blockchain.NewChain(SimulationChainID, db, genesis)
+		selector, err := NewProposerSelector(selection, chain)
+		if err != nil {
+			return nil, err
+		}
+		valMgr := NewRotatingValidatorManager()
+		valMgr.SetProposerSelector(selector)
+		endpoint := &simEndpoint{sim: sim, index: i, id: privKey.PublicKey().Address().Hex()}
+		dispatch := dispatcher.NewDispatcher(endpoint, (*simNoLibp2p)(nil))
+
+		node := &SimNode{
+			Index:   i,
+			PrivKey: privKey,
+			sim:     sim,
+			chain:   chain,
+			orphans: make(map[common.Hash][]*core.Block),
+		}
+		node.Engine = NewConsensusEngine(privKey, db, chain, dispatch, valMgr)
+		node.Engine.SetLedger(&simLedger{vcp: vcp})
+		node.Engine.clock = sim.Now
+		node.Engine.loopback = func(msg interface{}) {
+			sim.schedule(0, func() { node.handle(msg) })
+		}
+		valMgr.SetConsensusEngine(node.Engine)
+		sim.Nodes = append(sim.Nodes, node)
+	}
+	return sim, nil
+}
+
+// Start lets all the nodes enter their first epoch.
+func (sim *Simulation) Start() {
+	for _, node := range sim.Nodes {
+		node.enterEpoch()
+	}
+}
+
+// Stop stops the timers the engines started outside of the simulation.
+func (sim *Simulation) Stop() {
+	for _, node := range sim.Nodes {
+		if node.Engine.guardianTimer != nil {
+			node.Engine.guardianTimer.Stop()
+		}
+	}
+}
+
+// Now returns the virtual time.
+func (sim *Simulation) Now() time.Time {
+	return simulationStartTime.Add(sim.now)
+}
+
+// Elapsed returns the virtual time since the start of the simulation.
+func (sim *Simulation) Elapsed() time.Duration {
+	return sim.now
+}
+
+// Step runs the next event, and returns false if there is none.
+func (sim *Simulation) Step() bool {
+	if sim.events.Len() == 0 {
+		return false
+	}
+	event := heap.Pop(&sim.events).(*simEvent)
+	sim.now = event.time
+	event.run()
+	for _, node := range sim.Nodes {
+		node.collectFinalizedBlocks()
+	}
+	return true
+}
+
+// RunFor runs the events of the given virtual duration.
+func (sim *Simulation) RunFor(duration time.Duration) {
+	end := sim.now + duration
+	for sim.events.Len() > 0 && sim.events[0].time <= end {
+		sim.Step()
+	}
+	sim.now = end
+}
+
+// RunUntil runs the events until the condition holds, for at most the given virtual duration.
+// It returns whether the condition holds.
+func (sim *Simulation) RunUntil(cond func() bool, timeout time.Duration) bool {
+	end := sim.now + timeout
+	for !cond() {
+		if sim.events.Len() == 0 || sim.events[0].time > end {
+			sim.now = end
+			return false
+		}
+		sim.Step()
+	}
+	return true
+}
+
+// SetLatency sets the range of the message latencies.
+func (sim *Simulation) SetLatency(min time.Duration, max time.Duration) {
+	sim.config.MinLatency = min
+	sim.config.MaxLatency = max
+}
+
+// SetLinkLatency fixes the latency of the messages from a node to another.
+func (sim *Simulation) SetLinkLatency(from int, to int, latency time.Duration) {
+	sim.latencies[[2]int{from, to}] = latency
+}
+
+// SetDropRate sets the probability for a message to be lost.
+func (sim *Simulation) SetDropRate(rate float64) {
+	sim.dropRate = rate
+}
+
+// Partition splits the network into the given groups of nodes. The nodes in no group form one
+// more group. The messages between groups are lost, including the ones in flight.
+func (sim *Simulation) Partition(groups ...[]int) {
+	for i := range sim.partitions {
+		sim.partitions[i] = 0
+	}
+	for k, group := range groups {
+		for _, i := range group {
+			sim.partitions[i] = k + 1
+		}
+	}
+}
+
+// Heal reconnects all the nodes.
+func (sim *Simulation) Heal() {
+	sim.Partition()
+}
+
+// Crash stops the node: it neither receives messages nor acts on its timers until it recovers.
+func (sim *Simulation) Crash(i int) {
+	sim.Nodes[i].crashed = true
+}
+
+// Recover restarts a crashed node from its persisted state, in a new round of its epoch.
+func (sim *Simulation) Recover(i int) {
+	node := sim.Nodes[i]
+	if !node.crashed {
+		return
+	}
+	node.crashed = false
+	node.enterEpoch()
+}
+
+// SetByzantine makes the node send the messages chosen by the behavior, or follow the protocol if
+// the behavior is nil.
+func (sim *Simulation) SetByzantine(i int, behavior ByzantineBehavior) {
+	sim.Nodes[i].behavior = behavior
+}
+
+// MinFinalizedHeight returns the lowest height finalized by the running nodes.
+func (sim *Simulation) MinFinalizedHeight() uint64 {
+	first := true
+	var min uint64
+	for _, node := range sim.Nodes {
+		if node.crashed {
+			continue
+		}
+		if height := node.LastFinalizedHeight(); first || height < min {
+			min = height
+			first = false
+		}
+	}
+	return min
+}
+
+// CheckSafety returns an error if two blocks finalized by the nodes conflict, i.e. if the
+// finalized blocks of all the nodes are not on a single chain.
+func (sim *Simulation) CheckSafety() error {
+	canonical := []common.Hash{}
+	for _, node := range sim.Nodes {
+		path, err := node.finalizedPath()
+		if err != nil {
+			return err
+		}
+		for _, block := range node.finalized {
+			if block.Height >= uint64(len(path)) || path[block.Height] != block.Hash() {
+				return fmt.Errorf("Node %v finalized conflicting blocks at height %v", node.Index, block.Height)
+			}
+		}
+		for height, hash := range path {
+			if height >= len(canonical) {
+				canonical = append(canonical, hash)
+			} else if canonical[height] != hash {
+				return fmt.Errorf("Nodes finalized conflicting blocks at height %v: %v, %v", height, canonical[height].Hex(), hash.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+func (sim *Simulation) schedule(delay time.Duration, run func()) {
+	sim.seq++
+	heap.Push(&sim.events, &simEvent{time: sim.now + delay, seq: sim.seq, run: run})
+}
+
+func (sim *Simulation) connected(from int, to int) bool {
+	return sim.partitions[from] == sim.partitions[to]
+}
+
+func (sim *Simulation) latency(from int, to int) time.Duration {
+	if latency, ok := sim.latencies[[2]int{from, to}]; ok {
+		return latency
+	}
+	spread := sim.config.MaxLatency - sim.config.MinLatency
+	if spread <= 0 {
+		return sim.config.MinLatency
+	}
+	return sim.config.MinLatency + time.Duration(sim.rand.Int63n(int64(spread)+1))
+}
+
+func (sim *Simulation) broadcast(from int, message p2ptypes.Message) {
+	for to := range sim.Nodes {
+		if to != from {
+			sim.send(from, to, message)
+		}
+	}
+}
+
+// send delivers a message of the dispatcher. Each receiver decodes its own copy.
+func (sim *Simulation) send(from int, to int, message p2ptypes.Message) {
+	data, ok := message.Content.(dispatcher.DataResponse)
+	if !ok {
+		return
+	}
+	msg, err := decodeSimMessage(data)
+	if err != nil || msg == nil {
+		return
+	}
+	msgs := []interface{}{msg}
+	if behavior := sim.Nodes[from].behavior; behavior != nil {
+		msgs = behavior(sim.Nodes[from], to, msg)
+	}
+	for _, msg := range msgs {
+		sim.deliver(from, to, msg)
+	}
+}
+
+func (sim *Simulation) deliver(from int, to int, msg interface{}) {
+	if !sim.connected(from, to) || (sim.dropRate > 0 && sim.rand.Float64() < sim.dropRate) {
+		sim.Dropped++
+		return
+	}
+	sim.schedule(sim.latency(from, to), func() {
+		if !sim.connected(from, to) || sim.Nodes[to].crashed {
+			sim.Dropped++
+			return
+		}
+		sim.Delivered++
+		sim.Nodes[to].receive(from, msg)
+	})
+}
+
+// requestBlock lets a node fetch a missing block from a peer, as the sync manager does.
+func (sim *Simulation) requestBlock(requester int, peer int, hash common.Hash) {
+	if !sim.connected(requester, peer) {
+		sim.Dropped++
+		return
+	}
+	sim.schedule(2*sim.latency(requester, peer), func() {
+		if !sim.connected(requester, peer) || sim.Nodes[peer].crashed || sim.Nodes[requester].crashed {
+			sim.Dropped++
+			return
+		}
+		eb, err := sim.Nodes[peer].chain.FindBlock(hash)
+		if err != nil {
+			return
+		}
+		raw, err := rlp.EncodeToBytes(eb.Block)
+		if err != nil {
+			return
+		}
+		block := &core.Block{}
+		if err := rlp.DecodeBytes(raw, block); err != nil {
+			return
+		}
+		sim.Delivered++
+		sim.Nodes[requester].receiveBlock(peer, block)
+	})
+}
+
+func decodeSimMessage(data dispatcher.DataResponse) (interface{}, error) {
+	switch data.ChannelID {
+	case common.ChannelIDVote:
+		vote := core.Vote{}
+		err := rlp.DecodeBytes(data.Payload, &vote)
+		return vote, err
+	case common.ChannelIDProposal:
+		proposal := &core.Proposal{}
+		err := rlp.DecodeBytes(data.Payload, proposal)
+		return proposal, err
+	case common.ChannelIDEvidence:
+		evidence := &core.Evidence{}
+		err := rlp.DecodeBytes(data.Payload, evidence)
+		return evidence, err
+	default:
+		// The guardian and elite edge node votes are not simulated.
+		return nil, nil
+	}
+}
+
+//
+// -------------------------------- SimNode ----------------------------------
+//
+
+// SimNode is a validator of a simulated network.
+type SimNode struct {
+	Index   int
+	Engine  *ConsensusEngine
+	PrivKey *crypto.PrivateKey
+
+	sim        *Simulation
+	chain      *blockchain.Chain
+	behavior   ByzantineBehavior
+	crashed    bool
+	epochRound uint64                        // Incremented each time the node enters an epoch, to ignore the stale timers.
+	orphans    map[common.Hash][]*core.Block // Blocks waiting for their parents, by parent hash.
+	finalized  []*core.Block                 // Blocks finalized by the engine, in order.
+}
+
+// Chain returns the chain of the node.
+func (n *SimNode) Chain() *blockchain.Chain {
+	return n.chain
+}
+
+// Crashed returns whether the node is crashed.
+func (n *SimNode) Crashed() bool {
+	return n.crashed
+}
+
+// FinalizedBlocks returns the blocks finalized by the engine, in order. The ancestors finalized
+// along with a block are not included.
+func (n *SimNode) FinalizedBlocks() []*core.Block {
+	return n.finalized
+}
+
+// LastFinalizedHeight returns the height of the last finalized block.
+func (n *SimNode) LastFinalizedHeight() uint64 {
+	return n.Engine.GetLastFinalizedBlock().Height
+}
+
+// enterEpoch does what the main loop of the engine does when entering an epoch, with the timers
+// on the virtual clock.
+func (n *SimNode) enterEpoch() {
+	n.epochRound++
+	round := n.epochRound
+	epochTimeout := n.Engine.resetEpoch()
+	voteDelay := time.Duration(viper.GetInt(common.CfgConsensusMinBlockInterval)) * time.Second
+
+	n.sim.schedule(voteDelay, func() {
+		if n.isCurrentRound(round) {
+			n.Engine.handleVoteTimer()
+		}
+	})
+	n.sim.schedule(epochTimeout, func() {
+		if n.isCurrentRound(round) {
+			n.Engine.handleEpochTimeout()
+			n.enterEpoch()
+		}
+	})
+	n.Engine.propose()
+}
+
+func (n *SimNode) isCurrentRound(round uint64) bool {
+	return !n.crashed && round == n.epochRound
+}
+
+// handle passes a message to the engine, as the main loop does.
+func (n *SimNode) handle(msg interface{}) {
+	if n.crashed {
+		return
+	}
+	if endEpoch := n.Engine.processMessage(msg); endEpoch {
+		n.enterEpoch()
+	}
+}
+
+// receive handles a message from a peer, as the sync manager does.
+func (n *SimNode) receive(from int, msg interface{}) {
+	switch m := msg.(type) {
+	case *core.Proposal:
+		if m.Votes != nil {
+			for _, vote := range m.Votes.Votes() {
+				n.handle(vote)
+			}
+		}
+		if m.Block != nil {
+			n.receiveBlock(from, m.Block)
+		}
+	case *core.Block:
+		n.receiveBlock(from, m)
+	default:
+		n.handle(m)
+	}
+}
+
+// receiveBlock adds the block to the chain and passes it to the engine once its parent is
+// known, fetching the missing parent from the peer.
+func (n *SimNode) receiveBlock(from int, block *core.Block) {
+	if n.crashed {
+		return
+	}
+	hash := block.Hash()
+	if _, err := n.chain.FindBlock(hash); err == nil {
+		return
+	}
+	if res := block.Validate(n.chain.ChainID); res.IsError() {
+		return
+	}
+	if _, err := n.chain.FindBlock(block.Parent); err != nil {
+		n.orphans[block.Parent] = append(n.orphans[block.Parent], block)
+		n.sim.requestBlock(n.Index, from, block.Parent)
+		return
+	}
+	if _, err := n.chain.AddBlock(block); err != nil {
+		return
+	}
+	n.handle(block)
+
+	orphans := n.orphans[hash]
+	delete(n.orphans, hash)
+	for _, orphan := range orphans {
+		n.receiveBlock(from, orphan)
+	}
+}
+
+func (n *SimNode) collectFinalizedBlocks() {
+	for {
+		select {
+		case block := <-n.Engine.FinalizedBlocks():
+			n.finalized = append(n.finalized, block)
+		default:
+			return
+		}
+	}
+}
+
+// finalizedPath returns the hashes of the blocks from the genesis to the last finalized block,
+// by height.
+func (n *SimNode) finalizedPath() ([]common.Hash, error) {
+	block := n.Engine.GetLastFinalizedBlock()
+	path := make([]common.Hash, block.Height+1)
+	for {
+		path[block.Height] = block.Hash()
+		if block.Height == core.GenesisBlockHeight {
+			return path, nil
+		}
+		parent, err := n.chain.FindBlock(block.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("Node %v is missing the finalized block %v: %v", n.Index, block.Parent.Hex(), err)
+		}
+		block = parent
+	}
+}
+
+// conflictingProposal returns a proposal of another block at the same height and epoch, signed
+// by the node.
+func (n *SimNode) conflictingProposal(proposal *core.Proposal) *core.Proposal {
+	header := *proposal.Block.BlockHeader
+	header.Timestamp = new(big.Int).Add(header.Timestamp, big.NewInt(1))
+	sig, err := n.PrivKey.Sign(header.SignBytes())
+	if err != nil {
+		return proposal
+	}
+	header.SetSignature(sig)
+	header.UpdateHash()
+	return &core.Proposal{
+		Block:      &core.Block{BlockHeader: &header, Txs: proposal.Block.Txs},
+		ProposerID: proposal.ProposerID,
+		Votes:      proposal.Votes,
+	}
+}
+
+//
+// -------------------------------- ByzantineBehavior ----------------------------------
+//
+
+// ByzantineBehavior returns the messages a byzantine node sends to a peer in place of the given
+// message, which is a core.Vote, a *core.Proposal or a *core.Evidence.
+type ByzantineBehavior func(node *SimNode, to int, msg interface{}) []interface{}
+
+// SilentBehavior withholds all the messages: the node follows the protocol, but its votes and
+// proposals never reach the peers.
+func SilentBehavior(node *SimNode, to int, msg interface{}) []interface{} {
+	return nil
+}
+
+// EquivocatingBehavior sends a conflicting proposal of the same epoch to the nodes with an odd
+// index.
+func EquivocatingBehavior(node *SimNode, to int, msg interface{}) []interface{} {
+	proposal, ok := msg.(*core.Proposal)
+	if !ok || proposal.Block == nil || to%2 == 0 {
+		return []interface{}{msg}
+	}
+	return []interface{}{node.conflictingProposal(proposal)}
+}
+
+// WithholdVotesBehavior withholds the votes from the given nodes.
+func WithholdVotesBehavior(targets ...int) ByzantineBehavior {
+	return func(node *SimNode, to int, msg interface{}) []interface{} {
+		if _, ok := msg.(core.Vote); ok {
+			for _, target := range targets {
+				if to == target {
+					return nil
+				}
+			}
+		}
+		return []interface{}{msg}
+	}
+}
+
+//
+// -------------------------------- Events ----------------------------------
+//
+
+type simEvent struct {
+	time time.Duration
+	seq  uint64 // Orders the events of the same time by scheduling order.
+	run  func()
+}
+
+type simEventQueue []*simEvent
+
+func (q simEventQueue) Len() int { return len(q) }
+
+func (q simEventQueue) Less(i, j int) bool {
+	if q[i].time != q[j].time {
+		return q[i].time < q[j].time
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q simEventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *simEventQueue) Push(x interface{}) { *q = append(*q, x.(*simEvent)) }
+
+func (q *simEventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	event := old[n-1]
+	*q = old[:n-1]
+	return event
+}
+
+//
+// -------------------------------- Network ----------------------------------
+//
+
+var _ p2p.Network = (*simEndpoint)(nil)
+
+// simEndpoint is the network of a node, delivering its messages through the simulation.
+type simEndpoint struct {
+	sim   *Simulation
+	index int
+	id    string
+}
+
+func (se *simEndpoint) Start(ctx context.Context) error { return nil }
+
+func (se *simEndpoint) Wait() {}
+
+func (se *simEndpoint) Stop() {}
+
+func (se *simEndpoint) Broadcast(message p2ptypes.Message, skipEdgeNode bool) chan bool {
+	se.sim.broadcast(se.index, message)
+	successes := make(chan bool, 1)
+	successes <- true
+	return successes
+}
+
+func (se *simEndpoint) BroadcastToNeighbors(message p2ptypes.Message, maxNumPeersToBroadcast int, skipEdgeNode bool) chan bool {
+	return se.Broadcast(message, skipEdgeNode)
+}
+
+func (se *simEndpoint) Send(peerID string, message p2ptypes.Message) bool {
+	for to, node := range se.sim.Nodes {
+		if node.Engine.ID() == peerID {
+			se.sim.send(se.index, to, message)
+			return true
+		}
+	}
+	return false
+}
+
+func (se *simEndpoint) Peers(skipEdgeNode bool) []string {
+	peers := []string{}
+	for to, node := range se.sim.Nodes {
+		if to != se.index {
+			peers = append(peers, node.Engine.ID())
+		}
+	}
+	return peers
+}
+
+func (se *simEndpoint) PeerURLs(skipEdgeNode bool) []string {
+	return []string{}
+}
+
+func (se *simEndpoint) PeerExists(peerID string) bool {
+	for _, peer := range se.Peers(false) {
+		if peer == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (se *simEndpoint) RegisterMessageHandler(messageHandler p2p.MessageHandler) {}
+
+func (se *simEndpoint) ID() string {
+	return se.id
+}
+
+// simNoLibp2p stands for the missing libp2p network: the dispatcher checks for a nil network
+// with reflection, which fails on a nil interface.
+type simNoLibp2p struct {
+	p2pl.Network
+}
+
+//
+// -------------------------------- Ledger ----------------------------------
+//
+
+var _ core.Ledger = (*simLedger)(nil)
+
+// simLedger is a ledger without transactions, whose validator candidate pool never changes.
+type simLedger struct {
+	vcp *core.ValidatorCandidatePool
+}
+
+func (l *simLedger) GetCurrentBlock() *core.Block {
+	return nil
+}
+
+func (l *simLedger) ScreenTxUnsafe(rawTx common.Bytes) result.Result {
+	return result.Error("Transactions are not simulated")
+}
+
+func (l *simLedger) ScreenTx(rawTx common.Bytes) (*core.TxInfo, result.Result) {
+	return nil, result.Error("Transactions are not simulated")
+}
+
+func (l *simLedger) ProposeBlockTxs(block *core.Block, shouldIncludeValidatorUpdateTxs bool) (common.Hash, []common.Bytes, result.Result) {
+	return common.Hash{}, []common.Bytes{}, result.OK
+}
+
+func (l *simLedger) ApplyBlockTxs(block *core.Block) result.Result {
+	return result.OK
+}
+
+func (l *simLedger) ApplyBlockTxsForChainCorrection(block *core.Block) (common.Hash, result.Result) {
+	return common.Hash{}, result.OK
+}
+
+func (l *simLedger) ResetState(block *core.Block) result.Result {
+	return result.OK
+}
+
+func (l *simLedger) FinalizeState(height uint64, rootHash common.Hash) result.Result {
+	return result.OK
+}
+
+func (l *simLedger) GetFinalizedValidatorCandidatePool(blockHash common.Hash, isNext bool) (*core.ValidatorCandidatePool, error) {
+	return l.vcp, nil
+}
+
+func (l *simLedger) GetGuardianCandidatePool(blockHash common.Hash) (*core.GuardianCandidatePool, error) {
+	return core.NewGuardianCandidatePool(), nil
+}
+
+func (l *simLedger) GetEliteEdgeNodePoolOfLastCheckpoint(blockHash common.Hash) (core.EliteEdgeNodePool, error) {
+	return nil, nil
+}
+
+func (l *simLedger) PruneState(endHeight uint64) error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func newTestSimulation(t *testing.T, config SimulationConfig) *Simulation {
+	sim, err := NewSimulation(config)
+	require.Nil(t, err)
+	sim.Start()
+	return sim
+}
+
+func finalizedHashes(sim *Simulation) [][]common.Hash {
+	result := [][]common.Hash{}
+	for _, node := range sim.Nodes {
+		hashes := []common.Hash{}
+		for _, block := range node.FinalizedBlocks() {
+			hashes = append(hashes, block.Hash())
+		}
+		result = append(result, hashes)
+	}
+	return result
+}
+
+func TestSimulationDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	run := func() *Simulation {
+		sim := newTestSimulation(t, DefaultSimulationConfig())
+		defer sim.Stop()
+		sim.RunFor(3 * time.Minute)
+		return sim
+	}
+	sim1 := run()
+	sim2 := run()
+
+	require.Nil(sim1.CheckSafety())
+	assert.True(sim1.MinFinalizedHeight() >= 5)
+	assert.Equal(finalizedHashes(sim1), finalizedHashes(sim2))
+	assert.Equal(sim1.Delivered, sim2.Delivered)
+
+	config := DefaultSimulationConfig()
+	config.Seed = 2
+	sim3 := newTestSimulation(t, config)
+	defer sim3.Stop()
+	sim3.RunFor(3 * time.Minute)
+	require.Nil(sim3.CheckSafety())
+	assert.NotEqual(finalizedHashes(sim1), finalizedHashes(sim3))
+}
+
+func TestSimulationPartition(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sim := newTestSimulation(t, DefaultSimulationConfig())
+	defer sim.Stop()
+	require.True(sim.RunUntil(func() bool { return sim.MinFinalizedHeight() >= 2 }, 5*time.Minute))
+
+	// Neither half of the validators has a majority.
+	sim.Partition([]int{0, 1}, []int{2, 3})
+	sim.RunFor(30 * time.Second)
+	height := sim.MinFinalizedHeight()
+	sim.RunFor(5 * time.Minute)
+	assert.Equal(height, sim.MinFinalizedHeight())
+	require.Nil(sim.CheckSafety())
+
+	sim.Heal()
+	assert.True(sim.RunUntil(func() bool { return sim.MinFinalizedHeight() >= height+3 }, 10*time.Minute))
+	assert.Nil(sim.CheckSafety())
+}
+
+func TestSimulationCrash(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sim := newTestSimulation(t, DefaultSimulationConfig())
+	defer sim.Stop()
+	require.True(sim.RunUntil(func() bool { return sim.MinFinalizedHeight() >= 2 }, 5*time.Minute))
+
+	// The other validators keep going without one of them.
+	sim.Crash(3)
+	height := sim.Nodes[3].LastFinalizedHeight()
+	require.True(sim.RunUntil(func() bool { return sim.MinFinalizedHeight() >= height+5 }, 10*time.Minute))
+	assert.Equal(height, sim.Nodes[3].LastFinalizedHeight())
+
+	// It catches up once it recovers.
+	sim.Recover(3)
+	target := sim.MinFinalizedHeight()
+	assert.True(sim.RunUntil(func() bool { return sim.Nodes[3].LastFinalizedHeight() >= target }, 10*time.Minute))
+	assert.Nil(sim.CheckSafety())
+}
+
+func TestSimulationByzantine(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, behavior := range []ByzantineBehavior{SilentBehavior, EquivocatingBehavior, WithholdVotesBehavior(1, 2)} {
+		sim := newTestSimulation(t, DefaultSimulationConfig())
+		sim.SetByzantine(0, behavior)
+		sim.SetDropRate(0.01)
+		assert.True(sim.RunUntil(func() bool { return sim.MinFinalizedHeight() >= 5 }, 10*time.Minute))
+		assert.Nil(sim.CheckSafety())
+		sim.Stop()
+	}
+}
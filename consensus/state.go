@@ -38,6 +38,8 @@ type State struct {
 	LastProposal core.Proposal
 	LastVote     core.Vote
 	epoch        uint64
+
+	wal *WAL // nil when the write-ahead log is disabled
 }
 
 func NewState(db store.Store, chain *blockchain.Chain) *State {
@@ -114,6 +116,111 @@ func (s *State) Load() (err error) {
 	return
 }
 
+// RecoverFromWAL restores the proposal, vote and epoch recorded in the write-ahead log which
+// are more recent than the ones of the state, and logs the state changes to the WAL from then
+// on. The state never goes back to an older proposal, vote or epoch of the same chain root.
+func (s *State) RecoverFromWAL(wal *WAL, records []*WALRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root := s.chain.Root().Hash()
+	for _, record := range records {
+		if record.Root != root {
+			continue
+		}
+		switch record.Type {
+		case WALRecordProposal:
+			proposal, err := record.Proposal()
+			if err != nil {
+				return err
+			}
+			if proposal.Block != nil && (s.LastProposal.Block == nil || proposal.Block.Epoch >= s.LastProposal.Block.Epoch) {
+				s.LastProposal = *proposal
+			}
+		case WALRecordVote:
+			vote, err := record.Vote()
+			if err != nil {
+				return err
+			}
+			if vote.Height >= s.LastVote.Height {
+				s.LastVote = *vote
+			}
+		case WALRecordEpoch:
+			epoch, err := record.Epoch()
+			if err != nil {
+				return err
+			}
+			if epoch > s.epoch {
+				s.epoch = epoch
+			}
+		default:
+			logger.Warnf("Ignoring WAL record of unknown type %v", record.Type)
+		}
+	}
+
+	s.wal = wal
+	if err := s.compactWAL(); err != nil {
+		return err
+	}
+	return s.commit()
+}
+
+// CloseWAL stops logging the state changes to the write-ahead log.
+func (s *State) CloseWAL() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.Close()
+	s.wal = nil
+	return err
+}
+
+// writeWAL logs the state change before it is applied.
+func (s *State) writeWAL(recordType WALRecordType, value interface{}) error {
+	if s.wal == nil {
+		return nil
+	}
+	if s.wal.Size() > walCompactionSize {
+		if err := s.compactWAL(); err != nil {
+			return err
+		}
+	}
+	record, err := newWALRecord(recordType, s.chain.Root().Hash(), value)
+	if err != nil {
+		return err
+	}
+	return s.wal.Write(record)
+}
+
+// compactWAL rewrites the write-ahead log with the current proposal, vote and epoch only.
+func (s *State) compactWAL() error {
+	root := s.chain.Root().Hash()
+	records := []*WALRecord{}
+	if s.LastProposal.Block != nil {
+		record, err := newWALRecord(WALRecordProposal, root, s.LastProposal)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	if s.LastVote.Height != 0 {
+		record, err := newWALRecord(WALRecordVote, root, s.LastVote)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	record, err := newWALRecord(WALRecordEpoch, root, s.epoch)
+	if err != nil {
+		return err
+	}
+	records = append(records, record)
+	return s.wal.Rewrite(records)
+}
+
 func (s *State) GetEpoch() uint64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -125,6 +232,9 @@ func (s *State) SetEpoch(epoch uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.writeWAL(WALRecordEpoch, epoch); err != nil {
+		return err
+	}
 	s.epoch = epoch
 	return s.commit()
 }
@@ -140,6 +250,9 @@ func (s *State) SetLastProposal(p core.Proposal) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.writeWAL(WALRecordProposal, p); err != nil {
+		return err
+	}
 	s.LastProposal = p
 	return s.commit()
 }
@@ -155,6 +268,9 @@ func (s *State) SetLastVote(v core.Vote) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.writeWAL(WALRecordVote, v); err != nil {
+		return err
+	}
 	s.LastVote = v
 	return s.commit()
 }
@@ -69,15 +69,18 @@ func (m *FixedValidatorManager) GetNextValidatorSet(blockHash common.Hash) *core
 //
 var _ core.ValidatorManager = &RotatingValidatorManager{}
 
-// RotatingValidatorManager is an implementation of ValidatorManager interface that selects a random validator as
-// the proposer using validator's stake as weight.
+// RotatingValidatorManager is an implementation of ValidatorManager interface that selects the
+// proposer with a ProposerSelector, by default a random validator using validator's stake as weight.
 type RotatingValidatorManager struct {
 	consensus core.ConsensusEngine
+	selector  ProposerSelector
 }
 
 // NewRotatingValidatorManager creates an instance of RotatingValidatorManager.
 func NewRotatingValidatorManager() *RotatingValidatorManager {
-	m := &RotatingValidatorManager{}
+	m := &RotatingValidatorManager{
+		selector: &StakeWeightedSelector{},
+	}
 	return m
 }
 
@@ -86,41 +89,19 @@ func (m *RotatingValidatorManager) SetConsensusEngine(consensus core.ConsensusEn
 	m.consensus = consensus
 }
 
+// SetProposerSelector replaces the proposer selection strategy.
+func (m *RotatingValidatorManager) SetProposerSelector(selector ProposerSelector) {
+	m.selector = selector
+}
+
 // GetProposer implements ValidatorManager interface.
 func (m *RotatingValidatorManager) GetProposer(blockHash common.Hash, epoch uint64) core.Validator {
-	return m.getProposerFromValidators(m.GetValidatorSet(blockHash), epoch)
+	return m.selector.SelectProposer(m.GetValidatorSet(blockHash), blockHash, epoch)
 }
 
 // GetNextProposer implements ValidatorManager interface.
 func (m *RotatingValidatorManager) GetNextProposer(blockHash common.Hash, epoch uint64) core.Validator {
-	return m.getProposerFromValidators(m.GetNextValidatorSet(blockHash), epoch)
-}
-
-func (m *RotatingValidatorManager) getProposerFromValidators(valSet *core.ValidatorSet, epoch uint64) core.Validator {
-	if valSet.Size() == 0 {
-		log.Panic("No validators have been added")
-	}
-
-	totalStake := valSet.TotalStake()
-	scalingFactor := new(big.Int).Div(totalStake, common.BigMaxUint32)
-	scalingFactor = new(big.Int).Add(scalingFactor, common.Big1)
-	scaledTotalStake := scaleDown(totalStake, scalingFactor)
-
-	// TODO: replace with more secure randomness.
-	rnd := rand.New(rand.NewSource(int64(epoch)))
-	r := randUint64(rnd, scaledTotalStake)
-	curr := uint64(0)
-	validators := valSet.Validators()
-	for _, v := range validators {
-		curr += scaleDown(v.Stake, scalingFactor)
-		if r < curr {
-			return v
-		}
-	}
-
-	// Should not reach here.
-	log.Panic("Failed to randomly select a validator")
-	panic("Should not reach here")
+	return m.selector.SelectProposer(m.GetNextValidatorSet(blockHash), blockHash, epoch)
 }
 
 // GetValidatorSet returns the validator set for given block.
@@ -145,7 +126,7 @@ func SelectTopStakeHoldersAsValidators(vcp *core.ValidatorCandidatePool) *core.V
 
 	valSet := core.NewValidatorSet()
 	for _, stakeHolder := range topStakeHolders {
-		valAddr := stakeHolder.Holder.Hex()
+		valAddr := vcp.SignerOf(stakeHolder.Holder).Hex() // the rotated signing key if any
 		valStake := stakeHolder.TotalStake()
 		if valStake.Cmp(core.Zero) == 0 {
 			continue
@@ -0,0 +1,239 @@
+package consensus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// The write-ahead log records the proposals and votes of the node, and the epochs it enters,
+// before they are committed to the consensus state and sent to the peers. A validator
+// restarting after a crash recovers them from the log, so it never proposes or votes twice
+// with different content.
+//
+// Each record is framed by its length and its CRC-32C checksum, both 4 bytes big endian. A
+// record torn by a crash fails the checks and is dropped, together with anything after it.
+
+// WALRecordType is the type of the consensus state change of a WAL record.
+type WALRecordType byte
+
+const (
+	WALRecordProposal WALRecordType = iota + 1
+	WALRecordVote
+	WALRecordEpoch
+)
+
+func (t WALRecordType) String() string {
+	switch t {
+	case WALRecordProposal:
+		return "proposal"
+	case WALRecordVote:
+		return "vote"
+	case WALRecordEpoch:
+		return "epoch"
+	default:
+		return fmt.Sprintf("unknown(%d)", t)
+	}
+}
+
+const (
+	walFrameHeaderSize = 8
+	walMaxRecordSize   = 64 * 1024 * 1024
+
+	// walCompactionSize is the size above which the log is rewritten with the current state only.
+	walCompactionSize = 16 * 1024 * 1024
+)
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WALRecord is an entry of the consensus write-ahead log.
+type WALRecord struct {
+	Type    WALRecordType
+	Root    common.Hash // root of the chain the state change applies to
+	Payload common.Bytes
+}
+
+func newWALRecord(recordType WALRecordType, root common.Hash, value interface{}) (*WALRecord, error) {
+	payload, err := rlp.EncodeToBytes(value)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode the %v WAL record: %v", recordType, err)
+	}
+	return &WALRecord{Type: recordType, Root: root, Payload: payload}, nil
+}
+
+// Proposal decodes the proposal of a WALRecordProposal record.
+func (r *WALRecord) Proposal() (*core.Proposal, error) {
+	proposal := &core.Proposal{}
+	if err := rlp.DecodeBytes(r.Payload, proposal); err != nil {
+		return nil, fmt.Errorf("Failed to decode the proposal WAL record: %v", err)
+	}
+	return proposal, nil
+}
+
+// Vote decodes the vote of a WALRecordVote record.
+func (r *WALRecord) Vote() (*core.Vote, error) {
+	vote := &core.Vote{}
+	if err := rlp.DecodeBytes(r.Payload, vote); err != nil {
+		return nil, fmt.Errorf("Failed to decode the vote WAL record: %v", err)
+	}
+	return vote, nil
+}
+
+// Epoch decodes the epoch of a WALRecordEpoch record.
+func (r *WALRecord) Epoch() (uint64, error) {
+	var epoch uint64
+	if err := rlp.DecodeBytes(r.Payload, &epoch); err != nil {
+		return 0, fmt.Errorf("Failed to decode the epoch WAL record: %v", err)
+	}
+	return epoch, nil
+}
+
+// WAL is the consensus write-ahead log. Every record is synced to the disk before Write returns.
+type WAL struct {
+	path string
+	file *os.File
+	size int64
+}
+
+// OpenWAL opens the write-ahead log at the path, creating it if it does not exist, and returns
+// the records in it. A torn record at the end of the log is truncated.
+func OpenWAL(path string) (*WAL, []*WALRecord, error) {
+	records, size, err := ReadWAL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open the WAL %v: %v", path, err)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("Failed to truncate the WAL %v to %v bytes: %v", path, size, err)
+	}
+	if _, err := file.Seek(size, 0); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("Failed to seek the end of the WAL %v: %v", path, err)
+	}
+	return &WAL{path: path, file: file, size: size}, records, nil
+}
+
+// ReadWAL returns the records of the write-ahead log at the path, along with the size of the
+// valid part of the log. A missing log has no records.
+func ReadWAL(path string) ([]*WALRecord, int64, error) {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to read the WAL %v: %v", path, err)
+	}
+
+	records := []*WALRecord{}
+	offset := 0
+	for offset+walFrameHeaderSize <= len(raw) {
+		length := int(binary.BigEndian.Uint32(raw[offset:]))
+		checksum := binary.BigEndian.Uint32(raw[offset+4:])
+		end := offset + walFrameHeaderSize + length
+		if length > walMaxRecordSize || end > len(raw) {
+			break
+		}
+		body := raw[offset+walFrameHeaderSize : end]
+		if crc32.Checksum(body, walCRCTable) != checksum {
+			break
+		}
+		record := &WALRecord{}
+		if err := rlp.DecodeBytes(body, record); err != nil {
+			break
+		}
+		records = append(records, record)
+		offset = end
+	}
+	if offset < len(raw) {
+		logger.Warnf("Dropping the %v bytes of the WAL %v after its last valid record", len(raw)-offset, path)
+	}
+	return records, int64(offset), nil
+}
+
+func encodeWALFrame(record *WALRecord) ([]byte, error) {
+	body, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode the WAL record: %v", err)
+	}
+	frame := make([]byte, walFrameHeaderSize, walFrameHeaderSize+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(len(body)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(body, walCRCTable))
+	return append(frame, body...), nil
+}
+
+// Write appends the record to the log and syncs it to the disk.
+func (w *WAL) Write(record *WALRecord) error {
+	frame, err := encodeWALFrame(record)
+	if err != nil {
+		return err
+	}
+	n, err := w.file.Write(frame)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("Failed to write the WAL %v: %v", w.path, err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("Failed to sync the WAL %v: %v", w.path, err)
+	}
+	return nil
+}
+
+// Size returns the size of the log in bytes.
+func (w *WAL) Size() int64 {
+	return w.size
+}
+
+// Rewrite atomically replaces the content of the log with the records.
+func (w *WAL) Rewrite(records []*WALRecord) error {
+	tmpPath := w.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to create %v: %v", tmpPath, err)
+	}
+	size := int64(0)
+	for _, record := range records {
+		frame, err := encodeWALFrame(record)
+		if err == nil {
+			_, err = tmp.Write(frame)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("Failed to write %v: %v", tmpPath, err)
+		}
+		size += int64(len(frame))
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to sync %v: %v", tmpPath, err)
+	}
+	tmp.Close()
+
+	w.file.Close()
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return fmt.Errorf("Failed to replace the WAL %v: %v", w.path, err)
+	}
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to reopen the WAL %v: %v", w.path, err)
+	}
+	w.file = file
+	w.size = size
+	return nil
+}
+
+// Close closes the log.
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
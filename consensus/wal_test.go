@@ -0,0 +1,127 @@
+package consensus
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestWALTornRecord(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "wal_test")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	walPath := path.Join(dir, "wal")
+
+	wal, records, err := OpenWAL(walPath)
+	require.Nil(err)
+	assert.Equal(0, len(records))
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		record, err := newWALRecord(WALRecordEpoch, common.Hash{}, epoch)
+		require.Nil(err)
+		require.Nil(wal.Write(record))
+	}
+	size := wal.Size()
+	require.Nil(wal.Close())
+
+	// A crash in the middle of a write leaves a partial record.
+	f, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.Nil(err)
+	_, err = f.Write([]byte{0, 0, 0, 100, 1, 2})
+	require.Nil(err)
+	f.Close()
+
+	wal, records, err = OpenWAL(walPath)
+	require.Nil(err)
+	require.Equal(3, len(records))
+	epoch, err := records[2].Epoch()
+	require.Nil(err)
+	assert.Equal(uint64(3), epoch)
+	assert.Equal(size, wal.Size())
+
+	// The records written after the recovery follow the valid ones.
+	record, err := newWALRecord(WALRecordEpoch, common.Hash{}, uint64(4))
+	require.Nil(err)
+	require.Nil(wal.Write(record))
+	require.Nil(wal.Close())
+	records, _, err = ReadWAL(walPath)
+	require.Nil(err)
+	assert.Equal(4, len(records))
+}
+
+func TestWALRecovery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	core.ResetTestBlocks()
+
+	dir, err := ioutil.TempDir("", "wal_test")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	walPath := path.Join(dir, "wal")
+
+	chain := blockchain.CreateTestChainByBlocks([]string{
+		"A1", "A0",
+		"A2", "A1",
+	})
+	block := core.GetTestBlock("A2")
+	// The epochs of the test blocks depend on the blocks created before, the state starts at
+	// the epoch of the root.
+	epoch := chain.Root().Epoch
+
+	state1 := NewState(kvstore.NewKVStore(backend.NewMemDatabase()), chain)
+	wal, records, err := OpenWAL(walPath)
+	require.Nil(err)
+	require.Nil(state1.RecoverFromWAL(wal, records))
+	require.Nil(state1.SetEpoch(epoch + 5))
+	require.Nil(state1.SetLastProposal(core.Proposal{Block: block}))
+	require.Nil(state1.SetLastVote(core.Vote{Block: block.Hash(), Height: block.Height, Epoch: epoch + 5}))
+	require.Nil(state1.CloseWAL())
+
+	// The state committed to the db is lost, the WAL is not.
+	state2 := NewState(kvstore.NewKVStore(backend.NewMemDatabase()), chain)
+	assert.Equal(uint64(0), state2.GetLastVote().Height)
+	wal, records, err = OpenWAL(walPath)
+	require.Nil(err)
+	require.Nil(state2.RecoverFromWAL(wal, records))
+	assert.Equal(epoch+5, state2.GetEpoch())
+	assert.Equal(block.Hash(), state2.GetLastProposal().Block.Hash())
+	assert.Equal(block.Hash(), state2.GetLastVote().Block)
+
+	// The WAL is compacted to the recovered state, which it never rolls back.
+	require.Nil(state2.SetEpoch(epoch + 7))
+	require.Nil(state2.CloseWAL())
+	records, _, err = ReadWAL(walPath)
+	require.Nil(err)
+	assert.Equal(4, len(records))
+
+	db := kvstore.NewKVStore(backend.NewMemDatabase())
+	state3 := NewState(db, chain)
+	require.Nil(state3.SetEpoch(epoch + 9))
+	wal, records, err = OpenWAL(walPath)
+	require.Nil(err)
+	require.Nil(state3.RecoverFromWAL(wal, records))
+	assert.Equal(epoch+9, state3.GetEpoch())
+	assert.Equal(block.Height, state3.GetLastVote().Height)
+	require.Nil(state3.CloseWAL())
+
+	// The records of another root are ignored.
+	other := blockchain.NewChain("testchain", kvstore.NewKVStore(backend.NewMemDatabase()), core.CreateTestBlock("b0", ""))
+	state4 := NewState(kvstore.NewKVStore(backend.NewMemDatabase()), other)
+	wal, records, err = OpenWAL(walPath)
+	require.Nil(err)
+	require.Nil(state4.RecoverFromWAL(wal, records))
+	assert.Equal(uint64(0), state4.GetLastVote().Height)
+	assert.Nil(state4.GetLastProposal().Block)
+	require.Nil(state4.CloseWAL())
+}
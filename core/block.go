@@ -473,6 +473,24 @@ type ExtendedBlock struct {
 	HasValidatorUpdate bool
 }
 
+// SkipHeight returns the height of the ancestor the skip pointer of a block at the given height
+// points to. The heights are chosen as in Bitcoin's skip list, so that any ancestor is reached
+// in O(log n) hops. The skip pointers are indexed by the chain, apart from the stored blocks.
+func SkipHeight(height uint64) uint64 {
+	if height < 2 {
+		return 0
+	}
+	if height&1 == 1 {
+		return invertLowestOne(invertLowestOne(height-1)) + 1
+	}
+	return invertLowestOne(height)
+}
+
+// invertLowestOne clears the lowest set bit.
+func invertLowestOne(n uint64) uint64 {
+	return n & (n - 1)
+}
+
 // Hash of header.
 func (eb *ExtendedBlock) Hash() common.Hash {
 	if eb.Block == nil {
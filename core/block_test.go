@@ -76,6 +76,17 @@ func TestBlockEncoding(t *testing.T) {
 	require.Nil(err)
 }
 
+func TestSkipHeight(t *testing.T) {
+	assert := assert.New(t)
+
+	for height, skip := range map[uint64]uint64{0: 0, 1: 0, 2: 0, 3: 1, 6: 4, 7: 1, 100: 96, 101: 65, 255: 249} {
+		assert.Equal(skip, SkipHeight(height), "height %v", height)
+	}
+	for height := uint64(1); height < 1000; height++ {
+		assert.True(SkipHeight(height) < height)
+	}
+}
+
 func TestBlockHash(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store"
+)
+
+// BlockTrioKeyPrefix is the prefix of the store keys of the block trios, followed by the
+// height of the trio as a fixed size big endian integer, so the keys sort by height.
+const BlockTrioKeyPrefix = "prooftrio/"
+
+const blockTrioKeyLen = len(BlockTrioKeyPrefix) + 8
+
+// BlockTrioKey returns the store key of the block trio at the given height.
+func BlockTrioKey(height uint64) common.Bytes {
+	key := make(common.Bytes, blockTrioKeyLen)
+	copy(key, BlockTrioKeyPrefix)
+	binary.BigEndian.PutUint64(key[len(BlockTrioKeyPrefix):], height)
+	return key
+}
+
+// ParseBlockTrioKey returns the height encoded in the block trio key.
+func ParseBlockTrioKey(key common.Bytes) (uint64, error) {
+	if len(key) != blockTrioKeyLen || string(key[:len(BlockTrioKeyPrefix)]) != BlockTrioKeyPrefix {
+		return 0, fmt.Errorf("Invalid block trio key: %v", common.Bytes2Hex(key))
+	}
+	return binary.BigEndian.Uint64(key[len(BlockTrioKeyPrefix):]), nil
+}
+
+// LegacyBlockTrioKey returns the key the block trio at the given height was stored under
+// before the key codec, i.e. BlockTrioStoreKeyPrefix followed by the decimal height.
+func LegacyBlockTrioKey(height uint64) common.Bytes {
+	return common.Bytes(BlockTrioStoreKeyPrefix + strconv.FormatUint(height, 10))
+}
+
+// Height returns the height of the block trio, that is the height of the block with the
+// validator set change, or of the genesis block for the genesis trio.
+func (t *SnapshotBlockTrio) Height() uint64 {
+	if t.First.Header != nil {
+		return t.First.Header.Height
+	}
+	if t.Second.Header != nil {
+		return t.Second.Header.Height
+	}
+	return GenesisBlockHeight
+}
+
+// SaveBlockTrio saves the block trio under the key of its height.
+func SaveBlockTrio(st store.Store, trio *SnapshotBlockTrio) error {
+	return st.Put(BlockTrioKey(trio.Height()), *trio)
+}
+
+// GetBlockTrioByHeight returns the block trio saved at the given height. The error is
+// store.ErrKeyNotFound if there is none.
+func GetBlockTrioByHeight(st store.Store, height uint64) (*SnapshotBlockTrio, error) {
+	trio := &SnapshotBlockTrio{}
+	if err := st.Get(BlockTrioKey(height), trio); err != nil {
+		return nil, err
+	}
+	return trio, nil
+}
+
+// MigrateBlockTrio moves the block trio at the given height from its legacy key to the key
+// of the codec. It returns whether a legacy trio was found.
+func MigrateBlockTrio(st store.Store, height uint64) (bool, error) {
+	trio := &SnapshotBlockTrio{}
+	err := st.Get(LegacyBlockTrioKey(height), trio)
+	if err == store.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to read the legacy block trio at height %v: %v", height, err)
+	}
+	if err = st.Put(BlockTrioKey(height), *trio); err != nil {
+		return false, fmt.Errorf("Failed to save the block trio at height %v: %v", height, err)
+	}
+	if err = st.Delete(LegacyBlockTrioKey(height)); err != nil {
+		return false, fmt.Errorf("Failed to delete the legacy block trio at height %v: %v", height, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestBlockTrioKey(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, height := range []uint64{0, 1, 64, 1000000, ^uint64(0)} {
+		height2, err := ParseBlockTrioKey(BlockTrioKey(height))
+		assert.Nil(err)
+		assert.Equal(height, height2)
+	}
+	assert.True(string(BlockTrioKey(9)) < string(BlockTrioKey(10)))
+
+	_, err := ParseBlockTrioKey(LegacyBlockTrioKey(10))
+	assert.NotNil(err)
+	_, err = ParseBlockTrioKey(common.Bytes(BlockTrioKeyPrefix))
+	assert.NotNil(err)
+}
+
+func TestBlockTrioStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	st := kvstore.NewKVStore(backend.NewMemDatabase())
+	genesis := &SnapshotBlockTrio{Second: SnapshotSecondBlock{Header: &BlockHeader{ChainID: "testchain", Height: GenesisBlockHeight, Timestamp: big.NewInt(0)}}}
+	trio := &SnapshotBlockTrio{
+		First:  SnapshotFirstBlock{Header: &BlockHeader{ChainID: "testchain", Height: 100, Timestamp: big.NewInt(1)}},
+		Second: SnapshotSecondBlock{Header: &BlockHeader{ChainID: "testchain", Height: 101, Timestamp: big.NewInt(2)}},
+	}
+	require.Nil(SaveBlockTrio(st, genesis))
+	require.Nil(SaveBlockTrio(st, trio))
+
+	trio2, err := GetBlockTrioByHeight(st, 100)
+	require.Nil(err)
+	assert.Equal(trio.Second.Header.Hash(), trio2.Second.Header.Hash())
+	genesis2, err := GetBlockTrioByHeight(st, GenesisBlockHeight)
+	require.Nil(err)
+	assert.Equal(genesis.Second.Header.Hash(), genesis2.Second.Header.Hash())
+	_, err = GetBlockTrioByHeight(st, 101)
+	assert.Equal(store.ErrKeyNotFound, err)
+
+	// A trio saved under the legacy key is moved to the new key.
+	require.Nil(st.Put(LegacyBlockTrioKey(200), *trio))
+	found, err := MigrateBlockTrio(st, 200)
+	require.Nil(err)
+	assert.True(found)
+	_, err = GetBlockTrioByHeight(st, 200)
+	assert.Nil(err)
+	assert.Equal(store.ErrKeyNotFound, st.Get(LegacyBlockTrioKey(200), &SnapshotBlockTrio{}))
+
+	found, err = MigrateBlockTrio(st, 200)
+	require.Nil(err)
+	assert.False(found)
+}
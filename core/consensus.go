@@ -9,6 +9,7 @@ import (
 type ConsensusEngine interface {
 	ID() string
 	PrivateKey() *crypto.PrivateKey
+	Signer() Signer
 	GetTip(includePendingBlockingLeaf bool) *ExtendedBlock
 	GetEpoch() uint64
 	GetLedger() Ledger
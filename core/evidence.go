@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// EvidenceType is the type of misbehavior an evidence proves.
+type EvidenceType byte
+
+const (
+	// EvidenceTypeDuplicateVote proves that a validator voted for two blocks at the same height.
+	EvidenceTypeDuplicateVote EvidenceType = iota + 1
+	// EvidenceTypeDuplicateProposal proves that a proposer signed two blocks in the same epoch.
+	EvidenceTypeDuplicateProposal
+)
+
+func (t EvidenceType) String() string {
+	switch t {
+	case EvidenceTypeDuplicateVote:
+		return "duplicate-vote"
+	case EvidenceTypeDuplicateProposal:
+		return "duplicate-proposal"
+	default:
+		return fmt.Sprintf("unknown(%d)", t)
+	}
+}
+
+// Evidence proves that a validator signed two conflicting consensus messages. It carries the
+// headers of the two blocks, which fix their heights as the votes only sign the block hashes.
+// The two messages are ordered by block hash, so the same misbehavior has a single evidence.
+type Evidence struct {
+	Type     EvidenceType
+	Offender common.Address
+	HeaderA  *BlockHeader
+	HeaderB  *BlockHeader
+	VoteA    Vote // the votes for the blocks of a duplicate vote, empty otherwise
+	VoteB    Vote
+}
+
+// NewDuplicateVoteEvidence creates the evidence of the two votes for the blocks of the headers.
+func NewDuplicateVoteEvidence(headerA *BlockHeader, voteA Vote, headerB *BlockHeader, voteB Vote) *Evidence {
+	if bytes.Compare(voteA.Block[:], voteB.Block[:]) > 0 {
+		headerA, voteA, headerB, voteB = headerB, voteB, headerA, voteA
+	}
+	return &Evidence{
+		Type:     EvidenceTypeDuplicateVote,
+		Offender: voteA.ID,
+		HeaderA:  headerA,
+		HeaderB:  headerB,
+		VoteA:    voteA,
+		VoteB:    voteB,
+	}
+}
+
+// NewDuplicateProposalEvidence creates the evidence of the two signed block headers.
+func NewDuplicateProposalEvidence(headerA, headerB *BlockHeader) *Evidence {
+	hashA, hashB := headerA.Hash(), headerB.Hash()
+	if bytes.Compare(hashA[:], hashB[:]) > 0 {
+		headerA, headerB = headerB, headerA
+	}
+	return &Evidence{
+		Type:     EvidenceTypeDuplicateProposal,
+		Offender: headerA.Proposer,
+		HeaderA:  headerA,
+		HeaderB:  headerB,
+	}
+}
+
+func (e *Evidence) String() string {
+	return fmt.Sprintf("Evidence{type: %v, offender: %v, height: %v, epoch: %v, blockA: %v, blockB: %v}",
+		e.Type, e.Offender.Hex(), e.Height(), e.Epoch(), e.HeaderA.Hash().Hex(), e.HeaderB.Hash().Hex())
+}
+
+// evidenceHashForm is the canonical form of an evidence, which identifies the misbehavior
+// regardless of the encoding of the headers and the votes.
+type evidenceHashForm struct {
+	Type     EvidenceType
+	Offender common.Address
+	BlockA   common.Hash
+	BlockB   common.Hash
+	VoteA    common.Bytes // the signed content of the votes, empty for a duplicate proposal
+	VoteB    common.Bytes
+}
+
+// Hash returns the hash of the evidence. It covers the type, the offender, and the conflicting
+// blocks and votes ordered by block hash, so it is stable across an encode/decode round trip.
+func (e *Evidence) Hash() common.Hash {
+	form := evidenceHashForm{Type: e.Type, Offender: e.Offender}
+	if e.HeaderA != nil {
+		form.BlockA = e.HeaderA.Hash()
+	}
+	if e.HeaderB != nil {
+		form.BlockB = e.HeaderB.Hash()
+	}
+	voteA, voteB := e.VoteA, e.VoteB
+	if bytes.Compare(form.BlockA[:], form.BlockB[:]) > 0 {
+		form.BlockA, form.BlockB = form.BlockB, form.BlockA
+		voteA, voteB = voteB, voteA
+	}
+	if e.Type == EvidenceTypeDuplicateVote {
+		form.VoteA, form.VoteB = voteA.SignBytes(), voteB.SignBytes()
+	}
+	raw, _ := rlp.EncodeToBytes(form)
+	return crypto.Keccak256Hash(raw)
+}
+
+// Height returns the height of the conflicting blocks.
+func (e *Evidence) Height() uint64 {
+	return e.HeaderA.Height
+}
+
+// Epoch returns the epoch of the conflicting messages: the epoch of the proposals, or the
+// epoch of the first vote.
+func (e *Evidence) Epoch() uint64 {
+	if e.Type == EvidenceTypeDuplicateVote {
+		return e.VoteA.Epoch
+	}
+	return e.HeaderA.Epoch
+}
+
+// Validate checks that the evidence proves the misbehavior of the offender.
+func (e *Evidence) Validate(chainID string) result.Result {
+	if e.HeaderA == nil || e.HeaderB == nil {
+		return result.Error("Block header is missing")
+	}
+	if e.HeaderA.ChainID != chainID || e.HeaderB.ChainID != chainID {
+		return result.Error("ChainID mismatch")
+	}
+	hashA, hashB := e.HeaderA.Hash(), e.HeaderB.Hash()
+	if bytes.Compare(hashA[:], hashB[:]) >= 0 {
+		return result.Error("Blocks are not distinct and ordered by hash")
+	}
+
+	switch e.Type {
+	case EvidenceTypeDuplicateVote:
+		if e.HeaderA.Height != e.HeaderB.Height {
+			return result.Error("Voted blocks have different heights")
+		}
+		for _, pair := range []struct {
+			vote Vote
+			hash common.Hash
+		}{{e.VoteA, hashA}, {e.VoteB, hashB}} {
+			if pair.vote.Block != pair.hash {
+				return result.Error("Vote is not for the block of the header")
+			}
+			if pair.vote.ID != e.Offender {
+				return result.Error("Vote is not from the offender")
+			}
+			if res := pair.vote.Validate(); res.IsError() {
+				return res
+			}
+		}
+	case EvidenceTypeDuplicateProposal:
+		if e.HeaderA.Epoch != e.HeaderB.Epoch {
+			return result.Error("Proposed blocks have different epochs")
+		}
+		for _, header := range []*BlockHeader{e.HeaderA, e.HeaderB} {
+			if header.Proposer != e.Offender {
+				return result.Error("Block is not proposed by the offender")
+			}
+			if res := header.Validate(chainID); res.IsError() {
+				return res
+			}
+		}
+	default:
+		return result.Error("Unknown evidence type %v", e.Type)
+	}
+	return result.OK
+}
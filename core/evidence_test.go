@@ -0,0 +1,86 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestEvidenceValidate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	address := privKey.PublicKey().Address()
+
+	newHeader := func(parent string, height, epoch uint64) *BlockHeader {
+		header := &BlockHeader{
+			ChainID:   "testchain",
+			Epoch:     epoch,
+			Height:    height,
+			Parent:    common.HexToHash(parent),
+			HCC:       CommitCertificate{BlockHash: common.HexToHash(parent)},
+			Timestamp: big.NewInt(1),
+			Proposer:  address,
+		}
+		sig, err := privKey.Sign(header.SignBytes())
+		require.Nil(err)
+		header.SetSignature(sig)
+		return header
+	}
+	newVote := func(header *BlockHeader, epoch uint64) Vote {
+		vote := Vote{Block: header.Hash(), Height: header.Height, Epoch: epoch, ID: address}
+		vote.Sign(privKey)
+		return vote
+	}
+
+	a := newHeader("0x1", 10, 3)
+	b := newHeader("0x2", 10, 3)
+	c := newHeader("0x3", 11, 4)
+
+	// Duplicate votes, in either order.
+	ev := NewDuplicateVoteEvidence(a, newVote(a, 3), b, newVote(b, 4))
+	assert.True(ev.Validate("testchain").IsOK())
+	assert.Equal(address, ev.Offender)
+	assert.Equal(uint64(10), ev.Height())
+	assert.Equal(ev.Hash(), NewDuplicateVoteEvidence(ev.HeaderB, ev.VoteB, ev.HeaderA, ev.VoteA).Hash())
+	assert.True(ev.Validate("otherchain").IsError())
+
+	raw, err := rlp.EncodeToBytes(ev)
+	require.Nil(err)
+	decoded := &Evidence{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+	assert.True(decoded.Validate("testchain").IsOK())
+	assert.Equal(ev.Hash(), decoded.Hash())
+
+	// Votes at different heights do not conflict.
+	assert.True(NewDuplicateVoteEvidence(a, newVote(a, 3), c, newVote(c, 4)).Validate("testchain").IsError())
+	// Nor do votes for the same block.
+	assert.True(NewDuplicateVoteEvidence(a, newVote(a, 3), a, newVote(a, 4)).Validate("testchain").IsError())
+
+	// Forged votes are rejected.
+	forged := NewDuplicateVoteEvidence(a, newVote(a, 3), b, newVote(b, 4))
+	forged.VoteB.Epoch = 5
+	assert.True(forged.Validate("testchain").IsError())
+
+	// Duplicate proposals.
+	ev = NewDuplicateProposalEvidence(a, b)
+	assert.True(ev.Validate("testchain").IsOK())
+	assert.Equal(uint64(3), ev.Epoch())
+	raw, err = rlp.EncodeToBytes(ev)
+	require.Nil(err)
+	decoded = &Evidence{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+	assert.Equal(ev.Hash(), decoded.Hash())
+	assert.True(NewDuplicateProposalEvidence(a, c).Validate("testchain").IsError())
+
+	unsigned := newHeader("0x4", 10, 3)
+	unsigned.Signature = nil
+	assert.True(NewDuplicateProposalEvidence(a, unsigned).Validate("testchain").IsError())
+}
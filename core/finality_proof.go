@@ -0,0 +1,14 @@
+package core
+
+// FinalityProof proves that a block is finalized to a verifier that trusts the validator set at
+// the trusted height, e.g. the genesis validator set. The proof trios carry the validator set
+// changes above the trusted height, as in the snapshot metadata. The headers link the block to a
+// directly finalized descendant, which the committed block extends with its parent and HCC, and
+// the votes for the committed block come from a majority of the proven validator set.
+type FinalityProof struct {
+	TrustedHeight uint64
+	ProofTrios    []SnapshotBlockTrio // In height order.
+	Headers       []*BlockHeader      // The block, followed by its descendants up to the directly finalized block.
+	Committed     *BlockHeader
+	Votes         *VoteSet
+}
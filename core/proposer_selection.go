@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// The proposer selection strategies.
+const (
+	// ProposerSelectionStake selects a random validator weighted by stake, seeded by the epoch.
+	ProposerSelectionStake = "stake"
+	// ProposerSelectionStakeBlockHash selects a random validator weighted by stake, seeded by the
+	// parent block hash and the epoch.
+	ProposerSelectionStakeBlockHash = "stakeBlockHash"
+	// ProposerSelectionVRF selects a random validator weighted by stake, seeded by the signature
+	// of the parent block, the output of a verifiable random function of its proposer.
+	ProposerSelectionVRF = "vrf"
+	// ProposerSelectionRoundRobin selects the validators in turn, by epoch.
+	ProposerSelectionRoundRobin = "roundRobin"
+	// ProposerSelectionFixed always selects the same validator, for devnets.
+	ProposerSelectionFixed = "fixed"
+)
+
+// ProposerSelection is the proposer selection strategy of a chain. All the validators need to
+// select the same proposers, so it is set in the genesis, and the chains without it select by
+// stake.
+type ProposerSelection struct {
+	Strategy      string
+	FixedProposer common.Address // proposer of the fixed strategy, the first validator if empty
+}
+
+// DefaultProposerSelection returns the strategy of the chains whose genesis sets none.
+func DefaultProposerSelection() *ProposerSelection {
+	return &ProposerSelection{Strategy: ProposerSelectionStake}
+}
+
+func (s *ProposerSelection) String() string {
+	return fmt.Sprintf("ProposerSelection{Strategy: %v, FixedProposer: %v}", s.Strategy, s.FixedProposer.Hex())
+}
+
+// Validate checks that the strategy is known.
+func (s *ProposerSelection) Validate() error {
+	switch s.Strategy {
+	case ProposerSelectionStake, ProposerSelectionStakeBlockHash, ProposerSelectionVRF,
+		ProposerSelectionRoundRobin, ProposerSelectionFixed:
+		return nil
+	default:
+		return fmt.Errorf("Unknown proposer selection strategy: %v", s.Strategy)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// Signer signs the votes, blocks and transactions of a validator. It may hold the key itself,
+// or request the signatures from a remote signer process.
+type Signer interface {
+	Address() common.Address
+	SignVote(vote *Vote) error
+	SignBlock(header *BlockHeader) error
+	SignTx(signBytes common.Bytes) (*crypto.Signature, error)
+}
+
+var _ Signer = (*LocalSigner)(nil)
+
+// LocalSigner signs with a private key held in memory.
+type LocalSigner struct {
+	privateKey *crypto.PrivateKey
+}
+
+// NewLocalSigner creates a signer with the given private key.
+func NewLocalSigner(privateKey *crypto.PrivateKey) *LocalSigner {
+	return &LocalSigner{privateKey: privateKey}
+}
+
+// Address returns the address of the signer.
+func (s *LocalSigner) Address() common.Address {
+	return s.privateKey.PublicKey().Address()
+}
+
+// SignVote signs the vote.
+func (s *LocalSigner) SignVote(vote *Vote) error {
+	sig, err := s.privateKey.Sign(vote.SignBytes())
+	if err != nil {
+		return err
+	}
+	vote.SetSignature(sig)
+	return nil
+}
+
+// SignBlock signs the block header.
+func (s *LocalSigner) SignBlock(header *BlockHeader) error {
+	sig, err := s.privateKey.Sign(header.SignBytes())
+	if err != nil {
+		return err
+	}
+	header.SetSignature(sig)
+	return nil
+}
+
+// SignTx signs the sign bytes of a transaction.
+func (s *LocalSigner) SignTx(signBytes common.Bytes) (*crypto.Signature, error) {
+	return s.privateKey.Sign(signBytes)
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+)
+
+// MaxSlashBasisPoints is the basis points of the whole stake.
+const MaxSlashBasisPoints uint64 = 10000
+
+// SlashingRules are the rules to slash the validators proven to sign conflicting consensus
+// messages. They are set in the genesis, and the chains without them do not slash.
+type SlashingRules struct {
+	DuplicateVoteSlashBasisPoints     uint64 // fraction of the stake slashed for a duplicate vote, in 1/10000
+	DuplicateProposalSlashBasisPoints uint64 // fraction of the stake slashed for a duplicate proposal, in 1/10000
+	MaxEvidenceAge                    uint64 // number of blocks after the conflicting blocks the evidence can be included
+}
+
+// DefaultSlashingRules returns the rules used by the genesis generator unless overridden. The
+// evidence expires with the return locking period, so the stake withdrawn after the
+// misbehavior is still slashed.
+func DefaultSlashingRules() *SlashingRules {
+	return &SlashingRules{
+		DuplicateVoteSlashBasisPoints:     500,
+		DuplicateProposalSlashBasisPoints: 500,
+		MaxEvidenceAge:                    ReturnLockingPeriod,
+	}
+}
+
+func (r *SlashingRules) String() string {
+	return fmt.Sprintf("SlashingRules{DuplicateVote: %v, DuplicateProposal: %v, MaxEvidenceAge: %v}",
+		r.DuplicateVoteSlashBasisPoints, r.DuplicateProposalSlashBasisPoints, r.MaxEvidenceAge)
+}
+
+// Validate checks that the slash fractions are at most the whole stake.
+func (r *SlashingRules) Validate() error {
+	if r.DuplicateVoteSlashBasisPoints > MaxSlashBasisPoints || r.DuplicateProposalSlashBasisPoints > MaxSlashBasisPoints {
+		return fmt.Errorf("Slash basis points cannot exceed %v: %v", MaxSlashBasisPoints, r)
+	}
+	if r.MaxEvidenceAge == 0 {
+		return fmt.Errorf("Max evidence age cannot be zero")
+	}
+	return nil
+}
+
+// SlashBasisPoints returns the fraction of the stake slashed for the misbehavior, in 1/10000.
+func (r *SlashingRules) SlashBasisPoints(evidenceType EvidenceType) uint64 {
+	switch evidenceType {
+	case EvidenceTypeDuplicateVote:
+		return r.DuplicateVoteSlashBasisPoints
+	case EvidenceTypeDuplicateProposal:
+		return r.DuplicateProposalSlashBasisPoints
+	default:
+		return 0
+	}
+}
@@ -5,24 +5,105 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/rlp"
 )
 
 const SnapshotHeaderMagic = "ThetaToDaMoon"
+
+// BlockTrioStoreKeyPrefix is the prefix of the legacy block trio keys, see LegacyBlockTrioKey.
 const BlockTrioStoreKeyPrefix = "prooftrio_"
+
 const (
 	SVStart = iota
 	SVEnd
 )
 
+// SnapshotPrefixCompressed is set in the snapshot header flags if the keys of the records
+// within each store view are delta encoded against the previous key.
+const SnapshotPrefixCompressed uint = 1 << 8
+
+// SnapshotTypedRecords is set in the snapshot header flags if each record carries its
+// record type explicitly.
+const SnapshotTypedRecords uint = 1 << 9
+
+const snapshotCodecFlags = SnapshotPrefixCompressed | SnapshotTypedRecords
+
+// SnapshotFiltered is set in the snapshot header flags if some accounts were excluded from
+// the exported state, in which case the state does not match the state root of the snapshot
+// block.
+const SnapshotFiltered uint = 1 << 10
+
+// SnapshotDiff is set in the snapshot header flags if the snapshot only contains the state
+// delta against a base snapshot, described by the SnapshotDiffBase section following the header.
+const SnapshotDiff uint = 1 << 11
+
+// SnapshotChecksummed is set in the snapshot header flags if each record following the header
+// carries a checksum, and the records are terminated by a trailer checksum of the whole content.
+const SnapshotChecksummed uint = 1 << 12
+
+// SnapshotDiffBase identifies the state a snapshot diff applies on top of.
+type SnapshotDiffBase struct {
+	Height    uint64
+	BlockHash common.Hash
+	StateHash common.Hash
+}
+
+// SnapshotRecordType is the kind of a V2 snapshot record.
+type SnapshotRecordType uint8
+
+const (
+	SnapshotRecordUntyped SnapshotRecordType = iota // legacy record, the type is derived from the key
+	SnapshotRecordSVStart
+	SnapshotRecordSVEnd
+	SnapshotRecordState
+	SnapshotRecordAccount
+)
+
 type SnapshotTrieRecord struct {
 	K common.Bytes // key
 	V common.Bytes // value
+
+	// Type is not encoded with the record. It is set when reading a typed record, and is
+	// SnapshotRecordUntyped for the legacy records.
+	Type SnapshotRecordType `rlp:"-"`
+}
+
+// RecordType returns the type of the record. For the legacy untyped records, the type is
+// derived from the store view markers and the account key prefix.
+func (r *SnapshotTrieRecord) RecordType() SnapshotRecordType {
+	if r.Type != SnapshotRecordUntyped {
+		return r.Type
+	}
+	if bytes.Equal(r.K, []byte{SVStart}) {
+		return SnapshotRecordSVStart
+	}
+	if bytes.Equal(r.K, []byte{SVEnd}) {
+		return SnapshotRecordSVEnd
+	}
+	if bytes.HasPrefix(r.K, []byte("ls/a")) {
+		return SnapshotRecordAccount
+	}
+	return SnapshotRecordState
+}
+
+// SnapshotTypedTrieRecord is the encoding of a trie record with an explicit record type.
+type SnapshotTypedTrieRecord struct {
+	Type SnapshotRecordType
+	K    common.Bytes // key
+	V    common.Bytes // value
+}
+
+// SnapshotCompressedTrieRecord is a trie record whose key shares the first SharedLen bytes
+// with the key of the previous record.
+type SnapshotCompressedTrieRecord struct {
+	SharedLen uint64
+	KSuffix   common.Bytes // key without the shared prefix
+	V         common.Bytes // value
 }
 
 type SnapshotFirstBlock struct {
@@ -48,11 +129,311 @@ type SnapshotBlockTrio struct {
 type SnapshotHeader struct {
 	Magic   string
 	Version uint
+	Flags   uint // the snapshot format flags, encoded only if any flag is set
+}
+
+// snapshotHeaderNoFlags is the encoding of a snapshot header without any flag, which is also
+// the encoding of the header before the flags were introduced, so that older nodes can still
+// read the unflagged snapshots.
+type snapshotHeaderNoFlags struct {
+	Magic   string
+	Version uint
+}
+
+// snapshotHeaderWithFlags is the encoding of a snapshot header with flags.
+type snapshotHeaderWithFlags struct {
+	Magic   string
+	Version uint
+	Flags   uint
+}
+
+var _ rlp.Encoder = (*SnapshotHeader)(nil)
+
+// EncodeRLP implements RLP Encoder interface.
+func (h SnapshotHeader) EncodeRLP(w io.Writer) error {
+	if h.Flags == 0 {
+		return rlp.Encode(w, snapshotHeaderNoFlags{Magic: h.Magic, Version: h.Version})
+	}
+	return rlp.Encode(w, snapshotHeaderWithFlags{Magic: h.Magic, Version: h.Version, Flags: h.Flags})
+}
+
+var _ rlp.Decoder = (*SnapshotHeader)(nil)
+
+// DecodeRLP implements RLP Decoder interface. The encoding is told apart by the number of fields.
+func (h *SnapshotHeader) DecodeRLP(stream *rlp.Stream) error {
+	raw, err := stream.Raw()
+	if err != nil {
+		return err
+	}
+	content, _, err := rlp.SplitList(raw)
+	if err != nil {
+		return err
+	}
+	numFields, err := rlp.CountValues(content)
+	if err != nil {
+		return err
+	}
+	switch numFields {
+	case 2:
+		noFlags := snapshotHeaderNoFlags{}
+		if err = rlp.DecodeBytes(raw, &noFlags); err != nil {
+			return err
+		}
+		*h = SnapshotHeader{Magic: noFlags.Magic, Version: noFlags.Version}
+	case 3:
+		withFlags := snapshotHeaderWithFlags{}
+		if err = rlp.DecodeBytes(raw, &withFlags); err != nil {
+			return err
+		}
+		*h = SnapshotHeader{Magic: withFlags.Magic, Version: withFlags.Version, Flags: withFlags.Flags}
+	default:
+		return fmt.Errorf("Invalid snapshot header with %v fields", numFields)
+	}
+	return nil
 }
 
+// FormatVersion returns the snapshot format version.
+func (h *SnapshotHeader) FormatVersion() uint {
+	return h.Version
+}
+
+// CodecFlags returns the flags of the record encoding.
+func (h *SnapshotHeader) CodecFlags() uint {
+	return h.Flags & snapshotCodecFlags
+}
+
+// IsPrefixCompressed returns whether the snapshot records are prefix compressed.
+func (h *SnapshotHeader) IsPrefixCompressed() bool {
+	return h.Flags&SnapshotPrefixCompressed != 0
+}
+
+// IsFiltered returns whether some accounts were excluded from the snapshot state.
+func (h *SnapshotHeader) IsFiltered() bool {
+	return h.Flags&SnapshotFiltered != 0
+}
+
+// IsDiff returns whether the snapshot only contains the state delta against a base snapshot.
+func (h *SnapshotHeader) IsDiff() bool {
+	return h.Flags&SnapshotDiff != 0
+}
+
+// HasRecordChecksums returns whether the snapshot records carry checksums.
+func (h *SnapshotHeader) HasRecordChecksums() bool {
+	return h.Flags&SnapshotChecksummed != 0
+}
+
+// HasTypedRecords returns whether the snapshot records carry an explicit record type.
+func (h *SnapshotHeader) HasTypedRecords() bool {
+	return h.Flags&SnapshotTypedRecords != 0
+}
+
+// Snapshot format versions, i.e. the version in the snapshot header, which can be loaded.
+// Version 1 snapshots have no header at all and start with the metadata.
+const (
+	MinSnapshotFormatVersion     uint = 1
+	CurrentSnapshotFormatVersion uint = 4
+)
+
+// Snapshot metadata versions. The legacy metadata has no version field, version 2 adds the
+// pruned state hash, version 3 the next validator set proof, version 4 the vote signature
+// scheme, version 5 the chunk root.
+const (
+	SnapshotMetadataVersionLegacy  uint = 0
+	SnapshotMetadataVersion1       uint = 1
+	SnapshotMetadataVersion2       uint = 2
+	SnapshotMetadataVersion3       uint = 3
+	SnapshotMetadataVersion4       uint = 4
+	SnapshotMetadataVersion5       uint = 5
+	CurrentSnapshotMetadataVersion uint = SnapshotMetadataVersion5
+)
+
 type SnapshotMetadata struct {
 	ProofTrios []SnapshotBlockTrio
 	TailTrio   SnapshotBlockTrio
+
+	// Version is the version of the metadata encoding. The legacy metadata is encoded without
+	// the version, so that it is decoded as is by the nodes predating the version field.
+	Version uint
+
+	// PrunedStateHash is the root of the snapshot block state without the accounts excluded on
+	// export, which is the root of the state loaded from a filtered snapshot. It is empty if
+	// the snapshot is not filtered. Encoded from version 2 on.
+	PrunedStateHash common.Hash
+
+	// NextVCPProof proves the validator candidate pool of the snapshot block state if the
+	// snapshot block has a validator update, i.e. the validator set taking over once the update
+	// is confirmed. Empty otherwise. Encoded from version 3 on.
+	NextVCPProof VCPProof
+
+	// VoteScheme is the signature scheme of the votes in the snapshot, empty for the ECDSA
+	// votes of the earlier versions. Encoded from version 4 on.
+	VoteScheme string
+
+	// ChunkRoot is the Merkle root of the chunks of ChunkSize bytes the snapshot content
+	// following the metadata is split into for distribution, empty if the snapshot is not
+	// split. Encoded from version 5 on.
+	ChunkRoot common.Hash
+	ChunkSize uint64
+}
+
+// HasNextVCPProof returns whether the metadata carries the next validator set proof.
+func (m *SnapshotMetadata) HasNextVCPProof() bool {
+	return len(m.NextVCPProof.GetKvs()) != 0
+}
+
+// snapshotMetadataLegacy is the encoding of the legacy snapshot metadata.
+type snapshotMetadataLegacy struct {
+	ProofTrios []SnapshotBlockTrio
+	TailTrio   SnapshotBlockTrio
+}
+
+// snapshotMetadataV1 is the encoding of the version 1 snapshot metadata.
+type snapshotMetadataV1 struct {
+	ProofTrios []SnapshotBlockTrio
+	TailTrio   SnapshotBlockTrio
+	Version    uint
+}
+
+// snapshotMetadataV2 is the encoding of the version 2 snapshot metadata.
+type snapshotMetadataV2 struct {
+	ProofTrios      []SnapshotBlockTrio
+	TailTrio        SnapshotBlockTrio
+	Version         uint
+	PrunedStateHash common.Hash
+}
+
+// snapshotMetadataV3 is the encoding of the version 3 snapshot metadata.
+type snapshotMetadataV3 struct {
+	ProofTrios      []SnapshotBlockTrio
+	TailTrio        SnapshotBlockTrio
+	Version         uint
+	PrunedStateHash common.Hash
+	NextVCPProof    VCPProof
+}
+
+// snapshotMetadataV4 is the encoding of the version 4 snapshot metadata.
+type snapshotMetadataV4 struct {
+	ProofTrios      []SnapshotBlockTrio
+	TailTrio        SnapshotBlockTrio
+	Version         uint
+	PrunedStateHash common.Hash
+	NextVCPProof    VCPProof
+	VoteScheme      string
+}
+
+// snapshotMetadataV5 is the encoding of the version 5 snapshot metadata.
+type snapshotMetadataV5 struct {
+	ProofTrios      []SnapshotBlockTrio
+	TailTrio        SnapshotBlockTrio
+	Version         uint
+	PrunedStateHash common.Hash
+	NextVCPProof    VCPProof
+	VoteScheme      string
+	ChunkRoot       common.Hash
+	ChunkSize       uint64
+}
+
+var _ rlp.Encoder = (*SnapshotMetadata)(nil)
+
+// EncodeRLP implements RLP Encoder interface.
+func (m SnapshotMetadata) EncodeRLP(w io.Writer) error {
+	switch m.Version {
+	case SnapshotMetadataVersionLegacy:
+		return rlp.Encode(w, snapshotMetadataLegacy{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio})
+	case SnapshotMetadataVersion1:
+		return rlp.Encode(w, snapshotMetadataV1{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio, Version: m.Version})
+	case SnapshotMetadataVersion2:
+		return rlp.Encode(w, snapshotMetadataV2{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio, Version: m.Version, PrunedStateHash: m.PrunedStateHash})
+	case SnapshotMetadataVersion3:
+		return rlp.Encode(w, snapshotMetadataV3{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio, Version: m.Version,
+			PrunedStateHash: m.PrunedStateHash, NextVCPProof: m.NextVCPProof})
+	case SnapshotMetadataVersion4:
+		return rlp.Encode(w, snapshotMetadataV4{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio, Version: m.Version,
+			PrunedStateHash: m.PrunedStateHash, NextVCPProof: m.NextVCPProof, VoteScheme: m.VoteScheme})
+	default:
+		return rlp.Encode(w, snapshotMetadataV5{ProofTrios: m.ProofTrios, TailTrio: m.TailTrio, Version: m.Version,
+			PrunedStateHash: m.PrunedStateHash, NextVCPProof: m.NextVCPProof, VoteScheme: m.VoteScheme,
+			ChunkRoot: m.ChunkRoot, ChunkSize: m.ChunkSize})
+	}
+}
+
+var _ rlp.Decoder = (*SnapshotMetadata)(nil)
+
+// DecodeRLP implements RLP Decoder interface. The encoding is told apart by the number of
+// fields, the version is checked by the snapshot loader.
+func (m *SnapshotMetadata) DecodeRLP(stream *rlp.Stream) error {
+	raw, err := stream.Raw()
+	if err != nil {
+		return err
+	}
+	content, _, err := rlp.SplitList(raw)
+	if err != nil {
+		return err
+	}
+	numFields, err := rlp.CountValues(content)
+	if err != nil {
+		return err
+	}
+	switch numFields {
+	case 2:
+		legacy := snapshotMetadataLegacy{}
+		if err = rlp.DecodeBytes(raw, &legacy); err != nil {
+			return err
+		}
+		*m = SnapshotMetadata{ProofTrios: legacy.ProofTrios, TailTrio: legacy.TailTrio, Version: SnapshotMetadataVersionLegacy}
+	case 3:
+		v1 := snapshotMetadataV1{}
+		if err = rlp.DecodeBytes(raw, &v1); err != nil {
+			return err
+		}
+		if v1.Version != SnapshotMetadataVersion1 {
+			return fmt.Errorf("Invalid snapshot metadata version: %v", v1.Version)
+		}
+		*m = SnapshotMetadata{ProofTrios: v1.ProofTrios, TailTrio: v1.TailTrio, Version: v1.Version}
+	case 4:
+		v2 := snapshotMetadataV2{}
+		if err = rlp.DecodeBytes(raw, &v2); err != nil {
+			return err
+		}
+		if v2.Version != SnapshotMetadataVersion2 {
+			return fmt.Errorf("Invalid snapshot metadata version: %v", v2.Version)
+		}
+		*m = SnapshotMetadata{ProofTrios: v2.ProofTrios, TailTrio: v2.TailTrio, Version: v2.Version, PrunedStateHash: v2.PrunedStateHash}
+	case 5:
+		v3 := snapshotMetadataV3{}
+		if err = rlp.DecodeBytes(raw, &v3); err != nil {
+			return err
+		}
+		if v3.Version < SnapshotMetadataVersion3 {
+			return fmt.Errorf("Invalid snapshot metadata version: %v", v3.Version)
+		}
+		*m = SnapshotMetadata{ProofTrios: v3.ProofTrios, TailTrio: v3.TailTrio, Version: v3.Version,
+			PrunedStateHash: v3.PrunedStateHash, NextVCPProof: v3.NextVCPProof}
+	case 6:
+		v4 := snapshotMetadataV4{}
+		if err = rlp.DecodeBytes(raw, &v4); err != nil {
+			return err
+		}
+		if v4.Version < SnapshotMetadataVersion4 {
+			return fmt.Errorf("Invalid snapshot metadata version: %v", v4.Version)
+		}
+		*m = SnapshotMetadata{ProofTrios: v4.ProofTrios, TailTrio: v4.TailTrio, Version: v4.Version,
+			PrunedStateHash: v4.PrunedStateHash, NextVCPProof: v4.NextVCPProof, VoteScheme: v4.VoteScheme}
+	case 8:
+		v5 := snapshotMetadataV5{}
+		if err = rlp.DecodeBytes(raw, &v5); err != nil {
+			return err
+		}
+		if v5.Version < SnapshotMetadataVersion5 {
+			return fmt.Errorf("Invalid snapshot metadata version: %v", v5.Version)
+		}
+		*m = SnapshotMetadata{ProofTrios: v5.ProofTrios, TailTrio: v5.TailTrio, Version: v5.Version,
+			PrunedStateHash: v5.PrunedStateHash, NextVCPProof: v5.NextVCPProof, VoteScheme: v5.VoteScheme,
+			ChunkRoot: v5.ChunkRoot, ChunkSize: v5.ChunkSize}
+	default:
+		return fmt.Errorf("Unknown snapshot metadata encoding with %v fields", numFields)
+	}
+	return nil
 }
 
 type LastCheckpoint struct {
@@ -80,6 +461,16 @@ func WriteLastCheckpoint(writer *bufio.Writer, lastCheckpoint *LastCheckpoint) e
 	return err
 }
 
+func WriteDiffBase(writer *bufio.Writer, diffBase *SnapshotDiffBase) error {
+	raw, err := rlp.EncodeToBytes(*diffBase)
+	if err != nil {
+		logger.Errorf("Failed to encode snapshot diff base: %v", err)
+		return err
+	}
+	err = writeBytes(writer, raw)
+	return err
+}
+
 func WriteMetadata(writer *bufio.Writer, metadata *SnapshotMetadata) error {
 	raw, err := rlp.EncodeToBytes(*metadata)
 	if err != nil {
@@ -101,6 +492,28 @@ func WriteRecord(writer *bufio.Writer, k, v common.Bytes) error {
 	return err
 }
 
+func WriteCompressedRecord(writer *bufio.Writer, sharedLen uint64, kSuffix, v common.Bytes) error {
+	record := SnapshotCompressedTrieRecord{SharedLen: sharedLen, KSuffix: kSuffix, V: v}
+	raw, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		logger.Errorf("Failed to encode compressed record: %v", err)
+		return err
+	}
+	err = writeBytes(writer, raw)
+	return err
+}
+
+func WriteTypedRecord(writer *bufio.Writer, recordType SnapshotRecordType, k, v common.Bytes) error {
+	record := SnapshotTypedTrieRecord{Type: recordType, K: k, V: v}
+	raw, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		logger.Errorf("Failed to encode typed record: %v", err)
+		return err
+	}
+	err = writeBytes(writer, raw)
+	return err
+}
+
 func writeBytes(writer *bufio.Writer, raw []byte) error {
 	// write length first
 	_, err := writer.Write(Itobytes(uint64(len(raw))))
@@ -121,9 +534,73 @@ func writeBytes(writer *bufio.Writer, raw []byte) error {
 	return nil
 }
 
-func ReadRecord(file *os.File, obj interface{}) (uint64, error) {
+// maxSnapshotHeaderSize bounds the encoded size of the snapshot header, so that a file which
+// is not a snapshot can be rejected without allocating a buffer for a bogus record length.
+const maxSnapshotHeaderSize = 1024
+
+// ErrNotSnapshotFile is returned when a file does not start with the snapshot header magic.
+var ErrNotSnapshotFile = errors.New("not a snapshot file")
+
+// ReadSnapshotHeader reads the snapshot header at the start of the file and verifies its magic.
+// It returns ErrNotSnapshotFile if the file does not start with a valid snapshot header.
+func ReadSnapshotHeader(reader io.Reader) (*SnapshotHeader, error) {
 	sizeBytes := make([]byte, 8)
-	n, err := io.ReadAtLeast(file, sizeBytes, 8)
+	_, err := io.ReadFull(reader, sizeBytes)
+	if err != nil {
+		return nil, ErrNotSnapshotFile
+	}
+	size := Bytestoi(sizeBytes)
+	if size == 0 || size > maxSnapshotHeaderSize {
+		return nil, ErrNotSnapshotFile
+	}
+	raw := make([]byte, size)
+	_, err = io.ReadFull(reader, raw)
+	if err != nil {
+		return nil, ErrNotSnapshotFile
+	}
+	snapshotHeader := &SnapshotHeader{}
+	err = rlp.DecodeBytes(raw, snapshotHeader)
+	if err != nil || snapshotHeader.Magic != SnapshotHeaderMagic {
+		return nil, ErrNotSnapshotFile
+	}
+	return snapshotHeader, nil
+}
+
+// maxLegacySnapshotMetadataSize bounds the encoded size of the metadata a headerless version 1
+// snapshot starts with, so that a file which is not a snapshot can be rejected without
+// allocating a buffer for a bogus record length.
+const maxLegacySnapshotMetadataSize = 1 << 30
+
+// PeekSnapshotHeader reads the snapshot header like ReadSnapshotHeader, but a file which
+// starts with a record that is not a snapshot header is taken as a headerless version 1
+// snapshot. In that case nothing is consumed from the reader, so that the metadata can be read
+// next, and a version 1 header is returned. The caller still needs to return
+// ErrNotSnapshotFile if the metadata of a version 1 snapshot fails to decode.
+func PeekSnapshotHeader(reader *bufio.Reader) (*SnapshotHeader, error) {
+	sizeBytes, err := reader.Peek(8)
+	if err != nil {
+		return nil, ErrNotSnapshotFile
+	}
+	size := Bytestoi(sizeBytes)
+	if size > 0 && size <= maxSnapshotHeaderSize {
+		raw, err := reader.Peek(8 + int(size))
+		if err == nil {
+			snapshotHeader := &SnapshotHeader{}
+			if rlp.DecodeBytes(raw[8:], snapshotHeader) == nil && snapshotHeader.Magic == SnapshotHeaderMagic {
+				_, err = reader.Discard(len(raw))
+				return snapshotHeader, err
+			}
+		}
+	}
+	if size == 0 || size > maxLegacySnapshotMetadataSize {
+		return nil, ErrNotSnapshotFile
+	}
+	return &SnapshotHeader{Version: 1}, nil
+}
+
+func ReadRecord(reader io.Reader, obj interface{}) (uint64, error) {
+	sizeBytes := make([]byte, 8)
+	n, err := io.ReadAtLeast(reader, sizeBytes, 8)
 	if err != nil {
 		return 0, err
 	}
@@ -132,7 +609,7 @@ func ReadRecord(file *os.File, obj interface{}) (uint64, error) {
 	}
 	size := Bytestoi(sizeBytes)
 	bytes := make([]byte, size)
-	n, err = io.ReadAtLeast(file, bytes, int(size))
+	n, err = io.ReadAtLeast(reader, bytes, int(size))
 	if err != nil {
 		return 0, err
 	}
@@ -143,6 +620,68 @@ func ReadRecord(file *os.File, obj interface{}) (uint64, error) {
 	return size, err
 }
 
+// RecordReader reads snapshot trie records while reusing a single read buffer across
+// records to reduce allocations.
+type RecordReader struct {
+	reader  io.Reader
+	sizeBuf [8]byte
+	buf     []byte
+}
+
+// NewRecordReader creates a new RecordReader.
+func NewRecordReader(reader io.Reader) *RecordReader {
+	return &RecordReader{
+		reader: reader,
+	}
+}
+
+// ReadTrieRecord reads the next trie record without copying. The K and V slices of the record
+// point into the internal read buffer, and thus are only valid until the next read. The caller
+// needs to copy them if they are retained.
+func (rr *RecordReader) ReadTrieRecord(record *SnapshotTrieRecord) (uint64, error) {
+	_, err := io.ReadFull(rr.reader, rr.sizeBuf[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("Failed to read record length")
+		}
+		return 0, err
+	}
+	size := Bytestoi(rr.sizeBuf[:])
+	if uint64(cap(rr.buf)) < size {
+		rr.buf = make([]byte, size)
+	}
+	rr.buf = rr.buf[:size]
+	n, err := io.ReadFull(rr.reader, rr.buf)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("Failed to read record, %v < %v", n, size)
+		}
+		return 0, err
+	}
+
+	content, rest, err := rlp.SplitList(rr.buf)
+	if err != nil {
+		return 0, err
+	}
+	if len(rest) > 0 {
+		return 0, rlp.ErrMoreThanOneValue
+	}
+	k, content, err := rlp.SplitString(content)
+	if err != nil {
+		return 0, err
+	}
+	v, content, err := rlp.SplitString(content)
+	if err != nil {
+		return 0, err
+	}
+	if len(content) > 0 {
+		return 0, fmt.Errorf("Unexpected trailing data in trie record")
+	}
+	record.K = k
+	record.V = v
+	return size, nil
+}
+
 func Bytestoi(arr []byte) uint64 {
 	return binary.LittleEndian.Uint64(arr)
 }
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestSnapshotMetadataEncoding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tailTrio := SnapshotBlockTrio{}
+	tailTrio.Second.Header = &BlockHeader{ChainID: "testchain", Height: 10, Timestamp: big.NewInt(1)}
+
+	// The legacy metadata is encoded as before, and decoded without a version.
+	legacyRaw, err := rlp.EncodeToBytes(snapshotMetadataLegacy{TailTrio: tailTrio})
+	require.Nil(err)
+	raw, err := rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio})
+	require.Nil(err)
+	assert.Equal(legacyRaw, raw)
+
+	legacy := SnapshotMetadata{Version: CurrentSnapshotMetadataVersion}
+	require.Nil(rlp.DecodeBytes(legacyRaw, &legacy))
+	assert.Equal(SnapshotMetadataVersionLegacy, legacy.Version)
+	assert.Equal(uint64(10), legacy.TailTrio.Second.Header.Height)
+
+	// The versioned metadata round trips.
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: CurrentSnapshotMetadataVersion})
+	require.Nil(err)
+	versioned := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &versioned))
+	assert.Equal(CurrentSnapshotMetadataVersion, versioned.Version)
+	assert.Equal(uint64(10), versioned.TailTrio.Second.Header.Height)
+
+	// The version 1 metadata, without the pruned state hash, is still decoded.
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: SnapshotMetadataVersion1})
+	require.Nil(err)
+	v1 := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &v1))
+	assert.Equal(SnapshotMetadataVersion1, v1.Version)
+
+	// The pruned state hash round trips.
+	prunedStateHash := common.HexToHash("0x1234")
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: SnapshotMetadataVersion2, PrunedStateHash: prunedStateHash})
+	require.Nil(err)
+	v2 := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &v2))
+	assert.Equal(prunedStateHash, v2.PrunedStateHash)
+	assert.False(v2.HasNextVCPProof())
+
+	// The next validator set proof round trips.
+	nextVCPProof := VCPProof{}
+	require.Nil(nextVCPProof.Put([]byte{0x1}, []byte{0x2}))
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: SnapshotMetadataVersion3, NextVCPProof: nextVCPProof})
+	require.Nil(err)
+	v3 := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &v3))
+	assert.True(v3.HasNextVCPProof())
+	value, err := v3.NextVCPProof.Get([]byte{0x1})
+	require.Nil(err)
+	assert.Equal([]byte{0x2}, value)
+
+	// The vote scheme round trips.
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: SnapshotMetadataVersion4, VoteScheme: "bls"})
+	require.Nil(err)
+	v4 := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &v4))
+	assert.Equal("bls", v4.VoteScheme)
+
+	// The chunk root round trips.
+	chunkRoot := common.HexToHash("0x5678")
+	raw, err = rlp.EncodeToBytes(SnapshotMetadata{TailTrio: tailTrio, Version: SnapshotMetadataVersion5, ChunkRoot: chunkRoot, ChunkSize: 1024})
+	require.Nil(err)
+	v5 := SnapshotMetadata{}
+	require.Nil(rlp.DecodeBytes(raw, &v5))
+	assert.Equal(chunkRoot, v5.ChunkRoot)
+	assert.Equal(uint64(1024), v5.ChunkSize)
+
+	// An unknown encoding is rejected.
+	raw, err = rlp.EncodeToBytes([]uint{1, 2, 3, 4, 5, 6, 7})
+	require.Nil(err)
+	assert.NotNil(rlp.DecodeBytes(raw, &SnapshotMetadata{}))
+}
+
+func TestSnapshotHeaderEncoding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// A header without flags is encoded as before the flags were introduced, so that older
+	// nodes can read it.
+	raw, err := rlp.EncodeToBytes(SnapshotHeader{Magic: SnapshotHeaderMagic, Version: 4})
+	require.Nil(err)
+	noFlags := snapshotHeaderNoFlags{}
+	require.Nil(rlp.DecodeBytes(raw, &noFlags))
+	assert.Equal(uint(4), noFlags.Version)
+	header := SnapshotHeader{}
+	require.Nil(rlp.DecodeBytes(raw, &header))
+	assert.Equal(SnapshotHeader{Magic: SnapshotHeaderMagic, Version: 4}, header)
+
+	// The flags don't change the version.
+	raw, err = rlp.EncodeToBytes(SnapshotHeader{Magic: SnapshotHeaderMagic, Version: 4, Flags: SnapshotDiff | SnapshotChecksummed})
+	require.Nil(err)
+	header = SnapshotHeader{}
+	require.Nil(rlp.DecodeBytes(raw, &header))
+	assert.Equal(uint(4), header.FormatVersion())
+	assert.True(header.IsDiff())
+	assert.True(header.HasRecordChecksums())
+	assert.False(header.IsFiltered())
+}
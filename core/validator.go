@@ -179,17 +179,125 @@ func init() {
 
 type ValidatorCandidatePool struct {
 	SortedCandidates []*StakeHolder
+	SigningKeys      []*ValidatorSigningKey `rlp:"tail"` // encoded as the pool without rotations if empty
 }
 
+// ValidatorSigningKey is a rotation of the consensus signing key of a candidate: once active,
+// the candidate proposes and votes as the signer address instead of the holder address.
+type ValidatorSigningKey struct {
+	Holder          common.Address
+	Signer          common.Address
+	EffectiveHeight uint64
+	Active          bool
+}
+
+func (k *ValidatorSigningKey) String() string {
+	return fmt.Sprintf("{holder: %v, signer: %v, effectiveHeight: %v, active: %v}",
+		k.Holder, k.Signer, k.EffectiveHeight, k.Active)
+}
+
+// FindStakeDelegate returns the candidate with the holder address, or with the active signing
+// key of the address.
 func (vcp *ValidatorCandidatePool) FindStakeDelegate(delegateAddr common.Address) *StakeHolder {
 	for _, candidate := range vcp.SortedCandidates {
 		if candidate.Holder == delegateAddr {
 			return candidate
 		}
 	}
+	for _, key := range vcp.SigningKeys {
+		if key.Active && key.Signer == delegateAddr {
+			return vcp.findCandidate(key.Holder)
+		}
+	}
+	return nil
+}
+
+func (vcp *ValidatorCandidatePool) findCandidate(holder common.Address) *StakeHolder {
+	for _, candidate := range vcp.SortedCandidates {
+		if candidate.Holder == holder {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// SignerOf returns the address the holder signs the consensus messages with.
+func (vcp *ValidatorCandidatePool) SignerOf(holder common.Address) common.Address {
+	for _, key := range vcp.SigningKeys {
+		if key.Active && key.Holder == holder {
+			return key.Signer
+		}
+	}
+	return holder
+}
+
+// RotateSigningKey schedules the rotation of the signing key of the holder to the signer
+// address at the effective height, replacing the rotation already scheduled if any.
+func (vcp *ValidatorCandidatePool) RotateSigningKey(holder common.Address, signer common.Address, effectiveHeight uint64, currentHeight uint64) error {
+	if effectiveHeight <= currentHeight {
+		return fmt.Errorf("Effective height %v is not after the current height %v", effectiveHeight, currentHeight)
+	}
+	if (signer == common.Address{}) {
+		return fmt.Errorf("Signer address cannot be empty")
+	}
+	if vcp.findCandidate(holder) == nil {
+		return fmt.Errorf("No matched stake holder address found: %v", holder)
+	}
+	if signer != holder && vcp.findCandidate(signer) != nil {
+		return fmt.Errorf("Signer %v is a stake holder", signer)
+	}
+	for _, key := range vcp.SigningKeys {
+		if key.Holder != holder && key.Signer == signer {
+			return fmt.Errorf("Signer %v is used by stake holder %v", signer, key.Holder)
+		}
+	}
+
+	vcp.removeSigningKeys(func(key *ValidatorSigningKey) bool {
+		return key.Holder == holder && !key.Active
+	})
+	vcp.SigningKeys = append(vcp.SigningKeys, &ValidatorSigningKey{
+		Holder:          holder,
+		Signer:          signer,
+		EffectiveHeight: effectiveHeight,
+	})
 	return nil
 }
 
+// ActivateSigningKeys activates the rotations effective at the current height, and returns
+// whether any was.
+func (vcp *ValidatorCandidatePool) ActivateSigningKeys(currentHeight uint64) bool {
+	activated := []*ValidatorSigningKey{}
+	for _, key := range vcp.SigningKeys {
+		if !key.Active && key.EffectiveHeight <= currentHeight {
+			activated = append(activated, key)
+		}
+	}
+	for _, key := range activated {
+		logger.Infof("Signing key rotated: holder = %v, signer = %v", key.Holder, key.Signer)
+		vcp.removeSigningKeys(func(k *ValidatorSigningKey) bool {
+			return k.Holder == key.Holder && k.Active
+		})
+		key.Active = true
+		if key.Signer == key.Holder { // rotated back to the holder key
+			vcp.removeSigningKeys(func(k *ValidatorSigningKey) bool { return k == key })
+		}
+	}
+	return len(activated) > 0
+}
+
+func (vcp *ValidatorCandidatePool) removeSigningKeys(shouldRemove func(key *ValidatorSigningKey) bool) {
+	keys := []*ValidatorSigningKey{}
+	for _, key := range vcp.SigningKeys {
+		if !shouldRemove(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		keys = nil // keeps the encoding of the pool without rotations
+	}
+	vcp.SigningKeys = keys
+}
+
 func (vcp *ValidatorCandidatePool) GetTopStakeHolders(maxNumStakeHolders int) []*StakeHolder {
 	n := len(vcp.SortedCandidates)
 	if n > maxNumStakeHolders {
@@ -247,6 +355,35 @@ func (vcp *ValidatorCandidatePool) WithdrawStake(source common.Address, holder c
 	return nil
 }
 
+// SlashStake burns the fraction basisPoints/10000 of each stake of the holder, including the
+// ones being withdrawn, and withdraws the rest, which removes the holder from the candidates.
+// Returns the slashed amount.
+func (vcp *ValidatorCandidatePool) SlashStake(holder common.Address, basisPoints uint64, currentHeight uint64) (*big.Int, error) {
+	if basisPoints > MaxSlashBasisPoints {
+		return nil, fmt.Errorf("Invalid slash basis points: %v", basisPoints)
+	}
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return nil, fmt.Errorf("No matched stake holder address found: %v", holder)
+	}
+
+	slashedAmount := new(big.Int)
+	for _, stake := range candidate.Stakes {
+		slashed := new(big.Int).Mul(stake.Amount, new(big.Int).SetUint64(basisPoints))
+		slashed.Div(slashed, new(big.Int).SetUint64(MaxSlashBasisPoints))
+		stake.Amount = new(big.Int).Sub(stake.Amount, slashed)
+		slashedAmount.Add(slashedAmount, slashed)
+		if !stake.Withdrawn {
+			stake.Withdrawn = true
+			stake.ReturnHeight = currentHeight + ReturnLockingPeriod
+		}
+	}
+
+	vcp.sortCandidates()
+
+	return slashedAmount, nil
+}
+
 func (vcp *ValidatorCandidatePool) ReturnStakes(currentHeight uint64) []*Stake {
 	returnedStakes := []*Stake{}
 
@@ -271,6 +408,7 @@ func (vcp *ValidatorCandidatePool) ReturnStakes(currentHeight uint64) []*Stake {
 
 		if len(candidate.Stakes) == 0 { // the candidate's stake becomes zero, no need to keep track of the candidate anymore
 			vcp.SortedCandidates = append(vcp.SortedCandidates[:cidx], vcp.SortedCandidates[cidx+1:]...)
+			vcp.removeSigningKeys(func(key *ValidatorSigningKey) bool { return key.Holder == candidate.Holder })
 		}
 	}
 
@@ -10,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
 )
 
 func TestValidatorSet(t *testing.T) {
@@ -358,6 +359,117 @@ func TestValidatorSetUniqueSortedOrder(t *testing.T) {
 	assert.Equal(vcpJson3, vcpJson4)
 }
 
+func TestValidatorCandidatePoolSlashStake(t *testing.T) {
+	assert := assert.New(t)
+
+	holder := common.HexToAddress("0x111")
+	other := common.HexToAddress("0x222")
+	source1 := common.HexToAddress("0x333")
+	source2 := common.HexToAddress("0x444")
+	stake := new(big.Int).Mul(MinValidatorStakeDeposit, big.NewInt(2))
+
+	vcp := &ValidatorCandidatePool{}
+	assert.Nil(vcp.DepositStake(source1, holder, stake))
+	assert.Nil(vcp.DepositStake(source2, holder, MinValidatorStakeDeposit))
+	assert.Nil(vcp.DepositStake(source1, other, MinValidatorStakeDeposit))
+	assert.Nil(vcp.WithdrawStake(source2, holder, 10))
+
+	// The stake being withdrawn is slashed too, and keeps its return height.
+	slashed, err := vcp.SlashStake(holder, 500, 100)
+	assert.Nil(err)
+	expected := new(big.Int).Div(new(big.Int).Mul(new(big.Int).Add(stake, MinValidatorStakeDeposit), big.NewInt(5)), big.NewInt(100))
+	assert.Equal(0, expected.Cmp(slashed))
+
+	candidate := vcp.FindStakeDelegate(holder)
+	assert.NotNil(candidate)
+	assert.Equal(0, candidate.TotalStake().Cmp(Zero))
+	assert.Equal(other, vcp.SortedCandidates[0].Holder)
+	for _, s := range candidate.Stakes {
+		assert.True(s.Withdrawn)
+	}
+	assert.Equal(10+ReturnLockingPeriod, candidate.Stakes[1].ReturnHeight)
+	assert.Equal(100+ReturnLockingPeriod, candidate.Stakes[0].ReturnHeight)
+
+	// The rest is returned after the locking period.
+	returned := vcp.ReturnStakes(100 + ReturnLockingPeriod)
+	assert.Equal(2, len(returned))
+	assert.Nil(vcp.FindStakeDelegate(holder))
+
+	_, err = vcp.SlashStake(holder, 500, 200)
+	assert.NotNil(err)
+	_, err = vcp.SlashStake(other, MaxSlashBasisPoints+1, 200)
+	assert.NotNil(err)
+}
+
+func TestValidatorCandidatePoolRotateSigningKey(t *testing.T) {
+	assert := assert.New(t)
+
+	holder := common.HexToAddress("0x111")
+	other := common.HexToAddress("0x222")
+	source := common.HexToAddress("0x333")
+	signer := common.HexToAddress("0x555")
+	signer2 := common.HexToAddress("0x666")
+
+	vcp := &ValidatorCandidatePool{}
+	assert.Nil(vcp.DepositStake(source, holder, MinValidatorStakeDeposit))
+	assert.Nil(vcp.DepositStake(source, other, MinValidatorStakeDeposit))
+
+	// Without rotations the pool encodes as before.
+	legacy := struct{ SortedCandidates []*StakeHolder }{vcp.SortedCandidates}
+	legacyRaw, err := rlp.EncodeToBytes(legacy)
+	assert.Nil(err)
+	raw, err := rlp.EncodeToBytes(vcp)
+	assert.Nil(err)
+	assert.Equal(legacyRaw, raw)
+
+	assert.NotNil(vcp.RotateSigningKey(holder, signer, 10, 10))
+	assert.NotNil(vcp.RotateSigningKey(holder, common.Address{}, 20, 10))
+	assert.NotNil(vcp.RotateSigningKey(source, signer, 20, 10))
+	assert.NotNil(vcp.RotateSigningKey(holder, other, 20, 10))
+	assert.Nil(vcp.RotateSigningKey(holder, signer, 20, 10))
+	assert.NotNil(vcp.RotateSigningKey(other, signer, 20, 10))
+
+	// Not effective yet.
+	assert.False(vcp.ActivateSigningKeys(19))
+	assert.Equal(holder, vcp.SignerOf(holder))
+	assert.Nil(vcp.FindStakeDelegate(signer))
+
+	assert.True(vcp.ActivateSigningKeys(20))
+	assert.Equal(signer, vcp.SignerOf(holder))
+	assert.Equal(other, vcp.SignerOf(other))
+	assert.Equal(holder, vcp.FindStakeDelegate(signer).Holder)
+	assert.Equal(holder, vcp.FindStakeDelegate(holder).Holder)
+
+	var decoded ValidatorCandidatePool
+	raw, err = rlp.EncodeToBytes(vcp)
+	assert.Nil(err)
+	assert.Nil(rlp.DecodeBytes(raw, &decoded))
+	assert.Equal(signer, decoded.SignerOf(holder))
+
+	// A later rotation replaces the active key once effective.
+	assert.Nil(vcp.RotateSigningKey(holder, signer2, 30, 25))
+	assert.Equal(signer, vcp.SignerOf(holder))
+	assert.True(vcp.ActivateSigningKeys(30))
+	assert.Equal(signer2, vcp.SignerOf(holder))
+	assert.Nil(vcp.FindStakeDelegate(signer))
+	assert.Equal(1, len(vcp.SigningKeys))
+
+	// Rotating back to the holder key drops the rotation.
+	assert.Nil(vcp.RotateSigningKey(holder, holder, 40, 35))
+	assert.True(vcp.ActivateSigningKeys(40))
+	assert.Equal(holder, vcp.SignerOf(holder))
+	assert.Nil(vcp.SigningKeys)
+
+	// The rotation goes away with the stake.
+	assert.Nil(vcp.RotateSigningKey(other, signer, 50, 45))
+	assert.True(vcp.ActivateSigningKeys(50))
+	assert.Nil(vcp.WithdrawStake(source, other, 50))
+	vcp.ReturnStakes(50 + ReturnLockingPeriod)
+	assert.Nil(vcp.FindStakeDelegate(other))
+	assert.Nil(vcp.FindStakeDelegate(signer))
+	assert.Equal(0, len(vcp.SigningKeys))
+}
+
 // ------------------------- Utilities -------------------------
 
 func checkAndPrintAllSortedCandidates(t *testing.T, assert *assert.Assertions, vcp *ValidatorCandidatePool) {
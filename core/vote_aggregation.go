@@ -0,0 +1,215 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto/bls"
+)
+
+//
+// ------- SignerBitmap ------- //
+//
+
+// SignerBitmap marks the signers of an ordered list: the signer i is marked by the bit
+// 7 - i%8 of the byte i/8.
+type SignerBitmap common.Bytes
+
+// NewSignerBitmap creates an empty bitmap for the given number of signers.
+func NewSignerBitmap(numSigners int) SignerBitmap {
+	return make(SignerBitmap, (numSigners+7)/8)
+}
+
+// Set marks the signer i.
+func (b SignerBitmap) Set(i int) {
+	b[i/8] |= 0x80 >> uint(i%8)
+}
+
+// IsSet returns whether the signer i is marked.
+func (b SignerBitmap) IsSet(i int) bool {
+	if i < 0 || i/8 >= len(b) {
+		return false
+	}
+	return b[i/8]&(0x80>>uint(i%8)) != 0
+}
+
+// Count returns the number of marked signers.
+func (b SignerBitmap) Count() int {
+	count := 0
+	for _, x := range b {
+		count += bits.OnesCount8(x)
+	}
+	return count
+}
+
+// fits returns whether the bitmap is sized for the number of signers, without any mark past them.
+func (b SignerBitmap) fits(numSigners int) bool {
+	if len(b) != (numSigners+7)/8 {
+		return false
+	}
+	for i := numSigners; i < len(b)*8; i++ {
+		if b.IsSet(i) {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// ------- AggregatedVoteSet ------- //
+//
+
+// AggregatedVoteSet is the compact form of the BLS votes of a list of signers on a block: a
+// bitmap of the signers, and a single aggregated signature. Unlike AggregatedVotes, each
+// signer counts once, so it only merges disjoint vote sets.
+type AggregatedVoteSet struct {
+	Block     common.Hash    // Hash of the block.
+	SignerSet common.Hash    // Hash of the signer list, e.g. the guardian candidate pool.
+	Signers   SignerBitmap   // Signers of the votes.
+	Signature *bls.Signature // Aggregated signature.
+}
+
+// NewAggregatedVoteSet creates an empty vote set of the signers of the list with the given hash.
+func NewAggregatedVoteSet(block common.Hash, signerSet common.Hash, numSigners int) *AggregatedVoteSet {
+	return &AggregatedVoteSet{
+		Block:     block,
+		SignerSet: signerSet,
+		Signers:   NewSignerBitmap(numSigners),
+		Signature: bls.NewAggregateSignature(),
+	}
+}
+
+func (a *AggregatedVoteSet) String() string {
+	return fmt.Sprintf("AggregatedVoteSet{Block: %s, SignerSet: %s, Signers: %d}", a.Block.Hex(), a.SignerSet.Hex(), a.Signers.Count())
+}
+
+// signBytes returns the bytes to be signed, the same as the ones of AggregatedVotes, so the
+// two forms convert into each other.
+func (a *AggregatedVoteSet) signBytes() common.Bytes {
+	tmp := &AggregatedVotes{
+		Block: a.Block,
+		Gcp:   a.SignerSet,
+	}
+	return tmp.signBytes()
+}
+
+// Sign adds the vote of the signer. Returns false if the signer has already signed.
+func (a *AggregatedVoteSet) Sign(key *bls.SecretKey, signerIdx int) bool {
+	return a.Add(signerIdx, key.Sign(a.signBytes()))
+}
+
+// Add adds the signature of the signer. Returns false if the signer has already signed.
+func (a *AggregatedVoteSet) Add(signerIdx int, sig *bls.Signature) bool {
+	if a.Signers.IsSet(signerIdx) {
+		return false
+	}
+	a.Signers.Set(signerIdx)
+	a.Signature.Aggregate(sig)
+	return true
+}
+
+// Merge creates a new vote set that combines two vote sets with distinct signers.
+func (a *AggregatedVoteSet) Merge(b *AggregatedVoteSet) (*AggregatedVoteSet, error) {
+	if a.Block != b.Block || a.SignerSet != b.SignerSet || len(a.Signers) != len(b.Signers) {
+		return nil, errors.New("Cannot merge incompatible votes")
+	}
+	signers := make(SignerBitmap, len(a.Signers))
+	for i := range a.Signers {
+		if a.Signers[i]&b.Signers[i] != 0 {
+			return nil, errors.New("Cannot merge votes with common signers")
+		}
+		signers[i] = a.Signers[i] | b.Signers[i]
+	}
+	sig := a.Signature.Copy()
+	sig.Aggregate(b.Signature)
+	return &AggregatedVoteSet{
+		Block:     a.Block,
+		SignerSet: a.SignerSet,
+		Signers:   signers,
+		Signature: sig,
+	}, nil
+}
+
+// Validate verifies the vote set against the BLS public keys of the signer list.
+func (a *AggregatedVoteSet) Validate(pubKeys []*bls.PublicKey) result.Result {
+	if !a.Signers.fits(len(pubKeys)) {
+		return result.Error("signer bitmap of %d bytes does not fit %d signers", len(a.Signers), len(pubKeys))
+	}
+	if a.Signature == nil {
+		return result.Error("signature cannot be nil")
+	}
+	signerKeys := []*bls.PublicKey{}
+	for i, pubKey := range pubKeys {
+		if a.Signers.IsSet(i) {
+			signerKeys = append(signerKeys, pubKey)
+		}
+	}
+	if len(signerKeys) == 0 {
+		return result.Error("vote set has no signer")
+	}
+	if !a.Signature.Verify(a.signBytes(), bls.AggregatePublicKeys(signerKeys)) {
+		return result.Error("signature verification failed")
+	}
+	return result.OK
+}
+
+// Expand returns the votes of the list of signers in the AggregatedVotes form.
+func (a *AggregatedVoteSet) Expand(numSigners int) *AggregatedVotes {
+	multiplies := make([]uint32, numSigners)
+	for i := range multiplies {
+		if a.Signers.IsSet(i) {
+			multiplies[i] = 1
+		}
+	}
+	votes := &AggregatedVotes{
+		Block:      a.Block,
+		Gcp:        a.SignerSet,
+		Multiplies: multiplies,
+	}
+	if a.Signature != nil {
+		votes.Signature = a.Signature.Copy()
+	}
+	return votes
+}
+
+// Compress returns the votes in the AggregatedVoteSet form, or false if a guardian signature
+// is aggregated more than once, which a bitmap can't represent.
+func (a *AggregatedVotes) Compress() (*AggregatedVoteSet, bool) {
+	signers := NewSignerBitmap(len(a.Multiplies))
+	for i, m := range a.Multiplies {
+		if m > 1 {
+			return nil, false
+		}
+		if m == 1 {
+			signers.Set(i)
+		}
+	}
+	var sig *bls.Signature
+	if a.Signature != nil {
+		sig = a.Signature.Copy()
+	}
+	return &AggregatedVoteSet{
+		Block:     a.Block,
+		SignerSet: a.Gcp,
+		Signers:   signers,
+		Signature: sig,
+	}, true
+}
+
+// SignerBitmap returns the bitmap of the validators of the set, in their order, with a vote in
+// the vote set.
+func (s *VoteSet) SignerBitmap(validators *ValidatorSet) SignerBitmap {
+	bitmap := NewSignerBitmap(validators.Size())
+	for i, v := range validators.Validators() {
+		for _, vote := range s.votes {
+			if vote.ID == v.ID() {
+				bitmap.Set(i)
+				break
+			}
+		}
+	}
+	return bitmap
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestAggregatedVoteSet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pool, sks := createTestGuardianPool(20)
+	guardians := pool.WithStake()
+	pubKeys := guardians.PubKeys()
+	block := common.HexToHash("0x1234")
+
+	a := NewAggregatedVoteSet(block, pool.Hash(), guardians.Len())
+	b := NewAggregatedVoteSet(block, pool.Hash(), guardians.Len())
+	for i, g := range guardians.SortedGuardians {
+		if i%2 == 0 {
+			assert.True(a.Sign(sks[g.Holder], i))
+		} else if i < 11 {
+			assert.True(b.Sign(sks[g.Holder], i))
+		}
+	}
+	assert.False(a.Sign(sks[guardians.SortedGuardians[0].Holder], 0))
+	assert.True(a.Validate(pubKeys).IsOK())
+	assert.True(b.Validate(pubKeys).IsOK())
+	assert.True(a.Validate(pubKeys[:8]).IsError())
+
+	merged, err := a.Merge(b)
+	require.Nil(err)
+	assert.Equal(15, merged.Signers.Count())
+	assert.True(merged.Validate(pubKeys).IsOK())
+	_, err = merged.Merge(b)
+	assert.NotNil(err)
+
+	// The signers can't be altered.
+	forged, err := a.Merge(b)
+	require.Nil(err)
+	forged.Signers.Set(19)
+	assert.True(forged.Validate(pubKeys).IsError())
+
+	raw, err := rlp.EncodeToBytes(merged)
+	require.Nil(err)
+	decoded := &AggregatedVoteSet{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+	assert.True(decoded.Validate(pubKeys).IsOK())
+
+	// The two forms convert into each other.
+	votes := merged.Expand(guardians.Len())
+	assert.True(votes.Validate(pool).IsOK())
+	assert.Equal(15, votes.Abs())
+	compressed, ok := votes.Compress()
+	require.True(ok)
+	assert.True(compressed.Validate(pubKeys).IsOK())
+	rawVotes, err := rlp.EncodeToBytes(votes)
+	require.Nil(err)
+	assert.True(len(raw) < len(rawVotes))
+
+	// Merging a subset of the signers gives nothing new.
+	subset, err := votes.Merge(a.Expand(guardians.Len()))
+	require.Nil(err)
+	assert.Nil(subset)
+
+	// A guardian signature aggregated twice has no bitmap form.
+	votes, err = b.Expand(guardians.Len()).Merge(votes)
+	require.Nil(err)
+	require.NotNil(votes)
+	_, ok = votes.Compress()
+	assert.False(ok)
+}
+
+func TestVoteSetSignerBitmap(t *testing.T) {
+	assert := assert.New(t)
+
+	validators := NewValidatorSet()
+	for _, id := range []string{"0x1", "0x2", "0x3"} {
+		validators.AddValidator(NewValidator(id, big.NewInt(100)))
+	}
+	votes := NewVoteSet()
+	votes.AddVote(Vote{ID: common.HexToAddress("0x3"), Epoch: 1})
+	votes.AddVote(Vote{ID: common.HexToAddress("0x3"), Epoch: 2})
+	votes.AddVote(Vote{ID: common.HexToAddress("0x1"), Epoch: 2})
+	votes.AddVote(Vote{ID: common.HexToAddress("0x9"), Epoch: 2})
+
+	bitmap := votes.SignerBitmap(validators)
+	assert.Equal(1, len(bitmap))
+	assert.Equal(2, bitmap.Count())
+	assert.True(bitmap.IsSet(0))
+	assert.False(bitmap.IsSet(1))
+	assert.True(bitmap.IsSet(2))
+	assert.False(bitmap.IsSet(8))
+}
@@ -124,6 +124,20 @@ func (dp *Dispatcher) SendData(peerIDs []string, datarsp DataResponse) {
 	}
 }
 
+// GetSnapshot sends out the SnapshotRequest
+func (dp *Dispatcher) GetSnapshot(peerIDs []string, snapreq SnapshotRequest) {
+	if len(peerIDs) == 0 {
+		dp.broadcastToNeighbors(common.ChannelIDSnapshot, snapreq, true /* edge nodes don't serve snapshots */)
+	} else {
+		dp.send(peerIDs, common.ChannelIDSnapshot, snapreq)
+	}
+}
+
+// SendSnapshot sends out the SnapshotResponse
+func (dp *Dispatcher) SendSnapshot(peerIDs []string, snaprsp SnapshotResponse) {
+	dp.send(peerIDs, common.ChannelIDSnapshot, snaprsp)
+}
+
 // ID returns the ID of the node
 func (dp Dispatcher) ID() string {
 	if !reflect.ValueOf(dp.p2pnet).IsNil() {
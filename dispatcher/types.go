@@ -31,3 +31,42 @@ type DataResponse struct {
 	ChannelID common.ChannelIDEnum
 	Payload   common.Bytes
 }
+
+// SnapshotRequestType defines the type of data requested by a SnapshotRequest
+type SnapshotRequestType uint8
+
+const (
+	// SnapshotRequestManifest requests the chunk manifest of the snapshot served by the peer
+	SnapshotRequestManifest SnapshotRequestType = iota
+
+	// SnapshotRequestChunk requests a chunk of the snapshot with the given manifest root
+	SnapshotRequestChunk
+
+	// SnapshotRequestCheckpoint requests the tail block trio, i.e. the finalized checkpoint,
+	// of the snapshot served by the peer
+	SnapshotRequestCheckpoint
+
+	// SnapshotRequestMetadata requests the metadata, i.e. the validator set change proofs and
+	// the tail block trio, of the snapshot served by the peer
+	SnapshotRequestMetadata
+
+	// SnapshotRequestHeaders requests the finalized block headers above the height given as
+	// the ChunkIndex, each along with the votes endorsing it
+	SnapshotRequestHeaders
+)
+
+// SnapshotRequest defines the structure of the snapshot state sync request
+type SnapshotRequest struct {
+	Type       SnapshotRequestType
+	Root       common.Hash // Manifest root, ignored for manifest requests.
+	ChunkIndex uint64      // The chunk index, or the height the requested headers follow.
+}
+
+// SnapshotResponse defines the structure of the snapshot state sync response. An empty
+// payload means the peer doesn't serve the requested data.
+type SnapshotResponse struct {
+	Type       SnapshotRequestType
+	Root       common.Hash
+	ChunkIndex uint64
+	Payload    common.Bytes // RLP encoded manifest, block trio, metadata or headers, or the chunk data.
+}
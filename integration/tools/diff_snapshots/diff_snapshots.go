@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+func handleError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: diff_snapshots -old=<path_to_old_snapshot> -new=<path_to_new_snapshot> [-genesis=<genesis_block_hash>] [-values]")
+}
+
+func main() {
+	oldPathPtr := flag.String("old", "", "path to the old snapshot")
+	newPathPtr := flag.String("new", "", "path to the new snapshot")
+	genesisPtr := flag.String("genesis", "", "expected genesis block hash, if the chain is not known")
+	valuesPtr := flag.Bool("values", false, "print the old and new values of the changed keys")
+	flag.Parse()
+	if *oldPathPtr == "" || *newPathPtr == "" {
+		handleError(fmt.Errorf("both snapshots need to be specified"))
+	}
+
+	opts := &snapshot.LoadSnapshotOptions{}
+	if *genesisPtr != "" {
+		opts.GenesisHash = common.HexToHash(*genesisPtr)
+	}
+	comparison, err := snapshot.CompareSnapshots(*oldPathPtr, *newPathPtr, opts)
+	handleError(err)
+
+	printComparison(os.Stdout, comparison, *valuesPtr)
+}
+
+// printComparison prints one line per changed key, followed by a summary.
+func printComparison(w io.Writer, comparison *snapshot.SnapshotComparison, printValues bool) {
+	fmt.Fprintf(w, "Old snapshot block: %v, height: %v, state hash: %v\n", comparison.OldBlockHeader.Hash().Hex(),
+		comparison.OldBlockHeader.Height, comparison.OldBlockHeader.StateHash.Hex())
+	fmt.Fprintf(w, "New snapshot block: %v, height: %v, state hash: %v\n", comparison.NewBlockHeader.Hash().Hex(),
+		comparison.NewBlockHeader.Height, comparison.NewBlockHeader.StateHash.Hex())
+
+	accounts, keys, storageKeys := 0, 0, 0
+	for _, change := range comparison.Changes {
+		fmt.Fprintf(w, "%-8v %v\n", change.Type, describeKey(&change))
+		if printValues {
+			fmt.Fprintf(w, "    old: %v\n    new: %v\n", common.Bytes2Hex(change.OldValue), common.Bytes2Hex(change.NewValue))
+		}
+		switch {
+		case change.Storage:
+			storageKeys++
+		case bytes.HasPrefix(change.Key, state.AccountKeyPrefix()):
+			accounts++
+		default:
+			keys++
+		}
+	}
+	fmt.Fprintf(w, "%v accounts, %v storage keys and %v other keys changed\n", accounts, storageKeys, keys)
+}
+
+// describeKey formats the key of the change, with the address of an account key and the
+// owner of a storage key.
+func describeKey(change *snapshot.StateChange) string {
+	if change.Storage {
+		return fmt.Sprintf("storage %v %v", change.Account.Hex(), common.Bytes2Hex(change.Key))
+	}
+	if prefix := state.AccountKeyPrefix(); bytes.HasPrefix(change.Key, prefix) {
+		return fmt.Sprintf("account %v", common.BytesToAddress(change.Key[len(prefix):]).Hex())
+	}
+	return fmt.Sprintf("key %v (%q)", common.Bytes2Hex(change.Key), string(change.Key))
+}
@@ -41,9 +41,9 @@ type StakeDeposit struct {
 // generate_genesis -chainID=privatenet -erc20snapshot=./data/genesis_theta_erc20_snapshot.json -stake_deposit=./data/genesis_stake_deposit.json -genesis=./genesis
 //
 func main() {
-	chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath, genesisSnapshotFilePath := parseArguments()
+	chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath, genesisSnapshotFilePath, slashingRules, proposerSelection := parseArguments()
 
-	sv, metadata, err := generateGenesisSnapshot(chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath)
+	sv, metadata, err := generateGenesisSnapshot(chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath, slashingRules, proposerSelection)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to generate genesis snapshot: %v", err))
 	}
@@ -70,28 +70,60 @@ func main() {
 	fmt.Println("")
 }
 
-func parseArguments() (chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath, genesisSnapshotFilePath string) {
+func parseArguments() (chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath, genesisSnapshotFilePath string, slashingRules *core.SlashingRules, proposerSelection *core.ProposerSelection) {
+	defaultRules := core.DefaultSlashingRules()
 	chainIDPtr := flag.String("chainID", "local_chain", "the ID of the chain")
 	erc20SnapshotJSONFilePathPtr := flag.String("erc20snapshot", "./theta_erc20_snapshot.json", "the json file contain the ERC20 balance snapshot")
 	stakeDepositFilePathPtr := flag.String("stake_deposit", "./stake_deposit.json", "the initial stake deposits")
 	genesisSnapshotFilePathPtr := flag.String("genesis", "./genesis", "the genesis snapshot")
+	slashingPtr := flag.Bool("slashing", true, "whether to slash the validators proven to double-sign")
+	duplicateVoteSlashPtr := flag.Uint64("duplicate_vote_slash_bp", defaultRules.DuplicateVoteSlashBasisPoints, "the fraction of the stake slashed for a duplicate vote, in 1/10000")
+	duplicateProposalSlashPtr := flag.Uint64("duplicate_proposal_slash_bp", defaultRules.DuplicateProposalSlashBasisPoints, "the fraction of the stake slashed for a duplicate proposal, in 1/10000")
+	maxEvidenceAgePtr := flag.Uint64("max_evidence_age", defaultRules.MaxEvidenceAge, "the number of blocks after the conflicting blocks the evidence can be included")
+	proposerSelectionPtr := flag.String("proposer_selection", core.ProposerSelectionStake, "the proposer selection strategy: stake, stakeBlockHash, vrf, roundRobin or fixed")
+	fixedProposerPtr := flag.String("fixed_proposer", "", "the address of the proposer of the fixed strategy, the first validator if empty")
 	flag.Parse()
 
 	chainID = *chainIDPtr
 	erc20SnapshotJSONFilePath = *erc20SnapshotJSONFilePathPtr
 	stakeDepositFilePath = *stakeDepositFilePathPtr
 	genesisSnapshotFilePath = *genesisSnapshotFilePathPtr
+	if *slashingPtr {
+		slashingRules = &core.SlashingRules{
+			DuplicateVoteSlashBasisPoints:     *duplicateVoteSlashPtr,
+			DuplicateProposalSlashBasisPoints: *duplicateProposalSlashPtr,
+			MaxEvidenceAge:                    *maxEvidenceAgePtr,
+		}
+	}
+	proposerSelection = &core.ProposerSelection{
+		Strategy:      *proposerSelectionPtr,
+		FixedProposer: common.HexToAddress(*fixedProposerPtr),
+	}
 
 	return
 }
 
 // generateGenesisSnapshot generates the genesis snapshot.
-func generateGenesisSnapshot(chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath string) (*state.StoreView, *core.SnapshotMetadata, error) {
+func generateGenesisSnapshot(chainID, erc20SnapshotJSONFilePath, stakeDepositFilePath string, slashingRules *core.SlashingRules,
+	proposerSelection *core.ProposerSelection) (*state.StoreView, *core.SnapshotMetadata, error) {
 	metadata := &core.SnapshotMetadata{}
 	genesisHeight := core.GenesisBlockHeight
 
 	sv := loadInitialBalances(erc20SnapshotJSONFilePath)
 	performInitialStakeDeposit(stakeDepositFilePath, genesisHeight, sv)
+	if slashingRules != nil {
+		if err := slashingRules.Validate(); err != nil {
+			return nil, nil, err
+		}
+		sv.UpdateSlashingRules(slashingRules)
+	}
+	if err := proposerSelection.Validate(); err != nil {
+		return nil, nil, err
+	}
+	// The chains without a strategy select by stake, so that the existing genesis states are unchanged
+	if proposerSelection.Strategy != core.ProposerSelectionStake {
+		sv.UpdateProposerSelection(proposerSelection)
+	}
 
 	stateHash := sv.Hash()
 
@@ -287,6 +319,26 @@ func sanityChecks(sv *state.StoreView) error {
 			if hl.Heights[0] != uint64(0) {
 				panic(fmt.Sprintf("Only height 0 should be in the genesis height list"))
 			}
+		} else if bytes.Compare(key, state.SlashingRulesKey()) == 0 {
+			var rules core.SlashingRules
+			err := rlp.DecodeBytes(val, &rules)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to decode slashing rules: %v", err))
+			}
+			if err := rules.Validate(); err != nil {
+				panic(fmt.Sprintf("Invalid slashing rules: %v", err))
+			}
+			logger.Infof("Slashing rules: %v", &rules)
+		} else if bytes.Compare(key, state.ProposerSelectionKey()) == 0 {
+			var selection core.ProposerSelection
+			err := rlp.DecodeBytes(val, &selection)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to decode proposer selection: %v", err))
+			}
+			if err := selection.Validate(); err != nil {
+				panic(fmt.Sprintf("Invalid proposer selection: %v", err))
+			}
+			logger.Infof("Proposer selection: %v", &selection)
 		} else { // regular account
 			var account types.Account
 			err := rlp.DecodeBytes(val, &account)
@@ -13,7 +13,10 @@ import (
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/database"
 	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
 	"github.com/thetatoken/theta/store/trie"
 )
 
@@ -46,36 +49,80 @@ func main() {
 	// db, _ := backend.NewMongoDatabase()
 
 	k := str2hex2bytes(key)
-	value, err := db.Get(k)
+	output, err := inspect(db, k, level)
 	handleError(err)
+	fmt.Println(output)
+
+	os.Exit(0)
+}
+
+// inspect retrieves the value stored under the given key and formats it according to
+// the first object type it can be decoded as.
+func inspect(db database.Database, k []byte, level int) (string, error) {
+	value, err := db.Get(k)
+	if err != nil {
+		return "", err
+	}
 
+	// Objects stored without a reference count, such as the blocks, have no count entry.
 	ref, err := db.CountReference(k)
-	handleError(err)
+	if err == store.ErrKeyNotFound {
+		ref = 0
+	} else if err != nil {
+		return "", err
+	}
 
 	node, err := trie.DecodeNode(k, value, 0)
 	if err == nil {
-		fmt.Printf("ref = %v, obj = %v\n", ref, trie.FmtNode(node, "", level, db, fmtValue))
-	} else {
-		if strings.HasPrefix(err.Error(), "invalid number of list elements") {
-			block := core.ExtendedBlock{}
-			err = rlp.DecodeBytes(value, &block)
-			if err == nil {
-				fmt.Printf("ref = %v, obj = %v\n", ref, block)
-			} else {
-				blockByHeightIndexEntry := blockchain.BlockByHeightIndexEntry{}
-				err = rlp.DecodeBytes(value, &blockByHeightIndexEntry)
-				if err == nil {
-					fmt.Printf("ref = %v, obj = %v\n", ref, blockByHeightIndexEntry)
-				} else {
-					handleError(err)
-				}
-			}
-		} else {
-			handleError(err)
-		}
+		return fmt.Sprintf("ref = %v, obj = %v", ref, trie.FmtNode(node, "", level, db, fmtValue)), nil
 	}
 
-	os.Exit(0)
+	obj, err := fmtObject(value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ref = %v, obj = %v", ref, obj), nil
+}
+
+// fmtObject tries to decode the value as each of the known non-trie objects in turn.
+func fmtObject(value []byte) (string, error) {
+	block := core.ExtendedBlock{}
+	err := kvstore.DecodeValue(value, &block)
+	if err == nil {
+		return fmt.Sprintf("%v", block), nil
+	}
+
+	blockByHeightIndexEntry := blockchain.BlockByHeightIndexEntry{}
+	err = rlp.DecodeBytes(value, &blockByHeightIndexEntry)
+	if err == nil {
+		return fmt.Sprintf("%v", blockByHeightIndexEntry), nil
+	}
+
+	voteSet := core.NewVoteSet()
+	err = rlp.DecodeBytes(value, voteSet)
+	if err == nil {
+		return fmtVoteSet(voteSet), nil
+	}
+
+	return "", err
+}
+
+// fmtVoteSet prints the block hash, validator ID and validity of each vote in the set.
+func fmtVoteSet(voteSet *core.VoteSet) string {
+	var sb strings.Builder
+	votes := voteSet.Votes()
+	sb.WriteString(fmt.Sprintf("VoteSet{%v votes", len(votes)))
+	for _, vote := range votes {
+		res := vote.Validate()
+		validity := "valid"
+		if res.IsError() {
+			validity = fmt.Sprintf("invalid: %v", res.Message)
+		}
+		sb.WriteString(fmt.Sprintf("\n  Vote{Block: %v, ID: %v, Height: %v, Epoch: %v, %v}",
+			vote.Block.Hex(), vote.ID.Hex(), vote.Height, vote.Epoch, validity))
+	}
+	sb.WriteString("\n}")
+	return sb.String()
 }
 
 func str2hex2bytes(str string) []byte {
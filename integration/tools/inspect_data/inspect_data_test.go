@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestInspectVoteSet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	blockHash := common.HexToHash("a1")
+	voteSet := core.NewVoteSet()
+
+	privKey1, _, _ := crypto.GenerateKeyPair()
+	vote1 := core.Vote{Block: blockHash, Height: 10, Epoch: 11, ID: privKey1.PublicKey().Address()}
+	vote1.Sign(privKey1)
+	voteSet.AddVote(vote1)
+
+	privKey2, _, _ := crypto.GenerateKeyPair()
+	vote2 := core.Vote{Block: blockHash, Height: 10, Epoch: 11, ID: privKey2.PublicKey().Address()}
+	voteSet.AddVote(vote2) // unsigned
+
+	raw, err := rlp.EncodeToBytes(voteSet)
+	require.Nil(err)
+
+	db := backend.NewMemDatabase()
+	key := append(common.Bytes("vt/"), blockHash[:]...)
+	require.Nil(db.Put(key, raw))
+
+	output, err := inspect(db, key, 0)
+	require.Nil(err)
+	assert.Contains(output, "2 votes")
+	assert.Contains(output, vote1.ID.Hex())
+	assert.Contains(output, vote2.ID.Hex())
+	assert.Contains(output, "valid}")
+	assert.Contains(output, "invalid: Vote is not signed")
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/snapshot"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+func handleError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: verify_chain -config=<path_to_config_home> [-from=<height>]")
+}
+
+func main() {
+	configPathPtr := flag.String("config", "", "path to theta config home")
+	fromPtr := flag.Uint64("from", 0, "height to start the verification from, the snapshot base by default")
+	flag.Parse()
+	configPath := *configPathPtr
+
+	mainDBPath := path.Join(configPath, "db", "main")
+	refDBPath := path.Join(configPath, "db", "ref")
+	db, err := backend.NewLDBDatabase(mainDBPath, refDBPath, 256, 0)
+	handleError(err)
+	defer db.Close()
+
+	root, err := loadRootBlock(db)
+	handleError(err)
+	tip, err := findLastFinalizedBlock(db)
+	handleError(err)
+	from := root.Height
+	if *fromPtr > from {
+		from = *fromPtr
+	}
+	fmt.Printf("Verifying the chain from height %v to the last finalized block %v at height %v\n", from, tip.Hash().Hex(), tip.Height)
+
+	v := &chainVerifier{
+		db:    db,
+		chain: blockchain.NewChain(root.ChainID, kvstore.NewKVStore(db), root),
+	}
+	if err := v.verify(from, tip); err != nil {
+		fmt.Printf("Chain verification FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Chain verified, %v blocks checked, %v commit certificates not checked as their validator state is pruned\n",
+		v.verified, v.unverifiedCCs)
+}
+
+// loadRootBlock returns the snapshot base the node started from.
+func loadRootBlock(db database.Database) (*core.Block, error) {
+	header, err := snapshot.LoadValidatedSnapshotHeader(db)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the snapshot block header: %v", err)
+	}
+	return &core.Block{BlockHeader: header}, nil
+}
+
+// findLastFinalizedBlock returns the last finalized block recorded by the consensus state.
+func findLastFinalizedBlock(db database.Database) (*core.ExtendedBlock, error) {
+	store := kvstore.NewKVStore(db)
+	stub := &consensus.StateStub{}
+	if err := store.Get([]byte(consensus.DBStateStubKey), stub); err != nil {
+		return nil, fmt.Errorf("Failed to load the consensus state: %v", err)
+	}
+	block := &core.ExtendedBlock{}
+	if err := store.Get(stub.LastFinalizedBlock[:], block); err != nil {
+		return nil, fmt.Errorf("Failed to load the last finalized block %v: %v", stub.LastFinalizedBlock.Hex(), err)
+	}
+	return block, nil
+}
+
+type chainVerifier struct {
+	db    database.Database
+	chain *blockchain.Chain
+
+	stateFound    bool // whether the state of a previous block is present
+	verified      int
+	unverifiedCCs int
+}
+
+// verify walks the finalized blocks from the height up to the tip, and returns the first
+// inconsistency found.
+func (v *chainVerifier) verify(from uint64, tip *core.ExtendedBlock) error {
+	if from > tip.Height {
+		return fmt.Errorf("Height %v is above the last finalized height %v", from, tip.Height)
+	}
+	var prev *core.ExtendedBlock
+	for height := from; height <= tip.Height; height++ {
+		block, err := v.chain.FindFinalizedBlockByHeight(height)
+		if err != nil {
+			return fmt.Errorf("Failed to read the finalized block at height %v: %v", height, err)
+		}
+		if block == nil {
+			return fmt.Errorf("No finalized block at height %v", height)
+		}
+		if err := v.verifyBlock(prev, block); err != nil {
+			return fmt.Errorf("Block %v at height %v: %v", block.Hash().Hex(), height, err)
+		}
+		prev = block
+		v.verified++
+	}
+	if prev.Hash() != tip.Hash() {
+		return fmt.Errorf("The finalized block at height %v is %v, not the last finalized block %v", tip.Height, prev.Hash().Hex(), tip.Hash().Hex())
+	}
+	if err := v.verifyStateTrie(tip.StateHash); err != nil {
+		return fmt.Errorf("State %v of the last finalized block is invalid: %v", tip.StateHash.Hex(), err)
+	}
+	return nil
+}
+
+func (v *chainVerifier) verifyBlock(prev, block *core.ExtendedBlock) error {
+	if prev != nil {
+		if err := verifyParentLink(prev, block); err != nil {
+			return err
+		}
+		if err := v.verifyHCC(block); err != nil {
+			return err
+		}
+	}
+	return v.verifyState(block)
+}
+
+// verifyParentLink checks that the block extends the previous finalized block, and that the
+// previous block links to it.
+func verifyParentLink(prev, block *core.ExtendedBlock) error {
+	if block.Parent != prev.Hash() {
+		return fmt.Errorf("Parent %v is not the finalized block %v at height %v", block.Parent.Hex(), prev.Hash().Hex(), prev.Height)
+	}
+	if block.Height != prev.Height+1 {
+		return fmt.Errorf("Height is not above the height %v of the parent", prev.Height)
+	}
+	for _, child := range prev.Children {
+		if child == block.Hash() {
+			return nil
+		}
+	}
+	return fmt.Errorf("Block is missing from the children of the parent %v", prev.Hash().Hex())
+}
+
+// verifyHCC checks that the highest commit certificate of the block points to a finalized
+// ancestor, and that its votes are valid and form a majority of the validators of the block
+// certified. The votes of the certificates carried without votes are the ones the node
+// stored for the block certified.
+func (v *chainVerifier) verifyHCC(block *core.ExtendedBlock) error {
+	hcc := block.HCC
+	if hcc.BlockHash.IsEmpty() {
+		return fmt.Errorf("HCC is missing")
+	}
+	certified, err := v.chain.FindBlock(hcc.BlockHash)
+	if err != nil {
+		return fmt.Errorf("HCC block %v is not found: %v", hcc.BlockHash.Hex(), err)
+	}
+	if !certified.Status.IsFinalized() || certified.Height >= block.Height {
+		return fmt.Errorf("HCC block %v at height %v is not a finalized ancestor", hcc.BlockHash.Hex(), certified.Height)
+	}
+	cc := core.CommitCertificate{Votes: hcc.Votes, BlockHash: hcc.BlockHash}
+	if cc.Votes == nil || cc.Votes.IsEmpty() { // the decoded headers carry an empty vote set
+		cc.Votes = v.storedVotes(hcc.BlockHash)
+		if cc.Votes.IsEmpty() {
+			return fmt.Errorf("No votes are stored for the HCC block %v", hcc.BlockHash.Hex())
+		}
+	}
+
+	validators, ok := v.validatorSet(certified)
+	if !ok {
+		v.unverifiedCCs++
+		return nil
+	}
+	if !cc.IsValid(validators) {
+		return fmt.Errorf("HCC votes %v are not a valid majority of the validators %v", cc.Votes, validators)
+	}
+	return nil
+}
+
+// storedVotes returns the votes stored for the block, one per voter.
+func (v *chainVerifier) storedVotes(hash common.Hash) *core.VoteSet {
+	votes := core.NewVoteSet()
+	for _, vote := range v.chain.FindVotesByHash(hash).Votes() {
+		if vote.Block == hash {
+			votes.AddVote(vote)
+		}
+	}
+	return votes.UniqueVoter()
+}
+
+// validatorSet returns the validator set voting on the block, which the ledger selects from
+// the state of the block two HCC links below, or false if that state is not available.
+func (v *chainVerifier) validatorSet(block *core.ExtendedBlock) (*core.ValidatorSet, bool) {
+	for i := 2; i > 0 && !block.HCC.BlockHash.IsEmpty() && !block.Status.IsTrusted(); i-- {
+		var err error
+		if block, err = v.chain.FindBlock(block.HCC.BlockHash); err != nil {
+			return nil, false
+		}
+	}
+	if !v.hasState(block.StateHash) {
+		return nil, false
+	}
+	vcp := state.NewStoreView(block.Height, block.StateHash, v.db).GetValidatorCandidatePool()
+	if vcp == nil {
+		return nil, false
+	}
+	return consensus.SelectTopStakeHoldersAsValidators(vcp), true
+}
+
+// verifyState checks the continuity of the states: once the state of a block is present,
+// the states of all the blocks above need to be present too, as pruning only removes the
+// older states.
+func (v *chainVerifier) verifyState(block *core.ExtendedBlock) error {
+	if block.StateHash.IsEmpty() {
+		return fmt.Errorf("State hash is empty")
+	}
+	if v.hasState(block.StateHash) {
+		v.stateFound = true
+		return nil
+	}
+	if v.stateFound {
+		return fmt.Errorf("State %v is missing, while the state of a lower block is present", block.StateHash.Hex())
+	}
+	return nil
+}
+
+// hasState reports whether the root node of the state is present. Only the state of the last
+// finalized block is walked in full by verifyStateTrie, walking the state of every block
+// would take too long.
+func (v *chainVerifier) hasState(stateHash common.Hash) bool {
+	_, err := trie.New(stateHash, trie.NewDatabase(v.db))
+	return err == nil
+}
+
+// verifyStateTrie walks the state trie to confirm all its nodes are present, and that its
+// root is recomputed from the leaves.
+func (v *chainVerifier) verifyStateTrie(stateHash common.Hash) error {
+	tr, err := trie.New(stateHash, trie.NewDatabase(v.db))
+	if err != nil {
+		return err
+	}
+	return tr.Verify()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/snapshot"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// createTestNodeChain creates a node DB started from a snapshot at height 10, with the blocks
+// up to height 13 finalized on top of it. The blocks commit to a state whose only validator is
+// the signer, and the signer votes for all the blocks but the ones listed.
+func createTestNodeChain(t *testing.T, signer *crypto.PrivateKey, unvoted ...uint64) (database.Database, []*core.Block) {
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	validator := signer.PublicKey().Address()
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(validator, validator, core.MinValidatorStakeDeposit))
+	sv.UpdateValidatorCandidatePool(vcp)
+	sv.UpdateStakeTransactionHeightList(&types.HeightList{})
+	stateHash := sv.Save()
+
+	root := core.NewBlock()
+	root.ChainID = "testchain"
+	root.Height = 10
+	root.StateHash = stateHash
+	root.Timestamp = big.NewInt(10)
+	require.Nil(snapshot.SaveValidatedSnapshotHeader(db, root.BlockHeader))
+	chain := blockchain.NewChain(root.ChainID, kvstore.NewKVStore(db), root)
+
+	blocks := []*core.Block{root}
+	for height := uint64(11); height <= 13; height++ {
+		parent := blocks[len(blocks)-1]
+		block := core.NewBlock()
+		block.ChainID = root.ChainID
+		block.Height = height
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = parent.Hash()
+		block.StateHash = stateHash
+		block.Timestamp = big.NewInt(int64(height))
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		blocks = append(blocks, block)
+	}
+	require.Nil(chain.FinalizePreviousBlocks(blocks[len(blocks)-1].Hash()))
+
+	skipped := make(map[uint64]bool)
+	for _, height := range unvoted {
+		skipped[height] = true
+	}
+	for _, block := range blocks {
+		if skipped[block.Height] {
+			continue
+		}
+		vote := core.Vote{Block: block.Hash(), Height: block.Height, ID: validator}
+		vote.Sign(signer)
+		chain.AddVoteToIndex(vote)
+	}
+
+	tip := blocks[len(blocks)-1].Hash()
+	require.Nil(kvstore.NewKVStore(db).Put([]byte(consensus.DBStateStubKey), &consensus.StateStub{LastFinalizedBlock: tip}))
+	return db, blocks
+}
+
+func verifyTestNodeChain(t *testing.T, db database.Database) (*chainVerifier, error) {
+	root, err := loadRootBlock(db)
+	require.Nil(t, err)
+	tip, err := findLastFinalizedBlock(db)
+	require.Nil(t, err)
+	v := &chainVerifier{
+		db:    db,
+		chain: blockchain.NewChain(root.ChainID, kvstore.NewKVStore(db), root),
+	}
+	return v, v.verify(root.Height, tip)
+}
+
+func TestVerifyChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	signer, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	db, blocks := createTestNodeChain(t, signer)
+
+	root, err := loadRootBlock(db)
+	require.Nil(err)
+	assert.Equal(blocks[0].Hash(), root.Hash())
+
+	v, err := verifyTestNodeChain(t, db)
+	require.Nil(err)
+	assert.Equal(4, v.verified)
+	assert.Equal(0, v.unverifiedCCs)
+}
+
+func TestVerifyChainStoredVotes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The HCC of the block at height 13 certifies a block without stored votes.
+	signer, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	db, _ := createTestNodeChain(t, signer, 12)
+	_, err = verifyTestNodeChain(t, db)
+	assert.NotNil(err)
+
+	// The stored votes are not from the validators.
+	other, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	db, blocks := createTestNodeChain(t, signer, 12)
+	vote := core.Vote{Block: blocks[2].Hash(), Height: blocks[2].Height, ID: other.PublicKey().Address()}
+	vote.Sign(other)
+	root, err := loadRootBlock(db)
+	require.Nil(err)
+	blockchain.NewChain(root.ChainID, kvstore.NewKVStore(db), root).AddVoteToIndex(vote)
+	_, err = verifyTestNodeChain(t, db)
+	assert.NotNil(err)
+}
+
+func TestVerifyChainMissingStateNode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	signer, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	db, blocks := createTestNodeChain(t, signer)
+
+	// Delete a trie node other than the state root, the root of the state stays present.
+	memdb := db.(*backend.MemDatabase)
+	deleted := false
+	for _, key := range memdb.Keys() {
+		if len(key) != common.HashLength || common.BytesToHash(key) == blocks[0].StateHash {
+			continue
+		}
+		if value, err := memdb.Get(key); err != nil || len(value) == 0 || isBlockKey(key, blocks) {
+			continue
+		}
+		require.Nil(memdb.Delete(key))
+		deleted = true
+		break
+	}
+	require.True(deleted)
+
+	v, err := verifyTestNodeChain(t, db)
+	assert.NotNil(err)
+	assert.True(v.hasState(blocks[0].StateHash))
+}
+
+func isBlockKey(key []byte, blocks []*core.Block) bool {
+	for _, block := range blocks {
+		if common.BytesToHash(key) == block.Hash() {
+			return true
+		}
+	}
+	return false
+}
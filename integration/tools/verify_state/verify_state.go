@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+func handleError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: verify_state -config=<path_to_config_home> -batch=<max_accounts_per_run>")
+}
+
+func main() {
+	configPathPtr := flag.String("config", "", "path to theta config home")
+	batchSizePtr := flag.Int("batch", 0, "max number of account storages verified in this run, 0 for all")
+	flag.Parse()
+	configPath := *configPathPtr
+	batchSize := *batchSizePtr
+
+	mainDBPath := path.Join(configPath, "db", "main")
+	refDBPath := path.Join(configPath, "db", "ref")
+	db, err := backend.NewLDBDatabase(mainDBPath, refDBPath, 256, 0)
+	handleError(err)
+	defer db.Close()
+
+	block, err := findLastFinalizedBlock(db)
+	handleError(err)
+	fmt.Printf("Verifying the state of block %v at height %v, state hash: %v\n", block.Hash().Hex(), block.Height, block.StateHash.Hex())
+
+	checkpoint, err := verifyState(db, block.StateHash, batchSize)
+	if err != nil {
+		fmt.Printf("State verification FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	if !checkpoint.Done {
+		fmt.Printf("%v accounts verified so far, run again to resume\n", checkpoint.Verified)
+		return
+	}
+	fmt.Printf("State verified, %v accounts checked\n", checkpoint.Verified)
+}
+
+// findLastFinalizedBlock returns the last finalized block recorded by the consensus state.
+func findLastFinalizedBlock(db database.Database) (*core.ExtendedBlock, error) {
+	store := kvstore.NewKVStore(db)
+	stub := &consensus.StateStub{}
+	if err := store.Get([]byte(consensus.DBStateStubKey), stub); err != nil {
+		return nil, fmt.Errorf("Failed to load the consensus state: %v", err)
+	}
+	block := &core.ExtendedBlock{}
+	if err := store.Get(stub.LastFinalizedBlock[:], block); err != nil {
+		return nil, fmt.Errorf("Failed to load the last finalized block %v: %v", stub.LastFinalizedBlock.Hex(), err)
+	}
+	return block, nil
+}
+
+// verifyState verifies the state with the given root. The state trie is walked to confirm
+// all its nodes are present and its root is recomputed from the leaves, and then the account
+// storages are verified the same way, at most batchSize accounts per run (0: all accounts).
+// The progress of the account storage verification is checkpointed in the DB, so that the
+// next run resumes where the previous one stopped.
+func verifyState(db database.Database, stateHash common.Hash, batchSize int) (*state.StorageVerificationCheckpoint, error) {
+	checkpoint, err := state.LoadStorageVerificationCheckpoint(db)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the verification checkpoint: %v", err)
+	}
+	if checkpoint != nil && (checkpoint.StateHash != stateHash || checkpoint.Done) {
+		checkpoint = nil // start over
+	}
+
+	if checkpoint == nil {
+		tr, err := trie.New(stateHash, trie.NewDatabase(db))
+		if err == nil {
+			err = tr.Verify()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid state trie %v: %v", stateHash.Hex(), err)
+		}
+	}
+
+	sv := state.NewStoreView(0, stateHash, db)
+	checkpoint, err = sv.VerifyAccountStorages(checkpoint, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid account storage: %v", err)
+	}
+	if err = state.SaveStorageVerificationCheckpoint(db, checkpoint); err != nil {
+		return nil, fmt.Errorf("Failed to save the verification checkpoint: %v", err)
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// createTestNodeDB creates a node DB whose last finalized block commits to a state with a few
+// accounts, one of which has storage.
+func createTestNodeDB(t *testing.T) (database.Database, *core.ExtendedBlock) {
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	for i := 1; i <= 20; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		sv.SetAccount(addr, &types.Account{Address: addr, Balance: types.NewCoins(int64(i), int64(i))})
+	}
+	storage := state.NewStoreView(10, common.Hash{}, db)
+	for i := 0; i < 20; i++ {
+		storage.Set(common.BigToHash(big.NewInt(int64(i))).Bytes(), common.Bytes("value"))
+	}
+	contractAddr := common.HexToAddress("0xc0")
+	sv.SetAccount(contractAddr, &types.Account{Address: contractAddr, Balance: types.NewCoins(0, 0), Root: storage.Save()})
+
+	block := &core.ExtendedBlock{Block: core.NewBlock(), Status: core.BlockStatusDirectlyFinalized}
+	block.Height = 10
+	block.StateHash = sv.Save()
+
+	store := kvstore.NewKVStore(db)
+	blockHash := block.Hash()
+	require.Nil(store.Put(blockHash[:], block))
+	require.Nil(store.Put([]byte(consensus.DBStateStubKey), &consensus.StateStub{LastFinalizedBlock: blockHash}))
+	return db, block
+}
+
+func TestVerifyState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, block := createTestNodeDB(t)
+	lfb, err := findLastFinalizedBlock(db)
+	require.Nil(err)
+	assert.Equal(block.Hash(), lfb.Hash())
+
+	checkpoint, err := verifyState(db, lfb.StateHash, 0)
+	require.Nil(err)
+	assert.True(checkpoint.Done)
+	assert.Equal(uint64(21), checkpoint.Verified)
+}
+
+func TestVerifyStateMissingNode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, block := createTestNodeDB(t)
+	blockHash := block.Hash()
+
+	// Delete a trie node other than the state root.
+	memdb := db.(*backend.MemDatabase)
+	deleted := false
+	for _, key := range memdb.Keys() {
+		if len(key) != common.HashLength || common.BytesToHash(key) == blockHash || common.BytesToHash(key) == block.StateHash {
+			continue
+		}
+		require.Nil(memdb.Delete(key))
+		deleted = true
+		break
+	}
+	require.True(deleted)
+
+	_, err := verifyState(db, block.StateHash, 0)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "missing trie node")
+}
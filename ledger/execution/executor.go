@@ -9,6 +9,7 @@ import (
 	"github.com/thetatoken/theta/core"
 	st "github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
 	"github.com/thetatoken/theta/store/database"
 )
 
@@ -44,6 +45,8 @@ type Executor struct {
 	depositStakeTxExec            *DepositStakeExecutor
 	withdrawStakeTxExec           *WithdrawStakeExecutor
 	stakeRewardDistributionTxExec *StakeRewardDistributionTxExecutor
+	evidenceTxExec                *EvidenceTxExecutor
+	rotateValidatorKeyTxExec      *RotateValidatorKeyTxExecutor
 
 	skipSanityCheck bool
 }
@@ -67,6 +70,8 @@ func NewExecutor(db database.Database, chain *blockchain.Chain, state *st.Ledger
 		depositStakeTxExec:            NewDepositStakeExecutor(state),
 		withdrawStakeTxExec:           NewWithdrawStakeExecutor(state),
 		stakeRewardDistributionTxExec: NewStakeRewardDistributionTxExecutor(state),
+		evidenceTxExec:                NewEvidenceTxExecutor(consensus, valMgr),
+		rotateValidatorKeyTxExec:      NewRotateValidatorKeyTxExecutor(state),
 		skipSanityCheck:               false,
 	}
 
@@ -79,6 +84,18 @@ func (exec *Executor) SetSkipSanityCheck(skip bool) {
 	exec.skipSanityCheck = skip
 }
 
+// SetTracer sets the function returning the tracer of the EVM execution of each smart contract
+// transaction, nil for no tracing. The function may return nil to skip a transaction.
+func (exec *Executor) SetTracer(newTracer func(tx *types.SmartContractTx) vm.Tracer) {
+	exec.smartContractTxExec.newTracer = newTracer
+}
+
+// SetSkipTxReceipts sets the flag for storing the tx receipts.
+// Skip storing while re-executing committed blocks, e.g. to trace them.
+func (exec *Executor) SetSkipTxReceipts(skip bool) {
+	exec.smartContractTxExec.skipTxReceipts = skip
+}
+
 // ExecuteTx executes the given transaction
 func (exec *Executor) ExecuteTx(tx types.Tx) (common.Hash, result.Result) {
 	return exec.processTx(tx, core.DeliveredView)
@@ -180,6 +197,14 @@ func (exec *Executor) isTxTypeSupported(view *st.StoreView, tx types.Tx) bool {
 		if blockHeight < common.HeightEnableTheta3 {
 			return false
 		}
+	case *types.EvidenceTx:
+		if view.GetSlashingRules() == nil {
+			return false
+		}
+	case *types.RotateValidatorKeyTx:
+		if blockHeight < common.HeightEnableRotateValidatorKey {
+			return false
+		}
 	default:
 		return true
 	}
@@ -214,6 +239,10 @@ func (exec *Executor) getTxExecutor(tx types.Tx) TxExecutor {
 		txExecutor = exec.depositStakeTxExec
 	case *types.StakeRewardDistributionTx:
 		txExecutor = exec.stakeRewardDistributionTxExec
+	case *types.EvidenceTx:
+		txExecutor = exec.evidenceTxExec
+	case *types.RotateValidatorKeyTx:
+		txExecutor = exec.rotateValidatorKeyTxExec
 	default:
 		txExecutor = nil
 	}
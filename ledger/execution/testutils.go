@@ -29,6 +29,7 @@ type TestConsensusEngine struct {
 
 func (tce *TestConsensusEngine) ID() string                        { return tce.privKey.PublicKey().Address().Hex() }
 func (tce *TestConsensusEngine) PrivateKey() *crypto.PrivateKey    { return tce.privKey }
+func (tce *TestConsensusEngine) Signer() core.Signer               { return core.NewLocalSigner(tce.privKey) }
 func (tce *TestConsensusEngine) GetTip(bool) *core.ExtendedBlock   { return nil }
 func (tce *TestConsensusEngine) GetEpoch() uint64                  { return 100 }
 func (tce *TestConsensusEngine) AddMessage(msg interface{})        {}
@@ -0,0 +1,144 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*EvidenceTxExecutor)(nil)
+
+// ------------------------------- Evidence Transaction -----------------------------------
+
+// EvidenceTxExecutor implements the TxExecutor interface
+type EvidenceTxExecutor struct {
+	consensus core.ConsensusEngine
+	valMgr    core.ValidatorManager
+}
+
+// NewEvidenceTxExecutor creates a new instance of EvidenceTxExecutor
+func NewEvidenceTxExecutor(consensus core.ConsensusEngine, valMgr core.ValidatorManager) *EvidenceTxExecutor {
+	return &EvidenceTxExecutor{
+		consensus: consensus,
+		valMgr:    valMgr,
+	}
+}
+
+func (exec *EvidenceTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.EvidenceTx)
+
+	validatorSet := getValidatorSet(exec.consensus.GetLedger(), exec.valMgr)
+	validatorAddresses := getValidatorAddresses(validatorSet)
+
+	// Validate proposer, basic
+	res := tx.Proposer.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	// verify the proposer is one of the validators
+	res = isAValidator(tx.Proposer.Address, validatorAddresses)
+	if res.IsError() {
+		return res
+	}
+
+	proposerAccount, res := getOrMakeInput(view, tx.Proposer)
+	if res.IsError() {
+		return res
+	}
+
+	// verify the proposer's signature
+	signBytes := tx.SignBytes(chainID)
+	if !tx.Proposer.Signature.Verify(signBytes, proposerAccount.Address) {
+		return result.Error("SignBytes: %X", signBytes)
+	}
+
+	return CheckEvidence(chainID, view, tx.Evidence)
+}
+
+func (exec *EvidenceTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.EvidenceTx)
+	evidence := tx.Evidence
+
+	rules := view.GetSlashingRules()
+	if rules == nil {
+		return common.Hash{}, result.Error("Slashing is not enabled")
+	}
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil {
+		return common.Hash{}, result.Error("Failed to retrieve the validator candidate pool")
+	}
+	slashedAmount, err := vcp.SlashStake(evidence.Offender, rules.SlashBasisPoints(evidence.Type), blockHeight)
+	if err != nil {
+		return common.Hash{}, result.Error("Failed to slash stake, err: %v", err)
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	view.SetValidatorSlashedHeight(evidence.Offender, blockHeight)
+
+	// The validator set changes, same as with a validator stake tx.
+	hl := view.GetStakeTransactionHeightList()
+	if hl == nil {
+		hl = &types.HeightList{}
+	}
+	hl.Append(blockHeight)
+	view.UpdateStakeTransactionHeightList(hl)
+
+	logger.Infof("Validator slashed: offender = %v, slashedAmount = %v, evidence = %v",
+		evidence.Offender, slashedAmount, evidence)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+// CheckEvidence checks that the evidence can slash its offender in the block following the view:
+// the slashing rules are set, the evidence is valid and not expired, and the offender has a
+// validator stake and was not slashed since the misbehavior.
+func CheckEvidence(chainID string, view *st.StoreView, evidence *core.Evidence) result.Result {
+	if evidence == nil {
+		return result.Error("Evidence is missing")
+	}
+	rules := view.GetSlashingRules()
+	if rules == nil {
+		return result.Error("Slashing is not enabled")
+	}
+	if res := evidence.Validate(chainID); res.IsError() {
+		return res
+	}
+
+	blockHeight := view.Height() + 1
+	if evidence.Height() >= blockHeight {
+		return result.Error("Evidence height %v is not below the block height %v", evidence.Height(), blockHeight)
+	}
+	if blockHeight-evidence.Height() > rules.MaxEvidenceAge {
+		return result.Error("Evidence at height %v has expired", evidence.Height())
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil || vcp.FindStakeDelegate(evidence.Offender) == nil {
+		return result.Error("Offender %v has no validator stake", evidence.Offender)
+	}
+	// A slashing covers all the misbehavior before it.
+	if slashedHeight, ok := view.GetValidatorSlashedHeight(evidence.Offender); ok && evidence.Height() < slashedHeight {
+		return result.Error("Offender %v was already slashed at height %v", evidence.Offender, slashedHeight)
+	}
+	return result.OK
+}
+
+func (exec *EvidenceTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.EvidenceTx)
+	return &core.TxInfo{
+		Address:           tx.Proposer.Address,
+		Sequence:          tx.Proposer.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *EvidenceTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	return new(big.Int).SetUint64(0)
+}
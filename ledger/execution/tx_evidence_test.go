@@ -0,0 +1,89 @@
+package execution
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestEvidenceTxSlashing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "testchain"
+	privKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	offender := privKey.PublicKey().Address()
+
+	newHeader := func(parent string, height uint64) *core.BlockHeader {
+		header := &core.BlockHeader{
+			ChainID:   chainID,
+			Epoch:     height,
+			Height:    height,
+			Parent:    common.HexToHash(parent),
+			HCC:       core.CommitCertificate{BlockHash: common.HexToHash(parent)},
+			Timestamp: big.NewInt(1),
+			Proposer:  offender,
+		}
+		sig, err := privKey.Sign(header.SignBytes())
+		require.Nil(err)
+		header.SetSignature(sig)
+		return header
+	}
+	newEvidence := func(height uint64) *core.Evidence {
+		a := newHeader("0x1", height)
+		b := newHeader("0x2", height)
+		voteA := core.Vote{Block: a.Hash(), Height: height, Epoch: height, ID: offender}
+		voteA.Sign(privKey)
+		voteB := core.Vote{Block: b.Hash(), Height: height, Epoch: height + 1, ID: offender}
+		voteB.Sign(privKey)
+		return core.NewDuplicateVoteEvidence(a, voteA, b, voteB)
+	}
+
+	view := st.NewStoreView(100, common.Hash{}, backend.NewMemDatabase())
+	stake := new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2))
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(common.HexToAddress("0x123"), offender, stake))
+	view.UpdateValidatorCandidatePool(vcp)
+
+	evidence := newEvidence(90)
+	assert.True(CheckEvidence(chainID, view, evidence).IsError()) // slashing not enabled
+
+	rules := &core.SlashingRules{
+		DuplicateVoteSlashBasisPoints:     1000,
+		DuplicateProposalSlashBasisPoints: 500,
+		MaxEvidenceAge:                    50,
+	}
+	view.UpdateSlashingRules(rules)
+	assert.True(CheckEvidence(chainID, view, evidence).IsOK())
+	assert.True(CheckEvidence("otherchain", view, evidence).IsError())
+	assert.True(CheckEvidence(chainID, view, newEvidence(40)).IsError()) // expired
+	assert.True(CheckEvidence(chainID, view, newEvidence(101)).IsError())
+
+	exec := NewEvidenceTxExecutor(nil, nil)
+	tx := &types.EvidenceTx{Evidence: evidence}
+	_, res := exec.process(chainID, view, tx)
+	require.True(res.IsOK())
+
+	vcp = view.GetValidatorCandidatePool()
+	candidate := vcp.FindStakeDelegate(offender)
+	require.NotNil(candidate)
+	assert.Equal(0, candidate.TotalStake().Cmp(core.Zero))
+	expected := new(big.Int).Div(new(big.Int).Mul(stake, big.NewInt(9)), big.NewInt(10))
+	assert.Equal(0, expected.Cmp(candidate.Stakes[0].Amount))
+	height, ok := view.GetValidatorSlashedHeight(offender)
+	assert.True(ok)
+	assert.Equal(uint64(101), height)
+
+	// The slashing covers the earlier misbehavior.
+	assert.True(CheckEvidence(chainID, view, evidence).IsError())
+	assert.True(CheckEvidence(chainID, view, newEvidence(95)).IsError())
+}
@@ -0,0 +1,138 @@
+package execution
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*RotateValidatorKeyTxExecutor)(nil)
+
+// ------------------------------- RotateValidatorKey Transaction -----------------------------------
+
+// RotateValidatorKeyTxExecutor implements the TxExecutor interface
+type RotateValidatorKeyTxExecutor struct {
+	state *st.LedgerState
+}
+
+// NewRotateValidatorKeyTxExecutor creates a new instance of RotateValidatorKeyTxExecutor
+func NewRotateValidatorKeyTxExecutor(state *st.LedgerState) *RotateValidatorKeyTxExecutor {
+	return &RotateValidatorKeyTxExecutor{
+		state: state,
+	}
+}
+
+func (exec *RotateValidatorKeyTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+
+	tx := transaction.(*types.RotateValidatorKeyTx)
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	// Get inputs
+	stakeHolderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	// Validate inputs, advanced
+	signBytes := tx.SignBytes(chainID)
+	res = validateInputAdvanced(stakeHolderAccount, signBytes, tx.Holder, blockHeight)
+	if res.IsError() {
+		return res
+	}
+
+	// The new signer proves the ownership of its key
+	if !tx.Signer.Signature.Verify(signBytes, tx.Signer.Address) {
+		return result.Error("Signer signature verification failed, SignBytes: %X",
+			signBytes).WithErrorCode(result.CodeInvalidSignature)
+	}
+
+	if minTxFee, success := sanityCheckForFee(tx.Fee, blockHeight); !success {
+		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
+			minTxFee).WithErrorCode(result.CodeInvalidFee)
+	}
+
+	minimalBalance := tx.Fee
+	if !stakeHolderAccount.Balance.IsGTE(minimalBalance) {
+		logger.Infof(fmt.Sprintf("the stake holder did not have enough to cover the fee %X", tx.Holder.Address))
+		return result.Error("the stake holder account balance is %v, but required minimal balance is %v", stakeHolderAccount.Balance, minimalBalance)
+	}
+
+	// Check the rotation against a copy of the validator candidate pool
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil {
+		return result.Error("Failed to retrieve the validator candidate pool")
+	}
+	if err := vcp.RotateSigningKey(tx.Holder.Address, tx.Signer.Address, tx.EffectiveHeight, blockHeight); err != nil {
+		return result.Error("%v", err)
+	}
+
+	return result.OK
+}
+
+func (exec *RotateValidatorKeyTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+
+	tx := transaction.(*types.RotateValidatorKeyTx)
+
+	stakeHolderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(stakeHolderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("failed to charge transaction fee")
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil {
+		return common.Hash{}, result.Error("Failed to retrieve the validator candidate pool")
+	}
+	if err := vcp.RotateSigningKey(tx.Holder.Address, tx.Signer.Address, tx.EffectiveHeight, blockHeight); err != nil {
+		return common.Hash{}, result.Error("Failed to rotate the signing key, err: %v", err)
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+
+	// Keep the state at this height, same as with a validator stake tx
+	hl := view.GetStakeTransactionHeightList()
+	if hl == nil {
+		hl = &types.HeightList{}
+	}
+	hl.Append(blockHeight)
+	view.UpdateStakeTransactionHeightList(hl)
+
+	stakeHolderAccount.Sequence++
+	view.SetAccount(tx.Holder.Address, stakeHolderAccount)
+
+	logger.Infof("Validator signing key rotation scheduled: holder = %v, signer = %v, effectiveHeight = %v",
+		tx.Holder.Address, tx.Signer.Address, tx.EffectiveHeight)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *RotateValidatorKeyTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.RotateValidatorKeyTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *RotateValidatorKeyTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.RotateValidatorKeyTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(getRegularTxGas(exec.state))
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -23,6 +23,9 @@ var _ TxExecutor = (*SmartContractTxExecutor)(nil)
 type SmartContractTxExecutor struct {
 	state *st.LedgerState
 	chain *blockchain.Chain
+
+	newTracer      func(tx *types.SmartContractTx) vm.Tracer // returns the tracer of the EVM execution, nil if not traced
+	skipTxReceipts bool
 }
 
 // NewSmartContractTxExecutor creates a new instance of SmartContractTxExecutor
@@ -146,11 +149,16 @@ func (exec *SmartContractTxExecutor) process(chainID string, view *st.StoreView,
 	tx := transaction.(*types.SmartContractTx)
 
 	view.ResetLogs()
+	view.ResetInternalTxs()
 
 	// Note: for contract deployment, vm.Execute() might transfer coins from the fromAccount to the
 	//       deployed smart contract. Thus, we should call vm.Execute() before calling getInput().
 	//       Otherwise, the fromAccount returned by getInput() will have incorrect balance.
-	evmRet, contractAddr, gasUsed, evmErr := vm.Execute(exec.state.ParentBlock(), tx, view)
+	var tracer vm.Tracer
+	if exec.newTracer != nil {
+		tracer = exec.newTracer(tx)
+	}
+	evmRet, contractAddr, gasUsed, evmErr := vm.ExecuteWithTracer(exec.state.ParentBlock(), tx, view, tracer)
 
 	fromAddress := tx.From.Address
 	fromAccount, success := getInput(view, tx.From)
@@ -175,13 +183,16 @@ func (exec *SmartContractTxExecutor) process(chainID string, view *st.StoreView,
 
 	txHash := types.TxID(chainID, tx)
 
-	// TODO: Add tx receipt: status and events
+	// The receipt records the events, and the status through the EVM error.
 	logs := view.PopLogs()
 	if evmErr != nil {
 		// Do not record events if transaction is reverted
 		logs = nil
 	}
-	exec.chain.AddTxReceipt(tx, logs, evmRet, contractAddr, gasUsed, evmErr)
+	internalTxs := view.PopInternalTxs()
+	if !exec.skipTxReceipts {
+		exec.chain.AddTxReceipt(tx, logs, internalTxs, evmRet, contractAddr, gasUsed, evmErr)
+	}
 
 	return txHash, result.OK
 }
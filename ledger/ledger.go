@@ -3,8 +3,8 @@ package ledger
 import (
 	"encoding/hex"
 	"fmt"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
@@ -22,6 +22,7 @@ import (
 	"github.com/thetatoken/theta/ledger/state"
 	st "github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
 	mp "github.com/thetatoken/theta/mempool"
 	"github.com/thetatoken/theta/store/database"
 )
@@ -30,6 +31,11 @@ var logger *log.Entry = log.WithFields(log.Fields{"prefix": "ledger"})
 
 var _ core.Ledger = (*Ledger)(nil)
 
+const (
+	maxNumEvidenceTxsPerBlock = 16  // max number of evidence txs the proposer adds to a block
+	maxNumEvidenceScanned     = 256 // max number of stored evidence checked per proposal
+)
+
 //
 // Ledger implements the core.Ledger interface
 //
@@ -44,6 +50,11 @@ type Ledger struct {
 	mu       *sync.RWMutex // Lock for accessing ledger state.
 	state    *st.LedgerState
 	executor *exec.Executor
+
+	evidenceCursor uint64 // sequence number of the first stored evidence that may still slash
+
+	snapshotHeight func() uint64 // height of the latest exported snapshot, 0 if none
+	pruning        int32         // set while a state pruning round is running
 }
 
 // NewLedger creates an instance of Ledger
@@ -118,6 +129,14 @@ func (ledger *Ledger) GetFinalizedValidatorCandidatePool(blockHash common.Hash,
 			return nil, fmt.Errorf("Block is nil for hash %v", blockHash.Hex())
 		}
 
+		// The validator update of a trusted snapshot block is not confirmed yet, the snapshot
+		// load saves the validator candidate pool of its HCC block for the blocks in between,
+		// once it checked that the pool selects the validators the snapshot block is voted by.
+		if i > 0 && block.Status.IsTrusted() && block.HasValidatorUpdate && hasTrustedVCP(store, db, block) {
+			blockHash = block.HCC.BlockHash
+			continue
+		}
+
 		// Grandparent or root block.
 		if i == 0 || block.HCC.BlockHash.IsEmpty() || block.Status.IsTrusted() {
 			stateRoot := block.BlockHeader.StateHash
@@ -140,6 +159,82 @@ func (ledger *Ledger) GetFinalizedValidatorCandidatePool(blockHash common.Hash,
 	return nil, fmt.Errorf("Failed to find a directly finalized ancestor block for %v", blockHash)
 }
 
+// GetValidatorCandidatePoolByHeight returns the validator candidate pool that selects the validators
+// of the finalized block at the given height, along with the block hash and the height of the state
+// the pool is read from. Like GetFinalizedValidatorCandidatePool, the pool is the one of the HCC of
+// the HCC of the block. If that state was pruned, the pool is read from the state at the last height
+// in the stake transaction height list, whose states are kept, since only the validator stake
+// transactions change the validators.
+func (ledger *Ledger) GetValidatorCandidatePoolByHeight(height uint64) (*core.ValidatorCandidatePool, common.Hash, uint64, error) {
+	db := ledger.state.DB()
+	store := kvstore.NewKVStore(db)
+
+	var block *core.ExtendedBlock
+	for _, b := range ledger.chain.FindBlocksByHeight(height) {
+		if b.Status.IsFinalized() || b.Status.IsTrusted() {
+			block = b
+			break
+		}
+	}
+	if block == nil {
+		return nil, common.Hash{}, 0, fmt.Errorf("No finalized block at height %v", height)
+	}
+	blockHash := block.Hash()
+
+	source := block
+	for i := 2; i > 0; i-- {
+		if source.HCC.BlockHash.IsEmpty() || source.Status.IsTrusted() {
+			break
+		}
+		hcc, err := findBlock(store, source.HCC.BlockHash)
+		if err != nil {
+			return nil, common.Hash{}, 0, fmt.Errorf("Failed to find HCC block %v: %v", source.HCC.BlockHash.Hex(), err)
+		}
+		source = hcc
+	}
+	if sv := st.NewStoreView(source.Height, source.StateHash, db); sv != nil {
+		if vcp := sv.GetValidatorCandidatePool(); vcp != nil {
+			return vcp, blockHash, source.Height, nil
+		}
+	}
+
+	lfb := ledger.consensus.GetLastFinalizedBlock()
+	lfbView := st.NewStoreView(lfb.Height, lfb.StateHash, db)
+	if lfbView == nil {
+		return nil, common.Hash{}, 0, fmt.Errorf("Failed to load the state of the last finalized block")
+	}
+	stakeHeight, found := uint64(0), false
+	for _, h := range lfbView.GetStakeTransactionHeightList().Heights {
+		if h <= source.Height && (!found || h > stakeHeight) {
+			stakeHeight, found = h, true
+		}
+	}
+	if !found {
+		return nil, common.Hash{}, 0, fmt.Errorf("No stake transaction height at or below %v", source.Height)
+	}
+
+	var stateHash common.Hash
+	if trio, err := core.GetBlockTrioByHeight(store, stakeHeight); err == nil {
+		stateHash = trio.First.Header.StateHash
+	} else {
+		for _, b := range ledger.chain.FindBlocksByHeight(stakeHeight) {
+			if b.Status.IsDirectlyFinalized() || b.Status.IsTrusted() || stakeHeight == core.GenesisBlockHeight {
+				stateHash = b.StateHash
+				break
+			}
+		}
+	}
+	sv := st.NewStoreView(stakeHeight, stateHash, db)
+	if stateHash.IsEmpty() || sv == nil {
+		return nil, common.Hash{}, 0, fmt.Errorf("The state at height %v is not available, it might have been pruned", stakeHeight)
+	}
+	vcp := sv.GetValidatorCandidatePool()
+	if vcp == nil {
+		return nil, common.Hash{}, 0, fmt.Errorf("No validator candidate pool at height %v", stakeHeight)
+	}
+	return vcp, blockHash, stakeHeight, nil
+}
+
 // GetGuardianCandidatePool returns the guardian candidate pool of the given block.
 func (ledger *Ledger) GetGuardianCandidatePool(blockHash common.Hash) (*core.GuardianCandidatePool, error) {
 	db := ledger.state.DB()
@@ -196,6 +291,22 @@ func (ledger *Ledger) GetEliteEdgeNodePoolOfLastCheckpoint(blockHash common.Hash
 	}
 }
 
+// hasTrustedVCP returns whether the HCC block of the trusted block is its parent, i.e. the first
+// block of the snapshot tail trio, and is a trusted block whose state root, and thus the
+// validator candidate pool, is available.
+func hasTrustedVCP(store store.Store, db database.Database, block *core.ExtendedBlock) bool {
+	hccBlockHash := block.HCC.BlockHash
+	if hccBlockHash.IsEmpty() || hccBlockHash != block.Parent {
+		return false
+	}
+	hccBlock, err := findBlock(store, hccBlockHash)
+	if err != nil || !hccBlock.Status.IsTrusted() || hccBlock.Height+1 != block.Height {
+		return false
+	}
+	found, err := db.Has(hccBlock.StateHash.Bytes())
+	return err == nil && found
+}
+
 func findBlock(store store.Store, blockHash common.Hash) (*core.ExtendedBlock, error) {
 	var block core.ExtendedBlock
 	err := store.Get(blockHash[:], &block)
@@ -298,6 +409,12 @@ func (ledger *Ledger) ProposeBlockTxs(block *core.Block, shouldIncludeValidatorU
 			if _, ok := tx.(*types.WithdrawStakeTx); ok {
 				continue
 			}
+			if _, ok := tx.(*types.EvidenceTx); ok {
+				continue
+			}
+			if _, ok := tx.(*types.RotateValidatorKeyTx); ok {
+				continue
+			}
 		}
 
 		_, res := ledger.executor.CheckTx(tx)
@@ -367,6 +484,10 @@ func (ledger *Ledger) ApplyBlockTxs(block *core.Block) result.Result {
 			hasValidatorUpdate = true
 		} else if wtx, ok := tx.(*types.WithdrawStakeTx); ok && wtx.Purpose == core.StakeForValidator {
 			hasValidatorUpdate = true
+		} else if _, ok := tx.(*types.EvidenceTx); ok {
+			hasValidatorUpdate = true
+		} else if _, ok := tx.(*types.RotateValidatorKeyTx); ok {
+			hasValidatorUpdate = true
 		}
 		_, res := ledger.executor.ExecuteTx(tx)
 		if res.IsError() {
@@ -380,7 +501,9 @@ func (ledger *Ledger) ApplyBlockTxs(block *core.Block) result.Result {
 	logger.Debugf("ApplyBlockTxs: Finish applying block transactions, block.height=%v, txProcessTime=%v", block.Height, txProcessTime)
 
 	start := time.Now()
-	ledger.handleDelayedStateUpdates(view)
+	if ledger.handleDelayedStateUpdates(view) {
+		hasValidatorUpdate = true
+	}
 	handleDelayedUpdateTime := time.Since(start)
 
 	newStateRoot := view.Hash()
@@ -448,6 +571,10 @@ func (ledger *Ledger) ApplyBlockTxsForChainCorrection(block *core.Block) (common
 			hasValidatorUpdate = true
 		} else if wtx, ok := tx.(*types.WithdrawStakeTx); ok && wtx.Purpose == core.StakeForValidator {
 			hasValidatorUpdate = true
+		} else if _, ok := tx.(*types.EvidenceTx); ok {
+			hasValidatorUpdate = true
+		} else if _, ok := tx.(*types.RotateValidatorKeyTx); ok {
+			hasValidatorUpdate = true
 		}
 		_, res := ledger.executor.ExecuteTx(tx)
 		if res.IsError() {
@@ -457,58 +584,120 @@ func (ledger *Ledger) ApplyBlockTxsForChainCorrection(block *core.Block) (common
 		}
 	}
 
-	ledger.handleDelayedStateUpdates(view)
+	if ledger.handleDelayedStateUpdates(view) {
+		hasValidatorUpdate = true
+	}
 
 	ledger.state.Commit() // commit to persistent storage
 
 	return view.Hash(), result.OKWith(result.Info{"hasValidatorUpdate": hasValidatorUpdate})
 }
 
+// TraceBlockTxs re-executes the transactions of the block on top of the state of its parent, up
+// to the one at txIndex included, or all of them if txIndex is negative. The EVM execution of each
+// smart contract transaction is reported to the tracer returned by newTracer, nil skipping the
+// transaction. The ledger state and the tx receipts are left untouched.
+func (ledger *Ledger) TraceBlockTxs(block *core.Block, txIndex int, newTracer func(index int, tx *types.SmartContractTx) vm.Tracer) error {
+	extParentBlock, err := ledger.chain.FindBlock(block.Parent)
+	if extParentBlock == nil || err != nil {
+		return fmt.Errorf("Failed to find the parent block: %v, err: %v", block.Parent.Hex(), err)
+	}
+	traceState := st.NewLedgerState(ledger.state.GetChainID(), ledger.state.DB(), nil)
+	if res := traceState.ResetState(extParentBlock.Block); res.IsError() {
+		return fmt.Errorf("State of block %v is not available, it might have been pruned", extParentBlock.Hash().Hex())
+	}
+	executor := exec.NewExecutor(ledger.state.DB(), ledger.chain, traceState, ledger.consensus, ledger.valMgr)
+	executor.SetSkipSanityCheck(true) // the block is already validated
+	executor.SetSkipTxReceipts(true)
+
+	for i, rawTx := range block.Txs {
+		if txIndex >= 0 && i > txIndex {
+			break
+		}
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return fmt.Errorf("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
+		}
+		index := i
+		executor.SetTracer(func(sctx *types.SmartContractTx) vm.Tracer {
+			return newTracer(index, sctx)
+		})
+		if _, res := executor.ExecuteTx(tx); res.IsError() {
+			return fmt.Errorf("Failed to re-execute transaction %v of block %v: %v", i, block.Hash().Hex(), res.Message)
+		}
+	}
+	return nil
+}
+
+// SetSnapshotHeightFunc sets the function returning the height of the latest exported snapshot.
+// The state pruning keeps the states from that height on, so that they stay available to export
+// and verify the snapshots.
+func (ledger *Ledger) SetSnapshotHeightFunc(snapshotHeight func() uint64) {
+	ledger.snapshotHeight = snapshotHeight
+}
+
 // PruneState attempts to prune the state up to the targetEndHeight
 func (ledger *Ledger) PruneState(targetEndHeight uint64) error {
-	// Permanently disabled
+	if !atomic.CompareAndSwapInt32(&ledger.pruning, 0, 1) {
+		return nil // the previous round is still running, it catches up gradually anyway
+	}
+	defer atomic.StoreInt32(&ledger.pruning, 0)
+
+	var processedHeight uint64
+	db := ledger.State().DB()
+	kvStore := kvstore.NewKVStore(db)
+	kvStore.Get(state.StatePruningProgressKey(), &processedHeight) // nothing processed yet if not found
+
+	snapshotHeight := uint64(0)
+	if ledger.snapshotHeight != nil {
+		snapshotHeight = ledger.snapshotHeight()
+	}
+	pruneInterval := uint64(viper.GetInt(common.CfgStorageStatePruningInterval))
+	lastFinalizedBlock := ledger.consensus.GetLastFinalizedBlock()
+
+	startHeight, endHeight, ok := statePruningRange(processedHeight, ledger.chain.Root().Height, snapshotHeight,
+		lastFinalizedBlock.Height, targetEndHeight, 3*pruneInterval) // prune too many heights at once could cause hang, should catchup gradually
+	if !ok {
+		return nil
+	}
+
+	// Need to save the progress before pruning -- in case the program exits during pruning (e.g. Ctrl+C),
+	// the states that are already pruned do not get pruned again
+	kvStore.Put(state.StatePruningProgressKey(), endHeight)
+
+	err := ledger.pruneStateForRange(startHeight, endHeight)
+	if err != nil {
+		logger.Warnf("Unable to pruning state: %v", err)
+		return err
+	}
+
 	return nil
+}
 
-	// var processedHeight uint64
-	// db := ledger.State().DB()
-	// kvStore := kvstore.NewKVStore(db)
-	// err := kvStore.Get(state.StatePruningProgressKey(), &processedHeight)
-	// if err != nil {
-	// 	processedHeight = ledger.chain.Root().Height
-	// }
-
-	// pruneInterval := uint64(viper.GetInt(common.CfgStorageStatePruningInterval))
-	// maxHeightsToPrune := 3 * pruneInterval // prune too many heights at once could cause hang, should catchup gradually
-	// endHeight := processedHeight + maxHeightsToPrune
-	// if endHeight > targetEndHeight {
-	// 	endHeight = targetEndHeight
-	// }
-
-	// startHeight := processedHeight + 1
-	// if endHeight < startHeight {
-	// 	errMsg := fmt.Sprintf("endHeight (%v) < startHeight (%v)", endHeight, startHeight)
-	// 	logger.Warnf(errMsg)
-	// 	return fmt.Errorf(errMsg)
-	// }
-
-	// lastFinalizedBlock := ledger.consensus.GetLastFinalizedBlock()
-	// if endHeight >= lastFinalizedBlock.Height {
-	// 	errMsg := fmt.Sprintf("Can't prune at height >= %v yet", lastFinalizedBlock.Height)
-	// 	logger.Warnf(errMsg)
-	// 	return fmt.Errorf(errMsg)
-	// }
-
-	// // Need to save the progress before pruning -- in case the program exits during pruning (e.g. Ctrl+C),
-	// // the states that are already pruned do not get pruned again
-	// kvStore.Put(state.StatePruningProgressKey(), endHeight)
-
-	// err = ledger.pruneStateForRange(startHeight, endHeight)
-	// if err != nil {
-	// 	logger.Warnf("Unable to pruning state: %v", err)
-	// 	return err
-	// }
-
-	// return nil
+// statePruningRange returns the heights whose states the next pruning round deletes. The range
+// starts after the processed height and the root, i.e. the snapshot the node started from, whose
+// state is kept. It ends below the latest exported snapshot and the last finalized block.
+func statePruningRange(processedHeight, rootHeight, snapshotHeight, lastFinalizedHeight, targetEndHeight, maxHeightsToPrune uint64) (startHeight, endHeight uint64, ok bool) {
+	if processedHeight < rootHeight {
+		processedHeight = rootHeight
+	}
+	startHeight = processedHeight + 1
+
+	endHeight = targetEndHeight
+	if maxHeightsToPrune > 0 && endHeight > processedHeight+maxHeightsToPrune {
+		endHeight = processedHeight + maxHeightsToPrune
+	}
+	if snapshotHeight > 0 && endHeight >= snapshotHeight {
+		endHeight = snapshotHeight - 1
+	}
+	if lastFinalizedHeight > 0 && endHeight >= lastFinalizedHeight {
+		endHeight = lastFinalizedHeight - 1
+	}
+
+	if endHeight < startHeight {
+		return 0, 0, false
+	}
+	return startHeight, endHeight, true
 }
 
 // pruneStateForRange prunes states from startHeight to endHeight (inclusive for both end)
@@ -527,9 +716,7 @@ func (ledger *Ledger) pruneStateForRange(startHeight, endHeight uint64) error {
 	hl := sv.GetStakeTransactionHeightList().Heights
 	for _, height := range hl {
 		// check kvstore first
-		blockTrio := &core.SnapshotBlockTrio{}
-		blockTrioKey := []byte(core.BlockTrioStoreKeyPrefix + strconv.FormatUint(height, 10))
-		err := kvStore.Get(blockTrioKey, blockTrio)
+		blockTrio, err := core.GetBlockTrioByHeight(kvStore, height)
 		if err == nil {
 			stateHashMap[blockTrio.First.Header.StateHash.String()] = true
 			continue
@@ -575,8 +762,7 @@ func (ledger *Ledger) pruneStateForRange(startHeight, endHeight uint64) error {
 					continue
 				}
 
-				sv := state.NewStoreView(height, block.StateHash, db)
-				err = sv.Prune()
+				err = ledger.pruneStateTrie(height, block.StateHash)
 				if err != nil {
 					return fmt.Errorf("Failed to prune storeview at height %v, %v", height, err)
 				}
@@ -589,6 +775,18 @@ func (ledger *Ledger) pruneStateForRange(startHeight, endHeight uint64) error {
 	return nil
 }
 
+// pruneStateTrie prunes the state trie of a block. The pruning runs in the background, it holds the
+// ledger lock so that the block commits do not reference a trie node between the pruner reading its
+// reference count and deleting it. The lock is taken per trie, for the block processing to proceed
+// between them.
+func (ledger *Ledger) pruneStateTrie(height uint64, stateHash common.Hash) error {
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	sv := state.NewStoreView(height, stateHash, ledger.State().DB())
+	return sv.Prune()
+}
+
 // ResetState sets the ledger state with the designated root
 //func (ledger *Ledger) ResetState(height uint64, rootHash common.Hash) result.Result {
 func (ledger *Ledger) ResetState(block *core.Block) result.Result {
@@ -635,14 +833,17 @@ func (ledger *Ledger) shouldSkipCheckTx(tx types.Tx) bool {
 		return true
 	case *types.SlashTx:
 		return true
+	case *types.EvidenceTx:
+		return true
 	default:
 		return false
 	}
 }
 
 // handleDelayedStateUpdates handles delayed state updates, e.g. stake return, where the stake
-// is returned only after X blocks of its corresponding StakeWithdraw transaction
-func (ledger *Ledger) handleDelayedStateUpdates(view *st.StoreView) {
+// is returned only after X blocks of its corresponding StakeWithdraw transaction. It returns
+// whether the validator signing keys changed.
+func (ledger *Ledger) handleDelayedStateUpdates(view *st.StoreView) bool {
 	ledger.handleValidatorStakeReturn(view)
 	ledger.handleGuardianStakeReturn(view)
 
@@ -650,6 +851,32 @@ func (ledger *Ledger) handleDelayedStateUpdates(view *st.StoreView) {
 	if blockHeight >= common.HeightEnableTheta3 {
 		ledger.handleEliteEdgeNodeStakeReturns(view)
 	}
+
+	return ledger.handleValidatorSigningKeyRotations(view)
+}
+
+// handleValidatorSigningKeyRotations activates the validator signing keys effective at the
+// current block height.
+func (ledger *Ledger) handleValidatorSigningKeyRotations(view *st.StoreView) bool {
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil || len(vcp.SigningKeys) == 0 {
+		return false
+	}
+
+	blockHeight := view.Height() + 1
+	if !vcp.ActivateSigningKeys(blockHeight) {
+		return false
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+
+	// The validator set changes, same as with a validator stake tx.
+	hl := view.GetStakeTransactionHeightList()
+	if hl == nil {
+		hl = &types.HeightList{}
+	}
+	hl.Append(blockHeight)
+	view.UpdateStakeTransactionHeightList(hl)
+	return true
 }
 
 func (ledger *Ledger) handleValidatorStakeReturn(view *st.StoreView) {
@@ -767,6 +994,7 @@ func (ledger *Ledger) addSpecialTransactions(block *core.Block, view *st.StoreVi
 
 	ledger.addCoinbaseTx(view, &proposer, validatorSet, rawTxs)
 	//ledger.addSlashTxs(view, &proposer, &validators, rawTxs)
+	ledger.addEvidenceTxs(view, &proposer, rawTxs)
 }
 
 // addCoinbaseTx adds a Coinbase transaction
@@ -856,11 +1084,71 @@ func (ledger *Ledger) addSlashTxs(view *st.StoreView, proposer *core.Validator,
 	view.ClearSlashIntents()
 }
 
+// addEvidenceTxs adds Evidence transactions for the stored evidence that can slash its offender.
+// The evidence found unable to slash is skipped in the later proposals.
+func (ledger *Ledger) addEvidenceTxs(view *st.StoreView, proposer *core.Validator, rawTxs *[]common.Bytes) {
+	if view.GetSlashingRules() == nil {
+		return
+	}
+
+	evidenceList, _, err := ledger.chain.GetEvidence(ledger.evidenceCursor, maxNumEvidenceScanned)
+	if err != nil {
+		logger.Errorf("Failed to add evidence transactions: %v", err)
+		return
+	}
+
+	chainID := ledger.state.GetChainID()
+	cursor := ledger.evidenceCursor + uint64(len(evidenceList))
+	pending := false
+	numTxs := 0
+	for i, evidence := range evidenceList {
+		seq := ledger.evidenceCursor + uint64(i)
+		if numTxs >= maxNumEvidenceTxsPerBlock {
+			if !pending {
+				cursor = seq
+			}
+			break
+		}
+		if res := exec.CheckEvidence(chainID, view, evidence); res.IsError() {
+			logger.Debugf("Skipping evidence %v: %v", evidence.Hash().Hex(), res.Message)
+			continue
+		}
+		// The evidence is checked again in the next proposals until its offender is slashed.
+		if !pending {
+			cursor = seq
+			pending = true
+		}
+
+		evidenceTx := &types.EvidenceTx{
+			Proposer: types.TxInput{
+				Address: proposer.Address,
+			},
+			Evidence: evidence,
+		}
+		signature, err := ledger.signTransaction(evidenceTx)
+		if err != nil {
+			logger.Errorf("Failed to add evidence transaction: %v", err)
+			continue
+		}
+		evidenceTx.SetSignature(proposer.Address, signature)
+		evidenceTxBytes, err := types.TxToBytes(evidenceTx)
+		if err != nil {
+			logger.Errorf("Failed to add evidence transaction: %v", err)
+			continue
+		}
+
+		*rawTxs = append(*rawTxs, evidenceTxBytes)
+		numTxs++
+		logger.Infof("Adding evidence transaction: tx: %v", evidenceTx)
+	}
+	ledger.evidenceCursor = cursor
+}
+
 // signTransaction signs the given transaction
 func (ledger *Ledger) signTransaction(tx types.Tx) (*crypto.Signature, error) {
 	chainID := ledger.state.GetChainID()
 	signBytes := tx.SignBytes(chainID)
-	signature, err := ledger.consensus.PrivateKey().Sign(signBytes)
+	signature, err := ledger.consensus.Signer().SignTx(signBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package ledger
 import (
 	"fmt"
 	"math/big"
+	"sync"
 	"testing"
 	"time"
 
@@ -678,3 +679,82 @@ func TestGuardianStakeUpdate(t *testing.T) {
 	assert.True(returnedCoins.TFuelWei.Cmp(core.Zero) == 0)
 	log.Infof("Returned coins: %v", returnedCoins)
 }
+
+func TestGetValidatorCandidatePoolByHeight(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+	snapshot, _, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+	ledger := &Ledger{chain: es.chain, consensus: es.consensus, state: es.state, mu: &sync.RWMutex{}}
+
+	blocks := []*core.Block{snapshot.block}
+	for height := uint64(1); height <= 3; height++ {
+		parent := blocks[len(blocks)-1]
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = height
+		block.Epoch = height
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = parent.Hash()
+		block.StateHash = snapshot.block.StateHash
+		es.addBlock(block)
+		blocks = append(blocks, block)
+	}
+	es.finalizePreviousBlocks(blocks[3].Hash())
+
+	// The pool is read from the state of the HCC of the HCC of the block.
+	vcp, blockHash, stateHeight, err := ledger.GetValidatorCandidatePoolByHeight(3)
+	require.Nil(err)
+	assert.Equal(blocks[3].Hash(), blockHash)
+	assert.Equal(uint64(1), stateHeight)
+	assert.Equal(len(snapshot.vcp.SortedCandidates), len(vcp.SortedCandidates))
+
+	// The HCC links stop at the root block.
+	_, blockHash, stateHeight, err = ledger.GetValidatorCandidatePoolByHeight(1)
+	require.Nil(err)
+	assert.Equal(blocks[1].Hash(), blockHash)
+	assert.Equal(uint64(0), stateHeight)
+
+	_, _, _, err = ledger.GetValidatorCandidatePoolByHeight(4)
+	assert.NotNil(err)
+}
+
+func TestStatePruningRange(t *testing.T) {
+	assert := assert.New(t)
+
+	// Catches up gradually from the root
+	start, end, ok := statePruningRange(0, 100, 0, 5000, 3000, 48)
+	assert.True(ok)
+	assert.Equal(uint64(101), start)
+	assert.Equal(uint64(148), end)
+
+	start, end, ok = statePruningRange(148, 100, 0, 5000, 3000, 48)
+	assert.True(ok)
+	assert.Equal(uint64(149), start)
+	assert.Equal(uint64(196), end)
+
+	start, end, ok = statePruningRange(2990, 100, 0, 5000, 3000, 48)
+	assert.True(ok)
+	assert.Equal(uint64(2991), start)
+	assert.Equal(uint64(3000), end)
+
+	// Never reaches the latest snapshot nor the last finalized block
+	start, end, ok = statePruningRange(2000, 100, 2020, 5000, 3000, 48)
+	assert.True(ok)
+	assert.Equal(uint64(2001), start)
+	assert.Equal(uint64(2019), end)
+	_, _, ok = statePruningRange(2019, 100, 2020, 5000, 3000, 48)
+	assert.False(ok)
+	_, end, ok = statePruningRange(2990, 100, 0, 2995, 3000, 48)
+	assert.True(ok)
+	assert.Equal(uint64(2994), end)
+
+	// Nothing to prune yet
+	_, _, ok = statePruningRange(3000, 100, 0, 5000, 3000, 48)
+	assert.False(ok)
+	_, _, ok = statePruningRange(0, 4000, 0, 5000, 3000, 48)
+	assert.False(ok)
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// StateDiff is a state key whose value differs between two states. For a storage slot,
+// Storage is set and Account is the owner of the storage.
+type StateDiff struct {
+	Key      common.Bytes
+	OldValue common.Bytes // nil if added
+	NewValue common.Bytes // nil if removed
+	Storage  bool
+	Account  common.Address
+}
+
+// Diff walks the state tries of the two roots and calls cb on each changed key in key order,
+// each changed account being followed by the changed slots of its storage. The walk stops
+// once cb returns false. The subtries the two states share are skipped, so the cost of the
+// walk is proportional to the changes rather than to the state size.
+func Diff(db database.Database, oldRoot, newRoot common.Hash, cb func(diff *StateDiff) bool) error {
+	_, err := walkTrieDiff(db, oldRoot, newRoot, func(key, oldValue, newValue common.Bytes) (bool, error) {
+		if !cb(&StateDiff{Key: key, OldValue: oldValue, NewValue: newValue}) {
+			return false, nil
+		}
+		addr, ok := AccountKeyAddress(key)
+		if !ok {
+			return true, nil
+		}
+		oldStorage, newStorage := accountStorageRoot(oldValue), accountStorageRoot(newValue)
+		if oldStorage == newStorage {
+			return true, nil
+		}
+		cont, err := walkTrieDiff(db, oldStorage, newStorage, func(slot, oldValue, newValue common.Bytes) (bool, error) {
+			return cb(&StateDiff{Key: slot, OldValue: oldValue, NewValue: newValue, Storage: true, Account: addr}), nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("Failed to compare the storage of account %v: %v", addr.Hex(), err)
+		}
+		return cont, nil
+	})
+	return err
+}
+
+// walkTrieDiff calls cb on the keys with different values in the two tries, in key order, and
+// returns false if cb stopped the walk.
+func walkTrieDiff(db database.Database, oldRoot, newRoot common.Hash, cb func(key, oldValue, newValue common.Bytes) (bool, error)) (bool, error) {
+	oldTrie, err := trie.New(oldRoot, trie.NewDatabase(db))
+	if err != nil {
+		return false, err
+	}
+	newTrie, err := trie.New(newRoot, trie.NewDatabase(db))
+	if err != nil {
+		return false, err
+	}
+
+	// The leaves of the new trie missing from the old trie are added or modified, the
+	// leaves of the old trie missing from the new trie are removed or modified.
+	addedIt, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil))
+	removedIt, _ := trie.NewDifferenceIterator(newTrie.NodeIterator(nil), oldTrie.NodeIterator(nil))
+	added, removed := trie.NewIterator(addedIt), trie.NewIterator(removedIt)
+	hasAdded, hasRemoved := added.Next(), removed.Next()
+	for hasAdded || hasRemoved {
+		var key, oldValue, newValue common.Bytes
+		cmp := 0
+		if !hasRemoved {
+			cmp = -1
+		} else if !hasAdded {
+			cmp = 1
+		} else {
+			cmp = bytes.Compare(added.Key, removed.Key)
+		}
+		if cmp <= 0 {
+			key, newValue = common.CopyBytes(added.Key), common.CopyBytes(added.Value)
+			hasAdded = added.Next()
+		}
+		if cmp >= 0 {
+			key, oldValue = common.CopyBytes(removed.Key), common.CopyBytes(removed.Value)
+			hasRemoved = removed.Next()
+		}
+		cont, err := cb(key, oldValue, newValue)
+		if err != nil || !cont {
+			return false, err
+		}
+	}
+	if added.Err != nil {
+		return false, added.Err
+	}
+	if removed.Err != nil {
+		return false, removed.Err
+	}
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestStateDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+	slot1 := common.HexToHash("0x11")
+	slot2 := common.HexToHash("0x12")
+
+	sv := NewStoreView(0, common.Hash{}, db)
+	sv.AddBalance(addr1, big.NewInt(100))
+	sv.SetState(addr2, slot1, common.HexToHash("0xa1"))
+	sv.SetState(addr2, slot2, common.HexToHash("0xa2"))
+	sv.Set(common.Bytes("ls/test"), common.Bytes("value"))
+	oldRoot := sv.Save()
+
+	sv.AddBalance(addr1, big.NewInt(10))
+	sv.SetState(addr2, slot1, common.HexToHash("0xa3"))
+	sv.SetState(addr2, slot2, common.Hash{})
+	sv.AddBalance(addr3, big.NewInt(1))
+	sv.Delete(common.Bytes("ls/test"))
+	newRoot := sv.Save()
+
+	diffs := []*StateDiff{}
+	require.Nil(Diff(db, oldRoot, newRoot, func(diff *StateDiff) bool {
+		diffs = append(diffs, diff)
+		return true
+	}))
+	require.Equal(6, len(diffs))
+
+	assert.Equal(AccountKey(addr1), diffs[0].Key)
+	assert.NotNil(diffs[0].OldValue)
+	assert.NotNil(diffs[0].NewValue)
+	assert.Equal(AccountKey(addr2), diffs[1].Key)
+	assert.True(diffs[2].Storage)
+	assert.Equal(addr2, diffs[2].Account)
+	assert.Equal(common.Bytes(slot1[:]), diffs[2].Key)
+	assert.Equal(common.Bytes(slot2[:]), diffs[3].Key)
+	assert.NotNil(diffs[3].OldValue)
+	assert.Nil(diffs[3].NewValue)
+	assert.Equal(AccountKey(addr3), diffs[4].Key)
+	assert.Nil(diffs[4].OldValue)
+	assert.Equal(common.Bytes("ls/test"), diffs[5].Key)
+	assert.Equal(common.Bytes("value"), diffs[5].OldValue)
+	assert.Nil(diffs[5].NewValue)
+
+	count := 0
+	require.Nil(Diff(db, oldRoot, newRoot, func(diff *StateDiff) bool {
+		count++
+		return count < 2
+	}))
+	assert.Equal(2, count)
+
+	require.Nil(Diff(db, newRoot, newRoot, func(diff *StateDiff) bool {
+		assert.Fail("No change expected")
+		return true
+	}))
+}
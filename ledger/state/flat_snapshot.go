@@ -0,0 +1,574 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// maxFlatSnapshotLinkNodes caps the trie nodes scanned to link a state root missing from the
+// snapshot to the disk layer, above which the disk layer is regenerated instead.
+const maxFlatSnapshotLinkNodes = 200000
+
+// flatSnapshotDeleteBatchSize is the number of keys of a discarded disk layer deleted per batch.
+const flatSnapshotDeleteBatchSize = 10000
+
+var (
+	flatSnapshotRootKey       = common.Bytes("fs/root")
+	flatSnapshotGenerationKey = common.Bytes("fs/gen")
+	flatSnapshotDeletedKey    = common.Bytes("fs/del") // generations below it are deleted
+)
+
+// prefixIterableDatabase is implemented by the databases iterating over the keys with a prefix,
+// which the flat snapshot needs to delete the discarded disk layers.
+type prefixIterableDatabase interface {
+	NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+}
+
+//
+// ------------------------- FlatSnapshot -------------------------
+//
+
+// FlatSnapshot is a flat key-value layer of the accounts and the account storages on top of
+// the state trie, so the reads skip the trie traversal. The disk layer holds the values at the
+// last finalized state root, filled from the trie on the first read of each key, and the
+// in-memory diff layers hold the changes of the states committed on top of it.
+type FlatSnapshot struct {
+	mu      sync.RWMutex
+	db      database.Database // database of the flat layer
+	stateDB database.Database // database of the state tries
+
+	diskRoot   common.Hash
+	generation uint64                    // bumped to discard the disk layer
+	diffs      map[common.Hash]*flatDiff // by state root
+
+	deleted  uint64         // generations below it are deleted
+	deleting bool           // whether the discarded generations are being deleted
+	wg       sync.WaitGroup // waits for the deletion of the discarded generations
+}
+
+// flatDiff holds the changes from the parent state root.
+type flatDiff struct {
+	parent   common.Hash
+	accounts map[common.Address]common.Bytes                 // nil for a removed account
+	storage  map[common.Address]map[common.Hash]common.Bytes // nil for a removed slot
+	reset    map[common.Address]bool                         // storage emptied
+}
+
+// NewFlatSnapshot creates the flat snapshot stored in db, of the states stored in stateDB.
+func NewFlatSnapshot(db, stateDB database.Database) *FlatSnapshot {
+	s := &FlatSnapshot{
+		db:      db,
+		stateDB: stateDB,
+		diffs:   make(map[common.Hash]*flatDiff),
+	}
+	if root, err := db.Get(flatSnapshotRootKey); err == nil {
+		s.diskRoot = common.BytesToHash(root)
+	}
+	if generation, err := db.Get(flatSnapshotGenerationKey); err == nil && len(generation) == 8 {
+		s.generation = binary.BigEndian.Uint64(generation)
+	}
+	if deleted, err := db.Get(flatSnapshotDeletedKey); err == nil && len(deleted) == 8 {
+		s.deleted = binary.BigEndian.Uint64(deleted)
+	}
+	s.deleteDiscardedGenerations() // left by a restart during the deletion
+	return s
+}
+
+// DiskRoot returns the state root of the disk layer.
+func (s *FlatSnapshot) DiskRoot() common.Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.diskRoot
+}
+
+// Covers returns whether the snapshot serves the reads at the state root.
+func (s *FlatSnapshot) Covers(root common.Hash) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.covers(root)
+}
+
+func (s *FlatSnapshot) covers(root common.Hash) bool {
+	_, ok := s.diffs[root]
+	return ok || root == s.diskRoot
+}
+
+// Account returns the encoded account at the state root, nil if there is none, and whether
+// the snapshot covers the root. On a disk layer miss, the value is read with load, which needs
+// to read the account at the state root, and is added to the disk layer.
+func (s *FlatSnapshot) Account(root common.Hash, addr common.Address, load func() common.Bytes) (common.Bytes, bool) {
+	s.mu.RLock()
+	value, fillKey, ok := s.lookupAccount(root, addr)
+	diskRoot, generation := s.diskRoot, s.generation
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	if fillKey != nil {
+		value = load()
+		s.fill(diskRoot, generation, fillKey, value)
+	}
+	return value, true
+}
+
+// Storage returns the encoded value of the storage slot of the account at the state root, and
+// whether the snapshot covers the root. It reads the disk layer misses like Account.
+func (s *FlatSnapshot) Storage(root common.Hash, addr common.Address, key common.Hash, load func() common.Bytes) (common.Bytes, bool) {
+	s.mu.RLock()
+	value, fillKey, ok := s.lookupStorage(root, addr, key)
+	diskRoot, generation := s.diskRoot, s.generation
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	if fillKey != nil {
+		value = load()
+		s.fill(diskRoot, generation, fillKey, value)
+	}
+	return value, true
+}
+
+// lookupAccount returns the value of the account, or the disk layer key to fill on a miss.
+func (s *FlatSnapshot) lookupAccount(root common.Hash, addr common.Address) (common.Bytes, common.Bytes, bool) {
+	for root != s.diskRoot {
+		diff, ok := s.diffs[root]
+		if !ok {
+			return nil, nil, false
+		}
+		if value, ok := diff.accounts[addr]; ok {
+			return value, nil, true
+		}
+		root = diff.parent
+	}
+
+	key := flatAccountKey(s.generation, addr)
+	if value, ok := s.readDisk(key); ok {
+		return value, nil, true
+	}
+	return nil, key, true
+}
+
+// lookupStorage returns the value of the storage slot, or the disk layer key to fill on a miss.
+func (s *FlatSnapshot) lookupStorage(root common.Hash, addr common.Address, key common.Hash) (common.Bytes, common.Bytes, bool) {
+	for root != s.diskRoot {
+		diff, ok := s.diffs[root]
+		if !ok {
+			return nil, nil, false
+		}
+		if value, ok := diff.storage[addr][key]; ok {
+			return value, nil, true
+		}
+		if diff.reset[addr] {
+			return nil, nil, true
+		}
+		root = diff.parent
+	}
+
+	diskKey := flatStorageKey(s.generation, addr, s.incarnation(addr), key)
+	if value, ok := s.readDisk(diskKey); ok {
+		return value, nil, true
+	}
+	return nil, diskKey, true
+}
+
+func (s *FlatSnapshot) readDisk(key common.Bytes) (common.Bytes, bool) {
+	enc, err := s.db.Get(key)
+	if err != nil || len(enc) == 0 {
+		return nil, false
+	}
+	if enc[0] == 0 {
+		return nil, true
+	}
+	return common.Bytes(enc[1:]), true
+}
+
+// fill adds the value read from the trie to the disk layer, unless the disk layer changed.
+func (s *FlatSnapshot) fill(diskRoot common.Hash, generation uint64, key, value common.Bytes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.diskRoot != diskRoot || s.generation != generation {
+		return
+	}
+	if err := s.db.Put(key, encodeFlatValue(value)); err != nil {
+		logger.Warnf("Failed to write the flat snapshot: %v", err)
+	}
+}
+
+// incarnation returns the number of times the storage of the account was emptied, which
+// prefixes its slots in the disk layer.
+func (s *FlatSnapshot) incarnation(addr common.Address) uint64 {
+	enc, err := s.db.Get(flatIncarnationKey(s.generation, addr))
+	if err != nil || len(enc) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(enc)
+}
+
+// Update adds the changes from the parent state root to the committed state root. If the
+// snapshot does not cover the parent, the changes are taken from the disk layer instead,
+// unless there are too many of them.
+func (s *FlatSnapshot) Update(parent, root common.Hash) error {
+	s.mu.RLock()
+	covered, parentCovered, diskRoot := s.covers(root), s.covers(parent), s.diskRoot
+	s.mu.RUnlock()
+
+	if covered {
+		return nil
+	}
+	if !parentCovered {
+		return s.update(diskRoot, root, maxFlatSnapshotLinkNodes)
+	}
+	return s.update(parent, root, 0)
+}
+
+func (s *FlatSnapshot) update(parent, root common.Hash, limit int) error {
+	diff, err := s.computeDiff(parent, root, limit)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.covers(parent) {
+		return fmt.Errorf("State root %v is no longer in the flat snapshot", parent.Hex())
+	}
+	s.diffs[root] = diff
+	return nil
+}
+
+// Cap flattens the diff layers up to the finalized state root into the disk layer, and drops
+// the diff layers not built on top of it. The disk layer is regenerated if the snapshot can
+// not be linked to the state root.
+func (s *FlatSnapshot) Cap(root common.Hash) error {
+	if !s.Covers(root) {
+		if err := s.update(s.DiskRoot(), root, maxFlatSnapshotLinkNodes); err != nil {
+			logger.Infof("Regenerating the flat snapshot at state root %v: %v", root.Hex(), err)
+			return s.reset(root)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := []*flatDiff{}
+	for curr := root; curr != s.diskRoot; {
+		diff, ok := s.diffs[curr]
+		if !ok {
+			return fmt.Errorf("State root %v is no longer in the flat snapshot", root.Hex())
+		}
+		path = append(path, diff)
+		curr = diff.parent
+	}
+
+	batch := s.db.NewBatch()
+	incarnations := make(map[common.Address]uint64)
+	incarnation := func(addr common.Address) uint64 {
+		if inc, ok := incarnations[addr]; ok {
+			return inc
+		}
+		return s.incarnation(addr)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		diff := path[i]
+		for addr := range diff.reset {
+			incarnations[addr] = incarnation(addr) + 1
+			batch.Put(flatIncarnationKey(s.generation, addr), encodeUint64(incarnations[addr]))
+		}
+		for addr, value := range diff.accounts {
+			batch.Put(flatAccountKey(s.generation, addr), encodeFlatValue(value))
+		}
+		for addr, slots := range diff.storage {
+			inc := incarnation(addr)
+			for key, value := range slots {
+				batch.Put(flatStorageKey(s.generation, addr, inc, key), encodeFlatValue(value))
+			}
+		}
+	}
+	batch.Put(flatSnapshotRootKey, root[:])
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("Failed to write the flat snapshot: %v", err)
+	}
+
+	s.diskRoot = root
+	delete(s.diffs, root)
+	for diffRoot := range s.diffs {
+		if !s.builtOnDisk(diffRoot) {
+			delete(s.diffs, diffRoot)
+		}
+	}
+	return nil
+}
+
+func (s *FlatSnapshot) builtOnDisk(root common.Hash) bool {
+	for root != s.diskRoot {
+		diff, ok := s.diffs[root]
+		if !ok {
+			return false
+		}
+		root = diff.parent
+	}
+	return true
+}
+
+// reset discards the disk and diff layers, and restarts the disk layer at the state root.
+func (s *FlatSnapshot) reset(root common.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.db.NewBatch()
+	batch.Put(flatSnapshotGenerationKey, encodeUint64(s.generation+1))
+	batch.Put(flatSnapshotRootKey, root[:])
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("Failed to reset the flat snapshot: %v", err)
+	}
+	s.generation++
+	s.diskRoot = root
+	s.diffs = make(map[common.Hash]*flatDiff)
+	s.deleteDiscardedGenerationsLocked()
+	return nil
+}
+
+// deleteDiscardedGenerations deletes the disk layers discarded by the resets in the background.
+func (s *FlatSnapshot) deleteDiscardedGenerations() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteDiscardedGenerationsLocked()
+}
+
+func (s *FlatSnapshot) deleteDiscardedGenerationsLocked() {
+	if s.deleting || s.deleted >= s.generation {
+		return
+	}
+	db, ok := s.db.(prefixIterableDatabase)
+	if !ok {
+		logger.Warnf("The flat snapshot database can not delete the discarded generations")
+		return
+	}
+	s.deleting = true
+	s.wg.Add(1)
+	go s.deleteGenerations(db)
+}
+
+// deleteGenerations deletes the keys of the discarded generations, including the ones
+// discarded during the deletion. The keys are no longer read once their generation is
+// discarded, the deletion only reclaims the space.
+func (s *FlatSnapshot) deleteGenerations(db prefixIterableDatabase) {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		generation, deleted := s.generation, s.deleted
+		if deleted >= generation {
+			s.deleting = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		for ; deleted < generation; deleted++ {
+			if err := s.deleteGeneration(db, deleted); err != nil {
+				logger.Warnf("Failed to delete the flat snapshot generation %v: %v", deleted, err)
+				s.mu.Lock()
+				s.deleting = false
+				s.mu.Unlock()
+				return
+			}
+			if err := s.db.Put(flatSnapshotDeletedKey, encodeUint64(deleted+1)); err != nil {
+				logger.Warnf("Failed to write the flat snapshot: %v", err)
+			}
+			s.mu.Lock()
+			s.deleted = deleted + 1
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *FlatSnapshot) deleteGeneration(db prefixIterableDatabase, generation uint64) error {
+	it := db.NewIteratorWithPrefix(flatGenerationPrefix(generation))
+	defer it.Release()
+
+	batch := s.db.NewBatch()
+	count := 0
+	for it.Next() {
+		batch.Delete(common.CopyBytes(it.Key()))
+		count++
+		if count%flatSnapshotDeleteBatchSize == 0 {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// computeDiff returns the changes of the accounts and their storages between the two state
+// roots. A positive limit caps the trie nodes scanned.
+func (s *FlatSnapshot) computeDiff(parent, root common.Hash, limit int) (*flatDiff, error) {
+	diff := &flatDiff{
+		parent:   parent,
+		accounts: make(map[common.Address]common.Bytes),
+		storage:  make(map[common.Address]map[common.Hash]common.Bytes),
+		reset:    make(map[common.Address]bool),
+	}
+
+	prefix := AccountKeyPrefix()
+	added, removed, err := diffTries(s.stateDB, parent, root, prefix, &limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compare the state tries: %v", err)
+	}
+	for key := range removed {
+		if _, ok := added[key]; !ok {
+			added[key] = nil
+		}
+	}
+	for key, value := range added {
+		addr, ok := AccountKeyAddress(common.Bytes(key))
+		if !ok {
+			continue
+		}
+		diff.accounts[addr] = value
+
+		oldStorage, newStorage := accountStorageRoot(removed[key]), accountStorageRoot(value)
+		if oldStorage == newStorage {
+			continue
+		}
+		if newStorage == core.EmptyRootHash {
+			diff.reset[addr] = true
+			continue
+		}
+		addedSlots, removedSlots, err := diffTries(s.stateDB, oldStorage, newStorage, nil, &limit)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare the storage of account %v: %v", addr.Hex(), err)
+		}
+		slots := make(map[common.Hash]common.Bytes)
+		for key := range removedSlots {
+			slots[common.BytesToHash([]byte(key))] = nil
+		}
+		for key, value := range addedSlots {
+			slots[common.BytesToHash([]byte(key))] = value
+		}
+		diff.storage[addr] = slots
+	}
+	return diff, nil
+}
+
+// accountStorageRoot returns the storage root of the encoded account, the empty root if there
+// is no account or storage.
+func accountStorageRoot(value common.Bytes) common.Hash {
+	if len(value) == 0 {
+		return core.EmptyRootHash
+	}
+	account := &types.Account{}
+	if err := types.FromBytes(value, account); err != nil || account.Root == (common.Hash{}) {
+		return core.EmptyRootHash
+	}
+	return account.Root
+}
+
+// diffTries returns the leaves with the prefix only in the new trie or with a new value, and
+// the ones only in the old trie or with an old value. A positive limit is decreased by the
+// trie nodes scanned, and an error returned once exceeded.
+func diffTries(db database.Database, oldRoot, newRoot common.Hash, prefix common.Bytes, limit *int) (map[string]common.Bytes, map[string]common.Bytes, error) {
+	oldTrie, err := trie.New(oldRoot, trie.NewDatabase(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	newTrie, err := trie.New(newRoot, trie.NewDatabase(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	added, err := differentLeaves(oldTrie, newTrie, prefix, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	removed, err := differentLeaves(newTrie, oldTrie, prefix, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// differentLeaves returns the leaves of trie b with the prefix which are not in trie a.
+func differentLeaves(a, b *trie.Trie, prefix common.Bytes, limit *int) (map[string]common.Bytes, error) {
+	it, count := trie.NewDifferenceIterator(a.NodeIterator(prefix), b.NodeIterator(prefix))
+	leaves := make(map[string]common.Bytes)
+	for it.Next(true) {
+		if *limit > 0 && *count > *limit {
+			return nil, fmt.Errorf("More than %v trie nodes changed", *limit)
+		}
+		if !it.Leaf() {
+			continue
+		}
+		key := it.LeafKey()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		leaves[string(key)] = common.CopyBytes(it.LeafBlob())
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if *limit > 0 {
+		*limit -= *count
+		if *limit <= 0 {
+			return nil, fmt.Errorf("Too many trie nodes changed")
+		}
+	}
+	return leaves, nil
+}
+
+func flatAccountKey(generation uint64, addr common.Address) common.Bytes {
+	return flatKey(generation, 'a', addr[:])
+}
+
+func flatIncarnationKey(generation uint64, addr common.Address) common.Bytes {
+	return flatKey(generation, 'i', addr[:])
+}
+
+func flatStorageKey(generation uint64, addr common.Address, incarnation uint64, key common.Hash) common.Bytes {
+	return flatKey(generation, 's', addr[:], encodeUint64(incarnation), key[:])
+}
+
+func flatKey(generation uint64, kind byte, parts ...[]byte) common.Bytes {
+	key := flatGenerationPrefix(generation)
+	key = append(key, kind)
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return key
+}
+
+func flatGenerationPrefix(generation uint64) common.Bytes {
+	return append(common.Bytes("fs/"), encodeUint64(generation)...)
+}
+
+func encodeUint64(value uint64) common.Bytes {
+	enc := make(common.Bytes, 8)
+	binary.BigEndian.PutUint64(enc, value)
+	return enc
+}
+
+// encodeFlatValue prefixes the value with a flag telling apart the missing values from the
+// keys not in the disk layer yet.
+func encodeFlatValue(value common.Bytes) common.Bytes {
+	if len(value) == 0 {
+		return common.Bytes{0}
+	}
+	return append(common.Bytes{1}, value...)
+}
@@ -0,0 +1,124 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestFlatSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+	key1 := common.HexToHash("0x11")
+	key2 := common.HexToHash("0x12")
+
+	sv := NewStoreView(0, common.Hash{}, db)
+	sv.AddBalance(addr1, big.NewInt(100))
+	sv.SetState(addr2, key1, common.HexToHash("0xa1"))
+	sv.SetState(addr2, key2, common.HexToHash("0xa2"))
+	sv.SetState(addr3, key1, common.HexToHash("0xb1"))
+	root0 := sv.Save()
+
+	snapshot := NewFlatSnapshot(db, db)
+	require.Nil(snapshot.Cap(root0))
+	assert.Equal(root0, snapshot.DiskRoot())
+
+	// The reads through the snapshot match the ones from the trie.
+	checkView := func(root common.Hash) {
+		trieView := NewStoreView(0, root, db)
+		view := NewStoreView(0, root, db)
+		view.attachSnapshot(snapshot, root)
+		for i := 0; i < 2; i++ { // the second round reads the disk layer
+			for _, addr := range []common.Address{addr1, addr2, addr3} {
+				assert.Equal(trieView.GetAccount(addr), view.GetAccount(addr))
+				for _, key := range []common.Hash{key1, key2} {
+					assert.Equal(trieView.GetState(addr, key), view.GetState(addr, key))
+				}
+			}
+		}
+	}
+	checkView(root0)
+
+	sv = NewStoreView(0, root0, db)
+	sv.attachSnapshot(snapshot, root0)
+	sv.AddBalance(addr1, big.NewInt(10))
+	assert.Equal(big.NewInt(110), sv.GetBalance(addr1)) // written accounts are read from the trie
+	sv.SetState(addr2, key1, common.HexToHash("0xa3"))
+	sv.SetState(addr2, key2, common.Hash{})
+	sv.DeleteAccount(addr3)
+	root1 := sv.Save()
+	require.Nil(snapshot.Update(root0, root1))
+	checkView(root1)
+
+	fork := NewStoreView(0, root0, db)
+	fork.AddBalance(addr1, big.NewInt(20))
+	rootFork := fork.Save()
+	require.Nil(snapshot.Update(root0, rootFork))
+	checkView(rootFork)
+
+	require.Nil(snapshot.Cap(root1))
+	assert.Equal(root1, snapshot.DiskRoot())
+	assert.False(snapshot.Covers(rootFork))
+	checkView(root1)
+	assert.Equal(common.Hash{}, NewStoreView(0, root1, db).GetState(addr3, key1))
+
+	// An account recreated after its storage was emptied.
+	sv = NewStoreView(0, root1, db)
+	sv.SetState(addr3, key2, common.HexToHash("0xb2"))
+	root2 := sv.Save()
+	require.Nil(snapshot.Update(root1, root2))
+	require.Nil(snapshot.Cap(root2))
+	checkView(root2)
+}
+
+func TestFlatSnapshotResetDeletesGeneration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	addr := common.HexToAddress("0x1")
+	key := common.HexToHash("0x11")
+	sv := NewStoreView(0, common.Hash{}, db)
+	sv.AddBalance(addr, big.NewInt(100))
+	sv.SetState(addr, key, common.HexToHash("0xa1"))
+	root0 := sv.Save()
+
+	snapshot := NewFlatSnapshot(db, db)
+	require.Nil(snapshot.Cap(root0))
+	view := NewStoreView(0, root0, db)
+	view.attachSnapshot(snapshot, root0)
+	view.GetAccount(addr)
+	view.GetState(addr, key)
+	countKeys := func(generation uint64) int {
+		count := 0
+		it := db.NewIteratorWithPrefix(flatGenerationPrefix(generation))
+		defer it.Release()
+		for it.Next() {
+			count++
+		}
+		return count
+	}
+	require.True(countKeys(0) > 0)
+
+	require.Nil(snapshot.reset(root0))
+	snapshot.wg.Wait()
+	assert.Equal(0, countKeys(0))
+	assert.Equal(uint64(1), snapshot.deleted)
+
+	// A generation left by a restart during the deletion is deleted on the restart.
+	require.Nil(db.Put(flatAccountKey(1, addr), encodeFlatValue(common.Bytes{1})))
+	require.Nil(db.Put(flatSnapshotGenerationKey, encodeUint64(2)))
+	restarted := NewFlatSnapshot(db, db)
+	restarted.wg.Wait()
+	assert.Equal(0, countKeys(1))
+	assert.Equal(uint64(2), restarted.deleted)
+}
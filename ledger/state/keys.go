@@ -1,6 +1,7 @@
 package state
 
 import (
+	"bytes"
 	"strconv"
 
 	"github.com/thetatoken/theta/common"
@@ -15,9 +16,23 @@ func ChainIDKey() common.Bytes {
 	return common.Bytes("chainid")
 }
 
+// AccountKeyPrefix returns the prefix of the account keys
+func AccountKeyPrefix() common.Bytes {
+	return common.Bytes("ls/a/")
+}
+
 // AccountKey constructs the state key for the given address
 func AccountKey(addr common.Address) common.Bytes {
-	return append(common.Bytes("ls/a/"), addr[:]...)
+	return append(AccountKeyPrefix(), addr[:]...)
+}
+
+// AccountKeyAddress returns the address of the account key, and false if it is not an account key
+func AccountKeyAddress(key common.Bytes) (common.Address, bool) {
+	prefix := AccountKeyPrefix()
+	if len(key) != len(prefix)+common.AddressLength || !bytes.HasPrefix(key, prefix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(key[len(prefix):]), true
 }
 
 // SplitRuleKeyPrefix returns the prefix for the split rule key
@@ -98,3 +113,23 @@ func EliteEdgeNodeStakeReturnsKey(height uint64) common.Bytes {
 func EliteEdgeNodesTotalActiveStakeKey() common.Bytes {
 	return common.Bytes("ls/eentas")
 }
+
+// SlashingRulesKey returns the state key for the slashing rules set in the genesis
+func SlashingRulesKey() common.Bytes {
+	return common.Bytes("ls/slr")
+}
+
+// ProposerSelectionKey returns the state key for the proposer selection strategy set in the genesis
+func ProposerSelectionKey() common.Bytes {
+	return common.Bytes("ls/pps")
+}
+
+// SlashedValidatorKeyPrefix returns the prefix of the slashed validator key
+func SlashedValidatorKeyPrefix() common.Bytes {
+	return common.Bytes("ls/slv/")
+}
+
+// SlashedValidatorKey returns the key for the height a validator was last slashed at
+func SlashedValidatorKey(addr common.Address) common.Bytes {
+	return append(SlashedValidatorKeyPrefix(), addr[:]...)
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/treestore"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// GetProof returns the Merkle proof of the state key against the state root. For a key not
+// set, the proof shows its absence.
+func (sv *StoreView) GetProof(key common.Bytes) (*core.VCPProof, error) {
+	proof := &core.VCPProof{}
+	if err := sv.store.ProveVCP(key, proof); err != nil {
+		return nil, fmt.Errorf("Failed to prove state key %v: %v", common.Bytes2Hex(key), err)
+	}
+	return proof, nil
+}
+
+// GetAccountProof returns the Merkle proof of the account against the state root.
+func (sv *StoreView) GetAccountProof(addr common.Address) (*core.VCPProof, error) {
+	return sv.GetProof(AccountKey(addr))
+}
+
+// GetStorageProof returns the Merkle proof of the storage slot against the storage root of
+// the account.
+func (sv *StoreView) GetStorageProof(addr common.Address, key common.Hash) (*core.VCPProof, error) {
+	account := sv.GetAccount(addr)
+	if account == nil {
+		return nil, fmt.Errorf("Account %v is not found", addr.Hex())
+	}
+	storage := treestore.NewTreeStore(account.Root, sv.GetDB())
+	if storage == nil {
+		return nil, fmt.Errorf("Storage of account %v is not available, it might have been pruned", addr.Hex())
+	}
+	proof := &core.VCPProof{}
+	if err := storage.ProveVCP(key[:], proof); err != nil {
+		return nil, fmt.Errorf("Failed to prove storage slot %v of account %v: %v", key.Hex(), addr.Hex(), err)
+	}
+	return proof, nil
+}
+
+// VerifyAccountProof verifies the proof of the account against the state root, and returns the
+// account, or nil if the proof shows it does not exist.
+func VerifyAccountProof(stateRoot common.Hash, addr common.Address, proof *core.VCPProof) (*types.Account, error) {
+	data, _, err := trie.VerifyProof(stateRoot, AccountKey(addr), proof)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	account := &types.Account{}
+	if err := types.FromBytes(data, account); err != nil {
+		return nil, fmt.Errorf("Failed to parse account %v: %v", addr.Hex(), err)
+	}
+	return account, nil
+}
+
+// VerifyStorageProof verifies the proof of the storage slot against the storage root of the
+// account, and returns the slot value, empty if the proof shows it is not set.
+func VerifyStorageProof(storageRoot common.Hash, key common.Hash, proof *core.VCPProof) (common.Hash, error) {
+	enc, _, err := trie.VerifyProof(storageRoot, key[:], proof)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(enc) == 0 {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("Failed to parse storage slot %v: %v", key.Hex(), err)
+	}
+	return common.BytesToHash(content), nil
+}
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestStateProof(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	slot := common.HexToHash("0x11")
+
+	sv := NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	sv.AddBalance(addr1, big.NewInt(100))
+	sv.SetState(addr1, slot, common.HexToHash("0xa1"))
+	root := sv.Save()
+
+	proof, err := sv.GetAccountProof(addr1)
+	require.Nil(err)
+	raw, err := rlp.EncodeToBytes(proof)
+	require.Nil(err)
+	decoded := &core.VCPProof{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+
+	account, err := VerifyAccountProof(root, addr1, decoded)
+	require.Nil(err)
+	require.NotNil(account)
+	assert.Equal(big.NewInt(100), account.Balance.TFuelWei)
+	_, err = VerifyAccountProof(common.HexToHash("0x12"), addr1, decoded)
+	assert.NotNil(err)
+
+	// The proof of a missing account shows its absence.
+	proof, err = sv.GetAccountProof(addr2)
+	require.Nil(err)
+	account, err = VerifyAccountProof(root, addr2, proof)
+	assert.Nil(err)
+	assert.Nil(account)
+
+	proof, err = sv.GetStorageProof(addr1, slot)
+	require.Nil(err)
+	value, err := VerifyStorageProof(sv.GetAccount(addr1).Root, slot, proof)
+	require.Nil(err)
+	assert.Equal(common.HexToHash("0xa1"), value)
+	_, err = sv.GetStorageProof(addr2, slot)
+	assert.NotNil(err)
+}
@@ -29,6 +29,8 @@ type LedgerState struct {
 	delivered *StoreView // for actually applying the transactions
 	checked   *StoreView // for block proposal check
 	screened  *StoreView // for mempool screening
+
+	snapshot *FlatSnapshot // nil if the flat snapshot is disabled
 }
 
 // NewLedgerState creates a new Leger State with given store.
@@ -62,6 +64,9 @@ func (s *LedgerState) ResetState(block *core.Block) result.Result {
 	if storeview == nil {
 		return result.Error(fmt.Sprintf("Failed to set ledger state with state root hash: %v", stateRootHash))
 	}
+	if s.snapshot != nil {
+		storeview.attachSnapshot(s.snapshot, stateRootHash)
+	}
 	s.delivered = storeview
 
 	var err error
@@ -83,10 +88,22 @@ func (s *LedgerState) Finalize(height uint64, stateRootHash common.Hash) result.
 	if storeview == nil {
 		return result.Error(fmt.Sprintf("Failed to finalize ledger state with state root hash: %v", stateRootHash))
 	}
+	if s.snapshot != nil {
+		if err := s.snapshot.Cap(stateRootHash); err != nil {
+			logger.Warnf("Failed to flatten the flat snapshot: %v", err)
+		}
+		storeview.attachSnapshot(s.snapshot, stateRootHash)
+	}
 	s.finalized = storeview
 	return result.OK
 }
 
+// SetFlatSnapshot serves the account and storage reads of the views reset or finalized from
+// now on from the flat snapshot, and maintains it at each commit.
+func (s *LedgerState) SetFlatSnapshot(snapshot *FlatSnapshot) {
+	s.snapshot = snapshot
+}
+
 // GetChainID gets chain ID.
 func (s *LedgerState) GetChainID() string {
 	if s.chainID != "" {
@@ -136,6 +153,13 @@ func (s *LedgerState) Finalized() *StoreView {
 // returns the hash for the commit.
 func (s *LedgerState) Commit() common.Hash {
 	hash := s.delivered.Save()
+	if s.snapshot != nil && s.delivered.snapshot != nil {
+		if err := s.snapshot.Update(s.delivered.snapshotRoot, hash); err != nil {
+			logger.Debugf("Failed to update the flat snapshot: %v", err)
+		} else {
+			s.delivered.attachSnapshot(s.snapshot, hash)
+		}
+	}
 	s.delivered.IncrementHeight()
 	s.dbTagger.Tag(s.delivered.height, hash)
 
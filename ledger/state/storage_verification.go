@@ -0,0 +1,112 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// storageVerificationCheckpointKey is the DB key of the persisted verification checkpoint.
+var storageVerificationCheckpointKey = common.Bytes("vs/checkpoint")
+
+// StorageVerificationCheckpoint records the progress of an account storage verification, so
+// that the verification of a large state can be spread over multiple runs.
+type StorageVerificationCheckpoint struct {
+	StateHash   common.Hash  // root of the state being verified
+	LastAccount common.Bytes // key of the last verified account, empty if none yet
+	Verified    uint64       // number of accounts verified so far
+	Done        bool
+}
+
+// VerifyAccountStorages verifies the storage tries of at most maxAccounts accounts following
+// the checkpoint, or from the first account if the checkpoint is nil. A non-positive
+// maxAccounts verifies all the remaining accounts. Each storage trie is walked to confirm all
+// its nodes are present, and its root is recomputed from the leaves. It returns the updated
+// checkpoint to resume from.
+func (sv *StoreView) VerifyAccountStorages(checkpoint *StorageVerificationCheckpoint, maxAccounts int) (*StorageVerificationCheckpoint, error) {
+	stateHash := sv.Hash()
+	if checkpoint == nil {
+		checkpoint = &StorageVerificationCheckpoint{StateHash: stateHash}
+	} else if checkpoint.StateHash != stateHash {
+		return nil, fmt.Errorf("Checkpoint is for state %v, not %v", checkpoint.StateHash.Hex(), stateHash.Hex())
+	}
+	result := *checkpoint
+	if result.Done {
+		return &result, nil
+	}
+
+	accountPrefix := common.Bytes("ls/a")
+	start := accountPrefix
+	if len(result.LastAccount) > 0 {
+		start = result.LastAccount
+	}
+	db := sv.GetDB()
+	it := trie.NewIterator(sv.store.Trie.NodeIterator(start))
+	verified := 0
+	for {
+		if maxAccounts > 0 && verified >= maxAccounts {
+			return &result, nil
+		}
+		if !it.Next() || !bytes.HasPrefix(it.Key, accountPrefix) {
+			break
+		}
+		if bytes.Equal(it.Key, result.LastAccount) {
+			continue
+		}
+
+		account := &types.Account{}
+		if err := types.FromBytes(it.Value, account); err != nil {
+			return nil, fmt.Errorf("Failed to parse account %v: %v", common.Bytes2Hex(it.Key), err)
+		}
+		if account.Root != (common.Hash{}) {
+			storage, err := trie.New(account.Root, trie.NewDatabase(db))
+			if err == nil {
+				err = storage.Verify()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Invalid storage of account %v: %v", account.Address.Hex(), err)
+			}
+		}
+		result.LastAccount = common.CopyBytes(it.Key)
+		result.Verified++
+		verified++
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+
+	result.Done = true
+	return &result, nil
+}
+
+// SaveStorageVerificationCheckpoint persists the verification checkpoint in the database.
+func SaveStorageVerificationCheckpoint(db database.Database, checkpoint *StorageVerificationCheckpoint) error {
+	raw, err := rlp.EncodeToBytes(checkpoint)
+	if err != nil {
+		return err
+	}
+	return db.Put(storageVerificationCheckpointKey, raw)
+}
+
+// LoadStorageVerificationCheckpoint loads the persisted verification checkpoint, or returns
+// nil if there is none.
+func LoadStorageVerificationCheckpoint(db database.Database) (*StorageVerificationCheckpoint, error) {
+	raw, err := db.Get(storageVerificationCheckpointKey)
+	if err == store.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &StorageVerificationCheckpoint{}
+	if err := rlp.DecodeBytes(raw, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
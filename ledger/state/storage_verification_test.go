@@ -0,0 +1,48 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestVerifyAccountStoragesResume(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(10, common.Hash{}, db)
+	for i := 1; i <= 10; i++ {
+		storage := NewStoreView(10, common.Hash{}, db)
+		storage.Set(common.BigToHash(big.NewInt(int64(i))).Bytes(), common.Bytes("value"))
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		sv.SetAccount(addr, &types.Account{Address: addr, Balance: types.NewCoins(0, 0), Root: storage.Save()})
+	}
+	sv.Save()
+
+	// Verify half of the accounts, and persist the checkpoint.
+	checkpoint, err := sv.VerifyAccountStorages(nil, 5)
+	require.Nil(err)
+	assert.False(checkpoint.Done)
+	assert.Equal(uint64(5), checkpoint.Verified)
+	assert.Equal(AccountKey(common.BigToAddress(big.NewInt(5))), checkpoint.LastAccount)
+	require.Nil(SaveStorageVerificationCheckpoint(db, checkpoint))
+
+	// Resume from the persisted checkpoint to completion.
+	loaded, err := LoadStorageVerificationCheckpoint(db)
+	require.Nil(err)
+	assert.Equal(checkpoint, loaded)
+	checkpoint, err = sv.VerifyAccountStorages(loaded, 0)
+	require.Nil(err)
+	assert.True(checkpoint.Done)
+	assert.Equal(uint64(10), checkpoint.Verified)
+
+	// A checkpoint of another state is rejected.
+	_, err = sv.VerifyAccountStorages(&StorageVerificationCheckpoint{StateHash: common.HexToHash("0x1")}, 0)
+	assert.NotNil(err)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/thetatoken/theta/rlp"
 	"github.com/thetatoken/theta/store/database"
 	"github.com/thetatoken/theta/store/treestore"
+	"github.com/thetatoken/theta/store/trie"
 )
 
 var logger *log.Entry = log.WithFields(log.Fields{"prefix": "ledger"})
@@ -27,8 +28,13 @@ type StoreView struct {
 
 	coinbaseTransactinProcessed bool
 	slashIntents                []types.SlashIntent
-	refund                      uint64       // Gas refund during smart contract execution
-	logs                        []*types.Log // Temporary store of events during smart contract execution
+	refund                      uint64              // Gas refund during smart contract execution
+	logs                        []*types.Log        // Temporary store of events during smart contract execution
+	internalTxs                 []*types.InternalTx // Temporary store of value transfers by contracts during smart contract execution
+
+	snapshot     *FlatSnapshot               // nil if the flat snapshot is disabled
+	snapshotRoot common.Hash                 // state root of the flat snapshot reads
+	touched      map[common.Address]struct{} // accounts written since snapshotRoot, read from the trie
 }
 
 // NewStoreView creates an instance of the StoreView
@@ -58,10 +64,47 @@ func (sv *StoreView) Copy() (*StoreView, error) {
 		store:        copiedStore,
 		slashIntents: []types.SlashIntent{},
 		refund:       0,
+		snapshot:     sv.snapshot,
+		snapshotRoot: sv.snapshotRoot,
+	}
+	for addr := range sv.touched {
+		copiedStoreView.touch(AccountKey(addr))
 	}
 	return copiedStoreView, nil
 }
 
+// attachSnapshot serves the account and storage reads from the flat snapshot at the state
+// root, which needs to be the committed state of the view.
+func (sv *StoreView) attachSnapshot(snapshot *FlatSnapshot, root common.Hash) {
+	sv.snapshot = snapshot
+	sv.snapshotRoot = root
+	sv.touched = nil
+}
+
+// touch records the write of an account, so it is no longer read from the flat snapshot.
+func (sv *StoreView) touch(key common.Bytes) {
+	if sv.snapshot == nil {
+		return
+	}
+	addr, ok := AccountKeyAddress(key)
+	if !ok {
+		return
+	}
+	if sv.touched == nil {
+		sv.touched = make(map[common.Address]struct{})
+	}
+	sv.touched[addr] = struct{}{}
+}
+
+// fromSnapshot returns whether the account is read from the flat snapshot.
+func (sv *StoreView) fromSnapshot(addr common.Address) bool {
+	if sv.snapshot == nil {
+		return false
+	}
+	_, ok := sv.touched[addr]
+	return !ok
+}
+
 // GetDB returns the underlying database.
 func (sv *StoreView) GetDB() database.Database {
 	return sv.store.GetDB()
@@ -112,11 +155,13 @@ func (sv *StoreView) ProveVCP(vcpKey []byte, vp *core.VCPProof) error {
 
 // Delete removes the value corresponding to the key
 func (sv *StoreView) Delete(key common.Bytes) {
+	sv.touch(key)
 	sv.store.Delete(key)
 }
 
 // Set returns the value corresponding to the key
 func (sv *StoreView) Set(key common.Bytes, value common.Bytes) {
+	sv.touch(key)
 	sv.store.Set(key, value)
 }
 
@@ -147,7 +192,14 @@ func (sv *StoreView) SetCoinbaseTransactionProcessed(processed bool) {
 
 // GetAccount returns an account.
 func (sv *StoreView) GetAccount(addr common.Address) *types.Account {
-	data := sv.Get(AccountKey(addr))
+	load := func() common.Bytes { return sv.Get(AccountKey(addr)) }
+	data, ok := common.Bytes(nil), false
+	if sv.fromSnapshot(addr) {
+		data, ok = sv.snapshot.Account(sv.snapshotRoot, addr, load)
+	}
+	if !ok {
+		data = load()
+	}
 	if data == nil || len(data) == 0 {
 		return nil
 	}
@@ -370,6 +422,82 @@ func (sv *StoreView) UpdateStakeTransactionHeightList(hl *types.HeightList) {
 	sv.Set(StakeTransactionHeightListKey(), hlBytes)
 }
 
+// GetSlashingRules gets the slashing rules, or nil if the genesis sets none.
+func (sv *StoreView) GetSlashingRules() *core.SlashingRules {
+	data := sv.Get(SlashingRulesKey())
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+	rules := &core.SlashingRules{}
+	err := types.FromBytes(data, rules)
+	if err != nil {
+		log.Panicf("Error reading slashing rules %X, error: %v",
+			data, err.Error())
+	}
+	return rules
+}
+
+// UpdateSlashingRules updates the slashing rules.
+func (sv *StoreView) UpdateSlashingRules(rules *core.SlashingRules) {
+	rulesBytes, err := types.ToBytes(rules)
+	if err != nil {
+		log.Panicf("Error writing slashing rules %v, error: %v",
+			rules, err.Error())
+	}
+	sv.Set(SlashingRulesKey(), rulesBytes)
+}
+
+// GetProposerSelection gets the proposer selection strategy, or nil if the genesis sets none.
+func (sv *StoreView) GetProposerSelection() *core.ProposerSelection {
+	data := sv.Get(ProposerSelectionKey())
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+	selection := &core.ProposerSelection{}
+	err := types.FromBytes(data, selection)
+	if err != nil {
+		log.Panicf("Error reading proposer selection %X, error: %v",
+			data, err.Error())
+	}
+	return selection
+}
+
+// UpdateProposerSelection updates the proposer selection strategy.
+func (sv *StoreView) UpdateProposerSelection(selection *core.ProposerSelection) {
+	selectionBytes, err := types.ToBytes(selection)
+	if err != nil {
+		log.Panicf("Error writing proposer selection %v, error: %v",
+			selection, err.Error())
+	}
+	sv.Set(ProposerSelectionKey(), selectionBytes)
+}
+
+// GetValidatorSlashedHeight returns the height of the block that last slashed the validator,
+// and whether it was ever slashed.
+func (sv *StoreView) GetValidatorSlashedHeight(addr common.Address) (uint64, bool) {
+	data := sv.Get(SlashedValidatorKey(addr))
+	if data == nil || len(data) == 0 {
+		return 0, false
+	}
+	var height uint64
+	err := types.FromBytes(data, &height)
+	if err != nil {
+		log.Panicf("Error reading slashed height %X, error: %v",
+			data, err.Error())
+	}
+	return height, true
+}
+
+// SetValidatorSlashedHeight records the height of the block that slashed the validator.
+func (sv *StoreView) SetValidatorSlashedHeight(addr common.Address, height uint64) {
+	heightBytes, err := types.ToBytes(height)
+	if err != nil {
+		log.Panicf("Error writing slashed height of %v, error: %v",
+			addr.Hex(), err.Error())
+	}
+	sv.Set(SlashedValidatorKey(addr), heightBytes)
+}
+
 type StakeWithHolder struct {
 	Holder common.Address
 	Stake  core.Stake
@@ -431,6 +559,20 @@ func (sv *StoreView) PopLogs() []*types.Log {
 	return ret
 }
 
+func (sv *StoreView) ResetInternalTxs() {
+	sv.internalTxs = []*types.InternalTx{}
+}
+
+func (sv *StoreView) AddInternalTxs(internalTxs []*types.InternalTx) {
+	sv.internalTxs = append(sv.internalTxs, internalTxs...)
+}
+
+func (sv *StoreView) PopInternalTxs() []*types.InternalTx {
+	ret := sv.internalTxs
+	sv.ResetInternalTxs()
+	return ret
+}
+
 //
 // ---------- Implement vm.StateDB interface -----------
 //
@@ -633,9 +775,19 @@ func (sv *StoreView) GetState(addr common.Address, key common.Hash) common.Hash
 	}
 	logger.Debugf("StoreView.GetState, address: %v, account.root: %v, key: %v", addr, account.Root.Hex(), key.Hex())
 
-	enc, err := sv.getAccountStorage(account).TryGet(key[:])
-	if err != nil {
-		log.Panic(err)
+	load := func() common.Bytes {
+		enc, err := sv.getAccountStorage(account).TryGet(key[:])
+		if err != nil {
+			log.Panic(err)
+		}
+		return enc
+	}
+	enc, ok := common.Bytes(nil), false
+	if sv.fromSnapshot(addr) {
+		enc, ok = sv.snapshot.Storage(sv.snapshotRoot, addr, key, load)
+	}
+	if !ok {
+		enc = load()
 	}
 	if len(enc) > 0 {
 		_, content, _, err := rlp.Split(enc)
@@ -647,6 +799,41 @@ func (sv *StoreView) GetState(addr common.Address, key common.Hash) common.Hash
 	return common.Hash{}
 }
 
+// IterateAccountStorage calls fn on the storage slots of the account with the key prefix, in
+// key order, until fn returns false.
+func (sv *StoreView) IterateAccountStorage(addr common.Address, prefix common.Bytes, fn func(key, value common.Hash) bool) error {
+	return sv.IterateAccountStorageFrom(addr, prefix, prefix, fn)
+}
+
+// IterateAccountStorageFrom is IterateAccountStorage starting from the slot key start.
+func (sv *StoreView) IterateAccountStorageFrom(addr common.Address, prefix, start common.Bytes, fn func(key, value common.Hash) bool) error {
+	account := sv.GetAccount(addr)
+	if account == nil {
+		return nil
+	}
+	storage := sv.getAccountStorage(account)
+	if storage == nil {
+		return fmt.Errorf("Storage of account %v is not available, it might have been pruned", addr.Hex())
+	}
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	it := trie.NewIterator(storage.NodeIterator(start))
+	for it.Next() {
+		if !bytes.HasPrefix(it.Key, prefix) {
+			break
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return fmt.Errorf("Failed to parse storage slot %v of account %v: %v", common.Bytes2Hex(it.Key), addr.Hex(), err)
+		}
+		if !fn(common.BytesToHash(it.Key), common.BytesToHash(content)) {
+			return nil
+		}
+	}
+	return it.Err
+}
+
 func (sv *StoreView) SetState(addr common.Address, key, val common.Hash) {
 	account := sv.GetAccount(addr)
 	if account == nil {
@@ -443,3 +443,39 @@ func compareHeightList(hl1, hl2 *types.HeightList) bool {
 
 	return true
 }
+
+func TestIterateAccountStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := common.HexToAddress("0x1")
+	sv := NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	sv.SetState(addr, common.HexToHash("0x0101"), common.HexToHash("0xa1"))
+	sv.SetState(addr, common.HexToHash("0x0102"), common.HexToHash("0xa2"))
+	sv.SetState(addr, common.HexToHash("0x0201"), common.HexToHash("0xa3"))
+	sv.Save()
+
+	collect := func(prefix, start common.Bytes, max int) []common.Hash {
+		values := []common.Hash{}
+		err := sv.IterateAccountStorageFrom(addr, prefix, start, func(key, value common.Hash) bool {
+			values = append(values, value)
+			return len(values) < max
+		})
+		assert.Nil(err)
+		return values
+	}
+
+	assert.Equal([]common.Hash{common.HexToHash("0xa1"), common.HexToHash("0xa2"), common.HexToHash("0xa3")}, collect(nil, nil, 10))
+	assert.Equal([]common.Hash{common.HexToHash("0xa1")}, collect(nil, nil, 1))
+
+	prefix := common.HexToHash("0x0100")
+	assert.Equal([]common.Hash{common.HexToHash("0xa1"), common.HexToHash("0xa2")}, collect(prefix[:31], nil, 10))
+	start := common.HexToHash("0x0102")
+	assert.Equal([]common.Hash{common.HexToHash("0xa2")}, collect(prefix[:31], start[:], 10))
+
+	count := 0
+	assert.Nil(sv.IterateAccountStorage(common.HexToAddress("0x2"), nil, func(key, value common.Hash) bool {
+		count++
+		return true
+	}))
+	assert.Equal(0, count)
+}
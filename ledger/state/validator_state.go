@@ -0,0 +1,34 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// ValidatorStateSource retrieves the validator candidate pool from the states in the database.
+type ValidatorStateSource struct {
+	db database.Database
+}
+
+// NewValidatorStateSource creates a new instance of ValidatorStateSource.
+func NewValidatorStateSource(db database.Database) *ValidatorStateSource {
+	return &ValidatorStateSource{
+		db: db,
+	}
+}
+
+// GetValidatorCandidatePool returns the validator candidate pool of the state with the given root.
+func (vss *ValidatorStateSource) GetValidatorCandidatePool(height uint64, stateHash common.Hash) (*core.ValidatorCandidatePool, error) {
+	sv := NewStoreView(height, stateHash, vss.db)
+	if sv == nil {
+		return nil, fmt.Errorf("Failed to load the state at height %v", height)
+	}
+	vcp := sv.GetValidatorCandidatePool()
+	if vcp == nil {
+		return nil, fmt.Errorf("Failed to retrieve the validator candidate pool at height %v", height)
+	}
+	return vcp, nil
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"github.com/thetatoken/theta/common"
+)
+
+// InternalTxType is the EVM operation moving the value of an internal transaction.
+type InternalTxType byte
+
+const (
+	// InternalTxTypeCall is a call with value from a contract.
+	InternalTxTypeCall InternalTxType = iota
+	// InternalTxTypeCreate is a contract creation with value from a contract.
+	InternalTxTypeCreate
+	// InternalTxTypeSelfDestruct is the balance of a self-destructed contract sent to the
+	// beneficiary.
+	InternalTxTypeSelfDestruct
+	// InternalTxTypeThetaTransfer is a transfer through the Theta transfer precompiled contract.
+	InternalTxTypeThetaTransfer
+)
+
+// InternalTx is a value transfer performed by a smart contract during the EVM execution of a
+// transaction, which the transaction itself doesn't show.
+type InternalTx struct {
+	Type  InternalTxType `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Coins Coins          `json:"coins"`
+	Depth uint64         `json:"depth"` // the call depth of the contract making the transfer
+}
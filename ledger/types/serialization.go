@@ -37,6 +37,8 @@ const (
 	TxWithdrawStake
 	TxDepositStakeV2
 	TxStakeRewardDistribution
+	TxEvidence
+	TxRotateValidatorKey
 )
 
 func Fuzz(data []byte) int {
@@ -114,6 +116,14 @@ func TxFromBytes(raw []byte) (Tx, error) {
 		data := &StakeRewardDistributionTx{}
 		err = s.Decode(data)
 		return data, err
+	} else if txType == TxEvidence {
+		data := &EvidenceTx{}
+		err = s.Decode(data)
+		return data, err
+	} else if txType == TxRotateValidatorKey {
+		data := &RotateValidatorKeyTx{}
+		err = s.Decode(data)
+		return data, err
 	} else {
 		return nil, fmt.Errorf("Unknown TX type: %v", txType)
 	}
@@ -147,6 +157,10 @@ func TxToBytes(t Tx) ([]byte, error) {
 		txType = TxDepositStakeV2
 	case *StakeRewardDistributionTx:
 		txType = TxStakeRewardDistribution
+	case *EvidenceTx:
+		txType = TxEvidence
+	case *RotateValidatorKeyTx:
+		txType = TxRotateValidatorKey
 	default:
 		return nil, errors.New("Unsupported message type")
 	}
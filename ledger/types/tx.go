@@ -35,6 +35,8 @@ Transaction Types:
  - WithdrawStakeTx         Withdraw stake from a target address (e.g. a validator)
  - SmartContractTx         Execute smart contract
  - StakeRewardDistribution Defines how stake reward is distributed
+ - EvidenceTx              Slash the stake of a validator proven to double-sign
+ - RotateValidatorKeyTx    Rotate the consensus signing key of a validator
 */
 
 // Gas of regular transactions
@@ -1018,6 +1020,94 @@ func (tx *StakeRewardDistributionTx) String() string {
 		tx.Holder.Address, tx.Beneficiary.Address, tx.SplitBasisPoint)
 }
 
+//-----------------------------------------------------------------------------
+
+//
+// EvidenceTx is added by the block proposer to include the evidence of a validator that signed
+// two conflicting consensus messages. Executing it slashes the stake of the offender following
+// the slashing rules set in the genesis.
+//
+type EvidenceTx struct {
+	Proposer TxInput
+	Evidence *core.Evidence
+}
+
+func (_ *EvidenceTx) AssertIsTx() {}
+
+func (tx *EvidenceTx) SignBytes(chainID string) []byte {
+	signBytes := encodeToBytes(chainID)
+	sig := tx.Proposer.Signature
+	tx.Proposer.Signature = nil
+	txBytes, _ := TxToBytes(tx)
+	signBytes = append(signBytes, txBytes...)
+	signBytes = addPrefixForSignBytes(signBytes)
+
+	tx.Proposer.Signature = sig
+	return signBytes
+}
+
+func (tx *EvidenceTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Proposer.Address == addr {
+		tx.Proposer.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *EvidenceTx) String() string {
+	return fmt.Sprintf("EvidenceTx{proposer: %v, evidence: %v}", tx.Proposer.Address, tx.Evidence)
+}
+
+//-----------------------------------------------------------------------------
+
+//
+// RotateValidatorKeyTx needs to be signed by both the validator stake holder and the new signer. Starting
+// from EffectiveHeight, the validator proposes and votes with the key of the signer instead of the key it
+// used so far, which allows the operator to replace a possibly exposed key without withdrawing the stake.
+// Rotating the key back to the holder address restores the holder key.
+//
+type RotateValidatorKeyTx struct {
+	Fee             Coins   `json:"fee"`              // transaction fee
+	Holder          TxInput `json:"holder"`           // validator stake holder account
+	Signer          TxInput `json:"signer"`           // account of the new signing key, only its address and signature are used
+	EffectiveHeight uint64  `json:"effective_height"` // height of the first block signed with the new key
+}
+
+func (_ *RotateValidatorKeyTx) AssertIsTx() {}
+
+func (tx *RotateValidatorKeyTx) SignBytes(chainID string) []byte {
+	signBytes := encodeToBytes(chainID)
+	holderSig := tx.Holder.Signature
+	signerSig := tx.Signer.Signature
+	tx.Holder.Signature = nil
+	tx.Signer.Signature = nil
+	txBytes, _ := TxToBytes(tx)
+	signBytes = append(signBytes, txBytes...)
+	signBytes = addPrefixForSignBytes(signBytes)
+
+	tx.Holder.Signature = holderSig
+	tx.Signer.Signature = signerSig
+	return signBytes
+}
+
+func (tx *RotateValidatorKeyTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	set := false
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		set = true
+	}
+	if tx.Signer.Address == addr {
+		tx.Signer.Signature = sig
+		set = true
+	}
+	return set
+}
+
+func (tx *RotateValidatorKeyTx) String() string {
+	return fmt.Sprintf("RotateValidatorKeyTx{holder: %v, signer: %v, effective_height: %v}",
+		tx.Holder.Address, tx.Signer.Address, tx.EffectiveHeight)
+}
+
 // --------------- Utils --------------- //
 
 type EthereumTxWrapper struct {
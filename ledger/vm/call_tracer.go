@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+)
+
+// CallFrame is a call or a contract creation in the call tree of a transaction.
+type CallFrame struct {
+	Type    string            `json:"type"`
+	From    common.Address    `json:"from"`
+	To      common.Address    `json:"to"`
+	Value   *common.JSONBig   `json:"value,omitempty"`
+	Gas     common.JSONUint64 `json:"gas"`
+	GasUsed common.JSONUint64 `json:"gas_used"`
+	Input   hexutil.Bytes     `json:"input"`
+	Output  hexutil.Bytes     `json:"output"`
+	Error   string            `json:"error,omitempty"`
+	Calls   []*CallFrame      `json:"calls,omitempty"`
+}
+
+// CallTracer is a Tracer building the tree of the calls and the contract creations made
+// during the execution of a transaction.
+type CallTracer struct {
+	root  *CallFrame
+	stack []*CallFrame // the calls in progress, the innermost last
+}
+
+var _ Tracer = (*CallTracer)(nil)
+
+// NewCallTracer returns a new call tracer
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// CaptureStart implements the Tracer interface, it starts the tree with the transaction call.
+func (t *CallTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	t.root = newCallFrame(typ, from, to, input, gas, value)
+	t.stack = []*CallFrame{t.root}
+	return nil
+}
+
+// CaptureState implements the Tracer interface.
+func (t *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface, it completes the transaction call.
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) error {
+	if t.root != nil {
+		t.root.finish(output, gasUsed, err)
+	}
+	t.stack = nil
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface, it adds the call to the calls of the caller.
+func (t *CallTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if len(t.stack) == 0 {
+		return nil
+	}
+	frame := newCallFrame(typ, from, to, input, gas, value)
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	t.stack = append(t.stack, frame)
+	return nil
+}
+
+// CaptureExit implements the Tracer interface, it completes the innermost call in progress.
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(t.stack) <= 1 {
+		return nil
+	}
+	t.stack[len(t.stack)-1].finish(output, gasUsed, err)
+	t.stack = t.stack[:len(t.stack)-1]
+	return nil
+}
+
+// CallFrame returns the call tree, or nil if the transaction did not reach the EVM.
+func (t *CallTracer) CallFrame() *CallFrame {
+	return t.root
+}
+
+func newCallFrame(typ OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int) *CallFrame {
+	frame := &CallFrame{
+		Type:  typ.String(),
+		From:  from,
+		To:    to,
+		Gas:   common.JSONUint64(gas),
+		Input: common.CopyBytes(input),
+	}
+	if value != nil {
+		frame.Value = (*common.JSONBig)(new(big.Int).Set(value))
+	}
+	return frame
+}
+
+func (frame *CallFrame) finish(output []byte, gasUsed uint64, err error) {
+	frame.GasUsed = common.JSONUint64(gasUsed)
+	frame.Output = common.CopyBytes(output)
+	if err != nil {
+		frame.Error = err.Error()
+	}
+}
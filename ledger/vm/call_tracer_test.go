@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestCallTracer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sender := common.HexToAddress("0x1")
+	contract1 := common.HexToAddress("0x2")
+	contract2 := common.HexToAddress("0x3")
+	contract3 := common.HexToAddress("0x4")
+
+	tracer := NewCallTracer()
+	assert.Nil(tracer.CallFrame())
+
+	tracer.CaptureStart(sender, contract1, false, []byte{0x1}, 1000, big.NewInt(5))
+	tracer.CaptureEnter(CALL, contract1, contract2, []byte{0x2}, 500, big.NewInt(0))
+	tracer.CaptureEnter(DELEGATECALL, contract2, contract3, []byte{0x3}, 200, nil)
+	tracer.CaptureExit([]byte{0x33}, 50, nil)
+	tracer.CaptureExit(nil, 500, ErrOutOfGas)
+	tracer.CaptureEnter(STATICCALL, contract1, contract3, nil, 300, new(big.Int))
+	tracer.CaptureExit([]byte{0x44}, 30, nil)
+	tracer.CaptureEnd([]byte{0x11}, 900, 0, errExecutionReverted)
+
+	root := tracer.CallFrame()
+	require.NotNil(root)
+	assert.Equal("CALL", root.Type)
+	assert.Equal(sender, root.From)
+	assert.Equal(contract1, root.To)
+	assert.Equal(common.JSONUint64(900), root.GasUsed)
+	assert.Equal([]byte{0x11}, []byte(root.Output))
+	assert.Equal(errExecutionReverted.Error(), root.Error)
+	require.Equal(2, len(root.Calls))
+
+	call := root.Calls[0]
+	assert.Equal("CALL", call.Type)
+	assert.Equal(contract2, call.To)
+	assert.Equal(ErrOutOfGas.Error(), call.Error)
+	require.Equal(1, len(call.Calls))
+	assert.Equal("DELEGATECALL", call.Calls[0].Type)
+	assert.Nil(call.Calls[0].Value)
+	assert.Equal(common.JSONUint64(50), call.Calls[0].GasUsed)
+	assert.Equal("", call.Calls[0].Error)
+
+	assert.Equal("STATICCALL", root.Calls[1].Type)
+	assert.Equal([]byte{0x44}, []byte(root.Calls[1].Output))
+	assert.Equal(0, len(root.Calls[1].Calls))
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/thetatoken/theta/common/math"
 	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/crypto/bn256"
+	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/ledger/vm/params"
 	"golang.org/x/crypto/ripemd160"
 )
@@ -442,6 +443,7 @@ func (c *transferTheta) Run(evm *EVM, input []byte, callerAddr common.Address) (
 
 	// send Theta from the contract to the specified recipient
 	TransferTheta(evm.StateDB, callerAddr, recipient, thetaWeiAmount)
+	evm.recordInternalTx(types.InternalTxTypeThetaTransfer, callerAddr, recipient, nil, thetaWeiAmount)
 
 	return common.Bytes{}, nil
 }
@@ -13,6 +13,13 @@ import (
 
 // Execute executes the given smart contract
 func Execute(parentBlock *core.Block, tx *types.SmartContractTx, storeView *state.StoreView) (evmRet common.Bytes,
+	contractAddr common.Address, gasUsed uint64, evmErr error) {
+	return ExecuteWithTracer(parentBlock, tx, storeView, nil)
+}
+
+// ExecuteWithTracer executes the given smart contract, and reports the execution to the tracer
+// unless it is nil
+func ExecuteWithTracer(parentBlock *core.Block, tx *types.SmartContractTx, storeView *state.StoreView, tracer Tracer) (evmRet common.Bytes,
 	contractAddr common.Address, gasUsed uint64, evmErr error) {
 	context := Context{
 		CanTransfer: CanTransfer,
@@ -29,6 +36,10 @@ func Execute(parentBlock *core.Block, tx *types.SmartContractTx, storeView *stat
 		ChainID: chainIDBigInt,
 	}
 	config := Config{}
+	if tracer != nil {
+		config.Debug = true
+		config.Tracer = tracer
+	}
 	evm := NewEVM(context, storeView, chainConfig, config)
 
 	value := tx.From.Coins.TFuelWei
@@ -73,6 +84,10 @@ func Execute(parentBlock *core.Block, tx *types.SmartContractTx, storeView *stat
 		evmRet, leftOverGas, evmErr = evm.Call(AccountRef(fromAddr), contractAddr, input, remainingGas, value, thetaValue)
 	}
 
+	if evmErr == nil {
+		storeView.AddInternalTxs(evm.InternalTxs())
+	}
+
 	if leftOverGas > gasLimit { // should not happen
 		gasUsed = uint64(0)
 	} else {
@@ -82,6 +97,51 @@ func Execute(parentBlock *core.Block, tx *types.SmartContractTx, storeView *stat
 	return evmRet, contractAddr, gasUsed, evmErr
 }
 
+// EstimateGas returns the lowest gas limit the smart contract transaction executes with without
+// an error, up to the gas limit of the transaction, or the max gas limit if not set. The executions
+// run on copies of the storeView, which is left untouched. If the transaction fails with the
+// highest gas limit, the error of the execution is returned.
+func EstimateGas(parentBlock *core.Block, tx *types.SmartContractTx, storeView *state.StoreView) (gasLimit uint64,
+	evmRet common.Bytes, evmErr error) {
+	execute := func(gasLimit uint64) (common.Bytes, uint64, error) {
+		view, err := storeView.Copy()
+		if err != nil {
+			return nil, 0, err
+		}
+		probeTx := *tx
+		probeTx.GasLimit = gasLimit
+		ret, _, gasUsed, err := Execute(parentBlock, &probeTx, view)
+		return ret, gasUsed, err
+	}
+
+	hi := tx.GasLimit
+	if hi == 0 {
+		hi = types.GetMaxGasLimit(storeView.Height() + 1).Uint64()
+	}
+	evmRet, gasUsed, evmErr := execute(hi)
+	if evmErr != nil {
+		return 0, evmRet, evmErr
+	}
+
+	// The execution needs at least the gas it used, but might need more, e.g. as a call only
+	// passes on 63/64 of the remaining gas. The gas used is 0 if the execution reported more
+	// left over gas than its limit.
+	lo := uint64(0)
+	if gasUsed > 0 {
+		lo = gasUsed - 1
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		ret, _, err := execute(mid)
+		if err != nil {
+			lo = mid
+		} else {
+			hi, evmRet = mid, ret
+		}
+	}
+	return hi, evmRet, nil
+}
+
 // calculateIntrinsicGas computes the 'intrinsic gas' for a message with the given data.
 func calculateIntrinsicGas(data []byte, createContract bool) (uint64, error) {
 	// Set the starting gas for the raw transaction
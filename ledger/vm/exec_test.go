@@ -13,6 +13,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/store/database/backend"
@@ -341,6 +342,58 @@ func TestVMExecutionDeployERC20TokenContract(t *testing.T) {
 	log.Infof("Call   Contract -- symbol: %v", symbol)
 }
 
+func TestVMEstimateGas(t *testing.T) {
+	assert := assert.New(t)
+
+	storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 2)
+	parentBlock := &core.Block{BlockHeader: &core.BlockHeader{ChainID: "privatenet", Height: storeView.Height()}}
+
+	var cbc contractByteCode
+	err := loadJSONTest("testdata/square_calculator.json", &cbc)
+	assert.Nil(err)
+	deploymentCode, err := hex.DecodeString(cbc.DeploymentCode)
+	assert.Nil(err)
+
+	deploySCTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: privAccounts[0].Account.Address, Coins: types.NewCoins(0, 0)},
+		GasLimit: 200000,
+		GasPrice: big.NewInt(50),
+		Data:     deploymentCode,
+	}
+	_, contractAddr, _, vmErr := Execute(parentBlock, deploySCTx, storeView)
+	assert.Nil(vmErr)
+	rootHash := storeView.Save()
+
+	setValueCallData, _ := hex.DecodeString("ed8b07060000000000000000000000000000000000000000000000000000000000004797")
+	callSCTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: privAccounts[1].Account.Address, Coins: types.NewCoins(0, 0)},
+		To:       types.TxOutput{Address: contractAddr},
+		GasPrice: big.NewInt(50),
+		Data:     setValueCallData,
+	}
+	gasLimit, _, vmErr := EstimateGas(parentBlock, callSCTx, storeView)
+	assert.Nil(vmErr)
+	assert.True(gasLimit > 0)
+	assert.Equal(rootHash, storeView.Hash()) // the estimation leaves the view untouched
+
+	// The estimate is the lowest gas limit the call succeeds with
+	execute := func(gasLimit uint64) error {
+		view, err := storeView.Copy()
+		assert.Nil(err)
+		tx := *callSCTx
+		tx.GasLimit = gasLimit
+		_, _, _, vmErr := Execute(parentBlock, &tx, view)
+		return vmErr
+	}
+	assert.Nil(execute(gasLimit))
+	assert.NotNil(execute(gasLimit - 1))
+
+	callSCTx.GasLimit = gasLimit - 1
+	_, _, vmErr = EstimateGas(parentBlock, callSCTx, storeView)
+	assert.NotNil(vmErr)
+}
+
 // ----------- Utilities ----------- //
 
 func prepareInitState(storeView *state.StoreView, numAccounts int) (privAccounts []types.PrivAccount) {
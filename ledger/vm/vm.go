@@ -157,6 +157,9 @@ type EVM struct {
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// internalTxs holds the value transfers made by the contracts in the calls which haven't
+	// failed so far.
+	internalTxs []*types.InternalTx
 }
 
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
@@ -199,6 +202,9 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		return nil, gas, nil
 	}
 
+	traceEnd := evm.traceCall(CALL, caller.Address(), addr, input, gas, value)
+	defer func() { traceEnd(ret, leftOverGas, err) }()
+
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
@@ -216,18 +222,15 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	}
 
 	var (
-		to       = AccountRef(addr)
-		snapshot = evm.StateDB.Snapshot()
+		to             = AccountRef(addr)
+		snapshot       = evm.StateDB.Snapshot()
+		numInternalTxs = len(evm.internalTxs)
 	)
 	if !evm.StateDB.Exist(addr) {
 
 		precompiles := getPrecompiledContracts(blockHeight)
 		if precompiles[addr] == nil && value.Sign() == 0 {
-			// Calling a non existing account, don't do anything, but ping the tracer
-			if evm.vmConfig.Debug && evm.depth == 0 {
-				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
-				evm.vmConfig.Tracer.CaptureEnd(ret, 0, 0, nil)
-			}
+			// Calling a non existing account, don't do anything
 			return nil, gas, nil
 		}
 
@@ -241,6 +244,11 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 
 	if SupportThetaTransferInEVM(blockHeight) {
 		TransferTheta(evm.StateDB, caller.Address(), to.Address(), thetaValue)
+	} else {
+		thetaValue = nil
+	}
+	if evm.depth > 0 {
+		evm.recordInternalTx(types.InternalTxTypeCall, caller.Address(), to.Address(), value, thetaValue)
 	}
 
 	// Initialise a new contract and set the code that is to be used by the EVM.
@@ -255,6 +263,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	// when we're in homestead this also counts for code storage gas errors.
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.revertInternalTxs(numInternalTxs)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
@@ -273,6 +282,8 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	traceEnd := evm.traceCall(CALLCODE, caller.Address(), addr, input, gas, value)
+	defer func() { traceEnd(ret, leftOverGas, err) }()
 
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
@@ -284,8 +295,9 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	}
 
 	var (
-		snapshot = evm.StateDB.Snapshot()
-		to       = AccountRef(caller.Address())
+		snapshot       = evm.StateDB.Snapshot()
+		to             = AccountRef(caller.Address())
+		numInternalTxs = len(evm.internalTxs)
 	)
 	// initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
@@ -296,6 +308,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.revertInternalTxs(numInternalTxs)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
@@ -312,14 +325,17 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	traceEnd := evm.traceCall(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+	defer func() { traceEnd(ret, leftOverGas, err) }()
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 
 	var (
-		snapshot = evm.StateDB.Snapshot()
-		to       = AccountRef(caller.Address())
+		snapshot       = evm.StateDB.Snapshot()
+		to             = AccountRef(caller.Address())
+		numInternalTxs = len(evm.internalTxs)
 	)
 
 	// Initialise a new contract and make initialise the delegate values
@@ -329,6 +345,7 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.revertInternalTxs(numInternalTxs)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
@@ -344,14 +361,17 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	traceEnd := evm.traceCall(STATICCALL, caller.Address(), addr, input, gas, nil)
+	defer func() { traceEnd(ret, leftOverGas, err) }()
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
 
 	var (
-		to       = AccountRef(addr)
-		snapshot = evm.StateDB.Snapshot()
+		to             = AccountRef(addr)
+		snapshot       = evm.StateDB.Snapshot()
+		numInternalTxs = len(evm.internalTxs)
 	)
 	// Initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
@@ -365,6 +385,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	ret, err = run(evm, contract, input, true)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.revertInternalTxs(numInternalTxs)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
@@ -385,7 +406,7 @@ func (c *codeAndHash) Hash() common.Hash {
 }
 
 // create creates a new contract using code as deployment code.
-func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, thetaValue *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
+func (evm *EVM) create(typ OpCode, caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, thetaValue *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(params.CallCreateDepth) {
@@ -409,6 +430,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	// Create a new account on the state
 	snapshot := evm.StateDB.Snapshot()
+	numInternalTxs := len(evm.internalTxs)
 
 	if !SupportThetaTransferInEVM(blockHeight) { // just for backward compatibility
 		evm.StateDB.CreateAccount(address)
@@ -419,6 +441,11 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 
 	if SupportThetaTransferInEVM(blockHeight) {
 		TransferTheta(evm.StateDB, caller.Address(), address, thetaValue)
+	} else {
+		thetaValue = nil
+	}
+	if evm.depth > 0 {
+		evm.recordInternalTx(types.InternalTxTypeCreate, caller.Address(), address, value, thetaValue)
 	}
 
 	// initialise a new contract and set the code that is to be used by the
@@ -431,10 +458,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		return nil, address, gas, nil
 	}
 
-	if evm.vmConfig.Debug && evm.depth == 0 {
-		evm.vmConfig.Tracer.CaptureStart(caller.Address(), address, true, codeAndHash.code, gas, value)
-	}
-	start := time.Now()
+	traceEnd := evm.traceCall(typ, caller.Address(), address, codeAndHash.code, gas, value)
 
 	ret, err := run(evm, contract, nil, false)
 
@@ -458,6 +482,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	// when we're in homestead this also counts for code storage gas errors.
 	if maxCodeSizeExceeded || err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.revertInternalTxs(numInternalTxs)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
@@ -466,9 +491,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if maxCodeSizeExceeded && err == nil {
 		err = errMaxCodeSizeExceeded
 	}
-	if evm.vmConfig.Debug && evm.depth == 0 {
-		evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
-	}
+	traceEnd(ret, contract.Gas, err)
 	return ret, address, contract.Gas, err
 
 }
@@ -476,7 +499,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 // Create creates a new contract using code as deployment code.
 func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.Int, thetaValue *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
-	return evm.create(caller, &codeAndHash{code: code}, gas, value, thetaValue, contractAddr)
+	return evm.create(CREATE, caller, &codeAndHash{code: code}, gas, value, thetaValue, contractAddr)
 }
 
 // Create2 creates a new contract using code as deployment code.
@@ -486,7 +509,60 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int, thetaEndowment *big.Int, salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	codeAndHash := &codeAndHash{code: code}
 	contractAddr = crypto.CreateAddress2(caller.Address(), common.BigToHash(salt), codeAndHash.Hash().Bytes())
-	return evm.create(caller, codeAndHash, gas, endowment, thetaEndowment, contractAddr)
+	return evm.create(CREATE2, caller, codeAndHash, gas, endowment, thetaEndowment, contractAddr)
+}
+
+// traceCall reports the start of a call or a contract creation to the tracer, and returns the
+// function reporting its end. The transaction itself is reported by CaptureStart and CaptureEnd,
+// the calls made by the contracts by CaptureEnter and CaptureExit.
+func (evm *EVM) traceCall(typ OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int) func(output []byte, leftOverGas uint64, err error) {
+	if !evm.vmConfig.Debug {
+		return func(output []byte, leftOverGas uint64, err error) {}
+	}
+	tracer := evm.vmConfig.Tracer
+	if evm.depth == 0 {
+		tracer.CaptureStart(from, to, typ == CREATE || typ == CREATE2, input, gas, value)
+		start := time.Now()
+		return func(output []byte, leftOverGas uint64, err error) {
+			tracer.CaptureEnd(output, gas-leftOverGas, time.Since(start), err)
+		}
+	}
+	tracer.CaptureEnter(typ, from, to, input, gas, value)
+	return func(output []byte, leftOverGas uint64, err error) {
+		tracer.CaptureExit(output, gas-leftOverGas, err)
+	}
+}
+
+// recordInternalTx records a value transfer made by a contract, unless no value is moved. The
+// amounts are copied, as the EVM reuses the big integers.
+func (evm *EVM) recordInternalTx(txType types.InternalTxType, from, to common.Address, value, thetaValue *big.Int) {
+	coins := types.NewCoins(0, 0)
+	if value != nil {
+		coins.TFuelWei.Set(value)
+	}
+	if thetaValue != nil {
+		coins.ThetaWei.Set(thetaValue)
+	}
+	if coins.IsZero() {
+		return
+	}
+	evm.internalTxs = append(evm.internalTxs, &types.InternalTx{
+		Type:  txType,
+		From:  from,
+		To:    to,
+		Coins: coins,
+		Depth: uint64(evm.depth),
+	})
+}
+
+// revertInternalTxs drops the internal transactions recorded by a failed call.
+func (evm *EVM) revertInternalTxs(numInternalTxs int) {
+	evm.internalTxs = evm.internalTxs[:numInternalTxs]
+}
+
+// InternalTxs returns the value transfers made by the contracts in the successful calls.
+func (evm *EVM) InternalTxs() []*types.InternalTx {
+	return evm.internalTxs
 }
 
 // ChainConfig returns the environment's chain configuration
@@ -31,6 +31,10 @@ func encodeMessage(message interface{}) (common.Bytes, error) {
 		msgID = common.MessageIDDataRequest
 	case dispatcher.DataResponse:
 		msgID = common.MessageIDDataResponse
+	case dispatcher.SnapshotRequest:
+		msgID = common.MessageIDSnapshotRequest
+	case dispatcher.SnapshotResponse:
+		msgID = common.MessageIDSnapshotResponse
 	default:
 		return nil, errors.New("Unsupported message type")
 	}
@@ -70,6 +74,14 @@ func decodeMessage(raw common.Bytes) (interface{}, error) {
 		data := dispatcher.DataResponse{}
 		err = rlp.DecodeBytes(raw[1:], &data)
 		return data, err
+	} else if msgID == common.MessageIDSnapshotRequest {
+		data := dispatcher.SnapshotRequest{}
+		err = rlp.DecodeBytes(raw[1:], &data)
+		return data, err
+	} else if msgID == common.MessageIDSnapshotResponse {
+		data := dispatcher.SnapshotResponse{}
+		err = rlp.DecodeBytes(raw[1:], &data)
+		return data, err
 	} else {
 		return nil, fmt.Errorf("Unknown message ID: %v", msgID)
 	}
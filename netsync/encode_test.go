@@ -26,3 +26,21 @@ func TestMessageEncoding(t *testing.T) {
 	assert.Equal(1, len(dataReq2.Entries))
 	assert.Equal("A0", dataReq2.Entries[0])
 }
+
+func TestSnapshotMessageEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	req := dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestChunk, Root: common.HexToHash("a1"), ChunkIndex: 3}
+	b, err := encodeMessage(req)
+	assert.Nil(err)
+	raw, err := decodeMessage(b)
+	assert.Nil(err)
+	assert.Equal(req, raw.(dispatcher.SnapshotRequest))
+
+	resp := dispatcher.SnapshotResponse{Type: dispatcher.SnapshotRequestChunk, Root: common.HexToHash("a1"), ChunkIndex: 3, Payload: common.Bytes("chunk")}
+	b, err = encodeMessage(resp)
+	assert.Nil(err)
+	raw, err = decodeMessage(b)
+	assert.Nil(err)
+	assert.Equal(resp, raw.(dispatcher.SnapshotResponse))
+}
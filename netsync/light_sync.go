@@ -0,0 +1,231 @@
+package netsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+const (
+	lightSyncInterval   = 60 * time.Second
+	lightSyncMaxHeaders = 100 // max number of headers per response
+)
+
+// lightHeader is a finalized block header along with the votes endorsing it.
+type lightHeader struct {
+	Header  *core.BlockHeader
+	VoteSet *core.VoteSet
+}
+
+// LightSyncStatus is the status of the header-only light sync.
+type LightSyncStatus struct {
+	LatestHeader *core.BlockHeader
+	ValidatorSet *core.ValidatorSet
+}
+
+// IsLightSyncing returns whether the node only syncs the block headers and the validator set
+// transitions, in which case the block sync is disabled.
+func (sm *SyncManager) IsLightSyncing() bool {
+	return sm.lightVerifier != nil
+}
+
+// SetLightSync enables the header-only light sync. Instead of the blocks, the node periodically
+// fetches the snapshot metadata from the peers, i.e. the validator set change proofs and the
+// finalized checkpoint, and then the finalized headers above the latest verified header, and
+// verifies them with the light verifier.
+func (sm *SyncManager) SetLightSync(verifier *snapshot.LightVerifier) {
+	sm.lightVerifier = verifier
+}
+
+// GetLightSyncStatus returns the latest verified header and the proven validator set.
+func (sm *SyncManager) GetLightSyncStatus() (*LightSyncStatus, error) {
+	if sm.lightVerifier == nil {
+		return nil, fmt.Errorf("Light sync is not enabled")
+	}
+	return &LightSyncStatus{
+		LatestHeader: sm.lightVerifier.LatestHeader(),
+		ValidatorSet: sm.lightVerifier.ValidatorSet(),
+	}, nil
+}
+
+// fetchMetadata requests the snapshot metadata from the peers, and passes the decoded metadata
+// to the callback until the wait is over.
+func (sf *snapshotFetcher) fetchMetadata(ctx context.Context, onMetadata func(peerID string, metadata *core.SnapshotMetadata)) error {
+	sf.send(nil, dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestMetadata})
+
+	timer := time.NewTimer(snapshotManifestWait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case pr := <-sf.responses:
+			if pr.resp.Type != dispatcher.SnapshotRequestMetadata || len(pr.resp.Payload) == 0 {
+				continue
+			}
+			metadata := &core.SnapshotMetadata{}
+			if err := rlp.DecodeBytes(pr.resp.Payload, metadata); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Failed to decode snapshot metadata")
+				continue
+			}
+			onMetadata(pr.peerID, metadata)
+		}
+	}
+}
+
+// lightSyncLoop periodically advances the light verifier with the snapshot metadata served by
+// the peers.
+func (sm *SyncManager) lightSyncLoop() {
+	defer sm.wg.Done()
+
+	ticker := time.NewTicker(lightSyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := sm.lightSync(sm.ctx); err != nil {
+			sm.logger.WithFields(log.Fields{"err": err}).Debug("Light sync round failed")
+		}
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lightSync runs one round of the light sync.
+func (sm *SyncManager) lightSync(ctx context.Context) error {
+	fetcher := &snapshotFetcher{
+		send:      sm.dispatcher.GetSnapshot,
+		responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize),
+	}
+	sm.snapshotMu.Lock()
+	if sm.snapshotResponses != nil {
+		sm.snapshotMu.Unlock()
+		return fmt.Errorf("A snapshot fetch is already in progress")
+	}
+	sm.snapshotResponses = fetcher.responses
+	sm.snapshotMu.Unlock()
+	defer func() {
+		sm.snapshotMu.Lock()
+		sm.snapshotResponses = nil
+		sm.snapshotMu.Unlock()
+	}()
+
+	err := fetcher.fetchMetadata(ctx, func(peerID string, metadata *core.SnapshotMetadata) {
+		sm.applyLightSyncMetadata(peerID, metadata)
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		previous := sm.lightVerifier.LatestHeader()
+		if err = fetcher.fetchHeaders(ctx, previous.Height, sm.applyLightSyncHeaders); err != nil {
+			return err
+		}
+		latest := sm.lightVerifier.LatestHeader()
+		if latest.Height == previous.Height {
+			return nil
+		}
+		sm.logger.WithFields(log.Fields{
+			"height": latest.Height,
+			"hash":   latest.Hash().Hex(),
+		}).Info("Light sync verified block headers")
+	}
+}
+
+// fetchHeaders requests the finalized headers above the height from the peers, and passes the
+// decoded headers to the callback until the wait is over.
+func (sf *snapshotFetcher) fetchHeaders(ctx context.Context, height uint64, onHeaders func(peerID string, headers []lightHeader)) error {
+	sf.send(nil, dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestHeaders, ChunkIndex: height})
+
+	timer := time.NewTimer(snapshotManifestWait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case pr := <-sf.responses:
+			if pr.resp.Type != dispatcher.SnapshotRequestHeaders || pr.resp.ChunkIndex != height || len(pr.resp.Payload) == 0 {
+				continue
+			}
+			headers := []lightHeader{}
+			if err := rlp.DecodeBytes(pr.resp.Payload, &headers); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Failed to decode block headers")
+				continue
+			}
+			onHeaders(pr.peerID, headers)
+		}
+	}
+}
+
+// applyLightSyncHeaders verifies the headers served by the peer with the light verifier, in
+// order, until one of them is not endorsed by the proven validator set. The headers beyond a
+// validator set change are verified once the metadata proving the change is received.
+func (sm *SyncManager) applyLightSyncHeaders(peerID string, headers []lightHeader) {
+	for _, lh := range headers {
+		if lh.Header == nil || lh.VoteSet == nil {
+			return
+		}
+		if err := sm.lightVerifier.VerifyHeader(lh.Header, lh.VoteSet); err != nil {
+			sm.logger.WithFields(log.Fields{"peer": peerID, "height": lh.Header.Height, "err": err}).Debug("Failed to verify block header")
+			return
+		}
+	}
+}
+
+// serveHeaders returns the finalized headers above the requested height, each along with the
+// votes endorsing it, up to lightSyncMaxHeaders of them.
+func (sm *SyncManager) serveHeaders(req *dispatcher.SnapshotRequest) dispatcher.SnapshotResponse {
+	resp := dispatcher.SnapshotResponse{Type: req.Type, ChunkIndex: req.ChunkIndex}
+	lfbHeight := sm.consensus.GetLastFinalizedBlock().Height
+	headers := []lightHeader{}
+	for height := req.ChunkIndex + 1; height <= lfbHeight && len(headers) < lightSyncMaxHeaders; height++ {
+		block, err := sm.chain.FindFinalizedBlockByHeight(height)
+		if err != nil || block == nil {
+			break
+		}
+		votes := sm.chain.FindVotesByHash(block.Hash())
+		if votes.IsEmpty() {
+			break
+		}
+		headers = append(headers, lightHeader{Header: block.BlockHeader, VoteSet: votes})
+	}
+	if len(headers) == 0 {
+		return resp
+	}
+	payload, err := rlp.EncodeToBytes(headers)
+	if err != nil {
+		logger.WithFields(log.Fields{"err": err}).Error("Failed to encode block headers")
+		return resp
+	}
+	resp.Payload = payload
+	return resp
+}
+
+// applyLightSyncMetadata verifies the metadata served by the peer with the light verifier,
+// which moves to the snapshot block of the metadata if it is newer.
+func (sm *SyncManager) applyLightSyncMetadata(peerID string, metadata *core.SnapshotMetadata) {
+	previous := sm.lightVerifier.LatestHeader()
+	header, err := sm.lightVerifier.VerifyMetadata(metadata)
+	if err != nil {
+		sm.logger.WithFields(log.Fields{"peer": peerID, "err": err}).Warn("Received invalid snapshot metadata")
+		return
+	}
+	if header.Height > previous.Height {
+		sm.logger.WithFields(log.Fields{
+			"peer":   peerID,
+			"height": header.Height,
+			"hash":   header.Hash().Hex(),
+		}).Info("Light sync verified block header")
+	}
+}
@@ -0,0 +1,48 @@
+package netsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestFetchHeaders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	trio := createTestCheckpoint(100)
+	served := []lightHeader{
+		{Header: trio.Second.Header, VoteSet: core.NewVoteSet()},
+		{Header: trio.Third.Header, VoteSet: core.NewVoteSet()},
+	}
+	payload, err := rlp.EncodeToBytes(served)
+	require.Nil(err)
+
+	fetcher := &snapshotFetcher{responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize)}
+	fetcher.send = func(peerIDs []string, req dispatcher.SnapshotRequest) {
+		assert.Equal(dispatcher.SnapshotRequestHeaders, req.Type)
+		// A stale response to an earlier request, a peer without the headers, and a peer
+		// serving them.
+		fetcher.responses <- snapshotPeerResponse{peerID: "stale", resp: dispatcher.SnapshotResponse{
+			Type: dispatcher.SnapshotRequestHeaders, ChunkIndex: req.ChunkIndex - 1, Payload: payload}}
+		fetcher.responses <- snapshotPeerResponse{peerID: "empty", resp: dispatcher.SnapshotResponse{
+			Type: dispatcher.SnapshotRequestHeaders, ChunkIndex: req.ChunkIndex}}
+		fetcher.responses <- snapshotPeerResponse{peerID: "good", resp: dispatcher.SnapshotResponse{
+			Type: dispatcher.SnapshotRequestHeaders, ChunkIndex: req.ChunkIndex, Payload: payload}}
+	}
+
+	received := make(map[string][]lightHeader)
+	err = fetcher.fetchHeaders(context.Background(), 99, func(peerID string, headers []lightHeader) {
+		received[peerID] = headers
+	})
+	require.Nil(err)
+	require.Equal(1, len(received))
+	require.Equal(2, len(received["good"]))
+	assert.Equal(trio.Second.Header.Hash(), received["good"][0].Header.Hash())
+	assert.Equal(trio.Third.Header.Hash(), received["good"][1].Header.Hash())
+}
@@ -293,6 +293,13 @@ func (rm *RequestManager) buildInventoryRequest() dispatcher.InventoryRequest {
 }
 
 func (rm *RequestManager) tryToDownload() {
+	if rm.syncMgr.IsSnapshotFastSyncing() {
+		return // the blocks are synced from the fast synced snapshot on
+	}
+	if rm.syncMgr.IsLightSyncing() {
+		return // only the headers are synced
+	}
+
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
@@ -0,0 +1,221 @@
+package netsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+const (
+	snapshotFastSyncRetryInterval = 30 * time.Second
+	snapshotFastSyncMaxAttempts   = 10
+	snapshotFastSyncFileName      = "snapshot"
+)
+
+// SnapshotFastSyncImporter validates the snapshot file and imports it into the node, and
+// returns the snapshot block, which becomes the last finalized block.
+type SnapshotFastSyncImporter func(snapshotFilePath string) (*core.ExtendedBlock, error)
+
+// snapshotCheckpoint is a finalized checkpoint, i.e. the tail block trio of a snapshot, along
+// with the peers serving the snapshot.
+type snapshotCheckpoint struct {
+	root  common.Hash
+	trio  *core.SnapshotBlockTrio
+	peers []string
+}
+
+type snapshotCheckpointKey struct {
+	root      common.Hash
+	blockHash common.Hash
+}
+
+func (cp *snapshotCheckpoint) height() uint64 {
+	return cp.trio.Second.Header.Height
+}
+
+// fetchCheckpoints requests the checkpoints of the snapshots served by the peers. The block
+// trio links are checked, the votes are only verified once the snapshot is validated.
+func (sf *snapshotFetcher) fetchCheckpoints(ctx context.Context) ([]*snapshotCheckpoint, error) {
+	sf.send(nil, dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestCheckpoint})
+
+	checkpoints := make(map[snapshotCheckpointKey]*snapshotCheckpoint)
+	timer := time.NewTimer(snapshotManifestWait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			result := []*snapshotCheckpoint{}
+			for _, cp := range checkpoints {
+				result = append(result, cp)
+			}
+			return result, nil
+		case pr := <-sf.responses:
+			if pr.resp.Type != dispatcher.SnapshotRequestCheckpoint || len(pr.resp.Payload) == 0 {
+				continue
+			}
+			trio := &core.SnapshotBlockTrio{}
+			if err := rlp.DecodeBytes(pr.resp.Payload, trio); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Failed to decode snapshot checkpoint")
+				continue
+			}
+			if err := snapshot.CheckBlockTrio(trio); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Received invalid snapshot checkpoint")
+				continue
+			}
+			// The same checkpoint may be served by snapshots split differently.
+			key := snapshotCheckpointKey{root: pr.resp.Root, blockHash: trio.Second.Header.Hash()}
+			cp, ok := checkpoints[key]
+			if !ok {
+				cp = &snapshotCheckpoint{root: pr.resp.Root, trio: trio}
+				checkpoints[key] = cp
+			}
+			cp.peers = append(cp.peers, pr.peerID)
+		}
+	}
+}
+
+// selectCheckpoint selects the highest checkpoint above minHeight served by at least minPeers
+// peers, preferring the checkpoint served by more peers at the same height. It returns nil if
+// there is none.
+func selectCheckpoint(checkpoints []*snapshotCheckpoint, minHeight uint64, minPeers int) *snapshotCheckpoint {
+	var selected *snapshotCheckpoint
+	for _, cp := range checkpoints {
+		if cp.height() <= minHeight || len(cp.peers) < minPeers {
+			continue
+		}
+		if selected == nil || cp.height() > selected.height() ||
+			(cp.height() == selected.height() && len(cp.peers) > len(selected.peers)) {
+			selected = cp
+		}
+	}
+	return selected
+}
+
+// IsSnapshotFastSyncing returns whether the node is fetching the state from the snapshot
+// peers, during which the block sync is paused.
+func (sm *SyncManager) IsSnapshotFastSyncing() bool {
+	return atomic.LoadInt32(&sm.snapshotFastSyncing) != 0
+}
+
+// SetSnapshotFastSync enables the snapshot fast sync: upon start, if the peers serve a
+// finalized checkpoint far enough ahead of the last finalized block, the state at the
+// checkpoint is fetched via the snapshot protocol into the working directory and imported,
+// and the block sync resumes from there.
+func (sm *SyncManager) SetSnapshotFastSync(workDir string, importer SnapshotFastSyncImporter) {
+	sm.snapshotFastSyncDir = workDir
+	sm.snapshotFastSyncImporter = importer
+	atomic.StoreInt32(&sm.snapshotFastSyncing, 1)
+}
+
+// snapshotFastSyncLoop runs the snapshot fast sync until it succeeds, or it turns out that
+// the node is close enough to the checkpoints served by the peers. The block sync resumes
+// from the last finalized block if the fast sync keeps failing.
+func (sm *SyncManager) snapshotFastSyncLoop() {
+	defer sm.wg.Done()
+	defer atomic.StoreInt32(&sm.snapshotFastSyncing, 0)
+
+	for attempt := 1; ; attempt++ {
+		done, err := sm.snapshotFastSync(sm.ctx)
+		if done {
+			return
+		}
+		if attempt >= snapshotFastSyncMaxAttempts {
+			sm.logger.WithFields(log.Fields{"err": err}).Warn("Snapshot fast sync failed, falling back to block sync")
+			return
+		}
+		sm.logger.WithFields(log.Fields{"err": err}).Warn("Snapshot fast sync failed, retrying")
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-time.After(snapshotFastSyncRetryInterval):
+		}
+	}
+}
+
+// snapshotFastSync runs the pipeline once: collect the checkpoints from the peers, pick a
+// recent one, fetch its snapshot and import it. It returns true once there's nothing left to
+// do, i.e. the snapshot is imported or no checkpoint is worth fetching.
+func (sm *SyncManager) snapshotFastSync(ctx context.Context) (bool, error) {
+	fetcher := &snapshotFetcher{
+		send:      sm.dispatcher.GetSnapshot,
+		responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize),
+	}
+	sm.snapshotMu.Lock()
+	if sm.snapshotResponses != nil {
+		sm.snapshotMu.Unlock()
+		return false, fmt.Errorf("A snapshot fetch is already in progress")
+	}
+	sm.snapshotResponses = fetcher.responses
+	sm.snapshotMu.Unlock()
+	defer func() {
+		sm.snapshotMu.Lock()
+		sm.snapshotResponses = nil
+		sm.snapshotMu.Unlock()
+	}()
+
+	lfbHeight := sm.consensus.GetLastFinalizedBlock().Height
+	minHeight := lfbHeight + viper.GetUint64(common.CfgSyncSnapshotFastSyncMinHeightGap)
+
+	// Stage 1: collect the finalized checkpoints served by the peers.
+	checkpoints, err := fetcher.fetchCheckpoints(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(checkpoints) == 0 {
+		return false, fmt.Errorf("No peer serves a snapshot checkpoint")
+	}
+
+	// Stage 2: pick a recent checkpoint.
+	checkpoint := selectCheckpoint(checkpoints, minHeight, viper.GetInt(common.CfgSyncSnapshotFastSyncMinPeers))
+	if checkpoint == nil {
+		if selectCheckpoint(checkpoints, minHeight, 1) != nil {
+			return false, fmt.Errorf("Not enough peers serve the snapshot checkpoints")
+		}
+		sm.logger.WithFields(log.Fields{"lfbHeight": lfbHeight}).Info("No snapshot checkpoint far enough ahead, syncing blocks")
+		return true, nil
+	}
+	checkpointHeader := checkpoint.trio.Second.Header
+	sm.logger.WithFields(log.Fields{
+		"height": checkpointHeader.Height,
+		"hash":   checkpointHeader.Hash().Hex(),
+		"root":   checkpoint.root.Hex(),
+		"peers":  len(checkpoint.peers),
+	}).Info("Selected snapshot checkpoint for fast sync")
+
+	// Stage 3: fetch the state via the snapshot protocol.
+	chunkDir := path.Join(sm.snapshotFastSyncDir, "chunks")
+	snapshotFilePath := path.Join(sm.snapshotFastSyncDir, snapshotFastSyncFileName)
+	if err = os.MkdirAll(sm.snapshotFastSyncDir, os.ModePerm); err != nil {
+		return false, err
+	}
+	if err = fetcher.fetch(ctx, checkpoint.root, chunkDir, snapshotFilePath); err != nil {
+		return false, err
+	}
+
+	// Stage 4: validate and import the snapshot, the block sync then resumes from it.
+	snapshotBlock, err := sm.snapshotFastSyncImporter(snapshotFilePath)
+	if err != nil {
+		return false, err
+	}
+	if snapshotBlock.Hash() != checkpointHeader.Hash() {
+		return false, fmt.Errorf("Imported snapshot block %v doesn't match the checkpoint %v", snapshotBlock.Hash().Hex(), checkpointHeader.Hash().Hex())
+	}
+	sm.logger.WithFields(log.Fields{
+		"height": snapshotBlock.Height,
+		"hash":   snapshotBlock.Hash().Hex(),
+	}).Info("Snapshot fast sync completed, syncing blocks")
+	return true, nil
+}
@@ -0,0 +1,76 @@
+package netsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// createTestCheckpoint creates a linked block trio with the snapshot block at the given height.
+func createTestCheckpoint(height uint64) *core.SnapshotBlockTrio {
+	first := &core.BlockHeader{ChainID: "testchain", Height: height - 1, Timestamp: big.NewInt(1)}
+	second := &core.BlockHeader{ChainID: "testchain", Height: height, Timestamp: big.NewInt(2),
+		Parent: first.Hash(), HCC: core.CommitCertificate{BlockHash: first.Hash()}}
+	third := &core.BlockHeader{ChainID: "testchain", Height: height + 1, Timestamp: big.NewInt(3),
+		Parent: second.Hash(), HCC: core.CommitCertificate{BlockHash: second.Hash()}}
+	trio := &core.SnapshotBlockTrio{}
+	trio.First.Header = first
+	trio.Second.Header = second
+	trio.Third.Header = third
+	trio.Third.VoteSet = core.NewVoteSet()
+	return trio
+}
+
+func TestSelectSnapshotCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	low := &snapshotCheckpoint{trio: createTestCheckpoint(100), peers: []string{"a", "b", "c"}}
+	high := &snapshotCheckpoint{trio: createTestCheckpoint(200), peers: []string{"a", "b"}}
+	highPopular := &snapshotCheckpoint{trio: createTestCheckpoint(200), peers: []string{"a", "b", "c"}}
+	highest := &snapshotCheckpoint{trio: createTestCheckpoint(300), peers: []string{"d"}}
+	checkpoints := []*snapshotCheckpoint{low, high, highPopular, highest}
+
+	assert.Equal(highest, selectCheckpoint(checkpoints, 0, 1))
+	assert.Equal(highPopular, selectCheckpoint(checkpoints, 0, 2))
+	assert.Equal(highPopular, selectCheckpoint(checkpoints, 0, 3))
+	assert.Equal(low, selectCheckpoint([]*snapshotCheckpoint{low, high, highest}, 0, 3))
+	assert.Nil(selectCheckpoint(checkpoints, 300, 1))
+}
+
+func TestFetchSnapshotCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	valid, err := rlp.EncodeToBytes(createTestCheckpoint(100))
+	require.Nil(err)
+	unlinkedTrio := createTestCheckpoint(200)
+	unlinkedTrio.Third.Header.Parent = common.HexToHash("a1")
+	unlinked, err := rlp.EncodeToBytes(unlinkedTrio)
+	require.Nil(err)
+
+	root := common.HexToHash("b2")
+	fetcher := &snapshotFetcher{responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize)}
+	fetcher.send = func(peerIDs []string, req dispatcher.SnapshotRequest) {
+		respond := func(peerID string, payload common.Bytes) {
+			fetcher.responses <- snapshotPeerResponse{peerID: peerID, resp: dispatcher.SnapshotResponse{Type: req.Type, Root: root, Payload: payload}}
+		}
+		respond("a", valid)
+		respond("b", valid)
+		respond("c", unlinked)
+		respond("d", nil)
+	}
+
+	checkpoints, err := fetcher.fetchCheckpoints(context.Background())
+	require.Nil(err)
+	require.Equal(1, len(checkpoints))
+	assert.Equal(root, checkpoints[0].root)
+	assert.Equal(uint64(100), checkpoints[0].height())
+	assert.Equal([]string{"a", "b"}, checkpoints[0].peers)
+}
@@ -0,0 +1,347 @@
+package netsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+const (
+	snapshotManifestWait      = 5 * time.Second
+	snapshotChunkTimeout      = 30 * time.Second
+	snapshotMaxInflightChunks = 8
+	snapshotMaxChunkAttempts  = 5
+	snapshotResponseQueueSize = 64
+)
+
+// snapshotPeerResponse is a snapshot response along with the peer it came from.
+type snapshotPeerResponse struct {
+	peerID string
+	resp   dispatcher.SnapshotResponse
+}
+
+// snapshotServer serves the manifest and the chunks of the snapshot split in the chunk
+// directory, see snapshot.SplitSnapshot.
+type snapshotServer struct {
+	chunkDir string
+
+	mu       sync.Mutex
+	manifest *snapshot.SnapshotChunkManifest
+	metadata *core.SnapshotMetadata // metadata of the served snapshot, nil until read
+}
+
+func newSnapshotServer(chunkDir string) *snapshotServer {
+	return &snapshotServer{chunkDir: chunkDir}
+}
+
+// loadManifest reads the manifest of the chunk directory. The manifest is read again upon
+// each manifest request, so a newly split snapshot is picked up without a restart.
+func (ss *snapshotServer) loadManifest(reload bool) *snapshot.SnapshotChunkManifest {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.manifest != nil && !reload {
+		return ss.manifest
+	}
+	manifest, err := snapshot.ReadChunkManifest(path.Join(ss.chunkDir, snapshot.ChunkManifestFileName))
+	if err != nil {
+		logger.WithFields(log.Fields{"chunkDir": ss.chunkDir, "err": err}).Debug("No snapshot manifest to serve")
+		return nil
+	}
+	if ss.manifest == nil || ss.manifest.Root != manifest.Root {
+		ss.metadata = nil
+	}
+	ss.manifest = manifest
+	return manifest
+}
+
+// loadMetadata reads the metadata of the served snapshot.
+func (ss *snapshotServer) loadMetadata(manifest *snapshot.SnapshotChunkManifest) *core.SnapshotMetadata {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.metadata != nil {
+		return ss.metadata
+	}
+	metadata, err := snapshot.ReadChunkedSnapshotMetadata(manifest, ss.chunkDir)
+	if err != nil {
+		logger.WithFields(log.Fields{"chunkDir": ss.chunkDir, "err": err}).Warn("Failed to read the served snapshot metadata")
+		return nil
+	}
+	ss.metadata = metadata
+	return metadata
+}
+
+// serve returns the response to the request, with an empty payload if the data isn't available.
+func (ss *snapshotServer) serve(req *dispatcher.SnapshotRequest) dispatcher.SnapshotResponse {
+	resp := dispatcher.SnapshotResponse{Type: req.Type, ChunkIndex: req.ChunkIndex}
+	switch req.Type {
+	case dispatcher.SnapshotRequestManifest:
+		manifest := ss.loadManifest(true)
+		if manifest == nil {
+			return resp
+		}
+		payload, err := rlp.EncodeToBytes(manifest)
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err}).Error("Failed to encode snapshot manifest")
+			return resp
+		}
+		resp.Root = manifest.Root
+		resp.Payload = payload
+	case dispatcher.SnapshotRequestChunk:
+		resp.Root = req.Root
+		manifest := ss.loadManifest(false)
+		if manifest == nil || manifest.Root != req.Root || req.ChunkIndex >= uint64(len(manifest.ChunkHashes)) {
+			return resp
+		}
+		data, err := ioutil.ReadFile(path.Join(ss.chunkDir, snapshot.ChunkFileName(int(req.ChunkIndex))))
+		if err != nil {
+			logger.WithFields(log.Fields{"chunkIndex": req.ChunkIndex, "err": err}).Warn("Failed to read snapshot chunk")
+			return resp
+		}
+		resp.Payload = data
+	case dispatcher.SnapshotRequestCheckpoint, dispatcher.SnapshotRequestMetadata:
+		manifest := ss.loadManifest(true)
+		if manifest == nil {
+			return resp
+		}
+		metadata := ss.loadMetadata(manifest)
+		if metadata == nil {
+			return resp
+		}
+		var payload []byte
+		var err error
+		if req.Type == dispatcher.SnapshotRequestCheckpoint {
+			payload, err = rlp.EncodeToBytes(&metadata.TailTrio)
+		} else {
+			payload, err = rlp.EncodeToBytes(metadata)
+		}
+		if err != nil {
+			logger.WithFields(log.Fields{"err": err}).Error("Failed to encode snapshot metadata")
+			return resp
+		}
+		resp.Root = manifest.Root
+		resp.Payload = payload
+	}
+	return resp
+}
+
+// snapshotFetcher downloads a snapshot chunk by chunk from the peers serving it.
+type snapshotFetcher struct {
+	send      func(peerIDs []string, req dispatcher.SnapshotRequest)
+	responses chan snapshotPeerResponse
+}
+
+// fetchManifest requests the manifest from the peers, and returns the manifest with the given
+// root along with the peers serving it. If the root is empty, the manifest served by the most
+// peers is selected.
+func (sf *snapshotFetcher) fetchManifest(ctx context.Context, root common.Hash) (*snapshot.SnapshotChunkManifest, []string, error) {
+	sf.send(nil, dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestManifest})
+
+	manifests := make(map[common.Hash]*snapshot.SnapshotChunkManifest)
+	peers := make(map[common.Hash][]string)
+	timer := time.NewTimer(snapshotManifestWait)
+	defer timer.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+			waiting = false
+		case pr := <-sf.responses:
+			if pr.resp.Type != dispatcher.SnapshotRequestManifest || len(pr.resp.Payload) == 0 {
+				continue
+			}
+			manifest := &snapshot.SnapshotChunkManifest{}
+			if err := rlp.DecodeBytes(pr.resp.Payload, manifest); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Failed to decode snapshot manifest")
+				continue
+			}
+			if err := manifest.Validate(); err != nil {
+				logger.WithFields(log.Fields{"peer": pr.peerID, "err": err}).Warn("Received invalid snapshot manifest")
+				continue
+			}
+			if !root.IsEmpty() && manifest.Root != root {
+				continue
+			}
+			manifests[manifest.Root] = manifest
+			peers[manifest.Root] = append(peers[manifest.Root], pr.peerID)
+		}
+	}
+
+	var selected common.Hash
+	for r, servingPeers := range peers {
+		if len(servingPeers) > len(peers[selected]) {
+			selected = r
+		}
+	}
+	if len(peers[selected]) == 0 {
+		return nil, nil, fmt.Errorf("No peer serves the snapshot manifest")
+	}
+	return manifests[selected], peers[selected], nil
+}
+
+// fetchChunks downloads the chunks missing from the chunk directory, spreading the requests
+// over the peers. Each chunk is verified against the manifest before it is written, a chunk
+// that fails the verification or times out is requested again from another peer.
+func (sf *snapshotFetcher) fetchChunks(ctx context.Context, manifest *snapshot.SnapshotChunkManifest, peers []string, chunkDir string) error {
+	queue := []uint64{}
+	for index := range manifest.ChunkHashes {
+		data, err := ioutil.ReadFile(path.Join(chunkDir, snapshot.ChunkFileName(index)))
+		if err == nil && manifest.VerifyChunk(index, data) == nil {
+			continue // already downloaded
+		}
+		queue = append(queue, uint64(index))
+	}
+
+	pending := make(map[uint64]time.Time)
+	attempts := make(map[uint64]int)
+	retry := func(index uint64) error {
+		delete(pending, index)
+		attempts[index]++
+		if attempts[index] >= snapshotMaxChunkAttempts {
+			return fmt.Errorf("Failed to fetch snapshot chunk %v after %v attempts", index, attempts[index])
+		}
+		queue = append(queue, index)
+		return nil
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for len(queue) > 0 || len(pending) > 0 {
+		for len(pending) < snapshotMaxInflightChunks && len(queue) > 0 {
+			index := queue[0]
+			queue = queue[1:]
+			peerID := peers[(int(index)+attempts[index])%len(peers)]
+			sf.send([]string{peerID}, dispatcher.SnapshotRequest{
+				Type:       dispatcher.SnapshotRequestChunk,
+				Root:       manifest.Root,
+				ChunkIndex: index,
+			})
+			pending[index] = time.Now().Add(snapshotChunkTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			for index, deadline := range pending {
+				if now.After(deadline) {
+					if err := retry(index); err != nil {
+						return err
+					}
+				}
+			}
+		case pr := <-sf.responses:
+			resp := pr.resp
+			if resp.Type != dispatcher.SnapshotRequestChunk || resp.Root != manifest.Root {
+				continue
+			}
+			if _, ok := pending[resp.ChunkIndex]; !ok {
+				continue
+			}
+			if err := manifest.VerifyChunk(int(resp.ChunkIndex), resp.Payload); err != nil {
+				logger.WithFields(log.Fields{
+					"peer":       pr.peerID,
+					"chunkIndex": resp.ChunkIndex,
+					"err":        err,
+				}).Warn("Received invalid snapshot chunk")
+				if err = retry(resp.ChunkIndex); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := ioutil.WriteFile(path.Join(chunkDir, snapshot.ChunkFileName(int(resp.ChunkIndex))), resp.Payload, 0644); err != nil {
+				return err
+			}
+			delete(pending, resp.ChunkIndex)
+		}
+	}
+	return nil
+}
+
+// fetch downloads the snapshot into the chunk directory and assembles the snapshot file.
+func (sf *snapshotFetcher) fetch(ctx context.Context, root common.Hash, chunkDir, snapshotFilePath string) error {
+	manifest, peers, err := sf.fetchManifest(ctx, root)
+	if err != nil {
+		return err
+	}
+	logger.WithFields(log.Fields{
+		"root":   manifest.Root.Hex(),
+		"size":   manifest.SnapshotSize,
+		"chunks": len(manifest.ChunkHashes),
+		"peers":  len(peers),
+	}).Info("Fetching snapshot from peers")
+
+	if err = os.MkdirAll(chunkDir, os.ModePerm); err != nil {
+		return err
+	}
+	if err = sf.fetchChunks(ctx, manifest, peers, chunkDir); err != nil {
+		return err
+	}
+	if err = snapshot.AssembleSnapshot(manifest, chunkDir, snapshotFilePath); err != nil {
+		return err
+	}
+	// Keep the manifest along with the chunks so that the snapshot can be served in turn.
+	return snapshot.WriteChunkManifest(path.Join(chunkDir, snapshot.ChunkManifestFileName), manifest)
+}
+
+// FetchSnapshot downloads the snapshot from the peers over the P2P network, verifying each
+// chunk against the manifest, and assembles it into the snapshot file. If the manifest root
+// is empty, the snapshot served by the most peers is fetched. Only the chunk integrity is
+// checked here, the snapshot itself still needs to be validated before it is loaded.
+func (sm *SyncManager) FetchSnapshot(ctx context.Context, root common.Hash, chunkDir, snapshotFilePath string) error {
+	fetcher := &snapshotFetcher{
+		send:      sm.dispatcher.GetSnapshot,
+		responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize),
+	}
+	sm.snapshotMu.Lock()
+	if sm.snapshotResponses != nil {
+		sm.snapshotMu.Unlock()
+		return fmt.Errorf("A snapshot fetch is already in progress")
+	}
+	sm.snapshotResponses = fetcher.responses
+	sm.snapshotMu.Unlock()
+
+	defer func() {
+		sm.snapshotMu.Lock()
+		sm.snapshotResponses = nil
+		sm.snapshotMu.Unlock()
+	}()
+
+	return fetcher.fetch(ctx, root, chunkDir, snapshotFilePath)
+}
+
+func (sm *SyncManager) handleSnapshotRequest(peerID string, req *dispatcher.SnapshotRequest) {
+	if req.Type == dispatcher.SnapshotRequestHeaders {
+		sm.dispatcher.SendSnapshot([]string{peerID}, sm.serveHeaders(req))
+		return
+	}
+	if sm.snapshotServer == nil {
+		return
+	}
+	resp := sm.snapshotServer.serve(req)
+	sm.dispatcher.SendSnapshot([]string{peerID}, resp)
+}
+
+func (sm *SyncManager) handleSnapshotResponse(peerID string, resp *dispatcher.SnapshotResponse) {
+	sm.snapshotMu.Lock()
+	defer sm.snapshotMu.Unlock()
+	if sm.snapshotResponses == nil {
+		return
+	}
+	select {
+	case sm.snapshotResponses <- snapshotPeerResponse{peerID: peerID, resp: *resp}:
+	default:
+		sm.logger.WithFields(log.Fields{"peerID": peerID}).Debug("Dropped snapshot response, queue is full")
+	}
+}
@@ -0,0 +1,83 @@
+package netsync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/snapshot"
+)
+
+func TestFetchSnapshotFromPeers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "snapshot-sync")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// A snapshot head followed by arbitrary content, which is all the chunking looks into.
+	trio := createTestCheckpoint(100)
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 4}))
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: trio.Second.Header}))
+	require.Nil(core.WriteMetadata(writer, &core.SnapshotMetadata{TailTrio: *trio, Version: core.CurrentSnapshotMetadataVersion}))
+	require.Nil(writer.Flush())
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	buf.Write(content)
+	snapshotPath := path.Join(dir, "theta_snapshot")
+	require.Nil(ioutil.WriteFile(snapshotPath, buf.Bytes(), 0644))
+	manifest, err := snapshot.SplitSnapshot(snapshotPath, path.Join(dir, "served"), 1024)
+	require.Nil(err)
+
+	server := newSnapshotServer(path.Join(dir, "served"))
+	fetcher := &snapshotFetcher{responses: make(chan snapshotPeerResponse, snapshotResponseQueueSize)}
+	fetcher.send = func(peerIDs []string, req dispatcher.SnapshotRequest) {
+		if len(peerIDs) == 0 {
+			peerIDs = []string{"bad", "good"}
+		}
+		for _, peerID := range peerIDs {
+			resp := server.serve(&req)
+			if peerID == "bad" && req.Type == dispatcher.SnapshotRequestChunk {
+				resp.Payload = append(common.Bytes{}, resp.Payload...)
+				resp.Payload[0] ^= 0xff
+			}
+			fetcher.responses <- snapshotPeerResponse{peerID: peerID, resp: resp}
+		}
+	}
+
+	fetchedPath := path.Join(dir, "theta_snapshot-fetched")
+	err = fetcher.fetch(context.Background(), manifest.Root, path.Join(dir, "fetched"), fetchedPath)
+	require.Nil(err)
+
+	fetched, err := ioutil.ReadFile(fetchedPath)
+	require.Nil(err)
+	assert.Equal(manifest.SnapshotSize, uint64(len(fetched)))
+	assert.True(bytes.HasSuffix(fetched, content))
+	fetchedManifest, err := snapshot.ReadChunkManifest(path.Join(dir, "fetched", snapshot.ChunkManifestFileName))
+	require.Nil(err)
+	assert.Equal(manifest.Root, fetchedManifest.Root)
+}
+
+func TestSnapshotServerUnknownRoot(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newSnapshotServer(path.Join(os.TempDir(), "nonexistent-snapshot-chunks"))
+	resp := server.serve(&dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestManifest})
+	assert.Empty(resp.Payload)
+	resp = server.serve(&dispatcher.SnapshotRequest{Type: dispatcher.SnapshotRequestChunk, Root: common.HexToHash("a1")})
+	assert.Empty(resp.Payload)
+}
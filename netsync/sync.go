@@ -19,6 +19,7 @@ import (
 	"github.com/thetatoken/theta/p2pl"
 	rp "github.com/thetatoken/theta/report"
 	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/snapshot"
 )
 
 const voteCacheLimit = 512
@@ -59,6 +60,16 @@ type SyncManager struct {
 	logger *log.Entry
 
 	voteCache *lru.Cache // Cache for votes
+
+	snapshotServer    *snapshotServer
+	snapshotMu        sync.Mutex
+	snapshotResponses chan snapshotPeerResponse // non-nil while a snapshot is being fetched
+
+	snapshotFastSyncing      int32 // atomic, non-zero while the snapshot fast sync is pending
+	snapshotFastSyncDir      string
+	snapshotFastSyncImporter SnapshotFastSyncImporter
+
+	lightVerifier *snapshot.LightVerifier // non-nil in the header-only light sync mode
 }
 
 func NewSyncManager(chain *blockchain.Chain, cons core.ConsensusEngine, networkOld p2p.Network, network p2pl.Network, disp *dispatcher.Dispatcher, consumer MessageConsumer, reporter *rp.Reporter) *SyncManager {
@@ -82,6 +93,10 @@ func NewSyncManager(chain *blockchain.Chain, cons core.ConsensusEngine, networkO
 		network.RegisterMessageHandler(sm)
 	}
 
+	if chunkDir := viper.GetString(common.CfgSyncSnapshotChunkDir); chunkDir != "" {
+		sm.snapshotServer = newSnapshotServer(chunkDir)
+	}
+
 	if viper.GetString(common.CfgSyncInboundResponseWhitelist) != "" {
 		sm.whitelist = strings.Split(viper.GetString(common.CfgSyncInboundResponseWhitelist), ",")
 	}
@@ -104,6 +119,16 @@ func (sm *SyncManager) Start(ctx context.Context) {
 
 	sm.wg.Add(1)
 	go sm.mainLoop()
+
+	if sm.IsSnapshotFastSyncing() {
+		sm.wg.Add(1)
+		go sm.snapshotFastSyncLoop()
+	}
+
+	if sm.IsLightSyncing() {
+		sm.wg.Add(1)
+		go sm.lightSyncLoop()
+	}
 }
 
 func (sm *SyncManager) Stop() {
@@ -140,6 +165,8 @@ func (sm *SyncManager) GetChannelIDs() []common.ChannelIDEnum {
 		common.ChannelIDGuardian,
 		common.ChannelIDEliteEdgeNodeVote,
 		common.ChannelIDAggregatedEliteEdgeNodeVotes,
+		common.ChannelIDSnapshot,
+		common.ChannelIDEvidence,
 	}
 }
 
@@ -194,6 +221,13 @@ func (sm *SyncManager) processMessage(message p2ptypes.Message) {
 			return
 		}
 		sm.handleDataResponse(message.PeerID, &content)
+	case dispatcher.SnapshotRequest:
+		sm.handleSnapshotRequest(message.PeerID, &content)
+	case dispatcher.SnapshotResponse:
+		if !inboundAllowed {
+			return
+		}
+		sm.handleSnapshotResponse(message.PeerID, &content)
 	default:
 		sm.logger.WithFields(log.Fields{
 			"message": message,
@@ -659,6 +693,23 @@ func (m *SyncManager) handleDataResponse(peerID string, data *dispatcher.DataRes
 			"peer":            peerID,
 		}).Debug("Received aggregated elite edge node vote")
 		m.handleAggregatedEliteEdgeNodeVotes(vote)
+	case common.ChannelIDEvidence:
+		evidence := &core.Evidence{}
+		err := rlp.DecodeBytes(data.Payload, evidence)
+		if err != nil {
+			m.logger.WithFields(log.Fields{
+				"channelID": data.ChannelID,
+				"payload":   data.Payload,
+				"error":     err,
+				"peerID":    peerID,
+			}).Warn("Failed to decode DataResponse payload")
+			return
+		}
+		m.logger.WithFields(log.Fields{
+			"evidence": evidence,
+			"peer":     peerID,
+		}).Debug("Received evidence")
+		m.PassdownMessage(evidence)
 	case common.ChannelIDHeader:
 		headers := &Headers{}
 		err := rlp.DecodeBytes(data.Payload, headers)
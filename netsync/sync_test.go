@@ -21,20 +21,32 @@ import (
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/p2p/simulation"
 	"github.com/thetatoken/theta/p2p/types"
+	"github.com/thetatoken/theta/p2pl/messenger"
 )
 
+// nilNetwork stands for the absent libp2p network, which the sync manager and the dispatcher
+// detect as a typed nil.
+var nilNetwork = (*messenger.Messenger)(nil)
+
+// MockMessageConsumer records the messages passed down, and marks the blocks valid as the
+// consensus engine would, so that their children are passed down too.
 type MockMessageConsumer struct {
+	chain    *blockchain.Chain
 	Received []interface{}
 }
 
-func NewMockMessageConsumer() *MockMessageConsumer {
+func NewMockMessageConsumer(chain *blockchain.Chain) *MockMessageConsumer {
 	return &MockMessageConsumer{
+		chain:    chain,
 		Received: []interface{}{},
 	}
 }
 
 func (m *MockMessageConsumer) AddMessage(msg interface{}) {
 	m.Received = append(m.Received, msg)
+	if block, ok := msg.(*core.Block); ok {
+		m.chain.MarkBlockValid(block.Hash())
+	}
 }
 
 type MockMsgHandler struct {
@@ -85,11 +97,11 @@ func TestSyncManager(t *testing.T) {
 	privKey, _, _ := crypto.GenerateKeyPair()
 	valMgr := consensus.NewFixedValidatorManager()
 	db := kvstore.NewKVStore(backend.NewMemDatabase())
-	dispatch := dispatcher.NewDispatcher(net1, nil)
+	dispatch := dispatcher.NewDispatcher(net1, nilNetwork)
 	consensus := consensus.NewConsensusEngine(privKey, db, initChain, dispatch, valMgr)
-	mockMsgConsumer := NewMockMessageConsumer()
+	mockMsgConsumer := NewMockMessageConsumer(initChain)
 
-	sm := NewSyncManager(initChain, consensus, net1, nil, dispatch, mockMsgConsumer)
+	sm := NewSyncManager(initChain, consensus, net1, nilNetwork, dispatch, mockMsgConsumer, nil)
 	sm.Start(context.Background())
 
 	// Send block A4 to node1
@@ -100,22 +112,25 @@ func TestSyncManager(t *testing.T) {
 			ChannelID: common.ChannelIDBlock,
 			Payload:   payload,
 		},
-	})
-
-	// node1 should broadcast InventoryResponse
-	var res interface{}
-	res = <-mockMsgHandler.C
-	msg1, ok := res.(dispatcher.InventoryResponse)
-	assert.True(ok)
+	}, false)
+
+	// node1 should gossip A4 with an InventoryResponse and its header with a DataResponse, the
+	// simulated network delivers them in either order.
+	var msg1 dispatcher.InventoryResponse
+	var msg11 dispatcher.DataResponse
+	for i := 0; i < 2; i++ {
+		switch msg := (<-mockMsgHandler.C).(type) {
+		case dispatcher.InventoryResponse:
+			msg1 = msg
+		case dispatcher.DataResponse:
+			msg11 = msg
+		}
+	}
 	assert.Equal(common.ChannelIDBlock, msg1.ChannelID)
-	assert.Equal(core.GetTestBlock("A4").Hash().Hex(), msg1.Entries[0])
-
-	res = <-mockMsgHandler.C
-	msg11, ok := res.(dispatcher.DataResponse)
-	assert.True(ok)
+	assert.Equal([]string{core.GetTestBlock("A4").Hash().Hex()}, msg1.Entries)
 	assert.Equal(common.ChannelIDHeader, msg11.ChannelID)
 
-	res = <-mockMsgHandler.C
+	res := <-mockMsgHandler.C
 	msg2, ok := res.(dispatcher.InventoryRequest)
 	assert.True(ok)
 	assert.Equal(common.ChannelIDBlock, msg2.ChannelID)
@@ -135,7 +150,7 @@ func TestSyncManager(t *testing.T) {
 			ChannelID: common.ChannelIDBlock,
 			Entries:   entries,
 		},
-	})
+	}, false)
 
 	// node2 replies with A3 first
 	payload, _ = rlp.EncodeToBytes(core.CreateTestBlock("A3", "A2"))
@@ -145,7 +160,7 @@ func TestSyncManager(t *testing.T) {
 			ChannelID: common.ChannelIDBlock,
 			Payload:   payload,
 		},
-	})
+	}, false)
 
 	time.Sleep(1 * time.Second)
 
@@ -157,9 +172,10 @@ func TestSyncManager(t *testing.T) {
 			ChannelID: common.ChannelIDBlock,
 			Payload:   payload,
 		},
-	})
+	}, false)
 
-	time.Sleep(1 * time.Second)
+	// A block is passed down once its parent is validated, which takes up to a second per block.
+	time.Sleep(3 * time.Second)
 
 	sm.Stop()
 	sm.Wait()
@@ -201,6 +217,10 @@ func (c *MockConsensus) PrivateKey() *crypto.PrivateKey {
 	return nil
 }
 
+func (c *MockConsensus) Signer() core.Signer {
+	return nil
+}
+
 func (c *MockConsensus) GetTip(includePendingBlockingLeaf bool) *core.ExtendedBlock {
 	return nil
 }
@@ -245,12 +265,12 @@ func TestCollectBlocks(t *testing.T) {
 	net2.RegisterMessageHandler(mockMsgHandler)
 	simnet.Start(context.Background())
 
-	dispatch := dispatcher.NewDispatcher(net1, nil)
+	dispatch := dispatcher.NewDispatcher(net1, nilNetwork)
 	a3, _ := initChain.FindBlock(core.GetTestBlock("A3").Hash())
 	consensus := NewMockConsensus(initChain, a3)
-	mockMsgConsumer := NewMockMessageConsumer()
+	mockMsgConsumer := NewMockMessageConsumer(initChain)
 
-	sm := NewSyncManager(initChain, consensus, net1, nil, dispatch, mockMsgConsumer)
+	sm := NewSyncManager(initChain, consensus, net1, nilNetwork, dispatch, mockMsgConsumer, nil)
 
 	blocks := sm.collectBlocks(core.GetTestBlock("A1").Hash(), core.GetTestBlock("A5").Hash())
 	// Expected blocks: [A1, A2, A3, A4, D4, A5, A3]
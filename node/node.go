@@ -2,18 +2,23 @@ package node
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/consensus/signer"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	dp "github.com/thetatoken/theta/dispatcher"
 	ld "github.com/thetatoken/theta/ledger"
+	st "github.com/thetatoken/theta/ledger/state"
 	mp "github.com/thetatoken/theta/mempool"
 	"github.com/thetatoken/theta/netsync"
 	"github.com/thetatoken/theta/p2p"
@@ -28,16 +33,18 @@ import (
 )
 
 type Node struct {
-	Store            store.Store
-	Chain            *blockchain.Chain
-	Consensus        *consensus.ConsensusEngine
-	ValidatorManager core.ValidatorManager
-	SyncManager      *netsync.SyncManager
-	Dispatcher       *dp.Dispatcher
-	Ledger           core.Ledger
-	Mempool          *mp.Mempool
-	RPC              *rpc.ThetaRPCServer
-	reporter         *rp.Reporter
+	Store             store.Store
+	Chain             *blockchain.Chain
+	Consensus         *consensus.ConsensusEngine
+	ValidatorManager  core.ValidatorManager
+	SyncManager       *netsync.SyncManager
+	Dispatcher        *dp.Dispatcher
+	Ledger            core.Ledger
+	Mempool           *mp.Mempool
+	RPC               *rpc.ThetaRPCServer
+	SnapshotScheduler *snapshot.SnapshotScheduler
+	OrphanPruner      *blockchain.OrphanPruner
+	reporter          *rp.Reporter
 
 	// Life cycle
 	wg      *sync.WaitGroup
@@ -58,12 +65,14 @@ type Params struct {
 	SnapshotPath        string
 	ChainImportDirPath  string
 	ChainCorrectionPath string
+	WALPath             string
 }
 
 func NewNode(params *Params) *Node {
 	store := kvstore.NewKVStore(params.DB)
 	chain := blockchain.NewChain(params.ChainID, store, params.Root)
 	params.RollingDB.SetChain(chain)
+	chain.SetValidatorStateSource(st.NewValidatorStateSource(params.RollingDB), consensus.SelectTopStakeHoldersAsValidators)
 
 	validatorManager := consensus.NewRotatingValidatorManager()
 	dispatcher := dp.NewDispatcher(params.NetworkOld, params.Network)
@@ -74,9 +83,27 @@ func NewNode(params *Params) *Node {
 	syncMgr := netsync.NewSyncManager(chain, consensus, params.NetworkOld, params.Network, dispatcher, consensus, reporter)
 	mempool := mp.CreateMempool(dispatcher, consensus)
 	ledger := ld.NewLedger(params.ChainID, params.RollingDB, params.RollingDB, chain, consensus, validatorManager, mempool)
+	if viper.GetBool(common.CfgStorageFlatSnapshotEnabled) {
+		// Kept in the root DB, the rolling DB compaction only copies the state tries
+		ledger.State().SetFlatSnapshot(st.NewFlatSnapshot(params.DB, params.RollingDB))
+	}
 
 	validatorManager.SetConsensusEngine(consensus)
 	consensus.SetLedger(ledger)
+	if params.WALPath != "" && viper.GetBool(common.CfgConsensusWAL) {
+		if err := consensus.OpenWAL(params.WALPath); err != nil {
+			log.Fatalf("Failed to open the consensus WAL: %v", err)
+		}
+	}
+	if signerAddr := viper.GetString(common.CfgConsensusRemoteSigner); signerAddr != "" {
+		timeout := time.Duration(viper.GetInt(common.CfgConsensusRemoteSignerTimeoutSecs)) * time.Second
+		remoteSigner, err := signer.NewRemoteSigner(signerAddr, timeout)
+		if err != nil {
+			log.Fatalf("Failed to connect to the remote signer: %v", err)
+		}
+		consensus.SetSigner(remoteSigner)
+		log.Printf("Using remote signer %v for validator %v", signerAddr, remoteSigner.Address().Hex())
+	}
 	mempool.SetLedger(ledger)
 	txMsgHandler := mp.CreateMempoolMessageHandler(mempool)
 
@@ -94,7 +121,15 @@ func NewNode(params *Params) *Node {
 		chainCorrectionPath := params.ChainCorrectionPath
 		var lastCC *core.ExtendedBlock
 		var err error
-		if _, lastCC, err = snapshot.ImportSnapshot(snapshotPath, chainImportDirPath, chainCorrectionPath, chain, params.DB, ledger); err != nil {
+		if viper.GetBool(common.CfgSnapshotValidateAndLoad) {
+			var snapshotBlockHeader *core.BlockHeader
+			if snapshotBlockHeader, lastCC, err = snapshot.ValidateAndLoad(snapshotPath, chainImportDirPath, chainCorrectionPath, chain, params.DB, ledger); err != nil {
+				log.Fatalf("Failed to validate and load snapshot: %v, err: %v", snapshotPath, err)
+			}
+			if snapshotBlockHeader.Hash() != params.Root.Hash() {
+				log.Fatalf("Loaded snapshot block %v doesn't match the root block %v", snapshotBlockHeader.Hash().Hex(), params.Root.Hash().Hex())
+			}
+		} else if _, lastCC, err = snapshot.ImportSnapshot(snapshotPath, chainImportDirPath, chainCorrectionPath, chain, params.DB, ledger); err != nil {
 			log.Fatalf("Failed to load snapshot: %v, err: %v", snapshotPath, err)
 		}
 		if lastCC != nil {
@@ -106,6 +141,35 @@ func NewNode(params *Params) *Node {
 		}
 	}
 
+	migrated, err := snapshot.MigrateBlockTrios(params.DB, consensus.GetLastFinalizedBlock().BlockHeader)
+	if err != nil {
+		log.Fatalf("Failed to migrate the block trios: %v", err)
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %v block trios to the new key format", migrated)
+	}
+
+	selector, err := newProposerSelector(chain, consensus.GetLastFinalizedBlock(), params.RollingDB)
+	if err != nil {
+		log.Fatalf("Failed to create the proposer selector: %v", err)
+	}
+	validatorManager.SetProposerSelector(selector)
+
+	if viper.GetBool(common.CfgSyncSnapshotFastSync) {
+		workDir := path.Join(viper.GetString(common.CfgDataPath), "fastsync")
+		syncMgr.SetSnapshotFastSync(workDir, func(snapshotFilePath string) (*core.ExtendedBlock, error) {
+			return importFastSyncSnapshot(snapshotFilePath, chain, consensus, params.DB, ledger)
+		})
+	}
+
+	if viper.GetBool(common.CfgSyncLightSync) {
+		verifier, err := newLightVerifier(params.SnapshotPath, params.DB)
+		if err != nil {
+			log.Fatalf("Failed to start the light sync: %v", err)
+		}
+		syncMgr.SetLightSync(verifier)
+	}
+
 	node := &Node{
 		Store:            store,
 		Chain:            chain,
@@ -118,13 +182,106 @@ func NewNode(params *Params) *Node {
 		reporter:         reporter,
 	}
 
+	if interval := viper.GetUint64(common.CfgSnapshotScheduleInterval); interval > 0 {
+		scheduleDir := viper.GetString(common.CfgSnapshotScheduleDir)
+		if scheduleDir == "" {
+			scheduleDir = path.Join(path.Dir(params.SnapshotPath), "scheduled")
+		}
+		node.SnapshotScheduler = snapshot.NewSnapshotScheduler(ledger.State().DB(), consensus, chain, scheduleDir,
+			interval, viper.GetInt(common.CfgSnapshotScheduleKeep))
+		uploaders, err := snapshot.SnapshotUploaders()
+		if err != nil {
+			log.Fatalf("Failed to create the snapshot uploaders: %v", err)
+		}
+		node.SnapshotScheduler.SetUploaders(uploaders)
+
+		// Keep the states the scheduled snapshots are exported from
+		scheduler := node.SnapshotScheduler
+		ledger.SetSnapshotHeightFunc(func() uint64 {
+			_, height := scheduler.LatestSnapshot()
+			return height
+		})
+	}
+
+	if viper.GetBool(common.CfgStorageOrphanPruningEnabled) {
+		node.OrphanPruner = blockchain.NewOrphanPruner(chain, viper.GetUint64(common.CfgStorageOrphanPruningRetainedBlocks),
+			viper.GetUint64(common.CfgStorageOrphanPruningInterval))
+	}
+
 	if viper.GetBool(common.CfgRPCEnabled) {
 		node.RPC = rpc.NewThetaRPCServer(mempool, ledger, dispatcher, chain, consensus)
+		if node.SnapshotScheduler != nil {
+			node.RPC.SetSnapshotScheduler(node.SnapshotScheduler)
+		}
 	}
 	return node
 }
 
+// importFastSyncSnapshot validates and imports the snapshot fetched by the snapshot fast sync,
+// and moves the last finalized block to the snapshot block. The consensus engine is paused
+// meanwhile, as the import runs in the sync manager goroutine.
+func importFastSyncSnapshot(snapshotFilePath string, chain *blockchain.Chain, cons *consensus.ConsensusEngine, db database.Database, ledger *ld.Ledger) (*core.ExtendedBlock, error) {
+	var snapshotBlock *core.ExtendedBlock
+	err := cons.RunExclusive(func() error {
+		snapshotBlockHeader, _, err := snapshot.ImportSnapshot(snapshotFilePath, "", "", chain, db, ledger)
+		if err != nil {
+			return err
+		}
+		snapshotBlock, err = chain.FindBlock(snapshotBlockHeader.Hash())
+		if err != nil {
+			return err
+		}
+		if res := ledger.ResetState(snapshotBlock.Block); res.IsError() {
+			return fmt.Errorf("Failed to reset the ledger state: %v", res.Message)
+		}
+		state := cons.State()
+		if err = state.SetLastFinalizedBlock(snapshotBlock); err != nil {
+			return err
+		}
+		state.SetHighestCCBlock(snapshotBlock)
+		state.SetLastVote(core.Vote{})
+		state.SetLastProposal(core.Proposal{})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshotBlock, nil
+}
+
+// newLightVerifier creates the light verifier from the genesis block in the metadata of the
+// local snapshot, and advances it to the snapshot block.
+func newLightVerifier(snapshotFilePath string, db database.Database) (*snapshot.LightVerifier, error) {
+	metadata, err := snapshot.ReadSnapshotMetadata(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.ProofTrios) == 0 {
+		return nil, fmt.Errorf("Snapshot %v has no validator set change proofs", snapshotFilePath)
+	}
+	verifier, err := snapshot.NewLightVerifier(metadata.ProofTrios[0].Second.Header, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = verifier.VerifyMetadata(metadata); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
 // Start starts sub components and kick off the main loop.
+// newProposerSelector creates the selector of the proposer selection strategy set in the genesis.
+// The strategy is read from the state of the last finalized block, the older states may have been
+// pruned.
+func newProposerSelector(chain *blockchain.Chain, lfb *core.ExtendedBlock, db database.Database) (consensus.ProposerSelector, error) {
+	selection := st.NewStoreView(lfb.Height, lfb.StateHash, db).GetProposerSelection()
+	if selection == nil {
+		selection = core.DefaultProposerSelection()
+	}
+	log.Printf("Proposer selection: %v", selection)
+	return consensus.NewProposerSelector(selection, chain)
+}
+
 func (n *Node) Start(ctx context.Context) {
 	c, cancel := context.WithCancel(ctx)
 	n.ctx = c
@@ -136,6 +293,15 @@ func (n *Node) Start(ctx context.Context) {
 	n.Mempool.Start(n.ctx)
 	n.reporter.Start(n.ctx)
 
+	if n.SnapshotScheduler != nil {
+		if err := n.SnapshotScheduler.Start(n.ctx); err != nil {
+			log.Fatalf("Failed to start the snapshot scheduler: %v", err)
+		}
+	}
+	if n.OrphanPruner != nil {
+		n.OrphanPruner.Start(n.ctx)
+	}
+
 	if viper.GetBool(common.CfgRPCEnabled) {
 		n.RPC.Start(n.ctx)
 	}
@@ -150,6 +316,12 @@ func (n *Node) Stop() {
 func (n *Node) Wait() {
 	n.Consensus.Wait()
 	n.SyncManager.Wait()
+	if n.SnapshotScheduler != nil {
+		n.SnapshotScheduler.Wait()
+	}
+	if n.OrphanPruner != nil {
+		n.OrphanPruner.Wait()
+	}
 	if n.RPC != nil {
 		n.RPC.Wait()
 	}
@@ -112,6 +112,8 @@ func CreateConnection(netconn net.Conn, config ConnectionConfig) *Connection {
 	channelNATMapping := createDefaultChannel(common.ChannelIDNATMapping)
 	channelEliteEdgeNodeVote := createDefaultChannel(common.ChannelIDEliteEdgeNodeVote)
 	channelEliteAggregatedEdgeNodeVotes := createDefaultChannel(common.ChannelIDAggregatedEliteEdgeNodeVotes)
+	channelSnapshot := createDefaultChannel(common.ChannelIDSnapshot)
+	channelEvidence := createDefaultChannel(common.ChannelIDEvidence)
 	channels := []*Channel{
 		&channelCheckpoint,
 		&channelHeader,
@@ -125,6 +127,8 @@ func CreateConnection(netconn net.Conn, config ConnectionConfig) *Connection {
 		&channelNATMapping,
 		&channelEliteEdgeNodeVote,
 		&channelEliteAggregatedEdgeNodeVotes,
+		&channelSnapshot,
+		&channelEvidence,
 	}
 
 	success, channelGroup := createChannelGroup(getDefaultChannelGroupConfig(), channels)
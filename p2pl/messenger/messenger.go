@@ -697,7 +697,7 @@ func (msgr *Messenger) printStats() {
 	defer msgr.statsLock.Unlock()
 
 	ret := "Received bytes:"
-	for k := byte(0); k <= byte(common.ChannelIDAggregatedEliteEdgeNodeVotes); k++ {
+	for k := byte(0); k <= byte(common.ChannelIDEvidence); k++ {
 		v, ok := msgr.statsCounter[common.ChannelIDEnum(k)]
 		if !ok {
 			continue
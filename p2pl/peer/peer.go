@@ -32,6 +32,8 @@ var Channels = []cmn.ChannelIDEnum{
 	cmn.ChannelIDGuardian,
 	cmn.ChannelIDEliteEdgeNodeVote,
 	cmn.ChannelIDAggregatedEliteEdgeNodeVotes,
+	cmn.ChannelIDSnapshot,
+	cmn.ChannelIDEvidence,
 }
 
 //
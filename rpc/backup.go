@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"fmt"
+	"math/big"
 	"os"
 	"path"
 
@@ -11,9 +13,11 @@ import (
 // ------------------------------- BackupSnapshot -----------------------------------
 
 type BackupSnapshotArgs struct {
-	Config  string `json:"config"`
-	Height  uint64 `json:"height"`
-	Version uint64 `json:"version"`
+	Config        string          `json:"config"`
+	Height        uint64          `json:"height"`
+	Version       uint64          `json:"version"`
+	PruneDust     bool            `json:"prune_dust"`     // V2 only
+	DustThreshold *common.JSONBig `json:"dust_threshold"` // in TFuel wei
 }
 
 type BackupSnapshotResult struct {
@@ -36,7 +40,11 @@ func (t *ThetaRPCService) BackupSnapshot(args *BackupSnapshotArgs, result *Backu
 	}
 
 	if args.Version == 2 {
-		snapshotFile, err := snapshot.ExportSnapshotV2(db, consensus, chain, snapshotDir, args.Height)
+		opts := &snapshot.ExportSnapshotOptions{
+			PruneDust:     args.PruneDust,
+			DustThreshold: (*big.Int)(args.DustThreshold),
+		}
+		snapshotFile, err := snapshot.ExportSnapshotV2WithOptions(db, consensus, chain, snapshotDir, args.Height, opts)
 		result.SnapshotFile = snapshotFile
 		return err
 	} else if args.Version == 3 {
@@ -50,6 +58,29 @@ func (t *ThetaRPCService) BackupSnapshot(args *BackupSnapshotArgs, result *Backu
 	return err
 }
 
+// ------------------------------- GetLatestSnapshot -----------------------------------
+
+type GetLatestSnapshotArgs struct{}
+
+type GetLatestSnapshotResult struct {
+	SnapshotFile string            `json:"snapshot_file"`
+	Height       common.JSONUint64 `json:"height"`
+}
+
+// GetLatestSnapshot returns the latest snapshot exported by the snapshot scheduler.
+func (t *ThetaRPCService) GetLatestSnapshot(args *GetLatestSnapshotArgs, result *GetLatestSnapshotResult) error {
+	if t.snapshotScheduler == nil {
+		return fmt.Errorf("Snapshot scheduling is not enabled")
+	}
+	snapshotFile, height := t.snapshotScheduler.LatestSnapshot()
+	if snapshotFile == "" {
+		return fmt.Errorf("No snapshot has been exported yet")
+	}
+	result.SnapshotFile = snapshotFile
+	result.Height = common.JSONUint64(height)
+	return nil
+}
+
 // ------------------------------- BackupChain -----------------------------------
 
 type BackupChainArgs struct {
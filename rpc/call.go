@@ -3,6 +3,7 @@ package rpc
 import (
 	"encoding/hex"
 	"fmt"
+	"math/big"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/ledger/state"
@@ -33,35 +34,90 @@ func (t *ThetaRPCService) CallSmartContract(args *CallSmartContractArgs, result
 		return err
 	}
 
-	blockHeight := ledgerState.Height() + 1 // the view points to the parent of the current block
-	if blockHeight < common.HeightEnableSmartContract {
-		return fmt.Errorf("Smart contract feature not enabled until block height %v.", common.HeightEnableSmartContract)
+	sctx, err := parseSmartContractTx(ledgerState, args.SctxBytes)
+	if err != nil {
+		return err
 	}
 
-	sctxBytes, err := hex.DecodeString(args.SctxBytes)
+	parentBlock := t.ledger.State().ParentBlock()
+	vmRet, contractAddr, gasUsed, vmErr := vm.Execute(parentBlock, sctx, ledgerState)
+	ledgerState.Save()
+
+	result.VmReturn = hex.EncodeToString(vmRet)
+	result.ContractAddress = contractAddr
+	result.GasUsed = common.JSONUint64(gasUsed)
+	if vmErr != nil {
+		result.VmError = vmErr.Error()
+	}
+
+	return nil
+}
+
+// ------------------------------- EstimateGas -----------------------------------
+
+type EstimateGasArgs struct {
+	SctxBytes string `json:"sctx_bytes"`
+}
+
+type EstimateGasResult struct {
+	GasEstimate     common.JSONUint64 `json:"gas_estimate"`
+	MinimumGasPrice *common.JSONBig   `json:"minimum_gas_price"` // in TFuelWei
+	MinimumFee      *common.JSONBig   `json:"minimum_fee"`       // in TFuelWei
+	VmReturn        string            `json:"vm_return"`
+	VmError         string            `json:"vm_error"`
+}
+
+// EstimateGas returns the lowest gas limit the smart contract transaction succeeds with against
+// the latest state, up to the gas limit of the transaction, or the max gas limit if not set, and
+// the fee of that gas at the minimum gas price. Like CallSmartContract, it does NOT modify the
+// consensus state.
+func (t *ThetaRPCService) EstimateGas(args *EstimateGasArgs, result *EstimateGasResult) (err error) {
+	ledgerState, err := t.ledger.GetDeliveredSnapshot()
 	if err != nil {
 		return err
 	}
 
-	tx, err := types.TxFromBytes(sctxBytes)
+	sctx, err := parseSmartContractTx(ledgerState, args.SctxBytes)
 	if err != nil {
-		return fmt.Errorf("Failed to parse SmartContractTx, error: %v", err)
-	}
-	sctx, ok := tx.(*types.SmartContractTx)
-	if !ok {
-		return fmt.Errorf("Failed to parse SmartContractTx: %v", args.SctxBytes)
+		return err
 	}
 
 	parentBlock := t.ledger.State().ParentBlock()
-	vmRet, contractAddr, gasUsed, vmErr := vm.Execute(parentBlock, sctx, ledgerState)
-	ledgerState.Save()
+	gasLimit, vmRet, vmErr := vm.EstimateGas(parentBlock, sctx, ledgerState)
 
 	result.VmReturn = hex.EncodeToString(vmRet)
-	result.ContractAddress = contractAddr
-	result.GasUsed = common.JSONUint64(gasUsed)
 	if vmErr != nil {
 		result.VmError = vmErr.Error()
+		return nil
 	}
+	minimumGasPrice := types.GetMinimumGasPrice(ledgerState.Height() + 1)
+	result.GasEstimate = common.JSONUint64(gasLimit)
+	result.MinimumGasPrice = (*common.JSONBig)(minimumGasPrice)
+	result.MinimumFee = (*common.JSONBig)(new(big.Int).Mul(minimumGasPrice, new(big.Int).SetUint64(gasLimit)))
 
 	return nil
 }
+
+// parseSmartContractTx parses the hex encoded smart contract transaction to execute on top of
+// the ledger state.
+func parseSmartContractTx(ledgerState *state.StoreView, sctxHex string) (*types.SmartContractTx, error) {
+	blockHeight := ledgerState.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableSmartContract {
+		return nil, fmt.Errorf("Smart contract feature not enabled until block height %v.", common.HeightEnableSmartContract)
+	}
+
+	sctxBytes, err := hex.DecodeString(sctxHex)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := types.TxFromBytes(sctxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse SmartContractTx, error: %v", err)
+	}
+	sctx, ok := tx.(*types.SmartContractTx)
+	if !ok {
+		return nil, fmt.Errorf("Failed to parse SmartContractTx: %v", sctxHex)
+	}
+	return sctx, nil
+}
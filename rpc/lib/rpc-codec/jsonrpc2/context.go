@@ -28,3 +28,20 @@ func (c *Ctx) Context() context.Context {
 func (c *Ctx) SetContext(ctx context.Context) {
 	c.ctx = ctx
 }
+
+type methodFilterKey struct{}
+
+// WithMethodFilter returns a context making the server codecs created with it, including the
+// ones processing batch requests, reply with a "method not found" error to the requests of
+// the methods for which filter returns false.
+func WithMethodFilter(ctx context.Context, filter func(method string) bool) context.Context {
+	return context.WithValue(ctx, methodFilterKey{}, filter)
+}
+
+func methodFilterFromContext(ctx context.Context) func(method string) bool {
+	if ctx == nil {
+		return nil
+	}
+	filter, _ := ctx.Value(methodFilterKey{}).(func(method string) bool)
+	return filter
+}
@@ -46,6 +46,7 @@ func (conn *httpServerConn) Close() error {
 
 type httpHandler struct {
 	rpc *rpc.Server
+	ctx context.Context
 }
 
 // HTTPHandler returns handler for HTTP requests which will execute
@@ -55,10 +56,16 @@ type httpHandler struct {
 //
 // Specification: http://www.simple-is-better.org/json-rpc/transport_http.html
 func HTTPHandler(srv *rpc.Server) http.Handler {
+	return HTTPHandlerContext(context.Background(), srv)
+}
+
+// HTTPHandlerContext is HTTPHandler with given context as the parent of
+// the request contexts.
+func HTTPHandlerContext(ctx context.Context, srv *rpc.Server) http.Handler {
 	if srv == nil {
 		srv = rpc.DefaultServer
 	}
-	return &httpHandler{srv}
+	return &httpHandler{srv, ctx}
 }
 
 func (h *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -74,7 +81,7 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(context.Background(), httpRequestContextKey, req)
+	ctx := context.WithValue(h.ctx, httpRequestContextKey, req)
 	conn := &httpServerConn{req: req.Body, res: w}
 	_ = h.rpc.ServeRequest(NewServerCodecContext(ctx, conn, h.rpc))
 	if !conn.replied {
@@ -3,6 +3,7 @@ package jsonrpc2_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -105,6 +106,22 @@ func TestHTTPServer(t *testing.T) {
 	}
 }
 
+func TestHTTPServerMethodFilter(t *testing.T) {
+	ctx := jsonrpc2.WithMethodFilter(context.Background(), func(method string) bool {
+		return method != "Svc.Sum"
+	})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandlerContext(ctx, nil))
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+
+	var got int
+	err := jsonrpc2.ServerError(client.Call("Svc.Sum", [2]int{1, 2}, &got))
+	if err == nil || err.Code != -32601 || !strings.Contains(err.Message, "disabled") {
+		t.Errorf("Call(Svc.Sum), err = %v, want a disabled method error", err)
+	}
+}
+
 func TestHTTPClient(t *testing.T) {
 	ts := httptest.NewServer(jsonrpc2.HTTPHandler(nil))
 	defer ts.Close()
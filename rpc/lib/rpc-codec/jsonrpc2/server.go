@@ -170,6 +170,10 @@ func (c *serverCodec) ReadRequestHeader(r *rpc.Request) (err error) {
 	}
 
 	r.ServiceMethod = c.req.Method
+	if filter := methodFilterFromContext(c.ctx); filter != nil && c.req.Method != batchMethod && !filter(c.req.Method) {
+		// Not registered, the server replies "rpc: can't find method <method> (disabled)".
+		r.ServiceMethod = c.req.Method + " (disabled)"
+	}
 
 	// JSON request id can be any JSON value;
 	// RPC package expects uint64.  Translate to
@@ -16,11 +16,14 @@ import (
 	"github.com/thetatoken/theta/crypto/bls"
 
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/mempool"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/snapshot"
 	"github.com/thetatoken/theta/version"
 )
 
@@ -116,6 +119,276 @@ func (t *ThetaRPCService) GetAccount(args *GetAccountArgs, result *GetAccountRes
 	return nil
 }
 
+// ------------------------------- GetStateProof -----------------------------------
+
+type GetStateProofArgs struct {
+	Address    string            `json:"address"`     // the account to prove
+	StorageKey string            `json:"storage_key"` // the storage slot of the account to prove, optional
+	Key        string            `json:"key"`         // the hex encoded state key to prove instead of an account
+	Height     common.JSONUint64 `json:"height"`      // the height of the finalized block, default: the latest
+}
+
+type GetStateProofResult struct {
+	Height       common.JSONUint64 `json:"height"`
+	BlockHash    common.Hash       `json:"block_hash"`
+	StateHash    common.Hash       `json:"state_hash"`
+	Key          string            `json:"key"`
+	Value        string            `json:"value"` // empty if the key is not set
+	Proof        string            `json:"proof"` // the RLP encoded core.VCPProof
+	StorageRoot  *common.Hash      `json:"storage_root,omitempty"`
+	StorageValue *common.Hash      `json:"storage_value,omitempty"`
+	StorageProof string            `json:"storage_proof,omitempty"` // the RLP encoded core.VCPProof
+}
+
+func (t *ThetaRPCService) GetStateProof(args *GetStateProofArgs, result *GetStateProofResult) (err error) {
+	var key common.Bytes
+	if args.Key != "" {
+		if args.StorageKey != "" {
+			return errors.New("Storage key requires an address instead of a state key")
+		}
+		if key, err = hex.DecodeString(strings.TrimPrefix(args.Key, "0x")); err != nil {
+			return fmt.Errorf("Invalid state key: %v", err)
+		}
+	} else if args.Address != "" {
+		key = state.AccountKey(common.HexToAddress(args.Address))
+	} else {
+		return errors.New("Address or state key must be specified")
+	}
+
+	block, sv, err := t.finalizedStateAtHeight(uint64(args.Height))
+	if err != nil {
+		return err
+	}
+
+	proof, err := sv.GetProof(key)
+	if err != nil {
+		return err
+	}
+	raw, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		return err
+	}
+	result.Height = common.JSONUint64(block.Height)
+	result.BlockHash = block.Hash()
+	result.StateHash = block.StateHash
+	result.Key = hex.EncodeToString(key)
+	result.Value = hex.EncodeToString(sv.Get(key))
+	result.Proof = hex.EncodeToString(raw)
+
+	if args.StorageKey == "" {
+		return nil
+	}
+	address := common.HexToAddress(args.Address)
+	account := sv.GetAccount(address)
+	if account == nil {
+		return fmt.Errorf("Account with address %v is not found", address.Hex())
+	}
+	storageKey := common.HexToHash(args.StorageKey)
+	storageProof, err := sv.GetStorageProof(address, storageKey)
+	if err != nil {
+		return err
+	}
+	if raw, err = rlp.EncodeToBytes(storageProof); err != nil {
+		return err
+	}
+	storageValue := sv.GetState(address, storageKey)
+	result.StorageRoot = &account.Root
+	result.StorageValue = &storageValue
+	result.StorageProof = hex.EncodeToString(raw)
+	return nil
+}
+
+// ------------------------------- GetStateDiff -----------------------------------
+
+const maxStateDiffLimit = 1000
+
+type GetStateDiffArgs struct {
+	FromHeight common.JSONUint64 `json:"from_height"` // default: the height before to_height
+	ToHeight   common.JSONUint64 `json:"to_height"`
+	Limit      common.JSONUint64 `json:"limit"` // max number of changes, default and max: 1000
+}
+
+type StateDiffResult struct {
+	Type     string          `json:"type"` // added, removed or modified
+	Key      string          `json:"key"`
+	Account  *common.Address `json:"account,omitempty"` // the owner of a storage slot
+	OldValue string          `json:"old_value"`
+	NewValue string          `json:"new_value"`
+}
+
+type GetStateDiffResult struct {
+	FromHeight    common.JSONUint64  `json:"from_height"`
+	FromStateHash common.Hash        `json:"from_state_hash"`
+	ToHeight      common.JSONUint64  `json:"to_height"`
+	ToStateHash   common.Hash        `json:"to_state_hash"`
+	Changes       []*StateDiffResult `json:"changes"`
+	Truncated     bool               `json:"truncated"` // more changes than the limit
+}
+
+func (t *ThetaRPCService) GetStateDiff(args *GetStateDiffArgs, result *GetStateDiffResult) (err error) {
+	toHeight := uint64(args.ToHeight)
+	if toHeight == 0 {
+		return errors.New("To height must be specified")
+	}
+	fromHeight := toHeight - 1
+	if args.FromHeight != 0 {
+		fromHeight = uint64(args.FromHeight)
+	}
+	limit := uint64(args.Limit)
+	if limit == 0 || limit > maxStateDiffLimit {
+		limit = maxStateDiffLimit
+	}
+
+	fromBlock := t.finalizedBlockAtHeight(fromHeight)
+	if fromBlock == nil {
+		return fmt.Errorf("Finalized block at height %v is not found", fromHeight)
+	}
+	toBlock := t.finalizedBlockAtHeight(toHeight)
+	if toBlock == nil {
+		return fmt.Errorf("Finalized block at height %v is not found", toHeight)
+	}
+
+	deliveredView, err := t.ledger.GetDeliveredSnapshot()
+	if err != nil {
+		return err
+	}
+	result.Changes = []*StateDiffResult{}
+	err = state.Diff(deliveredView.GetDB(), fromBlock.StateHash, toBlock.StateHash, func(diff *state.StateDiff) bool {
+		if uint64(len(result.Changes)) >= limit {
+			result.Truncated = true
+			return false
+		}
+		change := &StateDiffResult{
+			Type:     "modified",
+			Key:      hex.EncodeToString(diff.Key),
+			OldValue: hex.EncodeToString(diff.OldValue),
+			NewValue: hex.EncodeToString(diff.NewValue),
+		}
+		if diff.OldValue == nil {
+			change.Type = "added"
+		} else if diff.NewValue == nil {
+			change.Type = "removed"
+		}
+		if diff.Storage {
+			account := diff.Account
+			change.Account = &account
+		}
+		result.Changes = append(result.Changes, change)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to compare the states, they might have been pruned: %v", err)
+	}
+	result.FromHeight = common.JSONUint64(fromHeight)
+	result.FromStateHash = fromBlock.StateHash
+	result.ToHeight = common.JSONUint64(toHeight)
+	result.ToStateHash = toBlock.StateHash
+	return nil
+}
+
+// ------------------------------- GetAccountStorage -----------------------------------
+
+const maxAccountStorageLimit = 1000
+
+type GetAccountStorageArgs struct {
+	Address string            `json:"address"`
+	Prefix  string            `json:"prefix"` // hex encoded prefix of the slot keys, optional
+	Start   string            `json:"start"`  // the slot key to start from, e.g. the next_key of the previous call
+	Limit   common.JSONUint64 `json:"limit"`  // max number of slots, default and max: 1000
+	Height  common.JSONUint64 `json:"height"` // the height of the finalized block, default: the latest
+}
+
+type StorageSlotResult struct {
+	Key   common.Hash `json:"key"`
+	Value common.Hash `json:"value"`
+}
+
+type GetAccountStorageResult struct {
+	Height      common.JSONUint64    `json:"height"`
+	StateHash   common.Hash          `json:"state_hash"`
+	StorageRoot common.Hash          `json:"storage_root"`
+	Slots       []*StorageSlotResult `json:"slots"`
+	NextKey     *common.Hash         `json:"next_key,omitempty"` // set if there are more slots
+}
+
+func (t *ThetaRPCService) GetAccountStorage(args *GetAccountStorageArgs, result *GetAccountStorageResult) (err error) {
+	if args.Address == "" {
+		return errors.New("Address must be specified")
+	}
+	address := common.HexToAddress(args.Address)
+	prefix, err := hex.DecodeString(strings.TrimPrefix(args.Prefix, "0x"))
+	if err != nil {
+		return fmt.Errorf("Invalid prefix: %v", err)
+	}
+	var start common.Bytes
+	if args.Start != "" {
+		startKey := common.HexToHash(args.Start)
+		start = startKey[:]
+	}
+	limit := int(args.Limit)
+	if limit <= 0 || limit > maxAccountStorageLimit {
+		limit = maxAccountStorageLimit
+	}
+
+	block, sv, err := t.finalizedStateAtHeight(uint64(args.Height))
+	if err != nil {
+		return err
+	}
+	account := sv.GetAccount(address)
+	if account == nil {
+		return fmt.Errorf("Account with address %v is not found", address.Hex())
+	}
+
+	result.Slots = []*StorageSlotResult{}
+	err = sv.IterateAccountStorageFrom(address, prefix, start, func(key, value common.Hash) bool {
+		if len(result.Slots) >= limit {
+			result.NextKey = &key
+			return false
+		}
+		result.Slots = append(result.Slots, &StorageSlotResult{Key: key, Value: value})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	result.Height = common.JSONUint64(block.Height)
+	result.StateHash = block.StateHash
+	result.StorageRoot = account.Root
+	return nil
+}
+
+// finalizedBlockAtHeight returns the finalized block at the height, or the latest finalized
+// block for height 0, nil if not found.
+func (t *ThetaRPCService) finalizedBlockAtHeight(height uint64) *core.ExtendedBlock {
+	if height == 0 {
+		return t.consensus.GetLastFinalizedBlock()
+	}
+	for _, b := range t.chain.FindBlocksByHeight(height) {
+		if b.Status.IsFinalized() {
+			return b
+		}
+	}
+	return nil
+}
+
+// finalizedStateAtHeight returns the finalized block at the height like finalizedBlockAtHeight,
+// and a view of its state.
+func (t *ThetaRPCService) finalizedStateAtHeight(height uint64) (*core.ExtendedBlock, *state.StoreView, error) {
+	block := t.finalizedBlockAtHeight(height)
+	if block == nil {
+		return nil, nil, fmt.Errorf("Finalized block at height %v is not found", height)
+	}
+	deliveredView, err := t.ledger.GetDeliveredSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	sv := state.NewStoreView(block.Height, block.StateHash, deliveredView.GetDB())
+	if sv == nil { // might have been pruned
+		return nil, nil, fmt.Errorf("the state for height %v is not available, it might have been pruned", block.Height)
+	}
+	return block, sv, nil
+}
+
 // ------------------------------- GetSplitRule -----------------------------------
 
 type GetSplitRuleArgs struct {
@@ -162,6 +435,7 @@ const (
 	TxStatusPending   = "pending"
 	TxStatusFinalized = "finalized"
 	TxStatusAbandoned = "abandoned"
+	TxStatusOrphaned  = "orphaned"
 )
 
 func (t *ThetaRPCService) GetTransaction(args *GetTransactionArgs, result *GetTransactionResult) (err error) {
@@ -189,6 +463,8 @@ func (t *ThetaRPCService) GetTransaction(args *GetTransactionArgs, result *GetTr
 
 	if block.Status.IsFinalized() {
 		result.Status = TxStatusFinalized
+	} else if t.chain.IsTxOrphaned(hash) {
+		result.Status = TxStatusOrphaned
 	} else {
 		result.Status = TxStatusPending
 	}
@@ -216,6 +492,288 @@ func (t *ThetaRPCService) GetTransaction(args *GetTransactionArgs, result *GetTr
 	return nil
 }
 
+// ------------------------------ GetTransactionOccurrences -----------------------------------
+
+type GetTransactionOccurrencesArgs struct {
+	Hash string `json:"hash"`
+}
+
+type TransactionOccurrence struct {
+	BlockHash   common.Hash       `json:"block_hash"`
+	BlockHeight common.JSONUint64 `json:"block_height"`
+	Index       common.JSONUint64 `json:"index"`
+	Status      TxStatus          `json:"status"`
+}
+
+type GetTransactionOccurrencesResult struct {
+	Occurrences []*TransactionOccurrence `json:"occurrences"`
+}
+
+// GetTransactionOccurrences returns every block including the transaction. It requires the
+// all-occurrences tx index policy.
+func (t *ThetaRPCService) GetTransactionOccurrences(args *GetTransactionOccurrencesArgs, result *GetTransactionOccurrencesResult) (err error) {
+	if args.Hash == "" {
+		return errors.New("Transanction hash must be specified")
+	}
+	entries, err := t.chain.FindTxOccurrences(common.HexToHash(args.Hash))
+	if err != nil {
+		return err
+	}
+
+	finalizedHeight := t.chain.FinalizedHeight()
+	result.Occurrences = []*TransactionOccurrence{}
+	for _, entry := range entries {
+		block, err := t.chain.FindBlock(entry.BlockHash)
+		if err != nil {
+			return fmt.Errorf("Failed to find block %v: %v", entry.BlockHash.Hex(), err)
+		}
+		occurrence := &TransactionOccurrence{
+			BlockHash:   entry.BlockHash,
+			BlockHeight: common.JSONUint64(entry.BlockHeight),
+			Index:       common.JSONUint64(entry.Index),
+		}
+		if block.Status.IsFinalized() {
+			occurrence.Status = TxStatusFinalized
+		} else if block.Height <= finalizedHeight {
+			occurrence.Status = TxStatusOrphaned
+		} else {
+			occurrence.Status = TxStatusPending
+		}
+		result.Occurrences = append(result.Occurrences, occurrence)
+	}
+	return nil
+}
+
+// ------------------------------ GetTxReceipt -----------------------------------
+
+type GetTxReceiptArgs struct {
+	Hash string `json:"hash"`
+}
+
+type GetTxReceiptResult struct {
+	BlockHash       common.Hash                `json:"block_hash"`
+	BlockHeight     common.JSONUint64          `json:"block_height"`
+	TxHash          common.Hash                `json:"hash"`
+	Status          blockchain.TxReceiptStatus `json:"status"`
+	GasUsed         common.JSONUint64          `json:"gas_used"`
+	ContractAddress common.Address             `json:"contract_address"`
+	Logs            []*types.Log               `json:"logs"`
+	EvmRet          common.Bytes               `json:"evm_ret"`
+	EvmErr          string                     `json:"evm_err"`
+}
+
+func (t *ThetaRPCService) GetTxReceipt(args *GetTxReceiptArgs, result *GetTxReceiptResult) (err error) {
+	if args.Hash == "" {
+		return errors.New("Transanction hash must be specified")
+	}
+	receipt, block, err := t.chain.GetTxReceipt(common.HexToHash(args.Hash))
+	if err != nil {
+		return err
+	}
+	result.BlockHash = block.Hash()
+	result.BlockHeight = common.JSONUint64(block.Height)
+	result.TxHash = receipt.TxHash
+	result.Status = receipt.Status()
+	result.GasUsed = common.JSONUint64(receipt.GasUsed)
+	result.ContractAddress = receipt.ContractAddress
+	result.Logs = receipt.Logs
+	result.EvmRet = receipt.EvmRet
+	result.EvmErr = receipt.EvmErr
+	return nil
+}
+
+// ------------------------------ GetTransactionsByAddress -----------------------------------
+
+const maxTxsByAddressLimit = 1000
+
+type GetTransactionsByAddressArgs struct {
+	Address     string            `json:"address"`
+	StartHeight common.JSONUint64 `json:"start_height"`
+	Limit       common.JSONUint64 `json:"limit"` // default and max: 1000
+}
+
+type AddressTransaction struct {
+	BlockHash   common.Hash       `json:"block_hash"`
+	BlockHeight common.JSONUint64 `json:"block_height"`
+	TxHash      common.Hash       `json:"hash"`
+	Type        byte              `json:"type"`
+	Tx          types.Tx          `json:"transaction"`
+}
+
+type GetTransactionsByAddressResult struct {
+	Txs        []*AddressTransaction `json:"transactions"`
+	NextHeight common.JSONUint64     `json:"next_height"` // start height of the next page, 0 if none
+}
+
+func (t *ThetaRPCService) GetTransactionsByAddress(args *GetTransactionsByAddressArgs, result *GetTransactionsByAddressResult) (err error) {
+	if args.Address == "" {
+		return errors.New("Address must be specified")
+	}
+	limit := int(args.Limit)
+	if limit == 0 || limit > maxTxsByAddressLimit {
+		limit = maxTxsByAddressLimit
+	}
+
+	entries, nextHeight, err := t.chain.GetTxsByAddress(common.HexToAddress(args.Address), uint64(args.StartHeight), limit)
+	if err != nil {
+		return err
+	}
+	result.NextHeight = common.JSONUint64(nextHeight)
+	result.Txs = []*AddressTransaction{}
+
+	var block *core.ExtendedBlock
+	for _, entry := range entries {
+		if block == nil || block.Hash() != entry.BlockHash {
+			block, err = t.chain.FindBlock(entry.BlockHash)
+			if err != nil {
+				return fmt.Errorf("Failed to find block %v: %v", entry.BlockHash.Hex(), err)
+			}
+		}
+		tx, err := types.TxFromBytes(block.Txs[entry.Index])
+		if err != nil {
+			return err
+		}
+		result.Txs = append(result.Txs, &AddressTransaction{
+			BlockHash:   entry.BlockHash,
+			BlockHeight: common.JSONUint64(entry.BlockHeight),
+			TxHash:      entry.TxHash,
+			Type:        getTxType(tx),
+			Tx:          tx,
+		})
+	}
+	return nil
+}
+
+// ------------------------------ GetInternalTransactions -----------------------------------
+
+type GetInternalTransactionsByBlockArgs struct {
+	BlockHash common.Hash `json:"block_hash"`
+}
+
+type GetInternalTransactionsByAddressArgs struct {
+	Address     string            `json:"address"`
+	StartHeight common.JSONUint64 `json:"start_height"`
+	Limit       common.JSONUint64 `json:"limit"` // default and max: 1000
+}
+
+type InternalTransaction struct {
+	BlockHash   common.Hash          `json:"block_hash"`
+	BlockHeight common.JSONUint64    `json:"block_height"`
+	TxHash      common.Hash          `json:"hash"`
+	Type        types.InternalTxType `json:"type"`
+	From        common.Address       `json:"from"`
+	To          common.Address       `json:"to"`
+	Coins       types.CoinsJSON      `json:"coins"`
+	Depth       common.JSONUint64    `json:"depth"`
+}
+
+type GetInternalTransactionsResult struct {
+	Txs        []*InternalTransaction `json:"transactions"`
+	NextHeight common.JSONUint64      `json:"next_height"` // start height of the next page, 0 if none
+}
+
+func (t *ThetaRPCService) GetInternalTransactionsByBlock(args *GetInternalTransactionsByBlockArgs, result *GetInternalTransactionsResult) (err error) {
+	if args.BlockHash.IsEmpty() {
+		return errors.New("Block hash must be specified")
+	}
+	entries, err := t.chain.GetInternalTxsByBlock(args.BlockHash)
+	if err != nil {
+		return err
+	}
+	result.Txs = newInternalTransactions(entries)
+	return nil
+}
+
+func (t *ThetaRPCService) GetInternalTransactionsByAddress(args *GetInternalTransactionsByAddressArgs, result *GetInternalTransactionsResult) (err error) {
+	if args.Address == "" {
+		return errors.New("Address must be specified")
+	}
+	limit := int(args.Limit)
+	if limit == 0 || limit > maxTxsByAddressLimit {
+		limit = maxTxsByAddressLimit
+	}
+
+	entries, nextHeight, err := t.chain.GetInternalTxsByAddress(common.HexToAddress(args.Address), uint64(args.StartHeight), limit)
+	if err != nil {
+		return err
+	}
+	result.Txs = newInternalTransactions(entries)
+	result.NextHeight = common.JSONUint64(nextHeight)
+	return nil
+}
+
+func newInternalTransactions(entries []*blockchain.InternalTxEntry) []*InternalTransaction {
+	txs := []*InternalTransaction{}
+	for _, entry := range entries {
+		txs = append(txs, &InternalTransaction{
+			BlockHash:   entry.BlockHash,
+			BlockHeight: common.JSONUint64(entry.BlockHeight),
+			TxHash:      entry.TxHash,
+			Type:        entry.InternalTx.Type,
+			From:        entry.InternalTx.From,
+			To:          entry.InternalTx.To,
+			Coins:       types.NewCoinsJSON(entry.InternalTx.Coins),
+			Depth:       common.JSONUint64(entry.InternalTx.Depth),
+		})
+	}
+	return txs
+}
+
+// ------------------------------ GetLogs -----------------------------------
+
+const maxLogsHeightRange = 10000
+
+type GetLogsArgs struct {
+	FromHeight common.JSONUint64 `json:"from_height"`
+	ToHeight   common.JSONUint64 `json:"to_height"`
+	Addresses  []common.Address  `json:"addresses"`
+	Topics     [][]common.Hash   `json:"topics"`
+}
+
+type LogResult struct {
+	*types.Log
+	BlockHash   common.Hash       `json:"block_hash"`
+	BlockHeight common.JSONUint64 `json:"block_height"`
+	TxHash      common.Hash       `json:"transaction_hash"`
+	TxIndex     common.JSONUint64 `json:"transaction_index"`
+	LogIndex    common.JSONUint64 `json:"log_index"`
+}
+
+type GetLogsResult struct {
+	Logs []*LogResult `json:"logs"`
+}
+
+func (t *ThetaRPCService) GetLogs(args *GetLogsArgs, result *GetLogsResult) (err error) {
+	if args.ToHeight < args.FromHeight {
+		return errors.New("Starting height must not be greater than ending height")
+	}
+	if args.ToHeight-args.FromHeight >= maxLogsHeightRange {
+		return fmt.Errorf("Height range must be less than %v", maxLogsHeightRange)
+	}
+
+	logs, err := t.chain.GetLogs(&blockchain.LogFilter{
+		FromHeight: uint64(args.FromHeight),
+		ToHeight:   uint64(args.ToHeight),
+		Addresses:  args.Addresses,
+		Topics:     args.Topics,
+	})
+	if err != nil {
+		return err
+	}
+	result.Logs = []*LogResult{}
+	for _, filtered := range logs {
+		result.Logs = append(result.Logs, &LogResult{
+			Log:         filtered.Log,
+			BlockHash:   filtered.BlockHash,
+			BlockHeight: common.JSONUint64(filtered.BlockHeight),
+			TxHash:      filtered.TxHash,
+			TxIndex:     common.JSONUint64(filtered.TxIndex),
+			LogIndex:    common.JSONUint64(filtered.LogIndex),
+		})
+	}
+	return nil
+}
+
 // ------------------------------ GetPendingTransactions -----------------------------------
 
 type GetPendingTransactionsArgs struct {
@@ -294,6 +852,8 @@ const (
 	TxTypeWithdrawStake
 	TxTypeDepositStakeTxV2
 	TxTypeStakeRewardDistributionTx
+	TxTypeEvidenceTx
+	TxTypeRotateValidatorKeyTx
 )
 
 func (t *ThetaRPCService) GetBlock(args *GetBlockArgs, result *GetBlockResult) (err error) {
@@ -340,14 +900,9 @@ func (t *ThetaRPCService) GetBlockByHeight(args *GetBlockByHeightArgs, result *G
 	// }
 
 	blockHeight := uint64(args.Height)
-	blocks := t.chain.FindBlocksByHeight(blockHeight)
-
-	var block *core.ExtendedBlock
-	for _, b := range blocks {
-		if b.Status.IsFinalized() {
-			block = b
-			break
-		}
+	block, err := t.chain.FindFinalizedBlockByHeight(blockHeight)
+	if err != nil {
+		return err
 	}
 
 	if blockHeight == 0 && block == nil { // special handling for a node starting from a non-genesis snapshot
@@ -432,14 +987,9 @@ func (t *ThetaRPCService) GetBlocksByRange(args *GetBlocksByRangeArgs, result *G
 		return errors.New("Can't retrieve more than 100 blocks at a time")
 	}
 
-	blocks := t.chain.FindBlocksByHeight(uint64(args.End))
-
-	var block *core.ExtendedBlock
-	for _, b := range blocks {
-		if b.Status.IsFinalized() {
-			block = b
-			break
-		}
+	block, err := t.chain.FindFinalizedBlockByHeight(uint64(args.End))
+	if err != nil {
+		return err
 	}
 
 	if block == nil {
@@ -484,23 +1034,245 @@ func (t *ThetaRPCService) GetBlocksByRange(args *GetBlocksByRangeArgs, result *G
 	return
 }
 
+// ------------------------------ GetFinalityStatus -----------------------------------
+
+type GetFinalityStatusArgs struct {
+	Hash common.Hash `json:"hash"`
+}
+
+type GetFinalityStatusResult struct {
+	BlockHash   common.Hash               `json:"block_hash"`
+	BlockHeight common.JSONUint64         `json:"block_height"`
+	Status      blockchain.FinalityStatus `json:"status"`
+	FinalizedBy common.Hash               `json:"finalized_by"` // the directly finalized block finalizing the block
+}
+
+func (t *ThetaRPCService) GetFinalityStatus(args *GetFinalityStatusArgs, result *GetFinalityStatusResult) (err error) {
+	if args.Hash.IsEmpty() {
+		return errors.New("Block hash must be specified")
+	}
+	block, err := t.chain.FindBlock(args.Hash)
+	if err != nil {
+		return fmt.Errorf("Failed to find block %v: %v", args.Hash.Hex(), err)
+	}
+	status, finalizedBy, err := t.chain.GetFinalityStatus(args.Hash)
+	if err != nil {
+		return err
+	}
+	result.BlockHash = args.Hash
+	result.BlockHeight = common.JSONUint64(block.Height)
+	result.Status = status
+	result.FinalizedBy = finalizedBy
+	return nil
+}
+
+// ------------------------------ GetFinalityProof -----------------------------------
+
+type GetFinalityProofArgs struct {
+	Hash          common.Hash       `json:"hash"`
+	TrustedHeight common.JSONUint64 `json:"trusted_height"` // the height of the validator set the verifier trusts, default: genesis
+}
+
+type GetFinalityProofResult struct {
+	Hash          common.Hash       `json:"hash"`
+	Height        common.JSONUint64 `json:"height"`
+	TrustedHeight common.JSONUint64 `json:"trusted_height"`
+	NumProofTrios int               `json:"num_proof_trios"`
+	Proof         string            `json:"proof"` // the RLP encoded core.FinalityProof
+}
+
+func (t *ThetaRPCService) GetFinalityProof(args *GetFinalityProofArgs, result *GetFinalityProofResult) (err error) {
+	if args.Hash.IsEmpty() {
+		return errors.New("Block hash must be specified")
+	}
+	sv, err := t.ledger.GetFinalizedSnapshot()
+	if err != nil {
+		return err
+	}
+	proof, err := snapshot.BuildFinalityProof(t.chain, sv, args.Hash, uint64(args.TrustedHeight))
+	if err != nil {
+		return err
+	}
+	raw, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		return err
+	}
+	result.Hash = args.Hash
+	result.Height = common.JSONUint64(proof.Headers[0].Height)
+	result.TrustedHeight = args.TrustedHeight
+	result.NumProofTrios = len(proof.ProofTrios)
+	result.Proof = hex.EncodeToString(raw)
+	return nil
+}
+
+// ------------------------------ GetEvidence -----------------------------------
+
+const maxEvidenceLimit = 100
+
+type GetEvidenceArgs struct {
+	Hash     common.Hash       `json:"hash"`     // the evidence with the hash, if specified
+	Offender string            `json:"offender"` // all the evidence against the validator, if specified
+	Start    common.JSONUint64 `json:"start"`    // otherwise the evidence in the order it was received
+	Limit    common.JSONUint64 `json:"limit"`    // default and max: 100
+}
+
+type EvidenceResult struct {
+	Hash     common.Hash       `json:"hash"`
+	Type     string            `json:"type"`
+	Offender common.Address    `json:"offender"`
+	Height   common.JSONUint64 `json:"height"`
+	Epoch    common.JSONUint64 `json:"epoch"`
+	BlockA   common.Hash       `json:"block_a"`
+	BlockB   common.Hash       `json:"block_b"`
+	Raw      string            `json:"raw"` // the RLP encoded evidence, verifiable by anyone
+}
+
+type GetEvidenceResult struct {
+	Evidence []*EvidenceResult `json:"evidence"`
+	Next     common.JSONUint64 `json:"next"` // start of the next page, 0 if none
+}
+
+func (t *ThetaRPCService) GetEvidence(args *GetEvidenceArgs, result *GetEvidenceResult) (err error) {
+	var evidence []*core.Evidence
+	if !args.Hash.IsEmpty() {
+		ev, err := t.chain.FindEvidenceByHash(args.Hash)
+		if err != nil {
+			return fmt.Errorf("Failed to find evidence %v: %v", args.Hash.Hex(), err)
+		}
+		evidence = []*core.Evidence{ev}
+	} else if args.Offender != "" {
+		if evidence, err = t.chain.GetEvidenceByOffender(common.HexToAddress(args.Offender)); err != nil {
+			return err
+		}
+	} else {
+		limit := int(args.Limit)
+		if limit == 0 || limit > maxEvidenceLimit {
+			limit = maxEvidenceLimit
+		}
+		var next uint64
+		if evidence, next, err = t.chain.GetEvidence(uint64(args.Start), limit); err != nil {
+			return err
+		}
+		result.Next = common.JSONUint64(next)
+	}
+
+	result.Evidence = []*EvidenceResult{}
+	for _, ev := range evidence {
+		raw, err := rlp.EncodeToBytes(ev)
+		if err != nil {
+			return err
+		}
+		result.Evidence = append(result.Evidence, &EvidenceResult{
+			Hash:     ev.Hash(),
+			Type:     ev.Type.String(),
+			Offender: ev.Offender,
+			Height:   common.JSONUint64(ev.Height()),
+			Epoch:    common.JSONUint64(ev.Epoch()),
+			BlockA:   ev.HeaderA.Hash(),
+			BlockB:   ev.HeaderB.Hash(),
+			Raw:      hex.EncodeToString(raw),
+		})
+	}
+	return nil
+}
+
+// ------------------------------ GetBlockMetadata -----------------------------------
+
+type GetBlockMetadataArgs struct {
+	Hash   common.Hash       `json:"hash"`
+	Height common.JSONUint64 `json:"height"` // the finalized block at the height, if the hash is not specified
+}
+
+type ValidatorParticipation struct {
+	Address common.Address `json:"address"`
+	Voted   bool           `json:"voted"`
+}
+
+type BlockRewardResult struct {
+	Address common.Address  `json:"address"`
+	Coins   types.CoinsJSON `json:"coins"`
+}
+
+type GetBlockMetadataResult struct {
+	BlockHash   common.Hash               `json:"block_hash"`
+	BlockHeight common.JSONUint64         `json:"block_height"`
+	Proposer    common.Address            `json:"proposer"`
+	Validators  []*ValidatorParticipation `json:"validators"`
+	NumVoters   common.JSONUint64         `json:"num_voters"`
+	Rewards     []*BlockRewardResult      `json:"rewards"`
+}
+
+func (t *ThetaRPCService) GetBlockMetadata(args *GetBlockMetadataArgs, result *GetBlockMetadataResult) (err error) {
+	var block *core.ExtendedBlock
+	if args.Hash.IsEmpty() {
+		block, err = t.chain.FindFinalizedBlockByHeight(uint64(args.Height))
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("No finalized block at height %v", uint64(args.Height))
+		}
+	} else {
+		block, err = t.chain.FindBlock(args.Hash)
+		if err != nil {
+			return fmt.Errorf("Failed to find block %v: %v", args.Hash.Hex(), err)
+		}
+	}
+
+	metadata, err := t.chain.GetBlockMetadata(block.Hash())
+	if err != nil {
+		return err
+	}
+	result.BlockHash = block.Hash()
+	result.BlockHeight = common.JSONUint64(block.Height)
+	result.Proposer = metadata.Proposer
+	result.NumVoters = common.JSONUint64(metadata.NumVoters())
+	result.Validators = []*ValidatorParticipation{}
+	for _, address := range metadata.Validators {
+		result.Validators = append(result.Validators, &ValidatorParticipation{
+			Address: address,
+			Voted:   metadata.Voted(address),
+		})
+	}
+	result.Rewards = []*BlockRewardResult{}
+	for _, reward := range metadata.Rewards {
+		result.Rewards = append(result.Rewards, &BlockRewardResult{
+			Address: reward.Address,
+			Coins:   types.NewCoinsJSON(reward.Coins),
+		})
+	}
+	return nil
+}
+
 // ------------------------------ GetStatus -----------------------------------
 
 type GetStatusArgs struct{}
 
 type GetStatusResult struct {
-	Address                    string            `json:"address"`
-	ChainID                    string            `json:"chain_id"`
-	PeerID                     string            `json:"peer_id"`
-	LatestFinalizedBlockHash   common.Hash       `json:"latest_finalized_block_hash"`
-	LatestFinalizedBlockHeight common.JSONUint64 `json:"latest_finalized_block_height"`
-	LatestFinalizedBlockTime   *common.JSONBig   `json:"latest_finalized_block_time"`
-	LatestFinalizedBlockEpoch  common.JSONUint64 `json:"latest_finalized_block_epoch"`
-	CurrentEpoch               common.JSONUint64 `json:"current_epoch"`
-	CurrentHeight              common.JSONUint64 `json:"current_height"`
-	CurrentTime                *common.JSONBig   `json:"current_time"`
-	Syncing                    bool              `json:"syncing"`
-	GenesisBlockHash           common.Hash       `json:"genesis_block_hash"`
+	Address                    string              `json:"address"`
+	ChainID                    string              `json:"chain_id"`
+	PeerID                     string              `json:"peer_id"`
+	LatestFinalizedBlockHash   common.Hash         `json:"latest_finalized_block_hash"`
+	LatestFinalizedBlockHeight common.JSONUint64   `json:"latest_finalized_block_height"`
+	LatestFinalizedBlockTime   *common.JSONBig     `json:"latest_finalized_block_time"`
+	LatestFinalizedBlockEpoch  common.JSONUint64   `json:"latest_finalized_block_epoch"`
+	CurrentEpoch               common.JSONUint64   `json:"current_epoch"`
+	CurrentHeight              common.JSONUint64   `json:"current_height"`
+	CurrentTime                *common.JSONBig     `json:"current_time"`
+	Syncing                    bool                `json:"syncing"`
+	GenesisBlockHash           common.Hash         `json:"genesis_block_hash"`
+	SnapshotLoad               *SnapshotLoadStatus `json:"snapshot_load,omitempty"`
+}
+
+type SnapshotLoadStatus struct {
+	Operation           string            `json:"operation"`
+	Phase               string            `json:"phase"`
+	RecordsProcessed    common.JSONUint64 `json:"records_processed"`
+	BytesRead           common.JSONUint64 `json:"bytes_read"`
+	EstimatedTotalBytes common.JSONUint64 `json:"estimated_total_bytes"`
+	Percentage          int               `json:"percentage"` // -1 if unknown
+	Done                bool              `json:"done"`
+	Failed              bool              `json:"failed"`
 }
 
 func (t *ThetaRPCService) GetStatus(args *GetStatusArgs, result *GetStatusResult) (err error) {
@@ -548,9 +1320,200 @@ func (t *ThetaRPCService) GetStatus(args *GetStatusArgs, result *GetStatusResult
 	}
 	result.GenesisBlockHash = genesisHash
 
+	if progress, ok := snapshot.LatestLoadProgress(); ok {
+		result.SnapshotLoad = &SnapshotLoadStatus{
+			Operation:           progress.Operation,
+			Phase:               string(progress.Phase),
+			RecordsProcessed:    common.JSONUint64(progress.RecordsProcessed),
+			BytesRead:           common.JSONUint64(progress.BytesRead),
+			EstimatedTotalBytes: common.JSONUint64(progress.EstimatedTotalBytes),
+			Percentage:          progress.Percentage(),
+			Done:                progress.Done,
+			Failed:              progress.Failed,
+		}
+	}
+
 	return
 }
 
+// ------------------------------ GetConsensusState -----------------------------------
+
+type GetConsensusStateArgs struct{}
+
+type ConsensusBlockResult struct {
+	Hash   common.Hash       `json:"hash"`
+	Height common.JSONUint64 `json:"height"`
+	Epoch  common.JSONUint64 `json:"epoch"`
+}
+
+type ConsensusProposalResult struct {
+	ConsensusBlockResult
+	Proposer common.Address `json:"proposer"`
+}
+
+type ConsensusVoteResult struct {
+	Block  common.Hash       `json:"block"`
+	Height common.JSONUint64 `json:"height"`
+	Epoch  common.JSONUint64 `json:"epoch"`
+}
+
+type ValidatorVoteResult struct {
+	Address   common.Address       `json:"address"`
+	Stake     *common.JSONBig      `json:"stake"`
+	EpochVote *ConsensusVoteResult `json:"epoch_vote"` // the latest vote received from the validator, if any
+	VotedTip  bool                 `json:"voted_tip"`  // whether a vote for the tip was received
+}
+
+type PacemakerResult struct {
+	EpochStartTime         *common.JSONBig   `json:"epoch_start_time"`
+	EpochElapsedMillis     common.JSONUint64 `json:"epoch_elapsed_millis"`
+	TimeoutMillis          common.JSONUint64 `json:"timeout_millis"`
+	ConsecutiveTimeouts    common.JSONUint64 `json:"consecutive_timeouts"`
+	MinBlockIntervalMillis common.JSONUint64 `json:"min_block_interval_millis"`
+}
+
+type GetConsensusStateResult struct {
+	Address            string                   `json:"address"`
+	CurrentEpoch       common.JSONUint64        `json:"current_epoch"`
+	Syncing            bool                     `json:"syncing"`
+	Tip                *ConsensusBlockResult    `json:"tip"` // the block to extend
+	ExpectedProposer   common.Address           `json:"expected_proposer"`
+	LastProposal       *ConsensusProposalResult `json:"last_proposal"` // the last proposal of this node, if any
+	LastVote           *ConsensusVoteResult     `json:"last_vote"`     // the last vote of this node, if any
+	HighestCCBlock     *ConsensusBlockResult    `json:"highest_cc_block"`
+	LastFinalizedBlock *ConsensusBlockResult    `json:"last_finalized_block"`
+	Validators         []*ValidatorVoteResult   `json:"validators"`          // the validators voting on the epoch
+	EpochVoteMajority  bool                     `json:"epoch_vote_majority"` // whether a majority voted on the current epoch or later
+	Pacemaker          *PacemakerResult         `json:"pacemaker"`
+}
+
+func newConsensusBlockResult(block *core.ExtendedBlock) *ConsensusBlockResult {
+	return &ConsensusBlockResult{
+		Hash:   block.Hash(),
+		Height: common.JSONUint64(block.Height),
+		Epoch:  common.JSONUint64(block.Epoch),
+	}
+}
+
+func newConsensusVoteResult(vote core.Vote) *ConsensusVoteResult {
+	return &ConsensusVoteResult{
+		Block:  vote.Block,
+		Height: common.JSONUint64(vote.Height),
+		Epoch:  common.JSONUint64(vote.Epoch),
+	}
+}
+
+func (t *ThetaRPCService) GetConsensusState(args *GetConsensusStateArgs, result *GetConsensusStateResult) (err error) {
+	state := t.consensus.State()
+	epoch := t.consensus.GetEpoch()
+	result.Address = t.consensus.ID()
+	result.CurrentEpoch = common.JSONUint64(epoch)
+	result.Syncing = !t.consensus.HasSynced()
+
+	tip := t.consensus.GetTipToExtend()
+	result.Tip = newConsensusBlockResult(tip)
+	valMgr := t.consensus.GetValidatorManager()
+	result.ExpectedProposer = valMgr.GetNextProposer(tip.Hash(), epoch).ID()
+
+	if proposal := state.GetLastProposal(); proposal.Block != nil {
+		result.LastProposal = &ConsensusProposalResult{
+			ConsensusBlockResult: ConsensusBlockResult{
+				Hash:   proposal.Block.Hash(),
+				Height: common.JSONUint64(proposal.Block.Height),
+				Epoch:  common.JSONUint64(proposal.Block.Epoch),
+			},
+			Proposer: proposal.ProposerID,
+		}
+	}
+	if vote := state.GetLastVote(); !vote.Block.IsEmpty() {
+		result.LastVote = newConsensusVoteResult(vote)
+	}
+	result.HighestCCBlock = newConsensusBlockResult(state.GetHighestCCBlock())
+	lfb := state.GetLastFinalizedBlock()
+	result.LastFinalizedBlock = newConsensusBlockResult(lfb)
+
+	// The epoch votes are checked against the next validator set of the last finalized block,
+	// see ConsensusEngine.handleVote.
+	epochVotes, err := state.GetEpochVotes()
+	if err != nil {
+		epochVotes = core.NewVoteSet()
+	}
+	latestVotes := make(map[common.Address]core.Vote)
+	currentEpochVotes := core.NewVoteSet()
+	for _, vote := range epochVotes.Votes() {
+		if latest, ok := latestVotes[vote.ID]; !ok || vote.Epoch > latest.Epoch {
+			latestVotes[vote.ID] = vote
+		}
+		if vote.Epoch >= epoch {
+			currentEpochVotes.AddVote(vote)
+		}
+	}
+	tipVoters := make(map[common.Address]bool)
+	for _, vote := range t.chain.FindVotesByHash(tip.Hash()).Votes() {
+		tipVoters[vote.ID] = true
+	}
+	validators := valMgr.GetNextValidatorSet(lfb.Hash())
+	result.Validators = []*ValidatorVoteResult{}
+	for _, v := range validators.Validators() {
+		vr := &ValidatorVoteResult{
+			Address:  v.ID(),
+			Stake:    (*common.JSONBig)(v.Stake),
+			VotedTip: tipVoters[v.ID()],
+		}
+		if vote, ok := latestVotes[v.ID()]; ok {
+			vr.EpochVote = newConsensusVoteResult(vote)
+		}
+		result.Validators = append(result.Validators, vr)
+	}
+	result.EpochVoteMajority = validators.HasMajority(currentEpochVotes)
+
+	pacemaker := t.consensus.Pacemaker()
+	startTime := pacemaker.EpochStartTime()
+	result.Pacemaker = &PacemakerResult{
+		TimeoutMillis:          common.JSONUint64(pacemaker.Timeout() / time.Millisecond),
+		ConsecutiveTimeouts:    common.JSONUint64(pacemaker.ConsecutiveTimeouts()),
+		MinBlockIntervalMillis: common.JSONUint64(viper.GetInt(common.CfgConsensusMinBlockInterval) * 1000),
+	}
+	if !startTime.IsZero() {
+		result.Pacemaker.EpochStartTime = (*common.JSONBig)(big.NewInt(startTime.Unix()))
+		result.Pacemaker.EpochElapsedMillis = common.JSONUint64(time.Since(startTime) / time.Millisecond)
+	}
+	return nil
+}
+
+// ------------------------------ GetEpochTimeouts -----------------------------------
+
+type GetEpochTimeoutsArgs struct{}
+
+type EpochTimeoutResult struct {
+	Epoch    common.JSONUint64 `json:"epoch"`
+	Timeouts common.JSONUint64 `json:"timeouts"`
+}
+
+type GetEpochTimeoutsResult struct {
+	CurrentEpoch        common.JSONUint64     `json:"current_epoch"`
+	TimeoutMillis       common.JSONUint64     `json:"timeout_millis"` // timeout of the current epoch
+	ConsecutiveTimeouts common.JSONUint64     `json:"consecutive_timeouts"`
+	TotalTimeouts       common.JSONUint64     `json:"total_timeouts"`
+	Epochs              []*EpochTimeoutResult `json:"epochs"` // the most recent epochs that timed out
+}
+
+func (t *ThetaRPCService) GetEpochTimeouts(args *GetEpochTimeoutsArgs, result *GetEpochTimeoutsResult) (err error) {
+	pacemaker := t.consensus.Pacemaker()
+	result.CurrentEpoch = common.JSONUint64(t.consensus.GetEpoch())
+	result.TimeoutMillis = common.JSONUint64(pacemaker.Timeout() / time.Millisecond)
+	result.ConsecutiveTimeouts = common.JSONUint64(pacemaker.ConsecutiveTimeouts())
+	result.TotalTimeouts = common.JSONUint64(pacemaker.TotalTimeouts())
+	result.Epochs = []*EpochTimeoutResult{}
+	for _, et := range pacemaker.EpochTimeouts() {
+		result.Epochs = append(result.Epochs, &EpochTimeoutResult{
+			Epoch:    common.JSONUint64(et.Epoch),
+			Timeouts: common.JSONUint64(et.Timeouts),
+		})
+	}
+	return nil
+}
+
 // ------------------------------ GetPeerURLs -----------------------------------
 
 type GetPeerURLsArgs struct {
@@ -642,6 +1605,44 @@ func (t *ThetaRPCService) GetVcpByHeight(args *GetVcpByHeightArgs, result *GetVc
 	return nil
 }
 
+// ------------------------------ GetValidatorSetByHeight -----------------------------------
+
+type GetValidatorSetByHeightArgs struct {
+	Height common.JSONUint64 `json:"height"`
+}
+
+type ValidatorResult struct {
+	Address common.Address  `json:"address"`
+	Stake   *common.JSONBig `json:"stake"`
+}
+
+type GetValidatorSetByHeightResult struct {
+	BlockHash   common.Hash        `json:"block_hash"`   // the finalized block at the height
+	StateHeight common.JSONUint64  `json:"state_height"` // height of the state the validator candidate pool is read from
+	TotalStake  *common.JSONBig    `json:"total_stake"`
+	Validators  []*ValidatorResult `json:"validators"`
+}
+
+func (t *ThetaRPCService) GetValidatorSetByHeight(args *GetValidatorSetByHeightArgs, result *GetValidatorSetByHeightResult) (err error) {
+	vcp, blockHash, stateHeight, err := t.ledger.GetValidatorCandidatePoolByHeight(uint64(args.Height))
+	if err != nil {
+		return err
+	}
+	valSet := consensus.SelectTopStakeHoldersAsValidators(vcp)
+
+	result.BlockHash = blockHash
+	result.StateHeight = common.JSONUint64(stateHeight)
+	result.TotalStake = (*common.JSONBig)(valSet.TotalStake())
+	result.Validators = []*ValidatorResult{}
+	for _, v := range valSet.Validators() {
+		result.Validators = append(result.Validators, &ValidatorResult{
+			Address: v.ID(),
+			Stake:   (*common.JSONBig)(v.Stake),
+		})
+	}
+	return nil
+}
+
 // ------------------------------ GetGcp -----------------------------------
 
 type GetGcpByHeightArgs struct {
@@ -1078,6 +2079,10 @@ func getTxType(tx types.Tx) byte {
 		t = TxTypeDepositStakeTxV2
 	case *types.StakeRewardDistributionTx:
 		t = TxTypeStakeRewardDistributionTx
+	case *types.EvidenceTx:
+		t = TxTypeEvidenceTx
+	case *types.RotateValidatorKeyTx:
+		t = TxTypeRotateValidatorKeyTx
 	}
 
 	return t
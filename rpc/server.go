@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/thetatoken/theta/ledger"
 	"github.com/thetatoken/theta/mempool"
 	"github.com/thetatoken/theta/rpc/lib/rpc-codec/jsonrpc2"
+	"github.com/thetatoken/theta/snapshot"
 	"golang.org/x/net/netutil"
 	"golang.org/x/net/websocket"
 )
@@ -38,6 +40,8 @@ type ThetaRPCService struct {
 	chain      *blockchain.Chain
 	consensus  *consensus.ConsensusEngine
 
+	snapshotScheduler *snapshot.SnapshotScheduler
+
 	// Life cycle
 	wg      *sync.WaitGroup
 	ctx     context.Context
@@ -75,11 +79,14 @@ func NewThetaRPCServer(mempool *mempool.Mempool, ledger *ledger.Ledger, dispatch
 
 	t.handler = s
 
+	// Only serve the methods enabled in the node mode
+	ctx := jsonrpc2.WithMethodFilter(context.Background(), rpcMethodFilter(common.RPCMethodFilter()))
+
 	t.router = mux.NewRouter()
 	t.router.Handle("/", &defaultHTTPHandler{})
-	t.router.Handle("/rpc", corsMiddleware(TimeoutHandler(jsonrpc2.HTTPHandler(s), viper.GetDuration(common.CfgRPCTimeoutSecs)*time.Second, "")))
+	t.router.Handle("/rpc", corsMiddleware(TimeoutHandler(jsonrpc2.HTTPHandlerContext(ctx, s), viper.GetDuration(common.CfgRPCTimeoutSecs)*time.Second, "")))
 	t.router.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
-		s.ServeCodec(jsonrpc2.NewServerCodec(ws, s))
+		s.ServeCodec(jsonrpc2.NewServerCodecContext(ctx, ws, s))
 	}))
 
 	t.server = &http.Server{
@@ -91,6 +98,11 @@ func NewThetaRPCServer(mempool *mempool.Mempool, ledger *ledger.Ledger, dispatch
 	return t
 }
 
+// SetSnapshotScheduler sets the scheduler whose latest snapshot is served by GetLatestSnapshot.
+func (t *ThetaRPCServer) SetSnapshotScheduler(scheduler *snapshot.SnapshotScheduler) {
+	t.snapshotScheduler = scheduler
+}
+
 // Start creates the main goroutine.
 func (t *ThetaRPCServer) Start(ctx context.Context) {
 	c, cancel := context.WithCancel(ctx)
@@ -131,6 +143,17 @@ func (t *ThetaRPCServer) serve() {
 	logger.Info(t.server.Serve(ll))
 }
 
+// rpcMethodFilter applies the filter to the methods of the theta service, named without the
+// service prefix.
+func rpcMethodFilter(filter func(method string) bool) func(method string) bool {
+	return func(method string) bool {
+		if !strings.HasPrefix(method, "theta.") {
+			return false
+		}
+		return filter(strings.TrimPrefix(method, "theta."))
+	}
+}
+
 func corsMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//Allow CORS here By * or specific origin
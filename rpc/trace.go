@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+)
+
+const (
+	TracerStructLogger = "structLogger"
+	TracerCallTracer   = "callTracer"
+)
+
+// TraceConfig selects the tracer of the EVM executions, the struct logger by default.
+type TraceConfig struct {
+	Tracer         string            `json:"tracer"`
+	DisableMemory  bool              `json:"disable_memory"`
+	DisableStack   bool              `json:"disable_stack"`
+	DisableStorage bool              `json:"disable_storage"`
+	Limit          common.JSONUint64 `json:"limit"` // max number of struct logs per tx, 0 for no limit
+}
+
+// TxTrace is the trace of the EVM execution of a smart contract transaction.
+type TxTrace struct {
+	TxHash      common.Hash       `json:"tx_hash"`
+	Index       common.JSONUint64 `json:"index"`
+	Failed      bool              `json:"failed"`
+	Error       string            `json:"error,omitempty"`
+	ReturnValue string            `json:"return_value"`
+	StructLogs  []vm.StructLog    `json:"struct_logs,omitempty"`
+	CallTree    *vm.CallFrame     `json:"call_tree,omitempty"`
+}
+
+// ------------------------------- TraceTransaction -----------------------------------
+
+type TraceTransactionArgs struct {
+	Hash string `json:"hash"`
+	TraceConfig
+}
+
+type TraceTransactionResult struct {
+	BlockHash   common.Hash       `json:"block_hash"`
+	BlockHeight common.JSONUint64 `json:"block_height"`
+	*TxTrace
+}
+
+// TraceTransaction re-executes the block of the smart contract transaction up to the transaction,
+// and returns the trace of its EVM execution.
+func (t *ThetaRPCService) TraceTransaction(args *TraceTransactionArgs, result *TraceTransactionResult) (err error) {
+	if args.Hash == "" {
+		return errors.New("Transaction hash must be specified")
+	}
+	if err = checkTraceConfig(&args.TraceConfig); err != nil {
+		return err
+	}
+	raw, block, found := t.chain.FindTxByHash(common.HexToHash(args.Hash))
+	if !found {
+		return fmt.Errorf("Transaction %v is not found", args.Hash)
+	}
+	tx, err := types.TxFromBytes(raw)
+	if err != nil {
+		return err
+	}
+	if _, ok := tx.(*types.SmartContractTx); !ok {
+		return fmt.Errorf("Transaction %v is not a smart contract transaction", args.Hash)
+	}
+	txIndex := -1
+	for i, blockTx := range block.Txs {
+		if bytes.Equal(blockTx, raw) {
+			txIndex = i
+			break
+		}
+	}
+	if txIndex < 0 {
+		return fmt.Errorf("Transaction %v is not found in block %v", args.Hash, block.Hash().Hex())
+	}
+
+	traces, err := t.traceBlockTxs(block, txIndex, &args.TraceConfig)
+	if err != nil {
+		return err
+	}
+	result.BlockHash = block.Hash()
+	result.BlockHeight = common.JSONUint64(block.Height)
+	result.TxTrace = traces[0]
+	return nil
+}
+
+// ------------------------------- TraceBlock -----------------------------------
+
+type TraceBlockArgs struct {
+	Hash   common.Hash       `json:"hash"`
+	Height common.JSONUint64 `json:"height"` // used if the hash is not specified, 0 for the latest finalized block
+	TraceConfig
+}
+
+type TraceBlockResult struct {
+	BlockHash   common.Hash       `json:"block_hash"`
+	BlockHeight common.JSONUint64 `json:"block_height"`
+	Txs         []*TxTrace        `json:"txs"`
+}
+
+// TraceBlock re-executes the block, and returns the traces of the EVM executions of its smart
+// contract transactions.
+func (t *ThetaRPCService) TraceBlock(args *TraceBlockArgs, result *TraceBlockResult) (err error) {
+	if err = checkTraceConfig(&args.TraceConfig); err != nil {
+		return err
+	}
+	var block *core.ExtendedBlock
+	if !args.Hash.IsEmpty() {
+		block, err = t.chain.FindBlock(args.Hash)
+		if err != nil {
+			return fmt.Errorf("Block %v is not found: %v", args.Hash.Hex(), err)
+		}
+	} else {
+		block = t.finalizedBlockAtHeight(uint64(args.Height))
+		if block == nil {
+			return fmt.Errorf("Finalized block at height %v is not found", args.Height)
+		}
+	}
+
+	traces, err := t.traceBlockTxs(block, -1, &args.TraceConfig)
+	if err != nil {
+		return err
+	}
+	result.BlockHash = block.Hash()
+	result.BlockHeight = common.JSONUint64(block.Height)
+	result.Txs = traces
+	return nil
+}
+
+func checkTraceConfig(config *TraceConfig) error {
+	switch config.Tracer {
+	case "":
+		config.Tracer = TracerStructLogger
+	case TracerStructLogger, TracerCallTracer:
+	default:
+		return fmt.Errorf("Unknown tracer %v, expecting %v or %v", config.Tracer, TracerStructLogger, TracerCallTracer)
+	}
+	return nil
+}
+
+// traceBlockTxs re-executes the transactions of the block up to the one at txIndex, or all of them
+// if txIndex is negative, and returns the traces of the smart contract transactions traced, in
+// the block order. With a txIndex, only the transaction at txIndex is traced.
+func (t *ThetaRPCService) traceBlockTxs(block *core.ExtendedBlock, txIndex int, config *TraceConfig) ([]*TxTrace, error) {
+	traces := []*TxTrace{}
+	tracers := []vm.Tracer{}
+	err := t.ledger.TraceBlockTxs(block.Block, txIndex, func(index int, tx *types.SmartContractTx) vm.Tracer {
+		if txIndex >= 0 && index != txIndex {
+			return nil
+		}
+		var tracer vm.Tracer
+		if config.Tracer == TracerCallTracer {
+			tracer = vm.NewCallTracer()
+		} else {
+			tracer = vm.NewStructLogger(&vm.LogConfig{
+				DisableMemory:  config.DisableMemory,
+				DisableStack:   config.DisableStack,
+				DisableStorage: config.DisableStorage,
+				Limit:          int(config.Limit),
+			})
+		}
+		traces = append(traces, &TxTrace{
+			TxHash: crypto.Keccak256Hash(block.Txs[index]),
+			Index:  common.JSONUint64(index),
+		})
+		tracers = append(tracers, tracer)
+		return tracer
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, trace := range traces {
+		var output []byte
+		var vmErr error
+		switch tracer := tracers[i].(type) {
+		case *vm.StructLogger:
+			trace.StructLogs = tracer.StructLogs()
+			output, vmErr = tracer.Output(), tracer.Error()
+		case *vm.CallTracer:
+			trace.CallTree = tracer.CallFrame()
+			if trace.CallTree != nil {
+				output = trace.CallTree.Output
+				if trace.CallTree.Error != "" {
+					vmErr = errors.New(trace.CallTree.Error)
+				}
+			}
+		}
+		trace.ReturnValue = hex.EncodeToString(output)
+		if vmErr != nil {
+			trace.Failed = true
+			trace.Error = vmErr.Error()
+		}
+	}
+	if txIndex >= 0 && len(traces) == 0 {
+		return nil, fmt.Errorf("Transaction %v of block %v is not a smart contract transaction", txIndex, block.Hash().Hex())
+	}
+	return traces, nil
+}
@@ -0,0 +1,116 @@
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// AccountAvailability is the availability of an account while a snapshot is being loaded.
+type AccountAvailability int
+
+const (
+	// AccountNotLoaded means the account has not been loaded yet.
+	AccountNotLoaded AccountAvailability = iota
+
+	// AccountUnverified means the account, including its storage, has been loaded, but the
+	// snapshot has not been verified against the validator votes yet.
+	AccountUnverified
+
+	// AccountVerified means the snapshot has been verified, the account is trusted.
+	AccountVerified
+)
+
+// StateAvailability tracks which accounts of the snapshot block state are available while the
+// snapshot is being loaded, so that reads can be served before the load completes.
+//
+// Trust caveats: until the snapshot is verified, a loaded account has only been checked
+// against its own storage root. Neither the state root nor the validator votes have been
+// checked yet, so a malicious snapshot can serve arbitrary balances and code, and a later
+// failure discards all the accounts. Unverified accounts must therefore never be used for
+// consensus or presented as final. Only V2 snapshots expose accounts before verification,
+// later versions make all the accounts available at once upon verification. The unverified
+// accounts are held in memory until then.
+type StateAvailability struct {
+	mu       sync.RWMutex
+	height   uint64
+	accounts map[common.Address]*types.Account
+	sv       *state.StoreView // the verified state, nil until verified
+}
+
+// NewStateAvailability creates a new StateAvailability instance.
+func NewStateAvailability() *StateAvailability {
+	return &StateAvailability{
+		accounts: make(map[common.Address]*types.Account),
+	}
+}
+
+// GetAccount returns the account along with its availability. Once the snapshot is verified,
+// a nil account means the account doesn't exist.
+func (sa *StateAvailability) GetAccount(addr common.Address) (*types.Account, AccountAvailability) {
+	sa.mu.Lock() // the store view is not safe for concurrent reads
+	defer sa.mu.Unlock()
+
+	if sa.sv != nil {
+		return sa.sv.GetAccount(addr), AccountVerified
+	}
+	if account, ok := sa.accounts[addr]; ok {
+		return account, AccountUnverified
+	}
+	return nil, AccountNotLoaded
+}
+
+// IsVerified returns whether the snapshot has been verified, i.e. all accounts are trusted.
+func (sa *StateAvailability) IsVerified() bool {
+	sa.mu.RLock()
+	defer sa.mu.RUnlock()
+	return sa.sv != nil
+}
+
+// start begins tracking the accounts of the state at the given height.
+func (sa *StateAvailability) start(height uint64) {
+	if sa == nil {
+		return
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.height = height
+	sa.accounts = make(map[common.Address]*types.Account)
+	sa.sv = nil
+}
+
+// addAccount marks the account of the store view at the given height as loaded.
+func (sa *StateAvailability) addAccount(height uint64, account *types.Account) {
+	if sa == nil {
+		return
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if height == sa.height && sa.sv == nil {
+		sa.accounts[account.Address] = account
+	}
+}
+
+// markVerified makes all the accounts of the verified state available.
+func (sa *StateAvailability) markVerified(sv *state.StoreView) {
+	if sa == nil {
+		return
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.sv = sv
+	sa.accounts = nil
+}
+
+// reset discards the loaded accounts, e.g. if the snapshot fails to load.
+func (sa *StateAvailability) reset() {
+	if sa == nil {
+		return
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.accounts = make(map[common.Address]*types.Account)
+	sa.sv = nil
+}
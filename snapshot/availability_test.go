@@ -0,0 +1,124 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestStateAvailability(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, addr1, "a", "b")
+	setTestContractAccount(sv, db, addr2, "c", "d")
+	sv.SetAccount(addr3, &types.Account{Address: addr3, Balance: types.NewCoins(1, 2)})
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(buf), db, 0)
+
+	// While the storage of the second account is loading, only the first account is available.
+	availability := NewStateAvailability()
+	availability.start(10)
+	probed := false
+	opts := &LoadSnapshotOptions{
+		Availability: availability,
+		OnAccountStorageProgress: func(progress AccountStorageProgress) {
+			if progress.Address != addr1 || !progress.Done {
+				return
+			}
+			account, status := availability.GetAccount(addr1)
+			assert.Equal(AccountUnverified, status)
+			require.NotNil(account)
+			assert.Equal(addr1, account.Address)
+			_, status = availability.GetAccount(addr2)
+			assert.Equal(AccountNotLoaded, status)
+			probed = true
+		},
+	}
+	loadedSV, hash, err := loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, opts)
+	require.Nil(err)
+	require.Equal(stateHash, hash)
+	assert.True(probed)
+
+	// All accounts are loaded, but still unverified.
+	for _, addr := range []common.Address{addr1, addr2, addr3} {
+		account, status := availability.GetAccount(addr)
+		assert.Equal(AccountUnverified, status)
+		assert.NotNil(account)
+	}
+	assert.False(availability.IsVerified())
+
+	availability.markVerified(loadedSV)
+	assert.True(availability.IsVerified())
+	account, status := availability.GetAccount(addr3)
+	assert.Equal(AccountVerified, status)
+	require.NotNil(account)
+	assert.Equal(int64(1), account.Balance.ThetaWei.Int64())
+	account, status = availability.GetAccount(common.HexToAddress("0x4"))
+	assert.Equal(AccountVerified, status)
+	assert.Nil(account)
+}
+
+func TestStateAvailabilityDiscardedOnFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	addr := common.HexToAddress("0x1")
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, addr, "a", "b")
+	sv.Save()
+
+	// The state doesn't match the state hash committed by the tail trio.
+	filePath := path.Join(dir, "theta_snapshot-mismatch")
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	tailTrio := createTestTailTrio(10, common.HexToHash("a1"))
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 2}))
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: tailTrio.Second.Header}))
+	require.Nil(core.WriteMetadata(writer, &core.SnapshotMetadata{TailTrio: tailTrio}))
+	writeStoreView(sv, true, writer, db, 0)
+	require.Nil(file.Close())
+
+	availability := NewStateAvailability()
+	loaded := false
+	opts := &LoadSnapshotOptions{
+		Availability: availability,
+		OnAccountStorageProgress: func(progress AccountStorageProgress) {
+			if progress.Done {
+				_, status := availability.GetAccount(addr)
+				loaded = status == AccountUnverified
+			}
+		},
+	}
+	_, _, err = loadSnapshot(filePath, backend.NewMemDatabase(), "Testing", opts)
+	assert.NotNil(err)
+	assert.True(loaded)
+
+	account, status := availability.GetAccount(addr)
+	assert.Equal(AccountNotLoaded, status)
+	assert.Nil(account)
+	assert.False(availability.IsVerified())
+}
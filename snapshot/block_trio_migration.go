@@ -0,0 +1,33 @@
+package snapshot
+
+import (
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// MigrateBlockTrios moves the block trios saved under the legacy keys by the earlier snapshot
+// loads to the keys of the block trio codec, so they can be read with GetBlockTrioByHeight.
+// The trios are looked up at the validator set change heights recorded in the state of the
+// given block. It returns the number of migrated trios, zero once the database is migrated.
+func MigrateBlockTrios(db database.Database, block *core.BlockHeader) (int, error) {
+	sv := state.NewStoreView(block.Height, block.StateHash, db)
+	hl := sv.GetStakeTransactionHeightList()
+	if hl == nil {
+		return 0, nil
+	}
+
+	kvStore := kvstore.NewKVStore(db)
+	migrated := 0
+	for _, height := range hl.Heights {
+		found, err := core.MigrateBlockTrio(kvStore, height)
+		if err != nil {
+			return migrated, err
+		}
+		if found {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,179 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// Chunk framing
+//
+// For network transfer the snapshot record stream is split into fixed-size chunks, each
+// framed as:
+//
+//   +-----------------------+------------------------------+-----------------+
+//   | payload length (8B LE) | SHA-256 of the payload (32B) | payload         |
+//   +-----------------------+------------------------------+-----------------+
+//
+// Every chunk except the last carries exactly the chunk size worth of payload. Since the
+// frame boundaries do not depend on the payload content, a corrupted chunk can be detected
+// and re-requested on its own while the subsequent chunks are still verifiable.
+
+const (
+	// DefaultSnapshotChunkSize is the default payload size of a snapshot chunk.
+	DefaultSnapshotChunkSize = 1024 * 1024
+
+	// maxSnapshotChunkSize bounds the payload size accepted by the chunk reader.
+	maxSnapshotChunkSize = 64 * 1024 * 1024
+
+	chunkHeaderSize = 8 + common.HashLength
+)
+
+// ChunkVerificationError indicates that the content of a chunk doesn't match its hash.
+type ChunkVerificationError struct {
+	Index    uint64
+	Expected common.Hash
+	Actual   common.Hash
+}
+
+func (e *ChunkVerificationError) Error() string {
+	return fmt.Sprintf("Snapshot chunk %v is corrupted, expected hash: %v, actual hash: %v",
+		e.Index, e.Expected.Hex(), e.Actual.Hex())
+}
+
+// ChunkWriter splits the written data into hash-framed chunks.
+type ChunkWriter struct {
+	writer    io.Writer
+	chunkSize int
+	buf       []byte
+}
+
+// NewChunkWriter creates a new ChunkWriter with the given chunk payload size.
+func NewChunkWriter(writer io.Writer, chunkSize int) *ChunkWriter {
+	if chunkSize <= 0 {
+		chunkSize = DefaultSnapshotChunkSize
+	}
+	return &ChunkWriter{
+		writer:    writer,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (cw *ChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := cw.chunkSize - len(cw.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		cw.buf = append(cw.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(cw.buf) == cw.chunkSize {
+			if err := cw.writeChunk(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush writes out the remaining buffered data as the last chunk.
+func (cw *ChunkWriter) Flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	return cw.writeChunk()
+}
+
+func (cw *ChunkWriter) writeChunk() error {
+	hash := sha256.Sum256(cw.buf)
+	if _, err := cw.writer.Write(core.Itobytes(uint64(len(cw.buf)))); err != nil {
+		return err
+	}
+	if _, err := cw.writer.Write(hash[:]); err != nil {
+		return err
+	}
+	if _, err := cw.writer.Write(cw.buf); err != nil {
+		return err
+	}
+	cw.buf = cw.buf[:0]
+	return nil
+}
+
+// ChunkReader reads a hash-framed chunk stream, verifying each chunk as it arrives.
+type ChunkReader struct {
+	reader  io.Reader
+	index   uint64
+	pending *bytes.Reader
+}
+
+// NewChunkReader creates a new ChunkReader.
+func NewChunkReader(reader io.Reader) *ChunkReader {
+	return &ChunkReader{
+		reader: reader,
+	}
+}
+
+// NextChunk reads and verifies the next chunk, and returns its payload. It returns a
+// *ChunkVerificationError if the chunk is corrupted, in which case the reader is still
+// positioned at the next chunk. It returns io.EOF once all the chunks have been read.
+func (cr *ChunkReader) NextChunk() ([]byte, error) {
+	header := make([]byte, chunkHeaderSize)
+	_, err := io.ReadFull(cr.reader, header)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Truncated header for snapshot chunk %v", cr.index)
+		}
+		return nil, err
+	}
+	size := core.Bytestoi(header[:8])
+	if size == 0 || size > maxSnapshotChunkSize {
+		return nil, fmt.Errorf("Invalid size for snapshot chunk %v: %v", cr.index, size)
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(cr.reader, payload)
+	if err != nil {
+		return nil, fmt.Errorf("Truncated payload for snapshot chunk %v: %v", cr.index, err)
+	}
+
+	index := cr.index
+	cr.index++
+
+	expected := common.BytesToHash(header[8:])
+	actual := common.Hash(sha256.Sum256(payload))
+	if expected != actual {
+		return nil, &ChunkVerificationError{Index: index, Expected: expected, Actual: actual}
+	}
+	return payload, nil
+}
+
+// Read implements the io.Reader interface over the verified chunk payloads. Any chunk
+// verification failure aborts the read.
+func (cr *ChunkReader) Read(p []byte) (int, error) {
+	for cr.pending == nil || cr.pending.Len() == 0 {
+		payload, err := cr.NextChunk()
+		if err != nil {
+			return 0, err
+		}
+		cr.pending = bytes.NewReader(payload)
+	}
+	return cr.pending.Read(p)
+}
+
+// LoadStateFromChunks loads the snapshot state records (V3 and later format) from a chunk
+// framed stream, failing fast on the first corrupted chunk.
+func LoadStateFromChunks(reader io.Reader, db database.Database, opts *LoadSnapshotOptions) error {
+	progress := newProgressReporter("Loading Snapshot Chunks", 0, opts)
+	progress.setPhase(SnapshotPhaseState)
+	err := loadStateV3(NewChunkReader(reader), db, progress, opts.writeBatchSize(), opts.writeBatchBytes(), nil, false)
+	progress.done(err)
+	return err
+}
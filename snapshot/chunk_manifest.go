@@ -0,0 +1,323 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// ChunkManifestFileName is the name of the manifest file in a chunk directory.
+const ChunkManifestFileName = "manifest"
+
+// SnapshotChunkManifest describes a snapshot file split into chunks for parallel distribution.
+// The first chunk is the head of the snapshot, i.e. the sections up to the metadata, and the
+// following chunks of ChunkSize bytes split the rest of the snapshot. Root is the Merkle root
+// of the hashes of the chunks following the head, which is recorded in the snapshot metadata:
+// once the manifest is trusted, e.g. its root matches the metadata of a signed snapshot, each
+// chunk can be verified on its own as soon as it is downloaded, regardless of the mirror or
+// peer it came from.
+type SnapshotChunkManifest struct {
+	SnapshotSize uint64
+	ChunkSize    uint64
+	HeadSize     uint64
+	ChunkHashes  []common.Hash // the hash of the head first
+	Root         common.Hash
+}
+
+// ChunkFileName returns the file name of the chunk with the given index.
+func ChunkFileName(index int) string {
+	return fmt.Sprintf("chunk-%06d", index)
+}
+
+// snapshotHead holds the sections of a snapshot preceding the state records.
+type snapshotHead struct {
+	header         *core.SnapshotHeader
+	diffBase       *core.SnapshotDiffBase // nil if the snapshot is not a diff
+	lastCheckpoint *core.LastCheckpoint
+	metadata       *core.SnapshotMetadata
+}
+
+// readSnapshotHead reads the head of an uncompressed snapshot without record checksums, so
+// that the state records following it are left unread in the reader.
+func readSnapshotHead(reader *bufio.Reader) (*snapshotHead, error) {
+	if detectSnapshotCompression(reader) != SnapshotCompressionNone {
+		return nil, fmt.Errorf("The compressed snapshots can't be split, please decompress the snapshot first")
+	}
+	header, err := core.PeekSnapshotHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if header.FormatVersion() < 2 {
+		return nil, fmt.Errorf("The version %v snapshots can't be split", header.FormatVersion())
+	}
+	if header.HasRecordChecksums() {
+		return nil, fmt.Errorf("The snapshots with record checksums can't be split, their trailer covers the metadata")
+	}
+	head := &snapshotHead{header: header, lastCheckpoint: &core.LastCheckpoint{}, metadata: &core.SnapshotMetadata{}}
+	if header.IsDiff() {
+		head.diffBase = &core.SnapshotDiffBase{}
+		if _, err = core.ReadRecord(reader, head.diffBase); err != nil {
+			return nil, fmt.Errorf("Failed to load snapshot diff base, %v", err)
+		}
+	}
+	if _, err = core.ReadRecord(reader, head.lastCheckpoint); err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot last checkpoint, %v", err)
+	}
+	if _, err = core.ReadRecord(reader, head.metadata); err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot metadata, %v", err)
+	}
+	return head, nil
+}
+
+// encode returns the encoding of the head, as written by the snapshot exporter.
+func (head *snapshotHead) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	if err := core.WriteSnapshotHeader(writer, head.header); err != nil {
+		return nil, err
+	}
+	if head.diffBase != nil {
+		if err := core.WriteDiffBase(writer, head.diffBase); err != nil {
+			return nil, err
+		}
+	}
+	if err := core.WriteLastCheckpoint(writer, head.lastCheckpoint); err != nil {
+		return nil, err
+	}
+	if err := core.WriteMetadata(writer, head.metadata); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SplitSnapshot splits the snapshot file into chunk files of the given size in the chunk
+// directory, and writes the manifest of the chunks along with them. The root of the chunks is
+// recorded in the metadata of the head chunk, so the assembled snapshot differs from the
+// original file by its metadata, and needs to be signed after being split. The snapshot must
+// be uncompressed, and without record checksums.
+func SplitSnapshot(snapshotFilePath, chunkDir string, chunkSize int) (*SnapshotChunkManifest, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultSnapshotChunkSize
+	}
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+	reader := bufio.NewReader(snapshotFile)
+	head, err := readSnapshotHead(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to split snapshot %v: %v", snapshotFilePath, err)
+	}
+	if err = os.MkdirAll(chunkDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	manifest := &SnapshotChunkManifest{ChunkSize: uint64(chunkSize), ChunkHashes: []common.Hash{{}}}
+	buf := make([]byte, chunkSize)
+	for index := 1; ; index++ {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			if werr := ioutil.WriteFile(path.Join(chunkDir, ChunkFileName(index)), buf[:n], 0644); werr != nil {
+				return nil, werr
+			}
+			manifest.ChunkHashes = append(manifest.ChunkHashes, common.Hash(sha256.Sum256(buf[:n])))
+			manifest.SnapshotSize += uint64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	manifest.Root = chunkMerkleRoot(manifest.ChunkHashes[1:])
+
+	if head.metadata.Version < core.SnapshotMetadataVersion5 {
+		head.metadata.Version = core.SnapshotMetadataVersion5
+	}
+	head.metadata.ChunkRoot = manifest.Root
+	head.metadata.ChunkSize = manifest.ChunkSize
+	headData, err := head.encode()
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(path.Join(chunkDir, ChunkFileName(0)), headData, 0644); err != nil {
+		return nil, err
+	}
+	manifest.ChunkHashes[0] = common.Hash(sha256.Sum256(headData))
+	manifest.HeadSize = uint64(len(headData))
+	manifest.SnapshotSize += manifest.HeadSize
+
+	if err = WriteChunkManifest(path.Join(chunkDir, ChunkManifestFileName), manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WriteChunkManifest writes the manifest to the given file.
+func WriteChunkManifest(manifestPath string, manifest *SnapshotChunkManifest) error {
+	raw, err := rlp.EncodeToBytes(manifest)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath, raw, 0644)
+}
+
+// ReadChunkManifest reads the manifest from the given file, and checks its consistency.
+func ReadChunkManifest(manifestPath string) (*SnapshotChunkManifest, error) {
+	raw, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SnapshotChunkManifest{}
+	if err = rlp.DecodeBytes(raw, manifest); err != nil {
+		return nil, fmt.Errorf("Failed to decode snapshot chunk manifest, %v", err)
+	}
+	if err = manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Validate checks that the number of chunks matches the snapshot size, and that the root
+// commits to the chunk hashes.
+func (m *SnapshotChunkManifest) Validate() error {
+	if m.ChunkSize == 0 {
+		return fmt.Errorf("Invalid snapshot chunk size: 0")
+	}
+	if m.HeadSize == 0 || m.HeadSize > m.SnapshotSize {
+		return fmt.Errorf("Invalid snapshot head size: %v", m.HeadSize)
+	}
+	expectedChunks := 1 + (m.SnapshotSize-m.HeadSize+m.ChunkSize-1)/m.ChunkSize
+	if uint64(len(m.ChunkHashes)) != expectedChunks {
+		return fmt.Errorf("Snapshot chunk count mismatch, expected: %v, listed: %v", expectedChunks, len(m.ChunkHashes))
+	}
+	if root := chunkMerkleRoot(m.ChunkHashes[1:]); root != m.Root {
+		return fmt.Errorf("Snapshot chunk root mismatch, expected: %v, calculated: %v", m.Root.Hex(), root.Hex())
+	}
+	return nil
+}
+
+// chunkLength returns the expected payload length of the chunk with the given index.
+func (m *SnapshotChunkManifest) chunkLength(index int) uint64 {
+	if index == 0 {
+		return m.HeadSize
+	}
+	offset := m.HeadSize + uint64(index-1)*m.ChunkSize
+	if offset+m.ChunkSize <= m.SnapshotSize {
+		return m.ChunkSize
+	}
+	return m.SnapshotSize - offset
+}
+
+// VerifyChunk checks the content of the chunk with the given index against the manifest, and
+// that the metadata in the head chunk records the root and the chunk size of the manifest. It
+// returns a *ChunkVerificationError if the content doesn't match.
+func (m *SnapshotChunkManifest) VerifyChunk(index int, data []byte) error {
+	if index < 0 || index >= len(m.ChunkHashes) {
+		return fmt.Errorf("Invalid snapshot chunk index: %v", index)
+	}
+	if expected := m.chunkLength(index); uint64(len(data)) != expected {
+		return fmt.Errorf("Snapshot chunk %v size mismatch, expected: %v, actual: %v", index, expected, len(data))
+	}
+	actual := common.Hash(sha256.Sum256(data))
+	if actual != m.ChunkHashes[index] {
+		return &ChunkVerificationError{Index: uint64(index), Expected: m.ChunkHashes[index], Actual: actual}
+	}
+	if index == 0 {
+		head, err := readSnapshotHead(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return fmt.Errorf("Invalid snapshot head chunk: %v", err)
+		}
+		if head.metadata.ChunkRoot != m.Root || head.metadata.ChunkSize != m.ChunkSize {
+			return fmt.Errorf("Snapshot metadata doesn't record the chunk root %v, recorded: %v", m.Root.Hex(), head.metadata.ChunkRoot.Hex())
+		}
+	}
+	return nil
+}
+
+// AssembleSnapshot verifies the chunk files in the chunk directory against the manifest, and
+// concatenates them into the snapshot file. The snapshot file is only created if all the
+// chunks are valid.
+func AssembleSnapshot(manifest *SnapshotChunkManifest, chunkDir, snapshotFilePath string) error {
+	if err := manifest.Validate(); err != nil {
+		return err
+	}
+	tmpPath := snapshotFilePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	for index := range manifest.ChunkHashes {
+		data, err := ioutil.ReadFile(path.Join(chunkDir, ChunkFileName(index)))
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if err = manifest.VerifyChunk(index, data); err != nil {
+			file.Close()
+			return err
+		}
+		if _, err = file.Write(data); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, snapshotFilePath)
+}
+
+// ReadChunkedSnapshotMetadata reads the metadata of the snapshot split in the chunk directory,
+// from its head chunk.
+func ReadChunkedSnapshotMetadata(manifest *SnapshotChunkManifest, chunkDir string) (*core.SnapshotMetadata, error) {
+	data, err := ioutil.ReadFile(path.Join(chunkDir, ChunkFileName(0)))
+	if err != nil {
+		return nil, err
+	}
+	if err = manifest.VerifyChunk(0, data); err != nil {
+		return nil, fmt.Errorf("Failed to read the metadata of the chunked snapshot: %v", err)
+	}
+	head, err := readSnapshotHead(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	return head.metadata, nil
+}
+
+// chunkMerkleRoot computes the binary Merkle root of the chunk hashes. An odd node at the end
+// of a level is promoted to the next level as is.
+func chunkMerkleRoot(hashes []common.Hash) common.Hash {
+	if len(hashes) == 0 {
+		return common.Hash{}
+	}
+	level := append([]common.Hash{}, hashes...)
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, common.Hash(sha256.Sum256(append(level[i].Bytes(), level[i+1].Bytes()...))))
+		}
+		level = next
+	}
+	return level[0]
+}
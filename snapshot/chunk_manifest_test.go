@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestSplitAndAssembleSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-chunked")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"), common.HexToAddress("0x2"))
+
+	chunkDir := path.Join(dir, "chunks")
+	chunkSize := 128
+	manifest, err := SplitSnapshot(snapshotPath, chunkDir, chunkSize)
+	require.Nil(err)
+	head, err := ioutil.ReadFile(path.Join(chunkDir, ChunkFileName(0)))
+	require.Nil(err)
+	assert.Equal(uint64(len(head)), manifest.HeadSize)
+	bodySize := int(manifest.SnapshotSize - manifest.HeadSize)
+	assert.Equal(1+(bodySize+chunkSize-1)/chunkSize, len(manifest.ChunkHashes))
+
+	manifest, err = ReadChunkManifest(path.Join(chunkDir, ChunkManifestFileName))
+	require.Nil(err)
+
+	// Each chunk is verifiable on its own.
+	lastIndex := len(manifest.ChunkHashes) - 1
+	lastChunk, err := ioutil.ReadFile(path.Join(chunkDir, ChunkFileName(lastIndex)))
+	require.Nil(err)
+	assert.Nil(manifest.VerifyChunk(lastIndex, lastChunk))
+	assert.NotNil(manifest.VerifyChunk(0, lastChunk))
+	assert.Nil(manifest.VerifyChunk(0, head))
+
+	// The assembled snapshot records the chunk root in its metadata.
+	assembledPath := path.Join(dir, "theta_snapshot-assembled")
+	require.Nil(AssembleSnapshot(manifest, chunkDir, assembledPath))
+	assembled, err := ioutil.ReadFile(assembledPath)
+	require.Nil(err)
+	assert.Equal(manifest.SnapshotSize, uint64(len(assembled)))
+	header, _, err := LoadSnapshot(assembledPath, backend.NewMemDatabase(), nil)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+	assembledMetadata, err := ReadSnapshotMetadata(assembledPath)
+	require.Nil(err)
+	assert.Equal(core.SnapshotMetadataVersion5, assembledMetadata.Version)
+	assert.Equal(manifest.Root, assembledMetadata.ChunkRoot)
+	assert.Equal(uint64(chunkSize), assembledMetadata.ChunkSize)
+
+	// A head whose metadata doesn't record the root of the manifest is rejected.
+	otherManifest := *manifest
+	otherManifest.ChunkHashes = append([]common.Hash{}, manifest.ChunkHashes...)
+	otherManifest.ChunkHashes[1] = common.Hash{}
+	otherManifest.Root = chunkMerkleRoot(otherManifest.ChunkHashes[1:])
+	assert.NotNil(otherManifest.VerifyChunk(0, head))
+
+	// A tampered chunk is rejected, and nothing is assembled.
+	chunk1Path := path.Join(chunkDir, ChunkFileName(1))
+	chunk1, err := ioutil.ReadFile(chunk1Path)
+	require.Nil(err)
+	chunk1[5] ^= 0xff
+	require.Nil(ioutil.WriteFile(chunk1Path, chunk1, 0644))
+	tamperedPath := path.Join(dir, "theta_snapshot-tampered")
+	err = AssembleSnapshot(manifest, chunkDir, tamperedPath)
+	require.NotNil(err)
+	verr, ok := err.(*ChunkVerificationError)
+	require.True(ok)
+	assert.Equal(uint64(1), verr.Index)
+	_, err = os.Stat(tamperedPath)
+	assert.True(os.IsNotExist(err))
+
+	// A manifest whose chunk hashes don't match its root is rejected.
+	manifest.ChunkHashes[1] = common.Hash{}
+	assert.NotNil(manifest.Validate())
+}
+
+func TestReadChunkedSnapshotMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-chunked")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+	chunkDir := path.Join(dir, "chunks")
+	manifest, err := SplitSnapshot(snapshotPath, chunkDir, 64)
+	require.Nil(err)
+	require.True(len(manifest.ChunkHashes) > 2)
+
+	chunkedMetadata, err := ReadChunkedSnapshotMetadata(manifest, chunkDir)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), chunkedMetadata.TailTrio.Second.Header.Hash())
+	assert.Nil(CheckBlockTrio(&chunkedMetadata.TailTrio))
+	assert.Equal(manifest.Root, chunkedMetadata.ChunkRoot)
+}
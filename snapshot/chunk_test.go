@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func createTestChunkStream(t *testing.T, chunkSize int, numRecords int) []byte {
+	buf := &bytes.Buffer{}
+	cw := NewChunkWriter(buf, chunkSize)
+	writer := bufio.NewWriter(cw)
+	for i := 0; i < numRecords; i++ {
+		key := common.BytesToHash([]byte{byte(i), 0x1})
+		require.Nil(t, core.WriteRecord(writer, key.Bytes(), bytes.Repeat([]byte{byte(i)}, 50)))
+	}
+	require.Nil(t, cw.Flush())
+	return buf.Bytes()
+}
+
+func TestChunkVerification(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chunkSize := 256
+	stream := createTestChunkStream(t, chunkSize, 20)
+
+	// Flip a byte in the payload of the second chunk.
+	corrupted := make([]byte, len(stream))
+	copy(corrupted, stream)
+	corrupted[chunkHeaderSize+chunkSize+chunkHeaderSize+10] ^= 0xff
+
+	cr := NewChunkReader(bytes.NewReader(corrupted))
+	numChunks := 0
+	for {
+		payload, err := cr.NextChunk()
+		if err == io.EOF {
+			break
+		}
+		if numChunks == 1 {
+			require.NotNil(err)
+			verr, ok := err.(*ChunkVerificationError)
+			require.True(ok)
+			assert.Equal(uint64(1), verr.Index)
+		} else {
+			require.Nil(err)
+			assert.True(len(payload) > 0)
+		}
+		numChunks++
+	}
+	assert.True(numChunks > 2)
+}
+
+func TestLoadStateFromChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := createTestChunkStream(t, 256, 20)
+	db := backend.NewMemDatabase()
+	assert.Nil(LoadStateFromChunks(bytes.NewReader(stream), db, nil))
+	for i := 0; i < 20; i++ {
+		key := common.BytesToHash([]byte{byte(i), 0x1})
+		value, err := db.Get(key.Bytes())
+		assert.Nil(err)
+		assert.Equal(bytes.Repeat([]byte{byte(i)}, 50), value)
+	}
+
+	stream[chunkHeaderSize+5] ^= 0xff
+	err := LoadStateFromChunks(bytes.NewReader(stream), backend.NewMemDatabase(), nil)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Snapshot chunk 0 is corrupted")
+}
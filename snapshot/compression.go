@@ -0,0 +1,164 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+)
+
+// SnapshotCompression is the compression applied to a whole snapshot file.
+type SnapshotCompression int
+
+const (
+	SnapshotCompressionNone SnapshotCompression = iota
+	SnapshotCompressionGzip
+	SnapshotCompressionZstd // only detected, to reject the zstd compressed snapshots clearly
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseSnapshotCompression parses the compression name, i.e. "none" or "gzip". zstd is
+// rejected, as there is no zstd codec in this build.
+func ParseSnapshotCompression(name string) (SnapshotCompression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return SnapshotCompressionNone, nil
+	case "gzip", "gz":
+		return SnapshotCompressionGzip, nil
+	case "zstd", "zst":
+		return SnapshotCompressionNone, fmt.Errorf("zstd snapshot compression is not supported by this build, please use gzip")
+	default:
+		return SnapshotCompressionNone, fmt.Errorf("Unknown snapshot compression: %v", name)
+	}
+}
+
+func (c SnapshotCompression) String() string {
+	switch c {
+	case SnapshotCompressionGzip:
+		return "gzip"
+	case SnapshotCompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// FileExtension returns the extension appended to the name of a compressed snapshot file.
+func (c SnapshotCompression) FileExtension() string {
+	switch c {
+	case SnapshotCompressionGzip:
+		return ".gz"
+	default:
+		return ""
+	}
+}
+
+// exportCompression returns the compression configured for the exported snapshots.
+func exportCompression() (SnapshotCompression, error) {
+	return ParseSnapshotCompression(viper.GetString(common.CfgSnapshotExportCompression))
+}
+
+// detectSnapshotCompression detects the compression of the snapshot from the magic bytes at
+// the start of the stream, without consuming them.
+func detectSnapshotCompression(reader *bufio.Reader) SnapshotCompression {
+	magic, _ := reader.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) {
+		return SnapshotCompressionGzip
+	}
+	if bytes.HasPrefix(magic, zstdMagic) {
+		return SnapshotCompressionZstd
+	}
+	return SnapshotCompressionNone
+}
+
+// newDecompressingReader returns a reader of the decompressed snapshot content, along with
+// the detected compression. An uncompressed snapshot is read as is.
+func newDecompressingReader(r io.Reader) (io.Reader, SnapshotCompression, error) {
+	reader := bufio.NewReader(r)
+	compression := detectSnapshotCompression(reader)
+	switch compression {
+	case SnapshotCompressionGzip:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, compression, fmt.Errorf("Failed to read gzip compressed snapshot: %v", err)
+		}
+		return bufio.NewReader(gzipReader), compression, nil
+	case SnapshotCompressionZstd:
+		return nil, compression, fmt.Errorf("zstd compressed snapshots are not supported by this build, please decompress the snapshot first")
+	default:
+		return reader, compression, nil
+	}
+}
+
+// snapshotFileWriter writes a snapshot file, compressing the content if requested.
+type snapshotFileWriter struct {
+	*bufio.Writer
+
+	file        *os.File
+	compressor  io.WriteCloser  // nil if not compressed
+	checksummer *checksumWriter // nil without record checksums
+	closed      bool
+}
+
+func createSnapshotFileWriter(snapshotPath string, compression SnapshotCompression) (*snapshotFileWriter, error) {
+	file, err := os.Create(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	sfw := &snapshotFileWriter{file: file}
+	if compression == SnapshotCompressionGzip {
+		sfw.compressor = gzip.NewWriter(file)
+		sfw.Writer = bufio.NewWriter(sfw.compressor)
+	} else {
+		sfw.Writer = bufio.NewWriter(file)
+	}
+	return sfw, nil
+}
+
+// enableRecordChecksums appends a checksum to each record written from now on, i.e. after
+// the snapshot header, and the trailer upon Close.
+func (sfw *snapshotFileWriter) enableRecordChecksums() error {
+	if err := sfw.Writer.Flush(); err != nil {
+		return err
+	}
+	var underlying io.Writer = sfw.file
+	if sfw.compressor != nil {
+		underlying = sfw.compressor
+	}
+	sfw.checksummer = newChecksumWriter(underlying)
+	sfw.Writer.Reset(sfw.checksummer)
+	return nil
+}
+
+// Close flushes the buffered content, finishes the compressed stream and closes the file.
+// It is safe to call more than once.
+func (sfw *snapshotFileWriter) Close() error {
+	if sfw.closed {
+		return nil
+	}
+	sfw.closed = true
+
+	err := sfw.Writer.Flush()
+	if sfw.checksummer != nil && err == nil {
+		err = sfw.checksummer.Close()
+	}
+	if sfw.compressor != nil {
+		if cerr := sfw.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := sfw.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// BuildFinalityProof assembles the finality proof of the finalized block, for a verifier trusting
+// the validator set at the trusted height. The validator set changes are read from the stake
+// transaction height list of the finalized state view.
+func BuildFinalityProof(chain *blockchain.Chain, sv *state.StoreView, blockHash common.Hash, trustedHeight uint64) (*core.FinalityProof, error) {
+	block, err := chain.FindBlock(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+	if !block.Status.IsFinalized() {
+		return nil, fmt.Errorf("Block %v is not finalized", blockHash.Hex())
+	}
+	if block.Height <= trustedHeight {
+		return nil, fmt.Errorf("Block height %v is not above the trusted height %v", block.Height, trustedHeight)
+	}
+
+	// An indirectly finalized block is an ancestor of a directly finalized one.
+	proof := &core.FinalityProof{TrustedHeight: trustedHeight}
+	proof.Headers = []*core.BlockHeader{block.BlockHeader}
+	finalized := block
+	for !finalized.Status.IsDirectlyFinalized() {
+		child, err := getFinalizedChild(finalized, chain)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, fmt.Errorf("Failed to find the finalized child of block %v", finalized.Hash().Hex())
+		}
+		finalized = child
+		proof.Headers = append(proof.Headers, child.BlockHeader)
+	}
+
+	committed, err := getCommittingChild(finalized, chain)
+	if err != nil {
+		return nil, err
+	}
+	proof.Committed = committed.BlockHeader
+	votes, err := getCommitVotes(committed, chain)
+	if err != nil {
+		return nil, err
+	}
+	proof.Votes = votes
+
+	// The votes for the committed block are cast by the validator set of the HCC of the
+	// finalized block, see Ledger.GetFinalizedValidatorCandidatePool.
+	hcc, err := chain.FindBlock(finalized.HCC.BlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find the HCC block of %v: %v", finalized.Hash().Hex(), err)
+	}
+	kvStore := kvstore.NewKVStore(sv.GetDB())
+	for _, height := range sv.GetStakeTransactionHeightList().Heights {
+		if height <= trustedHeight || height > hcc.Height {
+			continue
+		}
+		trio, err := core.GetBlockTrioByHeight(kvStore, height)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find the validator set change proof at height %v: %v", height, err)
+		}
+		proof.ProofTrios = append(proof.ProofTrios, *trio)
+	}
+	return proof, nil
+}
+
+// getCommittingChild returns the child whose parent and HCC are the directly finalized block.
+func getCommittingChild(block *core.ExtendedBlock, chain *blockchain.Chain) (*core.ExtendedBlock, error) {
+	for _, h := range block.Children {
+		b, err := chain.FindBlock(h)
+		if err != nil {
+			return nil, err
+		}
+		if (b.Status.IsFinalized() || b.Status.IsCommitted()) && b.HCC.BlockHash == block.Hash() {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("Failed to find the committed child of block %v", block.Hash().Hex())
+}
+
+// getCommitVotes returns the commit certificate votes for the block, as carried by a child.
+func getCommitVotes(block *core.ExtendedBlock, chain *blockchain.Chain) (*core.VoteSet, error) {
+	for _, h := range block.Children {
+		b, err := chain.FindBlock(h)
+		if err != nil {
+			return nil, err
+		}
+		if b.HCC.BlockHash == block.Hash() && b.HCC.Votes != nil && !b.HCC.Votes.IsEmpty() {
+			return b.HCC.Votes, nil
+		}
+	}
+	return nil, fmt.Errorf("Failed to find the commit votes for block %v", block.Hash().Hex())
+}
+
+// VerifyFinalityProof checks the finality proof against the validator set at its trusted height,
+// and returns the header of the finalized block. A proof that omits a validator set change can
+// only be endorsed by the validators before the change.
+func VerifyFinalityProof(proof *core.FinalityProof, trustedValSet *core.ValidatorSet) (*core.BlockHeader, error) {
+	verifier, err := chainVoteVerifier()
+	if err != nil {
+		return nil, err
+	}
+	if len(proof.Headers) == 0 || proof.Committed == nil || proof.Votes == nil {
+		return nil, fmt.Errorf("Incomplete finality proof")
+	}
+
+	valSet := trustedValSet
+	lastHeight := proof.TrustedHeight
+	for _, trio := range proof.ProofTrios {
+		if trio.First.Header == nil || trio.Second.Header == nil || trio.Third.Header == nil {
+			return nil, fmt.Errorf("Incomplete validator set change proof")
+		}
+		if trio.Height() <= lastHeight {
+			return nil, fmt.Errorf("Validator set change proof at height %v is out of order", trio.Height())
+		}
+		lastHeight = trio.Height()
+		if valSet, err = checkProofTrio(valSet, &trio, verifier); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 1; i < len(proof.Headers); i++ {
+		if proof.Headers[i].Parent != proof.Headers[i-1].Hash() {
+			return nil, fmt.Errorf("Header at height %v does not extend its predecessor", proof.Headers[i].Height)
+		}
+	}
+	finalized := proof.Headers[len(proof.Headers)-1]
+	if proof.Committed.Parent != finalized.Hash() || proof.Committed.HCC.BlockHash != finalized.Hash() {
+		return nil, fmt.Errorf("Committed block does not link to the finalized block %v", finalized.Hash().Hex())
+	}
+	if lastHeight >= finalized.Height {
+		return nil, fmt.Errorf("Validator set change proofs do not precede the finalized block")
+	}
+	if err := validateVotes(valSet, proof.Committed, proof.Votes, verifier); err != nil {
+		return nil, fmt.Errorf("Committed block is not endorsed by the proven validator set: %v", err)
+	}
+	return proof.Headers[0], nil
+}
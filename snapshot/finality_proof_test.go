@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestVerifyFinalityProof(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privKey1, _, _ := crypto.GenerateKeyPair()
+	privKey2, _, _ := crypto.GenerateKeyPair()
+	addr1 := privKey1.PublicKey().Address()
+	addr2 := privKey2.PublicKey().Address()
+
+	trusted := core.NewValidatorSet()
+	trusted.AddValidator(core.NewValidator(addr1.Hex(), core.MinValidatorStakeDeposit))
+
+	// The validator set changes from {addr1} to {addr2} at height 14, endorsed by addr1. Block
+	// a is indirectly finalized by its child b, which c commits.
+	trio := createTestEndorsedTrio(t, 15, privKey1, addr2)
+	a := &core.BlockHeader{ChainID: "testchain", Height: 20, Parent: trio.Third.Header.Hash(), Timestamp: big.NewInt(4)}
+	a.HCC.BlockHash = trio.Third.Header.Hash()
+	b := &core.BlockHeader{ChainID: "testchain", Height: 21, Parent: a.Hash(), Timestamp: big.NewInt(5)}
+	b.HCC.BlockHash = a.Hash()
+	c := &core.BlockHeader{ChainID: "testchain", Height: 22, Parent: b.Hash(), Timestamp: big.NewInt(6)}
+	c.HCC.BlockHash = b.Hash()
+
+	proof := &core.FinalityProof{
+		ProofTrios: []core.SnapshotBlockTrio{trio},
+		Headers:    []*core.BlockHeader{a, b},
+		Committed:  c,
+		Votes:      signedTestVoteSet(c, privKey2),
+	}
+	header, err := VerifyFinalityProof(proof, trusted)
+	require.Nil(err)
+	assert.Equal(a.Hash(), header.Hash())
+
+	raw, err := rlp.EncodeToBytes(proof)
+	require.Nil(err)
+	decoded := &core.FinalityProof{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+	header, err = VerifyFinalityProof(decoded, trusted)
+	require.Nil(err)
+	assert.Equal(a.Hash(), header.Hash())
+
+	// The votes of the validators before the change are not enough.
+	stale := *proof
+	stale.Votes = signedTestVoteSet(c, privKey1)
+	_, err = VerifyFinalityProof(&stale, trusted)
+	assert.NotNil(err)
+
+	// Nor is a validator set change not endorsed by the trusted validator set.
+	forged := *proof
+	forged.ProofTrios = []core.SnapshotBlockTrio{createTestEndorsedTrio(t, 15, privKey2, addr2)}
+	_, err = VerifyFinalityProof(&forged, trusted)
+	assert.NotNil(err)
+
+	// The headers must link to the committed block.
+	unlinked := *proof
+	unlinked.Headers = []*core.BlockHeader{b, a}
+	_, err = VerifyFinalityProof(&unlinked, trusted)
+	assert.NotNil(err)
+
+	// A change proof at or below the trusted height is rejected.
+	below := *proof
+	below.TrustedHeight = 14
+	_, err = VerifyFinalityProof(&below, trusted)
+	assert.NotNil(err)
+}
@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+var (
+	genesisHashesLock sync.RWMutex
+	genesisHashes     = map[string]common.Hash{
+		core.MainnetChainID: common.HexToHash(core.MainnetGenesisBlockHash),
+	}
+)
+
+// RegisterGenesisHash registers the genesis block hash of the given chain, so that the
+// snapshots of testnets and private chains can be validated against their own genesis.
+func RegisterGenesisHash(chainID string, genesisHash common.Hash) {
+	genesisHashesLock.Lock()
+	defer genesisHashesLock.Unlock()
+	genesisHashes[chainID] = genesisHash
+}
+
+// expectedGenesisHash returns the genesis block hash expected for the chain. The hash set in
+// the options takes precedence over the registered hash of the chain, and the hash from the
+// node config is used for the chains with no registered hash.
+func expectedGenesisHash(chainID string, opts *LoadSnapshotOptions) (common.Hash, bool) {
+	if opts != nil && !opts.GenesisHash.IsEmpty() {
+		return opts.GenesisHash, true
+	}
+
+	genesisHashesLock.RLock()
+	genesisHash, ok := genesisHashes[chainID]
+	genesisHashesLock.RUnlock()
+	if ok {
+		return genesisHash, true
+	}
+
+	configured := viper.GetString(common.CfgGenesisHash)
+	if configured == "" {
+		return common.Hash{}, false
+	}
+	return common.HexToHash(configured), true
+}
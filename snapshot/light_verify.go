@@ -0,0 +1,129 @@
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// LightVerifier follows the validator set transitions of the chain from the genesis block
+// without the state, using the same validator set change proofs as the snapshot validation.
+// It is used by the nodes which only sync the block headers.
+type LightVerifier struct {
+	mu       sync.RWMutex
+	genesis  *core.BlockHeader
+	valSet   *core.ValidatorSet // the validator set proven so far
+	provenAt uint64             // height of the block proving the validator set
+	header   *core.BlockHeader  // the latest verified header
+	verifier VoteVerifier
+}
+
+// NewLightVerifier creates a light verifier starting from the genesis block, whose validator
+// set is read from the genesis state in the database.
+func NewLightVerifier(genesis *core.BlockHeader, db database.Database, opts *LoadSnapshotOptions) (*LightVerifier, error) {
+	verifier, err := chainVoteVerifier()
+	if err != nil {
+		return nil, err
+	}
+	valSet, err := checkGenesisBlock(genesis, db, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid genesis block: %v", err)
+	}
+	return &LightVerifier{
+		genesis:  genesis,
+		valSet:   valSet,
+		provenAt: genesis.Height,
+		header:   genesis,
+		verifier: verifier,
+	}, nil
+}
+
+// ValidatorSet returns the latest proven validator set.
+func (lv *LightVerifier) ValidatorSet() *core.ValidatorSet {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return lv.valSet
+}
+
+// LatestHeader returns the latest verified block header.
+func (lv *LightVerifier) LatestHeader() *core.BlockHeader {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return lv.header
+}
+
+// VerifyHeader checks that the header is endorsed by the latest proven validator set, i.e. the
+// votes for the header have the majority, and records it as the latest verified header.
+func (lv *LightVerifier) VerifyHeader(header *core.BlockHeader, votes *core.VoteSet) error {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	if header.Height <= lv.header.Height {
+		return nil
+	}
+	if err := validateVotes(lv.valSet, header, votes, lv.verifier); err != nil {
+		return fmt.Errorf("Block %v at height %v is not endorsed by the proven validator set: %v", header.Hash().Hex(), header.Height, err)
+	}
+	lv.header = header
+	return nil
+}
+
+// VerifyMetadata follows the validator set change proofs of the snapshot metadata beyond the
+// latest verified header, and verifies the tail trio with the proven validator set. The proofs
+// have to start from the same genesis block. It returns the snapshot block, which becomes the
+// latest verified header.
+func (lv *LightVerifier) VerifyMetadata(metadata *core.SnapshotMetadata) (*core.BlockHeader, error) {
+	// The first proof only holds the genesis block.
+	if len(metadata.ProofTrios) == 0 || metadata.ProofTrios[0].Second.Header == nil {
+		return nil, fmt.Errorf("Missing the genesis block")
+	}
+	tailTrio := &metadata.TailTrio
+	if err := CheckBlockTrio(tailTrio); err != nil {
+		return nil, fmt.Errorf("Invalid tail trio: %v", err)
+	}
+	for _, trio := range metadata.ProofTrios[1:] {
+		if err := CheckBlockTrio(&trio); err != nil {
+			return nil, fmt.Errorf("Invalid validator set change proof: %v", err)
+		}
+	}
+
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	if genesis := metadata.ProofTrios[0].Second.Header; genesis.Hash() != lv.genesis.Hash() {
+		return nil, fmt.Errorf("Genesis block hash mismatch, expected: %v, actual: %v", lv.genesis.Hash().Hex(), genesis.Hash().Hex())
+	}
+
+	// Only the proofs above the proven validator set evolve it, the ones below have been
+	// followed already.
+	valSet := lv.valSet
+	var err error
+	for _, trio := range metadata.ProofTrios[1:] {
+		if trio.Second.Header.Height <= lv.provenAt {
+			continue
+		}
+		valSet, err = checkProofTrio(valSet, &trio, lv.verifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	second := tailTrio.Second.Header
+	if second.Height <= lv.header.Height {
+		return lv.header, nil
+	}
+	if err = validateVotes(valSet, tailTrio.Third.Header, tailTrio.Third.VoteSet, lv.verifier); err != nil {
+		return nil, &SnapshotError{Phase: SnapshotPhaseVotes, StoreViewHeight: tailTrio.Third.Header.Height,
+			Err: fmt.Errorf("Tail trio is not endorsed by the proven validator set: %v", err)}
+	}
+	valSet, err = getValidatorSetFromVCPProof(tailTrio.First.Header.StateHash, &tailTrio.First.Proof)
+	if err != nil {
+		return nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: tailTrio.First.Header.Height,
+			Err: fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)}
+	}
+	lv.valSet = valSet
+	lv.provenAt = second.Height
+	lv.header = second
+	return second, nil
+}
@@ -0,0 +1,69 @@
+package snapshot
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestLightVerifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privKey1, _, _ := crypto.GenerateKeyPair()
+	privKey2, _, _ := crypto.GenerateKeyPair()
+	privKey3, _, _ := crypto.GenerateKeyPair()
+	addr1 := privKey1.PublicKey().Address()
+	addr2 := privKey2.PublicKey().Address()
+	addr3 := privKey3.PublicKey().Address()
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, core.GenesisBlockHeight, addr1)
+	genesis := &core.BlockHeader{ChainID: "testchain", Height: core.GenesisBlockHeight, StateHash: sv.Hash(), Timestamp: big.NewInt(0)}
+	genesisTrio := core.SnapshotBlockTrio{Second: core.SnapshotSecondBlock{Header: genesis}}
+
+	lv, err := NewLightVerifier(genesis, db, &LoadSnapshotOptions{GenesisHash: genesis.Hash()})
+	require.Nil(err)
+	assert.Equal(genesis, lv.LatestHeader())
+	_, err = lv.ValidatorSet().GetValidator(addr1)
+	assert.Nil(err)
+
+	// The validator set changes from {addr1} to {addr2} at height 15, endorsed by addr1.
+	header, err := lv.VerifyMetadata(&core.SnapshotMetadata{
+		ProofTrios: []core.SnapshotBlockTrio{genesisTrio, createTestEndorsedTrio(t, 15, privKey1, addr2)},
+		TailTrio:   createTestEndorsedTrio(t, 20, privKey2, addr2),
+	})
+	require.Nil(err)
+	assert.Equal(uint64(20), header.Height)
+	assert.Equal(header, lv.LatestHeader())
+	_, err = lv.ValidatorSet().GetValidator(addr2)
+	assert.Nil(err)
+
+	// A fork whose validator set change is not endorsed by the proven validator set.
+	_, err = lv.VerifyMetadata(&core.SnapshotMetadata{
+		ProofTrios: []core.SnapshotBlockTrio{genesisTrio, createTestEndorsedTrio(t, 25, privKey3, addr3)},
+		TailTrio:   createTestEndorsedTrio(t, 30, privKey3, addr3),
+	})
+	assert.NotNil(err)
+	assert.Equal(uint64(20), lv.LatestHeader().Height)
+
+	// A chain with a different genesis block.
+	otherGenesis := &core.BlockHeader{ChainID: "otherchain", Height: core.GenesisBlockHeight, StateHash: sv.Hash(), Timestamp: big.NewInt(0)}
+	_, err = lv.VerifyMetadata(&core.SnapshotMetadata{
+		ProofTrios: []core.SnapshotBlockTrio{{Second: core.SnapshotSecondBlock{Header: otherGenesis}}},
+		TailTrio:   createTestEndorsedTrio(t, 30, privKey2, addr2),
+	})
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Genesis block hash mismatch")
+
+	// The headers are verified with the proven validator set.
+	next := createTestEndorsedTrio(t, 31, privKey2, addr2).Second.Header
+	assert.NotNil(lv.VerifyHeader(next, signedTestVoteSet(next, privKey3)))
+	assert.Nil(lv.VerifyHeader(next, signedTestVoteSet(next, privKey2)))
+	assert.Equal(next, lv.LatestHeader())
+}
@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// loadCheckpointKey is the database key of the progress checkpoint of a resumable load.
+var loadCheckpointKey = []byte("snapshot/loadcheckpoint")
+
+// loadCheckpoint records the progress of a resumable V3+ snapshot load. The state records
+// before Offset, counted in bytes from the start of the state section, have been committed to
+// the database, in the same batch as the checkpoint itself.
+type loadCheckpoint struct {
+	SnapshotBlockHash common.Hash
+	Version           uint64
+	Flags             uint64
+	Offset            uint64
+}
+
+// readLoadCheckpoint returns the checkpoint of the interrupted load, nil if there is none.
+func readLoadCheckpoint(db database.Database) *loadCheckpoint {
+	raw, err := db.Get(loadCheckpointKey)
+	if err != nil || len(raw) == 0 {
+		return nil
+	}
+	checkpoint := &loadCheckpoint{}
+	if err := rlp.DecodeBytes(raw, checkpoint); err != nil {
+		logger.Warnf("Ignoring invalid snapshot load checkpoint: %v", err)
+		return nil
+	}
+	return checkpoint
+}
+
+// deleteLoadCheckpoint removes the checkpoint once the load is finished.
+func deleteLoadCheckpoint(db database.Database) {
+	if has, _ := db.Has(loadCheckpointKey); has {
+		if err := db.Delete(loadCheckpointKey); err != nil {
+			logger.Warnf("Failed to delete the snapshot load checkpoint: %v", err)
+		}
+	}
+}
+
+// resumes reports whether the checkpoint was saved while loading the same snapshot.
+func (c *loadCheckpoint) resumes(other *loadCheckpoint) bool {
+	return other != nil && c.SnapshotBlockHash == other.SnapshotBlockHash && c.Version == other.Version && c.Flags == other.Flags
+}
+
+// save adds the checkpoint to the batch, so that it is committed along with the records.
+func (c *loadCheckpoint) save(batch database.Batch) error {
+	raw, err := rlp.EncodeToBytes(c)
+	if err != nil {
+		return err
+	}
+	return batch.Put(loadCheckpointKey, raw)
+}
+
+// skipSnapshotBytes advances the reader by n bytes. An uncompressed snapshot whose source
+// supports seeking is skipped without reading, otherwise the bytes are read and discarded.
+func skipSnapshotBytes(src io.Reader, reader io.Reader, compression SnapshotCompression, n uint64) error {
+	br, ok := reader.(*bufio.Reader)
+	seeker, seekable := src.(io.Seeker)
+	if ok && seekable && compression == SnapshotCompressionNone {
+		// The buffered bytes have been read from the source but not consumed yet.
+		delta := int64(n) - int64(br.Buffered())
+		if _, err := seeker.Seek(delta, io.SeekCurrent); err != nil {
+			return err
+		}
+		br.Reset(src)
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, reader, int64(n))
+	return err
+}
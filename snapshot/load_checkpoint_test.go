@@ -0,0 +1,58 @@
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestResumeSnapshotLoad(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-resume")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"), common.HexToAddress("0x2"))
+	content, err := ioutil.ReadFile(snapshotPath)
+	require.Nil(err)
+	opts := &LoadSnapshotOptions{ResumableLoad: true, WriteBatchSize: 1}
+
+	// The load is interrupted by the truncated stream, after some records are committed.
+	db := backend.NewMemDatabase()
+	_, _, err = LoadSnapshotFromReader(bytes.NewReader(content[:len(content)-3]), db, opts)
+	require.NotNil(err)
+	checkpoint := readLoadCheckpoint(db)
+	require.NotNil(checkpoint)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), checkpoint.SnapshotBlockHash)
+	assert.True(checkpoint.Offset > 0)
+
+	header, _, err := LoadSnapshot(snapshotPath, db, opts)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+	assert.Nil(readLoadCheckpoint(db))
+
+	// The resumed load matches a load from scratch, and the committed records were not
+	// loaded twice.
+	freshDB := backend.NewMemDatabase()
+	_, _, err = LoadSnapshot(snapshotPath, freshDB, &LoadSnapshotOptions{})
+	require.Nil(err)
+	require.Equal(freshDB.Len(), db.Len())
+	for _, key := range freshDB.Keys() {
+		expected, _ := freshDB.Get(key)
+		actual, err := db.Get(key)
+		require.Nil(err)
+		assert.Equal(expected, actual)
+		expectedRefs, _ := freshDB.CountReference(key)
+		actualRefs, _ := db.CountReference(key)
+		assert.Equal(expectedRefs, actualRefs)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package snapshot
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform, the snapshot files are streamed instead.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package snapshot
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the entire file into memory read-only.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
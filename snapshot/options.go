@@ -0,0 +1,273 @@
+package snapshot
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+const (
+	// avgSnapshotRecordSize is the rough average size (in bytes) of a snapshot trie record,
+	// used to translate a memory budget into a number of records.
+	avgSnapshotRecordSize = 256
+
+	minWriteBatchSize     = 1000
+	maxWriteBatchSize     = 1 << 20
+	defaultWriteBatchSize = 4096
+
+	// accountStorageProgressInterval is the number of storage records loaded between two
+	// progress reports of an account storage.
+	accountStorageProgressInterval = 100000
+
+	// defaultHeapCheckInterval is the default number of records loaded between two heap
+	// usage checks, as reading the memory stats briefly stops the world.
+	defaultHeapCheckInterval = 10000
+)
+
+// LoadSnapshotOptions tunes how a snapshot is loaded into the database.
+type LoadSnapshotOptions struct {
+	// WriteBatchSize is the number of records accumulated before a batch is committed
+	// to the database. Zero selects a default tuned to the available memory.
+	WriteBatchSize int
+
+	// ReuseRecordBuffer, if true, decodes the V2 snapshot records in a single reused buffer
+	// instead of allocating new ones for every record.
+	ReuseRecordBuffer bool
+
+	// SubChainID, if specified, loads the snapshot into the key space of the given sub-chain
+	// so that the states of multiple sub-chains can coexist in one database. Only the keys are
+	// per sub-chain: the state hash is the state root of the sub-chain's own trie, verified
+	// against the blocks of that sub-chain, as a hash mixing in the sub-chain ID would no
+	// longer match the state hash of the block headers. The genesis of the sub-chain is the
+	// one of its chain ID, or GenesisHash if specified.
+	SubChainID string
+
+	// GenesisHash, if specified, overrides the expected genesis block hash otherwise derived
+	// from the chain ID and the node config.
+	GenesisHash common.Hash
+
+	// UseMmap, if true, memory-maps the snapshot file rather than streaming it, falling back
+	// to streaming reads if mmap is unavailable.
+	UseMmap bool
+
+	// SafeLoad, if true, validates the snapshot in a temporary database before loading it
+	// into the target database, so that the target database is never left with partial data
+	// of a bad snapshot. This roughly doubles the I/O cost of the load.
+	SafeLoad bool
+
+	// ValidateInMemory, if true, validates the snapshot in a memory-backed database instead of
+	// a temporary database on disk, which avoids doubling the disk usage while validating. The
+	// content is moved to a temporary database on disk once it exceeds SpillThreshold bytes,
+	// if non-zero.
+	ValidateInMemory bool
+	SpillThreshold   uint64
+
+	// StrictRecordOrder, if true, requires the records of each store view of a V2 snapshot to
+	// arrive in ascending key order, i.e. the canonical trie traversal order of the export.
+	StrictRecordOrder bool
+
+	// FlushHeapThreshold, if non-zero, flushes the in-progress V2 store view to the database
+	// whenever the heap usage exceeds the given number of bytes. The heap usage is checked
+	// every HeapCheckInterval records, which defaults to 10000.
+	FlushHeapThreshold uint64
+	HeapCheckInterval  int
+
+	// MemoryLimit, if non-zero, caps the memory used to hold the pending state records, in
+	// bytes. The V3 write batches are committed once their records reach 1/4 of the limit,
+	// and the in-progress V2 store view is flushed once the heap usage reaches 3/4 of the
+	// limit unless FlushHeapThreshold is set. The parallel storage load, which buffers whole
+	// account storages, is disabled.
+	MemoryLimit uint64
+
+	// Availability, if specified, tracks the accounts of the snapshot block state as they are
+	// loaded, so that reads can be served from the partially loaded state. See the trust
+	// caveats of StateAvailability.
+	Availability *StateAvailability
+
+	// ResumableLoad, if true, commits the progress of loading a V3 or later snapshot along
+	// with the state records, so that a load interrupted midway resumes from the last commit
+	// instead of starting over.
+	ResumableLoad bool
+
+	// LoadParallelism is the number of workers rebuilding the account storage sub-tries of a
+	// V2 snapshot concurrently with the account trie. Values below 2 load the state
+	// sequentially. The progress callback is never called concurrently.
+	LoadParallelism int
+
+	// VerificationCacheDir, if not empty, records the successful validations in the directory,
+	// keyed by the hash of the snapshot content, so that validating the same content again
+	// returns the cached result. The entries are trusted as is, so the directory must only be
+	// writable by the node, see CfgSnapshotVerificationCache.
+	VerificationCacheDir string
+
+	// Publishers, if not empty, requires the snapshot to be signed by one of the publishers,
+	// see SignSnapshot. The signature is checked by ValidateSnapshot.
+	Publishers []common.Address
+
+	// OnAccountStorageProgress, if specified, is called periodically while the storage of
+	// an account is being loaded, and once the account storage is fully loaded.
+	OnAccountStorageProgress func(progress AccountStorageProgress)
+
+	// OnProgress, if specified, is called as the snapshot is loaded or validated, every 5% of
+	// the snapshot size and every 100000 state records. See also ProgressToChannel.
+	OnProgress func(progress LoadProgress)
+
+	applyDiff bool // set by ApplySnapshotDiff, a snapshot diff is expected
+}
+
+// AccountStorageProgress reports the loading progress of an account storage.
+type AccountStorageProgress struct {
+	Address common.Address
+	Records uint64 // number of storage records loaded so far
+	Done    bool
+}
+
+// NewLoadSnapshotOptions returns the snapshot load options specified in the node config.
+func NewLoadSnapshotOptions() *LoadSnapshotOptions {
+	return &LoadSnapshotOptions{
+		WriteBatchSize:       viper.GetInt(common.CfgSnapshotWriteBatchSize),
+		ReuseRecordBuffer:    viper.GetBool(common.CfgSnapshotReuseRecordBuffer),
+		UseMmap:              viper.GetBool(common.CfgSnapshotUseMmap),
+		SafeLoad:             viper.GetBool(common.CfgSnapshotSafeLoad),
+		ValidateInMemory:     viper.GetBool(common.CfgSnapshotValidateInMemory),
+		SpillThreshold:       viper.GetUint64(common.CfgSnapshotSpillThresholdMB) * 1024 * 1024,
+		StrictRecordOrder:    viper.GetBool(common.CfgSnapshotStrictRecordOrder),
+		FlushHeapThreshold:   viper.GetUint64(common.CfgSnapshotFlushHeapThresholdMB) * 1024 * 1024,
+		MemoryLimit:          viper.GetUint64(common.CfgSnapshotMemoryLimitMB) * 1024 * 1024,
+		VerificationCacheDir: verificationCacheDir(),
+		LoadParallelism:      viper.GetInt(common.CfgSnapshotLoadParallelism),
+		ResumableLoad:        viper.GetBool(common.CfgSnapshotResumableLoad),
+		Publishers:           snapshotPublishers(),
+	}
+}
+
+// SubChainDB returns a view of the database where all the keys are prefixed with the key
+// prefix of the given sub-chain.
+func SubChainDB(db database.Database, subChainID string) database.Database {
+	return backend.NewTable(db, subChainKeyPrefix(subChainID))
+}
+
+func subChainKeyPrefix(subChainID string) string {
+	return "sc/" + subChainID + "/"
+}
+
+// writeBatchSize returns the effective write batch size.
+func (opts *LoadSnapshotOptions) writeBatchSize() int {
+	if opts != nil && opts.WriteBatchSize > 0 {
+		return opts.WriteBatchSize
+	}
+	availableMem := availableMemory()
+	if opts != nil && opts.MemoryLimit > 0 && (availableMem == 0 || opts.MemoryLimit < availableMem) {
+		availableMem = opts.MemoryLimit
+	}
+	return autoWriteBatchSize(availableMem)
+}
+
+// writeBatchBytes returns the size in bytes of the records above which a write batch is
+// committed regardless of its number of records, or 0 if unbounded.
+func (opts *LoadSnapshotOptions) writeBatchBytes() uint64 {
+	if opts == nil {
+		return 0
+	}
+	return opts.MemoryLimit / 4
+}
+
+// flushHeapThreshold returns the heap usage above which the in-progress V2 store view is
+// flushed, or 0 if the heap usage based flush is disabled.
+func (opts *LoadSnapshotOptions) flushHeapThreshold() uint64 {
+	if opts == nil {
+		return 0
+	}
+	if opts.FlushHeapThreshold > 0 {
+		return opts.FlushHeapThreshold
+	}
+	return opts.MemoryLimit / 4 * 3
+}
+
+// heapCheckInterval returns the number of records loaded between two heap usage checks, or 0
+// if the heap usage based flush is disabled.
+func (opts *LoadSnapshotOptions) heapCheckInterval() int {
+	if opts.flushHeapThreshold() == 0 {
+		return 0
+	}
+	if opts.HeapCheckInterval > 0 {
+		return opts.HeapCheckInterval
+	}
+	return defaultHeapCheckInterval
+}
+
+// loadParallelism returns the number of workers loading the account storages.
+func (opts *LoadSnapshotOptions) loadParallelism() int {
+	if opts == nil || opts.MemoryLimit > 0 {
+		return 1
+	}
+	return opts.LoadParallelism
+}
+
+// heapExceedsThreshold reports whether the heap usage exceeds the flush threshold.
+func (opts *LoadSnapshotOptions) heapExceedsThreshold() bool {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return memStats.HeapAlloc > opts.flushHeapThreshold()
+}
+
+// stateAvailability returns the account availability tracker, nil if not specified.
+func (opts *LoadSnapshotOptions) stateAvailability() *StateAvailability {
+	if opts == nil {
+		return nil
+	}
+	return opts.Availability
+}
+
+func (opts *LoadSnapshotOptions) reportAccountStorageProgress(progress AccountStorageProgress) {
+	if opts != nil && opts.OnAccountStorageProgress != nil {
+		opts.OnAccountStorageProgress(progress)
+	}
+}
+
+// autoWriteBatchSize dedicates roughly 1/256 of the available memory to the pending write
+// batch. Falls back to a conservative default if the available memory is unknown.
+func autoWriteBatchSize(availableMem uint64) int {
+	if availableMem == 0 {
+		return defaultWriteBatchSize
+	}
+	size := availableMem / 256 / avgSnapshotRecordSize
+	if size < minWriteBatchSize {
+		return minWriteBatchSize
+	}
+	if size > maxWriteBatchSize {
+		return maxWriteBatchSize
+	}
+	return int(size)
+}
+
+// availableMemory returns the memory available on the host in bytes, or 0 if it cannot be
+// determined.
+func availableMemory() uint64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+)
+
+const (
+	// storageChunkSize is the number of storage records handed over to a worker at a time.
+	storageChunkSize = 4096
+	// storageJobChunks is the number of chunks of an account storage buffered for its worker.
+	storageJobChunks = 2
+)
+
+// storageJob is the storage of an account read from a V2 snapshot, streamed in chunks to the
+// worker rebuilding its sub-trie.
+type storageJob struct {
+	account *types.Account
+	height  uint64
+	chunks  chan []core.SnapshotTrieRecord
+
+	// Only accessed by the snapshot reader, or by the worker once chunks is closed.
+	chunk        []core.SnapshotTrieRecord // chunk being filled by the snapshot reader
+	recordOffset uint64                    // offset of the storage end record, for error reporting
+	aborted      bool                      // set if the snapshot reader stopped midway
+	closed       bool
+}
+
+func newStorageJob(account *types.Account, height uint64) *storageJob {
+	return &storageJob{
+		account: account,
+		height:  height,
+		chunks:  make(chan []core.SnapshotTrieRecord, storageJobChunks),
+	}
+}
+
+// add appends the record to the storage, handing the chunk over to the worker once full,
+// which blocks while the worker is behind. The record is retained, so is copied by the caller.
+func (job *storageJob) add(record core.SnapshotTrieRecord) {
+	job.chunk = append(job.chunk, record)
+	if len(job.chunk) >= storageChunkSize {
+		job.chunks <- job.chunk
+		job.chunk = nil
+	}
+}
+
+// finish hands the last chunk over to the worker, and marks the end of the storage.
+func (job *storageJob) finish(recordOffset uint64) {
+	if len(job.chunk) > 0 {
+		job.chunks <- job.chunk
+		job.chunk = nil
+	}
+	job.recordOffset = recordOffset
+	job.closed = true
+	close(job.chunks)
+}
+
+// abort marks the end of the storage if the snapshot reader stopped before reaching it, so
+// that the worker discards the storage.
+func (job *storageJob) abort() {
+	if job.closed {
+		return
+	}
+	job.chunk = nil
+	job.aborted = true
+	job.closed = true
+	close(job.chunks)
+}
+
+// storageLoader rebuilds the account storage sub-tries of a V2 snapshot on a pool of workers,
+// while the account trie itself is loaded sequentially. The account storages are streamed to
+// the workers in chunks, so an account storage never holds more than storageJobChunks+2
+// chunks in memory, and at most twice the parallelism number of account storages are queued
+// or loading at a time.
+type storageLoader struct {
+	db   database.Database
+	opts *LoadSnapshotOptions
+
+	jobs chan *storageJob
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex // protects err and serializes the progress callbacks
+	err    error
+	closed bool
+}
+
+func newStorageLoader(db database.Database, parallelism int, opts *LoadSnapshotOptions) *storageLoader {
+	sl := &storageLoader{
+		db:   db,
+		opts: opts,
+		jobs: make(chan *storageJob, parallelism),
+	}
+	for i := 0; i < parallelism; i++ {
+		sl.wg.Add(1)
+		go func() {
+			defer sl.wg.Done()
+			for job := range sl.jobs {
+				if sl.failed() {
+					// Drained so that the snapshot reader isn't blocked.
+					for range job.chunks {
+					}
+					continue
+				}
+				if err := sl.load(job); err != nil {
+					sl.fail(err)
+				}
+			}
+		}()
+	}
+	return sl
+}
+
+// submit queues the account storage before its records are added, blocking while all the
+// workers are busy. It returns the error of a previously failed job, if any.
+func (sl *storageLoader) submit(job *storageJob) error {
+	sl.mu.Lock()
+	err := sl.err
+	sl.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	sl.jobs <- job
+	return nil
+}
+
+// wait waits for the queued account storages to be loaded and stops the workers. It is safe
+// to call more than once.
+func (sl *storageLoader) wait() error {
+	sl.mu.Lock()
+	if !sl.closed {
+		sl.closed = true
+		close(sl.jobs)
+	}
+	sl.mu.Unlock()
+
+	sl.wg.Wait()
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.err
+}
+
+func (sl *storageLoader) load(job *storageJob) error {
+	addr := job.account.Address
+	sv := state.NewStoreView(job.height, common.Hash{}, sl.db)
+	heapCheckInterval := sl.opts.heapCheckInterval()
+	numRecords := uint64(0)
+	for chunk := range job.chunks {
+		for _, record := range chunk {
+			sv.Set(record.K, record.V)
+			numRecords++
+			if heapCheckInterval > 0 && numRecords%uint64(heapCheckInterval) == 0 && sl.opts.heapExceedsThreshold() {
+				sv.Save()
+			}
+			if numRecords%accountStorageProgressInterval == 0 {
+				logger.Infof("Loading storage for account %v, %v records loaded", addr.Hex(), numRecords)
+				sl.reportProgress(AccountStorageProgress{Address: addr, Records: numRecords})
+			}
+		}
+	}
+	if job.aborted {
+		return nil
+	}
+
+	hash := sv.Save()
+	if job.account.Root != hash {
+		return &SnapshotError{Phase: SnapshotPhaseState, RecordOffset: job.recordOffset, StoreViewHeight: job.height, AccountAddress: &addr,
+			Err: fmt.Errorf("Account storage root doesn't match, expected: %v, calculated: %v", job.account.Root.Hex(), hash.Hex())}
+	}
+	sl.opts.stateAvailability().addAccount(job.height, job.account)
+	sl.reportProgress(AccountStorageProgress{Address: addr, Records: numRecords, Done: true})
+	return nil
+}
+
+func (sl *storageLoader) reportProgress(progress AccountStorageProgress) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.opts.reportAccountStorageProgress(progress)
+}
+
+func (sl *storageLoader) failed() bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.err != nil
+}
+
+func (sl *storageLoader) fail(err error) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.err == nil {
+		sl.err = err
+	}
+}
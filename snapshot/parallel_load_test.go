@@ -0,0 +1,135 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestLoadStateParallel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcDB := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, srcDB)
+	for i := 1; i <= 20; i++ {
+		values := []string{}
+		for j := 0; j < i; j++ {
+			values = append(values, fmt.Sprintf("value-%v-%v", i, j))
+		}
+		setTestContractAccount(sv, srcDB, common.BigToAddress(big.NewInt(int64(i))), values...)
+	}
+	sv.SetAccount(common.HexToAddress("0xabc"), &types.Account{Address: common.HexToAddress("0xabc"), Balance: types.NewCoins(1, 2)})
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	writeStoreView(sv, true, writer, srcDB, 0)
+
+	sequentialDB := backend.NewMemDatabase()
+	sequentialSV, _, err := loadStateV2(bytes.NewReader(buf.Bytes()), sequentialDB, nil, 0, &LoadSnapshotOptions{})
+	require.Nil(err)
+	assert.Equal(stateHash, sequentialSV.Hash())
+
+	mu := &sync.Mutex{}
+	done := map[common.Address]bool{}
+	availability := NewStateAvailability()
+	availability.start(10)
+	opts := &LoadSnapshotOptions{
+		LoadParallelism: 4,
+		Availability:    availability,
+		OnAccountStorageProgress: func(progress AccountStorageProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			if progress.Done {
+				done[progress.Address] = true
+			}
+		},
+	}
+	parallelDB := backend.NewMemDatabase()
+	parallelSV, _, err := loadStateV2(bytes.NewReader(buf.Bytes()), parallelDB, nil, 0, opts)
+	require.Nil(err)
+	assert.Equal(stateHash, parallelSV.Hash())
+	assert.Equal(20, len(done))
+
+	require.Equal(sequentialDB.Len(), parallelDB.Len())
+	for _, key := range sequentialDB.Keys() {
+		expected, _ := sequentialDB.Get(key)
+		actual, err := parallelDB.Get(key)
+		require.Nil(err)
+		assert.Equal(expected, actual)
+	}
+
+	account, availabilityState := availability.GetAccount(common.BigToAddress(big.NewInt(7)))
+	require.NotNil(account)
+	assert.Equal(AccountUnverified, availabilityState)
+}
+
+func TestLoadStateParallelBadAccountRoot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := common.HexToAddress("0x1")
+	account := &types.Account{Address: addr, Balance: types.NewCoins(0, 0), Root: common.HexToHash("a1")}
+	accountBytes, err := types.ToBytes(account)
+	require.Nil(err)
+
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	height := core.Itobytes(10)
+	require.Nil(core.WriteRecord(writer, []byte{core.SVStart}, height))
+	require.Nil(core.WriteRecord(writer, state.AccountKey(addr), accountBytes))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVStart}, height))
+	require.Nil(core.WriteRecord(writer, common.Bytes("storage"), common.Bytes("value")))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVEnd}, height))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVEnd}, height))
+	require.Nil(writer.Flush())
+
+	_, _, err = loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{LoadParallelism: 2})
+	snapshotErr := requireSnapshotError(t, err)
+	assert.Equal(SnapshotPhaseState, snapshotErr.Phase)
+	require.NotNil(snapshotErr.AccountAddress)
+	assert.Equal(addr, *snapshotErr.AccountAddress)
+	assert.Contains(err.Error(), "Account storage root doesn't match")
+}
+
+func TestLoadStateParallelChunkedStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srcDB := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, srcDB)
+	for i := 1; i <= 3; i++ {
+		// The storages span several chunks, the last one partially filled.
+		values := []string{}
+		for j := 0; j < storageChunkSize*(storageJobChunks+1)+i; j++ {
+			values = append(values, fmt.Sprintf("value-%v-%v", i, j))
+		}
+		setTestContractAccount(sv, srcDB, common.BigToAddress(big.NewInt(int64(i))), values...)
+	}
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	writeStoreView(sv, true, writer, srcDB, 0)
+
+	parallelSV, _, err := loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{LoadParallelism: 2})
+	require.Nil(err)
+	assert.Equal(stateHash, parallelSV.Hash())
+
+	// A snapshot ending within an account storage fails without blocking the workers.
+	truncated := buf.Bytes()[:buf.Len()/2]
+	_, _, err = loadStateV2(bytes.NewReader(truncated), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{LoadParallelism: 2})
+	assert.NotNil(err)
+}
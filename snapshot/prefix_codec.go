@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// Prefix compression
+//
+// Keys of the records within a store view are sorted, and often share long prefixes (e.g. the
+// account storage keys). With prefix compression, each record only carries the length of
+// the prefix shared with the previous key and the remaining suffix. The previous key is reset
+// at every store view start and end marker, so the markers are always written in full.
+
+func isStoreViewMarker(k common.Bytes) bool {
+	return bytes.Equal(k, []byte{core.SVStart}) || bytes.Equal(k, []byte{core.SVEnd})
+}
+
+// recordWriter writes the V2 snapshot records in the encoding selected by the codec flags of
+// the snapshot header, i.e. plain, typed or prefix compressed.
+type recordWriter struct {
+	writer      *bufio.Writer
+	recordFlags uint
+	prevKey     common.Bytes
+}
+
+func newRecordWriter(writer *bufio.Writer, recordFlags uint) *recordWriter {
+	return &recordWriter{
+		writer:      writer,
+		recordFlags: recordFlags,
+	}
+}
+
+func (rw *recordWriter) write(recordType core.SnapshotRecordType, k, v common.Bytes) error {
+	if rw.recordFlags&core.SnapshotTypedRecords != 0 {
+		return core.WriteTypedRecord(rw.writer, recordType, k, v)
+	}
+	if rw.recordFlags&core.SnapshotPrefixCompressed == 0 {
+		return core.WriteRecord(rw.writer, k, v)
+	}
+	if isStoreViewMarker(k) {
+		rw.prevKey = nil
+		return core.WriteCompressedRecord(rw.writer, 0, k, v)
+	}
+	sharedLen := commonPrefixLen(rw.prevKey, k)
+	rw.prevKey = common.CopyBytes(k)
+	return core.WriteCompressedRecord(rw.writer, uint64(sharedLen), k[sharedLen:], v)
+}
+
+// newRecordReader returns the function to read the V2 snapshot records encoded with the
+// given codec flags of the snapshot header.
+func newRecordReader(reader io.Reader, recordFlags uint) func(record *core.SnapshotTrieRecord) (uint64, error) {
+	if recordFlags&core.SnapshotTypedRecords != 0 {
+		return func(record *core.SnapshotTrieRecord) (uint64, error) {
+			typed := core.SnapshotTypedTrieRecord{}
+			size, err := core.ReadRecord(reader, &typed)
+			if err != nil {
+				return 0, err
+			}
+			if typed.Type == core.SnapshotRecordUntyped {
+				return 0, fmt.Errorf("Missing type of the snapshot record %v", typed.K.String())
+			}
+			record.K = typed.K
+			record.V = typed.V
+			record.Type = typed.Type
+			return size, nil
+		}
+	}
+	if recordFlags&core.SnapshotPrefixCompressed != 0 {
+		return newPrefixDecoder(reader).read
+	}
+	return func(record *core.SnapshotTrieRecord) (uint64, error) {
+		return core.ReadRecord(reader, record)
+	}
+}
+
+// checkSnapshotVersion checks that the snapshot format version can be loaded by this node.
+func checkSnapshotVersion(snapshotHeader *core.SnapshotHeader) error {
+	version := snapshotHeader.FormatVersion()
+	if version < core.MinSnapshotFormatVersion {
+		return fmt.Errorf("Version %v snapshots are no longer supported, the oldest supported version is %v", version, core.MinSnapshotFormatVersion)
+	}
+	if version > core.CurrentSnapshotFormatVersion {
+		return fmt.Errorf("Version %v snapshots are not supported, the latest supported version is %v, please upgrade the node", version, core.CurrentSnapshotFormatVersion)
+	}
+	return nil
+}
+
+// checkSnapshotMetadataVersion checks that the snapshot metadata version can be loaded by this node.
+func checkSnapshotMetadataVersion(metadata *core.SnapshotMetadata) error {
+	if metadata.Version > core.CurrentSnapshotMetadataVersion {
+		return fmt.Errorf("Snapshot metadata version %v is not supported, the latest supported version is %v, please upgrade the node", metadata.Version, core.CurrentSnapshotMetadataVersion)
+	}
+	return nil
+}
+
+// checkRecordFlags checks that the codec flags are supported by the snapshot version.
+func checkRecordFlags(snapshotHeader *core.SnapshotHeader) error {
+	if snapshotHeader.CodecFlags() == 0 {
+		return nil
+	}
+	if snapshotHeader.FormatVersion() != 2 {
+		return fmt.Errorf("Record codec flags %v are not supported for version %v snapshots", snapshotHeader.CodecFlags(), snapshotHeader.FormatVersion())
+	}
+	if snapshotHeader.IsPrefixCompressed() && snapshotHeader.HasTypedRecords() {
+		return fmt.Errorf("Prefix compressed typed records are not supported")
+	}
+	return nil
+}
+
+// prefixDecoder reads prefix compressed records and restores the full keys.
+type prefixDecoder struct {
+	reader  io.Reader
+	prevKey common.Bytes
+}
+
+func newPrefixDecoder(reader io.Reader) *prefixDecoder {
+	return &prefixDecoder{
+		reader: reader,
+	}
+}
+
+func (d *prefixDecoder) read(record *core.SnapshotTrieRecord) (uint64, error) {
+	compressed := core.SnapshotCompressedTrieRecord{}
+	size, err := core.ReadRecord(d.reader, &compressed)
+	if err != nil {
+		return 0, err
+	}
+	if compressed.SharedLen > uint64(len(d.prevKey)) {
+		return 0, fmt.Errorf("Invalid shared prefix length %v, previous key length: %v", compressed.SharedLen, len(d.prevKey))
+	}
+
+	key := make(common.Bytes, 0, int(compressed.SharedLen)+len(compressed.KSuffix))
+	key = append(key, d.prevKey[:compressed.SharedLen]...)
+	key = append(key, compressed.KSuffix...)
+	if isStoreViewMarker(key) {
+		d.prevKey = nil
+	} else {
+		d.prevKey = key
+	}
+
+	record.K = key
+	record.V = compressed.V
+	return size, nil
+}
+
+func commonPrefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,103 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func readTestRecords(t *testing.T, readRecord func(record *core.SnapshotTrieRecord) (uint64, error)) []core.SnapshotTrieRecord {
+	records := []core.SnapshotTrieRecord{}
+	for {
+		record := core.SnapshotTrieRecord{}
+		_, err := readRecord(&record)
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestPrefixCompressedStoreView(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 50; j++ {
+			key := fmt.Sprintf("ss/storage/%v/%v", common.BigToHash(big.NewInt(int64(i))).Hex(), j)
+			sv.Set(common.Bytes(key), common.Bytes(fmt.Sprintf("value%v", j)))
+		}
+	}
+	stateHash := sv.Save()
+
+	plain := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(plain), db, 0)
+	compressed := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(compressed), db, core.SnapshotPrefixCompressed)
+	assert.True(compressed.Len() < plain.Len()/2, "compressed: %v, plain: %v", compressed.Len(), plain.Len())
+
+	plainReader := bytes.NewReader(plain.Bytes())
+	plainRecords := readTestRecords(t, func(record *core.SnapshotTrieRecord) (uint64, error) {
+		return core.ReadRecord(plainReader, record)
+	})
+	decodedRecords := readTestRecords(t, newPrefixDecoder(bytes.NewReader(compressed.Bytes())).read)
+	assert.Equal(plainRecords, decodedRecords)
+
+	_, hash, err := loadStateV2(bytes.NewReader(compressed.Bytes()), backend.NewMemDatabase(), nil, core.SnapshotPrefixCompressed, nil)
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+}
+
+func TestLoadTypedRecords(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, common.HexToAddress("0x1"), "a", "b", "c")
+	sv.Set(common.Bytes("key"), common.Bytes("value"))
+	stateHash := sv.Save()
+
+	typed := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(typed), db, core.SnapshotTypedRecords)
+	_, hash, err := loadStateV2(bytes.NewReader(typed.Bytes()), backend.NewMemDatabase(), nil, core.SnapshotTypedRecords, nil)
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+
+	// The accounts are identified by the record type rather than the key prefix.
+	storage := state.NewStoreView(10, common.Hash{}, db)
+	storage.Set(common.Bytes("storage"), common.Bytes("value"))
+	account := &types.Account{Balance: types.NewCoins(0, 0), Root: storage.Save()}
+	accountBytes, err := types.ToBytes(account)
+	require.Nil(err)
+
+	records := &bytes.Buffer{}
+	writer := bufio.NewWriter(records)
+	height := core.Itobytes(10)
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordSVStart, []byte{core.SVStart}, height))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordAccount, common.Bytes("contract"), accountBytes))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordSVStart, []byte{core.SVStart}, height))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordState, common.Bytes("storage"), common.Bytes("value")))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordSVEnd, []byte{core.SVEnd}, height))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordState, common.Bytes("ls/a-not-an-account"), common.Bytes("value")))
+	require.Nil(core.WriteTypedRecord(writer, core.SnapshotRecordSVEnd, []byte{core.SVEnd}, height))
+	require.Nil(writer.Flush())
+
+	_, _, err = loadStateV2(bytes.NewReader(records.Bytes()), backend.NewMemDatabase(), nil, core.SnapshotTypedRecords, nil)
+	assert.Nil(err)
+}
@@ -0,0 +1,161 @@
+package snapshot
+
+import (
+	"sync"
+)
+
+// progressReportInterval is the number of state records loaded between two progress reports,
+// in addition to the reports at every 5% of the snapshot size.
+const progressReportInterval = 100000
+
+// LoadProgress reports the progress of a snapshot load or validation.
+type LoadProgress struct {
+	Operation        string // e.g. "Importing Snapshot" or "Validating Snapshot"
+	Phase            SnapshotPhase
+	RecordsProcessed uint64
+	BytesRead        uint64
+
+	// EstimatedTotalBytes is the estimated number of bytes of the state records, zero if
+	// unknown, e.g. for a compressed or streamed snapshot.
+	EstimatedTotalBytes uint64
+
+	Done   bool
+	Failed bool
+}
+
+// Percentage returns the estimated completion percentage, or -1 if the total is unknown.
+func (p LoadProgress) Percentage() int {
+	if p.Done && !p.Failed {
+		return 100
+	}
+	if p.EstimatedTotalBytes == 0 {
+		return -1
+	}
+	percentage := p.BytesRead * 100 / p.EstimatedTotalBytes
+	if percentage > 99 {
+		percentage = 99 // the checks are still pending
+	}
+	return int(percentage)
+}
+
+// ProgressToChannel returns a progress callback which forwards the reports to the channel.
+// Reports are dropped rather than blocking the load if the channel is full.
+func ProgressToChannel(ch chan<- LoadProgress) func(LoadProgress) {
+	return func(progress LoadProgress) {
+		select {
+		case ch <- progress:
+		default:
+		}
+	}
+}
+
+var (
+	latestProgressMu sync.RWMutex
+	latestProgress   *LoadProgress
+)
+
+// LatestLoadProgress returns the progress of the latest snapshot load or validation of the
+// process, false if no snapshot has been loaded.
+func LatestLoadProgress() (LoadProgress, bool) {
+	latestProgressMu.RLock()
+	defer latestProgressMu.RUnlock()
+	if latestProgress == nil {
+		return LoadProgress{}, false
+	}
+	return *latestProgress, true
+}
+
+func setLatestLoadProgress(progress LoadProgress) {
+	latestProgressMu.Lock()
+	defer latestProgressMu.Unlock()
+	latestProgress = &progress
+}
+
+// progressReporter logs the loading progress, and reports it to the progress callback and
+// to LatestLoadProgress. A nil reporter reports nothing.
+type progressReporter struct {
+	progress       LoadProgress
+	onProgress     func(LoadProgress)
+	lastPercentage uint64
+}
+
+func newProgressReporter(operation string, totalBytes uint64, opts *LoadSnapshotOptions) *progressReporter {
+	pr := &progressReporter{
+		progress: LoadProgress{
+			Operation:           operation,
+			Phase:               SnapshotPhaseMetadata,
+			EstimatedTotalBytes: totalBytes,
+		},
+	}
+	if opts != nil {
+		pr.onProgress = opts.OnProgress
+	}
+	pr.report()
+	return pr
+}
+
+func (pr *progressReporter) report() {
+	setLatestLoadProgress(pr.progress)
+	if pr.onProgress != nil {
+		pr.onProgress(pr.progress)
+	}
+}
+
+// setPhase reports the start of the given phase.
+func (pr *progressReporter) setPhase(phase SnapshotPhase) {
+	if pr == nil {
+		return
+	}
+	pr.progress.Phase = phase
+	pr.report()
+}
+
+// skip accounts for the bytes skipped when a load resumes.
+func (pr *progressReporter) skip(numBytes uint64) {
+	if pr == nil {
+		return
+	}
+	pr.progress.BytesRead += numBytes
+}
+
+// record accounts for a state record of the given size.
+func (pr *progressReporter) record(size uint64) {
+	if pr == nil {
+		return
+	}
+	pr.progress.RecordsProcessed++
+	pr.progress.BytesRead += size
+
+	reported := false
+	if total := pr.progress.EstimatedTotalBytes; total >= 100 {
+		percentage := pr.progress.BytesRead / (total / 100)
+		if percentage > pr.lastPercentage && percentage <= 100 && percentage%5 == 0 {
+			logger.Infof("%s, %v%% done.", pr.progress.Operation, percentage)
+			pr.lastPercentage = percentage
+			pr.report()
+			reported = true
+		}
+	}
+	if !reported && pr.progress.RecordsProcessed%progressReportInterval == 0 {
+		pr.report()
+	}
+}
+
+// stateLoaded logs the completion of the state records.
+func (pr *progressReporter) stateLoaded() {
+	if pr == nil {
+		return
+	}
+	logger.Infof("%s, 100%% done.", pr.progress.Operation)
+	pr.report()
+}
+
+// done reports the end of the load.
+func (pr *progressReporter) done(err error) {
+	if pr == nil {
+		return
+	}
+	pr.progress.Done = true
+	pr.progress.Failed = err != nil
+	pr.report()
+}
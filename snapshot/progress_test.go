@@ -0,0 +1,60 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestLoadSnapshotProgress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-progress")
+	writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+
+	reports := make(chan LoadProgress, 100)
+	opts := &LoadSnapshotOptions{OnProgress: ProgressToChannel(reports)}
+	_, _, err := loadSnapshot(snapshotPath, backend.NewMemDatabase(), "Testing", opts)
+	require.Nil(err)
+	close(reports)
+
+	phases := []SnapshotPhase{}
+	var last LoadProgress
+	for report := range reports {
+		assert.Equal("Testing", report.Operation)
+		assert.True(report.BytesRead >= last.BytesRead)
+		if len(phases) == 0 || phases[len(phases)-1] != report.Phase {
+			phases = append(phases, report.Phase)
+		}
+		last = report
+	}
+	assert.Equal([]SnapshotPhase{SnapshotPhaseMetadata, SnapshotPhaseState, SnapshotPhaseVotes}, phases)
+	assert.True(last.Done)
+	assert.False(last.Failed)
+	assert.True(last.RecordsProcessed > 0)
+	assert.True(last.EstimatedTotalBytes > 0)
+	assert.Equal(100, last.Percentage())
+
+	latest, ok := LatestLoadProgress()
+	require.True(ok)
+	assert.Equal(last, latest)
+}
+
+func TestLoadProgressPercentage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(-1, LoadProgress{BytesRead: 10}.Percentage())
+	assert.Equal(25, LoadProgress{BytesRead: 25, EstimatedTotalBytes: 100}.Percentage())
+	assert.Equal(99, LoadProgress{BytesRead: 120, EstimatedTotalBytes: 100}.Percentage())
+	assert.Equal(100, LoadProgress{Done: true}.Percentage())
+	assert.Equal(-1, LoadProgress{Done: true, Failed: true}.Percentage())
+}
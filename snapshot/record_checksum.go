@@ -0,0 +1,227 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// Record checksums
+//
+// With core.SnapshotChecksummed set in the header, every length prefixed record following the
+// header is followed by the CRC32C of its length and content, and the records are terminated
+// by a trailer: the trailerRecordLength marker followed by the SHA256 of everything written
+// after the header. The checksums are verified as the records are read, so a corrupted
+// download fails at the offending record rather than deep inside the trie validation.
+
+const (
+	recordChecksumSize  = 4
+	trailerRecordLength = ^uint64(0)
+
+	// maxChecksummedRecordSize bounds the length of a record, so that a corrupted length is
+	// reported rather than attempting a huge allocation.
+	maxChecksummedRecordSize = 1 << 30
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RecordChecksumError is returned when a snapshot record doesn't match its checksum.
+type RecordChecksumError struct {
+	Index  uint64 // index of the record following the header
+	Offset uint64 // offset of the record from the end of the header
+	Err    error
+}
+
+func (e *RecordChecksumError) Error() string {
+	return fmt.Sprintf("Snapshot record %v at offset %v is corrupted: %v", e.Index, e.Offset, e.Err)
+}
+
+// recordReadError describes the failure to read a snapshot record, keeping a checksum error
+// as is so that the offending record can be identified.
+func recordReadError(err error) error {
+	if _, ok := err.(*RecordChecksumError); ok {
+		return err
+	}
+	return fmt.Errorf("Failed to read snapshot record, %v", err)
+}
+
+// recordChecksums returns whether the exported snapshots carry record checksums.
+func recordChecksums() bool {
+	return viper.GetBool(common.CfgSnapshotRecordChecksums)
+}
+
+// newSectionReader returns the reader of the sections following the snapshot header, which
+// verifies the record checksums if the snapshot has any.
+func newSectionReader(reader io.Reader, snapshotHeader *core.SnapshotHeader) io.Reader {
+	if snapshotHeader.HasRecordChecksums() {
+		return newChecksumReader(reader)
+	}
+	return reader
+}
+
+// checksumWriter appends the checksum to each record written through it, and writes the
+// trailer upon Close. The records may be written in arbitrary pieces.
+type checksumWriter struct {
+	writer    io.Writer
+	digest    hash.Hash
+	lenBuf    [8]byte
+	lenFilled int
+	remaining uint64 // bytes of the current record content still to be written
+	crc       uint32
+}
+
+func newChecksumWriter(writer io.Writer) *checksumWriter {
+	return &checksumWriter{
+		writer: writer,
+		digest: sha256.New(),
+	}
+}
+
+func (cw *checksumWriter) emit(p []byte) error {
+	cw.digest.Write(p)
+	_, err := cw.writer.Write(p)
+	return err
+}
+
+func (cw *checksumWriter) endRecord() error {
+	var crcBuf [recordChecksumSize]byte
+	binary.LittleEndian.PutUint32(crcBuf[:], cw.crc)
+	cw.lenFilled = 0
+	return cw.emit(crcBuf[:])
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if cw.lenFilled < len(cw.lenBuf) {
+			n := copy(cw.lenBuf[cw.lenFilled:], p)
+			cw.lenFilled += n
+			p = p[n:]
+			written += n
+			if cw.lenFilled < len(cw.lenBuf) {
+				break
+			}
+			cw.remaining = core.Bytestoi(cw.lenBuf[:])
+			cw.crc = crc32.Update(0, crc32cTable, cw.lenBuf[:])
+			if err := cw.emit(cw.lenBuf[:]); err != nil {
+				return written, err
+			}
+		} else {
+			n := len(p)
+			if uint64(n) > cw.remaining {
+				n = int(cw.remaining)
+			}
+			cw.crc = crc32.Update(cw.crc, crc32cTable, p[:n])
+			if err := cw.emit(p[:n]); err != nil {
+				return written, err
+			}
+			cw.remaining -= uint64(n)
+			p = p[n:]
+			written += n
+		}
+		if cw.lenFilled == len(cw.lenBuf) && cw.remaining == 0 {
+			if err := cw.endRecord(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the trailer. It doesn't close the underlying writer.
+func (cw *checksumWriter) Close() error {
+	if cw.lenFilled != 0 {
+		return fmt.Errorf("Incomplete snapshot record, %v bytes missing", cw.remaining)
+	}
+	sum := cw.digest.Sum(nil)
+	if _, err := cw.writer.Write(core.Itobytes(trailerRecordLength)); err != nil {
+		return err
+	}
+	_, err := cw.writer.Write(sum)
+	return err
+}
+
+// checksumReader verifies the record checksums and the trailer, and passes the records on
+// without the checksums. It returns io.EOF once the trailer is verified.
+type checksumReader struct {
+	reader  io.Reader
+	digest  hash.Hash
+	pending []byte
+	index   uint64
+	offset  uint64
+	err     error
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	return &checksumReader{
+		reader: reader,
+		digest: sha256.New(),
+	}
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	for len(cr.pending) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		cr.err = cr.next()
+	}
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	return n, nil
+}
+
+func (cr *checksumReader) corrupted(format string, args ...interface{}) error {
+	return &RecordChecksumError{Index: cr.index, Offset: cr.offset, Err: fmt.Errorf(format, args...)}
+}
+
+// next reads and verifies the next record.
+func (cr *checksumReader) next() error {
+	var lenBuf [8]byte
+	if _, err := io.ReadFull(cr.reader, lenBuf[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return cr.corrupted("snapshot is truncated, the trailer is missing")
+		}
+		return err
+	}
+	size := core.Bytestoi(lenBuf[:])
+
+	if size == trailerRecordLength {
+		expected := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(cr.reader, expected); err != nil {
+			return cr.corrupted("failed to read the trailer checksum, %v", err)
+		}
+		if actual := cr.digest.Sum(nil); !bytes.Equal(actual, expected) {
+			return cr.corrupted("trailer checksum mismatch, expected: %x, calculated: %x", expected, actual)
+		}
+		return io.EOF
+	}
+	if size > maxChecksummedRecordSize {
+		return cr.corrupted("invalid record length %v", size)
+	}
+
+	record := make([]byte, 8+size+recordChecksumSize)
+	copy(record, lenBuf[:])
+	if _, err := io.ReadFull(cr.reader, record[8:]); err != nil {
+		return cr.corrupted("failed to read record, %v", err)
+	}
+	content := record[:8+size]
+	expected := binary.LittleEndian.Uint32(record[8+size:])
+	if actual := crc32.Checksum(content, crc32cTable); actual != expected {
+		return cr.corrupted("checksum mismatch, expected: %08x, calculated: %08x", expected, actual)
+	}
+
+	cr.digest.Write(record)
+	cr.pending = content
+	cr.index++
+	cr.offset += uint64(len(record))
+	return nil
+}
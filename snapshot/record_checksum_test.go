@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+// writeChecksummedTestSnapshot writes a valid V4 snapshot with record checksums.
+func writeChecksummedTestSnapshot(t *testing.T, filePath string) *core.SnapshotMetadata {
+	require := require.New(t)
+
+	srcDB := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, srcDB, 10, common.HexToAddress("0x1"))
+	metadata := createValidTestMetadata(t, sv, srcDB)
+
+	sfw, err := createSnapshotFileWriter(filePath, SnapshotCompressionNone)
+	require.Nil(err)
+	require.Nil(core.WriteSnapshotHeader(sfw.Writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 4, Flags: core.SnapshotChecksummed}))
+	require.Nil(sfw.enableRecordChecksums())
+	require.Nil(core.WriteLastCheckpoint(sfw.Writer, &core.LastCheckpoint{CheckpointHeader: metadata.TailTrio.Second.Header}))
+	require.Nil(core.WriteMetadata(sfw.Writer, metadata))
+	writeStoreViewV3(sv, true, sfw.Writer, srcDB, common.Hash{})
+	require.Nil(sfw.Close())
+	return metadata
+}
+
+func TestLoadChecksummedSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-checksummed")
+	metadata := writeChecksummedTestSnapshot(t, snapshotPath)
+
+	header, _, err := loadSnapshot(snapshotPath, backend.NewMemDatabase(), "Testing", nil)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), LoadSnapshotCheckpointHeader(snapshotPath).Hash())
+}
+
+func TestLoadChecksummedSnapshotCorruption(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-checksummed")
+	writeChecksummedTestSnapshot(t, snapshotPath)
+	content, err := ioutil.ReadFile(snapshotPath)
+	require.Nil(err)
+
+	// A flipped byte in the last state record is reported at that record.
+	corrupted := append([]byte{}, content...)
+	corrupted[len(corrupted)-8-32-recordChecksumSize-1] ^= 0xff
+	_, _, err = LoadSnapshotFromReader(bytes.NewReader(corrupted), backend.NewMemDatabase(), nil)
+	require.NotNil(err)
+	checksumErr, ok := requireSnapshotError(t, err).Err.(*RecordChecksumError)
+	require.True(ok, "unexpected error: %v", err)
+	assert.True(checksumErr.Index >= 2) // after the last checkpoint and the metadata
+	assert.Contains(err.Error(), "checksum mismatch")
+
+	// A snapshot cut off at a record boundary is missing the trailer.
+	_, _, err = LoadSnapshotFromReader(bytes.NewReader(content[:len(content)-8-32]), backend.NewMemDatabase(), nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "trailer is missing")
+}
+
+func TestChecksumWriterPartialWrites(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	plain := &bytes.Buffer{}
+	for _, record := range []string{"a", "", "record"} {
+		plain.Write(core.Itobytes(uint64(len(record))))
+		plain.WriteString(record)
+	}
+
+	framed := &bytes.Buffer{}
+	cw := newChecksumWriter(framed)
+	for _, b := range plain.Bytes() {
+		_, err := cw.Write([]byte{b})
+		require.Nil(err)
+	}
+	require.Nil(cw.Close())
+
+	restored, err := ioutil.ReadAll(newChecksumReader(framed))
+	require.Nil(err)
+	assert.Equal(plain.Bytes(), restored)
+}
@@ -0,0 +1,248 @@
+package snapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/blockchain"
+	cns "github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// SnapshotScheduler exports a snapshot every interval finalized blocks into its directory, and
+// removes the older snapshots so that only the latest ones are kept.
+type SnapshotScheduler struct {
+	dir      string
+	interval uint64
+	keep     int
+	export   func(height uint64) (string, error)
+
+	uploaders []SnapshotUploader
+
+	mu           sync.Mutex
+	latest       string
+	latestHeight uint64
+
+	pending       chan uint64
+	lastFinalized uint64 // height of the last finalized block notified, 0 until the first one
+
+	// Life cycle
+	wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewSnapshotScheduler creates a scheduler exporting V2 snapshots of the directly finalized
+// blocks whose height is a multiple of the interval, keeping the latest keep snapshots (0: all).
+func NewSnapshotScheduler(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, dir string, interval uint64, keep int) *SnapshotScheduler {
+	s := newSnapshotScheduler(dir, interval, keep, func(height uint64) (string, error) {
+		return ExportSnapshotV2(db, consensus, chain, dir, height)
+	})
+	chain.SubscribeFinalization(s.onFinalized)
+	return s
+}
+
+func newSnapshotScheduler(dir string, interval uint64, keep int, export func(height uint64) (string, error)) *SnapshotScheduler {
+	return &SnapshotScheduler{
+		dir:      dir,
+		interval: interval,
+		keep:     keep,
+		export:   export,
+		pending:  make(chan uint64, 1),
+		wg:       &sync.WaitGroup{},
+	}
+}
+
+// Start creates the snapshot directory, picks up the snapshots exported before the restart, and
+// starts exporting the snapshots in the background.
+func (s *SnapshotScheduler) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	snapshots, err := listScheduledSnapshots(s.dir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		latest := snapshots[len(snapshots)-1]
+		s.setLatest(latest.path, latest.height)
+	}
+
+	c, cancel := context.WithCancel(ctx)
+	s.ctx = c
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.mainLoop()
+	return nil
+}
+
+// Stop notifies the scheduler to stop without blocking.
+func (s *SnapshotScheduler) Stop() {
+	s.cancel()
+}
+
+// Wait blocks until the scheduler stops.
+func (s *SnapshotScheduler) Wait() {
+	s.wg.Wait()
+}
+
+// SetUploaders sets the uploaders the exported snapshots are pushed to. It needs to be called
+// before Start.
+func (s *SnapshotScheduler) SetUploaders(uploaders []SnapshotUploader) {
+	s.uploaders = uploaders
+}
+
+// LatestSnapshot returns the path and the block height of the latest snapshot, an empty path if
+// there is none yet.
+func (s *SnapshotScheduler) LatestSnapshot() (string, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest, s.latestHeight
+}
+
+func (s *SnapshotScheduler) setLatest(snapshotPath string, height uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latest = snapshotPath
+	s.latestHeight = height
+}
+
+// onFinalized schedules the export of the block if it is the first finalized block reaching a
+// multiple of the interval, since the blocks are not all directly finalized and notified. An
+// export still pending is replaced by the newer one, the finalization is never blocked.
+func (s *SnapshotScheduler) onFinalized(block *core.ExtendedBlock) {
+	if s.interval == 0 || !s.crossesInterval(block.Height) {
+		return
+	}
+	for {
+		select {
+		case s.pending <- block.Height:
+			return
+		default:
+		}
+		select {
+		case <-s.pending:
+		default:
+		}
+	}
+}
+
+// crossesInterval records the finalized height, and returns whether a multiple of the interval
+// was reached since the previous finalized height.
+func (s *SnapshotScheduler) crossesInterval(height uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.lastFinalized
+	if height <= previous {
+		return false
+	}
+	s.lastFinalized = height
+	if previous == 0 {
+		return height%s.interval == 0
+	}
+	return height/s.interval > previous/s.interval
+}
+
+func (s *SnapshotScheduler) mainLoop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case height := <-s.pending:
+			s.exportSnapshot(height)
+		}
+	}
+}
+
+// exportSnapshot exports the snapshot at the given height, uploads it, and rotates the older
+// snapshots.
+func (s *SnapshotScheduler) exportSnapshot(height uint64) {
+	logger.Infof("Exporting the scheduled snapshot at height %v", height)
+	snapshotPath, err := s.export(height)
+	if err != nil {
+		logger.WithFields(log.Fields{"height": height, "err": err}).Warn("Failed to export the scheduled snapshot")
+		return
+	}
+	s.setLatest(snapshotPath, height)
+	logger.Infof("Exported the scheduled snapshot: %v", snapshotPath)
+
+	if len(s.uploaders) > 0 {
+		if err := UploadSnapshot(snapshotPath, s.uploaders); err != nil {
+			logger.WithFields(log.Fields{"snapshot": snapshotPath, "err": err}).Warn("Failed to upload the scheduled snapshot")
+		}
+	}
+
+	if err := s.rotate(); err != nil {
+		logger.Warnf("Failed to remove the old scheduled snapshots: %v", err)
+	}
+}
+
+// rotate removes the snapshots older than the latest keep ones.
+func (s *SnapshotScheduler) rotate() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	snapshots, err := listScheduledSnapshots(s.dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(snapshots)-s.keep; i++ {
+		logger.Infof("Removing the old scheduled snapshot: %v", snapshots[i].path)
+		if err := os.Remove(snapshots[i].path); err != nil {
+			return err
+		}
+		for _, sidecar := range []string{signaturePath(snapshots[i].path), snapshots[i].path + checksumManifestSuffix} {
+			if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type scheduledSnapshot struct {
+	path   string
+	height uint64
+}
+
+// listScheduledSnapshots returns the snapshots in the directory sorted by height. The sidecar
+// files and the files whose name doesn't start with the snapshot prefix and height are skipped.
+func listScheduledSnapshots(dir string) ([]scheduledSnapshot, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []scheduledSnapshot{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, snapshotFilePrefix) || isSnapshotSidecar(name) {
+			continue
+		}
+		fields := strings.SplitN(name[len(snapshotFilePrefix):], "-", 2)
+		height, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, scheduledSnapshot{path: path.Join(dir, name), height: height})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].height < snapshots[j].height
+	})
+	return snapshots, nil
+}
+
+func isSnapshotSidecar(name string) bool {
+	return strings.HasSuffix(name, signatureSuffix) || strings.HasSuffix(name, checksumManifestSuffix) ||
+		strings.HasSuffix(name, ".tmp")
+}
@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestSnapshotScheduler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	// A snapshot exported before the restart, with its signature.
+	oldPath := path.Join(dir, "theta_snapshot-50-0x00-2026-01-01")
+	require.Nil(ioutil.WriteFile(oldPath, []byte("old"), 0600))
+	require.Nil(ioutil.WriteFile(signaturePath(oldPath), []byte("sig"), 0600))
+
+	exported := make(chan uint64, 10)
+	scheduler := newSnapshotScheduler(dir, 100, 2, func(height uint64) (string, error) {
+		snapshotPath := path.Join(dir, fmt.Sprintf("theta_snapshot-%v-0x00-2026-01-01", height))
+		if err := ioutil.WriteFile(snapshotPath, []byte("new"), 0600); err != nil {
+			return "", err
+		}
+		exported <- height
+		return snapshotPath, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.Nil(scheduler.Start(ctx))
+	defer func() {
+		cancel()
+		scheduler.Wait()
+	}()
+
+	latest, height := scheduler.LatestSnapshot()
+	assert.Equal(oldPath, latest)
+	assert.Equal(uint64(50), height)
+
+	waitExported := func(expected uint64) {
+		select {
+		case h := <-exported:
+			assert.Equal(expected, h)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Snapshot at height %v not exported", expected)
+		}
+	}
+
+	// Only the first heights reaching a multiple of the interval are exported.
+	scheduler.onFinalized(&core.ExtendedBlock{Block: &core.Block{BlockHeader: &core.BlockHeader{Height: 150}}})
+	scheduler.onFinalized(&core.ExtendedBlock{Block: &core.Block{BlockHeader: &core.BlockHeader{Height: 200}}})
+	waitExported(200)
+	scheduler.onFinalized(&core.ExtendedBlock{Block: &core.Block{BlockHeader: &core.BlockHeader{Height: 290}}})
+	// Height 300 is finalized indirectly along with 301.
+	scheduler.onFinalized(&core.ExtendedBlock{Block: &core.Block{BlockHeader: &core.BlockHeader{Height: 301}}})
+	waitExported(301)
+
+	// The latest two snapshots are kept, the oldest is removed along with its signature.
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+			break
+		}
+	}
+	_, err := os.Stat(oldPath)
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(signaturePath(oldPath))
+	assert.True(os.IsNotExist(err))
+	snapshots, err := listScheduledSnapshots(dir)
+	require.Nil(err)
+	require.Equal(2, len(snapshots))
+	assert.Equal(uint64(200), snapshots[0].height)
+	assert.Equal(uint64(301), snapshots[1].height)
+
+	latest, height = scheduler.LatestSnapshot()
+	assert.Equal(snapshots[1].path, latest)
+	assert.Equal(uint64(301), height)
+}
@@ -0,0 +1,148 @@
+package snapshot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// signatureSuffix is appended to the snapshot file path to name the sidecar file holding the
+// publisher signature.
+const signatureSuffix = ".sig"
+
+// snapshotSignaturePrefix separates the snapshot signatures from the other signatures made
+// with the same key.
+const snapshotSignaturePrefix = "ThetaSnapshotMetadata"
+
+// SnapshotSignature is the signature of the snapshot metadata by the snapshot publisher. Since
+// the metadata commits to the snapshot block, and thus to its state root, the signature covers
+// the whole snapshot once the snapshot is validated.
+type SnapshotSignature struct {
+	Publisher    common.Address
+	MetadataHash common.Hash
+	Signature    *crypto.Signature
+}
+
+func signaturePath(snapshotFilePath string) string {
+	return snapshotFilePath + signatureSuffix
+}
+
+func snapshotMetadataHash(metadata *core.SnapshotMetadata) (common.Hash, error) {
+	raw, err := rlp.EncodeToBytes(metadata)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(raw), nil
+}
+
+func snapshotSignatureMessage(metadataHash common.Hash) common.Bytes {
+	return append([]byte(snapshotSignaturePrefix), metadataHash.Bytes()...)
+}
+
+// SignSnapshot signs the metadata of the snapshot with the publisher key, and writes the
+// signature to a sidecar file next to the snapshot.
+func SignSnapshot(snapshotFilePath string, privKey *crypto.PrivateKey) (*SnapshotSignature, error) {
+	metadata, err := readSnapshotMetadata(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	metadataHash, err := snapshotMetadataHash(metadata)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := privKey.Sign(snapshotSignatureMessage(metadataHash))
+	if err != nil {
+		return nil, err
+	}
+	signature := &SnapshotSignature{
+		Publisher:    privKey.PublicKey().Address(),
+		MetadataHash: metadataHash,
+		Signature:    sig,
+	}
+
+	raw, err := rlp.EncodeToBytes(signature)
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := signaturePath(snapshotFilePath) + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, raw, 0644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmpPath, signaturePath(snapshotFilePath)); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// ReadSnapshotSignature reads the publisher signature of the snapshot.
+func ReadSnapshotSignature(snapshotFilePath string) (*SnapshotSignature, error) {
+	raw, err := ioutil.ReadFile(signaturePath(snapshotFilePath))
+	if err != nil {
+		return nil, err
+	}
+	signature := &SnapshotSignature{}
+	if err = rlp.DecodeBytes(raw, signature); err != nil {
+		return nil, fmt.Errorf("Failed to decode snapshot signature, %v", err)
+	}
+	return signature, nil
+}
+
+// Verify checks that the signature was made by one of the publishers over the metadata.
+func (s *SnapshotSignature) Verify(metadata *core.SnapshotMetadata, publishers []common.Address) error {
+	allowed := false
+	for _, publisher := range publishers {
+		if publisher == s.Publisher {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("Snapshot publisher %v is not in the publisher allowlist", s.Publisher.Hex())
+	}
+	metadataHash, err := snapshotMetadataHash(metadata)
+	if err != nil {
+		return err
+	}
+	if metadataHash != s.MetadataHash {
+		return fmt.Errorf("Snapshot metadata hash mismatch, signed: %v, actual: %v", s.MetadataHash.Hex(), metadataHash.Hex())
+	}
+	if !s.Signature.Verify(snapshotSignatureMessage(metadataHash), s.Publisher) {
+		return fmt.Errorf("Invalid snapshot signature of publisher %v", s.Publisher.Hex())
+	}
+	return nil
+}
+
+// verifySnapshotSignature checks the publisher signature of the snapshot against the metadata
+// of the snapshot file.
+func verifySnapshotSignature(snapshotFilePath string, publishers []common.Address) (*SnapshotSignature, error) {
+	signature, err := ReadSnapshotSignature(snapshotFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the signature of snapshot %v: %v", snapshotFilePath, err)
+	}
+	metadata, err := readSnapshotMetadata(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if err = signature.Verify(metadata, publishers); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// snapshotPublishers returns the publisher allowlist specified in the node config.
+func snapshotPublishers() []common.Address {
+	publishers := []common.Address{}
+	for _, publisher := range strings.Split(viper.GetString(common.CfgSnapshotPublishers), ",") {
+		if publisher = strings.TrimSpace(publisher); publisher != "" {
+			publishers = append(publishers, common.HexToAddress(publisher))
+		}
+	}
+	return publishers
+}
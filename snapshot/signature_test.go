@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+func TestValidateSignedSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-signed")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+	publisherKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	otherKey, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	publisher := publisherKey.PublicKey().Address()
+
+	// The signature is required once a publisher allowlist is configured.
+	opts := &LoadSnapshotOptions{Publishers: []common.Address{publisher}}
+	_, _, err = validateSnapshot(snapshotPath, "", "", opts)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "signature")
+
+	signature, err := SignSnapshot(snapshotPath, publisherKey)
+	require.Nil(err)
+	assert.Equal(publisher, signature.Publisher)
+	header, _, err := validateSnapshot(snapshotPath, "", "", opts)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	// A publisher outside of the allowlist is rejected.
+	_, err = SignSnapshot(snapshotPath, otherKey)
+	require.Nil(err)
+	_, _, err = validateSnapshot(snapshotPath, "", "", opts)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "allowlist")
+
+	// A signature over different metadata is rejected.
+	signature, err = SignSnapshot(snapshotPath, publisherKey)
+	require.Nil(err)
+	writeValidTestSnapshot(t, snapshotPath, 20, common.HexToAddress("0x1"))
+	_, _, err = validateSnapshot(snapshotPath, "", "", opts)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "metadata hash mismatch")
+}
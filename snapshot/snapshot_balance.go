@@ -0,0 +1,73 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// SumSnapshotBalances streams a V2 snapshot and sums up the balances of all the accounts in
+// the state of the snapshot block, without loading the snapshot into a database. Records of
+// the other store views and of the account storages are skipped.
+func SumSnapshotBalances(reader io.Reader) (thetaTotal, tfuelTotal *big.Int, accountCount int, err error) {
+	readRecord, metadata, err := readSnapshotV2Sections(reader)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	snapshotHeight := metadata.TailTrio.Second.Header.Height
+
+	thetaTotal = new(big.Int)
+	tfuelTotal = new(big.Int)
+	depth := 0
+	inSnapshotState := false
+	record := core.SnapshotTrieRecord{}
+	for {
+		_, err := readRecord(&record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, 0, fmt.Errorf("Failed to read snapshot record, %v", err)
+		}
+
+		if bytes.Equal(record.K, []byte{core.SVStart}) {
+			depth++
+			if depth == 1 {
+				inSnapshotState = core.Bytestoi(record.V) == snapshotHeight
+			}
+			continue
+		}
+		if bytes.Equal(record.K, []byte{core.SVEnd}) {
+			if depth == 0 {
+				return nil, nil, 0, fmt.Errorf("Missing storeview to handle")
+			}
+			depth--
+			continue
+		}
+		if !inSnapshotState || depth != 1 || !bytes.HasPrefix(record.K, []byte("ls/a/")) {
+			continue
+		}
+
+		account := &types.Account{}
+		err = types.FromBytes(record.V, account)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("Failed to parse account, %v", err)
+		}
+		if account.Balance.ThetaWei != nil {
+			thetaTotal.Add(thetaTotal, account.Balance.ThetaWei)
+		}
+		if account.Balance.TFuelWei != nil {
+			tfuelTotal.Add(tfuelTotal, account.Balance.TFuelWei)
+		}
+		accountCount++
+	}
+	if depth != 0 {
+		return nil, nil, 0, fmt.Errorf("Still some storeview unhandled")
+	}
+
+	return thetaTotal, tfuelTotal, accountCount, nil
+}
@@ -0,0 +1,47 @@
+package snapshot
+
+import (
+	"bufio"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestSumSnapshotBalances(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	sv.SetAccount(common.HexToAddress("0x1"), &types.Account{Address: common.HexToAddress("0x1"), Balance: types.NewCoins(100, 200)})
+	sv.SetAccount(common.HexToAddress("0x2"), &types.Account{Address: common.HexToAddress("0x2"), Balance: types.NewCoins(0, 0)})
+	// The storage records of the contract account are skipped
+	setTestContractAccount(sv, db, common.HexToAddress("0x3"), "a", "b")
+	contract := sv.GetAccount(common.HexToAddress("0x3"))
+	contract.Balance = types.NewCoins(5, 7)
+	sv.SetAccount(common.HexToAddress("0x3"), contract)
+	sv.Save()
+
+	snapshotPath := path.Join(dir, "theta_snapshot-balances")
+	writeTestSnapshotV2(t, snapshotPath, sv, db)
+
+	file, err := os.Open(snapshotPath)
+	require.Nil(err)
+	defer file.Close()
+	thetaTotal, tfuelTotal, accountCount, err := SumSnapshotBalances(bufio.NewReader(file))
+	require.Nil(err)
+	assert.Equal(0, big.NewInt(105).Cmp(thetaTotal))
+	assert.Equal(0, big.NewInt(207).Cmp(tfuelTotal))
+	assert.Equal(3, accountCount)
+}
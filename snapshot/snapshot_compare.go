@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// StateChangeType is the type of change of a state key between two snapshots.
+type StateChangeType int
+
+const (
+	StateKeyAdded StateChangeType = iota
+	StateKeyRemoved
+	StateKeyModified
+)
+
+func (t StateChangeType) String() string {
+	switch t {
+	case StateKeyAdded:
+		return "added"
+	case StateKeyRemoved:
+		return "removed"
+	case StateKeyModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChange is a state key which differs between two snapshots. For a key of an account
+// storage, Storage is set and Account is the owner of the storage.
+type StateChange struct {
+	Type     StateChangeType
+	Key      common.Bytes
+	OldValue common.Bytes // nil if added
+	NewValue common.Bytes // nil if removed
+	Storage  bool
+	Account  common.Address
+}
+
+// SnapshotComparison is the result of comparing the states of two snapshots.
+type SnapshotComparison struct {
+	OldBlockHeader *core.BlockHeader
+	NewBlockHeader *core.BlockHeader
+	Changes        []StateChange // sorted by key, the storage changes follow their account
+}
+
+// CompareSnapshots validates and loads the two snapshots into temporary databases, and
+// returns the state keys which changed from the old to the new snapshot block, including the
+// keys of the account storages. The subtries the two states share are skipped, so the cost
+// of the comparison is proportional to the changes rather than to the state size.
+func CompareSnapshots(oldSnapshotFilePath, newSnapshotFilePath string, opts *LoadSnapshotOptions) (*SnapshotComparison, error) {
+	oldDB, oldCleanup := createTempDB()
+	defer oldCleanup()
+	newDB, newCleanup := createTempDB()
+	defer newCleanup()
+
+	oldHeader, _, err := LoadSnapshot(oldSnapshotFilePath, oldDB, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", oldSnapshotFilePath, err)
+	}
+	newHeader, _, err := LoadSnapshot(newSnapshotFilePath, newDB, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", newSnapshotFilePath, err)
+	}
+
+	changes, err := compareStates(oldHeader.StateHash, oldDB, newHeader.StateHash, newDB)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotComparison{
+		OldBlockHeader: oldHeader,
+		NewBlockHeader: newHeader,
+		Changes:        changes,
+	}, nil
+}
+
+// compareStates returns the changes between the two state tries, descending into the
+// storage of the accounts whose storage root changed.
+func compareStates(oldRoot common.Hash, oldDB database.Database, newRoot common.Hash, newDB database.Database) ([]StateChange, error) {
+	changes, err := compareTries(oldRoot, oldDB, newRoot, newDB)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compare the state tries: %v", err)
+	}
+
+	result := []StateChange{}
+	for _, change := range changes {
+		result = append(result, change)
+		if !bytes.HasPrefix(change.Key, state.AccountKeyPrefix()) {
+			continue
+		}
+		oldStorage, err := accountStorageRoot(change.OldValue)
+		if err != nil {
+			return nil, err
+		}
+		newStorage, err := accountStorageRoot(change.NewValue)
+		if err != nil {
+			return nil, err
+		}
+		if oldStorage == newStorage {
+			continue
+		}
+		storageChanges, err := compareTries(oldStorage, oldDB, newStorage, newDB)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare the storage of account %v: %v", common.Bytes2Hex(change.Key), err)
+		}
+		account := common.BytesToAddress(change.Key[len(state.AccountKeyPrefix()):])
+		for _, storageChange := range storageChanges {
+			storageChange.Storage = true
+			storageChange.Account = account
+			result = append(result, storageChange)
+		}
+	}
+	return result, nil
+}
+
+// accountStorageRoot returns the storage root of the encoded account, empty if there is no
+// account.
+func accountStorageRoot(value common.Bytes) (common.Hash, error) {
+	if value == nil {
+		return common.Hash{}, nil
+	}
+	account := &types.Account{}
+	if err := types.FromBytes(value, account); err != nil {
+		return common.Hash{}, fmt.Errorf("Failed to parse account: %v", err)
+	}
+	return account.Root, nil
+}
+
+// compareTries returns the changed keys of the two tries, sorted by key. An empty root
+// stands for an empty trie.
+func compareTries(oldRoot common.Hash, oldDB database.Database, newRoot common.Hash, newDB database.Database) ([]StateChange, error) {
+	oldTrie, err := trie.New(oldRoot, trie.NewDatabase(oldDB))
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.New(newRoot, trie.NewDatabase(newDB))
+	if err != nil {
+		return nil, err
+	}
+
+	// The leaves of the new trie missing from the old trie are added or modified, the
+	// leaves of the old trie missing from the new trie are removed or modified.
+	added, err := differentLeaves(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := differentLeaves(newTrie, oldTrie)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []StateChange{}
+	for key, newValue := range added {
+		if oldValue, ok := removed[key]; ok {
+			changes = append(changes, StateChange{Type: StateKeyModified, Key: common.Bytes(key), OldValue: oldValue, NewValue: newValue})
+			delete(removed, key)
+		} else {
+			changes = append(changes, StateChange{Type: StateKeyAdded, Key: common.Bytes(key), NewValue: newValue})
+		}
+	}
+	for key, oldValue := range removed {
+		changes = append(changes, StateChange{Type: StateKeyRemoved, Key: common.Bytes(key), OldValue: oldValue})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Key, changes[j].Key) < 0
+	})
+	return changes, nil
+}
+
+// differentLeaves returns the leaves of trie b which are not in trie a.
+func differentLeaves(a, b *trie.Trie) (map[string]common.Bytes, error) {
+	it, _ := trie.NewDifferenceIterator(a.NodeIterator(nil), b.NodeIterator(nil))
+	leaves := make(map[string]common.Bytes)
+	for it.Next(true) {
+		if it.Leaf() {
+			leaves[string(it.LeafKey())] = common.CopyBytes(it.LeafBlob())
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestCompareSnapshots(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	validator := common.HexToAddress("0x100")
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+	contract := common.HexToAddress("0xc0")
+
+	oldDB := backend.NewMemDatabase()
+	oldSV := createTestSnapshotState(t, oldDB, 10, validator)
+	oldSV.SetAccount(addr1, &types.Account{Address: addr1, Balance: types.NewCoins(100, 200)})
+	oldSV.SetAccount(addr2, &types.Account{Address: addr2, Balance: types.NewCoins(1, 1)})
+	setTestContractAccount(oldSV, oldDB, contract, "a", "b")
+	oldSV.Save()
+	oldPath := path.Join(dir, "theta_snapshot-old")
+	writeValidTestSnapshotState(t, oldPath, oldSV, oldDB)
+
+	// addr1 is modified, addr2 is removed, addr3 is added, and the contract storage changes.
+	newDB := backend.NewMemDatabase()
+	newSV := createTestSnapshotState(t, newDB, 20, validator)
+	newSV.SetAccount(addr1, &types.Account{Address: addr1, Balance: types.NewCoins(100, 150)})
+	newSV.SetAccount(addr3, &types.Account{Address: addr3, Balance: types.NewCoins(0, 50)})
+	setTestContractAccount(newSV, newDB, contract, "x", "b", "c")
+	newSV.Save()
+	newPath := path.Join(dir, "theta_snapshot-new")
+	writeValidTestSnapshotState(t, newPath, newSV, newDB)
+
+	comparison, err := CompareSnapshots(oldPath, newPath, nil)
+	require.Nil(err)
+	assert.Equal(uint64(10), comparison.OldBlockHeader.Height)
+	assert.Equal(uint64(20), comparison.NewBlockHeader.Height)
+
+	changes := make(map[string]StateChange)
+	for _, change := range comparison.Changes {
+		changes[string(change.Key)] = change
+	}
+	assert.Equal(StateKeyModified, changes[string(state.AccountKey(addr1))].Type)
+	assert.Equal(StateKeyRemoved, changes[string(state.AccountKey(addr2))].Type)
+	assert.Nil(changes[string(state.AccountKey(addr2))].NewValue)
+	assert.Equal(StateKeyAdded, changes[string(state.AccountKey(addr3))].Type)
+	assert.Equal(StateKeyModified, changes[string(state.AccountKey(contract))].Type)
+	assert.NotContains(changes, string(state.ValidatorCandidatePoolKey()))
+
+	storageKey0 := common.BigToHash(big.NewInt(0)).Bytes()
+	storageKey1 := common.BigToHash(big.NewInt(1)).Bytes()
+	storageKey2 := common.BigToHash(big.NewInt(2)).Bytes()
+	assert.Equal(StateKeyModified, changes[string(storageKey0)].Type)
+	assert.True(changes[string(storageKey0)].Storage)
+	assert.Equal(contract, changes[string(storageKey0)].Account)
+	assert.NotContains(changes, string(storageKey1))
+	assert.Equal(StateKeyAdded, changes[string(storageKey2)].Type)
+	assert.Equal(6, len(comparison.Changes))
+
+	// Identical snapshots have no changes.
+	comparison, err = CompareSnapshots(oldPath, oldPath, nil)
+	require.Nil(err)
+	assert.Empty(comparison.Changes)
+}
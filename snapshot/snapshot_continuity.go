@@ -0,0 +1,123 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// VerifyContinuity checks that the newer snapshot is a legitimate evolution of the older,
+// already trusted, snapshot. The validator set proven by the older snapshot is evolved
+// through the validator set change proofs of the newer snapshot beyond the older tail, each
+// of which has to be endorsed by the validator set proven so far. The proofs at or below the
+// older tail height have to match the ones of the older snapshot. Finally, the tail trio of
+// the newer snapshot has to be endorsed by the evolved validator set.
+func VerifyContinuity(olderSnapshotFilePath, newerSnapshotFilePath string) error {
+	olderMetadata, err := readSnapshotMetadata(olderSnapshotFilePath)
+	if err != nil {
+		return err
+	}
+	newerMetadata, err := readSnapshotMetadata(newerSnapshotFilePath)
+	if err != nil {
+		return err
+	}
+
+	olderTail := &olderMetadata.TailTrio
+	newerTail := &newerMetadata.TailTrio
+	olderHeight := olderTail.Second.Header.Height
+	if olderTail.Second.Header.ChainID != newerTail.Second.Header.ChainID {
+		return fmt.Errorf("Chain ID mismatch: %v vs %v", olderTail.Second.Header.ChainID, newerTail.Second.Header.ChainID)
+	}
+	if newerTail.Second.Header.Height <= olderHeight {
+		return fmt.Errorf("Snapshot at height %v is not newer than the snapshot at height %v", newerTail.Second.Header.Height, olderHeight)
+	}
+
+	verifier, err := snapshotVoteVerifier(newerMetadata)
+	if err != nil {
+		return err
+	}
+	provenValSet, err := getValidatorSetFromVCPProof(olderTail.First.Header.StateHash, &olderTail.First.Proof)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve validator set of the older snapshot: %v", err)
+	}
+
+	olderProofBlocks := make(map[common.Hash]bool)
+	for _, trio := range olderMetadata.ProofTrios {
+		olderProofBlocks[trio.Second.Header.Hash()] = true
+	}
+	olderProofBlocks[olderTail.Second.Header.Hash()] = true
+
+	for _, trio := range newerMetadata.ProofTrios {
+		second := trio.Second.Header
+		if second.Height <= olderHeight {
+			if !olderProofBlocks[second.Hash()] {
+				return fmt.Errorf("Validator set change proof at height %v diverges from the older snapshot", second.Height)
+			}
+			continue
+		}
+
+		if err := checkTrioLinks(&trio); err != nil {
+			return fmt.Errorf("Invalid validator set change proof at height %v: %v", second.Height, err)
+		}
+		// third.Header.HCC.Votes contains the votes for the second block in the trio
+		if err := validateVotes(provenValSet, second, trio.Third.Header.HCC.Votes, verifier); err != nil {
+			return fmt.Errorf("Validator set change at height %v is not endorsed by the proven validator set: %v", second.Height, err)
+		}
+		provenValSet, err = getValidatorSetFromVCPProof(trio.First.Header.StateHash, &trio.First.Proof)
+		if err != nil {
+			return fmt.Errorf("Failed to retrieve validator set from VCP proof at height %v: %v", second.Height, err)
+		}
+	}
+
+	if err := checkTrioLinks(newerTail); err != nil {
+		return fmt.Errorf("Invalid tail trio: %v", err)
+	}
+	if err := validateVotes(provenValSet, newerTail.Third.Header, newerTail.Third.VoteSet, verifier); err != nil {
+		return fmt.Errorf("Tail trio is not endorsed by the proven validator set: %v", err)
+	}
+	return nil
+}
+
+// CheckBlockTrio checks that the headers of the block trio are present and linked by both
+// the Parent and the HCC links. The votes are not verified.
+func CheckBlockTrio(trio *core.SnapshotBlockTrio) error {
+	if trio.First.Header == nil || trio.Second.Header == nil || trio.Third.Header == nil {
+		return fmt.Errorf("block trio has missing headers")
+	}
+	return checkTrioLinks(trio)
+}
+
+// checkTrioLinks checks the Parent and HCC links between the blocks of the trio.
+func checkTrioLinks(trio *core.SnapshotBlockTrio) error {
+	first := trio.First.Header
+	second := trio.Second.Header
+	third := trio.Third.Header
+	if second.Parent != first.Hash() || third.Parent != second.Hash() {
+		return fmt.Errorf("block trio has invalid Parent link")
+	}
+	if second.HCC.BlockHash != first.Hash() || third.HCC.BlockHash != second.Hash() {
+		return fmt.Errorf("block trio has invalid HCC link")
+	}
+	return nil
+}
+
+// readSnapshotMetadata reads the metadata section of a snapshot file.
+func readSnapshotMetadata(snapshotFilePath string) (*core.SnapshotMetadata, error) {
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+
+	reader, _, err := newDecompressingReader(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	_, metadata, _, err := readSnapshotSections(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", snapshotFilePath, err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func signedTestVoteSet(block *core.BlockHeader, signer *crypto.PrivateKey) *core.VoteSet {
+	vote := core.Vote{Block: block.Hash(), Height: block.Height, ID: signer.PublicKey().Address()}
+	vote.Sign(signer)
+	voteSet := core.NewVoteSet()
+	voteSet.AddVote(vote)
+	return voteSet
+}
+
+// createTestEndorsedTrio creates a block trio endorsed by the signer, whose first block commits
+// to a state with the given validators.
+func createTestEndorsedTrio(t *testing.T, height uint64, signer *crypto.PrivateKey, validators ...common.Address) core.SnapshotBlockTrio {
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, height-1, validators...)
+
+	first := &core.BlockHeader{ChainID: "testchain", Height: height - 1, StateHash: sv.Hash(), Timestamp: big.NewInt(1)}
+	second := &core.BlockHeader{ChainID: "testchain", Height: height, Parent: first.Hash(), StateHash: sv.Hash(), Timestamp: big.NewInt(2)}
+	second.HCC.BlockHash = first.Hash()
+	third := &core.BlockHeader{ChainID: "testchain", Height: height + 1, Parent: second.Hash(), Timestamp: big.NewInt(3)}
+	third.HCC.BlockHash = second.Hash()
+	third.HCC.Votes = signedTestVoteSet(second, signer)
+
+	vcpProof, err := proveVCP(&core.ExtendedBlock{Block: &core.Block{BlockHeader: first}}, db)
+	require.Nil(t, err)
+	return core.SnapshotBlockTrio{
+		First:  core.SnapshotFirstBlock{Header: first, Proof: *vcpProof},
+		Second: core.SnapshotSecondBlock{Header: second},
+		Third:  core.SnapshotThirdBlock{Header: third, VoteSet: signedTestVoteSet(third, signer)},
+	}
+}
+
+func TestVerifyContinuity(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	privKey1, _, _ := crypto.GenerateKeyPair()
+	privKey2, _, _ := crypto.GenerateKeyPair()
+	privKey3, _, _ := crypto.GenerateKeyPair()
+	addr1 := privKey1.PublicKey().Address()
+	addr2 := privKey2.PublicKey().Address()
+	addr3 := privKey3.PublicKey().Address()
+
+	olderPath := path.Join(dir, "theta_snapshot-older")
+	writeTestSnapshot(t, olderPath, &core.SnapshotMetadata{
+		TailTrio: createTestEndorsedTrio(t, 10, privKey1, addr1),
+	}, nil)
+
+	// The validator set changes from {addr1} to {addr2} at height 15, endorsed by addr1.
+	newerPath := path.Join(dir, "theta_snapshot-newer")
+	writeTestSnapshot(t, newerPath, &core.SnapshotMetadata{
+		ProofTrios: []core.SnapshotBlockTrio{createTestEndorsedTrio(t, 15, privKey1, addr2)},
+		TailTrio:   createTestEndorsedTrio(t, 20, privKey2, addr2),
+	}, nil)
+	assert.Nil(VerifyContinuity(olderPath, newerPath))
+
+	// The snapshots are not in order.
+	assert.NotNil(VerifyContinuity(newerPath, olderPath))
+
+	// A fork whose tail is endorsed by a validator unknown to the older snapshot.
+	forkPath := path.Join(dir, "theta_snapshot-fork")
+	writeTestSnapshot(t, forkPath, &core.SnapshotMetadata{
+		TailTrio: createTestEndorsedTrio(t, 20, privKey3, addr3),
+	}, nil)
+	err := VerifyContinuity(olderPath, forkPath)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "not endorsed")
+
+	// A fork whose validator set change is not endorsed by the older validator set.
+	forkPath2 := path.Join(dir, "theta_snapshot-fork2")
+	writeTestSnapshot(t, forkPath2, &core.SnapshotMetadata{
+		ProofTrios: []core.SnapshotBlockTrio{createTestEndorsedTrio(t, 15, privKey3, addr3)},
+		TailTrio:   createTestEndorsedTrio(t, 20, privKey3, addr3),
+	}, nil)
+	err = VerifyContinuity(olderPath, forkPath2)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "not endorsed")
+}
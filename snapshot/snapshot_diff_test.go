@@ -0,0 +1,169 @@
+package snapshot
+
+import (
+	"bufio"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+func TestApplySnapshotDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+
+	srcDB := backend.NewMemDatabase()
+	baseSV := createTestSnapshotState(t, srcDB, 10, common.HexToAddress("0xa"))
+	setTestContractAccount(baseSV, srcDB, addr1, "a", "b")
+	setTestContractAccount(baseSV, srcDB, addr2, "c", "d")
+	baseSV.Save()
+
+	sv := state.NewStoreView(20, baseSV.Hash(), srcDB)
+	setTestContractAccount(sv, srcDB, addr1, "a", "x")
+	setTestContractAccount(sv, srcDB, addr3, "e")
+	sv.Save()
+
+	// The node holds the base state.
+	basePath := path.Join(dir, "theta_snapshot-base")
+	writeValidTestSnapshotState(t, basePath, baseSV, srcDB)
+	db := backend.NewMemDatabase()
+	_, _, err := LoadSnapshot(basePath, db, nil)
+	require.Nil(err)
+
+	diffPath := path.Join(dir, "theta_snapshot_diff")
+	metadata := writeTestSnapshotDiff(t, diffPath, sv, baseSV, srcDB)
+
+	// The diff is smaller than the full snapshot of the same state.
+	fullPath := path.Join(dir, "theta_snapshot-full")
+	writeValidTestSnapshotState(t, fullPath, sv, srcDB)
+	diffInfo, err := os.Stat(diffPath)
+	require.Nil(err)
+	fullInfo, err := os.Stat(fullPath)
+	require.Nil(err)
+	assert.True(diffInfo.Size() < fullInfo.Size())
+
+	// A diff is not a full snapshot, and needs its base state.
+	_, _, err = LoadSnapshot(diffPath, backend.NewMemDatabase(), nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "diff")
+	_, _, err = ApplySnapshotDiff(diffPath, backend.NewMemDatabase(), nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "missing")
+	_, _, err = ApplySnapshotDiff(basePath, db, nil)
+	require.NotNil(err)
+
+	header, _, err := ApplySnapshotDiff(diffPath, db, nil)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	// The resulting state is complete.
+	loadedSV := state.NewStoreView(20, sv.Hash(), db)
+	for _, addr := range []common.Address{addr1, addr2, addr3} {
+		account := loadedSV.GetAccount(addr)
+		require.NotNil(account)
+		tr, err := trie.New(account.Root, trie.NewDatabase(db))
+		require.Nil(err)
+		assert.Nil(tr.Verify())
+	}
+	tr, err := trie.New(sv.Hash(), trie.NewDatabase(db))
+	require.Nil(err)
+	assert.Nil(tr.Verify())
+}
+
+func TestApplySnapshotDiffPruneBase(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	createBaseState := func(db database.Database) *state.StoreView {
+		sv := createTestSnapshotState(t, db, 10, common.HexToAddress("0xa"))
+		setTestContractAccount(sv, db, addr1, "a", "b")
+		setTestContractAccount(sv, db, addr2, "c", "d")
+		sv.Save()
+		return sv
+	}
+
+	srcDB := backend.NewMemDatabase()
+	baseSV := createBaseState(srcDB)
+	sv := state.NewStoreView(20, baseSV.Hash(), srcDB)
+	setTestContractAccount(sv, srcDB, addr1, "a", "x")
+	// The account changes, while its storage is shared with the base state.
+	account2 := sv.GetAccount(addr2)
+	account2.Balance = types.NewCoins(1, 1)
+	sv.SetAccount(addr2, account2)
+	sv.Save()
+
+	diffPath := path.Join(dir, "theta_snapshot_diff")
+	writeTestSnapshotDiff(t, diffPath, sv, baseSV, srcDB)
+
+	// The node committed the base state itself, so the base nodes are referenced once.
+	db := backend.NewMemDatabase()
+	require.Equal(baseSV.Hash(), createBaseState(db).Hash())
+	_, _, err := ApplySnapshotDiff(diffPath, db, nil)
+	require.Nil(err)
+
+	for i := 0; i < 5; i++ {
+		if has, _ := db.Has(baseSV.Hash().Bytes()); !has {
+			break
+		}
+		require.Nil(state.NewStoreView(10, baseSV.Hash(), db).Prune())
+	}
+	has, _ := db.Has(baseSV.Hash().Bytes())
+	require.False(has)
+
+	// The new state is intact after the base state is pruned.
+	loadedSV := state.NewStoreView(20, sv.Hash(), db)
+	tr, err := trie.New(sv.Hash(), trie.NewDatabase(db))
+	require.Nil(err)
+	assert.Nil(tr.Verify())
+	for _, addr := range []common.Address{addr1, addr2} {
+		account := loadedSV.GetAccount(addr)
+		require.NotNil(account)
+		tr, err := trie.New(account.Root, trie.NewDatabase(db))
+		require.Nil(err)
+		assert.Nil(tr.Verify())
+	}
+	storage := state.NewStoreView(20, loadedSV.GetAccount(addr2).Root, db)
+	assert.Equal(common.Bytes("d"), storage.Get(common.BigToHash(big.NewInt(1)).Bytes()))
+}
+
+// writeTestSnapshotDiff writes the diff of the state from the base state, and returns its
+// metadata.
+func writeTestSnapshotDiff(t *testing.T, diffPath string, sv, baseSV *state.StoreView, srcDB database.Database) *core.SnapshotMetadata {
+	require := require.New(t)
+
+	metadata := createValidTestMetadata(t, sv, srcDB)
+	file, err := os.Create(diffPath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 4, Flags: core.SnapshotDiff}))
+	require.Nil(core.WriteDiffBase(writer, &core.SnapshotDiffBase{Height: baseSV.Height(), StateHash: baseSV.Hash()}))
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: metadata.TailTrio.Second.Header}))
+	require.Nil(core.WriteMetadata(writer, metadata))
+	lastCheckpointBlock := &core.ExtendedBlock{Block: &core.Block{BlockHeader: metadata.TailTrio.Second.Header}}
+	parentBlock := &core.ExtendedBlock{Block: &core.Block{BlockHeader: metadata.TailTrio.First.Header}}
+	writeStoreViewDiff(lastCheckpointBlock, parentBlock, sv, baseSV, writer, srcDB)
+	require.Nil(file.Close())
+	return metadata
+}
@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/core"
+)
+
+const snapshotFilePrefix = "theta_snapshot-"
+
+// SnapshotResult is the outcome of validating a single snapshot file.
+type SnapshotResult struct {
+	Path        string
+	BlockHeader *core.BlockHeader
+	Err         error
+	Duration    time.Duration
+}
+
+// Passed returns whether the snapshot has been validated successfully.
+func (r SnapshotResult) Passed() bool {
+	return r.Err == nil
+}
+
+// ValidateSnapshotDir validates all the snapshot files in the given directory by loading
+// each of them into a temporary on-disk database, so that the memory usage doesn't grow with
+// the snapshot sizes. The snapshots are validated concurrently, and the results are returned
+// in the order of the file names.
+func ValidateSnapshotDir(dir string) ([]SnapshotResult, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || !strings.HasPrefix(fileInfo.Name(), snapshotFilePrefix) {
+			continue
+		}
+		paths = append(paths, path.Join(dir, fileInfo.Name()))
+	}
+	sort.Strings(paths)
+
+	results := make([]SnapshotResult, len(paths))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU() && i < len(paths); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				results[idx] = validateSnapshotFile(paths[idx])
+			}
+		}()
+	}
+	for idx := range paths {
+		indices <- idx
+	}
+	close(indices)
+	wg.Wait()
+
+	return results, nil
+}
+
+func validateSnapshotFile(snapshotFilePath string) SnapshotResult {
+	start := time.Now()
+	tmpdb, cleanup := createTempDB()
+	defer cleanup()
+	blockHeader, _, err := loadSnapshot(snapshotFilePath, tmpdb, "Validating Snapshot", NewLoadSnapshotOptions())
+	result := SnapshotResult{
+		Path:        snapshotFilePath,
+		BlockHeader: blockHeader,
+		Err:         err,
+		Duration:    time.Since(start),
+	}
+	if err != nil {
+		logger.Warnf("Snapshot %v failed validation: %v", snapshotFilePath, err)
+	} else {
+		logger.Infof("Snapshot %v validated in %v", snapshotFilePath, result.Duration)
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestValidateSnapshotDir(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	goodPath := path.Join(dir, "theta_snapshot-10-good")
+	metadata := writeValidTestSnapshot(t, goodPath, 10, common.HexToAddress("0x1"))
+
+	// Truncate a copy of the good snapshot to corrupt it.
+	content, err := ioutil.ReadFile(goodPath)
+	require.Nil(err)
+	corruptPath := path.Join(dir, "theta_snapshot-20-corrupt")
+	require.Nil(ioutil.WriteFile(corruptPath, content[:len(content)-10], 0644))
+
+	// Other files are ignored.
+	require.Nil(ioutil.WriteFile(path.Join(dir, "README"), []byte("snapshots"), 0644))
+
+	results, err := ValidateSnapshotDir(dir)
+	require.Nil(err)
+	require.Equal(2, len(results))
+
+	assert.Equal(goodPath, results[0].Path)
+	assert.True(results[0].Passed())
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), results[0].BlockHeader.Hash())
+
+	assert.Equal(corruptPath, results[1].Path)
+	assert.False(results[1].Passed())
+	assert.NotNil(results[1].Err)
+}
@@ -0,0 +1,73 @@
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// SnapshotPhase is the stage of the snapshot loading pipeline.
+type SnapshotPhase string
+
+const (
+	SnapshotPhaseMetadata SnapshotPhase = "metadata"
+	SnapshotPhaseState    SnapshotPhase = "state"
+	SnapshotPhaseTrios    SnapshotPhase = "trios"
+	SnapshotPhaseVotes    SnapshotPhase = "votes"
+)
+
+// SnapshotError describes where in the snapshot loading pipeline a failure occurred.
+type SnapshotError struct {
+	Phase SnapshotPhase
+
+	// RecordOffset is the offset of the failing record from the start of the state records.
+	RecordOffset uint64
+
+	// StoreViewHeight is the height of the store view, or of the block, being checked.
+	StoreViewHeight uint64
+
+	// AccountAddress is the account whose storage failed, nil if not account specific.
+	AccountAddress *common.Address
+
+	Err error
+}
+
+func (e *SnapshotError) Error() string {
+	context := []string{}
+	if e.RecordOffset != 0 {
+		context = append(context, fmt.Sprintf("record offset: %v", e.RecordOffset))
+	}
+	if e.StoreViewHeight != 0 {
+		context = append(context, fmt.Sprintf("height: %v", e.StoreViewHeight))
+	}
+	if e.AccountAddress != nil {
+		context = append(context, fmt.Sprintf("account: %v", e.AccountAddress.Hex()))
+	}
+	if len(context) == 0 {
+		return fmt.Sprintf("Snapshot %v check failed: %v", e.Phase, e.Err)
+	}
+	return fmt.Sprintf("Snapshot %v check failed (%v): %v", e.Phase, strings.Join(context, ", "), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, for use with errors.Cause.
+func (e *SnapshotError) Cause() error {
+	return e.Err
+}
+
+// wrapSnapshotError attributes the error to the given phase and height, unless it already
+// carries a more specific snapshot context.
+func wrapSnapshotError(phase SnapshotPhase, height uint64, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*SnapshotError); ok {
+		return err
+	}
+	return &SnapshotError{Phase: phase, StoreViewHeight: height, Err: err}
+}
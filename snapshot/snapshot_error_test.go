@@ -0,0 +1,102 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func requireSnapshotError(t *testing.T, err error) *SnapshotError {
+	require.NotNil(t, err)
+	snapshotErr, ok := err.(*SnapshotError)
+	require.True(t, ok, "unexpected error type: %v", err)
+	return snapshotErr
+}
+
+func TestSnapshotErrorBadAccountRoot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := common.HexToAddress("0x1")
+	account := &types.Account{Address: addr, Balance: types.NewCoins(0, 0), Root: common.HexToHash("a1")}
+	accountBytes, err := types.ToBytes(account)
+	require.Nil(err)
+
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	height := core.Itobytes(10)
+	require.Nil(core.WriteRecord(writer, []byte{core.SVStart}, height))
+	require.Nil(core.WriteRecord(writer, state.AccountKey(addr), accountBytes))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVStart}, height))
+	require.Nil(core.WriteRecord(writer, common.Bytes("storage"), common.Bytes("value")))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVEnd}, height))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVEnd}, height))
+	require.Nil(writer.Flush())
+
+	_, _, err = loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, nil)
+	snapshotErr := requireSnapshotError(t, err)
+	assert.Equal(SnapshotPhaseState, snapshotErr.Phase)
+	assert.Equal(uint64(10), snapshotErr.StoreViewHeight)
+	require.NotNil(snapshotErr.AccountAddress)
+	assert.Equal(addr, *snapshotErr.AccountAddress)
+	assert.True(snapshotErr.RecordOffset > 0)
+	assert.Contains(err.Error(), "Account storage root doesn't match")
+	assert.Contains(err.Error(), addr.Hex())
+}
+
+func TestSnapshotErrorBadVote(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey1, _, _ := crypto.GenerateKeyPair()
+	privKey2, _, _ := crypto.GenerateKeyPair()
+	addr1 := privKey1.PublicKey().Address()
+
+	db := backend.NewMemDatabase()
+	genesisSV := createTestSnapshotState(t, db, core.GenesisBlockHeight, addr1)
+	genesis := &core.BlockHeader{ChainID: "testchain", Height: core.GenesisBlockHeight, StateHash: genesisSV.Hash(), Timestamp: big.NewInt(0)}
+	// The genesis snapshot has no first and third blocks, which read back as empty headers.
+	genesisTrio := core.SnapshotBlockTrio{
+		First:  core.SnapshotFirstBlock{Header: &core.BlockHeader{}},
+		Second: core.SnapshotSecondBlock{Header: genesis},
+		Third:  core.SnapshotThirdBlock{Header: &core.BlockHeader{}, VoteSet: core.NewVoteSet()},
+	}
+
+	// The validator set change is endorsed by a non-validator.
+	trio := createTestEndorsedTrio(t, 10, privKey2, addr1)
+	opts := &LoadSnapshotOptions{GenesisHash: genesis.Hash()}
+
+	_, err := checkProofTrios([]core.SnapshotBlockTrio{genesisTrio, trio}, ecdsaVoteVerifier{}, db, opts)
+	snapshotErr := requireSnapshotError(t, err)
+	assert.Equal(SnapshotPhaseVotes, snapshotErr.Phase)
+	assert.Equal(uint64(10), snapshotErr.StoreViewHeight)
+	assert.Nil(snapshotErr.AccountAddress)
+	assert.Contains(snapshotErr.Err.Error(), "majority")
+}
+
+func TestSnapshotErrorHashMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, 10, common.HexToAddress("0x1"))
+	metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}
+
+	for _, check := range []func() error{
+		func() error { return checkSnapshot(sv, metadata, db, nil) },
+		func() error { return checkSnapshotV4(sv, metadata, db, nil) },
+	} {
+		snapshotErr := requireSnapshotError(t, check())
+		assert.Equal(SnapshotPhaseState, snapshotErr.Phase)
+		assert.Equal(uint64(10), snapshotErr.StoreViewHeight)
+		assert.Contains(snapshotErr.Error(), "StateHash not matching")
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"os"
+	"math/big"
 	"path"
 	"strconv"
 	"time"
 
+	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	cns "github.com/thetatoken/theta/consensus"
@@ -22,7 +23,118 @@ import (
 	"github.com/thetatoken/theta/store/trie"
 )
 
+// ExportSnapshotOptions tunes how a V2 snapshot is exported.
+type ExportSnapshotOptions struct {
+	// ExcludeAccounts, if specified, excludes the matching accounts and their storage from
+	// the exported state, except the genesis state. The snapshot is then flagged as filtered,
+	// since its state no longer matches the state root of the snapshot block, and the root of
+	// the filtered snapshot block state is recorded in the metadata.
+	ExcludeAccounts func(addr common.Address) bool
+
+	// PruneDust, if true, prunes the dust accounts, i.e. the accounts without code, storage
+	// and reserved funds, holding no Theta and at most DustThreshold TFuel wei (nil: zero).
+	// The snapshot is then filtered like with ExcludeAccounts.
+	PruneDust     bool
+	DustThreshold *big.Int
+}
+
+// accountFilter returns the predicate of the accounts excluded from the exported state, nil if
+// none is.
+func (opts *ExportSnapshotOptions) accountFilter() func(account *types.Account) bool {
+	if opts == nil || (opts.ExcludeAccounts == nil && !opts.PruneDust) {
+		return nil
+	}
+	return func(account *types.Account) bool {
+		if opts.ExcludeAccounts != nil && opts.ExcludeAccounts(account.Address) {
+			return true
+		}
+		return opts.PruneDust && isDustAccount(account, opts.DustThreshold)
+	}
+}
+
+// isDustAccount returns whether the account holds nothing but at most threshold TFuel wei.
+func isDustAccount(account *types.Account, threshold *big.Int) bool {
+	if account.Root != (common.Hash{}) && account.Root != core.EmptyRootHash {
+		return false
+	}
+	if account.CodeHash != (common.Hash{}) && account.CodeHash != types.EmptyCodeHash {
+		return false
+	}
+	if len(account.ReservedFunds) != 0 {
+		return false
+	}
+	balance := account.Balance.NoNil()
+	if balance.ThetaWei.Sign() != 0 {
+		return false
+	}
+	if threshold == nil {
+		return balance.TFuelWei.Sign() == 0
+	}
+	return balance.TFuelWei.Cmp(threshold) <= 0
+}
+
+// hasValidatorUpdate returns whether the block at the given height, whose state is sv, has a
+// validator update, i.e. contains stake transactions.
+func hasValidatorUpdate(sv *state.StoreView, height uint64) bool {
+	hl := sv.GetStakeTransactionHeightList()
+	return height != core.GenesisBlockHeight && hl != nil && hl.Contains(height)
+}
+
+// checkSkippedProofTrio checks that the validator set proven by the proof trios is bound to the
+// state like the loader does, as the proof trio of the snapshot block is skipped for its
+// unconfirmed validator update.
+func checkSkippedProofTrio(sv *state.StoreView, metadata *core.SnapshotMetadata, db database.Database) error {
+	if len(metadata.ProofTrios) == 0 {
+		return fmt.Errorf("Missing the genesis block")
+	}
+	last := &metadata.ProofTrios[len(metadata.ProofTrios)-1]
+	var provenValSet *core.ValidatorSet
+	if len(metadata.ProofTrios) == 1 {
+		genesis := last.Second.Header
+		provenValSet = getValidatorSetFromSV(state.NewStoreView(genesis.Height, genesis.StateHash, db))
+	} else {
+		var err error
+		provenValSet, err = getValidatorSetFromVCPProof(last.First.Header.StateHash, &last.First.Proof)
+		if err != nil {
+			return fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)
+		}
+	}
+	if err := checkTailValidatorSet(sv, provenValSet, metadata); err != nil {
+		return fmt.Errorf("Invalid snapshot block validator update: %v", err)
+	}
+	return nil
+}
+
+// prunedStateHash returns the root of the state without the excluded accounts. The pruned
+// state is hashed in memory, nothing is written to the database.
+func prunedStateHash(sv *state.StoreView, excludeAccount func(account *types.Account) bool) (common.Hash, error) {
+	pruned := state.NewStoreView(sv.Height(), sv.Hash(), sv.GetDB())
+	var err error
+	sv.Traverse(state.AccountKeyPrefix(), func(k, v common.Bytes) bool {
+		account := &types.Account{}
+		if err = types.FromBytes(v, account); err != nil {
+			err = fmt.Errorf("Failed to parse account %v: %v", common.Bytes2Hex(k), err)
+			return false
+		}
+		if excludeAccount(account) {
+			pruned.Delete(k)
+		}
+		return true
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return pruned.Hash(), nil
+}
+
 func ExportSnapshotV2(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, height uint64) (string, error) {
+	return ExportSnapshotV2WithOptions(db, consensus, chain, snapshotDir, height, nil)
+}
+
+// ExportSnapshotV2WithOptions exports a V2 snapshot with the given export options.
+func ExportSnapshotV2WithOptions(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, height uint64, opts *ExportSnapshotOptions) (string, error) {
+	excludeAccount := opts.accountFilter()
+
 	var lastFinalizedBlock *core.ExtendedBlock
 	if height != 0 {
 		blocks := chain.FindBlocksByHeight(height)
@@ -47,25 +159,51 @@ func ExportSnapshotV2(db database.Database, consensus *cns.ConsensusEngine, chai
 	sv := state.NewStoreView(lastFinalizedBlock.Height, lastFinalizedBlock.BlockHeader.StateHash, db)
 
 	currentTime := time.Now().UTC()
-	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02")
+	compression, err := exportCompression()
+	if err != nil {
+		return "", err
+	}
+	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02") + compression.FileExtension()
 	snapshotPath := path.Join(snapshotDir, filename)
-	file, err := os.Create(snapshotPath)
+	snapshotWriter, err := createSnapshotFileWriter(snapshotPath, compression)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
+	defer snapshotWriter.Close()
+	writer := snapshotWriter.Writer
 
 	// --------------- Export the Header Section --------------- //
 
+	var recordFlags uint
+	if viper.GetBool(common.CfgSnapshotPrefixCompression) {
+		recordFlags |= core.SnapshotPrefixCompressed
+	}
+	if viper.GetBool(common.CfgSnapshotTypedRecords) {
+		recordFlags |= core.SnapshotTypedRecords
+	}
 	snapshotHeader := &core.SnapshotHeader{
 		Magic:   core.SnapshotHeaderMagic,
 		Version: 2,
+		Flags:   recordFlags,
+	}
+	if err = checkRecordFlags(snapshotHeader); err != nil {
+		return "", err
+	}
+	if excludeAccount != nil {
+		snapshotHeader.Flags |= core.SnapshotFiltered
+	}
+	if recordChecksums() {
+		snapshotHeader.Flags |= core.SnapshotChecksummed
 	}
 	err = core.WriteSnapshotHeader(writer, snapshotHeader)
 	if err != nil {
 		return "", err
 	}
+	if snapshotHeader.HasRecordChecksums() {
+		if err = snapshotWriter.enableRecordChecksums(); err != nil {
+			return "", err
+		}
+	}
 
 	// ------------ Export the Last Checkpoint Section ------------- //
 
@@ -96,15 +234,19 @@ func ExportSnapshotV2(db database.Database, consensus *cns.ConsensusEngine, chai
 
 	// -------------- Export the Metadata Section -------------- //
 
-	metadata := &core.SnapshotMetadata{}
+	metadata := &core.SnapshotMetadata{Version: core.CurrentSnapshotMetadataVersion, VoteScheme: VoteSchemeECDSA}
 	var genesisBlockHeader *core.BlockHeader
 	kvStore := kvstore.NewKVStore(db)
 	hl := sv.GetStakeTransactionHeightList().Heights
 	for _, height := range hl {
+		if height == lastFinalizedBlock.Height && height != core.GenesisBlockHeight {
+			// The validator update of the snapshot block is not confirmed yet, the next
+			// validator set is proven by the next VCP proof instead of a proof trio.
+			continue
+		}
+
 		// check kvstore first
-		blockTrio := &core.SnapshotBlockTrio{}
-		blockTrioKey := []byte(core.BlockTrioStoreKeyPrefix + strconv.FormatUint(height, 10))
-		err := kvStore.Get(blockTrioKey, blockTrio)
+		blockTrio, err := core.GetBlockTrioByHeight(kvStore, height)
 		if err == nil {
 			metadata.ProofTrios = append(metadata.ProofTrios, *blockTrio)
 			if height == core.GenesisBlockHeight {
@@ -212,6 +354,22 @@ func ExportSnapshotV2(db database.Database, consensus *cns.ConsensusEngine, chai
 		Second: core.SnapshotSecondBlock{Header: lastFinalizedBlock.BlockHeader},
 		Third:  core.SnapshotThirdBlock{Header: childBlock.BlockHeader, VoteSet: childVoteSet},
 	}
+	if hasValidatorUpdate(sv, lastFinalizedBlock.Height) {
+		nextVCPProof, err := proveVCP(lastFinalizedBlock, db)
+		if err != nil {
+			return "", fmt.Errorf("Failed to get the next VCP Proof")
+		}
+		metadata.NextVCPProof = *nextVCPProof
+		if err = checkSkippedProofTrio(sv, metadata, db); err != nil {
+			return "", err
+		}
+	}
+	if excludeAccount != nil {
+		metadata.PrunedStateHash, err = prunedStateHash(sv, excludeAccount)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	err = core.WriteMetadata(writer, metadata)
 	if err != nil {
@@ -220,24 +378,37 @@ func ExportSnapshotV2(db database.Database, consensus *cns.ConsensusEngine, chai
 
 	// -------------- Export the StoreView Section -------------- //
 
-	// Genesis storeview
+	// Genesis storeview, never filtered as the genesis validator set is read from its root
 	genesisSV := state.NewStoreView(genesisBlockHeader.Height, genesisBlockHeader.StateHash, db)
-	writeStoreView(genesisSV, false, writer, db)
+	writeFilteredStoreView(genesisSV, false, writer, db, recordFlags, nil)
 
 	// Last checkpoint storeview
 	if lastFinalizedBlock.Height != lastCheckpointHeight {
 		lastCheckpointSV := state.NewStoreView(lastCheckpointBlock.Height, lastCheckpointBlock.StateHash, db)
-		writeStoreView(lastCheckpointSV, true, writer, db)
+		writeFilteredStoreView(lastCheckpointSV, true, writer, db, recordFlags, excludeAccount)
 	}
 
 	// Parent block storeview
 	parentSV := state.NewStoreView(parentBlock.Height, parentBlock.StateHash, db)
-	writeStoreView(parentSV, true, writer, db)
-	writeStoreView(sv, true, writer, db)
+	writeFilteredStoreView(parentSV, true, writer, db, recordFlags, excludeAccount)
+	writeFilteredStoreView(sv, true, writer, db, recordFlags, excludeAccount)
 
+	if err = snapshotWriter.Close(); err != nil {
+		return "", err
+	}
 	return filename, nil
 }
 
+// ExportSnapshot exports a V3 snapshot of the state at the given finalized height, along with
+// the block trios proving the validator set changes since genesis. Unlike the other exports it
+// doesn't need a running consensus engine, so it can be used on the database of a stopped node.
+func ExportSnapshot(db database.Database, chain *blockchain.Chain, snapshotDir string, height uint64) (string, error) {
+	if height == 0 {
+		return "", fmt.Errorf("The snapshot height needs to be specified")
+	}
+	return ExportSnapshotV3(db, nil, chain, snapshotDir, height)
+}
+
 func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, height uint64) (string, error) {
 	var lastFinalizedBlock *core.ExtendedBlock
 	if height != 0 {
@@ -263,14 +434,18 @@ func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chai
 	sv := state.NewStoreView(lastFinalizedBlock.Height, lastFinalizedBlock.BlockHeader.StateHash, db)
 
 	currentTime := time.Now().UTC()
-	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02")
+	compression, err := exportCompression()
+	if err != nil {
+		return "", err
+	}
+	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02") + compression.FileExtension()
 	snapshotPath := path.Join(snapshotDir, filename)
-	file, err := os.Create(snapshotPath)
+	snapshotWriter, err := createSnapshotFileWriter(snapshotPath, compression)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
+	defer snapshotWriter.Close()
+	writer := snapshotWriter.Writer
 
 	// --------------- Export the Header Section --------------- //
 
@@ -278,10 +453,18 @@ func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chai
 		Magic:   core.SnapshotHeaderMagic,
 		Version: 3,
 	}
+	if recordChecksums() {
+		snapshotHeader.Flags |= core.SnapshotChecksummed
+	}
 	err = core.WriteSnapshotHeader(writer, snapshotHeader)
 	if err != nil {
 		return "", err
 	}
+	if snapshotHeader.HasRecordChecksums() {
+		if err = snapshotWriter.enableRecordChecksums(); err != nil {
+			return "", err
+		}
+	}
 
 	// ------------ Export the Last Checkpoint Section ------------- //
 
@@ -312,15 +495,19 @@ func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chai
 
 	// -------------- Export the Metadata Section -------------- //
 
-	metadata := &core.SnapshotMetadata{}
+	metadata := &core.SnapshotMetadata{Version: core.CurrentSnapshotMetadataVersion, VoteScheme: VoteSchemeECDSA}
 	var genesisBlockHeader *core.BlockHeader
 	kvStore := kvstore.NewKVStore(db)
 	hl := sv.GetStakeTransactionHeightList().Heights
 	for _, height := range hl {
+		if height == lastFinalizedBlock.Height && height != core.GenesisBlockHeight {
+			// The validator update of the snapshot block is not confirmed yet, the next
+			// validator set is proven by the next VCP proof instead of a proof trio.
+			continue
+		}
+
 		// check kvstore first
-		blockTrio := &core.SnapshotBlockTrio{}
-		blockTrioKey := []byte(core.BlockTrioStoreKeyPrefix + strconv.FormatUint(height, 10))
-		err := kvStore.Get(blockTrioKey, blockTrio)
+		blockTrio, err := core.GetBlockTrioByHeight(kvStore, height)
 		if err == nil {
 			metadata.ProofTrios = append(metadata.ProofTrios, *blockTrio)
 			if height == core.GenesisBlockHeight {
@@ -428,6 +615,16 @@ func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chai
 		Second: core.SnapshotSecondBlock{Header: lastFinalizedBlock.BlockHeader},
 		Third:  core.SnapshotThirdBlock{Header: childBlock.BlockHeader, VoteSet: childVoteSet},
 	}
+	if hasValidatorUpdate(sv, lastFinalizedBlock.Height) {
+		nextVCPProof, err := proveVCP(lastFinalizedBlock, db)
+		if err != nil {
+			return "", fmt.Errorf("Failed to get the next VCP Proof")
+		}
+		metadata.NextVCPProof = *nextVCPProof
+		if err = checkSkippedProofTrio(sv, metadata, db); err != nil {
+			return "", err
+		}
+	}
 
 	err = core.WriteMetadata(writer, metadata)
 	if err != nil {
@@ -451,10 +648,36 @@ func ExportSnapshotV3(db database.Database, consensus *cns.ConsensusEngine, chai
 	writeStoreViewV3(parentSV, false, writer, db, genesisSV.Hash())
 	writeStoreViewV3(sv, true, writer, db, parentSV.Hash())
 
+	if err = snapshotWriter.Close(); err != nil {
+		return "", err
+	}
 	return filename, nil
 }
 
 func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, height uint64) (string, error) {
+	return exportSnapshotV4(db, consensus, chain, snapshotDir, height, nil)
+}
+
+// ExportSnapshotDiff exports the state delta from the finalized block at the base height to
+// the finalized block at the given height, or the last finalized block if the height is 0.
+// The diff can be applied with ApplySnapshotDiff by a node which holds the base state.
+func ExportSnapshotDiff(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, baseHeight, height uint64) (string, error) {
+	var baseBlock *core.ExtendedBlock
+	for _, block := range chain.FindBlocksByHeight(baseHeight) {
+		if block.Status.IsDirectlyFinalized() {
+			baseBlock = block
+			break
+		}
+	}
+	if baseBlock == nil {
+		return "", fmt.Errorf("Can't find finalized base block at height %v", baseHeight)
+	}
+	return exportSnapshotV4(db, consensus, chain, snapshotDir, height, baseBlock)
+}
+
+// exportSnapshotV4 exports a V4 snapshot, or a diff against the state of the base block if
+// specified.
+func exportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chain *blockchain.Chain, snapshotDir string, height uint64, baseBlock *core.ExtendedBlock) (string, error) {
 	var lastFinalizedBlock *core.ExtendedBlock
 	if height != 0 {
 		blocks := chain.FindBlocksByHeight(height)
@@ -477,16 +700,26 @@ func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chai
 		}
 	}
 	sv := state.NewStoreView(lastFinalizedBlock.Height, lastFinalizedBlock.BlockHeader.StateHash, db)
+	if baseBlock != nil && baseBlock.Height >= lastFinalizedBlock.Height {
+		return "", fmt.Errorf("Snapshot diff base height %v is not below the snapshot height %v", baseBlock.Height, lastFinalizedBlock.Height)
+	}
 
 	currentTime := time.Now().UTC()
-	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02")
+	compression, err := exportCompression()
+	if err != nil {
+		return "", err
+	}
+	filename := "theta_snapshot-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02") + compression.FileExtension()
+	if baseBlock != nil {
+		filename = "theta_snapshot_diff-" + strconv.FormatUint(baseBlock.Height, 10) + "-" + strconv.FormatUint(sv.Height(), 10) + "-" + sv.Hash().String() + "-" + currentTime.Format("2006-01-02") + compression.FileExtension()
+	}
 	snapshotPath := path.Join(snapshotDir, filename)
-	file, err := os.Create(snapshotPath)
+	snapshotWriter, err := createSnapshotFileWriter(snapshotPath, compression)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	writer := bufio.NewWriter(file)
+	defer snapshotWriter.Close()
+	writer := snapshotWriter.Writer
 
 	// --------------- Export the Header Section --------------- //
 
@@ -494,10 +727,30 @@ func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chai
 		Magic:   core.SnapshotHeaderMagic,
 		Version: 4,
 	}
+	if baseBlock != nil {
+		snapshotHeader.Flags |= core.SnapshotDiff
+	}
+	if recordChecksums() {
+		snapshotHeader.Flags |= core.SnapshotChecksummed
+	}
 	err = core.WriteSnapshotHeader(writer, snapshotHeader)
 	if err != nil {
 		return "", err
 	}
+	if snapshotHeader.HasRecordChecksums() {
+		if err = snapshotWriter.enableRecordChecksums(); err != nil {
+			return "", err
+		}
+	}
+
+	var baseSV *state.StoreView
+	if baseBlock != nil {
+		baseSV = state.NewStoreView(baseBlock.Height, baseBlock.StateHash, db)
+		err = core.WriteDiffBase(writer, &core.SnapshotDiffBase{Height: baseBlock.Height, BlockHash: baseBlock.Hash(), StateHash: baseBlock.StateHash})
+		if err != nil {
+			return "", err
+		}
+	}
 
 	// ------------ Export the Last Checkpoint Section ------------- //
 
@@ -529,7 +782,7 @@ func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chai
 
 	// -------------- Export the Metadata Section -------------- //
 
-	metadata := &core.SnapshotMetadata{}
+	metadata := &core.SnapshotMetadata{Version: core.CurrentSnapshotMetadataVersion, VoteScheme: VoteSchemeECDSA}
 
 	parentBlock, err := chain.FindBlock(lastFinalizedBlock.Parent)
 	if err != nil {
@@ -559,6 +812,13 @@ func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chai
 		Second: core.SnapshotSecondBlock{Header: lastFinalizedBlock.BlockHeader},
 		Third:  core.SnapshotThirdBlock{Header: childBlock.BlockHeader, VoteSet: childVoteSet},
 	}
+	if hasValidatorUpdate(sv, lastFinalizedBlock.Height) {
+		nextVCPProof, err := proveVCP(lastFinalizedBlock, db)
+		if err != nil {
+			return "", fmt.Errorf("Failed to get the next VCP Proof")
+		}
+		metadata.NextVCPProof = *nextVCPProof
+	}
 
 	err = core.WriteMetadata(writer, metadata)
 	if err != nil {
@@ -566,18 +826,25 @@ func ExportSnapshotV4(db database.Database, consensus *cns.ConsensusEngine, chai
 	}
 
 	// -------------- Export the StoreView Section -------------- //
-	// Last checkpoint storeview
-	if lastFinalizedBlock.Height != lastCheckpointHeight {
-		lastCheckpointSV := state.NewStoreView(lastCheckpointBlock.Height, lastCheckpointBlock.StateHash, db)
-		writeStoreViewV3(lastCheckpointSV, false, writer, db, common.Hash{})
-	}
+	if baseSV != nil {
+		writeStoreViewDiff(lastCheckpointBlock, parentBlock, sv, baseSV, writer, db)
+	} else {
+		// Last checkpoint storeview
+		if lastFinalizedBlock.Height != lastCheckpointHeight {
+			lastCheckpointSV := state.NewStoreView(lastCheckpointBlock.Height, lastCheckpointBlock.StateHash, db)
+			writeStoreViewV3(lastCheckpointSV, false, writer, db, common.Hash{})
+		}
 
-	// Parent block storeview
-	parentSV := state.NewStoreView(parentBlock.Height, parentBlock.StateHash, db)
-	writeStoreViewV3(parentSV, false, writer, db, common.Hash{})
+		// Parent block storeview
+		parentSV := state.NewStoreView(parentBlock.Height, parentBlock.StateHash, db)
+		writeStoreViewV3(parentSV, false, writer, db, common.Hash{})
 
-	writeStoreViewV3(sv, true, writer, db, parentSV.Hash())
+		writeStoreViewV3(sv, true, writer, db, parentSV.Hash())
+	}
 
+	if err = snapshotWriter.Close(); err != nil {
+		return "", err
+	}
 	return filename, nil
 }
 
@@ -617,38 +884,57 @@ func getAtLeastCommittedChild(block *core.ExtendedBlock, chain *blockchain.Chain
 	return nil, nil
 }
 
-func writeStoreView(sv *state.StoreView, needAccountStorage bool, writer *bufio.Writer, db database.Database) {
+func writeStoreView(sv *state.StoreView, needAccountStorage bool, writer *bufio.Writer, db database.Database, recordFlags uint) {
+	writeFilteredStoreView(sv, needAccountStorage, writer, db, recordFlags, nil)
+}
+
+// writeFilteredStoreView writes the store view, skipping the accounts matched by
+// excludeAccount along with their storage.
+func writeFilteredStoreView(sv *state.StoreView, needAccountStorage bool, writer *bufio.Writer, db database.Database, recordFlags uint, excludeAccount func(account *types.Account) bool) {
+	rw := newRecordWriter(writer, recordFlags)
 	height := core.Itobytes(sv.Height())
-	err := core.WriteRecord(writer, []byte{core.SVStart}, height)
+	err := rw.write(core.SnapshotRecordSVStart, []byte{core.SVStart}, height)
 	if err != nil {
 		panic(err)
 	}
 	sv.GetStore().Traverse(nil, func(k, v common.Bytes) bool {
-		err = core.WriteRecord(writer, k, v)
-		if err != nil {
-			panic(err)
-		}
-		if needAccountStorage && bytes.HasPrefix(k, []byte("ls/a")) {
-			account := &types.Account{}
+		isAccount := bytes.HasPrefix(k, []byte("ls/a"))
+		var account *types.Account
+		if isAccount && (needAccountStorage || excludeAccount != nil) {
+			account = &types.Account{}
 			err := types.FromBytes([]byte(v), account)
 			if err != nil {
 				logger.Errorf("Failed to parse account for %v", []byte(v))
 				panic(err)
 			}
+			if excludeAccount != nil && excludeAccount(account) {
+				return true
+			}
+		}
+
+		recordType := core.SnapshotRecordState
+		if isAccount {
+			recordType = core.SnapshotRecordAccount
+		}
+		err = rw.write(recordType, k, v)
+		if err != nil {
+			panic(err)
+		}
+		if needAccountStorage && isAccount {
 			if account.Root != (common.Hash{}) {
-				err = core.WriteRecord(writer, []byte{core.SVStart}, height)
+				err = rw.write(core.SnapshotRecordSVStart, []byte{core.SVStart}, height)
 				if err != nil {
 					panic(err)
 				}
 				storage := treestore.NewTreeStore(account.Root, db)
 				storage.Traverse(nil, func(ak, av common.Bytes) bool {
-					err = core.WriteRecord(writer, ak, av)
+					err = rw.write(core.SnapshotRecordState, ak, av)
 					if err != nil {
 						panic(err)
 					}
 					return true
 				})
-				err = core.WriteRecord(writer, []byte{core.SVEnd}, height)
+				err = rw.write(core.SnapshotRecordSVEnd, []byte{core.SVEnd}, height)
 				if err != nil {
 					panic(err)
 				}
@@ -656,7 +942,7 @@ func writeStoreView(sv *state.StoreView, needAccountStorage bool, writer *bufio.
 		}
 		return true
 	})
-	err = core.WriteRecord(writer, []byte{core.SVEnd}, height)
+	err = rw.write(core.SnapshotRecordSVEnd, []byte{core.SVEnd}, height)
 	if err != nil {
 		panic(err)
 	}
@@ -684,6 +970,43 @@ func writeStoreViewV3(sv *state.StoreView, needAccountStorage bool, writer *bufi
 	}
 }
 
+// writeStoreViewDiff writes the trie nodes of the snapshot block state, of its parent and of
+// the last checkpoint which are missing from the base state, including the storage tries of
+// the accounts whose storage changed.
+func writeStoreViewDiff(lastCheckpointBlock, parentBlock *core.ExtendedBlock, sv, baseSV *state.StoreView, writer *bufio.Writer, db database.Database) {
+	if lastCheckpointBlock.Height != sv.Height() {
+		writeTrie(lastCheckpointBlock.StateHash, writer, db, baseSV.Hash())
+	}
+	// A block without transactions shares the state of its parent.
+	if parentBlock.StateHash != sv.Hash() {
+		writeTrie(parentBlock.StateHash, writer, db, baseSV.Hash())
+	}
+	writeTrie(sv.Hash(), writer, db, baseSV.Hash())
+
+	sv.GetStore().Traverse(nil, func(k, v common.Bytes) bool {
+		if bytes.HasPrefix(k, []byte("ls/a")) {
+			account := &types.Account{}
+			err := types.FromBytes([]byte(v), account)
+			if err != nil {
+				logger.Errorf("Failed to parse account for %v", []byte(v))
+				panic(err)
+			}
+			if account.Root == (common.Hash{}) {
+				return true
+			}
+			base := common.Hash{}
+			if baseAccount := baseSV.GetAccount(account.Address); baseAccount != nil {
+				if baseAccount.Root == account.Root {
+					return true
+				}
+				base = baseAccount.Root
+			}
+			writeTrie(account.Root, writer, db, base)
+		}
+		return true
+	})
+}
+
 func writeTrie(root common.Hash, writer *bufio.Writer, db database.Database, base common.Hash) {
 	tr, err := trie.New(root, trie.NewDatabase(db))
 	if err != nil {
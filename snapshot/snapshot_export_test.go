@@ -0,0 +1,257 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestExportFilteredSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, addr1, "a", "b")
+	setTestContractAccount(sv, db, addr2, "c", "d")
+	setTestContractAccount(sv, db, addr3, "e", "f")
+	sv.Save()
+	excludeAccount := (&ExportSnapshotOptions{
+		ExcludeAccounts: func(addr common.Address) bool { return addr == addr2 },
+	}).accountFilter()
+
+	filePath := path.Join(dir, "theta_snapshot-filtered")
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	tailTrio := createTestTailTrio(sv.Height(), sv.Hash())
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 2, Flags: core.SnapshotFiltered}))
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: tailTrio.Second.Header}))
+	require.Nil(core.WriteMetadata(writer, &core.SnapshotMetadata{TailTrio: tailTrio}))
+	writeFilteredStoreView(sv, true, writer, db, 0, excludeAccount)
+	require.Nil(file.Close())
+
+	file, err = os.Open(filePath)
+	require.Nil(err)
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	header, err := core.ReadSnapshotHeader(reader)
+	require.Nil(err)
+	assert.True(header.IsFiltered())
+	assert.Equal(uint(2), header.FormatVersion())
+
+	_, err = file.Seek(0, 0)
+	require.Nil(err)
+	readRecord, _, err := readSnapshotV2Sections(bufio.NewReader(file))
+	require.Nil(err)
+	records := readTestRecords(t, readRecord)
+	keys := []string{}
+	numStorageViews := 0
+	for _, record := range records {
+		if bytes.Equal(record.K, []byte{core.SVStart}) {
+			numStorageViews++
+		}
+		keys = append(keys, string(record.K))
+	}
+	assert.Contains(keys, string(state.AccountKey(addr1)))
+	assert.Contains(keys, string(state.AccountKey(addr3)))
+	assert.NotContains(keys, string(state.AccountKey(addr2)))
+	// The top level store view and the storage of the two remaining accounts.
+	assert.Equal(3, numStorageViews)
+
+	// A filtered snapshot which doesn't record its pruned state hash cannot be verified.
+	_, _, err = loadSnapshot(filePath, backend.NewMemDatabase(), "Testing", nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "filtered")
+}
+
+func TestLoadPrunedSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	validator := common.HexToAddress("0x1")
+	dust := common.HexToAddress("0x2")
+	rich := common.HexToAddress("0x3")
+	srcDB := backend.NewMemDatabase()
+	genesisSV := createTestSnapshotState(t, srcDB, core.GenesisBlockHeight, validator)
+	genesis := &core.BlockHeader{ChainID: "testchain", Height: core.GenesisBlockHeight, StateHash: genesisSV.Hash(), Timestamp: big.NewInt(0)}
+	sv := createTestSnapshotState(t, srcDB, 10, validator)
+	sv.SetAccount(dust, &types.Account{Address: dust, Balance: types.NewCoins(0, 5)})
+	sv.SetAccount(rich, &types.Account{Address: rich, Balance: types.NewCoins(100, 200)})
+	sv.Save()
+
+	excludeAccount := (&ExportSnapshotOptions{PruneDust: true, DustThreshold: big.NewInt(10)}).accountFilter()
+	prunedHash, err := prunedStateHash(sv, excludeAccount)
+	require.Nil(err)
+	tailTrio := createTestTailTrio(sv.Height(), sv.Hash())
+	endorseTestTailTrio(&tailTrio, getValidatorSetFromSV(sv))
+	metadata := &core.SnapshotMetadata{
+		ProofTrios:      []core.SnapshotBlockTrio{{Second: core.SnapshotSecondBlock{Header: genesis}}},
+		TailTrio:        tailTrio,
+		Version:         core.CurrentSnapshotMetadataVersion,
+		PrunedStateHash: prunedHash,
+		VoteScheme:      testVoteScheme,
+	}
+
+	// The snapshot is laid out like a pruned export, with the genesis state left unfiltered.
+	writePrunedSnapshot := func(filePath string) {
+		file, err := os.Create(filePath)
+		require.Nil(err)
+		defer file.Close()
+		writer := bufio.NewWriter(file)
+		require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 2, Flags: core.SnapshotFiltered}))
+		require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: tailTrio.Second.Header}))
+		require.Nil(core.WriteMetadata(writer, metadata))
+		writeFilteredStoreView(genesisSV, false, writer, srcDB, 0, nil)
+		writeFilteredStoreView(sv, true, writer, srcDB, 0, excludeAccount)
+	}
+	opts := &LoadSnapshotOptions{GenesisHash: genesis.Hash()}
+
+	prunedPath := path.Join(dir, "theta_snapshot-pruned")
+	writePrunedSnapshot(prunedPath)
+	db := backend.NewMemDatabase()
+	header, loadedMetadata, err := LoadSnapshot(prunedPath, db, opts)
+	require.Nil(err)
+	assert.Equal(tailTrio.Second.Header.Hash(), header.Hash())
+	assert.Equal(prunedHash, loadedMetadata.PrunedStateHash)
+	loaded := state.NewStoreView(sv.Height(), prunedHash, db)
+	assert.Nil(loaded.GetAccount(dust))
+	assert.NotNil(loaded.GetAccount(rich))
+
+	// The pruned state is verified against the recorded pruned state hash.
+	metadata.PrunedStateHash = sv.Hash()
+	mismatchPath := path.Join(dir, "theta_snapshot-mismatch")
+	writePrunedSnapshot(mismatchPath)
+	_, _, err = LoadSnapshot(mismatchPath, backend.NewMemDatabase(), opts)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "StateHash not matching")
+}
+
+func TestExportSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	signer, _, err := crypto.GenerateKeyPair()
+	require.Nil(err)
+	validator := signer.PublicKey().Address()
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, core.GenesisBlockHeight, validator)
+	sv.UpdateStakeTransactionHeightList(&types.HeightList{Heights: []uint64{core.GenesisBlockHeight}})
+	stateHash := sv.Save()
+
+	// The chain of a stopped node: the blocks up to height 3 are finalized, and the block at
+	// height 4 is committed with the votes stored.
+	genesis := core.NewBlock()
+	genesis.ChainID = "testchain"
+	genesis.Height = core.GenesisBlockHeight
+	genesis.StateHash = stateHash
+	genesis.Timestamp = big.NewInt(0)
+	chain := blockchain.NewChain(genesis.ChainID, kvstore.NewKVStore(db), genesis)
+	blocks := []*core.Block{genesis}
+	for height := uint64(1); height <= 4; height++ {
+		parent := blocks[len(blocks)-1]
+		block := core.NewBlock()
+		block.ChainID = genesis.ChainID
+		block.Height = height
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = parent.Hash()
+		block.StateHash = stateHash
+		block.Timestamp = big.NewInt(int64(height))
+		_, err := chain.AddBlock(block)
+		require.Nil(err)
+		blocks = append(blocks, block)
+	}
+	require.Nil(chain.FinalizePreviousBlocks(blocks[3].Hash()))
+	chain.CommitBlock(blocks[4].Hash())
+	vote := core.Vote{Block: blocks[4].Hash(), Height: blocks[4].Height, ID: validator}
+	vote.Sign(signer)
+	chain.AddVoteToIndex(vote)
+
+	_, err = ExportSnapshot(db, chain, dir, 0)
+	assert.NotNil(err)
+	_, err = ExportSnapshot(db, chain, dir, 4)
+	assert.NotNil(err)
+
+	filename, err := ExportSnapshot(db, chain, dir, 3)
+	require.Nil(err)
+	file, err := os.Open(path.Join(dir, filename))
+	require.Nil(err)
+	defer file.Close()
+	head, err := readSnapshotHead(bufio.NewReader(file))
+	require.Nil(err)
+	assert.Equal(uint(3), head.header.FormatVersion())
+	assert.Equal(blocks[1].Hash(), head.lastCheckpoint.CheckpointHeader.Hash())
+
+	metadata := head.metadata
+	assert.Equal(VoteSchemeECDSA, metadata.VoteScheme)
+	require.Equal(1, len(metadata.ProofTrios))
+	assert.Equal(genesis.Hash(), metadata.ProofTrios[0].Second.Header.Hash())
+	assert.Equal(blocks[2].Hash(), metadata.TailTrio.First.Header.Hash())
+	assert.Equal(blocks[3].Hash(), metadata.TailTrio.Second.Header.Hash())
+	assert.Equal(blocks[4].Hash(), metadata.TailTrio.Third.Header.Hash())
+	require.Equal(1, metadata.TailTrio.Third.VoteSet.Size())
+	assert.Equal(validator, metadata.TailTrio.Third.VoteSet.Votes()[0].ID)
+}
+
+func TestPruneDustAccounts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.True(isDustAccount(&types.Account{}, nil))
+	assert.True(isDustAccount(&types.Account{Balance: types.NewCoins(0, 10)}, big.NewInt(10)))
+	assert.False(isDustAccount(&types.Account{Balance: types.NewCoins(0, 11)}, big.NewInt(10)))
+	assert.False(isDustAccount(&types.Account{Balance: types.NewCoins(0, 1)}, nil))
+	assert.False(isDustAccount(&types.Account{Balance: types.NewCoins(1, 0)}, big.NewInt(10)))
+
+	dust := common.HexToAddress("0x1")
+	rich := common.HexToAddress("0x2")
+	contract := common.HexToAddress("0x3")
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	sv.SetAccount(dust, &types.Account{Address: dust, Balance: types.NewCoins(0, 5)})
+	sv.SetAccount(rich, &types.Account{Address: rich, Balance: types.NewCoins(100, 200)})
+	setTestContractAccount(sv, db, contract, "a")
+	sv.Save()
+	account := sv.GetAccount(contract)
+	assert.False(isDustAccount(account, big.NewInt(10)))
+
+	excludeAccount := (&ExportSnapshotOptions{PruneDust: true, DustThreshold: big.NewInt(10)}).accountFilter()
+	prunedHash, err := prunedStateHash(sv, excludeAccount)
+	require.Nil(err)
+
+	// The expected state reads the storage of the contract from the same database.
+	expected := state.NewStoreView(10, common.Hash{}, db)
+	expected.SetAccount(rich, &types.Account{Address: rich, Balance: types.NewCoins(100, 200)})
+	expected.SetAccount(contract, account)
+	assert.Equal(expected.Hash(), prunedHash)
+	assert.NotEqual(sv.Hash(), prunedHash)
+
+	// The pruned state is not written to the database.
+	assert.NotNil(state.NewStoreView(10, sv.Hash(), db).GetAccount(dust))
+}
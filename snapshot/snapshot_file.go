@@ -0,0 +1,85 @@
+package snapshot
+
+import (
+	"io"
+	"os"
+)
+
+// SnapshotFile is a snapshot file opened for random access reads. The file is either
+// memory-mapped, or read with positioned reads if mmap is unavailable.
+type SnapshotFile struct {
+	file *os.File
+	data []byte // the mapped file content, nil if not mapped
+	size int64
+}
+
+var _ io.ReaderAt = (*SnapshotFile)(nil)
+
+// OpenSnapshotFile opens the snapshot file. If useMmap is true, the file is memory-mapped,
+// falling back to positioned reads if mmap is unavailable.
+func OpenSnapshotFile(snapshotFilePath string, useMmap bool) (*SnapshotFile, error) {
+	file, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	sf := &SnapshotFile{
+		file: file,
+		size: fileInfo.Size(),
+	}
+	if useMmap && sf.size > 0 {
+		data, err := mmapFile(file, sf.size)
+		if err != nil {
+			logger.Warnf("Failed to mmap snapshot %v, falling back to streaming reads: %v", snapshotFilePath, err)
+		} else {
+			sf.data = data
+		}
+	}
+	return sf, nil
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (sf *SnapshotFile) ReadAt(p []byte, off int64) (int, error) {
+	if sf.data == nil {
+		return sf.file.ReadAt(p, off)
+	}
+	if off >= sf.size {
+		return 0, io.EOF
+	}
+	n := copy(p, sf.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// NewReader returns a reader of the whole file content, independent of the other readers.
+func (sf *SnapshotFile) NewReader() io.Reader {
+	return io.NewSectionReader(sf, 0, sf.size)
+}
+
+// Size returns the size of the file in bytes.
+func (sf *SnapshotFile) Size() int64 {
+	return sf.size
+}
+
+// IsMapped returns whether the file is memory-mapped.
+func (sf *SnapshotFile) IsMapped() bool {
+	return sf.data != nil
+}
+
+// Close unmaps and closes the file.
+func (sf *SnapshotFile) Close() error {
+	if sf.data != nil {
+		if err := munmapFile(sf.data); err != nil {
+			return err
+		}
+		sf.data = nil
+	}
+	return sf.file.Close()
+}
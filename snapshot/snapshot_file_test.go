@@ -0,0 +1,63 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestLoadSnapshotMmap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-mmap")
+	writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"), common.HexToAddress("0x2"))
+	content, err := ioutil.ReadFile(snapshotPath)
+	require.Nil(err)
+
+	// Random access reads return the same content through both paths.
+	for _, useMmap := range []bool{false, true} {
+		sf, err := OpenSnapshotFile(snapshotPath, useMmap)
+		require.Nil(err)
+		if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+			assert.Equal(useMmap, sf.IsMapped())
+		}
+		assert.Equal(int64(len(content)), sf.Size())
+		for _, off := range []int{0, 7, len(content) / 2, len(content) - 5} {
+			buf := make([]byte, 5)
+			n, err := sf.ReadAt(buf, int64(off))
+			require.Nil(err)
+			assert.Equal(content[off:off+n], buf[:n])
+		}
+		_, err = sf.ReadAt(make([]byte, 10), int64(len(content)-5))
+		assert.NotNil(err)
+		require.Nil(sf.Close())
+	}
+
+	streamedDB := backend.NewMemDatabase()
+	streamedHeader, _, err := LoadSnapshot(snapshotPath, streamedDB, &LoadSnapshotOptions{})
+	require.Nil(err)
+	mappedDB := backend.NewMemDatabase()
+	mappedHeader, _, err := LoadSnapshot(snapshotPath, mappedDB, &LoadSnapshotOptions{UseMmap: true})
+	require.Nil(err)
+
+	assert.Equal(streamedHeader.Hash(), mappedHeader.Hash())
+	require.Equal(streamedDB.Len(), mappedDB.Len())
+	for _, key := range streamedDB.Keys() {
+		expected, err := streamedDB.Get(key)
+		require.Nil(err)
+		actual, err := mappedDB.Get(key)
+		require.Nil(err)
+		assert.Equal(expected, actual)
+	}
+}
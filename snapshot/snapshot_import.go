@@ -1,6 +1,7 @@
 package snapshot
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -15,7 +16,6 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/consensus"
@@ -32,6 +32,9 @@ import (
 
 var logger *log.Entry = log.WithFields(log.Fields{"prefix": "snapshot"})
 
+// ValidatedSnapshotHeaderKey is the DB key of the header of the last validated snapshot block.
+const ValidatedSnapshotHeaderKey = "/snapshot_blockheader"
+
 type SVStack []*state.StoreView
 
 func (s SVStack) push(sv *state.StoreView) SVStack {
@@ -56,24 +59,64 @@ func (s SVStack) peek() *state.StoreView {
 
 // ImportSnapshot loads the snapshot into the given database
 func ImportSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath string, chain *blockchain.Chain, db database.Database, ledger *ledger.Ledger) (snapshotBlockHeader *core.BlockHeader, lastCC *core.ExtendedBlock, err error) {
-	logger.Infof("Loading snapshot from: %v", snapshotFilePath)
-	snapshotBlockHeader, metadata, err := loadSnapshot(snapshotFilePath, db, "Importing Snapshot")
+	snapshotBlockHeader, _, lastCC, err = importSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath, chain, db, ledger, NewLoadSnapshotOptions())
+	return snapshotBlockHeader, lastCC, err
+}
+
+// ValidateAndLoad validates the snapshot while loading it into the given database, so that the
+// snapshot is read and written only once, instead of being validated in a temporary database by
+// ValidateSnapshot and then loaded again by ImportSnapshot. The snapshot passes the same checks
+// as with ValidateSnapshot, and is recorded as validated in the database once loaded. If the
+// validation fails, the state loaded so far is left unreferenced in the database.
+func ValidateAndLoad(snapshotFilePath, chainImportDirPath, chainCorrectionPath string, chain *blockchain.Chain, db database.Database, ledger *ledger.Ledger) (snapshotBlockHeader *core.BlockHeader, lastCC *core.ExtendedBlock, err error) {
+	opts := NewLoadSnapshotOptions()
+	opts.SafeLoad = false // the point is to load the snapshot only once
+
+	var signature *SnapshotSignature
+	if len(opts.Publishers) > 0 {
+		signature, err = verifySnapshotSignature(snapshotFilePath, opts.Publishers)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Infof("Snapshot %v is signed by publisher %v", snapshotFilePath, signature.Publisher.Hex())
+	}
+
+	snapshotBlockHeader, metadata, lastCC, err := importSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath, chain, db, ledger, opts)
 	if err != nil {
 		return nil, nil, err
 	}
+	if signature != nil {
+		// The file may have been replaced since the signature was checked.
+		if err = signature.Verify(metadata, opts.Publishers); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = SaveValidatedSnapshotHeader(db, snapshotBlockHeader); err != nil {
+		return nil, nil, err
+	}
+	return snapshotBlockHeader, lastCC, nil
+}
+
+func importSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath string, chain *blockchain.Chain, db database.Database,
+	ledger *ledger.Ledger, opts *LoadSnapshotOptions) (snapshotBlockHeader *core.BlockHeader, metadata *core.SnapshotMetadata, lastCC *core.ExtendedBlock, err error) {
+	logger.Infof("Loading snapshot from: %v", snapshotFilePath)
+	snapshotBlockHeader, metadata, err = loadSnapshot(snapshotFilePath, db, "Importing Snapshot", opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	logger.Infof("Snapshot loaded successfully.")
 
 	// load previous chain, if any
 	err = loadPrevChain(chainImportDirPath, snapshotBlockHeader, metadata, chain, db)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// load chain correction, if any
 	if len(chainCorrectionPath) != 0 {
 		headBlock, tailBlock, err := LoadChainCorrection(chainCorrectionPath, snapshotBlockHeader, metadata, chain, db, ledger)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
 		snapshotBlock := core.ExtendedBlock{}
@@ -82,49 +125,117 @@ func ImportSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath st
 		snapshotBlock.Children = []common.Hash{headBlock.Hash()}
 		err = kvstore.Put(snapshotBlockHeader.Hash().Bytes(), snapshotBlock)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
 		lastCC = tailBlock
 	}
 
-	return snapshotBlockHeader, lastCC, nil
+	return snapshotBlockHeader, metadata, lastCC, nil
+}
+
+// SaveValidatedSnapshotHeader records the header of the snapshot block validated into the
+// database, so that the snapshot doesn't need to be validated again on the next start.
+func SaveValidatedSnapshotHeader(db database.Database, snapshotBlockHeader *core.BlockHeader) error {
+	raw, err := rlp.EncodeToBytes(snapshotBlockHeader)
+	if err != nil {
+		return err
+	}
+	return db.Put([]byte(ValidatedSnapshotHeaderKey), raw)
+}
+
+// LoadValidatedSnapshotHeader returns the header of the snapshot block recorded by
+// SaveValidatedSnapshotHeader.
+func LoadValidatedSnapshotHeader(db database.Database) (*core.BlockHeader, error) {
+	raw, err := db.Get([]byte(ValidatedSnapshotHeaderKey))
+	if err != nil {
+		return nil, err
+	}
+	header := &core.BlockHeader{}
+	if err = rlp.DecodeBytes(raw, header); err != nil {
+		return nil, err
+	}
+	return header, nil
 }
 
 // ValidateSnapshot validates the snapshot using a temporary database
 func ValidateSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath string) (*core.BlockHeader, error) {
-	logger.Infof("Verifying snapshot: %v", snapshotFilePath)
+	snapshotBlockHeader, _, err := validateSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath, NewLoadSnapshotOptions())
+	return snapshotBlockHeader, err
+}
 
-	tmpdbRoot, err := ioutil.TempDir("", "tmpdb")
-	if err != nil {
-		log.Panicf("Failed to create temporary db for snapshot verification: %v", err)
+// validateSnapshot validates the snapshot, and reports whether the result was served from the
+// verification cache. The cache only applies to the snapshot file alone, i.e. when there is
+// no chain to import or correct.
+func validateSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath string, opts *LoadSnapshotOptions) (*core.BlockHeader, bool, error) {
+	var signature *SnapshotSignature
+	if opts != nil && len(opts.Publishers) > 0 {
+		var err error
+		signature, err = verifySnapshotSignature(snapshotFilePath, opts.Publishers)
+		if err != nil {
+			return nil, false, err
+		}
+		logger.Infof("Snapshot %v is signed by publisher %v", snapshotFilePath, signature.Publisher.Hex())
 	}
-	mainTmpDBPath := path.Join(tmpdbRoot, "main")
-	refTmpDBPath := path.Join(tmpdbRoot, "ref")
-	defer func() {
-		os.RemoveAll(mainTmpDBPath)
-		os.RemoveAll(refTmpDBPath)
-	}()
 
-	tmpdb, err := backend.NewLDBDatabase(mainTmpDBPath, refTmpDBPath, 256, 0)
+	useCache := opts != nil && len(opts.VerificationCacheDir) > 0 && len(chainImportDirPath) == 0 && len(chainCorrectionPath) == 0
+	var snapshotHash common.Hash
+	if useCache {
+		var err error
+		snapshotHash, err = ComputeSnapshotHash(snapshotFilePath)
+		if err != nil {
+			return nil, false, err
+		}
+		if entry := loadVerificationCache(opts.VerificationCacheDir, snapshotHash); entry != nil {
+			logger.Infof("Snapshot %v verified previously, using the cached result.", snapshotFilePath)
+			return entry.SnapshotBlockHeader, true, nil
+		}
+	}
 
-	snapshotBlockHeader, metadata, err := loadSnapshot(snapshotFilePath, tmpdb, "Validating Snapshot")
+	logger.Infof("Verifying snapshot: %v", snapshotFilePath)
+
+	tmpdb, cleanup := createValidationDB(opts)
+	defer cleanup()
+
+	snapshotBlockHeader, metadata, err := loadSnapshot(snapshotFilePath, tmpdb, "Validating Snapshot", opts)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if signature != nil {
+		// The file may have been replaced since the signature was checked.
+		if err = signature.Verify(metadata, opts.Publishers); err != nil {
+			return nil, false, err
+		}
 	}
 	logger.Infof("Snapshot verified.")
 
+	if useCache {
+		// Only cache the result if the file didn't change while it was being validated.
+		validatedHash, err := ComputeSnapshotHash(snapshotFilePath)
+		if err == nil && validatedHash == snapshotHash {
+			sv := state.NewStoreView(snapshotBlockHeader.Height, snapshotBlockHeader.StateHash, tmpdb)
+			entry := &VerificationCacheEntry{
+				SnapshotHash:        snapshotHash,
+				SnapshotBlockHeader: snapshotBlockHeader,
+				Validators:          getValidatorSetFromSV(sv).Validators(),
+			}
+			if err := saveVerificationCache(opts.VerificationCacheDir, entry); err != nil {
+				logger.Warnf("Failed to save the snapshot verification cache: %v", err)
+			}
+		}
+	}
+
 	// load previous chain, if any
 	err = loadPrevChain(chainImportDirPath, snapshotBlockHeader, metadata, nil, tmpdb)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// load chain correction, if any
 	if len(chainCorrectionPath) != 0 {
 		headBlock, _, err := LoadChainCorrection(chainCorrectionPath, snapshotBlockHeader, metadata, nil, tmpdb, nil)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		snapshotBlock := core.ExtendedBlock{}
@@ -133,11 +244,42 @@ func ValidateSnapshot(snapshotFilePath, chainImportDirPath, chainCorrectionPath
 		snapshotBlock.Children = []common.Hash{headBlock.Hash()}
 		err = kvstore.Put(snapshotBlockHeader.Hash().Bytes(), snapshotBlock)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 	}
 
-	return snapshotBlockHeader, nil
+	return snapshotBlockHeader, false, nil
+}
+
+// createValidationDB creates the temporary database to validate a snapshot in, memory-backed
+// if ValidateInMemory is set, otherwise on disk.
+func createValidationDB(opts *LoadSnapshotOptions) (database.Database, func()) {
+	if opts == nil || !opts.ValidateInMemory {
+		return createTempDB()
+	}
+	db := newSpillDatabase(opts.SpillThreshold)
+	return db, db.Close
+}
+
+// createTempDB creates a temporary database for snapshot verification, along with the
+// function to remove it.
+func createTempDB() (database.Database, func()) {
+	tmpdbRoot, err := ioutil.TempDir("", "tmpdb")
+	if err != nil {
+		log.Panicf("Failed to create temporary db for snapshot verification: %v", err)
+	}
+	mainTmpDBPath := path.Join(tmpdbRoot, "main")
+	refTmpDBPath := path.Join(tmpdbRoot, "ref")
+
+	tmpdb, err := backend.NewLDBDatabase(mainTmpDBPath, refTmpDBPath, 256, 0)
+	if err != nil {
+		log.Panicf("Failed to create temporary db for snapshot verification: %v", err)
+	}
+	cleanup := func() {
+		tmpdb.Close()
+		os.RemoveAll(tmpdbRoot)
+	}
+	return tmpdb, cleanup
 }
 
 func LoadSnapshotCheckpointHeader(snapshotFilePath string) *core.BlockHeader {
@@ -148,21 +290,24 @@ func LoadSnapshotCheckpointHeader(snapshotFilePath string) *core.BlockHeader {
 		return nil
 	}
 	defer snapshotFile.Close()
+	reader, _, err := newDecompressingReader(snapshotFile)
+	if err != nil {
+		return nil
+	}
 
-	snapshotHeader := &core.SnapshotHeader{}
-	_, err = core.ReadRecord(snapshotFile, snapshotHeader)
+	_, reader, err = readSnapshotHeader(reader)
 	if err != nil {
 		return nil
 	}
 
 	lastCheckpoint := core.LastCheckpoint{}
-	_, err = core.ReadRecord(snapshotFile, &lastCheckpoint)
+	_, err = core.ReadRecord(reader, &lastCheckpoint)
 	if err != nil {
 		return nil
 	}
 
 	metadata := core.SnapshotMetadata{}
-	_, err = core.ReadRecord(snapshotFile, &metadata)
+	_, err = core.ReadRecord(reader, &metadata)
 	if err != nil {
 		return nil
 	}
@@ -170,35 +315,127 @@ func LoadSnapshotCheckpointHeader(snapshotFilePath string) *core.BlockHeader {
 	return metadata.TailTrio.Second.Header
 }
 
-func loadSnapshot(snapshotFilePath string, db database.Database, logStr string) (*core.BlockHeader, *core.SnapshotMetadata, error) {
-	var err error
+// LoadSnapshot loads and validates the snapshot state into the given database using the
+// given options, and returns the snapshot block header along with the snapshot metadata.
+func LoadSnapshot(snapshotFilePath string, db database.Database, opts *LoadSnapshotOptions) (*core.BlockHeader, *core.SnapshotMetadata, error) {
+	return loadSnapshot(snapshotFilePath, db, "Loading Snapshot", opts)
+}
 
-	snapshotFile, err := os.Open(snapshotFilePath)
+// LoadSnapshotFromReader loads and validates the snapshot read from the given stream, e.g. an
+// HTTP download or a decompression stream, so that the snapshot doesn't need to be staged on
+// disk first. The stream is read only once, hence SafeLoad is not supported.
+func LoadSnapshotFromReader(r io.Reader, db database.Database, opts *LoadSnapshotOptions) (*core.BlockHeader, *core.SnapshotMetadata, error) {
+	if opts != nil && opts.SafeLoad {
+		return nil, nil, fmt.Errorf("SafeLoad is not supported when loading a snapshot from a stream")
+	}
+	return loadSnapshotFromReader(r, 0, "snapshot stream", db, "Loading Snapshot", opts)
+}
+
+// ApplySnapshotDiff loads the snapshot diff on top of its base state, which must already be in
+// the database, and validates the resulting state. SafeLoad is not supported, as the base state
+// is not available in a temporary database.
+func ApplySnapshotDiff(diffFilePath string, db database.Database, opts *LoadSnapshotOptions) (*core.BlockHeader, *core.SnapshotMetadata, error) {
+	diffOpts := LoadSnapshotOptions{}
+	if opts != nil {
+		diffOpts = *opts
+	}
+	diffOpts.SafeLoad = false
+	diffOpts.applyDiff = true
+	return loadSnapshot(diffFilePath, db, "Applying Snapshot Diff", &diffOpts)
+}
+
+func loadSnapshot(snapshotFilePath string, db database.Database, logStr string, opts *LoadSnapshotOptions) (*core.BlockHeader, *core.SnapshotMetadata, error) {
+	if opts != nil && opts.SafeLoad {
+		// Validate the snapshot in a temporary database first, so that a bad snapshot
+		// never leaves partial data in the target database.
+		err := validateSnapshotInTempDB(snapshotFilePath, opts)
+		if err != nil {
+			opts.stateAvailability().reset()
+			return nil, nil, err
+		}
+	}
+
+	snapshotFile, err := OpenSnapshotFile(snapshotFilePath, opts != nil && opts.UseMmap)
 	if err != nil {
+		opts.stateAvailability().reset()
 		return nil, nil, err
 	}
 	defer snapshotFile.Close()
 
+	return loadSnapshotFromReader(snapshotFile.NewReader(), snapshotFile.Size(), snapshotFilePath, db, logStr, opts)
+}
+
+// loadSnapshotFromReader loads the snapshot from the reader, decompressing it if needed. The
+// size, if known, is only used to report the loading progress.
+func loadSnapshotFromReader(r io.Reader, size int64, name string, db database.Database, logStr string, opts *LoadSnapshotOptions) (snapshotBlockHeader *core.BlockHeader, snapshotMetadata *core.SnapshotMetadata, err error) {
+	availability := opts.stateAvailability()
+	var progress *progressReporter
+	defer func() {
+		if err != nil {
+			availability.reset()
+		}
+		progress.done(err)
+	}()
+
+	reader, compression, err := newDecompressingReader(r)
+	if err != nil {
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: err}
+	}
+	if compression != SnapshotCompressionNone {
+		logger.Infof("Reading %v compressed snapshot %v", compression, name)
+		size = 0 // the decompressed size is unknown
+	}
+
+	if opts != nil && len(opts.SubChainID) != 0 {
+		db = SubChainDB(db, opts.SubChainID)
+	}
 	kvstore := kvstore.NewKVStore(db)
 
 	// ------------------------------ Load State ------------------------------ //
 
-	snapshotVersion := uint(1)
-	snapshotHeader := &core.SnapshotHeader{}
-	_, err = core.ReadRecord(snapshotFile, snapshotHeader)
-	if err != nil || snapshotHeader.Magic != core.SnapshotHeaderMagic { // older version, reset snapshotFile
-		snapshotFile.Seek(0, 0)
-	} else {
-		snapshotVersion = snapshotHeader.Version
+	// Check the header magic before attempting to decode anything else, so that pointing the
+	// loader at a file which is not a snapshot gives a clear error. A file without the header
+	// is loaded as a headerless version 1 snapshot.
+	snapshotHeader, sectionReader, err := readSnapshotHeader(reader)
+	if err != nil {
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Failed to load snapshot %v: %v", name, err)}
+	}
+	snapshotVersion := snapshotHeader.FormatVersion()
+	if err = checkSnapshotVersion(snapshotHeader); err != nil {
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Failed to load snapshot %v: %v", name, err)}
+	}
+	if err = checkRecordFlags(snapshotHeader); err != nil {
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: err}
 	}
 
 	logger.Infof("Reading snapshot header, version: %v, magic: %v", snapshotVersion, snapshotHeader.Magic)
+	reader = sectionReader
+
+	applyDiff := opts != nil && opts.applyDiff
+	if snapshotHeader.IsDiff() != applyDiff {
+		if applyDiff {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Snapshot %v is not a snapshot diff", name)}
+		}
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Snapshot %v is a snapshot diff, it can only be applied on top of its base state", name)}
+	}
+	if applyDiff {
+		diffBase := core.SnapshotDiffBase{}
+		_, err = core.ReadRecord(reader, &diffBase)
+		if err != nil {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Failed to load snapshot diff base, %v", err)}
+		}
+		if has, _ := db.Has(diffBase.StateHash.Bytes()); !has {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, StoreViewHeight: diffBase.Height,
+				Err: fmt.Errorf("Base state %v of the snapshot diff is missing from the database", diffBase.StateHash.Hex())}
+		}
+		logger.Infof("Applying snapshot diff on top of the state at height %v", diffBase.Height)
+	}
 
 	lastCheckpoint := core.LastCheckpoint{}
 	if snapshotVersion >= 2 {
-		_, err = core.ReadRecord(snapshotFile, &lastCheckpoint)
+		_, err = core.ReadRecord(reader, &lastCheckpoint)
 		if err != nil {
-			return nil, nil, fmt.Errorf("Failed to load snapshot last checkpoint, %v", err)
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Failed to load snapshot last checkpoint, %v", err)}
 		}
 
 		ckb := core.Block{
@@ -236,28 +473,61 @@ func loadSnapshot(snapshotFilePath string, db database.Database, logStr string)
 	}
 
 	metadata := core.SnapshotMetadata{}
-	_, err = core.ReadRecord(snapshotFile, &metadata)
+	_, err = core.ReadRecord(reader, &metadata)
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to load snapshot metadata, %v", err)
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: metadataReadError(snapshotHeader, err)}
 	}
-
-	fileInfo, err := os.Stat(snapshotFilePath)
-	var fileSize uint64
-	if err == nil {
-		fileSize = uint64(fileInfo.Size()) / 100
+	if err = checkSnapshotMetadataVersion(&metadata); err != nil {
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: err}
 	}
+	if snapshotHeader.IsFiltered() == metadata.PrunedStateHash.IsEmpty() {
+		if snapshotHeader.IsFiltered() {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Snapshot %v is filtered but doesn't record its pruned state hash", name)}
+		}
+		return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, Err: fmt.Errorf("Snapshot %v records a pruned state hash but is not filtered", name)}
+	}
+	availability.start(metadata.TailTrio.Second.Header.Height)
+
+	progress = newProgressReporter(logStr, uint64(size), opts)
+	progress.setPhase(SnapshotPhaseState)
 
 	var sv *state.StoreView
-	if snapshotHeader.Version >= 3 {
-		err = loadStateV3(snapshotFile, db, fileSize, logStr)
+	if snapshotVersion >= 3 {
+		var checkpoint *loadCheckpoint
+		stateLoaded := false
+		if opts != nil && opts.ResumableLoad {
+			checkpoint = &loadCheckpoint{SnapshotBlockHash: metadata.TailTrio.Second.Header.Hash(), Version: uint64(snapshotHeader.Version),
+				Flags: uint64(snapshotHeader.Flags)}
+			if previous := readLoadCheckpoint(db); checkpoint.resumes(previous) {
+				logger.Infof("Resuming the interrupted snapshot load, skipping %v bytes of state records", previous.Offset)
+				if err = skipSnapshotBytes(r, reader, compression, previous.Offset); err != nil {
+					return nil, nil, &SnapshotError{Phase: SnapshotPhaseState, Err: fmt.Errorf("Failed to resume snapshot load, %v", err)}
+				}
+				checkpoint.Offset = previous.Offset
+			}
+			// The checkpoint survives a failure to read the state records, e.g. a stream cut
+			// off midway, but is discarded once the state is loaded, whether the checks pass.
+			defer func() {
+				if stateLoaded {
+					deleteLoadCheckpoint(db)
+				}
+			}()
+		}
+		err = loadStateV3(reader, db, progress, opts.writeBatchSize(), opts.writeBatchBytes(), checkpoint, applyDiff)
 		if err != nil {
 			return nil, nil, err
 		}
+		stateLoaded = true
 		lfb := metadata.TailTrio.Second
-		sv = state.NewStoreView(lfb.Header.Height, lfb.Header.StateHash, db)
+		stateHash := snapshotStateHash(&metadata)
+		sv = state.NewStoreView(lfb.Header.Height, stateHash, db)
+		if sv == nil {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseState, StoreViewHeight: lfb.Header.Height,
+				Err: fmt.Errorf("State root %v is missing from the snapshot", stateHash.Hex())}
+		}
 	} else {
-		sv, _, err = loadStateV2(snapshotFile, db, fileSize, logStr)
+		sv, _, err = loadStateV2(reader, db, progress, snapshotHeader.CodecFlags(), opts)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -265,23 +535,25 @@ func loadSnapshot(snapshotFilePath string, db database.Database, logStr string)
 
 	// ----------------------------- Validity Checks -------------------------- //
 
+	progress.setPhase(SnapshotPhaseVotes)
+
 	if snapshotVersion >= 4 {
-		if err = checkSnapshotV4(sv, &metadata, db); err != nil {
-			return nil, nil, fmt.Errorf("Snapshot state validation failed: %v", err)
+		if err = checkSnapshotV4(sv, &metadata, db, opts); err != nil {
+			return nil, nil, err
 		}
 	} else {
-		if err = checkSnapshot(sv, &metadata, db); err != nil {
-			return nil, nil, fmt.Errorf("Snapshot state validation failed: %v", err)
+		if err = checkSnapshot(sv, &metadata, db, opts); err != nil {
+			return nil, nil, err
 		}
 	}
 
 	// --------------------- Save Proofs and Tail Blocks  --------------------- //
 
-	for _, blockTrio := range metadata.ProofTrios {
-		blockTrioKey := []byte(core.BlockTrioStoreKeyPrefix + strconv.FormatUint(blockTrio.First.Header.Height, 10))
-		err = kvstore.Put(blockTrioKey, blockTrio)
-		if err != nil {
-			logger.Panicf("Failed to save ProofTrios: err: %v", err)
+	for i := range metadata.ProofTrios {
+		blockTrio := &metadata.ProofTrios[i]
+		if err = core.SaveBlockTrio(kvstore, blockTrio); err != nil {
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: blockTrio.Height(),
+				Err: fmt.Errorf("Failed to save the proof trio: %v", err)}
 		}
 	}
 
@@ -291,13 +563,54 @@ func loadSnapshot(snapshotFilePath string, db database.Database, logStr string)
 
 	if snapshotVersion >= 2 {
 		if err = checkLastCheckpoint(sv, secondBlockHeader, &lastCheckpoint, db); err != nil {
-			return nil, nil, fmt.Errorf("Snapshot last checkpoint validation failed: %v", err)
+			return nil, nil, &SnapshotError{Phase: SnapshotPhaseMetadata, StoreViewHeight: secondBlockHeader.Height,
+				Err: fmt.Errorf("Snapshot last checkpoint validation failed: %v", err)}
 		}
 	}
 
+	availability.markVerified(sv)
+
 	return secondBlockHeader, &metadata, nil
 }
 
+// readSnapshotHeader reads the snapshot header, taking a file without the header as a headerless
+// version 1 snapshot, and returns the reader of the sections that follow the header.
+func readSnapshotHeader(reader io.Reader) (*core.SnapshotHeader, io.Reader, error) {
+	bufReader, ok := reader.(*bufio.Reader)
+	if !ok {
+		bufReader = bufio.NewReader(reader)
+	}
+	snapshotHeader, err := core.PeekSnapshotHeader(bufReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshotHeader, newSectionReader(bufReader, snapshotHeader), nil
+}
+
+// metadataReadError returns the error of reading the snapshot metadata. A headerless file
+// whose leading record is not the metadata is not a snapshot at all.
+func metadataReadError(snapshotHeader *core.SnapshotHeader, err error) error {
+	if snapshotHeader.FormatVersion() == 1 {
+		return core.ErrNotSnapshotFile
+	}
+	return fmt.Errorf("Failed to load snapshot metadata, %v", err)
+}
+
+// validateSnapshotInTempDB fully loads and validates the snapshot in a temporary database.
+func validateSnapshotInTempDB(snapshotFilePath string, opts *LoadSnapshotOptions) error {
+	tmpdb, cleanup := createValidationDB(opts)
+	defer cleanup()
+
+	validateOpts := *opts
+	validateOpts.SafeLoad = false
+	validateOpts.SubChainID = ""
+	validateOpts.OnAccountStorageProgress = nil
+	validateOpts.Availability = nil
+	validateOpts.ResumableLoad = false
+	_, _, err := loadSnapshot(snapshotFilePath, tmpdb, "Pre-validating Snapshot", &validateOpts)
+	return err
+}
+
 func LoadChainCorrection(chainImportDirPath string, snapshotBlockHeader *core.BlockHeader, metadata *core.SnapshotMetadata, chain *blockchain.Chain, db database.Database, ledger *ledger.Ledger) (headBlock, tailBlock *core.ExtendedBlock, err error) {
 	chainFile, err := os.Open(chainImportDirPath)
 	if err != nil {
@@ -459,6 +772,10 @@ func loadChainSegment(filePath string, start, end uint64, prevBlock *core.Extend
 	}
 	defer file.Close()
 
+	verifier, err := snapshotVoteVerifier(metadata)
+	if err != nil {
+		return nil, err
+	}
 	kvstore := kvstore.NewKVStore(db)
 
 	var count uint64
@@ -488,7 +805,7 @@ func loadChainSegment(filePath string, start, end uint64, prevBlock *core.Extend
 		// check block itself
 		var provenValSet *core.ValidatorSet
 		if block.Height == core.GenesisBlockHeight {
-			provenValSet, err = checkGenesisBlock(block.BlockHeader, db)
+			provenValSet, err = checkGenesisBlock(block.BlockHeader, db, nil)
 			if err != nil {
 				return nil, err
 			}
@@ -511,7 +828,7 @@ func loadChainSegment(filePath string, start, end uint64, prevBlock *core.Extend
 
 			if provenValSet == nil {
 				if proofTrio.First.Header.Height == core.GenesisBlockHeight {
-					provenValSet, err = checkGenesisBlock(proofTrio.Second.Header, db)
+					provenValSet, err = checkGenesisBlock(proofTrio.Second.Header, db, nil)
 				} else {
 					provenValSet, err = getValidatorSetFromVCPProof(proofTrio.First.Header.StateHash, &proofTrio.First.Proof)
 				}
@@ -522,7 +839,7 @@ func loadChainSegment(filePath string, start, end uint64, prevBlock *core.Extend
 		}
 
 		// check votes
-		if err := validateVotes(provenValSet, block.BlockHeader, backupBlock.Votes); err != nil {
+		if err := validateVotes(provenValSet, block.BlockHeader, backupBlock.Votes, verifier); err != nil {
 			return nil, fmt.Errorf("Failed to validate voteSet, %v", err)
 		}
 
@@ -544,7 +861,7 @@ func loadChainSegment(filePath string, start, end uint64, prevBlock *core.Extend
 
 			// check against genesis block
 			if block.Height == core.GenesisBlockHeight {
-				_, err := checkGenesisBlock(block.BlockHeader, db)
+				_, err := checkGenesisBlock(block.BlockHeader, db, nil)
 				if err != nil {
 					return nil, err
 				}
@@ -605,103 +922,226 @@ func getChainBoundary(filename string) (start, end uint64) {
 	return
 }
 
-func loadStateV2(file *os.File, db database.Database, fileSize uint64, logStr string) (*state.StoreView, common.Hash, error) {
+func loadStateV2(file io.Reader, db database.Database, progress *progressReporter, recordFlags uint, opts *LoadSnapshotOptions) (*state.StoreView, common.Hash, error) {
 	var hash common.Hash
 	var sv *state.StoreView
 	var account *types.Account
+	var storageProgress *AccountStorageProgress
 	svStack := make(SVStack, 0)
-	var progress, curSize uint64
+	lastKeys := []common.Bytes{} // last key of each store view on the stack, for the strict order check
+	strictOrder := opts != nil && opts.StrictRecordOrder
+	availability := opts.stateAvailability()
+	heapCheckInterval := opts.heapCheckInterval()
+	recordCount := 0
+	var offset, recordOffset uint64
+
+	// With parallelism, the account storages are streamed to the storage loader instead of
+	// being loaded in place.
+	var storageLoader *storageLoader
+	var pendingStorage *storageJob
+	if parallelism := opts.loadParallelism(); parallelism > 1 {
+		storageLoader = newStorageLoader(db, parallelism, opts)
+		defer func() {
+			if pendingStorage != nil {
+				pendingStorage.abort()
+			}
+			storageLoader.wait()
+		}()
+	}
+
+	// stateError attributes the error to the current record and store view.
+	stateError := func(err error) error {
+		snapshotErr := &SnapshotError{Phase: SnapshotPhaseState, RecordOffset: recordOffset, Err: err}
+		if top := svStack.peek(); top != nil {
+			snapshotErr.StoreViewHeight = top.Height()
+		}
+		if account != nil {
+			addr := account.Address
+			snapshotErr.AccountAddress = &addr
+		}
+		return snapshotErr
+	}
+
+	readRecord := newRecordReader(file, recordFlags)
+	copyValue := false
+	if recordFlags == 0 && opts != nil && opts.ReuseRecordBuffer {
+		readRecord = core.NewRecordReader(file).ReadTrieRecord
+		copyValue = true
+	}
+
+	record := core.SnapshotTrieRecord{}
 	for {
-		record := core.SnapshotTrieRecord{}
-		recordSize, err := core.ReadRecord(file, &record)
+		recordOffset = offset
+		recordSize, err := readRecord(&record)
 		if err != nil {
 			if err == io.EOF {
-				if svStack.peek() != nil {
-					return nil, common.Hash{}, fmt.Errorf("Still some storeview unhandled")
+				if svStack.peek() != nil || pendingStorage != nil {
+					return nil, common.Hash{}, stateError(fmt.Errorf("Still some storeview unhandled"))
 				}
 				break
 			}
-			return nil, common.Hash{}, fmt.Errorf("Failed to read snapshot record, %v", err)
+			return nil, common.Hash{}, stateError(recordReadError(err))
 		}
+		offset += recordSize
+		progress.record(recordSize)
 
-		if fileSize > 0 {
-			curSize += recordSize
-			percentage := curSize / fileSize
-			if percentage > progress && percentage <= 100 && percentage%5 == 0 {
-				logger.Infof("%s, %v%% done.", logStr, percentage)
-				progress = percentage
+		recordType := record.RecordType()
+		if pendingStorage != nil {
+			if recordType == core.SnapshotRecordSVStart {
+				return nil, common.Hash{}, stateError(fmt.Errorf("Unexpected storeview nested in account storage"))
+			}
+			if recordType == core.SnapshotRecordSVEnd {
+				if core.Bytestoi(record.V) != pendingStorage.height {
+					return nil, common.Hash{}, stateError(fmt.Errorf("Storeview start and end heights don't match"))
+				}
+				lastKeys = lastKeys[:len(lastKeys)-1]
+				pendingStorage.finish(recordOffset)
+				pendingStorage = nil
+				account = nil
+				continue
+			}
+			if strictOrder {
+				lastKey := lastKeys[len(lastKeys)-1]
+				if lastKey != nil && bytes.Compare(record.K, lastKey) <= 0 {
+					return nil, common.Hash{}, stateError(fmt.Errorf("Snapshot record %v is not in ascending key order, previous key: %v", record.K.String(), lastKey.String()))
+				}
+				lastKeys[len(lastKeys)-1] = common.CopyBytes(record.K)
 			}
+			// The records are retained until the worker loads their chunk.
+			pendingStorage.add(core.SnapshotTrieRecord{K: common.CopyBytes(record.K), V: common.CopyBytes(record.V)})
+			continue
 		}
 
-		if bytes.Equal(record.K, []byte{core.SVStart}) {
+		if recordType == core.SnapshotRecordSVStart {
 			height := core.Bytestoi(record.V)
+			if storageLoader != nil && account != nil && svStack.peek() != nil && height == svStack.peek().Height() {
+				job := newStorageJob(account, height)
+				if err = storageLoader.submit(job); err != nil {
+					return nil, common.Hash{}, err
+				}
+				pendingStorage = job
+				lastKeys = append(lastKeys, nil)
+				continue
+			}
+			if svStack.peek() != nil && account != nil {
+				// it's a storeview for account storage
+				storageProgress = &AccountStorageProgress{Address: account.Address}
+			}
 			sv := state.NewStoreView(height, common.Hash{}, db)
 			svStack = svStack.push(sv)
-		} else if bytes.Equal(record.K, []byte{core.SVEnd}) {
+			lastKeys = append(lastKeys, nil)
+		} else if recordType == core.SnapshotRecordSVEnd {
 			svStack, sv = svStack.pop()
 			if sv == nil {
-				return nil, common.Hash{}, fmt.Errorf("Missing storeview to handle")
+				return nil, common.Hash{}, stateError(fmt.Errorf("Missing storeview to handle"))
 			}
+			lastKeys = lastKeys[:len(lastKeys)-1]
 			height := core.Bytestoi(record.V)
 			if height != sv.Height() {
-				return nil, common.Hash{}, fmt.Errorf("Storeview start and end heights don't match")
+				return nil, common.Hash{}, stateError(fmt.Errorf("Storeview start and end heights don't match"))
 			}
 			hash = sv.Save()
 
 			if svStack.peek() != nil && height == svStack.peek().Height() {
 				// it's a storeview for account storage, verify account
 				if account.Root != hash {
-					return nil, common.Hash{}, fmt.Errorf("Account storage root doesn't match")
+					return nil, common.Hash{}, stateError(fmt.Errorf("Account storage root doesn't match, expected: %v, calculated: %v", account.Root.Hex(), hash.Hex()))
+				}
+				availability.addAccount(height, account)
+				if storageProgress != nil {
+					storageProgress.Done = true
+					opts.reportAccountStorageProgress(*storageProgress)
+					storageProgress = nil
 				}
 			}
 			account = nil
 		} else {
 			sv := svStack.peek()
 			if sv == nil {
-				return nil, common.Hash{}, fmt.Errorf("Missing storeview to handle")
+				return nil, common.Hash{}, stateError(fmt.Errorf("Missing storeview to handle"))
+			}
+			if strictOrder {
+				lastKey := lastKeys[len(lastKeys)-1]
+				if lastKey != nil && bytes.Compare(record.K, lastKey) <= 0 {
+					return nil, common.Hash{}, stateError(fmt.Errorf("Snapshot record %v is not in ascending key order, previous key: %v", record.K.String(), lastKey.String()))
+				}
+				lastKeys[len(lastKeys)-1] = common.CopyBytes(record.K)
+			}
+			value := record.V
+			if copyValue {
+				// The store view retains the value, while the record buffer is reused
+				// for the next record. The key is converted by the trie so needs no copy.
+				value = common.CopyBytes(record.V)
 			}
-			sv.Set(record.K, record.V)
+			sv.Set(record.K, value)
 
-			if account == nil {
-				if bytes.HasPrefix(record.K, []byte("ls/a")) {
-					acct := &types.Account{}
-					err = types.FromBytes([]byte(record.V), acct)
-					if err != nil {
-						return nil, common.Hash{}, fmt.Errorf("Failed to parse account, %v", err)
-					}
-					if acct.Root != (common.Hash{}) {
-						account = acct
-					}
+			recordCount++
+			if heapCheckInterval > 0 && recordCount%heapCheckInterval == 0 && opts.heapExceedsThreshold() {
+				// Committing the partial trie moves its nodes from memory to the database, the
+				// store view keeps accumulating on top of the committed trie.
+				sv.Save()
+			}
+
+			if storageProgress != nil {
+				storageProgress.Records++
+				if storageProgress.Records%accountStorageProgressInterval == 0 {
+					logger.Infof("Loading storage for account %v, %v records loaded", storageProgress.Address.Hex(), storageProgress.Records)
+					opts.reportAccountStorageProgress(*storageProgress)
 				}
 			}
+
+			if account == nil && recordType == core.SnapshotRecordAccount {
+				acct := &types.Account{}
+				err = types.FromBytes([]byte(record.V), acct)
+				if err != nil {
+					return nil, common.Hash{}, stateError(fmt.Errorf("Failed to parse account, %v", err))
+				}
+				if acct.Root != (common.Hash{}) {
+					account = acct
+				} else {
+					availability.addAccount(sv.Height(), acct)
+				}
+			}
+		}
+	}
+	if storageLoader != nil {
+		if err := storageLoader.wait(); err != nil {
+			return nil, common.Hash{}, err
 		}
 	}
-	logger.Infof("%s, 100%% done.", logStr)
+	progress.stateLoaded()
 
 	return sv, hash, nil
 }
 
-func loadStateV3(file *os.File, db database.Database, fileSize uint64, logStr string) error {
-	var progress, curSize uint64
+// loadStateV3 loads the trie node records. A batch is committed once it holds writeBatchSize
+// records, or if writeBatchBytes is non-zero, once its records reach writeBatchBytes bytes.
+// If checkpoint is specified, the loading progress is committed along with every batch, and
+// the records before checkpoint.Offset are assumed to be loaded already and skipped by the
+// caller. With diff set, the records are the nodes missing from the base state, and the base
+// state nodes they link to are referenced, see referenceBaseNodes.
+func loadStateV3(file io.Reader, db database.Database, progress *progressReporter, writeBatchSize int, writeBatchBytes uint64, checkpoint *loadCheckpoint, diff bool) error {
+	var offset, consumed uint64
+	if checkpoint != nil {
+		consumed = checkpoint.Offset
+		progress.skip(checkpoint.Offset)
+	}
 	batch := db.NewBatch()
+	batchCount := 0
+	var batchBytes uint64
 	record := core.SnapshotTrieRecord{}
 	for {
+		recordOffset := offset
 		recordSize, err := core.ReadRecord(file, &record)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("Failed to read snapshot record, %v", err)
-		}
-
-		if fileSize > 0 {
-			curSize += recordSize
-			percentage := curSize / fileSize
-			if percentage > progress && percentage <= 100 && percentage%5 == 0 {
-				logger.Infof("%s, %v%% done.", logStr, percentage)
-				progress = percentage
-			}
+			return &SnapshotError{Phase: SnapshotPhaseState, RecordOffset: recordOffset, Err: recordReadError(err)}
 		}
+		offset += recordSize
+		consumed += recordSize + 8 // the record is prefixed with its length
+		progress.record(recordSize)
 
 		err = batch.Put(record.K, record.V)
 		if err != nil {
@@ -715,23 +1155,73 @@ func loadStateV3(file *os.File, db database.Database, fileSize uint64, logStr st
 				return fmt.Errorf("Failed to create reference of snapshot record, %v", err)
 			}
 		}
+		if diff {
+			if err = referenceBaseNodes(db, batch, record.V); err != nil {
+				return &SnapshotError{Phase: SnapshotPhaseState, RecordOffset: recordOffset, Err: err}
+			}
+		}
 
-		if batch.ValueSize() > database.IdealBatchSize {
-			if err := batch.Write(); err != nil {
+		batchCount++
+		batchBytes += recordSize
+		if batchCount >= writeBatchSize || (writeBatchBytes > 0 && batchBytes >= writeBatchBytes) {
+			if err := writeStateBatch(batch, checkpoint, consumed); err != nil {
 				return err
 			}
 			batch.Reset()
+			batchCount = 0
+			batchBytes = 0
 		}
 	}
-	if err := batch.Write(); err != nil {
+	if err := writeStateBatch(batch, checkpoint, consumed); err != nil {
 		return err
 	}
 
-	logger.Infof("%s, 100%% done.", logStr)
+	progress.stateLoaded()
 
 	return nil
 }
 
+// referenceBaseNodes adds a reference to the nodes already in the database which the trie node
+// of a snapshot diff links to, i.e. its child nodes and the storage roots of the accounts in its
+// leaves, as the trie commit does for the nodes it reuses. Without them, pruning the base state
+// would delete the nodes it shares with the new state. The nodes of the diff committed by an
+// earlier batch are referenced too, which only delays their pruning.
+func referenceBaseNodes(db database.Database, batch database.Batch, node common.Bytes) error {
+	children, values, err := trie.NodeReferences(node)
+	if err != nil {
+		return fmt.Errorf("Failed to decode snapshot diff trie node, %v", err)
+	}
+	for _, value := range values {
+		account := &types.Account{}
+		if types.FromBytes(value, account) != nil {
+			continue
+		}
+		if account.Root != (common.Hash{}) && account.Root != core.EmptyRootHash {
+			children = append(children, account.Root)
+		}
+	}
+	for _, child := range children {
+		if has, _ := db.Has(child[:]); !has {
+			continue
+		}
+		if err := batch.Reference(child[:]); err != nil {
+			return fmt.Errorf("Failed to create reference of base state node, %v", err)
+		}
+	}
+	return nil
+}
+
+// writeStateBatch commits the batch, along with the loading progress if it is checkpointed.
+func writeStateBatch(batch database.Batch, checkpoint *loadCheckpoint, consumed uint64) error {
+	if checkpoint != nil {
+		checkpoint.Offset = consumed
+		if err := checkpoint.save(batch); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
 func checkLastCheckpoint(sv *state.StoreView, snapshotBlockHeader *core.BlockHeader, lastCheckpoint *core.LastCheckpoint, db database.Database) error {
 	if snapshotBlockHeader == nil {
 		return fmt.Errorf("The snapshot block header is nil")
@@ -771,39 +1261,50 @@ func checkLastCheckpoint(sv *state.StoreView, snapshotBlockHeader *core.BlockHea
 	return nil
 }
 
-func checkSnapshot(sv *state.StoreView, metadata *core.SnapshotMetadata, db database.Database) error {
+func checkSnapshot(sv *state.StoreView, metadata *core.SnapshotMetadata, db database.Database, opts *LoadSnapshotOptions) error {
 	tailTrio := &metadata.TailTrio
 	secondBlock := tailTrio.Second.Header
+	if err := checkNonEmptyState(secondBlock); err != nil {
+		return &SnapshotError{Phase: SnapshotPhaseState, Err: err}
+	}
 	expectedStateHash := sv.Hash()
-	if bytes.Compare(expectedStateHash.Bytes(), secondBlock.StateHash.Bytes()) != 0 {
-		return fmt.Errorf("StateHash not matching: %v vs %s",
-			expectedStateHash.Hex(), secondBlock.StateHash.Hex())
+	if stateHash := snapshotStateHash(metadata); bytes.Compare(expectedStateHash.Bytes(), stateHash.Bytes()) != 0 {
+		return &SnapshotError{Phase: SnapshotPhaseState, StoreViewHeight: secondBlock.Height,
+			Err: fmt.Errorf("StateHash not matching: %v vs %s", expectedStateHash.Hex(), stateHash.Hex())}
 	}
 
 	var provenValSet *core.ValidatorSet
-	var err error
 	if secondBlock.Height != core.GenesisBlockHeight {
-		provenValSet, err = checkProofTrios(metadata.ProofTrios, db)
+		verifier, err := snapshotVoteVerifier(metadata)
+		if err != nil {
+			return &SnapshotError{Phase: SnapshotPhaseVotes, Err: err}
+		}
+		provenValSet, err = checkProofTrios(metadata.ProofTrios, verifier, db, opts)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = checkTailTrio(sv, provenValSet, tailTrio)
+	var err error
+
+	err = checkTailTrio(sv, provenValSet, metadata, opts)
 	if err != nil {
-		return err
+		return wrapSnapshotError(SnapshotPhaseTrios, secondBlock.Height, err)
 	}
 
 	return nil
 }
 
-func checkSnapshotV4(sv *state.StoreView, metadata *core.SnapshotMetadata, db database.Database) error {
+func checkSnapshotV4(sv *state.StoreView, metadata *core.SnapshotMetadata, db database.Database, opts *LoadSnapshotOptions) error {
 	tailTrio := &metadata.TailTrio
 	secondBlock := tailTrio.Second.Header
+	if err := checkNonEmptyState(secondBlock); err != nil {
+		return &SnapshotError{Phase: SnapshotPhaseState, Err: err}
+	}
 	expectedStateHash := sv.Hash()
-	if bytes.Compare(expectedStateHash.Bytes(), secondBlock.StateHash.Bytes()) != 0 {
-		return fmt.Errorf("StateHash not matching: %v vs %s",
-			expectedStateHash.Hex(), secondBlock.StateHash.Hex())
+	if stateHash := snapshotStateHash(metadata); bytes.Compare(expectedStateHash.Bytes(), stateHash.Bytes()) != 0 {
+		return &SnapshotError{Phase: SnapshotPhaseState, StoreViewHeight: secondBlock.Height,
+			Err: fmt.Errorf("StateHash not matching: %v vs %s", expectedStateHash.Hex(), stateHash.Hex())}
 	}
 
 	var valSet *core.ValidatorSet
@@ -812,51 +1313,66 @@ func checkSnapshotV4(sv *state.StoreView, metadata *core.SnapshotMetadata, db da
 	first := tailTrio.First
 	valSet, err = getValidatorSetFromVCPProof(first.Header.StateHash, &first.Proof)
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)
+		return &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: first.Header.Height,
+			Err: fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)}
 	}
 
 	logger.Infof("Validators of snapshost: %v", valSet)
 
-	err = checkTailTrio(sv, valSet, tailTrio)
+	err = checkTailTrio(sv, valSet, metadata, opts)
 	if err != nil {
-		return err
+		return wrapSnapshotError(SnapshotPhaseTrios, secondBlock.Height, err)
+	}
+
+	return nil
+}
+
+// snapshotStateHash returns the root of the state loaded from the snapshot, i.e. the state hash
+// of the snapshot block, or the pruned state hash if some accounts were excluded on export. The
+// pruned state is only as trustworthy as the exporter, since no block commits to its root.
+func snapshotStateHash(metadata *core.SnapshotMetadata) common.Hash {
+	if !metadata.PrunedStateHash.IsEmpty() {
+		return metadata.PrunedStateHash
 	}
+	return metadata.TailTrio.Second.Header.StateHash
+}
 
+// checkNonEmptyState rejects snapshots whose tail block commits to an empty state trie. A
+// legitimate chain state always contains at least the validator candidate pool, so an empty
+// state would yield an empty validator set and could never pass the majority vote check.
+// Such snapshots are therefore rejected explicitly rather than failing later with a
+// confusing validator set mismatch.
+func checkNonEmptyState(snapshotBlockHeader *core.BlockHeader) error {
+	if snapshotBlockHeader == nil {
+		return fmt.Errorf("The snapshot block header is nil")
+	}
+	stateHash := snapshotBlockHeader.StateHash
+	if stateHash.IsEmpty() || stateHash == core.EmptyRootHash {
+		return fmt.Errorf("Snapshot block %v at height %v has an empty state (state hash: %v), empty-state snapshots are not supported",
+			snapshotBlockHeader.Hash().Hex(), snapshotBlockHeader.Height, stateHash.Hex())
+	}
 	return nil
 }
 
-func checkProofTrios(proofTrios []core.SnapshotBlockTrio, db database.Database) (*core.ValidatorSet, error) {
+func checkProofTrios(proofTrios []core.SnapshotBlockTrio, verifier VoteVerifier, db database.Database, opts *LoadSnapshotOptions) (*core.ValidatorSet, error) {
 	logger.Debugf("Check validator set change proofs...")
 
-	var provenValSet *core.ValidatorSet // the proven validator set so far
 	var err error
+	var provenValSet *core.ValidatorSet // the proven validator set so far
 	for idx, blockTrio := range proofTrios {
 		first := blockTrio.First
 		second := blockTrio.Second
-		third := blockTrio.Third
 		if idx == 0 {
 			// special handling for the genesis block
-			provenValSet, err = checkGenesisBlock(second.Header, db)
+			provenValSet, err = checkGenesisBlock(second.Header, db, opts)
 			if err != nil {
-				return nil, fmt.Errorf("Invalid genesis block: %v", err)
+				return nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: second.Header.Height,
+					Err: fmt.Errorf("Invalid genesis block: %v", err)}
 			}
 		} else {
-			if second.Header.Parent != first.Header.Hash() || third.Header.Parent != second.Header.Hash() {
-				return nil, fmt.Errorf("block trio has invalid Parent link")
-			}
-
-			if second.Header.HCC.BlockHash != first.Header.Hash() || third.Header.HCC.BlockHash != second.Header.Hash() {
-				return nil, fmt.Errorf("block trio has invalid HCC link: %v, %v; %v, %v", first.Header.Hash(), second.Header.HCC.BlockHash,
-					second.Header.Hash(), third.Header.HCC.BlockHash)
-			}
-
-			// third.Header.HCC.Votes contains the votes for the second block in the trio
-			if err := validateVotes(provenValSet, second.Header, third.Header.HCC.Votes); err != nil {
-				return nil, fmt.Errorf("Failed to validate voteSet, %v", err)
-			}
-			provenValSet, err = getValidatorSetFromVCPProof(first.Header.StateHash, &first.Proof)
+			provenValSet, err = checkProofTrio(provenValSet, &blockTrio, verifier)
 			if err != nil {
-				return nil, fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)
+				return nil, err
 			}
 		}
 
@@ -866,44 +1382,107 @@ func checkProofTrios(proofTrios []core.SnapshotBlockTrio, db database.Database)
 	return provenValSet, nil
 }
 
-func checkTailTrio(sv *state.StoreView, provenValSet *core.ValidatorSet, tailTrio *core.SnapshotBlockTrio) error {
-	second := &tailTrio.Second
-	third := &tailTrio.Third
+// checkProofTrio checks a validator set change proof trio against the validator set proven so
+// far, and returns the validator set proven by the trio.
+func checkProofTrio(provenValSet *core.ValidatorSet, blockTrio *core.SnapshotBlockTrio, verifier VoteVerifier) (*core.ValidatorSet, error) {
+	first := blockTrio.First
+	second := blockTrio.Second
+	third := blockTrio.Third
+	if second.Header.Parent != first.Header.Hash() || third.Header.Parent != second.Header.Hash() {
+		return nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: second.Header.Height,
+			Err: fmt.Errorf("block trio has invalid Parent link")}
+	}
+
+	if second.Header.HCC.BlockHash != first.Header.Hash() || third.Header.HCC.BlockHash != second.Header.Hash() {
+		return nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: second.Header.Height,
+			Err: fmt.Errorf("block trio has invalid HCC link: %v, %v; %v, %v", first.Header.Hash(), second.Header.HCC.BlockHash,
+				second.Header.Hash(), third.Header.HCC.BlockHash)}
+	}
+
+	// third.Header.HCC.Votes contains the votes for the second block in the trio
+	if err := validateVotes(provenValSet, second.Header, third.Header.HCC.Votes, verifier); err != nil {
+		return nil, &SnapshotError{Phase: SnapshotPhaseVotes, StoreViewHeight: second.Header.Height,
+			Err: fmt.Errorf("Failed to validate voteSet, %v", err)}
+	}
+	valSet, err := getValidatorSetFromVCPProof(first.Header.StateHash, &first.Proof)
+	if err != nil {
+		return nil, &SnapshotError{Phase: SnapshotPhaseTrios, StoreViewHeight: first.Header.Height,
+			Err: fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)}
+	}
+	return valSet, nil
+}
+
+func checkTailTrio(sv *state.StoreView, provenValSet *core.ValidatorSet, metadata *core.SnapshotMetadata, opts *LoadSnapshotOptions) error {
+	second := &metadata.TailTrio.Second
+	third := &metadata.TailTrio.Third
 
 	if second.Header.Height == core.GenesisBlockHeight {
-		_, err := checkGenesisBlock(second.Header, sv.GetDB())
+		_, err := checkGenesisBlock(second.Header, sv.GetDB(), opts)
 		if err != nil {
 			return err
 		}
 	} else {
-		validateVotes(provenValSet, third.Header, third.VoteSet)
-		retrievedValSet := getValidatorSetFromSV(sv)
-		if !provenValSet.Equals(retrievedValSet) {
-			return fmt.Errorf("The latest proven and retrieved validator set does not match")
+		verifier, err := snapshotVoteVerifier(metadata)
+		if err != nil {
+			return &SnapshotError{Phase: SnapshotPhaseVotes, StoreViewHeight: third.Header.Height, Err: err}
+		}
+		if err = validateVotes(provenValSet, third.Header, third.VoteSet, verifier); err != nil {
+			return &SnapshotError{Phase: SnapshotPhaseVotes, StoreViewHeight: third.Header.Height,
+				Err: fmt.Errorf("Failed to validate the tail trio voteSet, %v", err)}
+		}
+		if err = checkTailValidatorSet(sv, provenValSet, metadata); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func checkGenesisBlock(block *core.BlockHeader, db database.Database) (*core.ValidatorSet, error) {
+// checkTailValidatorSet binds the proven validator set, which the tail trio is voted by, to the
+// trusted state. If the validator update of the snapshot block is not confirmed yet, the proven
+// validator set is the one of the first tail block state, while the snapshot block state holds
+// the next one proven by the next VCP proof. Otherwise it is the one of the snapshot block state.
+func checkTailValidatorSet(sv *state.StoreView, provenValSet *core.ValidatorSet, metadata *core.SnapshotMetadata) error {
+	first := &metadata.TailTrio.First
+	second := &metadata.TailTrio.Second
+	retrievedValSet := getValidatorSetFromSV(sv)
+	if hasValidatorUpdate(sv, second.Header.Height) && metadata.HasNextVCPProof() {
+		firstValSet, err := getValidatorSetFromVCPProof(first.Header.StateHash, &first.Proof)
+		if err != nil {
+			return fmt.Errorf("Failed to retrieve validator set from VCP proof: %v", err)
+		}
+		if !provenValSet.Equals(firstValSet) {
+			return fmt.Errorf("The latest proven validator set does not match the validator set of the first tail block")
+		}
+		nextValSet, err := getValidatorSetFromVCPProof(second.Header.StateHash, &metadata.NextVCPProof)
+		if err != nil {
+			return fmt.Errorf("Failed to retrieve the next validator set from VCP proof: %v", err)
+		}
+		if !nextValSet.Equals(retrievedValSet) {
+			return fmt.Errorf("The next proven and retrieved validator set does not match")
+		}
+		return nil
+	}
+	if !provenValSet.Equals(retrievedValSet) {
+		return fmt.Errorf("The latest proven and retrieved validator set does not match")
+	}
+	return nil
+}
+
+func checkGenesisBlock(block *core.BlockHeader, db database.Database, opts *LoadSnapshotOptions) (*core.ValidatorSet, error) {
 	if block.Height != core.GenesisBlockHeight {
 		return nil, fmt.Errorf("Invalid genesis block height: %v", block.Height)
 	}
 
-	var expectedGenesisHash string
-	if block.ChainID == core.MainnetChainID {
-		expectedGenesisHash = core.MainnetGenesisBlockHash
-	} else {
-		expectedGenesisHash = viper.GetString(common.CfgGenesisHash)
+	genesisHash, ok := expectedGenesisHash(block.ChainID, opts)
+	if !ok {
+		return nil, fmt.Errorf("Unknown genesis block hash for chain %v, please set %v or register the genesis hash of the chain",
+			block.ChainID, common.CfgGenesisHash)
 	}
 
-	// logger.Infof("Expected genesis hash: %v", expectedGenesisHash)
-	// logger.Infof("Acutal   genesis hash: %v", block.Hash().Hex())
-
-	if block.Hash() != common.HexToHash(expectedGenesisHash) {
+	if block.Hash() != genesisHash {
 		return nil, fmt.Errorf("Genesis block hash mismatch, expected: %v, calculated: %v",
-			expectedGenesisHash, block.Hash().Hex())
+			genesisHash.Hex(), block.Hash().Hex())
 	}
 
 	// now that the block hash matches with the expected genesis block hash,
@@ -930,19 +1509,31 @@ func getValidatorSetFromVCPProof(stateHash common.Hash, recoverredVp *core.VCPPr
 	return consensus.SelectTopStakeHoldersAsValidators(vcp), nil
 }
 
+// DescribeVCPProof walks the VCP proof node by node against the state hash, and reports where
+// the verification diverges, e.g. which node hash doesn't match, at which key nibble.
+func DescribeVCPProof(stateHash common.Hash, proof *core.VCPProof) (*trie.ProofTrace, error) {
+	if proof == nil {
+		return nil, fmt.Errorf("The VCP proof is nil")
+	}
+	trace := trie.TraceProof(stateHash, state.ValidatorCandidatePoolKey(), proof)
+	if trace.Divergence != nil {
+		return trace, fmt.Errorf("Invalid VCP proof, %v", trace.Divergence)
+	}
+	return trace, nil
+}
+
 func getValidatorSetFromSV(sv *state.StoreView) *core.ValidatorSet {
 	vcp := sv.GetValidatorCandidatePool()
 	return consensus.SelectTopStakeHoldersAsValidators(vcp)
 }
 
-func validateVotes(validatorSet *core.ValidatorSet, block *core.BlockHeader, voteSet *core.VoteSet) error {
+func validateVotes(validatorSet *core.ValidatorSet, block *core.BlockHeader, voteSet *core.VoteSet, verifier VoteVerifier) error {
 	if !validatorSet.HasMajority(voteSet) {
 		return fmt.Errorf("block doesn't have majority votes")
 	}
 	for _, vote := range voteSet.Votes() {
-		res := vote.Validate()
-		if !res.IsOK() {
-			return fmt.Errorf("vote is not valid, %v", res)
+		if err := verifier.VerifyVote(vote); err != nil {
+			return err
 		}
 		if vote.Block != block.Hash() {
 			return fmt.Errorf("vote is not for corresponding block")
@@ -955,6 +1546,16 @@ func validateVotes(validatorSet *core.ValidatorSet, block *core.BlockHeader, vot
 	return nil
 }
 
+// saveVCPProof writes the trie nodes of the VCP proof to the database, so the validator
+// candidate pool can be read from the state root of the proof.
+func saveVCPProof(proof *core.VCPProof, db database.Database) {
+	for _, kv := range proof.GetKvs() {
+		if err := db.Put(kv.Key, kv.Val); err != nil {
+			logger.Panicf("Failed to save the VCP proof: %v", err)
+		}
+	}
+}
+
 func saveTailBlocks(metadata *core.SnapshotMetadata, sv *state.StoreView, kvstore store.Store) *core.BlockHeader {
 	tailBlockTrio := &metadata.TailTrio
 	firstBlock := core.Block{BlockHeader: tailBlockTrio.First.Header}
@@ -998,9 +1599,13 @@ func saveTailBlocks(metadata *core.SnapshotMetadata, sv *state.StoreView, kvstor
 	}
 
 	if secondExt.Height != core.GenesisBlockHeight && secondExt.HasValidatorUpdate {
-		// TODO: this would lead to mismatch between the proven and retrieved validator set,
-		//       need to handle this case properly
-		logger.Warnf("The second block in the tail trio contains validator update, may cause valSet mismatch, height: %v", secondBlock.Height)
+		if metadata.HasNextVCPProof() {
+			// Until the validator update is confirmed, the validator set comes from the first
+			// block. Its VCP proof holds the state trie path to the validator candidate pool.
+			saveVCPProof(&tailBlockTrio.First.Proof, sv.GetDB())
+		} else {
+			logger.Warnf("The second block in the tail trio contains validator update without the next VCP proof, may cause valSet mismatch, height: %v", secondBlock.Height)
+		}
 	}
 
 	return secondBlock.BlockHeader
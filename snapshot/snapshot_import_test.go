@@ -0,0 +1,758 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// testSnapshotRecord is a raw key/value pair written to the state section of a test snapshot.
+type testSnapshotRecord struct {
+	k, v common.Bytes
+}
+
+// writeTestSnapshot writes a V4 snapshot file containing the given metadata and state records.
+func writeTestSnapshot(t *testing.T, filePath string, metadata *core.SnapshotMetadata, records []testSnapshotRecord) {
+	require := require.New(t)
+
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	writeTestSnapshotSections(t, writer, metadata)
+	for _, record := range records {
+		err = core.WriteRecord(writer, record.k, record.v)
+		require.Nil(err)
+	}
+}
+
+// writeTestSnapshotSections writes the header, last checkpoint and metadata sections of a V4 snapshot.
+func writeTestSnapshotSections(t *testing.T, writer *bufio.Writer, metadata *core.SnapshotMetadata) {
+	require := require.New(t)
+
+	err := core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 4})
+	require.Nil(err)
+	err = core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: metadata.TailTrio.Second.Header})
+	require.Nil(err)
+	err = core.WriteMetadata(writer, metadata)
+	require.Nil(err)
+}
+
+// writeValidTestSnapshot writes a V4 snapshot file which passes validation. The tail trio
+// commits to a state whose validator candidate pool consists of the given validators.
+func writeValidTestSnapshot(t *testing.T, filePath string, height uint64, validators ...common.Address) *core.SnapshotMetadata {
+	srcDB := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, srcDB, height, validators...)
+	return writeValidTestSnapshotState(t, filePath, sv, srcDB)
+}
+
+// writeValidTestSnapshotState writes a V4 snapshot file of the given state, which passes
+// validation if the validator candidate pool of the state is not empty.
+func writeValidTestSnapshotState(t *testing.T, filePath string, sv *state.StoreView, srcDB database.Database) *core.SnapshotMetadata {
+	require := require.New(t)
+
+	metadata := createValidTestMetadata(t, sv, srcDB)
+
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	writeTestSnapshotSections(t, writer, metadata)
+	writeStoreViewV3(sv, true, writer, srcDB, common.Hash{})
+
+	return metadata
+}
+
+// createValidTestMetadata creates the metadata of a snapshot of the given state, whose tail
+// trio proves the validator candidate pool of the state and is endorsed by its validators.
+func createValidTestMetadata(t *testing.T, sv *state.StoreView, srcDB database.Database) *core.SnapshotMetadata {
+	tailTrio := createTestTailTrio(sv.Height(), sv.Hash())
+	vcpProof, err := proveVCP(&core.ExtendedBlock{Block: &core.Block{BlockHeader: tailTrio.First.Header}}, srcDB)
+	require.Nil(t, err)
+	tailTrio.First.Proof = *vcpProof
+	endorseTestTailTrio(&tailTrio, getValidatorSetFromSV(sv))
+	return &core.SnapshotMetadata{TailTrio: tailTrio, Version: core.CurrentSnapshotMetadataVersion, VoteScheme: testVoteScheme}
+}
+
+// testVoteScheme is the vote scheme of the test snapshots, whose votes are not signed.
+const testVoteScheme = "unsigned"
+
+// unsignedVoteVerifier accepts the unsigned votes of the test snapshots.
+type unsignedVoteVerifier struct{}
+
+func (unsignedVoteVerifier) VerifyVote(vote core.Vote) error {
+	return nil
+}
+
+func init() {
+	RegisterVoteVerifier(testVoteScheme, unsignedVoteVerifier{})
+}
+
+// endorseTestTailTrio sets the unsigned votes of all the validators for the third block of the trio.
+func endorseTestTailTrio(trio *core.SnapshotBlockTrio, valSet *core.ValidatorSet) {
+	voteSet := core.NewVoteSet()
+	for _, validator := range valSet.Validators() {
+		voteSet.AddVote(core.Vote{Block: trio.Third.Header.Hash(), Height: trio.Third.Header.Height, ID: validator.ID()})
+	}
+	trio.Third.VoteSet = voteSet
+}
+
+// createTestSnapshotState creates and saves a state whose validator candidate pool consists of the given validators.
+func createTestSnapshotState(t *testing.T, db database.Database, height uint64, validators ...common.Address) *state.StoreView {
+	sv := state.NewStoreView(height, common.Hash{}, db)
+	vcp := &core.ValidatorCandidatePool{}
+	for _, validator := range validators {
+		require.Nil(t, vcp.DepositStake(validator, validator, core.MinValidatorStakeDeposit))
+	}
+	sv.UpdateValidatorCandidatePool(vcp)
+	sv.UpdateStakeTransactionHeightList(&types.HeightList{})
+	sv.Save()
+	return sv
+}
+
+// createTestTailTrio creates a tail block trio whose first and second blocks commit to the given state hash.
+func createTestTailTrio(height uint64, stateHash common.Hash) core.SnapshotBlockTrio {
+	first := &core.BlockHeader{ChainID: "testchain", Height: height - 1, StateHash: stateHash, Timestamp: big.NewInt(1)}
+	second := &core.BlockHeader{ChainID: "testchain", Height: height, Parent: first.Hash(), StateHash: stateHash, Timestamp: big.NewInt(2)}
+	second.HCC.BlockHash = first.Hash()
+	third := &core.BlockHeader{ChainID: "testchain", Height: height + 1, Parent: second.Hash(), Timestamp: big.NewInt(3)}
+	third.HCC.BlockHash = second.Hash()
+	return core.SnapshotBlockTrio{
+		First:  core.SnapshotFirstBlock{Header: first},
+		Second: core.SnapshotSecondBlock{Header: second},
+		Third:  core.SnapshotThirdBlock{Header: third, VoteSet: core.NewVoteSet()},
+	}
+}
+
+// createTestSnapshotDir creates a temporary directory for snapshot files.
+func createTestSnapshotDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "snapshot_test")
+	require.Nil(t, err)
+	return dir
+}
+
+func TestLoadEmptyStateSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, stateHash := range []common.Hash{core.EmptyRootHash, {}} {
+		snapshotPath := path.Join(dir, "theta_snapshot-empty")
+		metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, stateHash)}
+		writeTestSnapshot(t, snapshotPath, metadata, nil)
+
+		db := backend.NewMemDatabase()
+		_, _, err := loadSnapshot(snapshotPath, db, "Testing", nil)
+		assert.NotNil(err)
+		assert.Contains(err.Error(), "empty state")
+	}
+}
+
+func TestAutoWriteBatchSize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(defaultWriteBatchSize, autoWriteBatchSize(0))
+	assert.Equal(minWriteBatchSize, autoWriteBatchSize(1024*1024))
+	assert.Equal(16384, autoWriteBatchSize(1024*1024*1024))
+	assert.Equal(maxWriteBatchSize, autoWriteBatchSize(1024*1024*1024*1024))
+
+	opts := &LoadSnapshotOptions{WriteBatchSize: 123}
+	assert.Equal(123, opts.writeBatchSize())
+}
+
+// BenchmarkLoadStateV3WriteBatchSize documents the tradeoff between the write batch size
+// and the snapshot state load throughput.
+func BenchmarkLoadStateV3WriteBatchSize(b *testing.B) {
+	dir, err := ioutil.TempDir("", "snapshot_bench")
+	require.Nil(b, err)
+	defer os.RemoveAll(dir)
+
+	recordsPath := path.Join(dir, "records")
+	file, err := os.Create(recordsPath)
+	require.Nil(b, err)
+	writer := bufio.NewWriter(file)
+	value := make([]byte, avgSnapshotRecordSize)
+	for i := 0; i < 50000; i++ {
+		key := common.BigToHash(big.NewInt(int64(i)))
+		require.Nil(b, core.WriteRecord(writer, key.Bytes(), value))
+	}
+	file.Close()
+
+	for _, batchSize := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("batch-%d", batchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				file, err := os.Open(recordsPath)
+				require.Nil(b, err)
+				err = loadStateV3(file, backend.NewMemDatabase(), nil, batchSize, 0, nil, false)
+				require.Nil(b, err)
+				file.Close()
+			}
+		})
+	}
+}
+
+func TestLoadSubChainSnapshots(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath1 := path.Join(dir, "theta_snapshot-subchain1")
+	metadata1 := writeValidTestSnapshot(t, snapshotPath1, 10, common.HexToAddress("0x1"))
+	snapshotPath2 := path.Join(dir, "theta_snapshot-subchain2")
+	metadata2 := writeValidTestSnapshot(t, snapshotPath2, 10, common.HexToAddress("0x2"), common.HexToAddress("0x3"))
+
+	db := backend.NewMemDatabase()
+	header1, _, err := LoadSnapshot(snapshotPath1, db, &LoadSnapshotOptions{SubChainID: "sub1"})
+	require.Nil(err)
+	assert.Equal(metadata1.TailTrio.Second.Header.Hash(), header1.Hash())
+	header2, _, err := LoadSnapshot(snapshotPath2, db, &LoadSnapshotOptions{SubChainID: "sub2"})
+	require.Nil(err)
+	assert.Equal(metadata2.TailTrio.Second.Header.Hash(), header2.Hash())
+
+	// Each sub-chain's state is only accessible under its own key prefix.
+	sv1 := state.NewStoreView(header1.Height, header1.StateHash, SubChainDB(db, "sub1"))
+	assert.Equal(1, len(sv1.GetValidatorCandidatePool().SortedCandidates))
+	sv2 := state.NewStoreView(header2.Height, header2.StateHash, SubChainDB(db, "sub2"))
+	assert.Equal(2, len(sv2.GetValidatorCandidatePool().SortedCandidates))
+
+	_, err = db.Get(header1.StateHash.Bytes())
+	assert.NotNil(err)
+	_, err = SubChainDB(db, "sub2").Get(header1.StateHash.Bytes())
+	assert.NotNil(err)
+}
+
+func TestCheckGenesisBlockWithExpectedHash(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, core.GenesisBlockHeight, common.HexToAddress("0x1"))
+	genesis := &core.BlockHeader{ChainID: "subchain", Height: core.GenesisBlockHeight, StateHash: sv.Hash(), Timestamp: big.NewInt(1)}
+
+	valSet, err := checkGenesisBlock(genesis, db, &LoadSnapshotOptions{GenesisHash: genesis.Hash()})
+	assert.Nil(err)
+	assert.Equal(1, valSet.Size())
+
+	_, err = checkGenesisBlock(genesis, db, &LoadSnapshotOptions{GenesisHash: common.HexToHash("0x1234")})
+	assert.NotNil(err)
+}
+
+func TestCheckGenesisBlockWithRegisteredHash(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, core.GenesisBlockHeight, common.HexToAddress("0x1"))
+	genesis := &core.BlockHeader{ChainID: "privatenet_registry_test", Height: core.GenesisBlockHeight, StateHash: sv.Hash(), Timestamp: big.NewInt(1)}
+
+	_, err := checkGenesisBlock(genesis, db, nil)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Unknown genesis block hash")
+
+	RegisterGenesisHash(genesis.ChainID, genesis.Hash())
+	valSet, err := checkGenesisBlock(genesis, db, nil)
+	assert.Nil(err)
+	assert.Equal(1, valSet.Size())
+
+	// The hash in the options takes precedence.
+	_, err = checkGenesisBlock(genesis, db, &LoadSnapshotOptions{GenesisHash: common.HexToHash("0x1234")})
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "mismatch")
+}
+
+func TestLoadNonSnapshotFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	// A text file.
+	textPath := path.Join(dir, "text")
+	require.Nil(ioutil.WriteFile(textPath, []byte("definitely not a theta snapshot"), 0644))
+
+	// A chain backup file, which is made of valid records but has no snapshot header.
+	chainPath := path.Join(dir, "theta_chain-1-1")
+	file, err := os.Create(chainPath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	block := &core.BlockHeader{ChainID: "testchain", Height: 1, Timestamp: big.NewInt(1)}
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: block}))
+	file.Close()
+
+	// An empty file.
+	emptyPath := path.Join(dir, "empty")
+	require.Nil(ioutil.WriteFile(emptyPath, []byte{}, 0644))
+
+	for _, filePath := range []string{textPath, chainPath, emptyPath} {
+		_, _, err := loadSnapshot(filePath, backend.NewMemDatabase(), "Testing", nil)
+		require.NotNil(err)
+		assert.Contains(err.Error(), "not a snapshot file")
+	}
+}
+
+func TestLoadHeaderlessV1Snapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	sv.Set(common.BigToHash(big.NewInt(1)).Bytes(), []byte("v"))
+	sv.Save()
+
+	// A version 1 snapshot has no header, and starts with the legacy metadata. The tail trio
+	// commits to a different state, so the load gets to the state check and fails there.
+	filePath := path.Join(dir, "theta_snapshot-v1")
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	require.Nil(core.WriteMetadata(writer, &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}))
+	writeStoreView(sv, true, writer, db, 0)
+	require.Nil(file.Close())
+
+	_, _, err = loadSnapshot(filePath, backend.NewMemDatabase(), "Testing", nil)
+	require.NotNil(err)
+	assert.NotContains(err.Error(), "not a snapshot file")
+	assert.Contains(err.Error(), "StateHash not matching")
+}
+
+// createTestStateV2Records writes a state with the given number of extra entries in the V2
+// snapshot record format, and returns the records along with the state hash.
+func createTestStateV2Records(t testing.TB, numEntries int) ([]byte, common.Hash) {
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	for i := 0; i < numEntries; i++ {
+		key := common.BigToHash(big.NewInt(int64(i)))
+		sv.Set(key.Bytes(), bytes.Repeat(key.Bytes(), 4))
+	}
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(buf), db, 0)
+	return buf.Bytes(), stateHash
+}
+
+func TestLoadStateV2ReuseRecordBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	records, stateHash := createTestStateV2Records(t, 1000)
+
+	for _, reuseRecordBuffer := range []bool{false, true} {
+		db := backend.NewMemDatabase()
+		sv, hash, err := loadStateV2(bytes.NewReader(records), db, nil, 0, &LoadSnapshotOptions{ReuseRecordBuffer: reuseRecordBuffer})
+		require.Nil(err)
+		assert.Equal(stateHash, hash)
+
+		// Re-reading the loaded state should yield the original values.
+		loaded := state.NewStoreView(sv.Height(), hash, db)
+		for i := 0; i < 1000; i++ {
+			key := common.BigToHash(big.NewInt(int64(i)))
+			assert.Equal(bytes.Repeat(key.Bytes(), 4), []byte(loaded.Get(key.Bytes())))
+		}
+	}
+}
+
+func BenchmarkLoadStateV2(b *testing.B) {
+	records, _ := createTestStateV2Records(b, 20000)
+
+	for _, reuseRecordBuffer := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuse-%v", reuseRecordBuffer), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _, err := loadStateV2(bytes.NewReader(records), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{ReuseRecordBuffer: reuseRecordBuffer})
+				require.Nil(b, err)
+			}
+		})
+	}
+}
+
+func TestLoadStateV2AccountStorageProgress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, addr1, "a", "b", "c")
+	setTestContractAccount(sv, db, addr2, "d", "e")
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(buf), db, 0)
+
+	events := []AccountStorageProgress{}
+	opts := &LoadSnapshotOptions{
+		OnAccountStorageProgress: func(progress AccountStorageProgress) {
+			events = append(events, progress)
+		},
+	}
+	_, hash, err := loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, opts)
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+
+	assert.Equal([]AccountStorageProgress{
+		{Address: addr1, Records: 3, Done: true},
+		{Address: addr2, Records: 2, Done: true},
+	}, events)
+}
+
+func TestSafeLoadSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	// The records don't match the state hash committed by the tail trio.
+	corruptPath := path.Join(dir, "theta_snapshot-corrupt")
+	metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}
+	writeTestSnapshot(t, corruptPath, metadata, []testSnapshotRecord{
+		{k: common.Bytes("k1"), v: common.Bytes("v1")},
+	})
+
+	db := backend.NewMemDatabase()
+	_, _, err := LoadSnapshot(corruptPath, db, &LoadSnapshotOptions{SafeLoad: true})
+	assert.NotNil(err)
+	assert.Equal(0, db.Len())
+
+	// Without safe mode, the partially loaded data is left in the database.
+	_, _, err = LoadSnapshot(corruptPath, db, &LoadSnapshotOptions{})
+	assert.NotNil(err)
+	assert.True(db.Len() > 0)
+
+	goodPath := path.Join(dir, "theta_snapshot-good")
+	goodMetadata := writeValidTestSnapshot(t, goodPath, 10, common.HexToAddress("0x1"))
+	db = backend.NewMemDatabase()
+	header, _, err := LoadSnapshot(goodPath, db, &LoadSnapshotOptions{SafeLoad: true})
+	require.Nil(err)
+	assert.Equal(goodMetadata.TailTrio.Second.Header.Hash(), header.Hash())
+}
+
+func TestLoadStateV2StrictRecordOrder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The exported records, including the nested account storages, are in canonical order.
+	db := backend.NewMemDatabase()
+	sv := state.NewStoreView(10, common.Hash{}, db)
+	setTestContractAccount(sv, db, common.HexToAddress("0x1"), "a", "b", "c")
+	setTestContractAccount(sv, db, common.HexToAddress("0x2"), "d", "e")
+	stateHash := sv.Save()
+
+	buf := &bytes.Buffer{}
+	writeStoreView(sv, true, bufio.NewWriter(buf), db, 0)
+	_, hash, err := loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{StrictRecordOrder: true})
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+
+	// Swapping two records yields the same state, but is rejected in the strict mode.
+	buf = &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	require.Nil(core.WriteRecord(writer, []byte{core.SVStart}, core.Itobytes(10)))
+	require.Nil(core.WriteRecord(writer, common.Bytes("key2"), common.Bytes("value2")))
+	require.Nil(core.WriteRecord(writer, common.Bytes("key1"), common.Bytes("value1")))
+	require.Nil(core.WriteRecord(writer, []byte{core.SVEnd}, core.Itobytes(10)))
+	require.Nil(writer.Flush())
+
+	_, _, err = loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{})
+	require.Nil(err)
+	_, _, err = loadStateV2(bytes.NewReader(buf.Bytes()), backend.NewMemDatabase(), nil, 0, &LoadSnapshotOptions{StrictRecordOrder: true})
+	require.NotNil(err)
+	assert.Contains(err.Error(), "not in ascending key order")
+}
+
+func TestLoadStateV2FlushOnHeapThreshold(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	records, stateHash := createTestStateV2Records(t, 1000)
+
+	// A threshold which is never reached does not flush the store view before its end.
+	lenientDB := backend.NewMemDatabase()
+	_, hash, err := loadStateV2(bytes.NewReader(records), lenientDB, nil, 0,
+		&LoadSnapshotOptions{FlushHeapThreshold: math.MaxUint64, HeapCheckInterval: 100})
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+
+	// A tight threshold flushes every 100 records, persisting the intermediate trie nodes too.
+	tightDB := backend.NewMemDatabase()
+	_, hash, err = loadStateV2(bytes.NewReader(records), tightDB, nil, 0,
+		&LoadSnapshotOptions{FlushHeapThreshold: 1, HeapCheckInterval: 100})
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+	assert.True(tightDB.Len() > lenientDB.Len())
+}
+
+func TestLoadStateMemoryLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	opts := &LoadSnapshotOptions{MemoryLimit: 64 * 1024 * 1024, LoadParallelism: 4}
+	assert.Equal(uint64(16*1024*1024), opts.writeBatchBytes())
+	assert.Equal(uint64(48*1024*1024), opts.flushHeapThreshold())
+	assert.Equal(1, opts.loadParallelism())
+	assert.True(opts.writeBatchSize() <= autoWriteBatchSize(opts.MemoryLimit))
+
+	opts.FlushHeapThreshold = 1024
+	assert.Equal(uint64(1024), opts.flushHeapThreshold())
+
+	// A tight memory limit flushes the V2 store view as it is loaded.
+	records, stateHash := createTestStateV2Records(t, 1000)
+	db := backend.NewMemDatabase()
+	_, hash, err := loadStateV2(bytes.NewReader(records), db, nil, 0,
+		&LoadSnapshotOptions{MemoryLimit: 4, HeapCheckInterval: 100})
+	require.Nil(err)
+	assert.Equal(stateHash, hash)
+
+	// The V3 records are all written with byte bounded batches.
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	for i := 0; i < 100; i++ {
+		key := common.BigToHash(big.NewInt(int64(i)))
+		require.Nil(core.WriteRecord(writer, key.Bytes(), key.Bytes()))
+	}
+	require.Nil(writer.Flush())
+	db = backend.NewMemDatabase()
+	require.Nil(loadStateV3(buf, db, nil, maxWriteBatchSize, 200, nil, false))
+	assert.Equal(100, db.Len())
+}
+
+func TestDescribeVCPProof(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, 10, common.HexToAddress("0x1"), common.HexToAddress("0x2"))
+	block := &core.ExtendedBlock{Block: &core.Block{BlockHeader: &core.BlockHeader{Height: 10, StateHash: sv.Hash()}}}
+	proof, err := proveVCP(block, db)
+	require.Nil(err)
+
+	trace, err := DescribeVCPProof(sv.Hash(), proof)
+	require.Nil(err)
+	assert.Nil(trace.Divergence)
+	assert.NotNil(trace.Value)
+	kvs := proof.GetKvs()
+	require.Equal(len(kvs), len(trace.Steps))
+
+	// Tamper with the last node on the path.
+	tampered := kvs[len(kvs)-1]
+	tampered.Val = common.CopyBytes(tampered.Val)
+	tampered.Val[len(tampered.Val)-1] ^= 0xff
+
+	trace, err = DescribeVCPProof(sv.Hash(), proof)
+	require.NotNil(err)
+	require.NotNil(trace.Divergence)
+	assert.Equal(len(kvs)-1, trace.Divergence.Step)
+	assert.Equal(common.BytesToHash(tampered.Key), trace.Divergence.ExpectedHash)
+	assert.NotEqual(trace.Divergence.ExpectedHash, trace.Divergence.ActualHash)
+	if len(kvs) > 1 {
+		assert.True(trace.Divergence.Nibble > 0)
+	}
+	assert.Contains(err.Error(), "hash mismatch")
+
+	// The proof doesn't match a different state root.
+	trace, err = DescribeVCPProof(common.HexToHash("a1"), proof)
+	require.NotNil(err)
+	assert.Equal(0, trace.Divergence.Step)
+	assert.Contains(err.Error(), "missing")
+}
+
+func TestLoadSnapshotFromReader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-stream")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"), common.HexToAddress("0x2"))
+	content, err := ioutil.ReadFile(snapshotPath)
+	require.Nil(err)
+
+	// Feed the snapshot through a pipe in small chunks, as a download would.
+	pr, pw := io.Pipe()
+	go func() {
+		for start := 0; start < len(content); start += 7 {
+			end := start + 7
+			if end > len(content) {
+				end = len(content)
+			}
+			if _, err := pw.Write(content[start:end]); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	streamedDB := backend.NewMemDatabase()
+	header, _, err := LoadSnapshotFromReader(pr, streamedDB, &LoadSnapshotOptions{})
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	fileDB := backend.NewMemDatabase()
+	_, _, err = LoadSnapshot(snapshotPath, fileDB, &LoadSnapshotOptions{})
+	require.Nil(err)
+	require.Equal(fileDB.Len(), streamedDB.Len())
+	for _, key := range fileDB.Keys() {
+		expected, _ := fileDB.Get(key)
+		actual, err := streamedDB.Get(key)
+		require.Nil(err)
+		assert.Equal(expected, actual)
+	}
+
+	// A truncated stream fails to load.
+	_, _, err = LoadSnapshotFromReader(bytes.NewReader(content[:len(content)-3]), backend.NewMemDatabase(), &LoadSnapshotOptions{})
+	assert.NotNil(err)
+
+	_, _, err = LoadSnapshotFromReader(bytes.NewReader(content), backend.NewMemDatabase(), &LoadSnapshotOptions{SafeLoad: true})
+	assert.NotNil(err)
+}
+
+func TestLoadUnsupportedSnapshotVersion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	// A snapshot written by a newer node.
+	newerPath := path.Join(dir, "theta_snapshot-newer")
+	file, err := os.Create(newerPath)
+	require.Nil(err)
+	writer := bufio.NewWriter(file)
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: core.CurrentSnapshotFormatVersion + 1}))
+	require.Nil(writer.Flush())
+	file.Close()
+
+	_, _, err = loadSnapshot(newerPath, backend.NewMemDatabase(), "Testing", nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "upgrade the node")
+
+	// A snapshot with newer metadata.
+	metadataPath := path.Join(dir, "theta_snapshot-newer-metadata")
+	file, err = os.Create(metadataPath)
+	require.Nil(err)
+	writer = bufio.NewWriter(file)
+	metadata := &core.SnapshotMetadata{Version: core.CurrentSnapshotMetadataVersion + 1}
+	metadata.TailTrio.Second.Header = &core.BlockHeader{ChainID: "testchain", Height: 10, Timestamp: big.NewInt(1)}
+	writeTestSnapshotSections(t, writer, metadata)
+	require.Nil(writer.Flush())
+	file.Close()
+
+	_, _, err = loadSnapshot(metadataPath, backend.NewMemDatabase(), "Testing", nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "metadata version")
+}
+
+func TestValidateAndLoad(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	corruptPath := path.Join(dir, "theta_snapshot-corrupt")
+	metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}
+	writeTestSnapshot(t, corruptPath, metadata, []testSnapshotRecord{
+		{k: common.Bytes("k1"), v: common.Bytes("v1")},
+	})
+	db := backend.NewMemDatabase()
+	_, _, err := ValidateAndLoad(corruptPath, "", "", nil, db, nil)
+	assert.NotNil(err)
+	_, err = LoadValidatedSnapshotHeader(db)
+	assert.NotNil(err)
+
+	goodPath := path.Join(dir, "theta_snapshot-good")
+	goodMetadata := writeValidTestSnapshot(t, goodPath, 10, common.HexToAddress("0x1"))
+	db = backend.NewMemDatabase()
+	header, _, err := ValidateAndLoad(goodPath, "", "", nil, db, nil)
+	require.Nil(err)
+	assert.Equal(goodMetadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	validated, err := LoadValidatedSnapshotHeader(db)
+	require.Nil(err)
+	assert.Equal(header.Hash(), validated.Hash())
+	sv := state.NewStoreView(header.Height, header.StateHash, db)
+	assert.NotNil(sv.GetValidatorCandidatePool())
+}
+
+func TestTailTrioValidatorUpdate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The snapshot block at height 10 changes the validator set from {0x1} to {0x2}.
+	firstDB := backend.NewMemDatabase()
+	firstSV := createTestSnapshotState(t, firstDB, 9, common.HexToAddress("0x1"))
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, 10, common.HexToAddress("0x2"))
+	sv.UpdateStakeTransactionHeightList(&types.HeightList{Heights: []uint64{10}})
+	sv.Save()
+
+	tailTrio := createTestTailTrio(10, sv.Hash())
+	tailTrio.First.Header.StateHash = firstSV.Hash()
+	tailTrio.Second.Header.Parent = tailTrio.First.Header.Hash()
+	tailTrio.Second.Header.HCC.BlockHash = tailTrio.First.Header.Hash()
+	vcpProof, err := proveVCP(&core.ExtendedBlock{Block: &core.Block{BlockHeader: tailTrio.First.Header}}, firstDB)
+	require.Nil(err)
+	tailTrio.First.Proof = *vcpProof
+	provenValSet := getValidatorSetFromSV(firstSV)
+	endorseTestTailTrio(&tailTrio, provenValSet)
+
+	// Without the next VCP proof the state validator set doesn't match the proven one.
+	metadata := &core.SnapshotMetadata{TailTrio: tailTrio, Version: core.CurrentSnapshotMetadataVersion, VoteScheme: testVoteScheme}
+	err = checkTailTrio(sv, provenValSet, metadata, nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "does not match")
+
+	nextVCPProof, err := proveVCP(&core.ExtendedBlock{Block: &core.Block{BlockHeader: tailTrio.Second.Header}}, db)
+	require.Nil(err)
+	metadata.NextVCPProof = *nextVCPProof
+	assert.Nil(checkTailTrio(sv, provenValSet, metadata, nil))
+
+	// A next VCP proof of another state is rejected.
+	metadata.NextVCPProof = *vcpProof
+	assert.NotNil(checkTailTrio(sv, provenValSet, metadata, nil))
+	metadata.NextVCPProof = *nextVCPProof
+
+	// The tail trio voted by a validator set other than the one of the first tail block state is
+	// rejected, even with a valid next VCP proof.
+	otherValSet := getValidatorSetFromSV(createTestSnapshotState(t, backend.NewMemDatabase(), 9, common.HexToAddress("0x3")))
+	otherMetadata := *metadata
+	endorseTestTailTrio(&otherMetadata.TailTrio, otherValSet)
+	err = checkTailTrio(sv, otherValSet, &otherMetadata, nil)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "first tail block")
+
+	// The validator candidate pool of the first block is readable once the tail blocks are saved.
+	saveTailBlocks(metadata, sv, kvstore.NewKVStore(db))
+	firstVCP := state.NewStoreView(9, firstSV.Hash(), db).GetValidatorCandidatePool()
+	require.NotNil(firstVCP)
+	assert.True(provenValSet.Equals(consensus.SelectTopStakeHoldersAsValidators(firstVCP)))
+}
@@ -0,0 +1,245 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+// IncrementalStateCheckResult summarizes an incremental snapshot state check.
+type IncrementalStateCheckResult struct {
+	SnapshotBlockHeader *core.BlockHeader
+
+	// DeepVerifiedAccounts are the keys of the changed accounts whose storage was checked.
+	DeepVerifiedAccounts []common.Bytes
+
+	// TrustedAccounts is the number of unchanged accounts whose storage was not checked.
+	TrustedAccounts int
+}
+
+// CheckSnapshotStateIncremental checks the state of a V2 snapshot against a prior snapshot
+// which is already trusted. The top level state of the snapshot block is fully checked against
+// the state hash, while the storage of an account is only checked if the account record differs
+// from the one in the prior snapshot. Only the state is checked: the block trios and the votes
+// proving the snapshot block are not, so this is no substitute for validating the snapshot.
+func CheckSnapshotStateIncremental(snapshotFilePath, priorSnapshotFilePath string) (*IncrementalStateCheckResult, error) {
+	logger.Infof("Incrementally checking the state of snapshot %v against %v", snapshotFilePath, priorSnapshotFilePath)
+
+	priorAccounts, err := loadSnapshotAccountDigests(priorSnapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+
+	reader := bufio.NewReader(snapshotFile)
+	readRecord, metadata, err := readSnapshotV2Sections(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", snapshotFilePath, err)
+	}
+	snapshotBlockHeader := metadata.TailTrio.Second.Header
+	if err := checkNonEmptyState(snapshotBlockHeader); err != nil {
+		return nil, err
+	}
+
+	result := &IncrementalStateCheckResult{
+		SnapshotBlockHeader:  snapshotBlockHeader,
+		DeepVerifiedAccounts: []common.Bytes{},
+	}
+
+	db := backend.NewMemDatabase()
+	depth := 0
+	inSnapshotState := false
+	stateVerified := false
+	var sv, storageSV *state.StoreView
+	var changedAccount *types.Account
+	var changedAccountKey common.Bytes
+	record := core.SnapshotTrieRecord{}
+	for {
+		_, err := readRecord(&record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Failed to read snapshot record, %v", err)
+		}
+
+		if bytes.Equal(record.K, []byte{core.SVStart}) {
+			depth++
+			height := core.Bytestoi(record.V)
+			if depth == 1 {
+				inSnapshotState = height == snapshotBlockHeader.Height
+				if inSnapshotState {
+					sv = state.NewStoreView(height, common.Hash{}, db)
+				}
+			} else if inSnapshotState && changedAccount != nil {
+				storageSV = state.NewStoreView(height, common.Hash{}, db)
+			}
+			continue
+		}
+
+		if bytes.Equal(record.K, []byte{core.SVEnd}) {
+			if depth == 0 {
+				return nil, fmt.Errorf("Missing storeview to handle")
+			}
+			if depth == 1 && inSnapshotState {
+				if changedAccount != nil {
+					return nil, fmt.Errorf("Missing storage for account %v", changedAccount.Address.Hex())
+				}
+				stateHash := sv.Save()
+				if stateHash != snapshotBlockHeader.StateHash {
+					return nil, fmt.Errorf("Storeview root doesn't match the state hash, %v != %v", stateHash.Hex(), snapshotBlockHeader.StateHash.Hex())
+				}
+				stateVerified = true
+			} else if depth == 2 && storageSV != nil {
+				if storageSV.Save() != changedAccount.Root {
+					return nil, fmt.Errorf("Account storage root doesn't match for %v", changedAccount.Address.Hex())
+				}
+				result.DeepVerifiedAccounts = append(result.DeepVerifiedAccounts, changedAccountKey)
+				storageSV = nil
+			}
+			changedAccount = nil
+			depth--
+			continue
+		}
+
+		if !inSnapshotState {
+			continue
+		}
+		if depth == 2 {
+			if storageSV != nil {
+				storageSV.Set(record.K, record.V)
+			}
+			continue
+		}
+
+		if changedAccount != nil {
+			return nil, fmt.Errorf("Missing storage for account %v", changedAccount.Address.Hex())
+		}
+		sv.Set(record.K, record.V)
+		if bytes.HasPrefix(record.K, []byte("ls/a")) {
+			account := &types.Account{}
+			err = types.FromBytes(record.V, account)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse account, %v", err)
+			}
+			if account.Root == (common.Hash{}) {
+				continue
+			}
+			if priorAccounts[string(record.K)] == crypto.Keccak256Hash(record.V) {
+				result.TrustedAccounts++
+			} else {
+				changedAccount = account
+				changedAccountKey = record.K
+			}
+		}
+	}
+
+	if !stateVerified {
+		return nil, fmt.Errorf("Snapshot %v doesn't contain the state at height %v", snapshotFilePath, snapshotBlockHeader.Height)
+	}
+
+	logger.Infof("Snapshot state checked incrementally, %v accounts deep verified, %v accounts trusted",
+		len(result.DeepVerifiedAccounts), result.TrustedAccounts)
+
+	return result, nil
+}
+
+// loadSnapshotAccountDigests returns the digests of the account records in the state of the
+// snapshot block.
+func loadSnapshotAccountDigests(snapshotFilePath string) (map[string]common.Hash, error) {
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+
+	reader := bufio.NewReader(snapshotFile)
+	readRecord, metadata, err := readSnapshotV2Sections(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", snapshotFilePath, err)
+	}
+	snapshotHeight := metadata.TailTrio.Second.Header.Height
+
+	accounts := make(map[string]common.Hash)
+	depth := 0
+	inSnapshotState := false
+	record := core.SnapshotTrieRecord{}
+	for {
+		_, err := readRecord(&record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Failed to read snapshot record, %v", err)
+		}
+
+		if bytes.Equal(record.K, []byte{core.SVStart}) {
+			depth++
+			if depth == 1 {
+				inSnapshotState = core.Bytestoi(record.V) == snapshotHeight
+			}
+		} else if bytes.Equal(record.K, []byte{core.SVEnd}) {
+			depth--
+		} else if inSnapshotState && depth == 1 && bytes.HasPrefix(record.K, []byte("ls/a")) {
+			accounts[string(record.K)] = crypto.Keccak256Hash(record.V)
+		}
+	}
+	return accounts, nil
+}
+
+// readSnapshotV2Sections reads the sections preceding the records of a V2 snapshot, and
+// returns the function to read the records.
+func readSnapshotV2Sections(reader io.Reader) (func(record *core.SnapshotTrieRecord) (uint64, error), *core.SnapshotMetadata, error) {
+	snapshotHeader, metadata, reader, err := readSnapshotSections(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshotHeader.FormatVersion() != 2 {
+		return nil, nil, fmt.Errorf("Version %v snapshots are not supported, expecting a version 2 snapshot", snapshotHeader.FormatVersion())
+	}
+
+	if err = checkRecordFlags(snapshotHeader); err != nil {
+		return nil, nil, err
+	}
+	return newRecordReader(reader, snapshotHeader.CodecFlags()), metadata, nil
+}
+
+// readSnapshotSections reads the header, last checkpoint and metadata sections of a snapshot,
+// and returns the reader of the records that follow.
+func readSnapshotSections(reader io.Reader) (*core.SnapshotHeader, *core.SnapshotMetadata, io.Reader, error) {
+	snapshotHeader, reader, err := readSnapshotHeader(reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if snapshotHeader.IsDiff() {
+		diffBase := core.SnapshotDiffBase{}
+		if _, err = core.ReadRecord(reader, &diffBase); err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to load snapshot diff base, %v", err)
+		}
+	}
+	if snapshotHeader.FormatVersion() >= 2 {
+		lastCheckpoint := core.LastCheckpoint{}
+		if _, err = core.ReadRecord(reader, &lastCheckpoint); err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to load snapshot last checkpoint, %v", err)
+		}
+	}
+	metadata := &core.SnapshotMetadata{}
+	if _, err = core.ReadRecord(reader, metadata); err != nil {
+		return nil, nil, nil, metadataReadError(snapshotHeader, err)
+	}
+	return snapshotHeader, metadata, reader, nil
+}
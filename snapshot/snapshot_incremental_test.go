@@ -0,0 +1,88 @@
+package snapshot
+
+import (
+	"bufio"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+// setTestContractAccount sets an account whose storage holds the given values.
+func setTestContractAccount(sv *state.StoreView, db database.Database, addr common.Address, values ...string) {
+	storage := state.NewStoreView(sv.Height(), common.Hash{}, db)
+	for i, value := range values {
+		storage.Set(common.BigToHash(big.NewInt(int64(i))).Bytes(), common.Bytes(value))
+	}
+	account := &types.Account{
+		Address: addr,
+		Balance: types.NewCoins(0, 0),
+		Root:    storage.Save(),
+	}
+	sv.SetAccount(addr, account)
+}
+
+// writeTestSnapshotV2 writes a V2 snapshot file containing the given state.
+func writeTestSnapshotV2(t *testing.T, filePath string, sv *state.StoreView, db database.Database) {
+	require := require.New(t)
+
+	file, err := os.Create(filePath)
+	require.Nil(err)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	tailTrio := createTestTailTrio(sv.Height(), sv.Hash())
+	require.Nil(core.WriteSnapshotHeader(writer, &core.SnapshotHeader{Magic: core.SnapshotHeaderMagic, Version: 2}))
+	require.Nil(core.WriteLastCheckpoint(writer, &core.LastCheckpoint{CheckpointHeader: tailTrio.Second.Header}))
+	require.Nil(core.WriteMetadata(writer, &core.SnapshotMetadata{TailTrio: tailTrio}))
+	writeStoreView(sv, true, writer, db, 0)
+}
+
+func TestCheckSnapshotStateIncremental(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+
+	priorDB := backend.NewMemDatabase()
+	priorSV := state.NewStoreView(10, common.Hash{}, priorDB)
+	setTestContractAccount(priorSV, priorDB, addr1, "a", "b")
+	setTestContractAccount(priorSV, priorDB, addr2, "c", "d")
+	priorSV.Save()
+	priorPath := path.Join(dir, "theta_snapshot-prior")
+	writeTestSnapshotV2(t, priorPath, priorSV, priorDB)
+
+	// Only the storage of the second account changed.
+	newDB := backend.NewMemDatabase()
+	newSV := state.NewStoreView(20, common.Hash{}, newDB)
+	setTestContractAccount(newSV, newDB, addr1, "a", "b")
+	setTestContractAccount(newSV, newDB, addr2, "c", "e")
+	newSV.Save()
+	newPath := path.Join(dir, "theta_snapshot-new")
+	writeTestSnapshotV2(t, newPath, newSV, newDB)
+
+	result, err := CheckSnapshotStateIncremental(newPath, priorPath)
+	require.Nil(err)
+	assert.Equal(newSV.Hash(), result.SnapshotBlockHeader.StateHash)
+	assert.Equal([]common.Bytes{state.AccountKey(addr2)}, result.DeepVerifiedAccounts)
+	assert.Equal(1, result.TrustedAccounts)
+
+	// Against itself, nothing needs to be deep verified.
+	result, err = CheckSnapshotStateIncremental(newPath, newPath)
+	require.Nil(err)
+	assert.Equal(0, len(result.DeepVerifiedAccounts))
+	assert.Equal(2, result.TrustedAccounts)
+}
@@ -0,0 +1,97 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// SnapshotInfo summarizes a snapshot file.
+type SnapshotInfo struct {
+	FileSize        int64
+	Compression     SnapshotCompression
+	Header          *core.SnapshotHeader
+	MetadataVersion uint
+	BlockHeight     uint64
+	BlockHash       common.Hash
+	StateHash       common.Hash
+	PrunedStateHash common.Hash // state hash without the excluded accounts, empty if not filtered
+	NumBlockTrios   int         // number of proof trios, including the tail trio
+	RecordCount     uint64      // number of state records, including the store view markers of V2 snapshots
+}
+
+// ReadSnapshotMetadata reads the metadata section of the snapshot file without loading the
+// state.
+func ReadSnapshotMetadata(snapshotFilePath string) (*core.SnapshotMetadata, error) {
+	return readSnapshotMetadata(snapshotFilePath)
+}
+
+// InspectSnapshot summarizes the snapshot file. The state records are counted by skipping
+// over them, they are neither decoded nor loaded.
+func InspectSnapshot(snapshotFilePath string) (*SnapshotInfo, error) {
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+	fileInfo, err := snapshotFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, compression, err := newDecompressingReader(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	snapshotHeader, metadata, reader, err := readSnapshotSections(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", snapshotFilePath, err)
+	}
+	blockHeader := metadata.TailTrio.Second.Header
+	if blockHeader == nil {
+		return nil, fmt.Errorf("Snapshot %v has no snapshot block header", snapshotFilePath)
+	}
+	recordCount, err := countSnapshotRecords(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to count the records of snapshot %v: %v", snapshotFilePath, err)
+	}
+
+	return &SnapshotInfo{
+		FileSize:        fileInfo.Size(),
+		Compression:     compression,
+		Header:          snapshotHeader,
+		MetadataVersion: metadata.Version,
+		BlockHeight:     blockHeader.Height,
+		BlockHash:       blockHeader.Hash(),
+		StateHash:       blockHeader.StateHash,
+		PrunedStateHash: metadata.PrunedStateHash,
+		NumBlockTrios:   len(metadata.ProofTrios) + 1,
+		RecordCount:     recordCount,
+	}, nil
+}
+
+// countSnapshotRecords counts the length prefixed records until the end of the reader.
+func countSnapshotRecords(reader io.Reader) (uint64, error) {
+	var count uint64
+	var lenBuf [8]byte
+	for {
+		if _, err := io.ReadFull(reader, lenBuf[:]); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, recordReadError(err)
+		}
+		size := int64(core.Bytestoi(lenBuf[:]))
+		if n, err := io.CopyN(ioutil.Discard, reader, size); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("record %v is truncated, %v of %v bytes read", count, n, size)
+			}
+			return count, recordReadError(err)
+		}
+		count++
+	}
+}
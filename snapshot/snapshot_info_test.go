@@ -0,0 +1,44 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestInspectSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-info")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+
+	readMetadata, err := ReadSnapshotMetadata(snapshotPath)
+	require.Nil(err)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), readMetadata.TailTrio.Second.Header.Hash())
+
+	info, err := InspectSnapshot(snapshotPath)
+	require.Nil(err)
+	assert.Equal(uint(4), info.Header.FormatVersion())
+	assert.Equal(SnapshotCompressionNone, info.Compression)
+	assert.Equal(uint64(10), info.BlockHeight)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), info.BlockHash)
+	assert.Equal(metadata.TailTrio.Second.Header.StateHash, info.StateHash)
+	assert.Equal(len(metadata.ProofTrios)+1, info.NumBlockTrios)
+	assert.True(info.RecordCount > 0)
+
+	// A truncated snapshot is reported.
+	fileInfo, err := os.Stat(snapshotPath)
+	require.Nil(err)
+	require.Nil(os.Truncate(snapshotPath, fileInfo.Size()-1))
+	_, err = InspectSnapshot(snapshotPath)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "truncated")
+}
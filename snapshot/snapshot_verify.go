@@ -0,0 +1,127 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// Discrepancy describes a snapshot record which doesn't match the database.
+type Discrepancy struct {
+	Key           common.Bytes
+	ExpectedValue common.Bytes // value in the snapshot
+	ActualValue   common.Bytes // value in the database, nil if the key is missing
+	Missing       bool
+}
+
+func (d Discrepancy) String() string {
+	if d.Missing {
+		return fmt.Sprintf("Discrepancy{key: %v, missing in DB}", d.Key.String())
+	}
+	return fmt.Sprintf("Discrepancy{key: %v, expected: %v, actual: %v}", d.Key.String(), d.ExpectedValue.String(), d.ActualValue.String())
+}
+
+// ComputeSnapshotHash computes the canonical hash of a snapshot file, which is the SHA-256
+// digest of the entire file content (header, last checkpoint, metadata and all the records)
+// streamed in file order.
+func ComputeSnapshotHash(snapshotFilePath string) (common.Hash, error) {
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer snapshotFile.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, snapshotFile); err != nil {
+		return common.Hash{}, fmt.Errorf("Failed to hash snapshot file %v: %v", snapshotFilePath, err)
+	}
+	return common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// VerifySnapshotMatchesCommitment checks that the canonical hash of the snapshot file matches
+// the snapshot hash committed on-chain, i.e. the node downloaded exactly the approved snapshot.
+func VerifySnapshotMatchesCommitment(snapshotFilePath string, committedHash common.Hash) error {
+	snapshotHash, err := ComputeSnapshotHash(snapshotFilePath)
+	if err != nil {
+		return err
+	}
+	if snapshotHash != committedHash {
+		return fmt.Errorf("Snapshot hash mismatch, committed: %v, calculated: %v", committedHash.Hex(), snapshotHash.Hex())
+	}
+	return nil
+}
+
+// VerifySnapshotAgainstDB streams the state records of the snapshot file and compares each of
+// them against the value stored in the database, without writing to the database. It returns
+// the keys which are missing from the database or have a different value. Only V3 and later
+// snapshots are supported, since the V2 records do not map to the database keys directly.
+func VerifySnapshotAgainstDB(snapshotFilePath string, db database.Database) ([]Discrepancy, error) {
+	snapshotFile, err := os.Open(snapshotFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotFile.Close()
+	var reader io.Reader = bufio.NewReader(snapshotFile)
+
+	snapshotHeader, err := core.ReadSnapshotHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot %v: %v", snapshotFilePath, err)
+	}
+	reader = newSectionReader(reader, snapshotHeader)
+	if snapshotHeader.FormatVersion() < 3 {
+		return nil, fmt.Errorf("Verifying version %v snapshots against the DB is not supported", snapshotHeader.FormatVersion())
+	}
+	lastCheckpoint := core.LastCheckpoint{}
+	if _, err = core.ReadRecord(reader, &lastCheckpoint); err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot last checkpoint, %v", err)
+	}
+	metadata := core.SnapshotMetadata{}
+	if _, err = core.ReadRecord(reader, &metadata); err != nil {
+		return nil, fmt.Errorf("Failed to load snapshot metadata, %v", err)
+	}
+
+	discrepancies := []Discrepancy{}
+	recordReader := core.NewRecordReader(reader)
+	record := core.SnapshotTrieRecord{}
+	for {
+		_, err := recordReader.ReadTrieRecord(&record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Failed to read snapshot record, %v", err)
+		}
+
+		has, err := db.Has(record.K)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			discrepancies = append(discrepancies, Discrepancy{
+				Key:           common.CopyBytes(record.K),
+				ExpectedValue: common.CopyBytes(record.V),
+				Missing:       true,
+			})
+			continue
+		}
+		value, err := db.Get(record.K)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(value, record.V) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Key:           common.CopyBytes(record.K),
+				ExpectedValue: common.CopyBytes(record.V),
+				ActualValue:   value,
+			})
+		}
+	}
+	return discrepancies, nil
+}
@@ -0,0 +1,87 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestVerifySnapshotMatchesCommitment(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-commitment")
+	metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}
+	writeTestSnapshot(t, snapshotPath, metadata, []testSnapshotRecord{
+		{k: common.Bytes("k1"), v: common.Bytes("v1")},
+		{k: common.Bytes("k2"), v: common.Bytes("v2")},
+	})
+
+	content, err := ioutil.ReadFile(snapshotPath)
+	require.Nil(err)
+	sum := sha256.Sum256(content)
+	committedHash := common.BytesToHash(sum[:])
+
+	assert.Nil(VerifySnapshotMatchesCommitment(snapshotPath, committedHash))
+
+	err = VerifySnapshotMatchesCommitment(snapshotPath, common.HexToHash("deadbeef"))
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "mismatch")
+}
+
+func TestVerifySnapshotAgainstDB(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-live")
+	metadata := &core.SnapshotMetadata{TailTrio: createTestTailTrio(10, common.HexToHash("a1"))}
+	writeTestSnapshot(t, snapshotPath, metadata, []testSnapshotRecord{
+		{k: common.Bytes("k1"), v: common.Bytes("v1")},
+		{k: common.Bytes("k2"), v: common.Bytes("v2")},
+		{k: common.Bytes("k3"), v: common.Bytes("v3")},
+	})
+
+	db := backend.NewMemDatabase()
+	require.Nil(db.Put([]byte("k1"), []byte("v1")))
+	require.Nil(db.Put([]byte("k2"), []byte("v2")))
+	require.Nil(db.Put([]byte("k3"), []byte("v3")))
+
+	discrepancies, err := VerifySnapshotAgainstDB(snapshotPath, db)
+	require.Nil(err)
+	assert.Equal(0, len(discrepancies))
+
+	require.Nil(db.Put([]byte("k2"), []byte("v2-modified")))
+	discrepancies, err = VerifySnapshotAgainstDB(snapshotPath, db)
+	require.Nil(err)
+	require.Equal(1, len(discrepancies))
+	assert.Equal(common.Bytes("k2"), discrepancies[0].Key)
+	assert.Equal(common.Bytes("v2"), discrepancies[0].ExpectedValue)
+	assert.Equal(common.Bytes("v2-modified"), discrepancies[0].ActualValue)
+	assert.False(discrepancies[0].Missing)
+
+	require.Nil(db.Delete([]byte("k3")))
+	discrepancies, err = VerifySnapshotAgainstDB(snapshotPath, db)
+	require.Nil(err)
+	require.Equal(2, len(discrepancies))
+	assert.Equal(common.Bytes("k3"), discrepancies[1].Key)
+	assert.True(discrepancies[1].Missing)
+
+	// The database is not modified.
+	value, err := db.Get([]byte("k2"))
+	require.Nil(err)
+	assert.Equal([]byte("v2-modified"), value)
+}
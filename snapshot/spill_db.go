@@ -0,0 +1,239 @@
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+// spillDatabase is a memory-backed database for the snapshot validation, which moves its
+// content to a temporary on-disk database once the size of its content exceeds the spill
+// threshold. A zero threshold never spills.
+type spillDatabase struct {
+	mu        sync.RWMutex
+	mem       *backend.MemDatabase
+	disk      database.Database // the on-disk database, nil until spilled
+	cleanup   func()
+	size      uint64 // approximate size of the written keys and values
+	threshold uint64
+}
+
+var _ database.Database = (*spillDatabase)(nil)
+
+func newSpillDatabase(threshold uint64) *spillDatabase {
+	return &spillDatabase{
+		mem:       backend.NewMemDatabase(),
+		threshold: threshold,
+	}
+}
+
+// current returns the database holding the content. The caller needs to hold the lock.
+func (db *spillDatabase) current() database.Database {
+	if db.disk != nil {
+		return db.disk
+	}
+	return db.mem
+}
+
+// grow accounts for the written bytes, and spills the content to disk if the threshold is
+// exceeded. The caller needs to hold the write lock.
+func (db *spillDatabase) grow(numBytes int) error {
+	db.size += uint64(numBytes)
+	if db.disk != nil || db.threshold == 0 || db.size <= db.threshold {
+		return nil
+	}
+
+	logger.Infof("Validation database exceeds %v bytes, spilling it to disk", db.threshold)
+	disk, cleanup := createTempDB()
+	batch := disk.NewBatch()
+	for _, key := range db.mem.Keys() {
+		value, err := db.mem.Get(key)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		if err = batch.Put(key, value); err != nil {
+			cleanup()
+			return err
+		}
+		refs, _ := db.mem.CountReference(key)
+		for i := 0; i < refs; i++ {
+			if err = batch.Reference(key); err != nil {
+				cleanup()
+				return err
+			}
+		}
+		if batch.ValueSize() >= database.IdealBatchSize {
+			if err = batch.Write(); err != nil {
+				cleanup()
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		cleanup()
+		return err
+	}
+	db.disk = disk
+	db.cleanup = cleanup
+	db.mem = backend.NewMemDatabase() // release the memory
+	return nil
+}
+
+// spilled returns whether the content has been moved to disk.
+func (db *spillDatabase) spilled() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.disk != nil
+}
+
+func (db *spillDatabase) Put(key []byte, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.current().Put(key, value); err != nil {
+		return err
+	}
+	return db.grow(len(key) + len(value))
+}
+
+func (db *spillDatabase) Delete(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.current().Delete(key)
+}
+
+func (db *spillDatabase) Reference(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.current().Reference(key)
+}
+
+func (db *spillDatabase) Dereference(key []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.current().Dereference(key)
+}
+
+func (db *spillDatabase) Get(key []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.current().Get(key)
+}
+
+func (db *spillDatabase) Has(key []byte) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.current().Has(key)
+}
+
+func (db *spillDatabase) CountReference(key []byte) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.current().CountReference(key)
+}
+
+// Close releases the content, removing the on-disk database if any.
+func (db *spillDatabase) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.cleanup != nil {
+		db.cleanup()
+		db.cleanup = nil
+	}
+	db.disk = nil
+	db.mem = backend.NewMemDatabase()
+	db.size = 0
+}
+
+func (db *spillDatabase) NewBatch() database.Batch {
+	return &spillBatch{db: db}
+}
+
+type spillOpType int
+
+const (
+	spillOpPut spillOpType = iota
+	spillOpDelete
+	spillOpReference
+	spillOpDereference
+)
+
+type spillOp struct {
+	opType spillOpType
+	key    []byte
+	value  []byte
+}
+
+// spillBatch buffers the operations, and applies them to whichever database holds the
+// content when it is written.
+type spillBatch struct {
+	db   *spillDatabase
+	ops  []spillOp
+	size int
+}
+
+func (b *spillBatch) Put(key, value []byte) error {
+	b.ops = append(b.ops, spillOp{opType: spillOpPut, key: common.CopyBytes(key), value: common.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *spillBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, spillOp{opType: spillOpDelete, key: common.CopyBytes(key)})
+	b.size++
+	return nil
+}
+
+func (b *spillBatch) Reference(key []byte) error {
+	b.ops = append(b.ops, spillOp{opType: spillOpReference, key: common.CopyBytes(key)})
+	b.size++
+	return nil
+}
+
+func (b *spillBatch) Dereference(key []byte) error {
+	b.ops = append(b.ops, spillOp{opType: spillOpDereference, key: common.CopyBytes(key)})
+	b.size++
+	return nil
+}
+
+func (b *spillBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *spillBatch) Write() error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+
+	batch := b.db.current().NewBatch()
+	written := 0
+	for _, op := range b.ops {
+		var err error
+		switch op.opType {
+		case spillOpPut:
+			err = batch.Put(op.key, op.value)
+			written += len(op.key) + len(op.value)
+		case spillOpDelete:
+			err = batch.Delete(op.key)
+		case spillOpReference:
+			err = batch.Reference(op.key)
+		case spillOpDereference:
+			err = batch.Dereference(op.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	b.Reset()
+	return b.db.grow(written)
+}
+
+func (b *spillBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestSpillDatabase(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := newSpillDatabase(100)
+	defer db.Close()
+
+	require.Nil(db.Put([]byte("k1"), []byte("v1")))
+	require.Nil(db.Reference([]byte("k1")))
+	batch := db.NewBatch()
+	require.Nil(batch.Put([]byte("k2"), []byte("v2")))
+	require.Nil(batch.Reference([]byte("k2")))
+	require.Nil(batch.Reference([]byte("k2")))
+	require.Nil(batch.Write())
+	assert.False(db.spilled())
+
+	// Exceeding the threshold moves the content to disk.
+	batch = db.NewBatch()
+	require.Nil(batch.Put([]byte("k3"), make([]byte, 200)))
+	require.Nil(batch.Write())
+	assert.True(db.spilled())
+
+	value, err := db.Get([]byte("k1"))
+	require.Nil(err)
+	assert.Equal([]byte("v1"), value)
+	refs, err := db.CountReference([]byte("k2"))
+	require.Nil(err)
+	assert.Equal(2, refs)
+	has, err := db.Has([]byte("k3"))
+	require.Nil(err)
+	assert.True(has)
+}
+
+func TestValidateSnapshotInMemory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-in-memory")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+
+	for _, spillThreshold := range []uint64{0, 1} {
+		opts := &LoadSnapshotOptions{ValidateInMemory: true, SpillThreshold: spillThreshold}
+		header, _, err := validateSnapshot(snapshotPath, "", "", opts)
+		require.Nil(err)
+		assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+	}
+}
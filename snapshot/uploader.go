@@ -0,0 +1,283 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+)
+
+// checksumManifestSuffix is the suffix of the checksum manifest of a snapshot, which lists the
+// SHA-256 of the snapshot and of its signature in the sha256sum format.
+const checksumManifestSuffix = ".sha256"
+
+// SnapshotUploader pushes snapshot files to a remote storage, e.g. the bucket behind a CDN.
+type SnapshotUploader interface {
+	// Upload uploads the local file as the object with the given name under the target.
+	Upload(filePath, objectName string) error
+	String() string
+}
+
+// SnapshotUploaderConfig holds the credentials of the uploaders.
+type SnapshotUploaderConfig struct {
+	S3Endpoint        string // empty: the AWS endpoint of the region
+	S3Region          string
+	S3AccessKey       string
+	S3SecretKey       string
+	GCSToken          string // OAuth2 access token
+	HTTPAuthorization string // value of the Authorization header of the HTTP PUT, if not empty
+}
+
+// NewSnapshotUploader creates the uploader of the target, which is s3://<bucket>/<prefix>,
+// gs://<bucket>/<prefix>, or the http(s) URL the files are PUT under.
+func NewSnapshotUploader(target string, config *SnapshotUploaderConfig) (SnapshotUploader, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid snapshot upload target %v: %v", target, err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Missing bucket in snapshot upload target %v", target)
+		}
+		endpoint := config.S3Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", config.S3Region)
+		}
+		return &s3Uploader{
+			endpoint:  strings.TrimRight(endpoint, "/"),
+			bucket:    u.Host,
+			prefix:    prefix,
+			region:    config.S3Region,
+			accessKey: config.S3AccessKey,
+			secretKey: config.S3SecretKey,
+			partSize:  s3PartSize,
+		}, nil
+	case "gs":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Missing bucket in snapshot upload target %v", target)
+		}
+		return &gcsUploader{
+			endpoint: gcsUploadEndpoint,
+			bucket:   u.Host,
+			prefix:   prefix,
+			token:    config.GCSToken,
+		}, nil
+	case "http", "https":
+		return &httpUploader{
+			baseURL:       strings.TrimRight(target, "/"),
+			authorization: config.HTTPAuthorization,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported snapshot upload target %v", target)
+	}
+}
+
+// SnapshotUploaderConfigFromViper returns the uploader credentials specified in the node config.
+func SnapshotUploaderConfigFromViper() *SnapshotUploaderConfig {
+	return &SnapshotUploaderConfig{
+		S3Endpoint:        viper.GetString(common.CfgSnapshotUploadS3Endpoint),
+		S3Region:          viper.GetString(common.CfgSnapshotUploadS3Region),
+		S3AccessKey:       viper.GetString(common.CfgSnapshotUploadS3AccessKey),
+		S3SecretKey:       viper.GetString(common.CfgSnapshotUploadS3SecretKey),
+		GCSToken:          viper.GetString(common.CfgSnapshotUploadGCSToken),
+		HTTPAuthorization: viper.GetString(common.CfgSnapshotUploadHTTPAuthorization),
+	}
+}
+
+// SnapshotUploaders returns the uploaders of the targets specified in the node config.
+func SnapshotUploaders() ([]SnapshotUploader, error) {
+	config := SnapshotUploaderConfigFromViper()
+	uploaders := []SnapshotUploader{}
+	for _, target := range strings.Split(viper.GetString(common.CfgSnapshotUploadTargets), ",") {
+		if target = strings.TrimSpace(target); target == "" {
+			continue
+		}
+		uploader, err := NewSnapshotUploader(target, config)
+		if err != nil {
+			return nil, err
+		}
+		uploaders = append(uploaders, uploader)
+	}
+	return uploaders, nil
+}
+
+// UploadSnapshot writes the checksum manifest of the snapshot, and uploads the snapshot, its
+// signature if any, and the manifest with each uploader. The manifest is uploaded last, so its
+// presence tells the snapshot is complete. All the uploaders are tried, the first error is
+// returned.
+func UploadSnapshot(snapshotFilePath string, uploaders []SnapshotUploader) error {
+	manifestPath, err := WriteChecksumManifest(snapshotFilePath)
+	if err != nil {
+		return err
+	}
+	files := []string{snapshotFilePath}
+	if _, err := os.Stat(signaturePath(snapshotFilePath)); err == nil {
+		files = append(files, signaturePath(snapshotFilePath))
+	}
+	files = append(files, manifestPath)
+
+	var firstErr error
+	for _, uploader := range uploaders {
+		if err := uploadFiles(uploader, files); err != nil {
+			logger.Warn(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		logger.Infof("Uploaded snapshot %v to %v", snapshotFilePath, uploader)
+	}
+	return firstErr
+}
+
+func uploadFiles(uploader SnapshotUploader, files []string) error {
+	for _, file := range files {
+		if err := uploader.Upload(file, path.Base(file)); err != nil {
+			return fmt.Errorf("Failed to upload %v to %v: %v", file, uploader, err)
+		}
+	}
+	return nil
+}
+
+// WriteChecksumManifest writes the SHA-256 of the snapshot, and of its signature if any, next to
+// the snapshot in the sha256sum format, so the downloads can be checked with sha256sum -c. It
+// returns the path of the manifest.
+func WriteChecksumManifest(snapshotFilePath string) (string, error) {
+	files := []string{snapshotFilePath}
+	if _, err := os.Stat(signaturePath(snapshotFilePath)); err == nil {
+		files = append(files, signaturePath(snapshotFilePath))
+	}
+	manifest := &bytes.Buffer{}
+	for _, file := range files {
+		checksum, err := fileChecksum(file)
+		if err != nil {
+			return "", fmt.Errorf("Failed to compute the checksum of %v: %v", file, err)
+		}
+		fmt.Fprintf(manifest, "%v  %v\n", hex.EncodeToString(checksum), path.Base(file))
+	}
+	manifestPath := snapshotFilePath + checksumManifestSuffix
+	if err := ioutil.WriteFile(manifestPath, manifest.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("Failed to write the checksum manifest %v: %v", manifestPath, err)
+	}
+	return manifestPath, nil
+}
+
+func fileChecksum(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// uploadClient has no timeout, the snapshots can take long to upload.
+var uploadClient = &http.Client{}
+
+// newFileRequest creates a request with the file as its body.
+func newFileRequest(method, rawURL, filePath string) (*http.Request, *os.File, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	req, err := http.NewRequest(method, rawURL, f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return req, f, nil
+}
+
+// doUpload sends the request, and returns an error unless the response status is 2xx.
+func doUpload(req *http.Request) error {
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Upload failed with status %v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func objectKey(prefix, objectName string) string {
+	if prefix == "" {
+		return objectName
+	}
+	return prefix + "/" + objectName
+}
+
+// httpUploader PUTs the files under a base URL, e.g. a WebDAV server or a CDN storage API.
+type httpUploader struct {
+	baseURL       string
+	authorization string
+}
+
+func (u *httpUploader) Upload(filePath, objectName string) error {
+	req, f, err := newFileRequest(http.MethodPut, u.baseURL+"/"+url.PathEscape(objectName), filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if u.authorization != "" {
+		req.Header.Set("Authorization", u.authorization)
+	}
+	return doUpload(req)
+}
+
+func (u *httpUploader) String() string {
+	return u.baseURL
+}
+
+const gcsUploadEndpoint = "https://storage.googleapis.com"
+
+// gcsUploader uploads the files with the media upload of the Cloud Storage JSON API.
+type gcsUploader struct {
+	endpoint string
+	bucket   string
+	prefix   string
+	token    string
+}
+
+func (u *gcsUploader) Upload(filePath, objectName string) error {
+	rawURL := fmt.Sprintf("%v/upload/storage/v1/b/%v/o?uploadType=media&name=%v", u.endpoint,
+		url.PathEscape(u.bucket), url.QueryEscape(objectKey(u.prefix, objectName)))
+	req, f, err := newFileRequest(http.MethodPost, rawURL, filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	return doUpload(req)
+}
+
+func (u *gcsUploader) String() string {
+	return "gs://" + u.bucket + "/" + u.prefix
+}
@@ -0,0 +1,274 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3TimeFormat       = "20060102T150405Z"
+	s3DateFormat       = "20060102"
+
+	// s3PartSize is the size of the parts of the multipart uploads. A single PutObject is limited
+	// to 5 GB, and S3 allows at most 10,000 parts of at least 5 MB each but the last one.
+	s3PartSize     = 64 * 1024 * 1024
+	s3MaxPartCount = 10000
+)
+
+// s3Uploader uploads the files with the S3 PutObject API, or with the multipart upload API if
+// they are larger than a part, signed with AWS Signature Version 4. Any S3 compatible storage
+// can be used through the endpoint. The objects are addressed in the path style, i.e.
+// <endpoint>/<bucket>/<key>.
+type s3Uploader struct {
+	endpoint  string
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	partSize  int64
+}
+
+func (u *s3Uploader) Upload(filePath, objectName string) error {
+	rawURL := u.endpoint + "/" + s3URIEncode(u.bucket, true) + "/" + s3URIEncode(objectKey(u.prefix, objectName), false)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() > u.partSize {
+		return u.uploadMultipart(rawURL, filePath, info.Size())
+	}
+
+	req, f, err := newFileRequest(http.MethodPut, rawURL, filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	u.sign(req)
+	return doUpload(req)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// uploadMultipart uploads the file in parts, and aborts the upload on failure so that the
+// parts already uploaded are not kept, and billed, by the storage.
+func (u *s3Uploader) uploadMultipart(rawURL, filePath string, size int64) error {
+	partSize := u.partSize
+	if (size+partSize-1)/partSize > s3MaxPartCount {
+		partSize = (size + s3MaxPartCount - 1) / s3MaxPartCount
+	}
+
+	body, _, err := u.send(http.MethodPost, rawURL+"?uploads", nil, 0)
+	if err != nil {
+		return err
+	}
+	result := &s3InitiateMultipartUploadResult{}
+	if err := xml.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("Failed to parse the multipart upload: %v", err)
+	}
+	if result.UploadID == "" {
+		return fmt.Errorf("Missing upload ID of the multipart upload")
+	}
+	uploadURL := rawURL + "?uploadId=" + url.QueryEscape(result.UploadID)
+
+	err = u.uploadParts(rawURL, result.UploadID, filePath, size, partSize)
+	if err != nil {
+		if _, _, abortErr := u.send(http.MethodDelete, uploadURL, nil, 0); abortErr != nil {
+			logger.Warnf("Failed to abort the multipart upload of %v: %v", filePath, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *s3Uploader) uploadParts(rawURL, uploadID, filePath string, size, partSize int64) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	complete := &s3CompleteMultipartUpload{}
+	for offset, partNumber := int64(0), 1; offset < size; offset, partNumber = offset+partSize, partNumber+1 {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
+		partURL := fmt.Sprintf("%v?partNumber=%v&uploadId=%v", rawURL, partNumber, url.QueryEscape(uploadID))
+		_, header, err := u.send(http.MethodPut, partURL, io.NewSectionReader(f, offset, length), length)
+		if err != nil {
+			return fmt.Errorf("Failed to upload part %v: %v", partNumber, err)
+		}
+		etag := header.Get("ETag")
+		if etag == "" {
+			return fmt.Errorf("Missing ETag of part %v", partNumber)
+		}
+		complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: partNumber, ETag: etag})
+	}
+
+	payload, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	body, _, err := u.send(http.MethodPost, rawURL+"?uploadId="+url.QueryEscape(uploadID),
+		bytes.NewReader(payload), int64(len(payload)))
+	if err != nil {
+		return err
+	}
+	// The completion can fail after the 200 status, with the error in the body.
+	if bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("Failed to complete the multipart upload: %v", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// send sends the signed request, and returns the response body and headers unless the response
+// status is not 2xx.
+func (u *s3Uploader) send(method, rawURL string, body io.Reader, size int64) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.ContentLength = size
+	u.sign(req)
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(respBody) > 512 {
+			respBody = respBody[:512]
+		}
+		return nil, nil, fmt.Errorf("Upload failed with status %v: %v", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, resp.Header, nil
+}
+
+// sign signs the request. The payload is not hashed to avoid reading the snapshot twice, the
+// integrity is covered by the checksum manifest.
+func (u *s3Uploader) sign(req *http.Request) {
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	signS3Request(req, u.accessKey, u.secretKey, u.region, time.Now())
+}
+
+func (u *s3Uploader) String() string {
+	return "s3://" + u.bucket + "/" + u.prefix
+}
+
+// signS3Request sets the Authorization header of the request, signing the host and all the
+// headers already set. The X-Amz-Content-Sha256 header needs to be set by the caller.
+func signS3Request(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%v:%v\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := strings.Join([]string{now.Format(s3DateFormat), region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		now.Format(s3TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{now.Format(s3DateFormat), region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s3SigningAlgorithm, accessKey, scope, signedHeaders, signature))
+}
+
+// s3CanonicalQuery returns the query parameters sorted by name, each encoded.
+func s3CanonicalQuery(req *http.Request) string {
+	params := []string{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			params = append(params, s3URIEncode(name, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// s3URIEncode percent-encodes all the bytes but the unreserved characters, and the slashes
+// unless encodeSlash is set.
+func s3URIEncode(s string, encodeSlash bool) string {
+	encoded := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// verificationCacheDirName is the directory in the node data dir holding the verification
+// cache entries.
+const verificationCacheDirName = "snapshot_verification"
+
+// VerificationCacheEntry records a successful snapshot validation. The entry is keyed by the
+// canonical hash of the snapshot file content, so it is only trusted for the exact content
+// that was validated, regardless of the file path.
+type VerificationCacheEntry struct {
+	SnapshotHash        common.Hash
+	SnapshotBlockHeader *core.BlockHeader
+	Validators          []core.Validator // the validator set proven by the snapshot
+}
+
+// ValidatorSet returns the validator set proven by the snapshot.
+func (e *VerificationCacheEntry) ValidatorSet() *core.ValidatorSet {
+	valSet := core.NewValidatorSet()
+	valSet.SetValidators(e.Validators)
+	return valSet
+}
+
+// verificationCacheDir returns the verification cache dir in the node data dir, empty if
+// the cache is disabled or the data dir is unknown.
+func verificationCacheDir() string {
+	dataPath := viper.GetString(common.CfgDataPath)
+	if !viper.GetBool(common.CfgSnapshotVerificationCache) || dataPath == "" {
+		return ""
+	}
+	return path.Join(dataPath, verificationCacheDirName)
+}
+
+func verificationCachePath(cacheDir string, snapshotHash common.Hash) string {
+	return path.Join(cacheDir, snapshotHash.Hex())
+}
+
+// loadVerificationCache returns the cached validation result of the snapshot with the given
+// content hash, nil if there is none.
+func loadVerificationCache(cacheDir string, snapshotHash common.Hash) *VerificationCacheEntry {
+	raw, err := ioutil.ReadFile(verificationCachePath(cacheDir, snapshotHash))
+	if err != nil {
+		return nil
+	}
+	entry := &VerificationCacheEntry{}
+	if err := rlp.DecodeBytes(raw, entry); err != nil {
+		logger.Warnf("Ignoring invalid snapshot verification cache: %v", err)
+		return nil
+	}
+	if entry.SnapshotHash != snapshotHash || entry.SnapshotBlockHeader == nil {
+		return nil
+	}
+	return entry
+}
+
+// saveVerificationCache atomically saves the verification cache entry of the snapshot.
+func saveVerificationCache(cacheDir string, entry *VerificationCacheEntry) error {
+	raw, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return err
+	}
+	cachePath := verificationCachePath(cacheDir, entry.SnapshotHash)
+	tmpPath := cachePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
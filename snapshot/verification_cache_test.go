@@ -0,0 +1,57 @@
+package snapshot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestValidateSnapshotVerificationCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := createTestSnapshotDir(t)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := path.Join(dir, "theta_snapshot-cached")
+	metadata := writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x1"))
+	opts := &LoadSnapshotOptions{VerificationCacheDir: path.Join(dir, "data", verificationCacheDirName)}
+
+	header, cached, err := validateSnapshot(snapshotPath, "", "", opts)
+	require.Nil(err)
+	assert.False(cached)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	// The unchanged file is served from the cache.
+	header, cached, err = validateSnapshot(snapshotPath, "", "", opts)
+	require.Nil(err)
+	assert.True(cached)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	snapshotHash, err := ComputeSnapshotHash(snapshotPath)
+	require.Nil(err)
+	entry := loadVerificationCache(opts.VerificationCacheDir, snapshotHash)
+	require.NotNil(entry)
+	_, err = entry.ValidatorSet().GetValidator(common.HexToAddress("0x1"))
+	assert.Nil(err)
+
+	// Nothing is written next to the snapshot.
+	_, err = os.Stat(snapshotPath + ".verified")
+	assert.True(os.IsNotExist(err))
+
+	// A modified file is validated again.
+	metadata = writeValidTestSnapshot(t, snapshotPath, 10, common.HexToAddress("0x2"), common.HexToAddress("0x3"))
+	header, cached, err = validateSnapshot(snapshotPath, "", "", opts)
+	require.Nil(err)
+	assert.False(cached)
+	assert.Equal(metadata.TailTrio.Second.Header.Hash(), header.Hash())
+
+	// The cache is not used when disabled.
+	_, cached, err = validateSnapshot(snapshotPath, "", "", &LoadSnapshotOptions{})
+	require.Nil(err)
+	assert.False(cached)
+}
@@ -0,0 +1,69 @@
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thetatoken/theta/core"
+)
+
+// VoteSchemeECDSA is the signature scheme of the current votes, and the default scheme used
+// to verify the snapshot votes.
+const VoteSchemeECDSA = "ecdsa"
+
+// VoteVerifier verifies the signature of a vote under a specific signature scheme.
+type VoteVerifier interface {
+	VerifyVote(vote core.Vote) error
+}
+
+// ecdsaVoteVerifier verifies the ECDSA signed votes.
+type ecdsaVoteVerifier struct{}
+
+func (ecdsaVoteVerifier) VerifyVote(vote core.Vote) error {
+	res := vote.Validate()
+	if !res.IsOK() {
+		return fmt.Errorf("vote is not valid, %v", res)
+	}
+	return nil
+}
+
+var (
+	voteVerifiersLock sync.RWMutex
+	voteVerifiers     = map[string]VoteVerifier{
+		VoteSchemeECDSA: ecdsaVoteVerifier{},
+	}
+)
+
+// RegisterVoteVerifier registers the verifier for the given signature scheme, so that the
+// snapshots whose metadata names the scheme can be verified.
+func RegisterVoteVerifier(scheme string, verifier VoteVerifier) {
+	voteVerifiersLock.Lock()
+	defer voteVerifiersLock.Unlock()
+	voteVerifiers[scheme] = verifier
+}
+
+// getVoteVerifier returns the verifier registered for the signature scheme.
+func getVoteVerifier(scheme string) (VoteVerifier, error) {
+	if scheme == "" {
+		scheme = VoteSchemeECDSA
+	}
+	voteVerifiersLock.RLock()
+	defer voteVerifiersLock.RUnlock()
+	verifier, ok := voteVerifiers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("No vote verifier registered for signature scheme %v", scheme)
+	}
+	return verifier, nil
+}
+
+// snapshotVoteVerifier returns the verifier of the votes in the snapshot, selected by the vote
+// scheme in the snapshot metadata. The metadata predating the vote scheme has ECDSA votes.
+func snapshotVoteVerifier(metadata *core.SnapshotMetadata) (VoteVerifier, error) {
+	return getVoteVerifier(metadata.VoteScheme)
+}
+
+// chainVoteVerifier returns the verifier of the votes signed by the validators of the running
+// chain, which are ECDSA signed.
+func chainVoteVerifier() (VoteVerifier, error) {
+	return getVoteVerifier(VoteSchemeECDSA)
+}
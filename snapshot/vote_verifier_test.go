@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+type mockVoteVerifier struct {
+	verified []core.Vote
+}
+
+func (v *mockVoteVerifier) VerifyVote(vote core.Vote) error {
+	v.verified = append(v.verified, vote)
+	return nil
+}
+
+func TestCheckSnapshotVoteScheme(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	addr := privKey.PublicKey().Address()
+
+	db := backend.NewMemDatabase()
+	sv := createTestSnapshotState(t, db, 9, addr)
+	metadata := &core.SnapshotMetadata{TailTrio: createTestEndorsedTrio(t, 10, privKey, addr),
+		Version: core.CurrentSnapshotMetadataVersion, VoteScheme: "mock"}
+
+	mock := &mockVoteVerifier{}
+	RegisterVoteVerifier("mock", mock)
+
+	// The verifier is selected by the vote scheme of the metadata.
+	err := checkSnapshotV4(sv, metadata, db, nil)
+	require.Nil(err)
+	require.Equal(1, len(mock.verified))
+	assert.Equal(metadata.TailTrio.Third.Header.Hash(), mock.verified[0].Block)
+
+	metadata.VoteScheme = "unknown"
+	err = checkSnapshotV4(sv, metadata, db, nil)
+	assert.NotNil(err)
+
+	// The metadata predating the vote scheme has ECDSA votes.
+	metadata.VoteScheme = ""
+	assert.Nil(checkSnapshotV4(sv, metadata, db, nil))
+}
@@ -601,7 +601,7 @@ func (dt *table) Dereference(key []byte) error {
 }
 
 func (dt *table) CountReference(key []byte) (int, error) {
-	return dt.db.CountReference(key)
+	return dt.db.CountReference(append([]byte(dt.prefix), key...))
 }
 
 func (dt *table) Close() {
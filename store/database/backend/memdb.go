@@ -18,8 +18,12 @@
 package backend
 
 import (
+	"bytes"
 	"sync"
 
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/store"
 	"github.com/thetatoken/theta/store/database"
@@ -85,6 +89,20 @@ func (db *MemDatabase) Keys() [][]byte {
 	return keys
 }
 
+// NewIteratorWithPrefix returns a iterator to iterate over a copy of the database content with a particular prefix.
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	content := memdb.New(comparer.DefaultComparer, 0)
+	for key, value := range db.db {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			content.Put([]byte(key), value)
+		}
+	}
+	return content.NewIterator(nil)
+}
+
 func (db *MemDatabase) Delete(key []byte) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -10,3 +10,10 @@ type Store interface {
 	Delete(key common.Bytes) error
 	Get(key common.Bytes, value interface{}) error
 }
+
+// BufferedStore is a Store which holds the writes in memory until they are committed.
+type BufferedStore interface {
+	Store
+	Commit() error
+	PendingSize() int // amount of data pending to be committed
+}
@@ -0,0 +1,100 @@
+package kvstore
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// BufferedKVStore holds the writes to the DB in memory until Commit is called. The reads
+// see the pending writes. It is not safe for concurrent use.
+type BufferedKVStore struct {
+	db      database.Database
+	pending map[string]common.Bytes // nil value for the deleted keys
+	size    int
+}
+
+// NewBufferedKVStore creates a new instance of BufferedKVStore.
+func NewBufferedKVStore(db database.Database) *BufferedKVStore {
+	return &BufferedKVStore{
+		db:      db,
+		pending: make(map[string]common.Bytes),
+	}
+}
+
+// Put buffers the key/value upsert
+func (bs *BufferedKVStore) Put(key common.Bytes, value interface{}) error {
+	encodedValue, err := EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	bs.setPending(key, encodedValue)
+	return nil
+}
+
+// Delete buffers the key deletion
+func (bs *BufferedKVStore) Delete(key common.Bytes) error {
+	bs.setPending(key, nil)
+	return nil
+}
+
+// Get looks up the pending writes, then the DB, and returns result into value (passed by reference)
+func (bs *BufferedKVStore) Get(key common.Bytes, value interface{}) error {
+	encodedValue, ok := bs.pending[string(key)]
+	if !ok {
+		var err error
+		encodedValue, err = bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+	} else if encodedValue == nil {
+		return store.ErrKeyNotFound
+	}
+	return DecodeValue(encodedValue, value)
+}
+
+// Has checks if the key exists in the pending writes or the DB, without decoding the value
+func (bs *BufferedKVStore) Has(key common.Bytes) (bool, error) {
+	if encodedValue, ok := bs.pending[string(key)]; ok {
+		return encodedValue != nil, nil
+	}
+	return bs.db.Has(key)
+}
+
+// PendingSize returns the amount of data pending to be committed
+func (bs *BufferedKVStore) PendingSize() int {
+	return bs.size
+}
+
+// Commit writes the pending writes to the DB in a single batch
+func (bs *BufferedKVStore) Commit() error {
+	if len(bs.pending) == 0 {
+		return nil
+	}
+	batch := bs.db.NewBatch()
+	for key, encodedValue := range bs.pending {
+		var err error
+		if encodedValue == nil {
+			err = batch.Delete([]byte(key))
+		} else {
+			err = batch.Put([]byte(key), encodedValue)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bs.pending = make(map[string]common.Bytes)
+	bs.size = 0
+	return nil
+}
+
+func (bs *BufferedKVStore) setPending(key common.Bytes, encodedValue common.Bytes) {
+	if old, ok := bs.pending[string(key)]; ok {
+		bs.size -= len(key) + len(old)
+	}
+	bs.pending[string(key)] = encodedValue
+	bs.size += len(key) + len(encodedValue)
+}
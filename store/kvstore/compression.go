@@ -0,0 +1,48 @@
+package kvstore
+
+import (
+	"github.com/golang/snappy"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// compressedValuePrefix marks the values stored compressed. A valid RLP encoding longer than
+// one byte never starts with 0x00, so a compressed value can't be mistaken for a plain one.
+const compressedValuePrefix = 0x00
+
+// Compressed wraps a value to be stored snappy compressed by Put. The reads decompress the
+// values transparently, so the readers don't need to know how a value was stored.
+type Compressed struct {
+	Value interface{}
+}
+
+// EncodeValue encodes the value as stored in the DB.
+func EncodeValue(value interface{}) (common.Bytes, error) {
+	compressed, ok := value.(Compressed)
+	if !ok {
+		return rlp.EncodeToBytes(value)
+	}
+	encodedValue, err := rlp.EncodeToBytes(compressed.Value)
+	if err != nil {
+		return nil, err
+	}
+	return append(common.Bytes{compressedValuePrefix}, snappy.Encode(nil, encodedValue)...), nil
+}
+
+// DecodeValue decodes the value as stored in the DB, compressed or not, into value (passed by
+// reference).
+func DecodeValue(encodedValue common.Bytes, value interface{}) error {
+	if IsCompressed(encodedValue) {
+		decompressed, err := snappy.Decode(nil, encodedValue[1:])
+		if err != nil {
+			return err
+		}
+		encodedValue = decompressed
+	}
+	return rlp.DecodeBytes(encodedValue, value)
+}
+
+// IsCompressed returns whether the value as stored in the DB is compressed.
+func IsCompressed(encodedValue common.Bytes) bool {
+	return len(encodedValue) > 1 && encodedValue[0] == compressedValuePrefix
+}
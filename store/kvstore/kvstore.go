@@ -2,7 +2,6 @@ package kvstore
 
 import (
 	"github.com/thetatoken/theta/common"
-	"github.com/thetatoken/theta/rlp"
 	"github.com/thetatoken/theta/store"
 	"github.com/thetatoken/theta/store/database"
 )
@@ -19,7 +18,7 @@ type KVStore struct {
 
 // Put upserts key/value into DB
 func (store *KVStore) Put(key common.Bytes, value interface{}) error {
-	encodedValue, err := rlp.EncodeToBytes(value)
+	encodedValue, err := EncodeValue(value)
 	if err != nil {
 		return err
 	}
@@ -31,11 +30,21 @@ func (store *KVStore) Delete(key common.Bytes) error {
 	return store.db.Delete(key)
 }
 
+// Has checks if the key exists in DB, without decoding the value
+func (store *KVStore) Has(key common.Bytes) (bool, error) {
+	return store.db.Has(key)
+}
+
+// NewBufferedStore creates a buffered store on top of the same DB
+func (store *KVStore) NewBufferedStore() store.BufferedStore {
+	return NewBufferedKVStore(store.db)
+}
+
 // Get looks up DB with key and returns result into value (passed by reference)
 func (store *KVStore) Get(key common.Bytes, value interface{}) error {
 	encodedValue, err := store.db.Get(key)
 	if err != nil {
 		return err
 	}
-	return rlp.DecodeBytes(encodedValue, value)
+	return DecodeValue(encodedValue, value)
 }
@@ -128,6 +128,34 @@ func mustDecodeNode(hash, buf []byte, cachegen uint16) node {
 
 var DecodeNode = decodeNode
 
+// NodeReferences decodes the RLP encoding of a trie node, and returns the hashes of the child
+// nodes it references along with the values of the leaves embedded in it.
+func NodeReferences(buf []byte) ([]common.Hash, [][]byte, error) {
+	n, err := decodeNode(nil, buf, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	children := []common.Hash{}
+	values := [][]byte{}
+	var gather func(n node)
+	gather = func(n node) {
+		switch n := n.(type) {
+		case *shortNode:
+			gather(n.Val)
+		case *fullNode:
+			for _, child := range n.Children {
+				gather(child)
+			}
+		case hashNode:
+			children = append(children, common.BytesToHash(n))
+		case valueNode:
+			values = append(values, n)
+		}
+	}
+	gather(n)
+	return children, values, nil
+}
+
 // decodeNode parses the RLP encoding of a trie node.
 func decodeNode(hash, buf []byte, cachegen uint16) (node, error) {
 	if len(buf) == 0 {
@@ -0,0 +1,99 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// ProofStep is a proof node visited on the path from the root to the key.
+type ProofStep struct {
+	Hash   common.Hash // hash of the node
+	Nibble int         // offset of the first key nibble resolved by the node
+}
+
+// ProofDivergence describes where the proof verification failed.
+type ProofDivergence struct {
+	Step         int         // index of the failing node on the path
+	Nibble       int         // offset of the key nibble where the path diverged
+	ExpectedHash common.Hash // hash the node is referenced by
+	ActualHash   common.Hash // hash of the node content, empty if the node is missing
+	Reason       string
+}
+
+func (d *ProofDivergence) String() string {
+	return fmt.Sprintf("proof node %d diverges at key nibble %d: %v (expected hash: %v, actual hash: %v)",
+		d.Step, d.Nibble, d.Reason, d.ExpectedHash.Hex(), d.ActualHash.Hex())
+}
+
+// ProofTrace is the node-by-node walk of a Merkle proof against the root hash.
+type ProofTrace struct {
+	Root       common.Hash
+	Steps      []ProofStep
+	Value      []byte           // the proven value, nil if the verification diverged
+	Divergence *ProofDivergence // nil if the proof is valid
+}
+
+// TraceProof walks the proof like VerifyProof, but also checks the content hash of each proof
+// node, and records where the walk diverges from the path to the key.
+func TraceProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) *ProofTrace {
+	hexKey := keybytesToHex(key)
+	rest := hexKey
+	trace := &ProofTrace{Root: rootHash}
+	diverge := func(step int, actualHash, expectedHash common.Hash, reason string, args ...interface{}) *ProofTrace {
+		trace.Divergence = &ProofDivergence{
+			Step:         step,
+			Nibble:       len(hexKey) - len(rest),
+			ExpectedHash: expectedHash,
+			ActualHash:   actualHash,
+			Reason:       fmt.Sprintf(reason, args...),
+		}
+		return trace
+	}
+
+	wantHash := rootHash
+	for i := 0; ; i++ {
+		buf, _ := proofDb.Get(wantHash[:])
+		if buf == nil {
+			return diverge(i, common.Hash{}, wantHash, "node missing from the proof")
+		}
+		actualHash := crypto.Keccak256Hash(buf)
+		if actualHash != wantHash {
+			return diverge(i, actualHash, wantHash, "node hash mismatch")
+		}
+		n, err := decodeNode(wantHash[:], buf, 0)
+		if err != nil {
+			return diverge(i, actualHash, wantHash, "bad node: %v", err)
+		}
+		trace.Steps = append(trace.Steps, ProofStep{Hash: wantHash, Nibble: len(hexKey) - len(rest)})
+
+		tn := n
+	resolve:
+		for {
+			switch n := tn.(type) {
+			case *shortNode:
+				if len(rest) < len(n.Key) || !bytes.Equal(n.Key, rest[:len(n.Key)]) {
+					return diverge(i, actualHash, wantHash, "key not in trie, node path: %x", n.Key)
+				}
+				tn = n.Val
+				rest = rest[len(n.Key):]
+			case *fullNode:
+				if len(rest) == 0 || n.Children[rest[0]] == nil {
+					return diverge(i, actualHash, wantHash, "key not in trie, no child for the nibble")
+				}
+				tn = n.Children[rest[0]]
+				rest = rest[1:]
+			case hashNode:
+				copy(wantHash[:], n)
+				break resolve
+			case valueNode:
+				trace.Value = n
+				return trace
+			default:
+				return diverge(i, actualHash, wantHash, "invalid node %T", tn)
+			}
+		}
+	}
+}
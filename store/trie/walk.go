@@ -0,0 +1,193 @@
+package trie
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+const defaultWalkMaxPending = 1024
+
+// WalkOptions configures the trie walker.
+type WalkOptions struct {
+	// Workers is the number of goroutines resolving and visiting nodes concurrently.
+	// Defaults to the number of CPUs.
+	Workers int
+
+	// MaxPending bounds the number of nodes queued for the workers. When the queue is full,
+	// a worker walks the node's subtree depth-first by itself, so the memory usage stays
+	// flat regardless of the trie size. Defaults to 1024.
+	MaxPending int
+}
+
+// WalkCallback is called for each leaf visited by the walker. It may be called concurrently
+// when more than one worker is used. Returning an error aborts the walk.
+type WalkCallback func(key, value []byte) error
+
+type walkItem struct {
+	node node
+	path []byte // hex encoded path of the node
+}
+
+type walker struct {
+	trie *Trie
+	cb   WalkCallback
+
+	queue   chan walkItem
+	pending sync.WaitGroup
+
+	failed  int32
+	errOnce sync.Once
+	err     error
+
+	numPending  int64 // nodes queued or on the worker stacks
+	peakPending int64
+}
+
+// Walk visits all the leaves of the trie. Unlike the recursive traversals, the walk is
+// iterative and uses an explicit bounded work queue shared by the workers.
+func (t *Trie) Walk(opts WalkOptions, cb WalkCallback) error {
+	_, err := t.walk(opts, cb)
+	return err
+}
+
+// Verify walks the trie to confirm all its nodes are present, and checks that the leaves
+// reproduce the root hash of the trie.
+func (t *Trie) Verify() error {
+	root := t.Hash()
+	rebuilt, err := New(common.Hash{}, NewDatabase(backend.NewMemDatabase()))
+	if err != nil {
+		return err
+	}
+
+	mu := &sync.Mutex{}
+	err = t.Walk(WalkOptions{}, func(key, value []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return rebuilt.TryUpdate(common.CopyBytes(key), common.CopyBytes(value))
+	})
+	if err != nil {
+		return err
+	}
+	if rebuiltRoot := rebuilt.Hash(); rebuiltRoot != root {
+		return fmt.Errorf("Root hash mismatch, expected: %v, recomputed: %v", root.Hex(), rebuiltRoot.Hex())
+	}
+	return nil
+}
+
+func (t *Trie) walk(opts WalkOptions, cb WalkCallback) (*walker, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	maxPending := opts.MaxPending
+	if maxPending <= 0 {
+		maxPending = defaultWalkMaxPending
+	}
+
+	w := &walker{
+		trie:  t,
+		cb:    cb,
+		queue: make(chan walkItem, maxPending),
+	}
+	if t.root == nil {
+		return w, nil
+	}
+
+	w.pending.Add(1)
+	w.addPending(1)
+	w.queue <- walkItem{node: t.root}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+
+	w.pending.Wait()
+	close(w.queue)
+	wg.Wait()
+
+	return w, w.err
+}
+
+func (w *walker) work() {
+	for item := range w.queue {
+		stack := []walkItem{item}
+		for len(stack) > 0 {
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			w.addPending(-1)
+
+			if atomic.LoadInt32(&w.failed) != 0 {
+				continue
+			}
+			children, err := w.visit(current)
+			if err != nil {
+				w.fail(err)
+				continue
+			}
+			// Hand the children over to the other workers if there is room in the queue,
+			// otherwise keep walking them on this worker.
+			for i := len(children) - 1; i >= 0; i-- {
+				w.addPending(1)
+				w.pending.Add(1)
+				select {
+				case w.queue <- children[i]:
+				default:
+					w.pending.Done()
+					stack = append(stack, children[i])
+				}
+			}
+		}
+		w.pending.Done()
+	}
+}
+
+// visit resolves the node, calls the callback if it is a leaf, and returns its children.
+func (w *walker) visit(item walkItem) ([]walkItem, error) {
+	nd, err := w.trie.resolve(item.node, item.path)
+	if err != nil {
+		return nil, err
+	}
+	switch n := nd.(type) {
+	case *shortNode:
+		return []walkItem{{node: n.Val, path: concat(item.path, n.Key...)}}, nil
+	case *fullNode:
+		children := []walkItem{}
+		for i, child := range n.Children {
+			if child != nil {
+				children = append(children, walkItem{node: child, path: concat(item.path, byte(i))})
+			}
+		}
+		return children, nil
+	case valueNode:
+		return nil, w.cb(hexToKeybytes(item.path), n)
+	default:
+		return nil, nil
+	}
+}
+
+func (w *walker) fail(err error) {
+	w.errOnce.Do(func() {
+		w.err = err
+		atomic.StoreInt32(&w.failed, 1)
+	})
+}
+
+func (w *walker) addPending(delta int64) {
+	num := atomic.AddInt64(&w.numPending, delta)
+	for {
+		peak := atomic.LoadInt64(&w.peakPending)
+		if num <= peak || atomic.CompareAndSwapInt64(&w.peakPending, peak, num) {
+			return
+		}
+	}
+}
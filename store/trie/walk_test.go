@@ -0,0 +1,96 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	dbbackend "github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestWalk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	triedb := NewDatabase(dbbackend.NewMemDatabase())
+	tr, _ := New(common.Hash{}, triedb)
+
+	expected := make(map[string][]byte)
+	// Wide: many short keys.
+	for i := 0; i < 5000; i++ {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, uint32(i*7919))
+		expected[string(key)] = append([]byte("wide"), key...)
+	}
+	// Deep: long keys sharing a long common prefix.
+	prefix := bytes.Repeat([]byte{0xab}, 30)
+	for i := 0; i < 200; i++ {
+		key := append(common.CopyBytes(prefix), byte(i), byte(i*3))
+		expected[string(key)] = append([]byte("deep"), key...)
+	}
+	for k, v := range expected {
+		tr.Update([]byte(k), v)
+	}
+	root, err := tr.Commit(nil)
+	require.Nil(err)
+	require.Nil(triedb.Commit(root, false))
+
+	for _, opts := range []WalkOptions{{Workers: 1, MaxPending: 1}, {Workers: 4, MaxPending: 16}, {}} {
+		tr, err := New(root, triedb)
+		require.Nil(err)
+
+		mu := &sync.Mutex{}
+		visited := make(map[string][]byte)
+		w, err := tr.walk(opts, func(key, value []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			visited[string(key)] = common.CopyBytes(value)
+			return nil
+		})
+		require.Nil(err)
+		assert.Equal(expected, visited)
+
+		// The pending nodes are bounded by the queue size plus the per worker stacks, whose
+		// depth is bounded by the key length.
+		if opts.Workers > 0 {
+			maxKeyNibbles := int64(2*32 + 1)
+			bound := int64(opts.MaxPending) + int64(opts.Workers)*maxKeyNibbles*16
+			assert.True(w.peakPending <= bound, "peak pending %v exceeds %v", w.peakPending, bound)
+		}
+	}
+}
+
+func TestWalkMissingNode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	diskdb := dbbackend.NewMemDatabase()
+	triedb := NewDatabase(diskdb)
+	tr, _ := New(common.Hash{}, triedb)
+	for i := 0; i < 100; i++ {
+		tr.Update([]byte{byte(i), 0x1}, []byte{byte(i)})
+	}
+	root, err := tr.Commit(nil)
+	require.Nil(err)
+	require.Nil(triedb.Commit(root, false))
+
+	tr, err = New(root, NewDatabase(diskdb))
+	require.Nil(err)
+	// Remove all the nodes below the root.
+	for _, key := range diskdb.Keys() {
+		if !bytes.Equal(key, root[:]) {
+			require.Nil(diskdb.Delete(key))
+		}
+	}
+	err = tr.Walk(WalkOptions{Workers: 2}, func(key, value []byte) error { return nil })
+	_, ok := err.(*MissingNodeError)
+	assert.True(ok)
+
+	// Empty trie
+	tr, _ = New(common.Hash{}, NewDatabase(dbbackend.NewMemDatabase()))
+	assert.Nil(tr.Walk(WalkOptions{}, func(key, value []byte) error { return nil }))
+}